@@ -0,0 +1,236 @@
+package walrus
+
+import (
+	"errors"
+	"sync"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/renter/proto"
+	"lukechampine.com/us/wallet"
+)
+
+// A WalletAdapter pairs a Client with a seed, allowing a walrus server to be
+// used as the wallet and transaction pool of a us renter or host. Outputs and
+// addresses are managed by the server; transactions are signed locally.
+//
+// A WalletAdapter implements the proto.Wallet and proto.TransactionPool
+// interfaces.
+type WalletAdapter struct {
+	c    *Client
+	seed wallet.Seed
+
+	mu       sync.Mutex
+	reserved map[types.SiacoinOutputID]bool
+	filter   OutputFilter
+	strategy string
+}
+
+var _ proto.Wallet = (*WalletAdapter)(nil)
+var _ proto.TransactionPool = (*WalletAdapter)(nil)
+
+// SetOutputFilter restricts FundTransaction to the outputs selected by f, e.g.
+// to exclude outputs whose metadata marks them as reserved for another
+// purpose.
+func (wa *WalletAdapter) SetOutputFilter(f OutputFilter) {
+	wa.mu.Lock()
+	defer wa.mu.Unlock()
+	wa.filter = f
+}
+
+// SetCoinSelection sets the coin selection strategy used by FundTransaction,
+// e.g. SelectOldest. The default is SelectMinInputs.
+func (wa *WalletAdapter) SetCoinSelection(strategy string) {
+	wa.mu.Lock()
+	defer wa.mu.Unlock()
+	wa.strategy = strategy
+}
+
+// Address derives a new address from the seed and adds it to the wallet.
+func (wa *WalletAdapter) Address() (types.UnlockHash, error) {
+	return wa.c.deriveAddress(wa.seed)
+}
+
+// NewWalletAddress implements proto.Wallet. It is equivalent to Address.
+func (wa *WalletAdapter) NewWalletAddress() (types.UnlockHash, error) {
+	return wa.Address()
+}
+
+// UnspentOutputs implements proto.Wallet. It returns the outputs that
+// FundTransaction may select: those matching the output filter that are
+// neither locked nor reserved by an earlier call to FundTransaction. If the
+// limbo flag is true, the outputs reflect any transactions currently in Limbo.
+func (wa *WalletAdapter) UnspentOutputs(limbo bool) ([]modules.UnspentOutput, error) {
+	wa.mu.Lock()
+	filter := wa.filter
+	wa.mu.Unlock()
+	utxos, err := wa.c.FilterUnspentOutputs(limbo, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	wa.mu.Lock()
+	defer wa.mu.Unlock()
+	var outputs []modules.UnspentOutput
+	for _, o := range utxos {
+		if wa.reserved[o.ID] || o.LockID != "" {
+			continue
+		}
+		outputs = append(outputs, modules.UnspentOutput{
+			ID:                 types.OutputID(o.ID),
+			FundType:           types.SpecifierSiacoinOutput,
+			UnlockHash:         o.UnlockHash,
+			Value:              o.Value,
+			ConfirmationHeight: o.BlockHeight,
+		})
+	}
+	return outputs, nil
+}
+
+// UnlockConditions implements proto.Wallet. It returns the unlock conditions
+// of the specified wallet address.
+func (wa *WalletAdapter) UnlockConditions(addr types.UnlockHash) (types.UnlockConditions, error) {
+	info, err := wa.c.AddressInfo(addr)
+	return info.UnlockConditions, err
+}
+
+// FundTransaction adds inputs to txn worth at least amount, plus a change
+// output if necessary. It returns the IDs of the added inputs, which must be
+// signed, and a function that releases the inputs if the transaction is not
+// broadcast. Miner fees are the caller's responsibility.
+func (wa *WalletAdapter) FundTransaction(txn *types.Transaction, amount types.Currency) ([]crypto.Hash, func(), error) {
+	if amount.IsZero() {
+		return nil, func() {}, nil
+	}
+	wa.mu.Lock()
+	filter, strategy := wa.filter, wa.strategy
+	wa.mu.Unlock()
+	if !validStrategy(strategy) {
+		return nil, nil, errors.New("unknown coin selection strategy")
+	}
+	utxos, err := wa.c.FilterUnspentOutputs(true, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wa.mu.Lock()
+	defer wa.mu.Unlock()
+	unreserved := utxos[:0]
+	for _, o := range utxos {
+		if !wa.reserved[o.ID] && o.LockID == "" {
+			unreserved = append(unreserved, o)
+		}
+	}
+	candidates, _, err := wa.c.coinInputs(unreserved)
+	if err != nil {
+		return nil, nil, err
+	}
+	used, _, change, ok := selectCoins(strategy, amount, types.ZeroCurrency, candidates)
+	if !ok {
+		return nil, nil, errors.New("insufficient funds")
+	}
+	if !change.IsZero() {
+		addr, err := wa.Address()
+		if err != nil {
+			return nil, nil, err
+		}
+		txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{
+			Value:      change,
+			UnlockHash: addr,
+		})
+	}
+	toSign := make([]crypto.Hash, len(used))
+	for i, in := range used {
+		txn.SiacoinInputs = append(txn.SiacoinInputs, in.SiacoinInput)
+		toSign[i] = crypto.Hash(in.ParentID)
+		wa.reserved[in.ParentID] = true
+	}
+	discard := func() {
+		wa.mu.Lock()
+		defer wa.mu.Unlock()
+		for _, in := range used {
+			delete(wa.reserved, in.ParentID)
+		}
+	}
+	return toSign, discard, nil
+}
+
+// SignTransaction signs the inputs of txn whose parent IDs are in toSign. Each
+// input must be controlled by an address in the wallet.
+func (wa *WalletAdapter) SignTransaction(txn *types.Transaction, toSign []crypto.Hash) error {
+	for _, id := range toSign {
+		var uc types.UnlockConditions
+		var found bool
+		for _, in := range txn.SiacoinInputs {
+			if crypto.Hash(in.ParentID) == id {
+				uc, found = in.UnlockConditions, true
+				break
+			}
+		}
+		if !found {
+			return errors.New("no input with ID " + id.String())
+		}
+		info, err := wa.c.AddressInfo(uc.UnlockHash())
+		if err != nil {
+			return err
+		}
+		sig := wallet.StandardTransactionSignature(id)
+		wallet.AppendTransactionSignature(txn, sig, wa.seed.SecretKey(info.KeyIndex))
+	}
+	return nil
+}
+
+// ownsAddress reports whether addr is a wallet address derived from the seed.
+// Addresses that the wallet merely watches are not owned.
+func (wa *WalletAdapter) ownsAddress(addr types.UnlockHash) (bool, error) {
+	info, err := wa.c.AddressInfo(addr)
+	if errors.Is(err, ErrAddressNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	uc := wallet.StandardUnlockConditions(wa.seed.PublicKey(info.KeyIndex))
+	return uc.UnlockHash() == addr, nil
+}
+
+// AcceptTransactionSet implements proto.TransactionPool. It broadcasts txnSet
+// via the server.
+func (wa *WalletAdapter) AcceptTransactionSet(txnSet []types.Transaction) error {
+	_, err := wa.c.Broadcast(txnSet)
+	return err
+}
+
+// UnconfirmedParents returns any parents of txn that are in Limbo.
+func (wa *WalletAdapter) UnconfirmedParents(txn types.Transaction) ([]types.Transaction, error) {
+	limbo, err := wa.c.UnconfirmedParents(txn)
+	if err != nil {
+		return nil, err
+	}
+	parents := make([]types.Transaction, len(limbo))
+	for i := range limbo {
+		parents[i] = limbo[i].Transaction
+	}
+	return parents, nil
+}
+
+// FeeEstimate implements proto.TransactionPool. It returns the server's economy
+// and priority fees per byte.
+func (wa *WalletAdapter) FeeEstimate() (min, max types.Currency, err error) {
+	tiers, err := wa.c.FeeTiers()
+	if err != nil {
+		return types.ZeroCurrency, types.ZeroCurrency, err
+	}
+	return tiers[0].FeePerByte, tiers[len(tiers)-1].FeePerByte, nil
+}
+
+// NewWalletAdapter returns a WalletAdapter that uses c for outputs, addresses,
+// and broadcasting, and seed for signing. The seed must be the seed that the
+// wallet's addresses were derived from.
+func NewWalletAdapter(c *Client, seed wallet.Seed) *WalletAdapter {
+	return &WalletAdapter{
+		c:        c,
+		seed:     seed,
+		reserved: make(map[types.SiacoinOutputID]bool),
+	}
+}
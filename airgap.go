@@ -0,0 +1,175 @@
+package walrus
+
+import (
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// Frame types used in the air-gapped signing workflow.
+const (
+	FrameTypeSigningRequest  = "walrus-txn"
+	FrameTypeSigningResponse = "walrus-sigs"
+)
+
+// DefaultFrameSize is the default number of payload characters per frame. It
+// keeps each frame small enough to be scanned reliably from a screen.
+const DefaultFrameSize = 200
+
+// A SigningRequest is an unsigned transaction, along with the information that
+// an offline signer needs to sign it.
+type SigningRequest struct {
+	Transaction types.Transaction `json:"transaction"`
+	ToSign      []crypto.Hash     `json:"toSign"`
+	KeyIndices  []uint64          `json:"keyIndices"`
+}
+
+// A SigningResponse contains the signatures produced by an offline signer.
+type SigningResponse struct {
+	Signatures []types.TransactionSignature `json:"signatures"`
+}
+
+// frames are base32-encoded so that they fit in the QR alphanumeric character
+// set, which is considerably denser than the byte set.
+var frameEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EncodeFrames splits data into a sequence of frames of the form
+//
+//	UR:<TYPE>/<seq>-<total>/<checksum>/<payload>
+//
+// each of which can be displayed as a QR code. Displaying the frames in a loop
+// produces an animated QR code that can be scanned in any order.
+func EncodeFrames(typ string, data []byte, size int) []string {
+	if size <= 0 {
+		size = DefaultFrameSize
+	}
+	payload := frameEncoding.EncodeToString(data)
+	total := (len(payload) + size - 1) / size
+	if total == 0 {
+		total = 1
+	}
+	checksum := crc32.ChecksumIEEE(data)
+	frames := make([]string, total)
+	for i := range frames {
+		end := (i + 1) * size
+		if end > len(payload) {
+			end = len(payload)
+		}
+		frames[i] = fmt.Sprintf("UR:%s/%d-%d/%08X/%s", strings.ToUpper(typ), i+1, total, checksum, payload[i*size:end])
+	}
+	return frames
+}
+
+// A FrameDecoder reassembles data from a sequence of frames produced by
+// EncodeFrames.
+type FrameDecoder struct {
+	typ      string
+	total    int
+	checksum string
+	parts    map[int]string
+}
+
+// Add adds a frame to the decoder. Duplicate frames are ignored. It returns
+// true once every frame has been added.
+func (d *FrameDecoder) Add(frame string) (bool, error) {
+	frame = strings.ToUpper(strings.TrimSpace(frame))
+	fields := strings.Split(frame, "/")
+	if len(fields) != 4 || !strings.HasPrefix(fields[0], "UR:") {
+		return false, errors.New("malformed frame")
+	}
+	typ := strings.ToLower(strings.TrimPrefix(fields[0], "UR:"))
+	seqTotal := strings.Split(fields[1], "-")
+	if len(seqTotal) != 2 {
+		return false, errors.New("malformed frame sequence")
+	}
+	seq, err1 := strconv.Atoi(seqTotal[0])
+	total, err2 := strconv.Atoi(seqTotal[1])
+	if err1 != nil || err2 != nil || seq < 1 || seq > total {
+		return false, errors.New("malformed frame sequence")
+	}
+
+	if d.parts == nil {
+		d.typ, d.total, d.checksum = typ, total, fields[2]
+		d.parts = make(map[int]string)
+	} else if typ != d.typ || total != d.total || fields[2] != d.checksum {
+		return false, errors.New("frame belongs to a different sequence")
+	}
+	d.parts[seq] = fields[3]
+	return d.Complete(), nil
+}
+
+// Complete returns true if every frame has been added.
+func (d *FrameDecoder) Complete() bool {
+	return d.parts != nil && len(d.parts) == d.total
+}
+
+// Progress returns the number of distinct frames added, and the total number
+// of frames in the sequence.
+func (d *FrameDecoder) Progress() (have, total int) {
+	return len(d.parts), d.total
+}
+
+// Type returns the type of the frame sequence.
+func (d *FrameDecoder) Type() string {
+	return d.typ
+}
+
+// Data returns the reassembled data. It returns an error if the sequence is
+// incomplete or fails its checksum.
+func (d *FrameDecoder) Data() ([]byte, error) {
+	if !d.Complete() {
+		return nil, errors.New("frame sequence is incomplete")
+	}
+	var sb strings.Builder
+	for i := 1; i <= d.total; i++ {
+		sb.WriteString(d.parts[i])
+	}
+	data, err := frameEncoding.DecodeString(sb.String())
+	if err != nil {
+		return nil, err
+	} else if fmt.Sprintf("%08X", crc32.ChecksumIEEE(data)) != d.checksum {
+		return nil, errors.New("checksum mismatch")
+	}
+	return data, nil
+}
+
+// Frames encodes sr as a sequence of frames.
+func (sr SigningRequest) Frames(size int) []string {
+	return EncodeFrames(FrameTypeSigningRequest, encoding.Marshal(sr), size)
+}
+
+// Frames encodes sr as a sequence of frames.
+func (sr SigningResponse) Frames(size int) []string {
+	return EncodeFrames(FrameTypeSigningResponse, encoding.Marshal(sr), size)
+}
+
+// DecodeSigningRequest decodes a SigningRequest from a completed FrameDecoder.
+func DecodeSigningRequest(d *FrameDecoder) (sr SigningRequest, err error) {
+	err = decodeFrames(d, FrameTypeSigningRequest, &sr)
+	return
+}
+
+// DecodeSigningResponse decodes a SigningResponse from a completed
+// FrameDecoder.
+func DecodeSigningResponse(d *FrameDecoder) (sr SigningResponse, err error) {
+	err = decodeFrames(d, FrameTypeSigningResponse, &sr)
+	return
+}
+
+func decodeFrames(d *FrameDecoder, typ string, v interface{}) error {
+	if d.Type() != typ {
+		return fmt.Errorf("expected %v frames, got %v", typ, d.Type())
+	}
+	data, err := d.Data()
+	if err != nil {
+		return err
+	}
+	return encoding.Unmarshal(data, v)
+}
@@ -0,0 +1,258 @@
+package walrus
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// Alert types.
+const (
+	AlertLargeOutflow = "largeOutflow"
+	AlertLowBalance   = "lowBalance"
+	AlertSyncStalled  = "syncStalled"
+)
+
+// An Alert is a notification intended for the wallet's operator, rather than
+// its clients.
+type Alert struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Message   string    `json:"message"`
+}
+
+// An AlertSender delivers alerts, e.g. by email.
+type AlertSender interface {
+	SendAlert(a Alert) error
+}
+
+// An AlertChannel delivers selected types of alerts via a sender.
+type AlertChannel struct {
+	Sender AlertSender
+	// The alert types to deliver. If empty, all alerts are delivered.
+	Types []string
+}
+
+func (ac AlertChannel) wants(typ string) bool {
+	if len(ac.Types) == 0 {
+		return true
+	}
+	for _, t := range ac.Types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// An AlertPolicy determines when the Tracker raises alerts. A zero value
+// disables the corresponding alert.
+type AlertPolicy struct {
+	// Raise an AlertLargeOutflow when a confirmed transaction sends more than
+	// this many hastings out of the wallet, including fees.
+	LargeOutflow types.Currency
+	// Raise an AlertLowBalance when the confirmed balance falls below this
+	// many hastings. The alert is raised again only after the balance has
+	// recovered.
+	LowBalance types.Currency
+	// Raise an AlertSyncStalled when no block has been processed for this
+	// long. The alert is raised again only after a block is processed.
+	SyncStalled time.Duration
+}
+
+// alertQueueSize is the number of alerts that may await delivery before new
+// alerts are dropped.
+const alertQueueSize = 64
+
+type alertState struct {
+	policy   AlertPolicy
+	channels []AlertChannel
+	queue    chan Alert
+
+	mu        sync.Mutex
+	lastBlock time.Time
+	stalled   bool
+	low       bool
+}
+
+// SetAlerts configures the Tracker to raise alerts according to p, delivering
+// them via channels. Delivery is best-effort: if a sender fails, the alert is
+// not retried. It must be called before the Tracker is subscribed to the
+// consensus set.
+func (t *Tracker) SetAlerts(p AlertPolicy, channels []AlertChannel) {
+	t.alerts = &alertState{
+		policy:    p,
+		channels:  channels,
+		queue:     make(chan Alert, alertQueueSize),
+		lastBlock: time.Now(),
+	}
+	go t.alertLoop()
+}
+
+// raiseAlert queues an alert for delivery.
+func (t *Tracker) raiseAlert(typ, format string, args ...interface{}) {
+	if !t.isLeader() {
+		// standbys follow the same blockchain, so the leader raises the
+		// same alerts
+		return
+	}
+	select {
+	case t.alerts.queue <- Alert{Type: typ, Timestamp: time.Now(), Message: fmt.Sprintf(format, args...)}:
+	default:
+	}
+}
+
+// checkAlerts raises any alerts resulting from cc.
+func (t *Tracker) checkAlerts(cc modules.ConsensusChange) {
+	if t.alerts == nil {
+		return
+	}
+	as := t.alerts
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if len(cc.AppliedBlocks) > 0 {
+		as.lastBlock = time.Now()
+		as.stalled = false
+	}
+	// only alert once we've caught up to the current height; otherwise, we'd
+	// alert about every historical transaction
+	if !cc.Synced {
+		return
+	}
+
+	if !as.policy.LargeOutflow.IsZero() {
+		spent := make(map[types.SiacoinOutputID]types.Currency)
+		for _, diff := range cc.SiacoinOutputDiffs {
+			if diff.Direction == modules.DiffRevert {
+				spent[diff.ID] = diff.SiacoinOutput.Value
+			}
+		}
+		for _, b := range cc.AppliedBlocks {
+			for _, txn := range b.Transactions {
+				var in, out types.Currency
+				for _, sci := range txn.SiacoinInputs {
+					if t.w.OwnsAddress(sci.UnlockConditions.UnlockHash()) {
+						in = in.Add(spent[sci.ParentID])
+					}
+				}
+				for _, sco := range txn.SiacoinOutputs {
+					if t.w.OwnsAddress(sco.UnlockHash) {
+						out = out.Add(sco.Value)
+					}
+				}
+				if in.Cmp(out) > 0 {
+					if outflow := in.Sub(out); outflow.Cmp(as.policy.LargeOutflow) > 0 {
+						t.raiseAlert(AlertLargeOutflow, "Transaction %v sent %v SC out of the wallet", txn.ID(), formatSC(outflow))
+					}
+				}
+			}
+		}
+	}
+
+	if !as.policy.LowBalance.IsZero() {
+		bal := t.w.Balance(false)
+		low := bal.Cmp(as.policy.LowBalance) < 0
+		if low && !as.low {
+			t.raiseAlert(AlertLowBalance, "Balance is %v SC, below the threshold of %v SC", formatSC(bal), formatSC(as.policy.LowBalance))
+		}
+		as.low = low
+	}
+}
+
+// checkStalled raises an AlertSyncStalled if no block has been processed
+// within the policy's limit.
+func (t *Tracker) checkStalled() {
+	as := t.alerts
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if since := time.Since(as.lastBlock); since > as.policy.SyncStalled && !as.stalled {
+		as.stalled = true
+		t.raiseAlert(AlertSyncStalled, "No new blocks for %v", since.Round(time.Second))
+	}
+}
+
+func (t *Tracker) alertLoop() {
+	as := t.alerts
+	var stallCheck <-chan time.Time
+	if as.policy.SyncStalled > 0 {
+		interval := as.policy.SyncStalled / 4
+		if interval < time.Second {
+			interval = time.Second
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		stallCheck = ticker.C
+	}
+	for {
+		select {
+		case a := <-as.queue:
+			for _, ac := range as.channels {
+				if ac.wants(a.Type) {
+					ac.Sender.SendAlert(a)
+				}
+			}
+		case <-stallCheck:
+			t.checkStalled()
+		case <-t.closed:
+			return
+		}
+	}
+}
+
+// SMTPAlertSender delivers alerts by email.
+type SMTPAlertSender struct {
+	// The host:port of the SMTP server.
+	Addr string
+	// If set, the sender authenticates with the PLAIN mechanism, which
+	// requires TLS unless the server is on localhost.
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// SendAlert implements AlertSender.
+func (s *SMTPAlertSender) SendAlert(a Alert) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %v\r\n", s.From)
+	fmt.Fprintf(&msg, "To: %v\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&msg, "Subject: walrus: %v\r\n", a.Type)
+	fmt.Fprintf(&msg, "Date: %v\r\n", a.Timestamp.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%v\r\n", a.Message)
+	return smtp.SendMail(s.Addr, auth, s.From, s.To, msg.Bytes())
+}
+
+// SlackAlertSender delivers alerts to a Slack channel via an incoming
+// webhook.
+type SlackAlertSender struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+// SendAlert implements AlertSender.
+func (s *SlackAlertSender) SendAlert(a Alert) error {
+	c := s.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	return postJSON(c, s.WebhookURL, http.Header{}, map[string]string{
+		"text": fmt.Sprintf("*walrus: %v*\n%v", a.Type, a.Message),
+	})
+}
@@ -0,0 +1,187 @@
+package walrus
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+	"lukechampine.com/us/wallet"
+)
+
+// An AnnotationRequest describes a newly-confirmed transaction relevant to the
+// wallet.
+type AnnotationRequest struct {
+	TransactionID types.TransactionID `json:"transactionID"`
+	Transaction   types.Transaction   `json:"transaction"`
+	BlockHeight   types.BlockHeight   `json:"blockHeight"`
+	Timestamp     time.Time           `json:"timestamp"`
+}
+
+// An Annotator enriches transactions with data from an external service, such
+// as a customer ID or a risk score. The returned annotation must be valid
+// JSON; it is stored verbatim.
+type Annotator interface {
+	Annotate(req AnnotationRequest) (json.RawMessage, error)
+}
+
+// HTTPAnnotator annotates transactions by POSTing each AnnotationRequest to a
+// URL and storing the JSON response body.
+type HTTPAnnotator struct {
+	URL    string
+	Client *http.Client
+}
+
+// maxAnnotationSize is the maximum size of an annotation, in bytes.
+const maxAnnotationSize = 64 * 1024
+
+// Annotate implements Annotator.
+func (a *HTTPAnnotator) Annotate(ar AnnotationRequest) (json.RawMessage, error) {
+	c := a.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	js, _ := json.Marshal(ar)
+	resp, err := c.Post(a.URL, "application/json", bytes.NewReader(js))
+	if err != nil {
+		return nil, err
+	}
+	defer io.Copy(ioutil.Discard, resp.Body)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxAnnotationSize+1))
+	if err != nil {
+		return nil, err
+	} else if resp.StatusCode != http.StatusOK {
+		if len(body) > 1024 {
+			body = body[:1024]
+		}
+		return nil, fmt.Errorf("%v: %s", resp.Status, body)
+	} else if len(body) > maxAnnotationSize {
+		return nil, errors.New("annotation is too large")
+	} else if !json.Valid(body) {
+		return nil, errors.New("annotation is not valid JSON")
+	}
+	return body, nil
+}
+
+// SetAnnotator configures the Tracker to annotate each newly-confirmed
+// transaction relevant to the wallet using a. Requests that fail are retried
+// after the next block. It must be called before the Tracker is subscribed to
+// the consensus set.
+func (t *Tracker) SetAnnotator(a Annotator) {
+	t.annotator = a
+	go t.annotateLoop()
+	t.notifyAnnotate()
+}
+
+// Annotation returns the annotation for the specified transaction, if any.
+func (t *Tracker) Annotation(txid types.TransactionID) (annotation json.RawMessage, ok bool) {
+	t.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucketAnnotations).Get(txid[:]); v != nil {
+			annotation = append(json.RawMessage(nil), v...)
+			ok = true
+		}
+		return nil
+	})
+	return
+}
+
+func (t *Tracker) notifyAnnotate() {
+	select {
+	case t.annotateSignal <- struct{}{}:
+	default:
+	}
+}
+
+// isRelevant reports whether txn spends or creates an output belonging to w.
+// The outputs it spends must already be recorded by applyFlows.
+func isRelevant(tx *bolt.Tx, w *wallet.SeedWallet, txn types.Transaction) bool {
+	outputs := tx.Bucket(bucketOutputs)
+	for _, sci := range txn.SiacoinInputs {
+		if outputs.Get(sci.ParentID[:]) != nil {
+			return true
+		}
+	}
+	for _, sco := range txn.SiacoinOutputs {
+		if w.OwnsAddress(sco.UnlockHash) {
+			return true
+		}
+	}
+	for _, sfo := range txn.SiafundOutputs {
+		if w.OwnsAddress(sfo.UnlockHash) {
+			return true
+		}
+	}
+	return false
+}
+
+// queueAnnotations queues the relevant transactions in the applied blocks of
+// cc, the first of which is at the specified height, for annotation.
+func (t *Tracker) queueAnnotations(tx *bolt.Tx, cc modules.ConsensusChange, height types.BlockHeight) error {
+	if t.annotator == nil {
+		return nil
+	}
+	queue := tx.Bucket(bucketAnnotationQueue)
+	for i, b := range cc.AppliedBlocks {
+		for _, txn := range b.Transactions {
+			if !isRelevant(tx, t.w, txn) {
+				continue
+			}
+			txid := txn.ID()
+			err := putJSON(queue, txid[:], AnnotationRequest{
+				TransactionID: txid,
+				Transaction:   txn,
+				BlockHeight:   height + types.BlockHeight(i),
+				Timestamp:     time.Unix(int64(b.Timestamp), 0),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (t *Tracker) annotateLoop() {
+	for {
+		select {
+		case <-t.annotateSignal:
+		case <-t.closed:
+			return
+		}
+		if !t.isLeader() {
+			continue
+		}
+		var queued []AnnotationRequest
+		t.db.View(func(tx *bolt.Tx) error {
+			return tx.Bucket(bucketAnnotationQueue).ForEach(func(_, v []byte) error {
+				var ar AnnotationRequest
+				if err := json.Unmarshal(v, &ar); err != nil {
+					return err
+				}
+				queued = append(queued, ar)
+				return nil
+			})
+		})
+		for _, ar := range queued {
+			annotation, err := t.annotator.Annotate(ar)
+			if err != nil {
+				// try again after the next block
+				break
+			}
+			t.db.Update(func(tx *bolt.Tx) error {
+				if err := tx.Bucket(bucketAnnotations).Put(ar.TransactionID[:], annotation); err != nil {
+					return err
+				}
+				return tx.Bucket(bucketAnnotationQueue).Delete(ar.TransactionID[:])
+			})
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"unsafe"
 
 	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/types"
 	"lukechampine.com/us/wallet"
 )
@@ -100,17 +101,438 @@ type encodedTransaction struct {
 	} `json:"transactionSignatures,omitempty"`
 }
 
-type responseAddressesAddr wallet.SeedAddressInfo
+type responseAddressesAddr struct {
+	wallet.SeedAddressInfo
+	Labels []string
+}
 
 // MarshalJSON implements json.Marshaler.
 func (r responseAddressesAddr) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
 		UnlockConditions encodedUnlockConditions `json:"unlockConditions"`
 		KeyIndex         uint64                  `json:"keyIndex"`
-	}{encodedUnlockConditions(r.UnlockConditions), r.KeyIndex})
+		Labels           []string                `json:"labels,omitempty"`
+	}{encodedUnlockConditions(r.UnlockConditions), r.KeyIndex, r.Labels})
+}
+
+// ResponseOwnership is the response type for the /addresses/:addr/ownership
+// endpoint.
+type ResponseOwnership struct {
+	// The proof, without any signatures.
+	Proof OwnershipProof `json:"proof"`
+	// The hash to sign, i.e. Proof.SigHash().
+	SigHash crypto.Hash `json:"sigHash"`
+	// The seed index of the address's key.
+	KeyIndex uint64 `json:"keyIndex"`
+}
+
+// ResponseOwnershipVerify is the response type for the /ownership/verify
+// endpoint.
+type ResponseOwnershipVerify struct {
+	Valid bool `json:"valid"`
+	// Why the proof is invalid, if it is.
+	Error string `json:"error,omitempty"`
+}
+
+// RequestPublicKeys is the request type for the /pubkeys endpoint.
+type RequestPublicKeys struct {
+	// The seed index of the first key.
+	StartIndex uint64 `json:"startIndex"`
+	// Consecutive public keys, in the form "ed25519:<hex>".
+	PublicKeys []string `json:"publicKeys"`
+}
+
+// RequestInheritance is the request type for the POST /inheritance endpoint.
+type RequestInheritance struct {
+	Beneficiary types.UnlockHash `json:"beneficiary"`
+	// A signed transaction set paying the beneficiary.
+	Transactions []types.Transaction `json:"transactions"`
+	// The hex-encoded ed25519 public key that signs heartbeats.
+	HeartbeatKey string `json:"heartbeatKey"`
+	// The maximum time between heartbeats, e.g. "720h".
+	Period string `json:"period"`
+}
+
+// RequestHeartbeat is the request type for the POST /inheritance/heartbeat
+// and DELETE /inheritance endpoints.
+type RequestHeartbeat struct {
+	Timestamp time.Time `json:"timestamp"`
+	// The hex-encoded ed25519 signature of the timestamp.
+	Signature string `json:"signature"`
+}
+
+// RequestCancelWithdrawal is the request type for the DELETE
+// /vault/withdrawals/:id endpoint.
+type RequestCancelWithdrawal struct {
+	Timestamp time.Time `json:"timestamp"`
+	// The hex-encoded ed25519 signature of the ID and timestamp, made with the
+	// vault's recovery key.
+	Signature string `json:"signature"`
 }
 
-type responseBlockRewards []wallet.BlockReward
+// RequestDeposit is the request type for the POST /deposits endpoint.
+type RequestDeposit struct {
+	wallet.SeedAddressInfo
+	Reference string `json:"reference"`
+	// The number of confirmations required before a payment to the address
+	// is considered final. If zero, a default of 6 is used.
+	Confirmations uint64 `json:"confirmations,omitempty"`
+	// Optional; see Deposit.
+	Amount          types.Currency `json:"amount"`
+	Expiry          time.Time      `json:"expiry"`
+	Reserve         bool           `json:"reserve,omitempty"`
+	ReserveDuration string         `json:"reserveDuration,omitempty"`
+	Callback        string         `json:"callback,omitempty"`
+	CallbackSecret  string         `json:"callbackSecret,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r RequestDeposit) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		UnlockConditions encodedUnlockConditions `json:"unlockConditions"`
+		KeyIndex         uint64                  `json:"keyIndex"`
+		Reference        string                  `json:"reference"`
+		Confirmations    uint64                  `json:"confirmations,omitempty"`
+		Amount           types.Currency          `json:"amount"`
+		Expiry           time.Time               `json:"expiry"`
+		Reserve          bool                    `json:"reserve,omitempty"`
+		ReserveDuration  string                  `json:"reserveDuration,omitempty"`
+		Callback         string                  `json:"callback,omitempty"`
+		CallbackSecret   string                  `json:"callbackSecret,omitempty"`
+	}{encodedUnlockConditions(r.UnlockConditions), r.KeyIndex, r.Reference,
+		r.Confirmations, r.Amount, r.Expiry, r.Reserve, r.ReserveDuration,
+		r.Callback, r.CallbackSecret})
+}
+
+// RequestDepositCallback is the request type for the PUT
+// /deposits/:addr/callback endpoint.
+type RequestDepositCallback struct {
+	// If empty, callbacks are disabled for the deposit.
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// RequestBatchItem is an element of the request type for the /batch
+// endpoint.
+type RequestBatchItem struct {
+	Method string `json:"method"`
+	// The path and query string, e.g. "/utxos?limbo=true".
+	Route string          `json:"route"`
+	Body  json.RawMessage `json:"body,omitempty"`
+}
+
+// ResponseBatchItem is an element of the response type for the /batch
+// endpoint.
+type ResponseBatchItem struct {
+	Status int `json:"status"`
+	// The response body, if the request succeeded. Bodies that are not JSON
+	// are encoded as JSON strings.
+	Body json.RawMessage `json:"body,omitempty"`
+	// The error message, if the request failed.
+	Error string `json:"error,omitempty"`
+}
+
+// ResponseDBVerify is the response type for the /db/verify endpoint.
+type ResponseDBVerify struct {
+	VerifyReport
+	// Whether the wallet's index was rebuilt.
+	Repaired bool `json:"repaired"`
+}
+
+// ResponseDeposit is an element of the response type for the GET /deposits
+// endpoint.
+type ResponseDeposit struct {
+	Deposit
+	Received     types.Currency        `json:"received"`
+	Transactions []types.TransactionID `json:"transactions"`
+}
+
+// ResponseCheckout is the response type for the /deposits/:addr/checkout
+// endpoint.
+type ResponseCheckout struct {
+	Reference string           `json:"reference"`
+	Address   types.UnlockHash `json:"address"`
+	URI       string           `json:"uri"`
+	// QR codes encoding URI, as a PNG image and an SVG document.
+	QRPNG    []byte         `json:"qrPNG"`
+	QRSVG    string         `json:"qrSVG"`
+	Amount   types.Currency `json:"amount"`
+	AmountSC string         `json:"amountSC"`
+	// Only present if a fiat currency was requested.
+	Fiat     *ResponseCheckoutFiat `json:"fiat,omitempty"`
+	Received types.Currency        `json:"received"`
+	Expiry   time.Time             `json:"expiry"`
+	Expired  bool                  `json:"expired"`
+}
+
+// ResponseCheckoutFiat is the fiat value of a checkout amount.
+type ResponseCheckoutFiat struct {
+	Currency string  `json:"currency"`
+	Rate     float64 `json:"rate"`
+	Amount   float64 `json:"amount"`
+}
+
+// ResponseConsolidation is the response type for the /consolidation endpoint.
+type ResponseConsolidation struct {
+	Policy ConsolidationPolicy `json:"policy"`
+	Fee    ResponseFeeTier     `json:"fee"`
+	// The unsigned consolidation transaction. Each input should be signed
+	// with the key at the corresponding index in KeyIndices.
+	Transaction types.Transaction `json:"transaction"`
+	KeyIndices  []uint64          `json:"keyIndices"`
+}
+
+// RequestConsolidate is the request type for the /consolidate endpoint.
+type RequestConsolidate struct {
+	// Outputs worth less than Threshold are consolidated.
+	Threshold types.Currency `json:"threshold"`
+	// The addresses that receive the consolidated value, which is divided
+	// evenly among them.
+	Destinations []types.UnlockHash `json:"destinations"`
+	// The maximum number of outputs spent. If zero, as many outputs are spent
+	// as fit in a single transaction.
+	MaxInputs int `json:"maxInputs"`
+	// A fee tier or an explicit fee in hastings per byte; see /fee/tiers.
+	Fee string `json:"fee"`
+	// If non-zero, the consolidation is deferred while the fee exceeds this
+	// value, in hastings per byte.
+	MaxFeePerByte types.Currency `json:"maxFeePerByte"`
+}
+
+// ResponseConsolidate is the response type for the /consolidate endpoint.
+type ResponseConsolidate struct {
+	Fee ResponseFeeTier `json:"fee"`
+	// The unsigned consolidation transaction. Each input should be signed
+	// with the key at the corresponding index in KeyIndices.
+	Transaction types.Transaction `json:"transaction"`
+	KeyIndices  []uint64          `json:"keyIndices"`
+	// The number of outputs below the threshold that did not fit in the
+	// transaction, and can be consolidated by a later request.
+	Remaining int `json:"remaining"`
+}
+
+// RequestBump is the request type for the POST /limbo/:id/bump endpoint.
+type RequestBump struct {
+	// A fee tier or an explicit fee in hastings per byte; see /fee/tiers.
+	// Defaults to FeeTierPriority.
+	Fee string `json:"fee"`
+	// The address that receives any change if inputs must be added to pay
+	// the fee. Defaults to the address of the original change output.
+	ChangeAddress types.UnlockHash `json:"changeAddress"`
+}
+
+// ResponseBump is the response type for the POST /limbo/:id/bump endpoint.
+type ResponseBump struct {
+	Fee ResponseFeeTier `json:"fee"`
+	// The unsigned replacement transaction. Each input should be signed with
+	// the key at the corresponding index in KeyIndices.
+	Transaction types.Transaction `json:"transaction"`
+	KeyIndices  []uint64          `json:"keyIndices"`
+	// The ID of the transaction being replaced.
+	Replaces types.TransactionID `json:"replaces"`
+}
+
+// RequestTemplateBuild is the request type for the POST
+// /templates/:name/build endpoint.
+type RequestTemplateBuild struct {
+	// The amount that percentages are taken of. Required if the template has
+	// percentage recipients.
+	Total types.Currency `json:"total"`
+	// Overrides the template's change address, if set.
+	ChangeAddress types.UnlockHash `json:"changeAddress"`
+	// A fee tier or an explicit fee in hastings per byte; see /fee/tiers.
+	Fee string `json:"fee"`
+	// Values for the placeholders in the template's memo.
+	Vars map[string]string `json:"vars"`
+	// Restricts which outputs may fund the transaction.
+	Outputs OutputFilter `json:"outputs"`
+}
+
+// ResponseTemplateBuild is the response type for the POST
+// /templates/:name/build endpoint.
+type ResponseTemplateBuild struct {
+	Template TransactionTemplate `json:"template"`
+	Fee      ResponseFeeTier     `json:"fee"`
+	// The unsigned transaction. Each input should be signed with the key at
+	// the corresponding index in KeyIndices.
+	Transaction types.Transaction `json:"transaction"`
+	KeyIndices  []uint64          `json:"keyIndices"`
+	// The expanded memo, which is also stored as the transaction's memo.
+	Memo string `json:"memo"`
+}
+
+// RequestConstruct is the request type for the /construct endpoint.
+type RequestConstruct struct {
+	Outputs []types.SiacoinOutput `json:"outputs"`
+	// The address that change is sent to. Required if the transaction
+	// returns change.
+	ChangeAddress types.UnlockHash `json:"changeAddress"`
+	// A fee tier or an explicit fee in hastings per byte; see /fee/tiers.
+	Fee string `json:"fee"`
+	// Restricts which outputs may fund the transaction.
+	Inputs OutputFilter `json:"inputs"`
+	// The coin selection strategy, e.g. SelectOldest. Defaults to
+	// SelectMinInputs.
+	Strategy string `json:"strategy"`
+	// Outputs held by this lock may fund the transaction; outputs held by
+	// other locks never do. See /utxos/lock.
+	LockID string `json:"lockID"`
+	// If set, the outputs funding the transaction are locked under LockID for
+	// this duration, e.g. "10m".
+	LockDuration string `json:"lockDuration"`
+	// Siafund outputs to create, funded by the wallet's siafund outputs. Their
+	// ClaimStart is ignored. Requires a Tracker.
+	SiafundOutputs []types.SiafundOutput `json:"siafundOutputs"`
+	// The address that receives the siacoin claims of the spent siafund
+	// outputs. Defaults to ChangeAddress.
+	ClaimAddress types.UnlockHash `json:"claimAddress"`
+}
+
+// ResponseConstruct is the response type for the /construct endpoint.
+type ResponseConstruct struct {
+	Fee ResponseFeeTier `json:"fee"`
+	// The unsigned transaction. Each input should be signed with the key at
+	// the corresponding index in KeyIndices.
+	Transaction types.Transaction `json:"transaction"`
+	KeyIndices  []uint64          `json:"keyIndices"`
+	// The key index of each siafund input, if any.
+	SiafundKeyIndices []uint64 `json:"siafundKeyIndices,omitempty"`
+	// The transactions in Limbo that the transaction depends on, ordered such
+	// that each follows its parents. They must be broadcast along with the
+	// transaction, preceding it in the set.
+	Parents []types.Transaction `json:"parents"`
+}
+
+// A Payout is a payment to a single recipient, as part of a /payouts request.
+type Payout struct {
+	Address types.UnlockHash `json:"address"`
+	Amount  types.Currency   `json:"amount"`
+}
+
+// RequestPayouts is the request type for the /payouts endpoint.
+type RequestPayouts struct {
+	Payouts []Payout `json:"payouts"`
+	// The address that change is sent to. Required if any transaction
+	// returns change.
+	ChangeAddress types.UnlockHash `json:"changeAddress"`
+	// A fee tier or an explicit fee in hastings per byte; see /fee/tiers.
+	Fee string `json:"fee"`
+	// Restricts which outputs may fund the transactions.
+	Inputs OutputFilter `json:"inputs"`
+	// The coin selection strategy, e.g. SelectOldest. Defaults to
+	// SelectMinInputs.
+	Strategy string `json:"strategy"`
+	// If true, the server signs the transactions with its seed and broadcasts
+	// them. Requires /sign to be enabled.
+	Sign bool `json:"sign"`
+}
+
+// ResponsePayouts is the response type for the /payouts endpoint.
+type ResponsePayouts struct {
+	Fee ResponseFeeTier `json:"fee"`
+	// The unsigned transactions, if the request did not set Sign, in the
+	// order they must be broadcast.
+	Bundles []SigningBundle `json:"bundles,omitempty"`
+	// The signed transactions, if the request set Sign, in the order they
+	// were broadcast.
+	Transactions []types.Transaction `json:"transactions,omitempty"`
+	// A receipt for each broadcast transaction, in the same order.
+	Receipts []ResponseBroadcast `json:"receipts,omitempty"`
+	// One for each requested payout, in the same order.
+	Payouts []ResponsePayout `json:"payouts"`
+	// The total fees paid by the transactions.
+	Fees types.Currency `json:"fees"`
+	// Set if only some of the signed transactions could be broadcast.
+	// Transactions then holds those that were, and the TransactionID of each
+	// payout that was not made is zero.
+	Error string `json:"error,omitempty"`
+}
+
+// ResponsePayout reports the transaction that pays a payout.
+type ResponsePayout struct {
+	Payout
+	TransactionID types.TransactionID `json:"transactionID"`
+}
+
+// RequestSign is the request type for the /sign endpoint.
+type RequestSign struct {
+	Transaction types.Transaction `json:"transaction"`
+	// The parent IDs of the inputs to sign. If empty, every input controlled
+	// by the wallet is signed.
+	ToSign []crypto.Hash `json:"toSign"`
+}
+
+// ResponseSplitDraft is the response type for the /splits/:name/draft
+// endpoint.
+type ResponseSplitDraft struct {
+	Rule SplitRule       `json:"rule"`
+	Fee  ResponseFeeTier `json:"fee"`
+	// The unsigned split transaction. Each input should be signed with the
+	// key at the corresponding index in KeyIndices.
+	Transaction types.Transaction `json:"transaction"`
+	KeyIndices  []uint64          `json:"keyIndices"`
+}
+
+// ResponseFeeTier describes a transaction fee and how quickly a transaction
+// paying it is expected to confirm.
+type ResponseFeeTier struct {
+	// The tier name, or empty if the fee was specified explicitly.
+	Tier       string         `json:"tier,omitempty"`
+	FeePerByte types.Currency `json:"feePerByte"`
+	// The estimated number of blocks until confirmation. Zero if the fee is
+	// below the economy tier, in which case the transaction may not confirm.
+	ConfirmationBlocks int `json:"confirmationBlocks"`
+}
+
+// ResponseCostBasis is the response type for the /reports/costbasis endpoint.
+type ResponseCostBasis struct {
+	Currency     string     `json:"currency"`
+	Policy       string     `json:"policy"`
+	Disposals    []Disposal `json:"disposals"`
+	RealizedGain float64    `json:"realizedGain"`
+}
+
+// ResponseRenterReport is the response type for the /reports/renter
+// endpoint.
+type ResponseRenterReport struct {
+	Start             time.Time      `json:"start"`
+	End               time.Time      `json:"end"`
+	ContractsFormed   int            `json:"contractsFormed"`
+	ContractsRenewed  int            `json:"contractsRenewed"`
+	ContractFormation types.Currency `json:"contractFormation"`
+	ContractRenewal   types.Currency `json:"contractRenewal"`
+	Fees              types.Currency `json:"fees"`
+	Other             types.Currency `json:"other"`
+	Total             types.Currency `json:"total"`
+}
+
+// ResponseHostReport is the response type for the /reports/host endpoint.
+type ResponseHostReport struct {
+	ActiveContracts  int                      `json:"activeContracts"`
+	CollateralLocked types.Currency           `json:"collateralLocked"`
+	AtRisk           types.Currency           `json:"atRisk"`
+	ExpectedPayouts  []ResponseHostReportWeek `json:"expectedPayouts"`
+	ValidProofs      int                      `json:"validProofs"`
+	MissedProofs     int                      `json:"missedProofs"`
+	Revenue          []ResponseHostReportWeek `json:"revenue"`
+}
+
+// ResponseHostReportWeek summarizes the file contracts that resolve, or are
+// expected to resolve, within a week.
+type ResponseHostReportWeek struct {
+	Week      time.Time      `json:"week"`
+	Contracts int            `json:"contracts"`
+	Payout    types.Currency `json:"payout"`
+}
+
+// ResponseBlockReward is an element of the response type for the
+// /blockrewards endpoint.
+type ResponseBlockReward struct {
+	wallet.BlockReward
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type responseBlockRewards []ResponseBlockReward
 
 // MarshalJSON implements json.Marshaler.
 func (r responseBlockRewards) MarshalJSON() ([]byte, error) {
@@ -119,38 +541,313 @@ func (r responseBlockRewards) MarshalJSON() ([]byte, error) {
 		Value      types.Currency        `json:"value"`
 		UnlockHash types.UnlockHash      `json:"unlockHash"`
 		Timelock   types.BlockHeight     `json:"timelock"`
+		Timestamp  time.Time             `json:"timestamp"`
 	}, len(r))
 	for i := range enc {
 		enc[i].ID = r[i].ID
 		enc[i].Value = r[i].Value
 		enc[i].UnlockHash = r[i].UnlockHash
 		enc[i].Timelock = r[i].Timelock
+		enc[i].Timestamp = r[i].Timestamp
 	}
 	return json.Marshal(enc)
 }
 
+// Broadcast results.
+const (
+	// The transaction pool accepted the transaction set.
+	BroadcastAccepted = "accepted"
+	// The transaction pool already contained the transaction set.
+	BroadcastDuplicate = "duplicate"
+	// The transaction set exceeds the vault threshold, and will be broadcast
+	// once the vault delay has elapsed.
+	BroadcastQueued = "queued"
+)
+
+// ResponseBroadcast is the response type for the /broadcast endpoint.
+type ResponseBroadcast struct {
+	Transactions []ResponseBroadcastTransaction `json:"transactions"`
+	// The number of peers the set was relayed to. Zero if unknown.
+	RelayPeers int `json:"relayPeers"`
+	// Set if the transaction set was queued by the vault policy.
+	Withdrawal *ResponseWithdrawal `json:"withdrawal,omitempty"`
+}
+
+// ResponseBroadcastTransaction is an element of ResponseBroadcast.
+type ResponseBroadcastTransaction struct {
+	ID         types.TransactionID `json:"id"`
+	Size       int                 `json:"size"`
+	FeePerByte types.Currency      `json:"feePerByte"`
+	Result     string              `json:"result"`
+}
+
+// ResponseWithdrawal describes a withdrawal queued by the vault policy.
+type ResponseWithdrawal struct {
+	ID             crypto.Hash           `json:"id"`
+	TransactionIDs []types.TransactionID `json:"transactionIDs"`
+	Value          types.Currency        `json:"value"`
+	Queued         time.Time             `json:"queued"`
+	Release        time.Time             `json:"release"`
+	LastError      string                `json:"lastError,omitempty"`
+}
+
+// ResponseVault is the response type for the /vault endpoint.
+type ResponseVault struct {
+	Threshold   types.Currency       `json:"threshold"`
+	Delay       string               `json:"delay"`
+	RecoveryKey string               `json:"recoveryKey"`
+	Withdrawals []ResponseWithdrawal `json:"withdrawals"`
+}
+
 // ResponseConsensus is the response type for the /consensus endpoint.
 type ResponseConsensus struct {
+	Height  types.BlockHeight `json:"height"`
+	CCID    crypto.Hash       `json:"ccid"`
+	Network string            `json:"network"`
+}
+
+// ResponseReconcile is the response type for the /reconcile endpoint.
+type ResponseReconcile struct {
+	Postings []Posting `json:"postings"`
+	// The ID of the last consensus change processed, to be passed as 'since'
+	// in the next request. Omitted if more postings remain, in which case the
+	// next request should pass the last posting's Seq as 'after'.
+	CCID *crypto.Hash `json:"ccid,omitempty"`
+}
+
+// ResponseConfirmationStats is the response type for the /stats/confirmations
+// endpoint.
+type ResponseConfirmationStats struct {
+	// Samples grouped by the interval in which they were broadcast, oldest
+	// first. Intervals without samples are omitted.
+	Buckets []ResponseConfirmationBucket `json:"buckets"`
+	// Samples grouped by fee rate, lowest first.
+	FeeBands []ResponseFeeBand `json:"feeBands"`
+	// The number of broadcasts that have not yet confirmed.
+	Pending int `json:"pending"`
+}
+
+// ResponseConfirmationBucket summarizes the broadcasts made during an
+// interval.
+type ResponseConfirmationBucket struct {
+	Start time.Time `json:"start"`
+	ConfirmationStats
+}
+
+// ResponseFeeBand summarizes the broadcasts whose fee rate is at least FeeBand
+// and less than twice FeeBand.
+type ResponseFeeBand struct {
+	FeeBand types.Currency `json:"feeBand"`
+	ConfirmationStats
+}
+
+// ResponseReady is the response type for the /ready endpoint.
+type ResponseReady struct {
+	Ready bool `json:"ready"`
+	// The height of the wallet's view of the blockchain.
 	Height types.BlockHeight `json:"height"`
-	CCID   crypto.Hash       `json:"ccid"`
+	// An estimate of how many blocks the wallet lags behind the network.
+	BlocksBehind types.BlockHeight `json:"blocksBehind"`
+	DBWritable   bool              `json:"dbWritable"`
+	// Whether the server's SyncWatchdog reports that sync has stalled.
+	SyncStalled bool `json:"syncStalled,omitempty"`
+	// The reasons the server is not ready, if any.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// ResponseVersion is the response type for the /version endpoint.
+type ResponseVersion struct {
+	Version     string   `json:"version"`
+	APIRevision int      `json:"apiRevision"`
+	Network     string   `json:"network"`
+	Features    []string `json:"features"`
+}
+
+// ResponseWalletID is the response type for the /wallet/id endpoint.
+type ResponseWalletID struct {
+	ID string `json:"id"`
+	// The address at seed index 0, from which the ID is derived.
+	Address types.UnlockHash `json:"address"`
+}
+
+// ResponseNetwork is the response type for the /network endpoint.
+type ResponseNetwork struct {
+	Height     types.BlockHeight          `json:"height"`
+	Target     crypto.Hash                `json:"target"`
+	Difficulty types.Currency             `json:"difficulty"`
+	Hashrate   types.Currency             `json:"hashrate"`
+	BlockTimes []ResponseNetworkBlockTime `json:"blockTimes"`
+}
+
+// ResponseNetworkBlockTime is the average time, in seconds, between the last
+// Blocks blocks.
+type ResponseNetworkBlockTime struct {
+	Blocks  types.BlockHeight `json:"blocks"`
+	Average float64           `json:"average"`
+}
+
+// ResponseHostAnnouncement is an element of the response type for the
+// /hostannouncements endpoint.
+type ResponseHostAnnouncement struct {
+	TransactionID types.TransactionID `json:"transactionID"`
+	BlockHeight   types.BlockHeight   `json:"blockHeight"`
+	Timestamp     time.Time           `json:"timestamp"`
+	NetAddress    modules.NetAddress  `json:"netAddress"`
+	PublicKey     string              `json:"publicKey"`
+	Addresses     []types.UnlockHash  `json:"addresses"`
 }
 
 type responseLimbo []wallet.LimboTransaction
 
 // MarshalJSON implements json.Marshaler.
 func (r responseLimbo) MarshalJSON() ([]byte, error) {
-	enc := make([]struct {
-		encodedTransaction
-		LimboSince time.Time `json:"limboSince"`
-	}, len(r))
+	enc := make([]responseLimboID, len(r))
 	for i := range enc {
-		enc[i].encodedTransaction = *(*encodedTransaction)(unsafe.Pointer(&r[i].Transaction))
-		enc[i].LimboSince = r[i].LimboSince
+		enc[i] = responseLimboID(r[i])
 	}
 	return json.Marshal(enc)
 }
 
-type responseFileContracts []wallet.FileContract
+type responseLimboID wallet.LimboTransaction
+
+// MarshalJSON implements json.Marshaler.
+func (r responseLimboID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		encodedTransaction
+		LimboSince time.Time `json:"limboSince"`
+	}{*(*encodedTransaction)(unsafe.Pointer(&r.Transaction)), r.LimboSince})
+}
+
+// ResponseLimboSet is an element of the response type for the /limbo/sets
+// endpoint.
+type ResponseLimboSet struct {
+	// The ID of the set, or for transactions that were not broadcast as part
+	// of a set, the transaction ID.
+	ID           crypto.Hash               `json:"id"`
+	Broadcast    time.Time                 `json:"broadcast"`
+	Transactions []wallet.LimboTransaction `json:"transactions"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r ResponseLimboSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID           crypto.Hash   `json:"id"`
+		Broadcast    time.Time     `json:"broadcast"`
+		Transactions responseLimbo `json:"transactions"`
+	}{r.ID, r.Broadcast, responseLimbo(r.Transactions)})
+}
+
+// RequestSandboxFaucet is the request type for the /sandbox/faucet endpoint.
+type RequestSandboxFaucet struct {
+	Address types.UnlockHash `json:"address"`
+	Value   types.Currency   `json:"value"`
+}
+
+// ResponseSandboxFaucet is the response type for the /sandbox/faucet
+// endpoint.
+type ResponseSandboxFaucet struct {
+	TransactionID types.TransactionID `json:"transactionID"`
+}
+
+// ResponseSeedIndexPreview is an element of the response type for the
+// /seedindex/preview endpoint, and the response type for the /addresses/next
+// endpoint.
+type ResponseSeedIndexPreview struct {
+	wallet.SeedAddressInfo
+	Address types.UnlockHash `json:"address"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r ResponseSeedIndexPreview) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		UnlockConditions encodedUnlockConditions `json:"unlockConditions"`
+		KeyIndex         uint64                  `json:"keyIndex"`
+		Address          types.UnlockHash        `json:"address"`
+	}{encodedUnlockConditions(r.UnlockConditions), r.KeyIndex, r.Address})
+}
+
+// ResponseSeedIndexReserve is the response type for the /seedindex/reserve
+// endpoint. The reserved range is [Start, End).
+type ResponseSeedIndexReserve struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// ResponseUnspentOutput is an element of the response type for the /utxos
+// endpoint.
+type ResponseUnspentOutput struct {
+	wallet.UnspentOutput
+	// Whether the output is change returned to the wallet by one of its own
+	// transactions, rather than a payment from another party.
+	IsChange bool `json:"isChange"`
+	// Metadata attached to the output via /utxos/:id/metadata.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// The height at which the output became spendable, if known.
+	BlockHeight types.BlockHeight `json:"blockHeight,omitempty"`
+	// Whether the output was created by a transaction in Limbo.
+	Limbo bool `json:"limbo,omitempty"`
+	// The ID of the lock holding the output, if any; see /utxos/lock.
+	LockID string `json:"lockID,omitempty"`
+}
+
+// RequestLockUTXOs is the request type for the /utxos/lock endpoint.
+type RequestLockUTXOs struct {
+	// Identifies the holder of the lock, e.g. the name of a process.
+	LockID string                  `json:"lockID"`
+	IDs    []types.SiacoinOutputID `json:"ids"`
+	// How long the outputs remain locked, e.g. "10m". Defaults to 10 minutes.
+	Duration string `json:"duration"`
+}
+
+// ResponseLockUTXOs is the response type for the /utxos/lock endpoint.
+type ResponseLockUTXOs struct {
+	Expires time.Time `json:"expires"`
+}
+
+// RequestReleaseUTXOs is the request type for the /utxos/release endpoint.
+type RequestReleaseUTXOs struct {
+	LockID string `json:"lockID"`
+	// The outputs to release. If empty, every output held by the lock is
+	// released.
+	IDs []types.SiacoinOutputID `json:"ids"`
+}
+
+// ResponseUsage is the response type for the /usage endpoint.
+type ResponseUsage struct {
+	Addresses          int    `json:"addresses"`
+	PushDevices        int    `json:"pushDevices"`
+	Requests           uint64 `json:"requests"`
+	RequestsThisMinute int    `json:"requestsThisMinute"`
+	Quota              Quota  `json:"quota"`
+}
+
+// ResponseSiafunds is the response type for the /siafunds endpoint.
+type ResponseSiafunds struct {
+	// The number of siafunds in the wallet's unspent siafund outputs.
+	Balance types.Currency `json:"balance"`
+	// The siacoin claims that the outputs would receive if they were spent at
+	// the current height.
+	ClaimBalance types.Currency `json:"claimBalance"`
+	Pool         types.Currency `json:"pool"`
+}
+
+// ResponseSiafundClaim is an element of the response type for the
+// /siafunds/claims and /siafunds/utxos endpoints.
+type ResponseSiafundClaim struct {
+	SiafundOutput
+	UnrealizedClaim types.Currency `json:"unrealizedClaim"`
+}
+
+// ResponseFileContract is an element of the response type for the
+// /filecontracts and /filecontracts/:id endpoints. If the contract's proof
+// window has ended, WindowEndTimestamp is the timestamp of the block at
+// WindowEnd; otherwise, it is the zero time.
+type ResponseFileContract struct {
+	wallet.FileContract
+	WindowEndTimestamp time.Time `json:"windowEndTimestamp"`
+}
+
+type responseFileContracts []ResponseFileContract
 
 // MarshalJSON implements json.Marshaler.
 func (r responseFileContracts) MarshalJSON() ([]byte, error) {
@@ -166,6 +863,7 @@ func (r responseFileContracts) MarshalJSON() ([]byte, error) {
 		UnlockHash         types.UnlockHash         `json:"unlockHash"`
 		UnlockConditions   *encodedUnlockConditions `json:"unlockConditions,omitempty"`
 		RevisionNumber     uint64                   `json:"revisionNumber"`
+		WindowEndTimestamp *time.Time               `json:"windowEndTimestamp,omitempty"`
 	}, len(r))
 	for i := range enc {
 		enc[i].ID = r[i].ID
@@ -183,10 +881,26 @@ func (r responseFileContracts) MarshalJSON() ([]byte, error) {
 		}
 		enc[i].UnlockConditions = ucs
 		enc[i].RevisionNumber = r[i].RevisionNumber
+		if !r[i].WindowEndTimestamp.IsZero() {
+			enc[i].WindowEndTimestamp = &r[i].WindowEndTimestamp
+		}
 	}
 	return json.Marshal(enc)
 }
 
+// ResponseInheritance is the response type for the /inheritance endpoint.
+type ResponseInheritance struct {
+	Beneficiary    types.UnlockHash      `json:"beneficiary"`
+	TransactionIDs []types.TransactionID `json:"transactionIDs"`
+	HeartbeatKey   string                `json:"heartbeatKey"`
+	Period         string                `json:"period"`
+	LastHeartbeat  time.Time             `json:"lastHeartbeat"`
+	Deadline       time.Time             `json:"deadline"`
+	// Set once the transactions have been broadcast.
+	Triggered *time.Time `json:"triggered,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+}
+
 // ResponseTransactionsID is the response type for the /transactions/:id
 // endpoint.
 type ResponseTransactionsID struct {
@@ -197,6 +911,11 @@ type ResponseTransactionsID struct {
 	FeePerByte  types.Currency    `json:"feePerByte"`
 	Inflow      types.Currency    `json:"inflow"`
 	Outflow     types.Currency    `json:"outflow"`
+	// The portion of Inflow that is change returned to the wallet.
+	Change types.Currency `json:"change"`
+	// Whether every input and output of the transaction belongs to the
+	// wallet.
+	Internal bool `json:"internal"`
 }
 
 // MarshalJSON implements json.Marshaler.
@@ -209,6 +928,29 @@ func (r ResponseTransactionsID) MarshalJSON() ([]byte, error) {
 		FeePerByte  types.Currency     `json:"feePerByte"`
 		Inflow      types.Currency     `json:"inflow"`
 		Outflow     types.Currency     `json:"outflow"`
+		Change      types.Currency     `json:"change"`
+		Internal    bool               `json:"internal"`
+	}{*(*encodedTransaction)(unsafe.Pointer(&r.Transaction)),
+		r.BlockID, r.BlockHeight, r.Timestamp, r.FeePerByte, r.Inflow, r.Outflow, r.Change, r.Internal})
+}
+
+// ResponseTransactionsIDRaw is the response type for the
+// /transactions/:id/raw endpoint.
+type ResponseTransactionsIDRaw struct {
+	Transaction types.Transaction `json:"transaction"`
+	// BlockID and BlockHeight are only set if the transaction is confirmed.
+	BlockID     types.BlockID     `json:"blockID"`
+	BlockHeight types.BlockHeight `json:"blockHeight"`
+	Confirmed   bool              `json:"confirmed"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r ResponseTransactionsIDRaw) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Transaction encodedTransaction `json:"transaction"`
+		BlockID     types.BlockID      `json:"blockID"`
+		BlockHeight types.BlockHeight  `json:"blockHeight"`
+		Confirmed   bool               `json:"confirmed"`
 	}{*(*encodedTransaction)(unsafe.Pointer(&r.Transaction)),
-		r.BlockID, r.BlockHeight, r.Timestamp, r.FeePerByte, r.Inflow, r.Outflow})
+		r.BlockID, r.BlockHeight, r.Confirmed})
 }
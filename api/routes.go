@@ -0,0 +1,288 @@
+// Package api defines the routes of the walrus HTTP API.
+//
+// The routes are shared by the walrus client and server, and are exported so
+// that third-party middleware, reverse-proxy ACLs, and custom clients can
+// refer to them programmatically rather than hardcoding strings. Route
+// parameters are denoted httprouter-style, e.g. ":addr"; Path fills them in,
+// and Match performs the reverse.
+package api
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Routes of the walrus API.
+const (
+	Addresses                  = "/addresses"
+	AddressesNext              = "/addresses/next"
+	AddressesAddr              = "/addresses/:addr"
+	AddressesAddrLabel         = "/addresses/:addr/label"
+	AddressesAddrOwnership     = "/addresses/:addr/ownership"
+	Balance                    = "/balance"
+	Batch                      = "/batch"
+	BlockRewards               = "/blockrewards"
+	Broadcast                  = "/broadcast"
+	Consensus                  = "/consensus"
+	Consolidate                = "/consolidate"
+	Consolidation              = "/consolidation"
+	Construct                  = "/construct"
+	DBVerify                   = "/db/verify"
+	Deposits                   = "/deposits"
+	DepositsAddrCallback       = "/deposits/:addr/callback"
+	DepositsAddrCheckout       = "/deposits/:addr/checkout"
+	Events                     = "/events"
+	EventsSSE                  = "/events/sse"
+	Fee                        = "/fee"
+	FeeTiers                   = "/fee/tiers"
+	FileContracts              = "/filecontracts"
+	FileContractsUpcoming      = "/filecontracts/upcoming"
+	FileContractsID            = "/filecontracts/:id"
+	Health                     = "/health"
+	HostAnnouncements          = "/hostannouncements"
+	Inheritance                = "/inheritance"
+	InheritanceHeartbeat       = "/inheritance/heartbeat"
+	Jobs                       = "/jobs"
+	JobsID                     = "/jobs/:id"
+	Leader                     = "/leader"
+	Limbo                      = "/limbo"
+	LimboSets                  = "/limbo/sets"
+	LimboID                    = "/limbo/:id"
+	LimboIDBump                = "/limbo/:id/bump"
+	MemosTxID                  = "/memos/:txid"
+	Network                    = "/network"
+	OwnershipVerify            = "/ownership/verify"
+	Payments                   = "/payments"
+	Payouts                    = "/payouts"
+	PubKeys                    = "/pubkeys"
+	PushDevices                = "/push/devices"
+	PushDevicesToken           = "/push/devices/:token"
+	Ready                      = "/ready"
+	Reconcile                  = "/reconcile"
+	ReportsCostBasis           = "/reports/costbasis"
+	ReportsHost                = "/reports/host"
+	ReportsRenter              = "/reports/renter"
+	ReportsStatement           = "/reports/statement"
+	ReportsStatementKey        = "/reports/statement/key"
+	Reserves                   = "/reserves"
+	SandboxFaucet              = "/sandbox/faucet"
+	SandboxMine                = "/sandbox/mine"
+	SandboxReorg               = "/sandbox/reorg"
+	SeedIndex                  = "/seedindex"
+	SeedIndexPreview           = "/seedindex/preview"
+	SeedIndexReserve           = "/seedindex/reserve"
+	Siafunds                   = "/siafunds"
+	SiafundsClaims             = "/siafunds/claims"
+	SiafundsUTXOs              = "/siafunds/utxos"
+	Sign                       = "/sign"
+	Splits                     = "/splits"
+	SplitsName                 = "/splits/:name"
+	SplitsNameDraft            = "/splits/:name/draft"
+	StatsConfirmations         = "/stats/confirmations"
+	Sweep                      = "/sweep"
+	Templates                  = "/templates"
+	TemplatesName              = "/templates/:name"
+	TemplatesNameBuild         = "/templates/:name/build"
+	Transactions               = "/transactions"
+	TransactionsTxID           = "/transactions/:txid"
+	TransactionsTxIDAnnotation = "/transactions/:txid/annotation"
+	TransactionsTxIDProof      = "/transactions/:txid/proof"
+	TransactionsTxIDRaw        = "/transactions/:txid/raw"
+	UnconfirmedParents         = "/unconfirmedparents"
+	Usage                      = "/usage"
+	UTXOs                      = "/utxos"
+	UTXOsLock                  = "/utxos/lock"
+	UTXOsRelease               = "/utxos/release"
+	UTXOsIDMetadata            = "/utxos/:id/metadata"
+	UTXOsIDProof               = "/utxos/:id/proof"
+	UTXOsIDTrace               = "/utxos/:id/trace"
+	Vault                      = "/vault"
+	VaultWithdrawalsID         = "/vault/withdrawals/:id"
+	Version                    = "/version"
+	WalletID                   = "/wallet/id"
+)
+
+// A Route is an HTTP method and route served by walrus.
+type Route struct {
+	Method string
+	Path   string
+}
+
+// Routes lists every route served by walrus, ordered by path. Some routes are
+// only served if the server is configured accordingly, e.g. with a Tracker;
+// see the API documentation. Custom routes are not included.
+var Routes = []Route{
+	{"GET", Addresses},
+	{"POST", Addresses},
+	{"POST", AddressesNext},
+	{"GET", AddressesAddr},
+	{"DELETE", AddressesAddr},
+	{"PUT", AddressesAddrLabel},
+	{"GET", AddressesAddrOwnership},
+	{"GET", Balance},
+	{"POST", Batch},
+	{"GET", BlockRewards},
+	{"POST", Broadcast},
+	{"GET", Consensus},
+	{"POST", Consolidate},
+	{"GET", Consolidation},
+	{"POST", Construct},
+	{"POST", DBVerify},
+	{"GET", Deposits},
+	{"POST", Deposits},
+	{"PUT", DepositsAddrCallback},
+	{"GET", DepositsAddrCheckout},
+	{"GET", Events},
+	{"GET", EventsSSE},
+	{"GET", Fee},
+	{"GET", FeeTiers},
+	{"GET", FileContracts},
+	{"GET", FileContractsUpcoming},
+	{"GET", FileContractsID},
+	{"GET", Health},
+	{"GET", HostAnnouncements},
+	{"GET", Inheritance},
+	{"POST", Inheritance},
+	{"DELETE", Inheritance},
+	{"POST", InheritanceHeartbeat},
+	{"GET", Jobs},
+	{"GET", JobsID},
+	{"DELETE", JobsID},
+	{"GET", Leader},
+	{"GET", Limbo},
+	{"GET", LimboSets},
+	{"GET", LimboID},
+	{"PUT", LimboID},
+	{"DELETE", LimboID},
+	{"POST", LimboIDBump},
+	{"PUT", LimboIDBump},
+	{"GET", MemosTxID},
+	{"PUT", MemosTxID},
+	{"GET", Network},
+	{"POST", OwnershipVerify},
+	{"GET", Payments},
+	{"POST", Payouts},
+	{"POST", PubKeys},
+	{"GET", PushDevices},
+	{"POST", PushDevices},
+	{"DELETE", PushDevicesToken},
+	{"GET", Ready},
+	{"GET", Reconcile},
+	{"GET", ReportsCostBasis},
+	{"GET", ReportsHost},
+	{"GET", ReportsRenter},
+	{"GET", ReportsStatement},
+	{"GET", ReportsStatementKey},
+	{"GET", Reserves},
+	{"POST", SandboxFaucet},
+	{"POST", SandboxMine},
+	{"POST", SandboxReorg},
+	{"GET", SeedIndex},
+	{"GET", SeedIndexPreview},
+	{"POST", SeedIndexReserve},
+	{"GET", Siafunds},
+	{"GET", SiafundsClaims},
+	{"GET", SiafundsUTXOs},
+	{"POST", Sign},
+	{"GET", Splits},
+	{"PUT", SplitsName},
+	{"DELETE", SplitsName},
+	{"GET", SplitsNameDraft},
+	{"GET", StatsConfirmations},
+	{"GET", Sweep},
+	{"GET", Templates},
+	{"GET", TemplatesName},
+	{"PUT", TemplatesName},
+	{"DELETE", TemplatesName},
+	{"POST", TemplatesNameBuild},
+	{"GET", Transactions},
+	{"GET", TransactionsTxID},
+	{"GET", TransactionsTxIDAnnotation},
+	{"GET", TransactionsTxIDProof},
+	{"GET", TransactionsTxIDRaw},
+	{"POST", UnconfirmedParents},
+	{"GET", Usage},
+	{"GET", UTXOs},
+	{"POST", UTXOsLock},
+	{"POST", UTXOsRelease},
+	{"GET", UTXOsIDMetadata},
+	{"PUT", UTXOsIDMetadata},
+	{"GET", UTXOsIDProof},
+	{"GET", UTXOsIDTrace},
+	{"GET", Vault},
+	{"DELETE", VaultWithdrawalsID},
+	{"GET", Version},
+	{"GET", WalletID},
+}
+
+// Path returns route with its parameters replaced, in order, by params, which
+// are escaped as necessary. It panics if the number of params does not match
+// the number of parameters in route.
+func Path(route string, params ...string) string {
+	segs := strings.Split(route, "/")
+	n := 0
+	for i, seg := range segs {
+		if strings.HasPrefix(seg, ":") {
+			if n == len(params) {
+				panic("api: too few parameters for route " + route)
+			}
+			segs[i] = url.PathEscape(params[n])
+			n++
+		}
+	}
+	if n != len(params) {
+		panic("api: too many parameters for route " + route)
+	}
+	return strings.Join(segs, "/")
+}
+
+// Match returns the route in Routes that serves a request with the specified
+// method and path, along with the values of the route's parameters, keyed by
+// name (without the leading ':'). path should be escaped, e.g. as returned by
+// (*url.URL).EscapedPath. Routes without parameters take precedence, e.g.
+// "/limbo/sets" matches LimboSets rather than LimboID.
+func Match(method, path string) (Route, map[string]string, bool) {
+	segs := strings.Split(path, "/")
+	var match Route
+	var params map[string]string
+	found := false
+	for _, r := range Routes {
+		if r.Method != method {
+			continue
+		}
+		ps, ok := matchPath(r.Path, segs)
+		if !ok {
+			continue
+		} else if len(ps) == 0 {
+			return r, nil, true
+		} else if !found {
+			match, params, found = r, ps, true
+		}
+	}
+	return match, params, found
+}
+
+// matchPath reports whether route matches the path segments segs, returning
+// the values of its parameters.
+func matchPath(route string, segs []string) (map[string]string, bool) {
+	rsegs := strings.Split(route, "/")
+	if len(rsegs) != len(segs) {
+		return nil, false
+	}
+	var params map[string]string
+	for i, rseg := range rsegs {
+		if strings.HasPrefix(rseg, ":") {
+			v, err := url.PathUnescape(segs[i])
+			if err != nil || v == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[rseg[1:]] = v
+		} else if rseg != segs[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
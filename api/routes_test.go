@@ -0,0 +1,103 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	tests := []struct {
+		route  string
+		params []string
+		exp    string
+	}{
+		{Balance, nil, "/balance"},
+		{AddressesAddr, []string{"abc"}, "/addresses/abc"},
+		{AddressesAddrOwnership, []string{"abc"}, "/addresses/abc/ownership"},
+		{TemplatesNameBuild, []string{"a b/c"}, "/templates/a%20b%2Fc/build"},
+	}
+	for _, test := range tests {
+		if p := Path(test.route, test.params...); p != test.exp {
+			t.Errorf("Path(%q, %q): expected %q, got %q", test.route, test.params, test.exp, p)
+		}
+	}
+
+	for _, test := range []struct {
+		route  string
+		params []string
+	}{
+		{Balance, []string{"foo"}},
+		{AddressesAddr, nil},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Path(%q, %q) should have panicked", test.route, test.params)
+				}
+			}()
+			Path(test.route, test.params...)
+		}()
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		route  string
+		params map[string]string
+	}{
+		{"GET", "/balance", Balance, nil},
+		{"GET", "/limbo/sets", LimboSets, nil},
+		{"GET", "/limbo/abc", LimboID, map[string]string{"id": "abc"}},
+		{"GET", "/filecontracts/upcoming", FileContractsUpcoming, nil},
+		{"POST", "/templates/a%20b%2Fc/build", TemplatesNameBuild, map[string]string{"name": "a b/c"}},
+		{"PUT", "/utxos/abc/metadata", UTXOsIDMetadata, map[string]string{"id": "abc"}},
+	}
+	for _, test := range tests {
+		r, params, ok := Match(test.method, test.path)
+		if !ok {
+			t.Errorf("%v %v: no match", test.method, test.path)
+			continue
+		} else if r.Method != test.method || r.Path != test.route {
+			t.Errorf("%v %v: expected %v, got %v %v", test.method, test.path, test.route, r.Method, r.Path)
+		}
+		if len(params) != len(test.params) {
+			t.Errorf("%v %v: expected params %v, got %v", test.method, test.path, test.params, params)
+		}
+		for k, v := range test.params {
+			if params[k] != v {
+				t.Errorf("%v %v: expected params %v, got %v", test.method, test.path, test.params, params)
+			}
+		}
+	}
+
+	for _, test := range []struct{ method, path string }{
+		{"POST", "/balance"},
+		{"GET", "/nonexistent"},
+		{"GET", "/limbo/"},
+		{"GET", "/addresses/abc/def"},
+	} {
+		if r, _, ok := Match(test.method, test.path); ok {
+			t.Errorf("%v %v: expected no match, got %v %v", test.method, test.path, r.Method, r.Path)
+		}
+	}
+
+	// every route should match itself
+	for _, r := range Routes {
+		path := r.Path
+		if strings.Contains(path, ":") {
+			segs := strings.Split(path, "/")
+			var params []string
+			for _, seg := range segs {
+				if strings.HasPrefix(seg, ":") {
+					params = append(params, "x")
+				}
+			}
+			path = Path(r.Path, params...)
+		}
+		if m, _, ok := Match(r.Method, path); !ok || m != r {
+			t.Errorf("%v %v does not match itself", r.Method, r.Path)
+		}
+	}
+}
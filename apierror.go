@@ -0,0 +1,67 @@
+package walrus
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors that an *APIError can be matched against with errors.Is.
+var (
+	// ErrNotFound matches any 404 response.
+	ErrNotFound = errors.New("not found")
+	// ErrAddressNotFound matches a 404 response from /addresses/:addr.
+	ErrAddressNotFound = errors.New("address not found")
+	// ErrTransactionNotRelevant matches a 404 response from
+	// /transactions/:txid or /transactions/:txid/raw.
+	ErrTransactionNotRelevant = errors.New("transaction not relevant to the wallet")
+	// ErrUnauthorized matches a 401 response, returned when the Client's
+	// credentials are missing or invalid.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrRateLimited matches a 429 response.
+	ErrRateLimited = errors.New("request quota exceeded")
+	// ErrStandby matches a 503 response from a standby instance.
+	ErrStandby = errors.New("server is a standby")
+	// ErrConsolidationDeferred matches a 409 response from /consolidate,
+	// returned when the fee is too high or there are too few outputs to
+	// consolidate.
+	ErrConsolidationDeferred = errors.New("consolidation deferred")
+)
+
+// An APIError is returned by a Client when the server responds with a status
+// other than 200 OK.
+type APIError struct {
+	StatusCode int
+	Method     string
+	// The requested path, without the query string.
+	Route   string
+	Message string
+}
+
+// Error implements error.
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// Is reports whether e matches one of the sentinel errors of this package.
+func (e *APIError) Is(target error) bool {
+	segments := strings.Split(strings.Trim(e.Route, "/"), "/")
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrAddressNotFound:
+		return e.StatusCode == http.StatusNotFound && len(segments) == 2 && segments[0] == "addresses"
+	case ErrTransactionNotRelevant:
+		return e.StatusCode == http.StatusNotFound && segments[0] == "transactions" &&
+			(len(segments) == 2 || (len(segments) == 3 && segments[2] == "raw"))
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrStandby:
+		return e.StatusCode == http.StatusServiceUnavailable
+	case ErrConsolidationDeferred:
+		return e.StatusCode == http.StatusConflict && len(segments) == 1 && segments[0] == "consolidate"
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package walrus
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// Credentials are the credentials that clients of a server must present.
+// Clients may authenticate with any of the API keys, sent as a bearer token,
+// or, if Username is set, with the username and password via HTTP Basic
+// authentication.
+type Credentials struct {
+	APIKeys  []string `json:"apiKeys"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+}
+
+// WithCredentials requires clients of the server to authenticate with creds.
+func WithCredentials(creds Credentials) ServerOption {
+	return func(s *server) {
+		s.creds = creds
+	}
+}
+
+func secretsEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// hasCredentials reports whether the server requires clients to
+// authenticate.
+func (s *server) hasCredentials() bool {
+	return len(s.creds.APIKeys) > 0 || s.creds.Username != ""
+}
+
+// authorized reports whether req carries valid credentials.
+func (s *server) authorized(req *http.Request) bool {
+	if h := req.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		token := strings.TrimPrefix(h, "Bearer ")
+		valid := false
+		for _, key := range s.creds.APIKeys {
+			// check every key, so that timing does not reveal which matched
+			valid = secretsEqual(token, key) || valid
+		}
+		return valid
+	}
+	if user, pass, ok := req.BasicAuth(); ok && s.creds.Username != "" {
+		// evaluate both comparisons, so that timing does not reveal which
+		// failed
+		userOK := secretsEqual(user, s.creds.Username)
+		passOK := secretsEqual(pass, s.creds.Password)
+		return userOK && passOK
+	}
+	return false
+}
+
+// authenticate wraps h, rejecting requests that lack valid credentials. If
+// the server has no credentials configured, h is returned unchanged.
+func (s *server) authenticate(h http.Handler) http.Handler {
+	if !s.hasCredentials() {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !s.authorized(req) {
+			if s.creds.Username != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="walrus"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="walrus"`)
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// WithAPIKey configures the Client to authenticate with the specified key,
+// sent as a bearer token.
+func WithAPIKey(key string) ClientOption {
+	return func(c *Client) {
+		c.auth = "Bearer " + key
+	}
+}
+
+// WithBasicAuth configures the Client to authenticate with the specified
+// username and password via HTTP Basic authentication, as required by some
+// reverse proxies.
+func WithBasicAuth(username, password string) ClientOption {
+	return func(c *Client) {
+		c.auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	}
+}
@@ -0,0 +1,178 @@
+package walrus
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+	"lukechampine.com/walrus/api"
+)
+
+// maxBatchRequests is the maximum number of sub-requests in a /batch request.
+const maxBatchRequests = 32
+
+// A batchResponseWriter buffers the response to a sub-request of /batch.
+type batchResponseWriter struct {
+	header http.Header
+	status int
+	buf    bytes.Buffer
+}
+
+func (bw *batchResponseWriter) Header() http.Header { return bw.header }
+
+func (bw *batchResponseWriter) WriteHeader(status int) {
+	if bw.status == 0 {
+		bw.status = status
+	}
+}
+
+func (bw *batchResponseWriter) Write(p []byte) (int, error) {
+	bw.WriteHeader(http.StatusOK)
+	return bw.buf.Write(p)
+}
+
+// serveBatchItem serves a single sub-request of req via h.
+func serveBatchItem(h http.Handler, req *http.Request, item RequestBatchItem) ResponseBatchItem {
+	u, err := url.ParseRequestURI(item.Route)
+	if err != nil || !strings.HasPrefix(u.Path, "/") || u.Host != "" {
+		return ResponseBatchItem{Status: http.StatusBadRequest, Error: "Invalid route"}
+	} else if u.Path == api.Batch {
+		return ResponseBatchItem{Status: http.StatusBadRequest, Error: "Batches cannot be nested"}
+	}
+	sub, err := http.NewRequestWithContext(req.Context(), item.Method, item.Route, bytes.NewReader(item.Body))
+	if err != nil {
+		return ResponseBatchItem{Status: http.StatusBadRequest, Error: "Invalid request: " + err.Error()}
+	}
+	sub.Header.Set("Content-Type", "application/json")
+	sub.RemoteAddr = req.RemoteAddr
+	sub.TLS = req.TLS
+
+	bw := &batchResponseWriter{header: make(http.Header)}
+	h.ServeHTTP(bw, sub)
+	resp := ResponseBatchItem{Status: bw.status}
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+	body := bytes.TrimSpace(bw.buf.Bytes())
+	switch {
+	case resp.Status != http.StatusOK:
+		resp.Error = string(body)
+	case len(body) == 0:
+	case strings.HasPrefix(bw.header.Get("Content-Type"), "application/json"):
+		resp.Body = body
+	default:
+		resp.Body, _ = json.Marshal(string(body))
+	}
+	return resp
+}
+
+// A Batch is a set of requests sent to the server in a single round trip via
+// /batch. Each method adds a request and returns the Batch, so that calls can
+// be chained; the responses are decoded when Do is called.
+type Batch struct {
+	c     *Client
+	items []RequestBatchItem
+	resps []interface{}
+}
+
+// Batch returns an empty Batch.
+func (c *Client) Batch() *Batch {
+	return &Batch{c: c}
+}
+
+func (b *Batch) add(method, route string, data, resp interface{}) *Batch {
+	if len(b.items) == maxBatchRequests {
+		panic("batch contains too many requests")
+	}
+	item := RequestBatchItem{Method: method, Route: route}
+	if data != nil {
+		item.Body, _ = json.Marshal(data)
+	}
+	b.items = append(b.items, item)
+	b.resps = append(b.resps, resp)
+	return b
+}
+
+// Get adds a GET request for the specified route (a path and query string,
+// e.g. "/utxos?limbo=true"). Its response will be decoded into resp, which
+// may be nil.
+func (b *Batch) Get(route string, resp interface{}) *Batch {
+	return b.add("GET", route, nil, resp)
+}
+
+// Post adds a POST request for the specified route, with data encoded as its
+// JSON body. Its response will be decoded into resp, which may be nil.
+func (b *Batch) Post(route string, data, resp interface{}) *Batch {
+	return b.add("POST", route, data, resp)
+}
+
+// Balance adds a request for the current wallet balance. See Client.Balance.
+func (b *Batch) Balance(limbo bool, bal *types.Currency) *Batch {
+	return b.Get(api.Balance+"?limbo="+strconv.FormatBool(limbo), bal)
+}
+
+// RecommendedFee adds a request for the recommended transaction fee. See
+// Client.RecommendedFee.
+func (b *Batch) RecommendedFee(fee *types.Currency) *Batch {
+	return b.Get(api.Fee, fee)
+}
+
+// SeedIndex adds a request for the current seed index. See Client.SeedIndex.
+func (b *Batch) SeedIndex(index *uint64) *Batch {
+	return b.Get(api.SeedIndex, index)
+}
+
+// UnconfirmedParents adds a request for the Limbo parents of txn. See
+// Client.UnconfirmedParents.
+func (b *Batch) UnconfirmedParents(txn types.Transaction, parents *[]wallet.LimboTransaction) *Batch {
+	return b.Post(api.UnconfirmedParents, txn, parents)
+}
+
+// UnspentOutputs adds a request for the outputs that the wallet can spend.
+// See Client.UnspentOutputs.
+func (b *Batch) UnspentOutputs(limbo bool, utxos *[]ResponseUnspentOutput) *Batch {
+	return b.Get(api.UTXOs+"?limbo="+strconv.FormatBool(limbo), utxos)
+}
+
+// Do sends the batch and decodes each response. The requests are executed in
+// order. If any request fails, Do returns an *APIError describing the first
+// failure; the responses of the other requests are decoded regardless.
+func (b *Batch) Do() error {
+	if len(b.items) == 0 {
+		return nil
+	}
+	var resps []ResponseBatchItem
+	if err := b.c.post(api.Batch, b.items, &resps); err != nil {
+		return err
+	} else if len(resps) != len(b.items) {
+		return errors.New("server returned wrong number of responses")
+	}
+	var firstErr error
+	for i, r := range resps {
+		var err error
+		if r.Status != http.StatusOK {
+			route := b.items[i].Route
+			if j := strings.IndexByte(route, '?'); j >= 0 {
+				route = route[:j]
+			}
+			err = &APIError{
+				StatusCode: r.Status,
+				Method:     b.items[i].Method,
+				Route:      route,
+				Message:    r.Error,
+			}
+		} else if b.resps[i] != nil && len(r.Body) != 0 {
+			err = json.Unmarshal(r.Body, b.resps[i])
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,200 @@
+package walrus
+
+import (
+	"errors"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+	"lukechampine.com/us/wallet"
+)
+
+// errBumpFeeTooLow is returned by draftBump if the requested fee does not
+// exceed the transaction's current fee.
+var errBumpFeeTooLow = errors.New("fee must exceed the transaction's current fee")
+
+// totalFee returns the sum of txn's miner fees.
+func totalFee(txn types.Transaction) types.Currency {
+	fee := types.ZeroCurrency
+	for _, f := range txn.MinerFees {
+		fee = fee.Add(f)
+	}
+	return fee
+}
+
+// signedSize returns the size of txn once each of its siacoin inputs is signed
+// with a standard signature.
+func signedSize(txn types.Transaction) int {
+	size := len(encoding.Marshal(txn))
+	for _, in := range txn.SiacoinInputs {
+		size += signedInputSize(in) - len(encoding.Marshal(in))
+	}
+	return size
+}
+
+// onlyTransfersSiacoins reports whether txn transfers siacoins and nothing
+// else.
+func onlyTransfersSiacoins(txn types.Transaction) bool {
+	return len(txn.SiacoinInputs) != 0 && len(txn.SiafundInputs) == 0 && len(txn.SiafundOutputs) == 0 &&
+		len(txn.FileContracts) == 0 && len(txn.FileContractRevisions) == 0 && len(txn.StorageProofs) == 0
+}
+
+// draftBump returns an unsigned copy of txn, a transaction spending the
+// wallet's outputs, that pays feePerByte instead of its current fee, along
+// with the key index of each input. The additional fee is taken from txn's
+// change output, i.e. its last output paying the wallet. If the change is
+// insufficient, it is spent on the fee in its entirety, and inputs are added
+// from candidates to pay the remainder; any new change is sent to changeAddr
+// or, if it is unset, to the address of the original change output. The other
+// outputs of txn are unchanged.
+func draftBump(w *wallet.SeedWallet, txn types.Transaction, candidates []coinInput, changeAddr types.UnlockHash, feePerByte types.Currency) (types.Transaction, []uint64, error) {
+	if !onlyTransfersSiacoins(txn) {
+		return types.Transaction{}, nil, errors.New("only transactions that transfer siacoins can be bumped")
+	}
+	bumped := types.Transaction{
+		SiacoinInputs:  append([]types.SiacoinInput(nil), txn.SiacoinInputs...),
+		SiacoinOutputs: append([]types.SiacoinOutput(nil), txn.SiacoinOutputs...),
+		MinerFees:      []types.Currency{totalFee(txn)},
+		ArbitraryData:  txn.ArbitraryData,
+	}
+	keyIndices := make([]uint64, len(txn.SiacoinInputs))
+	for i, in := range txn.SiacoinInputs {
+		info, ok := w.AddressInfo(in.UnlockConditions.UnlockHash())
+		if !ok {
+			return types.Transaction{}, nil, errors.New("transaction spends outputs not owned by the wallet")
+		}
+		keyIndices[i] = info.KeyIndex
+	}
+
+	oldFee := totalFee(txn)
+	fee := feePerByte.Mul64(uint64(signedSize(bumped)))
+	if fee.Cmp(oldFee) <= 0 {
+		return types.Transaction{}, nil, errBumpFeeTooLow
+	}
+	deficit := fee.Sub(oldFee)
+	changeIndex := -1
+	for i, isChange := range changeOutputs(w, txn) {
+		if isChange {
+			changeIndex = i
+		}
+	}
+	if changeIndex >= 0 {
+		change := bumped.SiacoinOutputs[changeIndex]
+		if change.Value.Cmp(deficit) > 0 {
+			bumped.SiacoinOutputs[changeIndex].Value = change.Value.Sub(deficit)
+			bumped.MinerFees = []types.Currency{fee}
+			return bumped, keyIndices, nil
+		}
+		if changeAddr == (types.UnlockHash{}) {
+			changeAddr = change.UnlockHash
+		}
+		deficit = deficit.Sub(change.Value)
+		bumped.SiacoinOutputs = append(bumped.SiacoinOutputs[:changeIndex], bumped.SiacoinOutputs[changeIndex+1:]...)
+	}
+	if !deficit.IsZero() {
+		used, inputFee, change, ok := selectCoins("", deficit, feePerByte, candidates)
+		if !ok {
+			return types.Transaction{}, nil, errors.New("insufficient funds")
+		}
+		for _, in := range used {
+			info, _ := w.AddressInfo(in.UnlockConditions.UnlockHash())
+			bumped.SiacoinInputs = append(bumped.SiacoinInputs, in.SiacoinInput)
+			keyIndices = append(keyIndices, info.KeyIndex)
+		}
+		fee = fee.Add(inputFee)
+		if !change.IsZero() {
+			if changeAddr == (types.UnlockHash{}) {
+				return types.Transaction{}, nil, errors.New("no change address specified")
+			}
+			bumped.SiacoinOutputs = append(bumped.SiacoinOutputs, types.SiacoinOutput{
+				Value:      change,
+				UnlockHash: changeAddr,
+			})
+		}
+	}
+	bumped.MinerFees = []types.Currency{fee}
+	return bumped, keyIndices, nil
+}
+
+// checkReplacement returns an error unless replacement is a fee bump of old:
+// it must transfer only siacoins, spend every input of old, make the same
+// payments to other parties, and pay a higher fee.
+func checkReplacement(w *wallet.SeedWallet, old, replacement types.Transaction) error {
+	if !onlyTransfersSiacoins(replacement) {
+		return errors.New("replacement may only transfer siacoins")
+	}
+	spent := make(map[types.SiacoinOutputID]bool)
+	for _, in := range replacement.SiacoinInputs {
+		spent[in.ParentID] = true
+	}
+	for _, in := range old.SiacoinInputs {
+		if !spent[in.ParentID] {
+			return errors.New("replacement must spend every input of the original")
+		}
+	}
+	payments := func(txn types.Transaction) (outputs []types.SiacoinOutput) {
+		for _, sco := range txn.SiacoinOutputs {
+			if !w.OwnsAddress(sco.UnlockHash) {
+				outputs = append(outputs, sco)
+			}
+		}
+		return
+	}
+	oldPayments, newPayments := payments(old), payments(replacement)
+	if len(oldPayments) != len(newPayments) {
+		return errors.New("replacement must make the same payments as the original")
+	}
+	for i := range oldPayments {
+		if oldPayments[i].UnlockHash != newPayments[i].UnlockHash || !oldPayments[i].Value.Equals(newPayments[i].Value) {
+			return errors.New("replacement must make the same payments as the original")
+		}
+	}
+	if totalFee(replacement).Cmp(totalFee(old)) <= 0 {
+		return errors.New("replacement must pay a higher fee than the original")
+	}
+	return nil
+}
+
+// recordReplacement records that the transaction with ID old was replaced by
+// the transaction with ID replacement.
+func (t *Tracker) recordReplacement(old, replacement types.TransactionID) error {
+	return t.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketReplacements).Put(old[:], replacement[:])
+	})
+}
+
+// Replacement returns the ID of the transaction that replaced the specified
+// transaction via /limbo/:id/bump, if any.
+func (t *Tracker) Replacement(id types.TransactionID) (replacement types.TransactionID, ok bool) {
+	t.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucketReplacements).Get(id[:]); v != nil {
+			copy(replacement[:], v)
+			ok = true
+		}
+		return nil
+	})
+	return
+}
+
+// BumpFee replaces the specified transaction in Limbo with a copy paying the
+// specified fee (see DraftFeeBump), signed with s, and broadcasts it. It
+// returns the replacement. Broadcasting fails if the server's transaction pool
+// still holds the original.
+func (c *Client) BumpFee(s TransactionSigner, txid types.TransactionID, fee string) (types.Transaction, error) {
+	resp, err := c.DraftFeeBump(txid, RequestBump{Fee: fee})
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	txn := resp.Transaction
+	toSign := make([]crypto.Hash, len(txn.SiacoinInputs))
+	for i, in := range txn.SiacoinInputs {
+		toSign[i] = crypto.Hash(in.ParentID)
+	}
+	if err := s.SignTransaction(&txn, toSign); err != nil {
+		return types.Transaction{}, err
+	} else if _, err := c.BroadcastReplacement(txid, txn); err != nil {
+		return types.Transaction{}, err
+	}
+	return txn, nil
+}
@@ -0,0 +1,119 @@
+package walrus
+
+import (
+	"errors"
+	"fmt"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+)
+
+// SigningBundleVersion is the version of the SigningBundle format.
+const SigningBundleVersion = 1
+
+// A BundleInput describes an input of a SigningBundle's transaction.
+type BundleInput struct {
+	ParentID         types.SiacoinOutputID  `json:"parentID"`
+	Value            types.Currency         `json:"value"`
+	UnlockConditions types.UnlockConditions `json:"unlockConditions"`
+	// The seed index of the key that signs the input.
+	KeyIndex uint64 `json:"keyIndex"`
+}
+
+// A SigningBundle is an unsigned transaction, along with everything an offline
+// signer needs to check and sign it: the value and unlock conditions of each
+// input, and the seed index of its key. Like a Bitcoin PSBT, it can be carried
+// to an air-gapped machine, signed with SignBundle, and carried back to be
+// broadcast.
+type SigningBundle struct {
+	Version     int               `json:"version"`
+	Transaction types.Transaction `json:"transaction"`
+	// One for each of the transaction's siacoin inputs, in the same order.
+	Inputs []BundleInput `json:"inputs"`
+	// The transactions in Limbo that the transaction depends on, ordered such
+	// that each follows its parents.
+	Parents []types.Transaction `json:"parents"`
+}
+
+// Validate checks that b is well-formed: that its inputs match those of its
+// transaction, and that their values equal the transaction's outputs plus its
+// fees. It does not check that the inputs are unspent.
+func (b SigningBundle) Validate() error {
+	if b.Version != SigningBundleVersion {
+		return fmt.Errorf("unsupported bundle version %v", b.Version)
+	} else if len(b.Inputs) != len(b.Transaction.SiacoinInputs) {
+		return fmt.Errorf("bundle describes %v inputs, but transaction has %v", len(b.Inputs), len(b.Transaction.SiacoinInputs))
+	}
+	in := types.ZeroCurrency
+	for i, bi := range b.Inputs {
+		sci := b.Transaction.SiacoinInputs[i]
+		if bi.ParentID != sci.ParentID {
+			return fmt.Errorf("input %v has parent ID %v, but bundle describes %v", i, sci.ParentID, bi.ParentID)
+		} else if bi.UnlockConditions.UnlockHash() != sci.UnlockConditions.UnlockHash() {
+			return fmt.Errorf("input %v has different unlock conditions than described by bundle", i)
+		}
+		in = in.Add(bi.Value)
+	}
+	out := types.ZeroCurrency
+	for _, sco := range b.Transaction.SiacoinOutputs {
+		out = out.Add(sco.Value)
+	}
+	for _, fc := range b.Transaction.FileContracts {
+		out = out.Add(fc.Payout)
+	}
+	for _, fee := range b.Transaction.MinerFees {
+		out = out.Add(fee)
+	}
+	if !in.Equals(out) {
+		return fmt.Errorf("inputs total %v H, but outputs and fees total %v H", in, out)
+	}
+	return nil
+}
+
+// Fee returns the total miner fee paid by b's transaction.
+func (b SigningBundle) Fee() types.Currency {
+	fee := types.ZeroCurrency
+	for _, f := range b.Transaction.MinerFees {
+		fee = fee.Add(f)
+	}
+	return fee
+}
+
+// TransactionSet returns the transaction set that should be broadcast once
+// b's transaction has been signed.
+func (b SigningBundle) TransactionSet() []types.Transaction {
+	return append(append([]types.Transaction(nil), b.Parents...), b.Transaction)
+}
+
+// SigningRequest returns a SigningRequest for b's transaction, suitable for
+// the QR-based air-gapped signing workflow.
+func (b SigningBundle) SigningRequest() SigningRequest {
+	sr := SigningRequest{Transaction: b.Transaction}
+	for _, bi := range b.Inputs {
+		sr.ToSign = append(sr.ToSign, crypto.Hash(bi.ParentID))
+		sr.KeyIndices = append(sr.KeyIndices, bi.KeyIndex)
+	}
+	return sr
+}
+
+// SignBundle validates b and signs each of its inputs with the corresponding
+// key derived from seed. It does not require a connection to a walrus server.
+func SignBundle(b *SigningBundle, seed wallet.Seed) error {
+	if err := b.Validate(); err != nil {
+		return err
+	} else if len(b.Transaction.TransactionSignatures) > 0 {
+		return errors.New("transaction is already signed")
+	}
+	for i, bi := range b.Inputs {
+		uc := wallet.StandardUnlockConditions(seed.PublicKey(bi.KeyIndex))
+		if uc.UnlockHash() != bi.UnlockConditions.UnlockHash() {
+			return fmt.Errorf("input %v is not controlled by key %v of the seed", i, bi.KeyIndex)
+		}
+	}
+	for _, bi := range b.Inputs {
+		sig := wallet.StandardTransactionSignature(crypto.Hash(bi.ParentID))
+		wallet.AppendTransactionSignature(&b.Transaction, sig, seed.SecretKey(bi.KeyIndex))
+	}
+	return nil
+}
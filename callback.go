@@ -0,0 +1,240 @@
+package walrus
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	keyCallbackCursor  = []byte("callbackCursor")
+	keyCallbackRetries = []byte("callbackRetries")
+)
+
+// callbackClient is the client used to deliver deposit callbacks.
+var callbackClient = &http.Client{Timeout: 10 * time.Second}
+
+// SignCallback returns the hex-encoded HMAC-SHA256 of a callback body, keyed
+// by the deposit's callback secret. walrus sends it in the Walrus-Signature
+// header of each callback; recipients should recompute it and compare with
+// hmac.Equal.
+func SignCallback(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateCallback checks that a callback URL and secret are usable. An empty
+// URL is valid, and disables callbacks.
+func validateCallback(callbackURL, secret string) error {
+	if callbackURL == "" {
+		return nil
+	}
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return err
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("callback URL must be http or https")
+	} else if secret == "" {
+		return errors.New("callback must specify a secret")
+	}
+	return nil
+}
+
+// SetDepositCallback sets the URL that events relating to the specified
+// deposit are posted to, and the secret used to sign them. An empty URL
+// disables callbacks for the deposit.
+func (t *Tracker) SetDepositCallback(addr types.UnlockHash, callbackURL, secret string) error {
+	if err := validateCallback(callbackURL, secret); err != nil {
+		return err
+	}
+	return t.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketDeposits)
+		var d Deposit
+		if !getJSON(b, addr[:], &d) {
+			return errors.New("no deposit with address " + addr.String())
+		}
+		d.Callback, d.CallbackSecret = callbackURL, secret
+		if callbackURL == "" {
+			d.CallbackSecret = ""
+		}
+		return putJSON(b, addr[:], d)
+	})
+}
+
+// eventDeposit returns the deposit address that e relates to, if any.
+func eventDeposit(e Event) (types.UnlockHash, bool) {
+	switch e.Type {
+	case EventDepositReceived:
+		var dr DepositReceipt
+		err := json.Unmarshal(e.Data, &dr)
+		return dr.Address, err == nil
+	case EventPaymentConfirming, EventPaymentFinal, EventPaymentReverted:
+		var p Payment
+		err := json.Unmarshal(e.Data, &p)
+		return p.Address, err == nil
+	default:
+		return types.UnlockHash{}, false
+	}
+}
+
+// sendCallback posts e to the deposit's callback URL.
+func sendCallback(d Deposit, e Event) error {
+	js, _ := json.Marshal(e)
+	req, err := http.NewRequest("POST", d.Callback, bytes.NewReader(js))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Walrus-Signature", SignCallback(d.CallbackSecret, js))
+	resp, err := callbackClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer io.Copy(ioutil.Discard, resp.Body)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%v: %s", resp.Status, body)
+	}
+	return nil
+}
+
+func (t *Tracker) notifyCallbacks() {
+	select {
+	case t.callbackSignal <- struct{}{}:
+	default:
+	}
+}
+
+// callbackRetryPolicy controls the delay before a failed callback is retried.
+var callbackRetryPolicy = RetryPolicy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     10 * time.Minute,
+	Jitter:         0.2,
+}
+
+// A callbackRetry records a deposit whose callbacks are held back by a failed
+// delivery.
+type callbackRetry struct {
+	// The sequence number of the first undelivered event.
+	Seq      uint64    `json:"seq"`
+	Failures int       `json:"failures"`
+	RetryAt  time.Time `json:"retryAt"`
+}
+
+// callbackLoop delivers deposit events to their deposits' callback URLs. Each
+// deposit's events are delivered in order: if a callback fails, that
+// deposit's later events are held back, and delivery is retried with
+// exponential backoff. Other deposits are unaffected.
+func (t *Tracker) callbackLoop() {
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-t.callbackSignal:
+		case <-retry:
+		case <-t.closed:
+			return
+		}
+		if next := t.deliverCallbacks(time.Now()); next.IsZero() {
+			retry = nil
+		} else {
+			retry = time.After(time.Until(next))
+		}
+	}
+}
+
+// deliverCallbacks retries the held-back deposits whose backoff has elapsed as
+// of now, then delivers the events after the callback cursor, advancing the
+// cursor past each one. It returns the time of the next retry, if any.
+func (t *Tracker) deliverCallbacks(now time.Time) (nextRetry time.Time) {
+	var cursor uint64
+	retries := make(map[string]callbackRetry)
+	t.db.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(bucketMeta)
+		getJSON(meta, keyCallbackCursor, &cursor)
+		getJSON(meta, keyCallbackRetries, &retries)
+		return nil
+	})
+	save := func() {
+		t.db.Update(func(tx *bolt.Tx) error {
+			meta := tx.Bucket(bucketMeta)
+			if err := putJSON(meta, keyCallbackRetries, retries); err != nil {
+				return err
+			}
+			return putJSON(meta, keyCallbackCursor, cursor)
+		})
+	}
+	send := func(addr types.UnlockHash, e Event) error {
+		if d, ok := t.Deposit(addr); ok && d.Callback != "" {
+			return sendCallback(d, e)
+		}
+		return nil
+	}
+	fail := func(key string, seq uint64) {
+		r := retries[key]
+		if r.Seq != seq {
+			r = callbackRetry{Seq: seq}
+		}
+		r.Failures++
+		r.RetryAt = now.Add(callbackRetryPolicy.backoff(r.Failures))
+		retries[key] = r
+	}
+
+	// standbys skip events; the leader delivers them
+	leader := t.isLeader()
+	if leader {
+		for key, r := range retries {
+			if now.Before(r.RetryAt) {
+				continue
+			}
+			delivered := true
+			for _, e := range t.EventsAfter(r.Seq-1, -1) {
+				if e.Seq > cursor {
+					break
+				}
+				if addr, ok := eventDeposit(e); ok && addr.String() == key {
+					if err := send(addr, e); err != nil {
+						fail(key, e.Seq)
+						delivered = false
+						break
+					}
+				}
+			}
+			if delivered {
+				delete(retries, key)
+			}
+		}
+		save()
+	}
+	for _, e := range t.EventsAfter(cursor, -1) {
+		if addr, ok := eventDeposit(e); ok && leader {
+			key := addr.String()
+			if _, held := retries[key]; !held {
+				if err := send(addr, e); err != nil {
+					fail(key, e.Seq)
+				}
+			}
+		}
+		cursor = e.Seq
+		save()
+	}
+	for _, r := range retries {
+		if nextRetry.IsZero() || r.RetryAt.Before(nextRetry) {
+			nextRetry = r.RetryAt
+		}
+	}
+	return
+}
@@ -0,0 +1,111 @@
+package walrus
+
+import (
+	"errors"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// A ChainAdapter provides the network-specific parts of a walrus server: the
+// blockchain it follows, the transaction pool it broadcasts to, and the rules
+// for validating transactions. Supporting a fork or a future
+// network upgrade only requires a new ChainAdapter; the server, store, and
+// client are unaffected.
+//
+// Adapters currently share the transaction and block types of Sia, along with
+// its encoding, which determines transaction sizes and fees.
+type ChainAdapter interface {
+	ConsensusSet
+	TransactionPool
+
+	// Network returns the name of the network, e.g. "mainnet".
+	Network() string
+	// Subscribe sends s the consensus changes following ccid, and then any
+	// new changes as they occur.
+	Subscribe(s modules.ConsensusSetSubscriber, ccid modules.ConsensusChangeID) error
+	// ValidateTransaction checks whether txn could be included in a block at
+	// the specified height, without regard to the rest of the blockchain.
+	ValidateTransaction(txn types.Transaction, height types.BlockHeight) error
+	// UnconfirmedTransaction returns the unconfirmed transaction with the
+	// specified ID, if it is known to the transaction pool.
+	UnconfirmedTransaction(id types.TransactionID) (types.Transaction, bool)
+}
+
+// A consensusSubscriber can subscribe to consensus changes. The Sia consensus
+// set satisfies this interface.
+type consensusSubscriber interface {
+	ConsensusSetSubscribe(modules.ConsensusSetSubscriber, modules.ConsensusChangeID, <-chan struct{}) error
+}
+
+// SiaAdapter is the ChainAdapter for the Sia network.
+type SiaAdapter struct {
+	CS ConsensusSet
+	TP TransactionPool
+	// The name reported by Network. If empty, "mainnet" is reported.
+	Name string
+}
+
+// BlockAtHeight implements ChainAdapter.
+func (sa SiaAdapter) BlockAtHeight(height types.BlockHeight) (types.Block, bool) {
+	return sa.CS.BlockAtHeight(height)
+}
+
+// ChildTarget implements ChainAdapter.
+func (sa SiaAdapter) ChildTarget(id types.BlockID) (types.Target, bool) {
+	return sa.CS.ChildTarget(id)
+}
+
+// CurrentBlock implements ChainAdapter.
+func (sa SiaAdapter) CurrentBlock() types.Block {
+	return sa.CS.CurrentBlock()
+}
+
+// Height implements ChainAdapter.
+func (sa SiaAdapter) Height() types.BlockHeight {
+	return sa.CS.Height()
+}
+
+// AcceptTransactionSet implements ChainAdapter.
+func (sa SiaAdapter) AcceptTransactionSet(txnSet []types.Transaction) error {
+	return sa.TP.AcceptTransactionSet(txnSet)
+}
+
+// FeeEstimation implements ChainAdapter.
+func (sa SiaAdapter) FeeEstimation() (min, max types.Currency) {
+	return sa.TP.FeeEstimation()
+}
+
+// Network implements ChainAdapter.
+func (sa SiaAdapter) Network() string {
+	if sa.Name == "" {
+		return "mainnet"
+	}
+	return sa.Name
+}
+
+// Subscribe implements ChainAdapter. It returns an error if CS cannot send
+// consensus changes.
+func (sa SiaAdapter) Subscribe(s modules.ConsensusSetSubscriber, ccid modules.ConsensusChangeID) error {
+	cs, ok := sa.CS.(consensusSubscriber)
+	if !ok {
+		return errors.New("consensus set does not support subscriptions")
+	}
+	return cs.ConsensusSetSubscribe(s, ccid, nil)
+}
+
+// ValidateTransaction implements ChainAdapter.
+func (SiaAdapter) ValidateTransaction(txn types.Transaction, height types.BlockHeight) error {
+	return txn.StandaloneValid(height)
+}
+
+// UnconfirmedTransaction implements ChainAdapter. It always reports false if
+// TP cannot look up transactions.
+func (sa SiaAdapter) UnconfirmedTransaction(id types.TransactionID) (types.Transaction, bool) {
+	tf, ok := sa.TP.(transactionFinder)
+	if !ok {
+		return types.Transaction{}, false
+	}
+	txn, _, ok := tf.Transaction(id)
+	return txn, ok
+}
@@ -0,0 +1,81 @@
+package walrus
+
+import (
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+	"lukechampine.com/us/wallet"
+)
+
+// changeOutputs reports which of txn's siacoin outputs are change, i.e.
+// outputs returned to the wallet by a transaction that spends the wallet's
+// own outputs. It returns nil if txn spends no wallet outputs.
+func changeOutputs(w *wallet.SeedWallet, txn types.Transaction) []bool {
+	spendsWallet := false
+	for _, sci := range txn.SiacoinInputs {
+		spendsWallet = spendsWallet || w.OwnsAddress(sci.UnlockConditions.UnlockHash())
+	}
+	if !spendsWallet {
+		return nil
+	}
+	change := make([]bool, len(txn.SiacoinOutputs))
+	for i, sco := range txn.SiacoinOutputs {
+		change[i] = w.OwnsAddress(sco.UnlockHash)
+	}
+	return change
+}
+
+// isInternal reports whether txn is a self-transfer, i.e. a transaction that
+// spends only wallet outputs and creates only wallet outputs, such as a
+// consolidation or split. Apart from the miner fee, an internal transaction
+// does not change the wallet's balance.
+func isInternal(w *wallet.SeedWallet, txn types.Transaction) bool {
+	if len(txn.SiacoinInputs) == 0 || len(txn.FileContracts) != 0 {
+		return false
+	}
+	for _, sci := range txn.SiacoinInputs {
+		if !w.OwnsAddress(sci.UnlockConditions.UnlockHash()) {
+			return false
+		}
+	}
+	for _, sco := range txn.SiacoinOutputs {
+		if !w.OwnsAddress(sco.UnlockHash) {
+			return false
+		}
+	}
+	for _, sfo := range txn.SiafundOutputs {
+		if !w.OwnsAddress(sfo.UnlockHash) {
+			return false
+		}
+	}
+	return true
+}
+
+// recordChange marks the change outputs created by the applied blocks of cc.
+func (t *Tracker) recordChange(tx *bolt.Tx, cc modules.ConsensusChange) error {
+	b := tx.Bucket(bucketChangeOutputs)
+	for _, block := range cc.AppliedBlocks {
+		for _, txn := range block.Transactions {
+			for i, isChange := range changeOutputs(t.w, txn) {
+				if !isChange {
+					continue
+				}
+				id := txn.SiacoinOutputID(uint64(i))
+				if err := b.Put(id[:], []byte{1}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// IsChange reports whether the specified output is change returned to the
+// wallet by one of its own transactions.
+func (t *Tracker) IsChange(id types.SiacoinOutputID) (change bool) {
+	t.db.View(func(tx *bolt.Tx) error {
+		change = tx.Bucket(bucketChangeOutputs).Get(id[:]) != nil
+		return nil
+	})
+	return
+}
@@ -2,22 +2,114 @@ package walrus
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
+	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/types"
 	"lukechampine.com/us/wallet"
+	"lukechampine.com/walrus/api"
 )
 
 // A Client communicates with a walrus server.
 type Client struct {
-	addr string
+	addr  string
+	hc    *http.Client
+	ctx   context.Context
+	stats *statsCollector
+	retry RetryPolicy
+	// the Authorization header sent with each request, if any
+	auth     string
+	compat   *compatibilityCheck
+	identity *walletIDCheck
+}
+
+// WithContext returns a shallow copy of c whose requests use ctx. Cancelling
+// ctx aborts any in-flight requests made by the copy.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	if ctx == nil {
+		panic("nil context")
+	}
+	c2 := *c
+	c2.ctx = ctx
+	return &c2
+}
+
+// roundTrip sends a request to the server and returns its response, which
+// the caller must close. A response with a status other than 200 OK is
+// returned as an *APIError. GET requests are retried according to the
+// Client's RetryPolicy.
+func (c *Client) roundTrip(method, route string, body io.Reader, contentType string) (*http.Response, error) {
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if c.compat != nil {
+		if err := c.compat.check(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	if c.identity != nil {
+		if err := c.identity.check(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	r, err := c.attempt(ctx, method, route, body, contentType)
+	if method != "GET" {
+		return r, err
+	}
+	for retry := 1; retry < c.retry.MaxAttempts && err != nil && c.retry.retryable(err); retry++ {
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(c.retry.backoff(retry)):
+		}
+		r, err = c.attempt(ctx, method, route, body, contentType)
+	}
+	return r, err
+}
+
+// attempt makes a single attempt at a request.
+func (c *Client) attempt(ctx context.Context, method, route string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%v%v", c.addr, route), body)
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.auth != "" {
+		req.Header.Set("Authorization", c.auth)
+	}
+	start := time.Now()
+	r, err := c.hc.Do(req)
+	if err == nil && r.StatusCode != 200 {
+		msg, _ := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		err = &APIError{
+			StatusCode: r.StatusCode,
+			Method:     method,
+			Route:      req.URL.Path,
+			Message:    strings.TrimSpace(string(msg)),
+		}
+	}
+	if c.stats != nil {
+		c.stats.record(method, route, time.Since(start), err != nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
 }
 
 func (c *Client) req(method string, route string, data, resp interface{}) error {
@@ -26,27 +118,77 @@ func (c *Client) req(method string, route string, data, resp interface{}) error
 		js, _ := json.Marshal(data)
 		body = bytes.NewReader(js)
 	}
-	req, err := http.NewRequest(method, fmt.Sprintf("%v%v", c.addr, route), body)
-	if err != nil {
-		panic(err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	r, err := http.DefaultClient.Do(req)
+	r, err := c.roundTrip(method, route, body, "application/json")
 	if err != nil {
 		return err
 	}
 	defer io.Copy(ioutil.Discard, r.Body)
 	defer r.Body.Close()
-	if r.StatusCode != 200 {
-		err, _ := ioutil.ReadAll(r.Body)
-		return errors.New(string(err))
-	}
 	if resp == nil {
 		return nil
 	}
 	return json.NewDecoder(r.Body).Decode(resp)
 }
 
+// ResponseOptions customize the responses of endpoints that support them.
+type ResponseOptions struct {
+	// If non-empty, only these top-level JSON fields are returned; all other
+	// fields of the decoded response will be zero.
+	Fields []string
+}
+
+// fieldsQuery returns the query parameters corresponding to opts, prefixed with
+// '&', or the empty string.
+func fieldsQuery(opts []ResponseOptions) string {
+	var fields []string
+	for _, o := range opts {
+		fields = append(fields, o.Fields...)
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return "&fields=" + url.QueryEscape(strings.Join(fields, ","))
+}
+
+// withField adds field to opts if opts selects a subset of fields.
+func withField(opts []ResponseOptions, field string) []ResponseOptions {
+	for _, o := range opts {
+		if len(o.Fields) > 0 {
+			return append(opts, ResponseOptions{Fields: []string{field}})
+		}
+	}
+	return opts
+}
+
+// addCSVOptions adds the query parameters corresponding to opts to q.
+func addCSVOptions(q url.Values, opts []CSVOptions) {
+	for _, o := range opts {
+		for k, v := range map[string]string{
+			"decimal":    o.Decimal,
+			"dateformat": o.DateFormat,
+			"currency":   o.Currency,
+		} {
+			if v != "" {
+				q.Set(k, v)
+			}
+		}
+	}
+}
+
+// pageQuery returns the query parameters for a page of at most limit items
+// following cursor. One extra item is requested, to determine whether another
+// page follows.
+func pageQuery(cursorParam string, cursor crypto.Hash, limit int) string {
+	if limit <= 0 {
+		panic("page limit must be positive")
+	}
+	q := "limit=" + strconv.Itoa(limit+1)
+	if cursor != (crypto.Hash{}) {
+		q += "&" + cursorParam + "=" + cursor.String()
+	}
+	return q
+}
+
 func (c *Client) get(route string, r interface{}) error     { return c.req("GET", route, nil, r) }
 func (c *Client) post(route string, d, r interface{}) error { return c.req("POST", route, d, r) }
 func (c *Client) put(route string, d interface{}) error     { return c.req("PUT", route, d, nil) }
@@ -54,70 +196,628 @@ func (c *Client) delete(route string) error                 { return c.req("DELE
 
 // Addresses returns all addresses known to the wallet.
 func (c *Client) Addresses() (addrs []types.UnlockHash, err error) {
-	err = c.get("/addresses", &addrs)
+	err = c.get(api.Addresses, &addrs)
+	return
+}
+
+// AddressesByLabel returns the addresses known to the wallet that carry each
+// of the specified labels.
+func (c *Client) AddressesByLabel(labels ...string) (addrs []types.UnlockHash, err error) {
+	err = c.get(api.Addresses+"?"+url.Values{"label": labels}.Encode(), &addrs)
 	return
 }
 
 // AddressInfo returns information about a specific address, including its
 // unlock conditions and the index it was derived from.
 func (c *Client) AddressInfo(addr types.UnlockHash) (info wallet.SeedAddressInfo, err error) {
-	err = c.get("/addresses/"+addr.String(), &info)
+	err = c.get(api.Path(api.AddressesAddr, addr.String()), &info)
 	return
 }
 
+// AddressLabels returns the labels attached to the specified address.
+func (c *Client) AddressLabels(addr types.UnlockHash) (labels []string, err error) {
+	var info struct {
+		Labels []string `json:"labels"`
+	}
+	err = c.get(api.Path(api.AddressesAddr, addr.String()), &info)
+	return info.Labels, err
+}
+
+// SetAddressLabels replaces the labels attached to the specified address,
+// e.g. "cold" or "customer 1234". If labels is empty, the address's labels are
+// removed.
+func (c *Client) SetAddressLabels(addr types.UnlockHash, labels []string) error {
+	return c.put(api.Path(api.AddressesAddrLabel, addr.String()), labels)
+}
+
+// OwnershipProof returns an unsigned proof that the wallet controls addr,
+// carrying the specified message. The proof must be signed with the key at
+// resp.KeyIndex, either via resp.Proof.Sign (for hot wallets) or by signing
+// resp.SigHash and calling resp.Proof.AddSignature (for hardware wallets),
+// before it is given to the verifier.
+func (c *Client) OwnershipProof(addr types.UnlockHash, message string) (resp ResponseOwnership, err error) {
+	err = c.get(api.Path(api.AddressesAddrOwnership, addr.String())+"?message="+url.QueryEscape(message), &resp)
+	return
+}
+
+// VerifyOwnership asks the server to verify proof, which need not concern an
+// address in the server's wallet. It returns nil if the proof is valid. Proofs
+// can also be verified locally with VerifyOwnershipProof.
+func (c *Client) VerifyOwnership(proof OwnershipProof) error {
+	var resp ResponseOwnershipVerify
+	if err := c.post(api.OwnershipVerify, proof, &resp); err != nil {
+		return err
+	} else if !resp.Valid {
+		return errors.New("invalid ownership proof: " + resp.Error)
+	}
+	return nil
+}
+
 // Balance returns the current wallet balance. If the limbo flag is true, the
 // balance will reflect any transactions currently in Limbo.
 func (c *Client) Balance(limbo bool) (bal types.Currency, err error) {
-	err = c.get("/balance?limbo="+strconv.FormatBool(limbo), &bal)
+	err = c.get(api.Balance+"?limbo="+strconv.FormatBool(limbo), &bal)
 	return
 }
 
-// Broadcast broadcasts the supplied transaction set to all connected peers.
-func (c *Client) Broadcast(txnSet []types.Transaction) error {
-	return c.post("/broadcast", txnSet, nil)
+// BalanceWithDust is like Balance, but includes outputs worth less than the
+// server's dust threshold.
+func (c *Client) BalanceWithDust(limbo bool) (bal types.Currency, err error) {
+	err = c.get(api.Balance+"?limbo="+strconv.FormatBool(limbo)+"&includeDust=true", &bal)
+	return
 }
 
-// BlockRewards returns the block rewards tracked by the wallet. If max < 0, all
-// rewards are returned; otherwise, at most max rewards are returned. The
-// rewards are ordered newest-to-oldest.
-func (c *Client) BlockRewards(max int) (rewards []wallet.BlockReward, err error) {
-	err = c.get("/blockrewards?max="+strconv.Itoa(max), &rewards)
+// Broadcast broadcasts the supplied transaction set to all connected peers,
+// returning a receipt describing each transaction.
+func (c *Client) Broadcast(txnSet []types.Transaction) (receipt ResponseBroadcast, err error) {
+	err = c.post(api.Broadcast, txnSet, &receipt)
 	return
 }
 
-// ConsensusInfo returns the current blockchain height and consensus change ID.
-// The latter is a unique ID that changes whenever blocks are added to the
-// blockchain.
+// BlockRewards returns the block rewards tracked by the wallet, along with the
+// timestamps of the blocks they were mined in. If max < 0, all rewards are
+// returned; otherwise, at most max rewards are returned. The rewards are
+// ordered newest-to-oldest. Large requests are fetched in pages.
+func (c *Client) BlockRewards(max int) (rewards []ResponseBlockReward, err error) {
+	if max >= 0 && max <= iterPageSize {
+		err = c.get(api.BlockRewards+"?max="+strconv.Itoa(max), &rewards)
+		return
+	}
+	var before types.SiacoinOutputID
+	for {
+		page, next, err := c.BlockRewardsPage(before, iterPageSize)
+		if err != nil {
+			return nil, err
+		}
+		rewards = append(rewards, page...)
+		if max >= 0 && len(rewards) >= max {
+			return rewards[:max], nil
+		} else if next == (types.SiacoinOutputID{}) {
+			return rewards, nil
+		}
+		before = next
+	}
+}
+
+// BlockRewardsPage returns a page of at most limit block rewards, ordered
+// newest-to-oldest, starting after the reward with ID before; if before is
+// the zero ID, the page starts with the newest reward. It also returns the
+// cursor for the next page, which is the zero ID if there are no more
+// rewards.
+func (c *Client) BlockRewardsPage(before types.SiacoinOutputID, limit int) (rewards []ResponseBlockReward, next types.SiacoinOutputID, err error) {
+	err = c.get(api.BlockRewards+"?"+pageQuery("before", crypto.Hash(before), limit), &rewards)
+	if err == nil && len(rewards) > limit {
+		rewards = rewards[:limit]
+		next = rewards[limit-1].ID
+	}
+	return
+}
+
+// ConsensusInfo returns the current blockchain height, consensus change ID,
+// and network name. The consensus change ID is a unique ID that changes
+// whenever blocks are added to the blockchain.
 func (c *Client) ConsensusInfo() (info ResponseConsensus, err error) {
-	err = c.get("/consensus", &info)
+	err = c.get(api.Consensus, &info)
+	return
+}
+
+// Health reports whether the server is ready to serve requests: its wallet
+// must be synced with the network, and its database writable. If the server
+// is not ready, Health returns an *APIError, and resp describes why.
+func (c *Client) Health() (resp ResponseReady, err error) {
+	err = c.get(api.Ready, &resp)
+	if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusServiceUnavailable {
+		json.Unmarshal([]byte(apiErr.Message), &resp)
+	}
+	return
+}
+
+// WaitForBlock blocks until the server's consensus change ID differs from
+// ccid, then returns the new consensus info. It long-polls the server rather
+// than repeatedly requesting /consensus. To stop waiting, use WithContext.
+func (c *Client) WaitForBlock(ccid crypto.Hash) (info ResponseConsensus, err error) {
+	for {
+		err = c.get(api.Consensus+"?wait="+ccid.String()+"&timeout=30s", &info)
+		if err != nil || info.CCID != ccid {
+			return
+		}
+	}
+}
+
+// VerifyIndex cross-checks the wallet against the most recent depth blocks of
+// the blockchain, or the entire blockchain if depth is 0. If repair is true and
+// discrepancies are found, the server rebuilds the wallet's index.
+func (c *Client) VerifyIndex(depth types.BlockHeight, repair bool) (report ResponseDBVerify, err error) {
+	err = c.post(api.DBVerify+fmt.Sprintf("?depth=%v&repair=%v", depth, repair), nil, &report)
+	return
+}
+
+// VerifyIndexAsync is like VerifyIndex, but runs the check as a background
+// job. When the job is done, its Result contains a ResponseDBVerify.
+func (c *Client) VerifyIndexAsync(depth types.BlockHeight, repair bool) (job Job, err error) {
+	err = c.post(api.DBVerify+fmt.Sprintf("?depth=%v&repair=%v&async=true", depth, repair), nil, &job)
+	return
+}
+
+// Jobs returns every job started by the server.
+func (c *Client) Jobs() (jobs []Job, err error) {
+	err = c.get(api.Jobs, &jobs)
+	return
+}
+
+// Job returns the job with the specified ID.
+func (c *Client) Job(id string) (job Job, err error) {
+	err = c.get(api.Path(api.JobsID, id), &job)
+	return
+}
+
+// CancelJob cancels the job with the specified ID.
+func (c *Client) CancelJob(id string) error {
+	return c.delete(api.Path(api.JobsID, id))
+}
+
+// AwaitJob polls the job with the specified ID until it is no longer running
+// or ctx is cancelled.
+func (c *Client) AwaitJob(ctx context.Context, id string, interval time.Duration) (Job, error) {
+	c = c.WithContext(ctx)
+	for {
+		job, err := c.Job(id)
+		if ctx.Err() != nil {
+			return job, ctx.Err()
+		} else if err != nil {
+			return Job{}, err
+		} else if job.Status != JobRunning {
+			return job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Deposits returns the deposit addresses provisioned for the specified
+// reference, along with the total amount received by each. If reference is
+// empty, all deposits are returned.
+func (c *Client) Deposits(reference string) (deposits []ResponseDeposit, err error) {
+	err = c.get(api.Deposits+"?reference="+url.QueryEscape(reference), &deposits)
+	return
+}
+
+// Checkout returns the information a checkout page needs to request payment
+// to the specified deposit address. If currency is non-empty, the amount is
+// also converted to that fiat currency.
+func (c *Client) Checkout(addr types.UnlockHash, currency string) (co ResponseCheckout, err error) {
+	err = c.get(api.Path(api.DepositsAddrCheckout, addr.String())+"?currency="+url.QueryEscape(currency), &co)
+	return
+}
+
+// SetDepositCallback sets the URL that events relating to the specified
+// deposit are posted to, and the secret used to sign them (see SignCallback).
+// An empty URL disables callbacks for the deposit.
+func (c *Client) SetDepositCallback(addr types.UnlockHash, callbackURL, secret string) error {
+	return c.put(api.Path(api.DepositsAddrCallback, addr.String()), RequestDepositCallback{
+		URL:    callbackURL,
+		Secret: secret,
+	})
+}
+
+// Events returns the most recent events relating to the wallet. If max < 0,
+// all events are returned; otherwise, at most max events are returned. The
+// events are ordered newest-to-oldest. Large requests are fetched in pages.
+func (c *Client) Events(max int) (events []Event, err error) {
+	if max >= 0 && max <= iterPageSize {
+		err = c.get(api.Events+"?max="+strconv.Itoa(max), &events)
+		return
+	}
+	// only the oldest-to-newest listing can be paged
+	if events, err = c.EventsAfter(0, -1); err != nil {
+		return nil, err
+	}
+	if max >= 0 && len(events) > max {
+		events = events[len(events)-max:]
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, nil
+}
+
+// EventsAfter returns the events with sequence numbers greater than seq,
+// ordered oldest-to-newest. If max >= 0, at most max events are returned.
+// Large requests are fetched in pages.
+func (c *Client) EventsAfter(seq uint64, max int) (events []Event, err error) {
+	for {
+		limit := iterPageSize
+		if max >= 0 && max-len(events) < limit {
+			limit = max - len(events)
+		}
+		var page []Event
+		if err := c.get(api.Events+"?after="+strconv.FormatUint(seq, 10)+"&max="+strconv.Itoa(limit), &page); err != nil {
+			return nil, err
+		}
+		events = append(events, page...)
+		if len(page) < limit || len(events) == max {
+			return events, nil
+		}
+		seq = page[len(page)-1].Seq
+	}
+}
+
+// Payments returns the payments made to deposits with the specified reference,
+// along with their confirmation state. If reference is empty, all payments are
+// returned.
+func (c *Client) Payments(reference string) (payments []Payment, err error) {
+	err = c.get(api.Payments+"?reference="+url.QueryEscape(reference), &payments)
+	return
+}
+
+// Payouts pays each of the payouts in rp, dividing them among as many
+// transactions as the size limit requires. Unless rp.Sign is set, the
+// transactions are returned as signing bundles, which must be signed (e.g.
+// with SignBundle) and broadcast in order. If only some of the signed
+// transactions could be broadcast, resp reports the payouts that were made,
+// and err is non-nil.
+func (c *Client) Payouts(rp RequestPayouts) (resp ResponsePayouts, err error) {
+	err = c.post(api.Payouts, rp, &resp)
+	if err == nil && resp.Error != "" {
+		err = errors.New(resp.Error)
+	}
+	return
+}
+
+// Reconcile returns the postings recorded after the consensus change since,
+// ordered oldest-to-newest, along with the ID of the last consensus change
+// processed, which should be passed as since in the next call. If since is
+// the zero ID, every posting is returned. The postings are fetched in pages.
+func (c *Client) Reconcile(since crypto.Hash) (postings []Posting, ccid crypto.Hash, err error) {
+	route := api.Reconcile + "?limit=" + strconv.Itoa(iterPageSize)
+	if since != (crypto.Hash{}) {
+		route += "&since=" + since.String()
+	}
+	for {
+		var resp ResponseReconcile
+		if err := c.get(route, &resp); err != nil {
+			return nil, crypto.Hash{}, err
+		}
+		postings = append(postings, resp.Postings...)
+		if resp.CCID != nil {
+			return postings, *resp.CCID, nil
+		} else if len(resp.Postings) == 0 {
+			return nil, crypto.Hash{}, errors.New("server returned an empty page without a consensus change ID")
+		}
+		route = api.Reconcile + "?limit=" + strconv.Itoa(iterPageSize) + "&after=" + strconv.FormatUint(resp.Postings[len(resp.Postings)-1].Seq, 10)
+	}
+}
+
+// Consolidate returns an unsigned transaction that merges the wallet's small
+// outputs into fewer, larger outputs, as specified by rc. If the fee exceeds
+// rc.MaxFeePerByte, or there are too few outputs to consolidate, the returned
+// error matches ErrConsolidationDeferred.
+func (c *Client) Consolidate(rc RequestConsolidate) (resp ResponseConsolidate, err error) {
+	err = c.post(api.Consolidate, rc, &resp)
+	return
+}
+
+// Consolidation returns an unsigned transaction that consolidates the wallet's
+// matured block rewards according to the server's consolidation policy. The
+// fee may be a fee tier (e.g. FeeTierPriority), a value in hastings per byte,
+// or empty to use the recommended fee.
+func (c *Client) Consolidation(fee string) (cons ResponseConsolidation, err error) {
+	err = c.get(api.Consolidation+"?fee="+url.QueryEscape(fee), &cons)
+	return
+}
+
+// CostBasis returns the wallet's realized gains, matching each disposal
+// against prior acquisitions using the specified policy (PolicyFIFO or
+// PolicyLIFO).
+func (c *Client) CostBasis(policy string) (report ResponseCostBasis, err error) {
+	err = c.get(api.ReportsCostBasis+"?policy="+policy, &report)
+	return
+}
+
+// CostBasisCSV returns the wallet's realized gains as a CSV file, formatted
+// according to opts.
+func (c *Client) CostBasisCSV(policy string, opts ...CSVOptions) ([]byte, error) {
+	q := url.Values{
+		"policy": {policy},
+		"format": {"csv"},
+	}
+	addCSVOptions(q, opts)
+	r, err := c.roundTrip("GET", api.ReportsCostBasis+"?"+q.Encode(), nil, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	return ioutil.ReadAll(r.Body)
+}
+
+// HostReport returns a summary of the wallet's file contracts from the
+// perspective of a host: funds locked in active contracts, expected payouts,
+// and the outcomes of resolved contracts.
+func (c *Client) HostReport() (report ResponseHostReport, err error) {
+	err = c.get(api.ReportsHost, &report)
+	return
+}
+
+// RenterReport returns a summary of the wallet's spending on file contracts
+// and fees between start and end.
+func (c *Client) RenterReport(start, end time.Time) (report ResponseRenterReport, err error) {
+	q := url.Values{
+		"start": {start.Format(time.RFC3339)},
+		"end":   {end.Format(time.RFC3339)},
+	}
+	err = c.get(api.ReportsRenter+"?"+q.Encode(), &report)
+	return
+}
+
+// Statement returns a statement file covering the period between start and
+// end, in the specified format ("json" or "csv"), along with the server's
+// signature of the file. The signature can be checked with VerifyStatement.
+// CSV files are formatted according to opts.
+func (c *Client) Statement(start, end time.Time, format string, opts ...CSVOptions) (file, sig []byte, err error) {
+	q := url.Values{
+		"start":  {start.Format(time.RFC3339)},
+		"end":    {end.Format(time.RFC3339)},
+		"format": {format},
+	}
+	addCSVOptions(q, opts)
+	r, err := c.roundTrip("GET", api.ReportsStatement+"?"+q.Encode(), nil, "application/json")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Body.Close()
+	file, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	sig, err = hex.DecodeString(r.Header.Get(StatementSignatureHeader))
+	return
+}
+
+// StatementKey returns the public key that the server signs statements with.
+func (c *Client) StatementKey() (pubkey ed25519.PublicKey, err error) {
+	var s string
+	if err = c.get(api.ReportsStatementKey, &s); err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(s)
+}
+
+// PushDevices returns the mobile devices registered to receive push
+// notifications.
+func (c *Client) PushDevices() (devices []PushDevice, err error) {
+	err = c.get(api.PushDevices, &devices)
+	return
+}
+
+// FeeTiers returns the current fee for each fee tier, along with the estimated
+// number of blocks until a transaction paying that fee is confirmed.
+func (c *Client) FeeTiers() (tiers []ResponseFeeTier, err error) {
+	err = c.get(api.FeeTiers, &tiers)
 	return
 }
 
 // RecommendedFee returns the current recommended transaction fee in hastings
 // per byte of the Sia-encoded transaction.
 func (c *Client) RecommendedFee() (fee types.Currency, err error) {
-	err = c.get("/fee", &fee)
+	err = c.get(api.Fee, &fee)
 	return
 }
 
 // FileContracts returns the file contracts tracked by the wallet. If max < 0,
 // all contracts are returned; otherwise, at most max contracts are returned.
-// The contracts are ordered newest-to-oldest.
-func (c *Client) FileContracts(max int) (contracts []wallet.FileContract, err error) {
-	err = c.get("/filecontracts?max="+strconv.Itoa(max), &contracts)
+// The contracts are ordered newest-to-oldest. Large requests are fetched in
+// pages.
+func (c *Client) FileContracts(max int, opts ...ResponseOptions) (contracts []ResponseFileContract, err error) {
+	if max >= 0 && max <= iterPageSize {
+		err = c.get(api.FileContracts+"?max="+strconv.Itoa(max)+fieldsQuery(opts), &contracts)
+		return
+	}
+	// the ID is needed to request the next page
+	opts = withField(opts, "id")
+	var before types.FileContractID
+	for {
+		page, next, err := c.FileContractsPage(before, iterPageSize, opts...)
+		if err != nil {
+			return nil, err
+		}
+		contracts = append(contracts, page...)
+		if max >= 0 && len(contracts) >= max {
+			return contracts[:max], nil
+		} else if next == (types.FileContractID{}) {
+			return contracts, nil
+		}
+		before = next
+	}
+}
+
+// FileContractsPage returns a page of at most limit file contracts, ordered
+// newest-to-oldest, starting after the contract with ID before; if before is
+// the zero ID, the page starts with the newest contract. It also returns the
+// cursor for the next page, which is the zero ID if there are no more
+// contracts.
+func (c *Client) FileContractsPage(before types.FileContractID, limit int, opts ...ResponseOptions) (contracts []ResponseFileContract, next types.FileContractID, err error) {
+	err = c.get(api.FileContracts+"?"+pageQuery("before", crypto.Hash(before), limit)+fieldsQuery(opts), &contracts)
+	if err == nil && len(contracts) > limit {
+		contracts = contracts[:limit]
+		next = contracts[limit-1].ID
+	}
 	return
 }
 
 // FileContractHistory returns the revision history of the specified file
-// contract, which must be a contract tracked by the wallet.
-func (c *Client) FileContractHistory(id types.FileContractID) (history []wallet.FileContract, err error) {
-	err = c.get("/filecontracts/"+id.String(), &history)
+// contract, which must be a contract tracked by the wallet. Long histories
+// are fetched in pages.
+func (c *Client) FileContractHistory(id types.FileContractID, opts ...ResponseOptions) (history []ResponseFileContract, err error) {
+	// the revision number is needed to request the next page
+	opts = withField(opts, "revisionNumber")
+	route := api.Path(api.FileContractsID, id.String()) + "?limit=" + strconv.Itoa(iterPageSize) + fieldsQuery(opts)
+	before := ""
+	for {
+		var page []ResponseFileContract
+		if err := c.get(route+before, &page); err != nil {
+			return nil, err
+		}
+		history = append(history, page...)
+		if len(page) < iterPageSize {
+			return history, nil
+		}
+		before = "&before=" + strconv.FormatUint(page[len(page)-1].RevisionNumber, 10)
+	}
+}
+
+// FilterFileContracts is like FileContractsPage, but returns only the
+// contracts selected by f.
+func (c *Client) FilterFileContracts(f ContractFilter, before types.FileContractID, limit int, opts ...ResponseOptions) (contracts []ResponseFileContract, next types.FileContractID, err error) {
+	q := make(url.Values)
+	addContractFilter(q, f)
+	route := api.FileContracts + "?" + pageQuery("before", crypto.Hash(before), limit)
+	if len(q) > 0 {
+		route += "&" + q.Encode()
+	}
+	err = c.get(route+fieldsQuery(opts), &contracts)
+	if err == nil && len(contracts) > limit {
+		contracts = contracts[:limit]
+		next = contracts[limit-1].ID
+	}
+	return
+}
+
+// FilterFileContractHistory returns a page of at most limit revisions of the
+// specified file contract that are selected by f, ordered newest-to-oldest,
+// starting with the newest revision whose revision number is less than
+// before; if before is 0, the page starts with the newest revision. It also
+// returns the cursor for the next page, which is 0 if there are no more
+// revisions.
+func (c *Client) FilterFileContractHistory(id types.FileContractID, f ContractFilter, before uint64, limit int, opts ...ResponseOptions) (history []ResponseFileContract, next uint64, err error) {
+	if limit <= 0 {
+		panic("page limit must be positive")
+	}
+	q := url.Values{"limit": {strconv.Itoa(limit + 1)}}
+	if before != 0 {
+		q.Set("before", strconv.FormatUint(before, 10))
+	}
+	addContractFilter(q, f)
+	err = c.get(api.Path(api.FileContractsID, id.String())+"?"+q.Encode()+fieldsQuery(opts), &history)
+	if err == nil && len(history) > limit {
+		history = history[:limit]
+		next = history[limit-1].RevisionNumber
+	}
+	return
+}
+
+// UpcomingFileContracts returns the file contracts whose proof windows are
+// open, or will open within the specified number of blocks.
+func (c *Client) UpcomingFileContracts(blocks types.BlockHeight) (contracts []ResponseFileContract, err error) {
+	err = c.get(api.FileContractsUpcoming+"?blocks="+strconv.FormatUint(uint64(blocks), 10), &contracts)
+	return
+}
+
+// HostAnnouncements returns the host announcements contained in transactions
+// funded by the wallet, ordered newest-to-oldest.
+func (c *Client) HostAnnouncements() (anns []ResponseHostAnnouncement, err error) {
+	err = c.get(api.HostAnnouncements, &anns)
+	return
+}
+
+// Inheritance returns the server's inheritance switch.
+func (c *Client) Inheritance() (inh ResponseInheritance, err error) {
+	err = c.get(api.Inheritance, &inh)
 	return
 }
 
+// SetInheritance configures the server to broadcast txnSet, a signed
+// transaction set paying beneficiary, if it does not receive a heartbeat
+// signed by key within period.
+func (c *Client) SetInheritance(beneficiary types.UnlockHash, txnSet []types.Transaction, key ed25519.PublicKey, period time.Duration) error {
+	return c.post(api.Inheritance, RequestInheritance{
+		Beneficiary:  beneficiary,
+		Transactions: txnSet,
+		HeartbeatKey: hex.EncodeToString(key),
+		Period:       period.String(),
+	}, nil)
+}
+
+// Heartbeat checks in with the server's inheritance switch, postponing its
+// deadline.
+func (c *Client) Heartbeat(key ed25519.PrivateKey) error {
+	now := time.Now()
+	return c.post(api.InheritanceHeartbeat, RequestHeartbeat{
+		Timestamp: now,
+		Signature: hex.EncodeToString(SignHeartbeat(key, now)),
+	}, nil)
+}
+
+// RemoveInheritance removes the server's inheritance switch.
+func (c *Client) RemoveInheritance(key ed25519.PrivateKey) error {
+	now := time.Now()
+	return c.req("DELETE", api.Inheritance, RequestHeartbeat{
+		Timestamp: now,
+		Signature: hex.EncodeToString(SignInheritanceRemoval(key, now)),
+	}, nil)
+}
+
 // LimboTransactions returns transactions that are in Limbo.
 func (c *Client) LimboTransactions() (txns []wallet.LimboTransaction, err error) {
-	err = c.get("/limbo", &txns)
+	err = c.get(api.Limbo, &txns)
+	return
+}
+
+// FilterLimbo returns the transactions in Limbo that are selected by f.
+func (c *Client) FilterLimbo(f LimboFilter) (txns []wallet.LimboTransaction, err error) {
+	q := make(url.Values)
+	for _, addr := range f.Addresses {
+		q.Add("addr", addr.String())
+	}
+	if !f.MinValue.IsZero() {
+		q.Set("minvalue", f.MinValue.String())
+	}
+	if f.MinAge != 0 {
+		q.Set("minage", f.MinAge.String())
+	}
+	err = c.get(api.Limbo+"?"+q.Encode(), &txns)
+	return
+}
+
+// LimboTransaction returns the transaction in Limbo with the specified ID.
+func (c *Client) LimboTransaction(txid types.TransactionID) (txn wallet.LimboTransaction, err error) {
+	err = c.get(api.Path(api.LimboID, txid.String()), &txn)
+	return
+}
+
+// IsLeader reports whether the server is the leader of its group, i.e. not a
+// standby. Servers that are not part of a group are always the leader.
+func (c *Client) IsLeader() (leader bool, err error) {
+	err = c.get(api.Leader, &leader)
+	return
+}
+
+// LimboSets returns the transactions in Limbo, grouped by the transaction set
+// they were broadcast in, ordered oldest-to-newest.
+func (c *Client) LimboSets() (sets []ResponseLimboSet, err error) {
+	err = c.get(api.LimboSets, &sets)
 	return
 }
 
@@ -127,7 +827,7 @@ func (c *Client) LimboTransactions() (txns []wallet.LimboTransaction, err error)
 // Manually adding transactions to Limbo is typically unnecessary. Calling Broadcast
 // will move all transactions in the set to Limbo automatically.
 func (c *Client) AddToLimbo(txn types.Transaction) (err error) {
-	return c.put("/limbo/"+txn.ID().String(), txn)
+	return c.put(api.Path(api.LimboID, txn.ID().String()), txn)
 }
 
 // RemoveFromLimbo removes a transaction from Limbo.
@@ -136,21 +836,34 @@ func (c *Client) AddToLimbo(txn types.Transaction) (err error) {
 // transaction appears in a valid block, it will be removed from Limbo
 // automatically.
 func (c *Client) RemoveFromLimbo(txid types.TransactionID) (err error) {
-	return c.delete("/limbo/" + txid.String())
+	return c.delete(api.Path(api.LimboID, txid.String()))
+}
+
+// DraftFeeBump returns an unsigned replacement for the specified transaction
+// in Limbo that pays a higher fee. The replacement spends the same inputs and
+// makes the same payments; the additional fee is taken from the change, or
+// from new inputs if the change is insufficient.
+func (c *Client) DraftFeeBump(txid types.TransactionID, rb RequestBump) (resp ResponseBump, err error) {
+	err = c.post(api.Path(api.LimboIDBump, txid.String()), rb, &resp)
+	return
+}
+
+// BroadcastReplacement broadcasts txn, a signed replacement for the specified
+// transaction in Limbo (see DraftFeeBump), and moves it into Limbo in place of
+// the original.
+func (c *Client) BroadcastReplacement(txid types.TransactionID, txn types.Transaction) (receipt ResponseBroadcast, err error) {
+	err = c.req("PUT", api.Path(api.LimboIDBump, txid.String()), txn, &receipt)
+	return
 }
 
 // Memo retrieves the memo for a transaction.
 func (c *Client) Memo(txid types.TransactionID) (memo []byte, err error) {
-	resp, err := http.Get(fmt.Sprintf("http://%v/memos/%v", c.addr, txid.String()))
+	r, err := c.roundTrip("GET", api.Path(api.MemosTxID, txid.String()), nil, "application/octet-stream")
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	data, _ := ioutil.ReadAll(resp.Body)
-	if resp.StatusCode != 200 {
-		return nil, errors.New(string(data))
-	}
-	return data, nil
+	defer r.Body.Close()
+	return ioutil.ReadAll(r.Body)
 }
 
 // SetMemo adds a memo for a transaction, overwriting the previous memo if it
@@ -158,34 +871,141 @@ func (c *Client) Memo(txid types.TransactionID) (memo []byte, err error) {
 //
 // Memos are not stored on the blockchain. They exist only in the local wallet.
 func (c *Client) SetMemo(txid types.TransactionID, memo []byte) (err error) {
-	req, err := http.NewRequest("PUT", fmt.Sprintf("http://%v/memos/%v", c.addr, txid.String()), bytes.NewReader(memo))
-	if err != nil {
-		panic(err)
-	}
-	r, err := http.DefaultClient.Do(req)
+	r, err := c.roundTrip("PUT", api.Path(api.MemosTxID, txid.String()), bytes.NewReader(memo), "application/octet-stream")
 	if err != nil {
 		return err
 	}
 	defer io.Copy(ioutil.Discard, r.Body)
-	defer r.Body.Close()
-	if r.StatusCode != 200 {
-		err, _ := ioutil.ReadAll(r.Body)
-		return errors.New(string(err))
-	}
-	return nil
+	return r.Body.Close()
+}
+
+// NetworkInfo returns the current mining difficulty, estimated network
+// hashrate, and average block times over recent windows.
+func (c *Client) NetworkInfo() (info ResponseNetwork, err error) {
+	err = c.get(api.Network, &info)
+	return
 }
 
 // SeedIndex returns the index that should be used to derive the next address.
 func (c *Client) SeedIndex() (index uint64, err error) {
-	err = c.get("/seedindex", &index)
+	err = c.get(api.SeedIndex, &index)
+	return
+}
+
+// ReserveSeedIndices atomically reserves count seed indices, returning the
+// reserved range [start, end). No other caller will be assigned an index in
+// the range, so addresses derived from it can be registered without racing
+// other clients.
+func (c *Client) ReserveSeedIndices(count int) (start, end uint64, err error) {
+	var resp ResponseSeedIndexReserve
+	err = c.post(api.SeedIndexReserve+"?count="+strconv.Itoa(count), nil, &resp)
+	return resp.Start, resp.End, err
+}
+
+// PreviewAddresses returns the next count addresses that would be derived,
+// starting at the current seed index, without adding them to the wallet. The
+// server must be configured with a KeySource.
+func (c *Client) PreviewAddresses(count int) (addrs []ResponseSeedIndexPreview, err error) {
+	err = c.get(api.SeedIndexPreview+"?count="+strconv.Itoa(count), &addrs)
+	return
+}
+
+// SiafundBalance returns the number of siafunds in the wallet's unspent
+// siafund outputs, along with the siacoin claims they would receive if spent
+// now. If the limbo flag is true, outputs spent by transactions in Limbo are
+// excluded.
+func (c *Client) SiafundBalance(limbo bool) (resp ResponseSiafunds, err error) {
+	err = c.get(api.Siafunds+"?limbo="+strconv.FormatBool(limbo), &resp)
+	return
+}
+
+// SiafundClaims returns every siafund output that is, or was, owned by the
+// wallet, along with its realized or unrealized claim.
+func (c *Client) SiafundClaims() (claims []ResponseSiafundClaim, err error) {
+	err = c.get(api.SiafundsClaims, &claims)
+	return
+}
+
+// SiafundOutputs returns the wallet's unspent siafund outputs, along with the
+// claim each would receive if spent now. If the limbo flag is true, outputs
+// spent by transactions in Limbo are excluded.
+func (c *Client) SiafundOutputs(limbo bool) (sfos []ResponseSiafundClaim, err error) {
+	err = c.get(api.SiafundsUTXOs+"?limbo="+strconv.FormatBool(limbo), &sfos)
+	return
+}
+
+// SignTransaction signs the inputs of txn whose parent IDs are in toSign with
+// the server's seed. If toSign is empty, every input controlled by the wallet
+// is signed. The server must be configured to sign transactions.
+func (c *Client) SignTransaction(txn *types.Transaction, toSign []crypto.Hash) error {
+	return c.post(api.Sign, RequestSign{Transaction: *txn, ToSign: toSign}, txn)
+}
+
+// ConfirmationStats returns statistics on how long the wallet's broadcasts
+// made since the specified time took to confirm, grouped by the interval in
+// which they were broadcast and by fee rate. A zero interval defaults to 24
+// hours, and a zero since defaults to 30 days ago.
+func (c *Client) ConfirmationStats(interval time.Duration, since time.Time) (stats ResponseConfirmationStats, err error) {
+	q := make(url.Values)
+	if interval != 0 {
+		q.Set("interval", interval.String())
+	}
+	if !since.IsZero() {
+		q.Set("since", since.Format(time.RFC3339))
+	}
+	err = c.get(api.StatsConfirmations+"?"+q.Encode(), &stats)
+	return
+}
+
+// SweepBundle returns a set of unsigned transactions that together send the
+// wallet's entire balance to dest, each small enough to be relayed. The fee
+// may be a fee tier (e.g. FeeTierPriority), a value in hastings per byte, or
+// empty to use the recommended fee.
+func (c *Client) SweepBundle(dest types.UnlockHash, fee string) (sb SweepBundle, err error) {
+	q := url.Values{
+		"dest": {dest.String()},
+		"fee":  {fee},
+	}
+	err = c.get(api.Sweep+"?"+q.Encode(), &sb)
 	return
 }
 
 // Transactions lists the IDs of transactions relevant to the wallet. If max <
 // 0, all such IDs are returned; otherwise, at most max IDs are returned. The
-// IDs are ordered newest-to-oldest.
+// IDs are ordered newest-to-oldest. Large requests are fetched in pages.
 func (c *Client) Transactions(max int) (txids []types.TransactionID, err error) {
-	err = c.get("/transactions?max="+strconv.Itoa(max), &txids)
+	return c.transactions(nil, max)
+}
+
+// transactions lists the IDs of transactions selected by the query q.
+func (c *Client) transactions(q url.Values, max int) (txids []types.TransactionID, err error) {
+	if max >= 0 && max <= iterPageSize {
+		q2 := url.Values{"max": {strconv.Itoa(max)}}
+		for k, v := range q {
+			q2[k] = v
+		}
+		err = c.get(api.Transactions+"?"+q2.Encode(), &txids)
+		return
+	}
+	ti := c.transactionsIter(q)
+	defer ti.Close()
+	for (max < 0 || len(txids) < max) && ti.Next() {
+		txids = append(txids, ti.ID())
+	}
+	return txids, ti.Err()
+}
+
+// TransactionsPage returns a page of at most limit IDs of transactions
+// relevant to the wallet, ordered newest-to-oldest, starting after the
+// transaction before; if before is the zero ID, the page starts with the
+// newest transaction. It also returns the cursor for the next page, which is
+// the zero ID if there are no more transactions.
+func (c *Client) TransactionsPage(before types.TransactionID, limit int) (txids []types.TransactionID, next types.TransactionID, err error) {
+	err = c.get(api.Transactions+"?"+pageQuery("before", crypto.Hash(before), limit), &txids)
+	if err == nil && len(txids) > limit {
+		txids = txids[:limit]
+		next = txids[limit-1]
+	}
 	return
 }
 
@@ -194,14 +1014,53 @@ func (c *Client) Transactions(max int) (txids []types.TransactionID, err error)
 // returned; otherwise, at most max IDs are returned. The IDs are ordered
 // newest-to-oldest.
 func (c *Client) TransactionsByAddress(addr types.UnlockHash, max int) (txids []types.TransactionID, err error) {
-	err = c.get("/transactions?max="+strconv.Itoa(max)+"&addr="+addr.String(), &txids)
-	return
+	return c.transactions(url.Values{"addr": {addr.String()}}, max)
+}
+
+// TransactionsByLabel lists the IDs of transactions that spend from or send to
+// an address carrying each of the specified labels. If max < 0, all such IDs
+// are returned; otherwise, at most max IDs are returned. The IDs are ordered
+// newest-to-oldest.
+func (c *Client) TransactionsByLabel(max int, labels ...string) (txids []types.TransactionID, err error) {
+	return c.transactions(url.Values{"label": labels}, max)
+}
+
+// InternalTransactions lists the IDs of internal transactions, i.e.
+// transactions whose inputs and outputs all belong to the wallet, such as
+// consolidations and splits. If internal is false, the IDs of all other
+// transactions are returned instead. If max < 0, all such IDs are returned;
+// otherwise, at most max IDs are returned. The IDs are ordered
+// newest-to-oldest.
+func (c *Client) InternalTransactions(internal bool, max int) (txids []types.TransactionID, err error) {
+	return c.transactions(url.Values{"internal": {strconv.FormatBool(internal)}}, max)
 }
 
 // Transaction returns the transaction with the specified ID, as well as inflow,
 // outflow, and fee information. The transaction must be relevant to the wallet.
-func (c *Client) Transaction(txid types.TransactionID) (txn ResponseTransactionsID, err error) {
-	err = c.get("/transactions/"+txid.String(), &txn)
+func (c *Client) Transaction(txid types.TransactionID, opts ...ResponseOptions) (txn ResponseTransactionsID, err error) {
+	err = c.get(api.Path(api.TransactionsTxID, txid.String())+"?"+fieldsQuery(opts), &txn)
+	return
+}
+
+// TransactionProof returns a proof that the specified confirmed transaction is
+// included in its block. The transaction must be relevant to the wallet.
+func (c *Client) TransactionProof(txid types.TransactionID) (proof InclusionProof, err error) {
+	err = c.get(api.Path(api.TransactionsTxIDProof, txid.String()), &proof)
+	return
+}
+
+// RawTransaction returns the transaction with the specified ID. If
+// anyRelevance is false, the transaction must be relevant to the wallet;
+// otherwise, the transaction pool and recent blocks are also searched.
+func (c *Client) RawTransaction(txid types.TransactionID, anyRelevance bool) (txn ResponseTransactionsIDRaw, err error) {
+	err = c.get(api.Path(api.TransactionsTxIDRaw, txid.String())+"?anyrelevance="+strconv.FormatBool(anyRelevance), &txn)
+	return
+}
+
+// Annotation returns the annotation that an external service attached to the
+// specified transaction.
+func (c *Client) Annotation(txid types.TransactionID) (annotation json.RawMessage, err error) {
+	err = c.get(api.Path(api.TransactionsTxIDAnnotation, txid.String()), &annotation)
 	return
 }
 
@@ -209,17 +1068,102 @@ func (c *Client) Transaction(txid types.TransactionID) (txn ResponseTransactions
 // transactions will need to be included in the transaction set passed to
 // Broadcast.
 func (c *Client) UnconfirmedParents(txn types.Transaction) (parents []wallet.LimboTransaction, err error) {
-	err = c.post("/unconfirmedparents", txn, &parents)
+	err = c.post(api.UnconfirmedParents, txn, &parents)
+	return
+}
+
+// UnconfirmedAncestors returns every transaction in Limbo that txnSet depends
+// on, directly or indirectly, ordered such that each transaction follows its
+// parents. Transactions in txnSet are excluded. Prepending the result to
+// txnSet yields a set that can be passed to Broadcast.
+func (c *Client) UnconfirmedAncestors(txnSet []types.Transaction) (ancestors []wallet.LimboTransaction, err error) {
+	err = c.post(api.UnconfirmedParents, txnSet, &ancestors)
+	return
+}
+
+// Usage returns the server's resource usage and quota.
+func (c *Client) Usage() (usage ResponseUsage, err error) {
+	err = c.get(api.Usage, &usage)
 	return
 }
 
 // UnspentOutputs returns the outputs that the wallet can spend. If the limbo
 // flag is true, the outputs will reflect any transactions currently in Limbo.
-func (c *Client) UnspentOutputs(limbo bool) (utxos []wallet.UnspentOutput, err error) {
-	err = c.get("/utxos?limbo="+strconv.FormatBool(limbo), &utxos)
+// The outputs are fetched in pages.
+func (c *Client) UnspentOutputs(limbo bool, opts ...ResponseOptions) (utxos []ResponseUnspentOutput, err error) {
+	return c.FilterUnspentOutputs(limbo, OutputFilter{}, opts...)
+}
+
+// FilterUnspentOutputs returns the outputs that the wallet can spend and that
+// are selected by f. If the limbo flag is true, the outputs will reflect any
+// transactions currently in Limbo. The outputs are fetched in pages.
+func (c *Client) FilterUnspentOutputs(limbo bool, f OutputFilter, opts ...ResponseOptions) (utxos []ResponseUnspentOutput, err error) {
+	q := url.Values{"limbo": {strconv.FormatBool(limbo)}}
+	addOutputFilter(q, f)
+	ui := c.unspentOutputsIter(q, opts)
+	defer ui.Close()
+	for ui.Next() {
+		utxos = append(utxos, ui.Output())
+	}
+	return utxos, ui.Err()
+}
+
+// OutputMetadata returns the metadata attached to the specified output.
+func (c *Client) OutputMetadata(id types.SiacoinOutputID) (meta map[string]string, err error) {
+	err = c.get(api.Path(api.UTXOsIDMetadata, id.String()), &meta)
+	return
+}
+
+// SetOutputMetadata replaces the metadata attached to the specified output. If
+// meta is empty, the output's metadata is removed.
+func (c *Client) SetOutputMetadata(id types.SiacoinOutputID, meta map[string]string) error {
+	return c.put(api.Path(api.UTXOsIDMetadata, id.String()), meta)
+}
+
+// UnspentOutputsPage returns a page of at most limit outputs that the wallet
+// can spend, ordered by ID, starting after the output with ID after; if after
+// is the zero ID, the page starts with the first output. It also returns the
+// cursor for the next page, which is the zero ID if there are no more
+// outputs.
+func (c *Client) UnspentOutputsPage(limbo bool, after types.SiacoinOutputID, limit int, opts ...ResponseOptions) (utxos []ResponseUnspentOutput, next types.SiacoinOutputID, err error) {
+	err = c.get(api.UTXOs+"?limbo="+strconv.FormatBool(limbo)+"&"+pageQuery("after", crypto.Hash(after), limit)+fieldsQuery(opts), &utxos)
+	if err == nil && len(utxos) > limit {
+		utxos = utxos[:limit]
+		next = utxos[limit-1].ID
+	}
+	return
+}
+
+// OutputProof returns a proof that the specified output, which must have been
+// created within the wallet's history, is included in the blockchain.
+func (c *Client) OutputProof(id types.SiacoinOutputID) (proof OutputProof, err error) {
+	err = c.get(api.Path(api.UTXOsIDProof, id.String()), &proof)
+	return
+}
+
+// TraceOutput returns the ancestry of the specified output within the
+// wallet's history, tracing back at most depth generations.
+func (c *Client) TraceOutput(id types.SiacoinOutputID, depth int) (trace []OutputTrace, err error) {
+	err = c.get(api.Path(api.UTXOsIDTrace, id.String())+"?depth="+strconv.Itoa(depth), &trace)
 	return
 }
 
+// LockUTXOs locks the specified outputs under lockID for duration, e.g.
+// "10m", or for DefaultLockDuration if duration is empty. Locked outputs are
+// not used to fund transactions built by the server for other locks. If any of
+// the outputs is held by another lock, none are locked.
+func (c *Client) LockUTXOs(lockID string, ids []types.SiacoinOutputID, duration string) (expires time.Time, err error) {
+	var resp ResponseLockUTXOs
+	err = c.post(api.UTXOsLock, RequestLockUTXOs{LockID: lockID, IDs: ids, Duration: duration}, &resp)
+	return resp.Expires, err
+}
+
+// ReleaseUTXOs releases the specified outputs held by lockID. If ids is empty,
+// every output held by lockID is released.
+func (c *Client) ReleaseUTXOs(lockID string, ids []types.SiacoinOutputID) error {
+	return c.post(api.UTXOsRelease, RequestReleaseUTXOs{LockID: lockID, IDs: ids}, nil)
+}
+
 // AddAddress adds a set of address metadata to the wallet. Future
 // transactions and outputs relevant to this address will be considered relevant
 // to the wallet.
@@ -227,7 +1171,51 @@ func (c *Client) UnspentOutputs(limbo bool) (utxos []wallet.UnspentOutput, err e
 // Importing an address does NOT import transactions and outputs relevant to
 // that address that are already in the blockchain.
 func (c *Client) AddAddress(info wallet.SeedAddressInfo) error {
-	return c.post("/addresses", info, new(types.UnlockHash))
+	return c.post(api.Addresses, info, new(types.UnlockHash))
+}
+
+// AddPublicKeys imports consecutive public keys derived from the wallet's
+// seed, starting at the specified index. The server can then derive and watch
+// addresses for those indices without holding the seed.
+func (c *Client) AddPublicKeys(start uint64, pks []types.SiaPublicKey) error {
+	rpk := RequestPublicKeys{
+		StartIndex: start,
+		PublicKeys: make([]string, len(pks)),
+	}
+	for i, pk := range pks {
+		rpk.PublicKeys[i] = pk.String()
+	}
+	return c.post(api.PubKeys, rpk, nil)
+}
+
+// NextAddress derives an address from the next seed index using the server's
+// public keys, and adds it to the wallet.
+func (c *Client) NextAddress() (info ResponseSeedIndexPreview, err error) {
+	err = c.post(api.AddressesNext, nil, &info)
+	return
+}
+
+// AddDeposit adds a deposit address to the wallet on behalf of the specified
+// reference. Future outputs sent to the address will be attributed to the
+// reference. The address must be derived from the current seed index or from
+// an index reserved with ReserveSeedIndices; if another address claims the
+// current index first, AddDeposit returns an error and the caller should retry
+// with the new index. If the server has the seed's public keys, the unlock
+// conditions may be left empty, and the server derives them from the index.
+func (c *Client) AddDeposit(rd RequestDeposit) (addr types.UnlockHash, err error) {
+	err = c.post(api.Deposits, rd, &addr)
+	return
+}
+
+// AddPushDevice registers a mobile device to receive push notifications for
+// the specified event types (or all events, if d.Events is empty).
+func (c *Client) AddPushDevice(d PushDevice) error {
+	return c.post(api.PushDevices, d, nil)
+}
+
+// RemovePushDevice unregisters a mobile device.
+func (c *Client) RemovePushDevice(token string) error {
+	return c.delete(api.Path(api.PushDevicesToken, token))
 }
 
 // RemoveAddress removes an address from the wallet. Future transactions and
@@ -237,15 +1225,169 @@ func (c *Client) AddAddress(info wallet.SeedAddressInfo) error {
 // Removing an address does NOT remove transactions and outputs relevant to that
 // address that are already recorded in the wallet.
 func (c *Client) RemoveAddress(addr types.UnlockHash) error {
-	return c.delete("/addresses/" + addr.String())
+	return c.delete(api.Path(api.AddressesAddr, addr.String()))
+}
+
+// Vault returns the server's vault policy and the withdrawals it has
+// queued.
+func (c *Client) Vault() (v ResponseVault, err error) {
+	err = c.get(api.Vault, &v)
+	return
+}
+
+// CancelWithdrawal cancels a withdrawal queued by the vault policy. key must
+// be the vault's recovery key.
+func (c *Client) CancelWithdrawal(id crypto.Hash, key ed25519.PrivateKey) error {
+	now := time.Now()
+	return c.req("DELETE", api.Path(api.VaultWithdrawalsID, id.String()), RequestCancelWithdrawal{
+		Timestamp: now,
+		Signature: hex.EncodeToString(SignWithdrawalCancellation(key, id, now)),
+	}, nil)
+}
+
+// SplitRules returns the stored revenue split rules.
+func (c *Client) SplitRules() (rs []SplitRule, err error) {
+	err = c.get(api.Splits, &rs)
+	return
+}
+
+// SetSplitRule stores r, replacing any existing rule with the same name.
+func (c *Client) SetSplitRule(r SplitRule) error {
+	return c.put(api.Path(api.SplitsName, r.Name), r)
+}
+
+// RemoveSplitRule deletes the split rule with the specified name.
+func (c *Client) RemoveSplitRule(name string) error {
+	return c.delete(api.Path(api.SplitsName, name))
+}
+
+// SplitDraft returns an unsigned transaction dividing the value held by the
+// sources of the specified split rule among its destinations. The fee may be
+// a fee tier or an explicit fee in hastings per byte; if empty, the
+// recommended fee is used.
+func (c *Client) SplitDraft(name, fee string) (draft ResponseSplitDraft, err error) {
+	err = c.get(api.Path(api.SplitsNameDraft, name)+"?fee="+url.QueryEscape(fee), &draft)
+	return
+}
+
+// Templates returns the stored transaction templates.
+func (c *Client) Templates() (tts []TransactionTemplate, err error) {
+	err = c.get(api.Templates, &tts)
+	return
+}
+
+// Template returns the transaction template with the specified name.
+func (c *Client) Template(name string) (tt TransactionTemplate, err error) {
+	err = c.get(api.Path(api.TemplatesName, name), &tt)
+	return
+}
+
+// SetTemplate stores tt, replacing any existing template with the same name.
+func (c *Client) SetTemplate(tt TransactionTemplate) error {
+	return c.put(api.Path(api.TemplatesName, tt.Name), tt)
+}
+
+// RemoveTemplate deletes the transaction template with the specified name.
+func (c *Client) RemoveTemplate(name string) error {
+	return c.delete(api.Path(api.TemplatesName, name))
+}
+
+// ConstructTransaction returns an unsigned transaction paying the requested
+// outputs, funded by the wallet's unspent outputs, along with any parents in
+// Limbo. Once signed, the transaction should be broadcast in a set with its
+// parents.
+func (c *Client) ConstructTransaction(rc RequestConstruct) (resp ResponseConstruct, err error) {
+	err = c.post(api.Construct, rc, &resp)
+	return
+}
+
+// ConstructBundle is like ConstructTransaction, but returns the transaction as
+// a SigningBundle, which can be signed offline with SignBundle.
+func (c *Client) ConstructBundle(rc RequestConstruct) (b SigningBundle, err error) {
+	err = c.post(api.Construct+"?format=bundle", rc, &b)
+	return
+}
+
+// BuildTemplate returns an unsigned transaction instantiating the specified
+// template, funded by the wallet's unspent outputs.
+func (c *Client) BuildTemplate(name string, rtb RequestTemplateBuild) (resp ResponseTemplateBuild, err error) {
+	err = c.post(api.Path(api.TemplatesNameBuild, name), rtb, &resp)
+	return
+}
+
+// A ClientOption modifies the default behavior of a Client.
+type ClientOption func(*Client)
+
+// WithHTTPClient sets the http.Client used to make requests. The default is
+// http.DefaultClient.
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *Client) {
+		if hc == nil {
+			hc = http.DefaultClient
+		}
+		c.hc = hc
+	}
+}
+
+// WithTimeout sets the time limit for each request, including reading the
+// response body. A timeout of zero means no timeout.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(c *Client) {
+		hc := *c.hc
+		hc.Timeout = d
+		c.hc = &hc
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used to connect to the server, e.g.
+// to trust a self-signed certificate. It panics if the Client's transport is
+// not an *http.Transport.
+func WithTLSConfig(cfg *tls.Config) ClientOption {
+	return func(c *Client) {
+		rt := c.hc.Transport
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+		tr, ok := rt.(*http.Transport)
+		if !ok {
+			panic("WithTLSConfig requires an *http.Transport")
+		}
+		tr = tr.Clone()
+		tr.TLSClientConfig = cfg
+		hc := *c.hc
+		hc.Transport = tr
+		c.hc = &hc
+	}
+}
+
+// WithStats enables request statistics; see Client.EnableStats.
+func WithStats() ClientOption {
+	return func(c *Client) {
+		c.EnableStats()
+	}
 }
 
 // NewClient returns a client that communicates with a walrus server listening
-// on the specified address.
-func NewClient(addr string) *Client {
-	// use https by default
-	if !strings.HasPrefix(addr, "https://") && !strings.HasPrefix(addr, "http://") {
+// on the specified address. The address may also be a Unix domain socket path
+// of the form unix:///path/to/walrus.sock. Options are applied in order; they
+// never modify an http.Client passed to WithHTTPClient.
+func NewClient(addr string, opts ...ClientOption) *Client {
+	hc := http.DefaultClient
+	if strings.HasPrefix(addr, unixPrefix) {
+		// the host is ignored; every request is sent over the socket
+		hc = &http.Client{Transport: unixTransport(strings.TrimPrefix(addr, unixPrefix))}
+		addr = "http://unix"
+	} else if !strings.HasPrefix(addr, "https://") && !strings.HasPrefix(addr, "http://") {
+		// use https by default
 		addr = "https://" + addr
 	}
-	return &Client{addr}
+	c := &Client{
+		addr:  addr,
+		hc:    hc,
+		retry: DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
@@ -0,0 +1,172 @@
+package walrus
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencySamples is the number of recent latencies kept per endpoint for
+// computing percentiles.
+const latencySamples = 1024
+
+// EndpointStats summarizes the requests made to an endpoint.
+type EndpointStats struct {
+	Requests uint64 `json:"requests"`
+	// Requests that failed, either in transit or with a non-200 status.
+	Errors uint64 `json:"errors"`
+	// Latency percentiles over the most recent requests.
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+}
+
+// ClientStats summarizes the requests made by a Client.
+type ClientStats struct {
+	Global EndpointStats `json:"global"`
+	// Keyed by method and route, e.g. "GET /transactions/:id". Path segments
+	// containing digits are assumed to be IDs and replaced with ":id".
+	Endpoints map[string]EndpointStats `json:"endpoints"`
+}
+
+// WritePrometheus writes cs in the Prometheus text exposition format.
+func (cs ClientStats) WritePrometheus(w io.Writer) error {
+	endpoints := make([]string, 0, len(cs.Endpoints))
+	for e := range cs.Endpoints {
+		endpoints = append(endpoints, e)
+	}
+	sort.Strings(endpoints)
+
+	var b strings.Builder
+	b.WriteString("# TYPE walrus_client_requests_total counter\n")
+	for _, e := range endpoints {
+		fmt.Fprintf(&b, "walrus_client_requests_total{endpoint=%q} %d\n", e, cs.Endpoints[e].Requests)
+	}
+	b.WriteString("# TYPE walrus_client_errors_total counter\n")
+	for _, e := range endpoints {
+		fmt.Fprintf(&b, "walrus_client_errors_total{endpoint=%q} %d\n", e, cs.Endpoints[e].Errors)
+	}
+	b.WriteString("# TYPE walrus_client_request_duration_seconds summary\n")
+	for _, e := range endpoints {
+		es := cs.Endpoints[e]
+		for _, q := range []struct {
+			quantile string
+			d        time.Duration
+		}{{"0.5", es.P50}, {"0.9", es.P90}, {"0.99", es.P99}} {
+			fmt.Fprintf(&b, "walrus_client_request_duration_seconds{endpoint=%q,quantile=%q} %s\n",
+				e, q.quantile, strconv.FormatFloat(q.d.Seconds(), 'f', -1, 64))
+		}
+		fmt.Fprintf(&b, "walrus_client_request_duration_seconds_count{endpoint=%q} %d\n", e, es.Requests)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// endpointStats accumulates the requests made to an endpoint.
+type endpointStats struct {
+	requests  uint64
+	errors    uint64
+	latencies []time.Duration // ring buffer
+	next      int
+}
+
+func (es *endpointStats) add(d time.Duration, failed bool) {
+	es.requests++
+	if failed {
+		es.errors++
+	}
+	if len(es.latencies) < latencySamples {
+		es.latencies = append(es.latencies, d)
+	} else {
+		es.latencies[es.next] = d
+		es.next = (es.next + 1) % latencySamples
+	}
+}
+
+func (es *endpointStats) summary() EndpointStats {
+	sorted := append([]time.Duration(nil), es.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p float64) time.Duration {
+		if len(sorted) == 0 {
+			return 0
+		}
+		return sorted[int(p*float64(len(sorted)-1))]
+	}
+	return EndpointStats{
+		Requests: es.requests,
+		Errors:   es.errors,
+		P50:      percentile(0.5),
+		P90:      percentile(0.9),
+		P99:      percentile(0.99),
+	}
+}
+
+// statsCollector records the requests made by a Client.
+type statsCollector struct {
+	mu        sync.Mutex
+	global    endpointStats
+	endpoints map[string]*endpointStats
+}
+
+// statsEndpoint returns the endpoint name for a request, replacing IDs in the
+// route with ":id" so that the number of endpoints stays small.
+func statsEndpoint(method, route string) string {
+	if i := strings.IndexByte(route, '?'); i >= 0 {
+		route = route[:i]
+	}
+	segments := strings.Split(route, "/")
+	for i, seg := range segments {
+		if strings.ContainsAny(seg, "0123456789") {
+			segments[i] = ":id"
+		}
+	}
+	return method + " " + strings.Join(segments, "/")
+}
+
+func (sc *statsCollector) record(method, route string, d time.Duration, failed bool) {
+	endpoint := statsEndpoint(method, route)
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	es, ok := sc.endpoints[endpoint]
+	if !ok {
+		es = new(endpointStats)
+		sc.endpoints[endpoint] = es
+	}
+	es.add(d, failed)
+	sc.global.add(d, failed)
+}
+
+func (sc *statsCollector) stats() ClientStats {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	cs := ClientStats{
+		Global:    sc.global.summary(),
+		Endpoints: make(map[string]EndpointStats, len(sc.endpoints)),
+	}
+	for e, es := range sc.endpoints {
+		cs.Endpoints[e] = es.summary()
+	}
+	return cs
+}
+
+// EnableStats configures c to record the number of requests, errors, and
+// latencies of each endpoint, retrievable via Stats. Copies of c made by
+// WithContext share the same stats.
+func (c *Client) EnableStats() {
+	if c.stats == nil {
+		c.stats = &statsCollector{endpoints: make(map[string]*endpointStats)}
+	}
+}
+
+// Stats returns the request statistics recorded since EnableStats was called.
+// If stats are not enabled, it returns the zero value.
+func (c *Client) Stats() ClientStats {
+	if c.stats == nil {
+		return ClientStats{}
+	}
+	return c.stats.stats()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"lukechampine.com/walrus"
+)
+
+// alertConfig describes when walrus raises alerts, and the channels it
+// delivers them to.
+type alertConfig struct {
+	LargeOutflow string `json:"largeOutflow"`
+	LowBalance   string `json:"lowBalance"`
+	SyncStalled  string `json:"syncStalled"`
+	SMTP         *struct {
+		Addr     string   `json:"addr"`
+		Username string   `json:"username"`
+		Password string   `json:"password"`
+		From     string   `json:"from"`
+		To       []string `json:"to"`
+		Alerts   []string `json:"alerts"`
+	} `json:"smtp"`
+	Slack *struct {
+		WebhookURL string   `json:"webhookURL"`
+		Alerts     []string `json:"alerts"`
+	} `json:"slack"`
+}
+
+// checkAlertTypes returns an error if any of types is not a known alert type.
+func checkAlertTypes(types []string) error {
+	for _, typ := range types {
+		switch typ {
+		case walrus.AlertLargeOutflow, walrus.AlertLowBalance, walrus.AlertSyncStalled:
+		default:
+			return fmt.Errorf("unknown alert type %q", typ)
+		}
+	}
+	return nil
+}
+
+// loadAlerts loads an alertConfig from filename and returns the corresponding
+// policy and channels.
+func loadAlerts(filename string) (walrus.AlertPolicy, []walrus.AlertChannel, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return walrus.AlertPolicy{}, nil, err
+	}
+	defer f.Close()
+	var ac alertConfig
+	if err := json.NewDecoder(f).Decode(&ac); err != nil {
+		return walrus.AlertPolicy{}, nil, err
+	}
+
+	var p walrus.AlertPolicy
+	var ok bool
+	if ac.LargeOutflow != "" {
+		if p.LargeOutflow, ok = parseSiacoins(ac.LargeOutflow); !ok {
+			return walrus.AlertPolicy{}, nil, errors.New("invalid largeOutflow: must be a non-negative number of siacoins")
+		}
+	}
+	if ac.LowBalance != "" {
+		if p.LowBalance, ok = parseSiacoins(ac.LowBalance); !ok {
+			return walrus.AlertPolicy{}, nil, errors.New("invalid lowBalance: must be a non-negative number of siacoins")
+		}
+	}
+	if ac.SyncStalled != "" {
+		if p.SyncStalled, err = time.ParseDuration(ac.SyncStalled); err != nil || p.SyncStalled < 0 {
+			return walrus.AlertPolicy{}, nil, errors.New("invalid syncStalled: must be a non-negative duration")
+		}
+	}
+
+	var channels []walrus.AlertChannel
+	if ac.SMTP != nil {
+		if err := checkAlertTypes(ac.SMTP.Alerts); err != nil {
+			return walrus.AlertPolicy{}, nil, err
+		} else if ac.SMTP.Addr == "" || ac.SMTP.From == "" || len(ac.SMTP.To) == 0 {
+			return walrus.AlertPolicy{}, nil, errors.New("smtp requires addr, from, and to")
+		}
+		channels = append(channels, walrus.AlertChannel{
+			Sender: &walrus.SMTPAlertSender{
+				Addr:     ac.SMTP.Addr,
+				Username: ac.SMTP.Username,
+				Password: ac.SMTP.Password,
+				From:     ac.SMTP.From,
+				To:       ac.SMTP.To,
+			},
+			Types: ac.SMTP.Alerts,
+		})
+	}
+	if ac.Slack != nil {
+		if err := checkAlertTypes(ac.Slack.Alerts); err != nil {
+			return walrus.AlertPolicy{}, nil, err
+		} else if ac.Slack.WebhookURL == "" {
+			return walrus.AlertPolicy{}, nil, errors.New("slack requires webhookURL")
+		}
+		channels = append(channels, walrus.AlertChannel{
+			Sender: &walrus.SlackAlertSender{WebhookURL: ac.Slack.WebhookURL},
+			Types:  ac.Slack.Alerts,
+		})
+	}
+	return p, channels, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"lukechampine.com/walrus"
+)
+
+// loadCredentials loads the credentials that API clients must present from
+// filename.
+func loadCredentials(filename string) (walrus.Credentials, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return walrus.Credentials{}, err
+	}
+	defer f.Close()
+	var creds walrus.Credentials
+	if err := json.NewDecoder(f).Decode(&creds); err != nil {
+		return walrus.Credentials{}, err
+	} else if len(creds.APIKeys) == 0 && creds.Username == "" {
+		return walrus.Credentials{}, errors.New("no API keys or username specified")
+	}
+	for _, key := range creds.APIKeys {
+		if key == "" {
+			return walrus.Credentials{}, errors.New("API keys must not be empty")
+		}
+	}
+	return creds, nil
+}
+
+// loadSigningPolicy loads the policy that transactions signed via /sign must
+// satisfy from filename.
+func loadSigningPolicy(filename string) (walrus.SigningPolicy, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return walrus.SigningPolicy{}, err
+	}
+	defer f.Close()
+	var p walrus.SigningPolicy
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return walrus.SigningPolicy{}, err
+	}
+	return p, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"lukechampine.com/walrus"
+)
+
+// signBundle reads a signing bundle from filename, signs it with the wallet's
+// seed, and prints the signed bundle as JSON. A summary of the transaction is
+// logged first, so that the operator can check it before broadcasting.
+func signBundle(filename string) error {
+	js, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var b walrus.SigningBundle
+	if err := json.Unmarshal(js, &b); err != nil {
+		return fmt.Errorf("couldn't parse bundle: %w", err)
+	} else if err := b.Validate(); err != nil {
+		return fmt.Errorf("invalid bundle: %w", err)
+	}
+	for _, sco := range b.Transaction.SiacoinOutputs {
+		log.Printf("Output: %v to %v", sco.Value.HumanString(), sco.UnlockHash)
+	}
+	log.Printf("Fee:    %v", b.Fee().HumanString())
+
+	seed, err := readSeed()
+	if err != nil {
+		return err
+	} else if err := walrus.SignBundle(&b, seed); err != nil {
+		return err
+	}
+	js, err = json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(append(js, '\n'))
+	log.Printf("Signed %v inputs", len(b.Inputs))
+	return nil
+}
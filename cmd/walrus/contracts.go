@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/walrus"
+)
+
+// contractsOptions are the flags of the contracts command.
+type contractsOptions struct {
+	API     string
+	APIKey  string
+	Host    string
+	Payout  string
+	Before  string
+	Limit   int
+	History string // a contract ID, if listing revisions
+}
+
+// parseFilter parses the -host and -payout flags.
+func (opts contractsOptions) parseFilter() (f walrus.ContractFilter, err error) {
+	if opts.Host != "" {
+		if f.HostKey, err = walrus.ParsePublicKey(opts.Host); err != nil {
+			return f, err
+		}
+	}
+	if opts.Payout != "" {
+		if err := f.PayoutAddress.LoadString(opts.Payout); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// listContracts prints a page of the file contracts (or, if opts.History is
+// set, a page of the revisions of a contract) tracked by the walrus server at
+// opts.API, followed by the cursor for the next page, if any.
+func listContracts(opts contractsOptions) error {
+	var copts []walrus.ClientOption
+	if opts.APIKey != "" {
+		copts = append(copts, walrus.WithAPIKey(opts.APIKey))
+	}
+	c := walrus.NewClient(opts.API, copts...)
+	f, err := opts.parseFilter()
+	if err != nil {
+		return err
+	}
+
+	var contracts []walrus.ResponseFileContract
+	var next string
+	if opts.History != "" {
+		var id types.FileContractID
+		if err := id.LoadString(opts.History); err != nil {
+			return err
+		}
+		var before uint64
+		if opts.Before != "" {
+			if before, err = strconv.ParseUint(opts.Before, 10, 64); err != nil {
+				return err
+			}
+		}
+		var n uint64
+		contracts, n, err = c.FilterFileContractHistory(id, f, before, opts.Limit)
+		if n != 0 {
+			next = strconv.FormatUint(n, 10)
+		}
+	} else {
+		var before types.FileContractID
+		if opts.Before != "" {
+			if err := before.LoadString(opts.Before); err != nil {
+				return err
+			}
+		}
+		var n types.FileContractID
+		contracts, n, err = c.FilterFileContracts(f, before, opts.Limit)
+		if n != (types.FileContractID{}) {
+			next = n.String()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	js, err := json.MarshalIndent(contracts, "", "\t")
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(append(js, '\n'))
+	if next != "" {
+		log.Printf("More results follow; continue with -before=%v", next)
+	}
+	return nil
+}
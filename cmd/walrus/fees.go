@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/walrus"
+)
+
+// feeOptions are the -fee-* flags.
+type feeOptions struct {
+	// A comma-separated list of sources: tpool, explorer, and static.
+	Sources  string
+	Explorer string
+	// A fee, or a "min,max" pair of fees, in hastings per byte.
+	Static  string
+	Floor   string
+	Ceiling string
+}
+
+// parseHastings parses a non-negative integer number of hastings.
+func parseHastings(s string) (types.Currency, error) {
+	i, ok := new(big.Int).SetString(strings.TrimSpace(s), 10)
+	if !ok || i.Sign() < 0 {
+		return types.Currency{}, fmt.Errorf("%q is not a non-negative number of hastings", s)
+	}
+	return types.NewCurrency(i), nil
+}
+
+// parseFeeOptions parses the -fee-* flags, returning a function that builds
+// the corresponding FeeEstimator once the transaction pool is available.
+func parseFeeOptions(opts feeOptions) (func(walrus.TransactionPool) walrus.FeeEstimator, error) {
+	var fe walrus.BlendedFeeEstimator
+	var err error
+	if opts.Floor != "" {
+		if fe.Floor, err = parseHastings(opts.Floor); err != nil {
+			return nil, fmt.Errorf("invalid -fee-floor: %v", err)
+		}
+	}
+	if opts.Ceiling != "" {
+		if fe.Ceiling, err = parseHastings(opts.Ceiling); err != nil {
+			return nil, fmt.Errorf("invalid -fee-ceiling: %v", err)
+		} else if fe.Ceiling.Cmp(fe.Floor) < 0 {
+			return nil, errors.New("-fee-ceiling must not be less than -fee-floor")
+		}
+	}
+
+	useTpool := false
+	for _, src := range strings.Split(opts.Sources, ",") {
+		switch strings.TrimSpace(src) {
+		case "tpool":
+			useTpool = true
+		case "explorer":
+			if opts.Explorer == "" {
+				return nil, errors.New("the explorer fee source requires -fee-explorer")
+			}
+			fe.Sources = append(fe.Sources, walrus.NewExplorerFeeEstimator(opts.Explorer))
+		case "static":
+			fees := strings.Split(opts.Static, ",")
+			if opts.Static == "" || len(fees) > 2 {
+				return nil, errors.New("the static fee source requires -fee-static=<fee> or -fee-static=<min>,<max>")
+			}
+			var sfe walrus.StaticFeeEstimator
+			if sfe.Min, err = parseHastings(fees[0]); err != nil {
+				return nil, fmt.Errorf("invalid -fee-static: %v", err)
+			}
+			sfe.Max = sfe.Min
+			if len(fees) == 2 {
+				if sfe.Max, err = parseHastings(fees[1]); err != nil {
+					return nil, fmt.Errorf("invalid -fee-static: %v", err)
+				}
+			}
+			fe.Sources = append(fe.Sources, sfe)
+		default:
+			return nil, fmt.Errorf("unrecognized fee source %q", src)
+		}
+	}
+	return func(tp walrus.TransactionPool) walrus.FeeEstimator {
+		if useTpool {
+			fe.Sources = append([]walrus.FeeEstimator{walrus.TpoolFeeEstimator(tp)}, fe.Sources...)
+		}
+		return fe
+	}, nil
+}
@@ -1,18 +1,26 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 
 	"gitlab.com/NebulousLabs/Sia/build"
 	"gitlab.com/NebulousLabs/Sia/modules/consensus"
 	"gitlab.com/NebulousLabs/Sia/modules/gateway"
 	"gitlab.com/NebulousLabs/Sia/modules/transactionpool"
+	"gitlab.com/NebulousLabs/Sia/types"
 	"lukechampine.com/flagg"
 	"lukechampine.com/us/wallet"
 	"lukechampine.com/walrus"
+	"lukechampine.com/walrus/vectors"
 )
 
 var (
@@ -26,6 +34,186 @@ var (
     walrus [flags]
 
 Initializes the wallet and begins serving the walrus API.
+
+The -network flag selects the Sia network to connect to. Network constants
+(such as the genesis block) are chosen when walrus is compiled, so the flag
+must match the build: "mainnet" requires a standard build, while "custom"
+requires a dev build (see 'make dev'). Custom networks do not bootstrap to
+mainnet peers.
+
+A custom network may be further configured with -network-config, which names
+a JSON file of the form:
+
+    {
+      "genesisTimestamp": 1528293910,
+      "genesisSiafunds": [
+        { "value": "2000", "unlockHash": "<addr>" }
+      ],
+      "blockFrequency": 12,
+      "bootstrapPeers": [ "10.0.0.1:9981" ]
+    }
+
+All fields are optional; omitted fields keep their compiled-in values.
+
+Miners can set -consolidate-threshold and -consolidate-to to be notified (via
+a consolidationReady event) when enough block rewards have matured, and to
+fetch an unsigned transaction sending them to a single address from
+/consolidation. With -sign, the consolidation is instead signed and broadcast
+automatically.
+
+Mobile push notifications are enabled with -push-config, which names a JSON
+file of the form:
+
+    {
+      "fcm": { "serverKey": "<key>" },
+      "apns": {
+        "keyFile": "AuthKey_ABC123.p8",
+        "keyID": "ABC123",
+        "teamID": "DEF456",
+        "topic": "com.example.wallet",
+        "sandbox": false
+      }
+    }
+
+Either service may be omitted. Devices are registered via /push/devices.
+
+Operators can be alerted by email or Slack with -alert-config, which names a
+JSON file of the form:
+
+    {
+      "largeOutflow": "1000",
+      "lowBalance": "50",
+      "syncStalled": "2h",
+      "smtp": {
+        "addr": "smtp.example.com:587",
+        "username": "<username>",
+        "password": "<password>",
+        "from": "walrus@example.com",
+        "to": [ "ops@example.com" ],
+        "alerts": [ "largeOutflow", "syncStalled" ]
+      },
+      "slack": {
+        "webhookURL": "https://hooks.slack.com/services/<id>",
+        "alerts": [ "lowBalance" ]
+      }
+    }
+
+An alert is raised when a confirmed transaction sends more than largeOutflow
+siacoins out of the wallet, when the balance falls below lowBalance siacoins,
+or when no block has been processed for syncStalled. Omitted thresholds
+disable the corresponding alert. Each channel may list the alerts it should
+receive; if "alerts" is omitted, it receives all of them.
+
+If public keys have been imported via /pubkeys, -lookahead keeps that many
+addresses beyond the last issued seed index under watch, so that payments to
+addresses that have not been requested yet are still detected.
+
+If -annotate-url is set, each newly-confirmed transaction relevant to the
+wallet is POSTed to that URL, and the JSON response is stored as the
+transaction's annotation, available from /transactions/:txid/annotation.
+
+The API is unauthenticated unless -auth-file names a JSON file of the form:
+
+    {
+      "apiKeys": [ "<key>", "<key>" ],
+      "username": "<username>",
+      "password": "<password>"
+    }
+
+Clients must then send one of the API keys as a bearer token, or the username
+and password via HTTP Basic authentication. Either may be omitted.
+
+For hot wallets, -sign enables /sign, which signs transactions with the
+wallet's seed so that payout services never handle key material. The seed is
+read from the WALRUS_SEED environment variable or, if it is unset, from stdin.
+Since any authenticated client can then spend the wallet's funds, -sign
+requires -auth-file, and cannot be combined with -vault-threshold. To limit
+what clients can sign, -sign-policy names a JSON file containing a signing
+policy (an allowlist of destinations, per-transaction and daily limits in
+hastings, and a required memo tag), which the server enforces.
+
+To avoid exposing a TCP port, -http can instead name a Unix domain socket,
+e.g. -http=unix:///var/run/walrus.sock. Access is then governed by the
+socket's file permissions.
+
+To serve the API over HTTPS, set -tls-cert and -tls-key to the server's
+PEM-encoded certificate and key. Setting -tls-client-ca additionally requires
+clients to present a certificate signed by one of the CA certificates in that
+file.
+
+Hosted deployments can limit the resources available to clients with
+-max-addresses, -max-push-devices, and -max-requests. Current usage is
+reported by /usage.
+
+For high availability, two or more instances (each with its own -dir) can
+share a -lease-file on common storage. Only the instance holding the lease
+broadcasts transactions and delivers notifications; the others follow the
+blockchain as warm standbys, and take over if the leader stops renewing the
+lease.
+
+The -verify flag cross-checks the wallet against the blockchain on startup,
+logging any missing or phantom transactions and outputs. With -repair, the
+wallet's index is then rebuilt in place by rescanning the blockchain; this
+takes a long time, but unlike 'walrus reset', it does not discard the
+deposits, payments, and other data stored by walrus. The same check is available via /db/verify.
+
+Setting -vault-threshold enables vault mode: any transaction set broadcast via
+/broadcast that sends more than that many siacoins out of the wallet is held
+for -vault-delay (default 48h) before it is relayed. During the delay, it can
+be cancelled via /vault/withdrawals/:id with a signature from the key given
+by -vault-recovery-key, which should be stored apart from the wallet's seed.
+
+Setting -dust-threshold enables opportunistic consolidation: transactions built
+from templates or via /construct that return change also spend up to
+-dust-max-inputs outputs worth less than -dust-threshold siacoins, adding their
+value to the change.
+Dust worth less than the fee for spending it is left alone. If -dust-max-fee
+is set, dust is only added while fees are at most that many hastings per byte.
+
+Setting -dust-hide treats outputs worth less than that many siacoins as spam:
+they are omitted from /balance and /utxos unless includeDust=true is
+specified, and are never used to fund transactions built by the server.
+
+Fee estimates (served by /fee and used to draft transactions) come from the
+local transaction pool by default. -fee-sources selects a comma-separated list
+of sources to blend instead: "tpool", "explorer" (a siad-compatible /tpool/fee
+endpoint at -fee-explorer), and "static" (-fee-static, in hastings per byte,
+either a single fee or a min,max pair). The median of the sources is used,
+bounded by -fee-floor and -fee-ceiling. To override the estimate entirely, set
+-fee-sources=static. If every source fails, the transaction pool's estimate is
+used.
+
+/health and /ready serve liveness and readiness checks, and do not require
+credentials. /ready fails if the wallet is more than -ready-max-behind blocks
+behind the network, or if its database cannot be written to. It also fails
+while consensus sync is stalled: when the height has not advanced for
+-sync-stall-timeout, or the node has had no peers for five minutes. A
+syncStalled event is emitted when sync stalls, and syncResumed when it
+recovers.
+
+Listing endpoints return at most -max-page-size items per request. Requests
+for more are rejected with 400 Bad Request, and unbounded requests (max=-1, or
+no limit) that would return more are rejected with 413 Request Entity Too
+Large; clients should request such listings in pages. Set -max-page-size=0 to
+disable the limit.
+
+Setting -journal appends every wallet event (deposits, spends, reorgs, and
+Limbo additions, along with the other events served by /events) to the given
+file as newline-delimited JSON, independent of walrus.db. The journal is
+rotated once it exceeds -journal-max-size bytes: the current file is renamed
+with the suffix ".1", the previous ".1" becomes ".2", and so on, keeping at
+most -journal-max-files files.
+
+Setting -sandbox serves the API on top of a simulated blockchain instead of
+the Sia network, with an in-memory wallet. Test funds are minted via
+/sandbox/faucet, blocks are mined on demand via /sandbox/mine, and reorgs are
+triggered via /sandbox/reorg, allowing integrators to exercise their deposit
+and withdrawal logic locally. Only -dir, -http, -auth-file, and the -tls flags
+apply in sandbox mode, and all state is discarded when walrus exits.
+
+Statements served by /reports/statement are signed with a key stored in
+statement.key, which is generated on first run. Back up this file to keep
+statement signatures verifiable against the same public key.
 `
 	versionUsage = rootUsage
 
@@ -37,6 +225,144 @@ will be forgotten, and the next time the wallet starts, it will begin scanning
 from the genesis block. This takes a long time! Resetting is typically only
 necessary if you want to track addresses that have already appeared on the
 blockchain.
+`
+
+	qrUsage = `Usage:
+    walrus qr [subcommand]
+
+Encodes and decodes the frames used to pass transactions to and from an
+offline signer via animated QR codes. Each frame is printed on its own line,
+and can be rendered with any QR encoder (e.g. qrencode).
+`
+
+	qrEncodeUsage = `Usage:
+    walrus qr encode [flags] file
+
+Reads a JSON signing request from file, and prints its frames. If -sigs is
+set, file instead contains a signing response.
+`
+
+	replicaUsage = `Usage:
+    walrus replica [flags] primary
+
+Serves a read-only mirror of the walrus server at the specified address.
+Instead of following the blockchain, the replica forwards requests to the
+primary, caching each response until the primary processes a new block or
+until the response is older than -max-age. Requests that would modify the
+primary's state are rejected.
+`
+
+	vectorsUsage = `Usage:
+    walrus vectors
+
+Prints deterministic test vectors as JSON: addresses, signed transactions, and
+example API requests and responses, all derived from a fixed, public seed.
+Client authors can check their implementations against this output
+byte-for-byte.
+`
+
+	snapshotUsage = `Usage:
+    walrus snapshot [subcommand]
+
+Exports and imports snapshots of the chain state processed by walrus: the
+consensus set, the wallet, and the Tracker's database. Importing a snapshot
+lets additional walrus nodes start from the snapshot's height instead of
+scanning the blockchain from genesis. walrus must not be running while a
+snapshot is exported.
+`
+
+	snapshotExportUsage = `Usage:
+    walrus snapshot export [flags] file
+
+Writes a snapshot of the databases in -dir to file, and prints its height and
+SHA-256 hash. The snapshot contains the wallet's addresses and transaction
+history, but not statement.key.
+`
+
+	snapshotImportUsage = `Usage:
+    walrus snapshot import [flags] file
+
+Restores the snapshot in file into -dir, which must not already contain any
+of its databases. Each database is verified against the hashes in the
+snapshot's manifest; if -sha256 is set, the snapshot file itself must also
+have that hash. After importing, start walrus as usual to continue syncing
+from the snapshot's height.
+`
+
+	contractsUsage = `Usage:
+    walrus contracts [flags] [id]
+
+Prints the file contracts tracked by the walrus server at -api as JSON,
+newest-to-oldest. If a contract ID is supplied, the on-chain revisions of that
+contract are printed instead.
+
+-host selects contracts formed with the specified host public key (e.g.
+ed25519:...), and -payout selects contracts with a valid or missed proof
+output sent to the specified address. At most -limit results are printed; if
+more follow, the value to pass as -before to fetch the next page is printed to
+stderr.
+`
+
+	tuiUsage = `Usage:
+    walrus tui [flags]
+
+Displays a live dashboard of the walrus server at -api: the wallet's balance,
+sync status, recent transactions, Limbo, and fee tiers, along with the most
+recent events from the server's event stream. The dashboard is refreshed
+whenever an event arrives, and every -refresh, since Limbo and fees change
+independently of the blockchain. Press Ctrl-C to exit.
+`
+
+	reservesUsage = `Usage:
+    walrus reserves [subcommand]
+
+Creates and verifies proofs of reserves. A proof of reserves lists every
+address in the wallet holding siacoins, along with its balance at a stated
+height, a Merkle root committing to the list, and a signature by each
+address's key of a challenge chosen by the auditor.
+`
+
+	reservesCreateUsage = `Usage:
+    walrus reserves create [flags] challenge
+
+Fetches a proof of reserves for the specified challenge from the walrus server
+at -api, and prints it as JSON. If -sign is set, the proof is signed with the
+wallet's seed, which is read from the WALRUS_SEED environment variable or, if
+it is unset, from stdin. Otherwise, the proof must be signed separately, e.g.
+with a hardware wallet, before it is given to the auditor.
+`
+
+	reservesVerifyUsage = `Usage:
+    walrus reserves verify file
+
+Verifies the signed proof of reserves in file. No connection to a walrus
+server is required. The proof's balances are not checked against the
+blockchain; compare them to an independent node at the proof's height.
+`
+
+	qrDecodeUsage = `Usage:
+    walrus qr decode
+
+Reads frames from stdin, one per line, in any order, and prints the decoded
+signing request or response as JSON.
+`
+
+	bundleUsage = `Usage:
+    walrus bundle [subcommand]
+
+Handles signing bundles: unsigned transactions, as returned by
+/construct?format=bundle, along with the value, unlock conditions, and key
+index of each input. A bundle carries everything an offline signer needs, so
+it can be signed on an air-gapped machine without a connection to walrus.
+`
+
+	bundleSignUsage = `Usage:
+    walrus bundle sign file
+
+Checks the signing bundle in file, logs its outputs and fee, and signs it with
+the wallet's seed, which is read from the WALRUS_SEED environment variable or,
+if it is unset, from stdin. The signed bundle is printed as JSON; broadcast
+its parents, followed by its transaction, via /broadcast.
 `
 )
 
@@ -47,17 +373,124 @@ func main() {
 
 	rootCmd := flagg.Root
 	rootCmd.Usage = flagg.SimpleUsage(rootCmd, rootUsage)
-	addr := rootCmd.String("http", ":9380", "host:port to serve on")
+	addr := rootCmd.String("http", ":9380", "host:port or unix:///path/to/socket to serve on")
 	dir := rootCmd.String("dir", ".", "directory to store in")
+	network := rootCmd.String("network", "mainnet", "network to connect to (mainnet, zen, or custom)")
+	networkConfig := rootCmd.String("network-config", "", "JSON file describing a custom network")
+	consolidateThreshold := rootCmd.Int("consolidate-threshold", 0, "draft a consolidation once this many block rewards have matured (0 to disable)")
+	consolidateTo := rootCmd.String("consolidate-to", "", "address to send consolidated block rewards to")
+	pushConfig := rootCmd.String("push-config", "", "JSON file configuring push notification services")
+	alertConfig := rootCmd.String("alert-config", "", "JSON file configuring email and Slack alerts")
+	annotateURL := rootCmd.String("annotate-url", "", "URL of a service that annotates new transactions")
+	tlsCert := rootCmd.String("tls-cert", "", "PEM file containing the server's TLS certificate")
+	tlsKey := rootCmd.String("tls-key", "", "PEM file containing the server's TLS key")
+	tlsClientCA := rootCmd.String("tls-client-ca", "", "PEM file of CA certificates that client certificates must be signed by")
+	authFile := rootCmd.String("auth-file", "", "JSON file containing the credentials API clients must present")
+	maxAddresses := rootCmd.Int("max-addresses", 0, "maximum number of addresses in the wallet (0 for no limit)")
+	maxPushDevices := rootCmd.Int("max-push-devices", 0, "maximum number of registered push devices (0 for no limit)")
+	maxRequests := rootCmd.Int("max-requests", 0, "maximum number of API requests per minute (0 for no limit)")
+	leaseFile := rootCmd.String("lease-file", "", "lease file shared with standby instances")
+	leaseHolder := rootCmd.String("lease-holder", "", "name of this instance in the lease file (defaults to the hostname)")
+	verify := rootCmd.Bool("verify", false, "check the wallet against the blockchain on startup")
+	repair := rootCmd.Bool("repair", false, "with -verify, rebuild the wallet index if discrepancies are found")
+	lookahead := rootCmd.Uint64("lookahead", 0, "number of unissued addresses to watch (0 to disable)")
+	vaultThreshold := rootCmd.String("vault-threshold", "", "delay broadcasts sending more than this many SC out of the wallet")
+	vaultDelay := rootCmd.Duration("vault-delay", 48*time.Hour, "how long to delay broadcasts above -vault-threshold")
+	vaultRecoveryKey := rootCmd.String("vault-recovery-key", "", "hex-encoded ed25519 public key that can cancel delayed broadcasts")
+	sign := rootCmd.Bool("sign", false, "serve /sign, signing transactions with the wallet's seed")
+	signPolicy := rootCmd.String("sign-policy", "", "JSON file of limits on the transactions signed via /sign")
+	dustThreshold := rootCmd.String("dust-threshold", "", "spend outputs worth less than this many SC in transactions built by the server")
+	dustMaxInputs := rootCmd.Int("dust-max-inputs", walrus.DefaultDustMaxInputs, "maximum number of dust outputs to add to a transaction")
+	dustMaxFee := rootCmd.String("dust-max-fee", "", "only add dust to transactions paying at most this many hastings per byte")
+	dustHide := rootCmd.String("dust-hide", "", "hide outputs worth less than this many SC and never spend them")
+	feeSources := rootCmd.String("fee-sources", "tpool", "comma-separated fee estimate sources to blend (tpool, explorer, static)")
+	feeExplorer := rootCmd.String("fee-explorer", "", "URL of a siad-compatible /tpool/fee endpoint")
+	feeStatic := rootCmd.String("fee-static", "", "fee, or min,max fees, in hastings per byte for the static source")
+	feeFloor := rootCmd.String("fee-floor", "", "lower bound on fee estimates, in hastings per byte")
+	feeCeiling := rootCmd.String("fee-ceiling", "", "upper bound on fee estimates, in hastings per byte")
+	readyMaxBehind := rootCmd.Uint64("ready-max-behind", walrus.DefaultMaxBlocksBehind, "number of blocks the wallet may lag behind the network before /ready fails")
+	maxPageSize := rootCmd.Int("max-page-size", walrus.DefaultMaxPageSize, "maximum number of items returned by a listing request (0 for no limit)")
+	syncStallTimeout := rootCmd.Duration("sync-stall-timeout", walrus.DefaultSyncStallTimeout, "how long the consensus height may stay the same before sync is considered stalled (0 to disable)")
+	journal := rootCmd.String("journal", "", "file to append a journal of wallet events to")
+	journalMaxSize := rootCmd.Int64("journal-max-size", walrus.DefaultJournalMaxSize, "size, in bytes, at which the journal is rotated")
+	journalMaxFiles := rootCmd.Int("journal-max-files", walrus.DefaultJournalMaxFiles, "maximum number of journal files to keep")
+	wsOrigins := rootCmd.String("ws-origins", "", "comma-separated origins of web pages allowed to open WebSocket connections")
+	sandbox := rootCmd.Bool("sandbox", false, "serve a simulated blockchain for testing, instead of connecting to the network")
 	versionCmd := flagg.New("version", versionUsage)
 	resetCmd := flagg.New("reset", resetUsage)
 	resetDir := resetCmd.String("dir", ".", "directory where wallet is stored")
+	replicaCmd := flagg.New("replica", replicaUsage)
+	replicaAddr := replicaCmd.String("http", ":9380", "host:port to serve on")
+	replicaMaxAge := replicaCmd.Duration("max-age", 10*time.Second, "maximum age of cached responses")
+	vectorsCmd := flagg.New("vectors", vectorsUsage)
+	qrCmd := flagg.New("qr", qrUsage)
+	qrEncodeCmd := flagg.New("encode", qrEncodeUsage)
+	qrSigs := qrEncodeCmd.Bool("sigs", false, "encode a signing response rather than a request")
+	qrSize := qrEncodeCmd.Int("size", walrus.DefaultFrameSize, "payload characters per frame")
+	qrDecodeCmd := flagg.New("decode", qrDecodeUsage)
+	bundleCmd := flagg.New("bundle", bundleUsage)
+	bundleSignCmd := flagg.New("sign", bundleSignUsage)
+	snapshotCmd := flagg.New("snapshot", snapshotUsage)
+	snapshotExportCmd := flagg.New("export", snapshotExportUsage)
+	snapshotExportDir := snapshotExportCmd.String("dir", ".", "directory where walrus is stored")
+	snapshotImportCmd := flagg.New("import", snapshotImportUsage)
+	snapshotImportDir := snapshotImportCmd.String("dir", ".", "directory to restore into")
+	snapshotImportHash := snapshotImportCmd.String("sha256", "", "expected hex-encoded SHA-256 hash of the snapshot")
+	contractsCmd := flagg.New("contracts", contractsUsage)
+	contractsAPI := contractsCmd.String("api", "http://localhost:9380", "address of the walrus server")
+	contractsAPIKey := contractsCmd.String("api-key", "", "API key to present to the server")
+	contractsHost := contractsCmd.String("host", "", "only list contracts with this host public key")
+	contractsPayout := contractsCmd.String("payout", "", "only list contracts paying this address")
+	contractsBefore := contractsCmd.String("before", "", "cursor printed by the previous page")
+	contractsLimit := contractsCmd.Int("limit", 100, "maximum number of results to print")
+	tuiCmd := flagg.New("tui", tuiUsage)
+	tuiAPI := tuiCmd.String("api", "http://localhost:9380", "address of the walrus server")
+	tuiAPIKey := tuiCmd.String("api-key", "", "API key to present to the server")
+	tuiRefresh := tuiCmd.Duration("refresh", 30*time.Second, "how often to refresh the dashboard")
+	tuiTxns := tuiCmd.Int("txns", 10, "number of recent transactions to show")
+	reservesCmd := flagg.New("reserves", reservesUsage)
+	reservesCreateCmd := flagg.New("create", reservesCreateUsage)
+	reservesAPI := reservesCreateCmd.String("api", "http://localhost:9380", "address of the walrus server")
+	reservesAPIKey := reservesCreateCmd.String("api-key", "", "API key to present to the server")
+	reservesSign := reservesCreateCmd.Bool("sign", false, "sign the proof with the wallet's seed")
+	reservesVerifyCmd := flagg.New("verify", reservesVerifyUsage)
 
 	cmd := flagg.Parse(flagg.Tree{
 		Cmd: rootCmd,
 		Sub: []flagg.Tree{
 			{Cmd: versionCmd},
 			{Cmd: resetCmd},
+			{Cmd: replicaCmd},
+			{Cmd: vectorsCmd},
+			{
+				Cmd: qrCmd,
+				Sub: []flagg.Tree{
+					{Cmd: qrEncodeCmd},
+					{Cmd: qrDecodeCmd},
+				},
+			},
+			{
+				Cmd: bundleCmd,
+				Sub: []flagg.Tree{
+					{Cmd: bundleSignCmd},
+				},
+			},
+			{
+				Cmd: snapshotCmd,
+				Sub: []flagg.Tree{
+					{Cmd: snapshotExportCmd},
+					{Cmd: snapshotImportCmd},
+				},
+			},
+			{Cmd: contractsCmd},
+			{Cmd: tuiCmd},
+			{
+				Cmd: reservesCmd,
+				Sub: []flagg.Tree{
+					{Cmd: reservesCreateCmd},
+					{Cmd: reservesVerifyCmd},
+				},
+			},
 		},
 	})
 	args := cmd.Args()
@@ -68,15 +501,64 @@ func main() {
 			usage()
 			return
 		}
-		log.Printf("walrus v0.3.0\nCommit:     %s\nRelease:    %s\nGo version: %s %s/%s\nBuild Date: %s\n",
-			githash, build.Release, runtime.Version(), runtime.GOOS, runtime.GOARCH, builddate)
+		log.Printf("walrus v%s (API revision %d)\nCommit:     %s\nRelease:    %s\nGo version: %s %s/%s\nBuild Date: %s\n",
+			walrus.Version, walrus.APIRevision, githash, build.Release, runtime.Version(), runtime.GOOS, runtime.GOARCH, builddate)
 
 	case rootCmd:
 		if len(args) != 0 {
 			rootCmd.Usage()
 			return
 		}
-		if err := start(*dir, *addr); err != nil {
+		err := start(config{
+			Dir:                  *dir,
+			APIAddr:              *addr,
+			Network:              *network,
+			NetworkConfig:        *networkConfig,
+			ConsolidateThreshold: *consolidateThreshold,
+			ConsolidateTo:        *consolidateTo,
+			PushConfig:           *pushConfig,
+			AlertConfig:          *alertConfig,
+			Lookahead:            *lookahead,
+			AnnotateURL:          *annotateURL,
+			LeaseFile:            *leaseFile,
+			Verify:               *verify,
+			Repair:               *repair,
+			LeaseHolder:          *leaseHolder,
+			VaultThreshold:       *vaultThreshold,
+			VaultDelay:           *vaultDelay,
+			VaultRecoveryKey:     *vaultRecoveryKey,
+			Sign:                 *sign,
+			SignPolicy:           *signPolicy,
+			DustThreshold:        *dustThreshold,
+			DustMaxInputs:        *dustMaxInputs,
+			DustMaxFee:           *dustMaxFee,
+			DustHide:             *dustHide,
+			AuthFile:             *authFile,
+			TLSCert:              *tlsCert,
+			TLSKey:               *tlsKey,
+			TLSClientCA:          *tlsClientCA,
+			ReadyMaxBehind:       *readyMaxBehind,
+			MaxPageSize:          *maxPageSize,
+			SyncStallTimeout:     *syncStallTimeout,
+			Journal:              *journal,
+			JournalMaxSize:       *journalMaxSize,
+			JournalMaxFiles:      *journalMaxFiles,
+			Sandbox:              *sandbox,
+			WSOrigins:            *wsOrigins,
+			Fees: feeOptions{
+				Sources:  *feeSources,
+				Explorer: *feeExplorer,
+				Static:   *feeStatic,
+				Floor:    *feeFloor,
+				Ceiling:  *feeCeiling,
+			},
+			Quota: walrus.Quota{
+				MaxAddresses:      *maxAddresses,
+				MaxPushDevices:    *maxPushDevices,
+				RequestsPerMinute: *maxRequests,
+			},
+		})
+		if err != nil {
 			log.Fatal(err)
 		}
 
@@ -88,15 +570,308 @@ func main() {
 		if err := reset(*resetDir); err != nil {
 			log.Fatal(err)
 		}
+
+	case replicaCmd:
+		if len(args) != 1 {
+			replicaCmd.Usage()
+			return
+		}
+		r := walrus.NewReplica(args[0], *replicaMaxAge)
+		go r.Sync(context.Background())
+		log.Printf("Serving replica of %v on %v...", args[0], *replicaAddr)
+		log.Fatal(http.ListenAndServe(*replicaAddr, r))
+
+	case vectorsCmd:
+		if len(args) != 0 {
+			vectorsCmd.Usage()
+			return
+		}
+		os.Stdout.Write(vectors.MarshalIndentedJSON())
+
+	case qrCmd:
+		qrCmd.Usage()
+
+	case qrEncodeCmd:
+		if len(args) != 1 {
+			qrEncodeCmd.Usage()
+			return
+		}
+		if err := qrEncode(args[0], *qrSigs, *qrSize); err != nil {
+			log.Fatal(err)
+		}
+
+	case qrDecodeCmd:
+		if len(args) != 0 {
+			qrDecodeCmd.Usage()
+			return
+		}
+		if err := qrDecode(os.Stdin); err != nil {
+			log.Fatal(err)
+		}
+
+	case bundleCmd:
+		bundleCmd.Usage()
+
+	case bundleSignCmd:
+		if len(args) != 1 {
+			bundleSignCmd.Usage()
+			return
+		}
+		if err := signBundle(args[0]); err != nil {
+			log.Fatal(err)
+		}
+
+	case snapshotCmd:
+		snapshotCmd.Usage()
+
+	case snapshotExportCmd:
+		if len(args) != 1 {
+			snapshotExportCmd.Usage()
+			return
+		}
+		if err := snapshotExport(*snapshotExportDir, args[0]); err != nil {
+			log.Fatal(err)
+		}
+
+	case snapshotImportCmd:
+		if len(args) != 1 {
+			snapshotImportCmd.Usage()
+			return
+		}
+		if err := snapshotImport(*snapshotImportDir, args[0], *snapshotImportHash); err != nil {
+			log.Fatal(err)
+		}
+
+	case contractsCmd:
+		if len(args) > 1 || *contractsLimit <= 0 {
+			contractsCmd.Usage()
+			return
+		}
+		opts := contractsOptions{
+			API:    *contractsAPI,
+			APIKey: *contractsAPIKey,
+			Host:   *contractsHost,
+			Payout: *contractsPayout,
+			Before: *contractsBefore,
+			Limit:  *contractsLimit,
+		}
+		if len(args) == 1 {
+			opts.History = args[0]
+		}
+		if err := listContracts(opts); err != nil {
+			log.Fatal(err)
+		}
+
+	case tuiCmd:
+		if len(args) != 0 || *tuiRefresh <= 0 || *tuiTxns < 0 || *tuiTxns > maxTUITransactions {
+			tuiCmd.Usage()
+			return
+		}
+		opts := tuiOptions{
+			API:          *tuiAPI,
+			APIKey:       *tuiAPIKey,
+			Refresh:      *tuiRefresh,
+			Transactions: *tuiTxns,
+		}
+		if err := runTUI(opts); err != nil {
+			log.Fatal(err)
+		}
+
+	case reservesCmd:
+		reservesCmd.Usage()
+
+	case reservesCreateCmd:
+		if len(args) != 1 {
+			reservesCreateCmd.Usage()
+			return
+		}
+		opts := reservesOptions{
+			API:     *reservesAPI,
+			APIKey:  *reservesAPIKey,
+			Sign:    *reservesSign,
+			Message: args[0],
+		}
+		if err := createReserves(opts); err != nil {
+			log.Fatal(err)
+		}
+
+	case reservesVerifyCmd:
+		if len(args) != 1 {
+			reservesVerifyCmd.Usage()
+			return
+		}
+		if err := verifyReserves(args[0]); err != nil {
+			log.Fatal(err)
+		}
 	}
 }
 
-func start(dir string, APIaddr string) error {
-	g, err := gateway.New(":9381", true, filepath.Join(dir, "gateway"))
+func checkNetwork(network string) error {
+	switch network {
+	case "mainnet":
+		if build.Release != "standard" {
+			return fmt.Errorf("walrus was built with %q constants; rebuild without the dev tag to use mainnet", build.Release)
+		}
+	case "zen":
+		return errors.New("the Zen testnet is not supported by this version of Sia")
+	case "custom":
+		if build.Release == "standard" {
+			return errors.New("walrus was built with mainnet constants; rebuild with the dev tag to use a custom network")
+		}
+	default:
+		return fmt.Errorf("unrecognized network %q", network)
+	}
+	return nil
+}
+
+type config struct {
+	Dir                  string
+	APIAddr              string
+	Network              string
+	NetworkConfig        string
+	ConsolidateThreshold int
+	ConsolidateTo        string
+	PushConfig           string
+	AlertConfig          string
+	Lookahead            uint64
+	AnnotateURL          string
+	LeaseFile            string
+	LeaseHolder          string
+	Verify               bool
+	Repair               bool
+	VaultThreshold       string
+	VaultDelay           time.Duration
+	VaultRecoveryKey     string
+	Sign                 bool
+	SignPolicy           string
+	DustThreshold        string
+	DustMaxInputs        int
+	DustMaxFee           string
+	DustHide             string
+	AuthFile             string
+	TLSCert              string
+	TLSKey               string
+	TLSClientCA          string
+	ReadyMaxBehind       uint64
+	MaxPageSize          int
+	SyncStallTimeout     time.Duration
+	Journal              string
+	JournalMaxSize       int64
+	JournalMaxFiles      int
+	Sandbox              bool
+	WSOrigins            string
+	Fees                 feeOptions
+	Quota                walrus.Quota
+}
+
+func start(cfg config) error {
+	if cfg.Sandbox {
+		return startSandbox(cfg)
+	}
+	dir, network := cfg.Dir, cfg.Network
+	if err := checkNetwork(network); err != nil {
+		return err
+	} else if cfg.NetworkConfig != "" && network != "custom" {
+		return errors.New("-network-config can only be used with -network=custom")
+	}
+	custom, err := loadCustomNetwork(cfg.NetworkConfig)
+	if err != nil {
+		return err
+	}
+	custom.apply()
+
+	var consolidation *walrus.ConsolidationPolicy
+	if cfg.ConsolidateThreshold > 0 {
+		consolidation = &walrus.ConsolidationPolicy{Threshold: cfg.ConsolidateThreshold}
+		if err := consolidation.Destination.LoadString(cfg.ConsolidateTo); err != nil {
+			return fmt.Errorf("invalid -consolidate-to address: %v", err)
+		}
+	}
+
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return errors.New("-tls-cert and -tls-key must be used together")
+	} else if cfg.TLSClientCA != "" && cfg.TLSCert == "" {
+		return errors.New("-tls-client-ca requires -tls-cert and -tls-key")
+	}
+	srv := &http.Server{Addr: cfg.APIAddr}
+	if cfg.TLSClientCA != "" {
+		if srv.TLSConfig, err = walrus.LoadServerTLSConfig(cfg.TLSClientCA); err != nil {
+			return fmt.Errorf("couldn't load client CA: %v", err)
+		}
+	}
+
+	var creds walrus.Credentials
+	if cfg.AuthFile != "" {
+		if creds, err = loadCredentials(cfg.AuthFile); err != nil {
+			return fmt.Errorf("couldn't load credentials: %v", err)
+		}
+	}
+	var seed *wallet.Seed
+	if cfg.Sign {
+		if len(creds.APIKeys) == 0 && creds.Username == "" {
+			return errors.New("-sign requires credentials in -auth-file")
+		} else if cfg.VaultThreshold != "" {
+			return errors.New("-sign cannot be combined with -vault-threshold, since signed transactions could be broadcast without delay")
+		}
+		s, err := readSeed()
+		if err != nil {
+			return fmt.Errorf("couldn't load seed: %v", err)
+		}
+		seed = &s
+	}
+	var signingPolicy *walrus.SigningPolicy
+	if cfg.SignPolicy != "" {
+		if !cfg.Sign {
+			return errors.New("-sign-policy requires -sign")
+		}
+		p, err := loadSigningPolicy(cfg.SignPolicy)
+		if err != nil {
+			return fmt.Errorf("couldn't load signing policy: %v", err)
+		}
+		signingPolicy = &p
+	}
+
+	newFeeEstimator, err := parseFeeOptions(cfg.Fees)
 	if err != nil {
 		return err
 	}
-	cs, errChan := consensus.New(g, true, filepath.Join(dir, "consensus"))
+
+	if cfg.JournalMaxSize <= 0 || cfg.JournalMaxFiles <= 0 {
+		return errors.New("-journal-max-size and -journal-max-files must be positive")
+	}
+
+	var vault *walrus.VaultPolicy
+	if cfg.VaultThreshold != "" {
+		p, err := parseVaultPolicy(cfg.VaultThreshold, cfg.VaultDelay, cfg.VaultRecoveryKey)
+		if err != nil {
+			return err
+		}
+		vault = &p
+	}
+
+	var dust *walrus.DustPolicy
+	if cfg.DustThreshold != "" {
+		p, err := parseDustPolicy(cfg.DustThreshold, cfg.DustMaxInputs, cfg.DustMaxFee)
+		if err != nil {
+			return err
+		}
+		dust = &p
+	}
+	dustHide := types.ZeroCurrency
+	if cfg.DustHide != "" {
+		var ok bool
+		if dustHide, ok = parseSiacoins(cfg.DustHide); !ok {
+			return errors.New("invalid -dust-hide: must be a number of siacoins")
+		}
+	}
+
+	bootstrap := network == "mainnet"
+	g, err := gateway.New(":9381", bootstrap, filepath.Join(dir, "gateway"))
+	if err != nil {
+		return err
+	}
+	custom.connect(g)
+	cs, errChan := consensus.New(g, bootstrap || len(custom.BootstrapPeers) > 0, filepath.Join(dir, "consensus"))
 	err = handleAsyncErr(errChan)
 	if err != nil {
 		return err
@@ -110,15 +885,124 @@ func start(dir string, APIaddr string) error {
 	if err != nil {
 		return err
 	}
+	chain := walrus.SiaAdapter{CS: cs, TP: tp, Name: network}
 	w := wallet.New(store)
-	err = cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	sub := w.ConsensusSetSubscriber(store)
+	err = chain.Subscribe(sub, store.ConsensusChangeID())
+	if err != nil {
+		return err
+	}
+	if cfg.Verify {
+		if err := verifyWallet(w, cs, walletRebuilder{cs, sub, store, nil}, cfg.Repair); err != nil {
+			return fmt.Errorf("couldn't rebuild wallet index: %v", err)
+		}
+	}
+	// the tracker must be subscribed after the wallet
+	t, err := walrus.NewTracker(w, filepath.Join(dir, "walrus.db"))
 	if err != nil {
 		return err
 	}
-	ss := walrus.NewServer(w, tp)
+	if consolidation != nil {
+		t.SetConsolidationPolicy(*consolidation)
+	}
+	t.SetLookahead(cfg.Lookahead)
+	if vault != nil {
+		if err := t.SetVaultPolicy(*vault); err != nil {
+			return err
+		}
+	}
+	if dust != nil {
+		t.SetDustPolicy(*dust)
+	}
+	if cfg.AnnotateURL != "" {
+		t.SetAnnotator(&walrus.HTTPAnnotator{URL: cfg.AnnotateURL})
+	}
+	if cfg.PushConfig != "" {
+		senders, err := loadPushSenders(cfg.PushConfig)
+		if err != nil {
+			return fmt.Errorf("couldn't load push config: %v", err)
+		} else if err := t.SetPushSenders(senders); err != nil {
+			return err
+		}
+	}
+	if cfg.AlertConfig != "" {
+		p, channels, err := loadAlerts(cfg.AlertConfig)
+		if err != nil {
+			return fmt.Errorf("couldn't load alert config: %v", err)
+		}
+		t.SetAlerts(p, channels)
+	}
+	if cfg.Journal != "" {
+		j, err := walrus.OpenJournal(cfg.Journal, cfg.JournalMaxSize, cfg.JournalMaxFiles)
+		if err != nil {
+			return fmt.Errorf("couldn't open journal: %v", err)
+		}
+		t.SetJournal(j, func(err error) {
+			log.Println("WARNING: couldn't write to journal:", err)
+		})
+	}
+	err = chain.Subscribe(t, t.ConsensusChangeID())
+	if err != nil {
+		return err
+	}
+	statementKey, err := loadStatementKey(filepath.Join(dir, "statement.key"))
+	if err != nil {
+		return fmt.Errorf("couldn't load statement key: %v", err)
+	}
+	opts := []walrus.ServerOption{
+		walrus.WithTracker(t),
+		walrus.WithStatementKey(statementKey),
+		walrus.WithKeySource(t),
+		walrus.WithQuota(cfg.Quota),
+		walrus.WithIndexRebuilder(walletRebuilder{cs, sub, store, t}),
+		walrus.WithGateway(g),
+		walrus.WithCredentials(creds),
+		walrus.WithFeeEstimator(newFeeEstimator(tp)),
+		walrus.WithMaxBlocksBehind(types.BlockHeight(cfg.ReadyMaxBehind)),
+		walrus.WithMaxPageSize(cfg.MaxPageSize),
+		walrus.WithDustThreshold(dustHide),
+	}
+	if cfg.WSOrigins != "" {
+		opts = append(opts, walrus.WithAllowedOrigins(strings.Split(cfg.WSOrigins, ",")...))
+	}
+	if seed != nil {
+		opts = append(opts, walrus.WithSigningSeed(*seed))
+	}
+	if signingPolicy != nil {
+		opts = append(opts, walrus.WithSigningPolicy(*signingPolicy))
+	}
+	if cfg.SyncStallTimeout > 0 {
+		sw := walrus.NewSyncWatchdog(cs, g, t, cfg.SyncStallTimeout)
+		go sw.Run(context.Background())
+		opts = append(opts, walrus.WithSyncWatchdog(sw))
+	}
+	if cfg.LeaseFile != "" {
+		holder := cfg.LeaseHolder
+		if holder == "" {
+			if holder, err = os.Hostname(); err != nil {
+				return err
+			}
+		}
+		lease := walrus.NewFileLease(cfg.LeaseFile, holder, 30*time.Second)
+		go lease.Run(context.Background())
+		t.SetLeader(lease)
+		opts = append(opts, walrus.WithLeader(lease))
+	}
+	// broadcast the inheritance transactions, if any, once the operator stops
+	// sending heartbeats
+	t.WatchInheritance(tp)
+	t.WatchVault(tp)
+	srv.Handler = walrus.NewChainServer(w, chain, opts...)
 
-	log.Printf("Listening on %v...", APIaddr)
-	return http.ListenAndServe(APIaddr, ss)
+	l, err := walrus.Listen(cfg.APIAddr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Listening on %v (%v)...", cfg.APIAddr, network)
+	if cfg.TLSCert != "" {
+		return srv.ServeTLS(l, cfg.TLSCert, cfg.TLSKey)
+	}
+	return srv.Serve(l)
 }
 
 func reset(dir string) error {
@@ -126,7 +1010,14 @@ func reset(dir string) error {
 	if err != nil {
 		return err
 	}
-	return store.Reset()
+	if err := store.Reset(); err != nil {
+		return err
+	}
+	// the tracker must rescan along with the wallet
+	if err := os.Remove(filepath.Join(dir, "walrus.db")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
 
 func handleAsyncErr(errCh <-chan error) error {
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// A customNetwork describes a private Sia network, e.g. a devnet used for CI.
+type customNetwork struct {
+	GenesisTimestamp types.Timestamp `json:"genesisTimestamp"`
+	GenesisSiafunds  []struct {
+		Value      types.Currency   `json:"value"`
+		UnlockHash types.UnlockHash `json:"unlockHash"`
+	} `json:"genesisSiafunds"`
+	BlockFrequency types.BlockHeight    `json:"blockFrequency"`
+	BootstrapPeers []modules.NetAddress `json:"bootstrapPeers"`
+}
+
+// apply overwrites the compiled-in network constants with those of n. It
+// must be called before any modules are initialized.
+func (n customNetwork) apply() {
+	if n.GenesisTimestamp != 0 || len(n.GenesisSiafunds) != 0 {
+		if n.GenesisTimestamp != 0 {
+			types.GenesisTimestamp = n.GenesisTimestamp
+		}
+		if len(n.GenesisSiafunds) != 0 {
+			types.GenesisSiafundAllocation = make([]types.SiafundOutput, len(n.GenesisSiafunds))
+			for i, sf := range n.GenesisSiafunds {
+				types.GenesisSiafundAllocation[i] = types.SiafundOutput{
+					Value:      sf.Value,
+					UnlockHash: sf.UnlockHash,
+				}
+			}
+		}
+		types.GenesisBlock = types.Block{
+			Timestamp: types.GenesisTimestamp,
+			Transactions: []types.Transaction{
+				{SiafundOutputs: types.GenesisSiafundAllocation},
+			},
+		}
+		types.GenesisID = types.GenesisBlock.ID()
+	}
+	if n.BlockFrequency != 0 {
+		types.BlockFrequency = n.BlockFrequency
+	}
+}
+
+// connect connects the gateway to the network's bootstrap peers. Failures are
+// logged, but are not fatal.
+func (n customNetwork) connect(g modules.Gateway) {
+	for _, addr := range n.BootstrapPeers {
+		if err := g.Connect(addr); err != nil {
+			log.Printf("WARNING: could not connect to bootstrap peer %v: %v", addr, err)
+		}
+	}
+}
+
+func loadCustomNetwork(filename string) (n customNetwork, err error) {
+	if filename == "" {
+		return customNetwork{}, nil
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return customNetwork{}, err
+	}
+	defer f.Close()
+	err = json.NewDecoder(f).Decode(&n)
+	return
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+func TestCustomNetwork(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// an empty filename leaves every constant untouched
+	if n, err := loadCustomNetwork(""); err != nil {
+		t.Fatal(err)
+	} else if n.GenesisTimestamp != 0 || n.BlockFrequency != 0 || len(n.BootstrapPeers) != 0 {
+		t.Fatal("expected empty network config, got", n)
+	}
+
+	addr := types.UnlockHash{1}
+	js := `{
+		"genesisTimestamp": 1528293910,
+		"genesisSiafunds": [{"value": "2000", "unlockHash": "` + addr.String() + `"}],
+		"blockFrequency": 12,
+		"bootstrapPeers": ["10.0.0.1:9981"]
+	}`
+	filename := filepath.Join(dir, "network.json")
+	if err := ioutil.WriteFile(filename, []byte(js), 0600); err != nil {
+		t.Fatal(err)
+	}
+	n, err := loadCustomNetwork(filename)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(n.BootstrapPeers) != 1 || n.BootstrapPeers[0] != "10.0.0.1:9981" {
+		t.Fatal("wrong bootstrap peers:", n.BootstrapPeers)
+	}
+
+	// restore the compiled-in constants afterwards
+	oldTimestamp, oldAllocation := types.GenesisTimestamp, types.GenesisSiafundAllocation
+	oldBlock, oldID, oldFrequency := types.GenesisBlock, types.GenesisID, types.BlockFrequency
+	defer func() {
+		types.GenesisTimestamp, types.GenesisSiafundAllocation = oldTimestamp, oldAllocation
+		types.GenesisBlock, types.GenesisID, types.BlockFrequency = oldBlock, oldID, oldFrequency
+	}()
+	n.apply()
+	if types.GenesisTimestamp != 1528293910 || types.BlockFrequency != 12 {
+		t.Fatal("network constants were not applied")
+	} else if len(types.GenesisSiafundAllocation) != 1 || types.GenesisSiafundAllocation[0].UnlockHash != addr ||
+		!types.GenesisSiafundAllocation[0].Value.Equals64(2000) {
+		t.Fatal("wrong genesis siafunds:", types.GenesisSiafundAllocation)
+	} else if types.GenesisID != types.GenesisBlock.ID() || types.GenesisID == oldID {
+		t.Fatal("genesis block was not rebuilt")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"lukechampine.com/walrus"
+)
+
+// pushConfig describes the push notification services that walrus delivers
+// events to.
+type pushConfig struct {
+	FCM *struct {
+		ServerKey string `json:"serverKey"`
+	} `json:"fcm"`
+	APNs *struct {
+		KeyFile string `json:"keyFile"`
+		KeyID   string `json:"keyID"`
+		TeamID  string `json:"teamID"`
+		Topic   string `json:"topic"`
+		Sandbox bool   `json:"sandbox"`
+	} `json:"apns"`
+}
+
+// loadPushSenders loads a pushConfig from filename and returns the
+// corresponding senders.
+func loadPushSenders(filename string) (map[string]walrus.PushSender, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var pc pushConfig
+	if err := json.NewDecoder(f).Decode(&pc); err != nil {
+		return nil, err
+	}
+	senders := make(map[string]walrus.PushSender)
+	if pc.FCM != nil {
+		senders[walrus.PlatformFCM] = &walrus.FCMSender{ServerKey: pc.FCM.ServerKey}
+	}
+	if pc.APNs != nil {
+		key, err := walrus.LoadAPNsKey(pc.APNs.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		senders[walrus.PlatformAPNs] = &walrus.APNsSender{
+			KeyID:   pc.APNs.KeyID,
+			TeamID:  pc.APNs.TeamID,
+			Topic:   pc.APNs.Topic,
+			Key:     key,
+			Sandbox: pc.APNs.Sandbox,
+		}
+	}
+	return senders, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"lukechampine.com/walrus"
+)
+
+// qrEncode reads a JSON signing request (or, if sigs is set, a signing
+// response) from filename and prints its frames, one per line.
+func qrEncode(filename string, sigs bool, size int) error {
+	js, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var frames []string
+	if sigs {
+		var sr walrus.SigningResponse
+		if err := json.Unmarshal(js, &sr); err != nil {
+			return err
+		}
+		frames = sr.Frames(size)
+	} else {
+		var sr walrus.SigningRequest
+		if err := json.Unmarshal(js, &sr); err != nil {
+			return err
+		}
+		frames = sr.Frames(size)
+	}
+	for _, f := range frames {
+		fmt.Println(f)
+	}
+	return nil
+}
+
+// qrDecode reads frames from r, one per line, and prints the decoded signing
+// request or response as JSON.
+func qrDecode(r io.Reader) error {
+	var d walrus.FrameDecoder
+	s := bufio.NewScanner(r)
+	for !d.Complete() && s.Scan() {
+		if _, err := d.Add(s.Text()); err != nil {
+			return err
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	} else if !d.Complete() {
+		have, total := d.Progress()
+		return fmt.Errorf("only %v of %v frames received", have, total)
+	}
+
+	var v interface{}
+	var err error
+	switch d.Type() {
+	case walrus.FrameTypeSigningRequest:
+		v, err = walrus.DecodeSigningRequest(&d)
+	case walrus.FrameTypeSigningResponse:
+		v, err = walrus.DecodeSigningResponse(&d)
+	default:
+		err = errors.New("unrecognized frame type " + d.Type())
+	}
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
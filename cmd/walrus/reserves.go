@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"lukechampine.com/us/wallet"
+	"lukechampine.com/walrus"
+)
+
+// seedEnvVar is the environment variable from which the reserves create
+// command reads the wallet's seed phrase.
+const seedEnvVar = "WALRUS_SEED"
+
+// reservesOptions are the flags of the reserves create command.
+type reservesOptions struct {
+	API     string
+	APIKey  string
+	Sign    bool
+	Message string
+}
+
+// readSeed reads the wallet's seed phrase from seedEnvVar, or, if it is unset,
+// from the first line of stdin.
+func readSeed() (wallet.Seed, error) {
+	phrase := os.Getenv(seedEnvVar)
+	if phrase == "" {
+		fmt.Fprint(os.Stderr, "Seed: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return wallet.Seed{}, fmt.Errorf("couldn't read seed: %w", err)
+		}
+		phrase = strings.TrimSpace(line)
+	}
+	return wallet.SeedFromPhrase(phrase)
+}
+
+// createReserves prints a proof of reserves for the walrus server at
+// opts.API, signing it with the wallet's seed if opts.Sign is set.
+func createReserves(opts reservesOptions) error {
+	var copts []walrus.ClientOption
+	if opts.APIKey != "" {
+		copts = append(copts, walrus.WithAPIKey(opts.APIKey))
+	}
+	a, err := walrus.NewClient(opts.API, copts...).Reserves(opts.Message)
+	if err != nil {
+		return err
+	}
+	if opts.Sign {
+		seed, err := readSeed()
+		if err != nil {
+			return err
+		} else if err := a.Sign(walrus.SeedSigningKey(seed)); err != nil {
+			return err
+		} else if err := walrus.VerifyReserves(a); err != nil {
+			return fmt.Errorf("signed attestation is invalid (wrong seed?): %w", err)
+		}
+	}
+	js, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(append(js, '\n'))
+	log.Printf("Attested to %v addresses holding %v at height %v", len(a.Entries), a.Total.HumanString(), a.Height)
+	return nil
+}
+
+// verifyReserves checks the proof of reserves in filename.
+func verifyReserves(filename string) error {
+	js, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var a walrus.ReservesAttestation
+	if err := json.Unmarshal(js, &a); err != nil {
+		return fmt.Errorf("couldn't parse attestation: %w", err)
+	} else if len(a.Entries) == 0 {
+		return errors.New("attestation contains no addresses")
+	} else if err := walrus.VerifyReserves(a); err != nil {
+		return err
+	}
+	fmt.Printf("Valid proof of reserves for challenge %q\n", a.Message)
+	fmt.Printf("%v addresses holding %v at height %v (block %v)\n", len(a.Entries), a.Total.HumanString(), a.Height, a.BlockID)
+	fmt.Printf("Merkle root: %v\n", a.MerkleRoot)
+	fmt.Println("Balances have not been checked against the blockchain.")
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lukechampine.com/us/wallet"
+	"lukechampine.com/walrus"
+	"lukechampine.com/walrus/walrustest"
+)
+
+// startSandbox serves the walrus API backed by a simulated blockchain and an
+// in-memory wallet. Only the -dir, -http, -auth-file, and -tls flags apply.
+func startSandbox(cfg config) error {
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return errors.New("-tls-cert and -tls-key must be used together")
+	} else if cfg.TLSClientCA != "" && cfg.TLSCert == "" {
+		return errors.New("-tls-client-ca requires -tls-cert and -tls-key")
+	}
+	srv := &http.Server{Addr: cfg.APIAddr}
+	var err error
+	if cfg.TLSClientCA != "" {
+		if srv.TLSConfig, err = walrus.LoadServerTLSConfig(cfg.TLSClientCA); err != nil {
+			return fmt.Errorf("couldn't load client CA: %v", err)
+		}
+	}
+	var creds walrus.Credentials
+	if cfg.AuthFile != "" {
+		if creds, err = loadCredentials(cfg.AuthFile); err != nil {
+			return fmt.Errorf("couldn't load credentials: %v", err)
+		}
+	}
+
+	// the simulated chain does not survive a restart, so neither may the
+	// tracker's database
+	dbPath := filepath.Join(cfg.Dir, "sandbox.db")
+	if err := os.Remove(dbPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	t, err := walrus.NewTracker(w, dbPath)
+	if err != nil {
+		return err
+	}
+	c := walrustest.NewChain()
+	// the tracker must be subscribed after the wallet
+	c.Subscribe(w.ConsensusSetSubscriber(store))
+	c.Subscribe(t)
+	_, statementKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	opts := []walrus.ServerOption{
+		walrus.WithNetwork("sandbox"),
+		walrus.WithTracker(t),
+		walrus.WithStatementKey(statementKey),
+		walrus.WithKeySource(t),
+		walrus.WithCredentials(creds),
+		walrus.WithSandbox(c),
+	}
+	if cfg.WSOrigins != "" {
+		opts = append(opts, walrus.WithAllowedOrigins(strings.Split(cfg.WSOrigins, ",")...))
+	}
+	srv.Handler = walrus.NewServer(w, c, c, opts...)
+
+	l, err := walrus.Listen(cfg.APIAddr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Listening on %v (sandbox)...", cfg.APIAddr)
+	if cfg.TLSCert != "" {
+		return srv.ServeTLS(l, cfg.TLSCert, cfg.TLSKey)
+	}
+	return srv.Serve(l)
+}
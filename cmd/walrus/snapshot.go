@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"lukechampine.com/walrus"
+)
+
+// snapshotExport writes a snapshot of the databases in dir to filename.
+func snapshotExport(dir, filename string) error {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	m, err := walrus.WriteSnapshot(io.MultiWriter(f, h), dir)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		os.Remove(filename)
+		return err
+	}
+	log.Printf("Wrote snapshot at height %v to %v", m.Height, filename)
+	log.Printf("SHA-256: %x", h.Sum(nil))
+	return nil
+}
+
+// snapshotImport restores the snapshot in filename into dir. If checksum is
+// non-empty, the snapshot must have that SHA-256 hash.
+func snapshotImport(dir, filename, checksum string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if checksum != "" {
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		} else if hex.EncodeToString(h.Sum(nil)) != strings.ToLower(checksum) {
+			return errors.New("snapshot does not match the expected SHA-256 hash")
+		} else if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	m, err := walrus.RestoreSnapshot(f, dir)
+	if err != nil {
+		return err
+	}
+	log.Printf("Restored snapshot at height %v (created %v) into %v", m.Height, m.Created.Format("2006-01-02 15:04:05"), dir)
+	return nil
+}
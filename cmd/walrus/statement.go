@@ -0,0 +1,28 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+// loadStatementKey loads the key used to sign statements from filename,
+// generating and saving a new key if the file does not exist.
+func loadStatementKey(filename string) (ed25519.PrivateKey, error) {
+	seed, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		seed = make([]byte, ed25519.SeedSize)
+		if _, err := rand.Read(seed); err != nil {
+			return nil, err
+		} else if err := ioutil.WriteFile(filename, seed, 0600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else if len(seed) != ed25519.SeedSize {
+		return nil, errors.New("statement key file is corrupt")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+	"lukechampine.com/walrus"
+	"lukechampine.com/walrus/api"
+)
+
+// ANSI escape sequences used to draw the dashboard.
+const (
+	ansiAltScreen  = "\x1b[?1049h"
+	ansiMainScreen = "\x1b[?1049l"
+	ansiClear      = "\x1b[H\x1b[2J"
+	ansiBold       = "\x1b[1m"
+	ansiReset      = "\x1b[0m"
+)
+
+// maxTUITransactions is the maximum value of the tui command's -txns flag; the
+// details of each transaction are fetched in a single batch.
+const maxTUITransactions = 32
+
+// tuiEventHistory is the number of recent stream events shown by the
+// dashboard.
+const tuiEventHistory = 5
+
+// tuiDebounce is how long the dashboard waits after a stream event before
+// refreshing, so that a burst of events (e.g. during a reorg) results in a
+// single refresh.
+const tuiDebounce = 250 * time.Millisecond
+
+// tuiOptions are the flags of the tui command.
+type tuiOptions struct {
+	API          string
+	APIKey       string
+	Refresh      time.Duration
+	Transactions int
+}
+
+// A dashboard is the state displayed by the tui command.
+type dashboard struct {
+	consensus    walrus.ResponseConsensus
+	ready        walrus.ResponseReady
+	balance      types.Currency
+	limboBalance types.Currency
+	txns         []walrus.ResponseTransactionsID
+	limbo        []wallet.LimboTransaction
+	fees         []walrus.ResponseFeeTier
+	updated      time.Time
+	err          error
+
+	events    []walrus.StreamEvent // oldest first
+	streamErr error
+}
+
+// fetch refreshes the dashboard's view of the server.
+func (d *dashboard) fetch(c *walrus.Client, numTxns int) {
+	d.err = nil
+	ready, err := c.Health()
+	if _, ok := err.(*walrus.APIError); ok && len(ready.Errors) > 0 {
+		// the server is reachable, but not ready, e.g. because it is still
+		// syncing
+		err = nil
+	}
+	if err != nil {
+		d.err = err
+		return
+	}
+	d.ready = ready
+
+	var txids []types.TransactionID
+	err = c.Batch().
+		Get(api.Consensus, &d.consensus).
+		Balance(false, &d.balance).
+		Balance(true, &d.limboBalance).
+		Get(api.Limbo, &d.limbo).
+		Get(api.FeeTiers, &d.fees).
+		Get(api.Transactions+"?max="+strconv.Itoa(numTxns), &txids).
+		Do()
+	if err != nil {
+		d.err = err
+		return
+	}
+	d.txns = make([]walrus.ResponseTransactionsID, len(txids))
+	if len(txids) > 0 {
+		b := c.Batch()
+		for i, txid := range txids {
+			b.Get(api.Path(api.TransactionsTxID, txid.String()), &d.txns[i])
+		}
+		if err := b.Do(); err != nil {
+			d.err = err
+			return
+		}
+	}
+	d.updated = time.Now()
+}
+
+// addEvent records a stream event, discarding the oldest if necessary.
+func (d *dashboard) addEvent(e walrus.StreamEvent) {
+	d.events = append(d.events, e)
+	if len(d.events) > tuiEventHistory {
+		d.events = d.events[len(d.events)-tuiEventHistory:]
+	}
+	d.streamErr = nil
+}
+
+// describeEvent returns a one-line summary of a stream event.
+func describeEvent(e walrus.StreamEvent) string {
+	switch e.Type {
+	case walrus.StreamBlockConnected:
+		var bc walrus.BlockConnected
+		if json.Unmarshal(e.Data, &bc) == nil {
+			return fmt.Sprintf("block %v connected", bc.Height)
+		}
+	case walrus.StreamTransactionRelevant:
+		var tr walrus.TransactionRelevant
+		if json.Unmarshal(e.Data, &tr) == nil {
+			return fmt.Sprintf("transaction %v confirmed at height %v", tr.TransactionID, tr.Height)
+		}
+	case walrus.StreamLimboAdded:
+		var la walrus.LimboAdded
+		if json.Unmarshal(e.Data, &la) == nil {
+			return fmt.Sprintf("transaction %v added to Limbo", la.TransactionID)
+		}
+	case walrus.StreamReorg:
+		var r walrus.Reorg
+		if json.Unmarshal(e.Data, &r) == nil {
+			return fmt.Sprintf("reorg: %v blocks reverted to height %v", len(r.Reverted), r.Height)
+		}
+	}
+	return e.Type
+}
+
+// render draws the dashboard.
+func (d *dashboard) render(w io.Writer, api string) {
+	var buf bytes.Buffer
+	buf.WriteString(ansiClear)
+	heading := func(s string) {
+		fmt.Fprintf(&buf, "\n%v%v%v\n", ansiBold, s, ansiReset)
+	}
+	fmt.Fprintf(&buf, "%vwalrus%v %v", ansiBold, ansiReset, api)
+	if !d.updated.IsZero() {
+		fmt.Fprintf(&buf, " (updated %v)", d.updated.Format("15:04:05"))
+	}
+	buf.WriteString("\n")
+	if d.err != nil {
+		fmt.Fprintf(&buf, "ERROR: %v\n", d.err)
+	}
+	if d.streamErr != nil {
+		fmt.Fprintf(&buf, "Event stream disconnected: %v\n", d.streamErr)
+	}
+
+	heading("Sync")
+	status := "synced"
+	if !d.ready.Ready {
+		status = fmt.Sprintf("syncing, ~%v blocks behind", d.ready.BlocksBehind)
+	}
+	fmt.Fprintf(&buf, "Height %v on %v (%v)\n", d.consensus.Height, d.consensus.Network, status)
+	for _, e := range d.ready.Errors {
+		fmt.Fprintf(&buf, "  %v\n", e)
+	}
+
+	heading("Balance")
+	fmt.Fprintf(&buf, "Confirmed: %v\n", d.balance.HumanString())
+	fmt.Fprintf(&buf, "Limbo:     %v\n", d.limboBalance.HumanString())
+
+	heading(fmt.Sprintf("Recent Transactions (%v)", len(d.txns)))
+	for _, txn := range d.txns {
+		fmt.Fprintf(&buf, "%v  %v  +%v  -%v\n", txn.Timestamp.Local().Format("2006-01-02 15:04"), txn.Transaction.ID(), txn.Inflow.HumanString(), txn.Outflow.HumanString())
+	}
+
+	heading(fmt.Sprintf("Limbo (%v)", len(d.limbo)))
+	for _, txn := range d.limbo {
+		fmt.Fprintf(&buf, "%v  %v (for %v)\n", txn.ID(), txn.LimboSince.Local().Format("2006-01-02 15:04"), time.Since(txn.LimboSince).Round(time.Minute))
+	}
+
+	heading("Fee Market")
+	for _, t := range d.fees {
+		eta := "may not confirm"
+		if t.ConfirmationBlocks > 0 {
+			eta = fmt.Sprintf("~%v blocks", t.ConfirmationBlocks)
+		}
+		fmt.Fprintf(&buf, "%-10v %v/byte (%v)\n", t.Tier, t.FeePerByte.HumanString(), eta)
+	}
+
+	heading("Events")
+	for _, e := range d.events {
+		fmt.Fprintf(&buf, "%v  %v\n", e.Timestamp.Local().Format("15:04:05"), describeEvent(e))
+	}
+	buf.WriteString("\nPress Ctrl-C to exit.\n")
+	w.Write(buf.Bytes())
+}
+
+// runTUI displays a dashboard of the walrus server at opts.API until
+// interrupted. The dashboard is refreshed whenever the server emits a stream
+// event, and every opts.Refresh, since Limbo and fees change independently of
+// the blockchain.
+func runTUI(opts tuiOptions) error {
+	var copts []walrus.ClientOption
+	if opts.APIKey != "" {
+		copts = append(copts, walrus.WithAPIKey(opts.APIKey))
+	}
+	c := walrus.NewClient(opts.API, copts...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	streamErrs := make(chan error, 1)
+	events := c.SubscribeEvents(ctx, func(err error) {
+		select {
+		case streamErrs <- err:
+		default:
+		}
+	})
+
+	os.Stdout.WriteString(ansiAltScreen)
+	defer os.Stdout.WriteString(ansiMainScreen)
+	var d dashboard
+	d.fetch(c, opts.Transactions)
+	d.render(os.Stdout, opts.API)
+
+	ticker := time.NewTicker(opts.Refresh)
+	defer ticker.Stop()
+	var debounce <-chan time.Time
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			d.addEvent(e)
+			d.render(os.Stdout, opts.API)
+			if debounce == nil {
+				debounce = time.After(tuiDebounce)
+			}
+		case err := <-streamErrs:
+			d.streamErr = err
+			d.render(os.Stdout, opts.API)
+		case <-debounce:
+			debounce = nil
+			d.fetch(c, opts.Transactions)
+			d.render(os.Stdout, opts.API)
+		case <-ticker.C:
+			d.fetch(c, opts.Transactions)
+			d.render(os.Stdout, opts.API)
+		case <-interrupt:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"lukechampine.com/walrus"
+)
+
+func TestDashboardEvents(t *testing.T) {
+	var d dashboard
+	d.streamErr = errors.New("disconnected")
+	for i := 0; i < tuiEventHistory+2; i++ {
+		data, _ := json.Marshal(walrus.BlockConnected{Height: 100})
+		d.addEvent(walrus.StreamEvent{Type: walrus.StreamBlockConnected, Timestamp: time.Now(), Data: data})
+	}
+	if len(d.events) != tuiEventHistory {
+		t.Fatalf("expected %v events, got %v", tuiEventHistory, len(d.events))
+	} else if d.streamErr != nil {
+		t.Fatal("receiving an event should clear the stream error")
+	}
+
+	if s := describeEvent(d.events[0]); s != "block 100 connected" {
+		t.Fatal("wrong description:", s)
+	} else if s := describeEvent(walrus.StreamEvent{Type: "unknown"}); s != "unknown" {
+		t.Fatal("unknown events should be described by their type, got", s)
+	}
+
+	var buf bytes.Buffer
+	d.err = errors.New("server unreachable")
+	d.render(&buf, "localhost:9380")
+	out := buf.String()
+	for _, s := range []string{"localhost:9380", "ERROR: server unreachable", "Balance", "Fee Market", "block 100 connected"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("dashboard is missing %q", s)
+		}
+	}
+}
+
+func TestDashboardFetchError(t *testing.T) {
+	srv := httptest.NewServer(nil)
+	c := walrus.NewClient(srv.URL)
+	srv.Close()
+
+	var d dashboard
+	d.fetch(c, maxTUITransactions)
+	if d.err == nil {
+		t.Fatal("expected fetch from a closed server to fail")
+	} else if !d.updated.IsZero() {
+		t.Fatal("failed fetch should not update the timestamp")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/walrus"
+)
+
+// parseSiacoins parses a decimal number of siacoins, e.g. "0.5".
+func parseSiacoins(s string) (types.Currency, bool) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || r.Sign() < 0 {
+		return types.Currency{}, false
+	}
+	r.Mul(r, new(big.Rat).SetInt(types.SiacoinPrecision.Big()))
+	return types.NewCurrency(new(big.Int).Quo(r.Num(), r.Denom())), true
+}
+
+// parseVaultPolicy parses the -vault-* flags. threshold is a decimal number of
+// siacoins, and recoveryKey is a hex-encoded ed25519 public key.
+func parseVaultPolicy(threshold string, delay time.Duration, recoveryKey string) (walrus.VaultPolicy, error) {
+	value, ok := parseSiacoins(threshold)
+	if !ok {
+		return walrus.VaultPolicy{}, errors.New("invalid -vault-threshold: must be a non-negative number of siacoins")
+	}
+	key, err := hex.DecodeString(recoveryKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return walrus.VaultPolicy{}, errors.New("invalid -vault-recovery-key: must be a hex-encoded ed25519 public key")
+	}
+	return walrus.VaultPolicy{
+		Threshold:   value,
+		Delay:       delay,
+		RecoveryKey: key,
+	}, nil
+}
+
+// parseDustPolicy parses the -dust-* flags. threshold is a decimal number of
+// siacoins, and maxFee is a number of hastings per byte, or empty for no
+// limit.
+func parseDustPolicy(threshold string, maxInputs int, maxFee string) (walrus.DustPolicy, error) {
+	value, ok := parseSiacoins(threshold)
+	if !ok || value.IsZero() {
+		return walrus.DustPolicy{}, errors.New("invalid -dust-threshold: must be a positive number of siacoins")
+	} else if maxInputs <= 0 {
+		return walrus.DustPolicy{}, errors.New("invalid -dust-max-inputs: must be positive")
+	}
+	p := walrus.DustPolicy{
+		Threshold: value,
+		MaxInputs: maxInputs,
+	}
+	if maxFee != "" {
+		fee, err := parseHastings(maxFee)
+		if err != nil {
+			return walrus.DustPolicy{}, fmt.Errorf("invalid -dust-max-fee: %v", err)
+		}
+		p.MaxFeePerByte = fee
+	}
+	return p, nil
+}
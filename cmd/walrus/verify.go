@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"lukechampine.com/us/wallet"
+	"lukechampine.com/walrus"
+)
+
+// walletRebuilder rebuilds the wallet's index by resetting its store and
+// rescanning the blockchain, without restarting walrus.
+type walletRebuilder struct {
+	cs    modules.ConsensusSet
+	sub   modules.ConsensusSetSubscriber
+	store *wallet.BoltDBStore
+	t     *walrus.Tracker // may be nil
+}
+
+// RebuildIndex implements walrus.IndexRebuilder.
+func (wr walletRebuilder) RebuildIndex() error {
+	// the tracker must remain subscribed after the wallet
+	if wr.t != nil {
+		wr.cs.Unsubscribe(wr.t)
+	}
+	wr.cs.Unsubscribe(wr.sub)
+	if err := wr.store.Reset(); err != nil {
+		return err
+	} else if err := wr.cs.ConsensusSetSubscribe(wr.sub, modules.ConsensusChangeBeginning, nil); err != nil {
+		return err
+	}
+	if wr.t != nil {
+		return wr.cs.ConsensusSetSubscribe(wr.t, wr.t.ConsensusChangeID(), nil)
+	}
+	return nil
+}
+
+// verifyWallet checks w against the entire blockchain, logging any
+// discrepancies, and rebuilds the wallet's index if repair is set.
+func verifyWallet(w *wallet.SeedWallet, cs modules.ConsensusSet, wr walletRebuilder, repair bool) error {
+	log.Println("Verifying wallet against the blockchain...")
+	r := walrus.VerifyWallet(w, cs, 0)
+	for _, d := range r.Discrepancies {
+		log.Printf("%v at height %v: %v", d.Type, d.BlockHeight, d.ID)
+	}
+	log.Printf("Found %v discrepancies in blocks %v through %v", len(r.Discrepancies), r.StartHeight, r.EndHeight)
+	if repair && len(r.Discrepancies) > 0 {
+		log.Println("Rebuilding wallet index...")
+		return wr.RebuildIndex()
+	}
+	return nil
+}
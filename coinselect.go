@@ -0,0 +1,278 @@
+package walrus
+
+import (
+	"crypto/rand"
+	"math"
+	"math/big"
+	"sort"
+
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+	"lukechampine.com/us/wallet"
+)
+
+// Coin selection strategies.
+const (
+	// Spend the largest outputs first, minimizing the number of inputs. This
+	// is the default.
+	SelectMinInputs = "minInputs"
+	// Spend the oldest outputs first.
+	SelectOldest = "oldest"
+	// Search for a set of outputs that pays the amount and fee exactly,
+	// without change, falling back to SelectMinInputs if there is none.
+	SelectExact = "exact"
+	// Spend outputs in random order, so that the selection reveals nothing
+	// about the wallet's other outputs.
+	SelectRandom = "random"
+)
+
+func validStrategy(strategy string) bool {
+	switch strategy {
+	case "", SelectMinInputs, SelectOldest, SelectExact, SelectRandom:
+		return true
+	}
+	return false
+}
+
+// maxExactTries bounds the search performed by SelectExact.
+const maxExactTries = 100000
+
+// txnOverhead is the approximate size of a transaction, excluding its inputs,
+// that pays an output and returns change.
+var txnOverhead = uint64(len(encoding.Marshal(types.Transaction{
+	SiacoinOutputs: []types.SiacoinOutput{
+		{Value: types.SiacoinPrecision.Mul64(1e6)},
+		{Value: types.SiacoinPrecision.Mul64(1e6)},
+	},
+	MinerFees: []types.Currency{types.SiacoinPrecision},
+})))
+
+// A coinInput is a candidate for coin selection.
+type coinInput struct {
+	wallet.ValuedInput
+	// The height at which the output became spendable. Outputs created by
+	// transactions in Limbo have the maximum height.
+	Height types.BlockHeight
+}
+
+// selectCoins selects inputs worth at least amount, plus the fee for spending
+// them, according to strategy. An empty strategy is SelectMinInputs. Like
+// wallet.FundTransaction, it returns the selected inputs, the fee, and the
+// change.
+func selectCoins(strategy string, amount, feePerByte types.Currency, candidates []coinInput) (used []wallet.ValuedInput, fee, change types.Currency, ok bool) {
+	candidates = append([]coinInput(nil), candidates...)
+	switch strategy {
+	case SelectOldest:
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Height < candidates[j].Height
+		})
+		return accumulateCoins(amount, feePerByte, valuedInputs(candidates))
+	case SelectRandom:
+		for i := len(candidates) - 1; i > 0; i-- {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+			if err != nil {
+				panic(err)
+			}
+			j := int(n.Int64())
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		}
+		return accumulateCoins(amount, feePerByte, valuedInputs(candidates))
+	case SelectExact:
+		if used, fee, ok := selectExact(amount, feePerByte, valuedInputs(candidates)); ok {
+			return used, fee, types.ZeroCurrency, true
+		}
+	}
+	return wallet.FundTransaction(amount, feePerByte, valuedInputs(candidates))
+}
+
+func valuedInputs(candidates []coinInput) []wallet.ValuedInput {
+	inputs := make([]wallet.ValuedInput, len(candidates))
+	for i, c := range candidates {
+		inputs[i] = c.ValuedInput
+	}
+	return inputs
+}
+
+// accumulateCoins selects inputs in order until they are worth at least
+// amount, plus the fee for spending them. Inputs worth less than the fee for
+// spending them are skipped.
+func accumulateCoins(amount, feePerByte types.Currency, inputs []wallet.ValuedInput) (used []wallet.ValuedInput, fee, change types.Currency, ok bool) {
+	if amount.IsZero() {
+		return nil, types.ZeroCurrency, types.ZeroCurrency, true
+	}
+	total := types.ZeroCurrency
+	fee = feePerByte.Mul64(txnOverhead)
+	for _, in := range inputs {
+		inFee := inputFee(in.SiacoinInput, feePerByte)
+		if in.Value.Cmp(inFee) <= 0 {
+			continue
+		}
+		used = append(used, in)
+		total = total.Add(in.Value)
+		fee = fee.Add(inFee)
+		if total.Cmp(amount.Add(fee)) >= 0 {
+			return used, fee, total.Sub(amount).Sub(fee), true
+		}
+	}
+	return nil, types.ZeroCurrency, types.ZeroCurrency, false
+}
+
+// selectExact performs a branch-and-bound search for a set of inputs that is
+// worth at least amount, plus the fee for spending them, but exceeds it by no
+// more than the cost of creating and later spending a change output. The
+// excess is added to the fee. It returns false if no such set is found within
+// maxExactTries steps.
+func selectExact(amount, feePerByte types.Currency, inputs []wallet.ValuedInput) (used []wallet.ValuedInput, fee types.Currency, ok bool) {
+	if amount.IsZero() {
+		return nil, types.ZeroCurrency, true
+	}
+	// consider inputs by their value less the fee for spending them, largest
+	// first, so that the search finds small sets early
+	type candidate struct {
+		in  wallet.ValuedInput
+		eff types.Currency
+	}
+	var cs []candidate
+	for _, in := range inputs {
+		if inFee := inputFee(in.SiacoinInput, feePerByte); in.Value.Cmp(inFee) > 0 {
+			cs = append(cs, candidate{in, in.Value.Sub(inFee)})
+		}
+	}
+	if len(cs) == 0 {
+		return nil, types.ZeroCurrency, false
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		return cs[i].eff.Cmp(cs[j].eff) > 0
+	})
+	// remaining[i] is the total value of cs[i:]
+	remaining := make([]types.Currency, len(cs)+1)
+	remaining[len(cs)] = types.ZeroCurrency
+	for i := len(cs) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1].Add(cs[i].eff)
+	}
+	changeCost := feePerByte.Mul64(uint64(len(encoding.Marshal(types.SiacoinOutput{Value: types.SiacoinPrecision.Mul64(1e6)})))).
+		Add(inputFee(cs[0].in.SiacoinInput, feePerByte))
+	target := amount.Add(feePerByte.Mul64(txnOverhead))
+	limit := target.Add(changeCost)
+
+	var selected []int
+	tries := 0
+	var search func(i int, total types.Currency) bool
+	search = func(i int, total types.Currency) bool {
+		if tries++; tries > maxExactTries {
+			return false
+		} else if total.Cmp(target) >= 0 {
+			// adding more inputs would only increase the excess
+			return total.Cmp(limit) <= 0
+		} else if i == len(cs) || total.Add(remaining[i]).Cmp(target) < 0 {
+			return false
+		}
+		selected = append(selected, i)
+		if search(i+1, total.Add(cs[i].eff)) {
+			return true
+		}
+		selected = selected[:len(selected)-1]
+		return search(i+1, total)
+	}
+	if !search(0, types.ZeroCurrency) {
+		return nil, types.ZeroCurrency, false
+	}
+	total := types.ZeroCurrency
+	for _, i := range selected {
+		used = append(used, cs[i].in)
+		total = total.Add(cs[i].in.Value)
+	}
+	return used, total.Sub(amount), true
+}
+
+// recordOutputHeights records the height at which each wallet output created
+// by cc became spendable. The applied blocks of cc begin at the specified
+// height.
+func (t *Tracker) recordOutputHeights(tx *bolt.Tx, cc modules.ConsensusChange, height types.BlockHeight) error {
+	if len(cc.AppliedBlocks) == 0 {
+		return nil
+	}
+	created := make(map[types.SiacoinOutputID]types.BlockHeight)
+	for i, b := range cc.AppliedBlocks {
+		for _, txn := range b.Transactions {
+			for j := range txn.SiacoinOutputs {
+				created[txn.SiacoinOutputID(uint64(j))] = height + types.BlockHeight(i)
+			}
+		}
+	}
+	tip := height + types.BlockHeight(len(cc.AppliedBlocks)-1)
+	b := tx.Bucket(bucketOutputHeights)
+	for _, diff := range cc.SiacoinOutputDiffs {
+		if diff.Direction != modules.DiffApply || !t.w.OwnsAddress(diff.SiacoinOutput.UnlockHash) {
+			continue
+		}
+		h, ok := created[diff.ID]
+		if !ok {
+			if b.Get(diff.ID[:]) != nil {
+				// the output's spend was reverted
+				continue
+			}
+			// delayed outputs, e.g. block rewards, become spendable when
+			// they mature
+			h = tip
+		}
+		if err := putJSON(b, diff.ID[:], h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// outputHeights returns the height at which each of outputs became
+// spendable, or zero if it is unknown.
+func (t *Tracker) outputHeights(outputs []wallet.UnspentOutput) []types.BlockHeight {
+	heights := make([]types.BlockHeight, len(outputs))
+	t.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketOutputHeights)
+		for i, o := range outputs {
+			getJSON(b, o.ID[:], &heights[i])
+		}
+		return nil
+	})
+	return heights
+}
+
+// coinInputs returns the candidates for coin selection among utxos. Outputs
+// whose addresses are not in the wallet are skipped. If t is nil, the heights
+// of confirmed outputs are unknown.
+func coinInputs(t *Tracker, w *wallet.SeedWallet, utxos []wallet.UnspentOutput) []coinInput {
+	inLimbo := make(map[types.SiacoinOutputID]bool)
+	for _, txn := range w.LimboTransactions() {
+		for i := range txn.SiacoinOutputs {
+			inLimbo[txn.SiacoinOutputID(uint64(i))] = true
+		}
+	}
+	heights := make([]types.BlockHeight, len(utxos))
+	if t != nil {
+		heights = t.outputHeights(utxos)
+	}
+	var cs []coinInput
+	for i, o := range utxos {
+		info, ok := w.AddressInfo(o.UnlockHash)
+		if !ok {
+			continue
+		}
+		c := coinInput{
+			ValuedInput: wallet.ValuedInput{
+				SiacoinInput: types.SiacoinInput{
+					ParentID:         o.ID,
+					UnlockConditions: info.UnlockConditions,
+				},
+				Value: o.Value,
+			},
+			Height: heights[i],
+		}
+		if inLimbo[o.ID] {
+			c.Height = math.MaxUint64
+		}
+		cs = append(cs, c)
+	}
+	return cs
+}
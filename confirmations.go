@@ -0,0 +1,272 @@
+package walrus
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"sort"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+// maxConfirmationSamples is the number of confirmation samples retained; older
+// samples are discarded.
+const maxConfirmationSamples = 10000
+
+// A pendingBroadcast is a broadcast transaction set that has not yet
+// confirmed. It is keyed by the ID of the last transaction in the set.
+type pendingBroadcast struct {
+	FeePerByte types.Currency    `json:"feePerByte"`
+	Broadcast  time.Time         `json:"broadcast"`
+	Height     types.BlockHeight `json:"height"`
+}
+
+// A ConfirmationSample records how long one of the wallet's broadcasts took
+// to confirm.
+type ConfirmationSample struct {
+	// The ID of the last transaction in the broadcast set.
+	TransactionID types.TransactionID `json:"transactionID"`
+	// The total fees of the set divided by its total size.
+	FeePerByte types.Currency `json:"feePerByte"`
+	Broadcast  time.Time      `json:"broadcast"`
+	// The timestamp of the confirming block.
+	Confirmed time.Time `json:"confirmed"`
+	// The number of blocks mined up to and including the confirming block,
+	// i.e. 1 if the set confirmed in the next block.
+	Blocks uint64 `json:"blocks"`
+}
+
+// Latency returns the time between the broadcast and the confirmation. Since
+// block timestamps are imprecise, it is never negative.
+func (cs ConfirmationSample) Latency() time.Duration {
+	if d := cs.Confirmed.Sub(cs.Broadcast); d > 0 {
+		return d
+	}
+	return 0
+}
+
+func sampleKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// setFeePerByte returns the total fees of txnSet divided by its total size.
+func setFeePerByte(txnSet []types.Transaction) types.Currency {
+	fees := types.ZeroCurrency
+	size := 0
+	for _, txn := range txnSet {
+		for _, fee := range txn.MinerFees {
+			fees = fees.Add(fee)
+		}
+		size += len(encoding.Marshal(txn))
+	}
+	if size == 0 {
+		return types.ZeroCurrency
+	}
+	return fees.Div64(uint64(size))
+}
+
+// recordBroadcast begins tracking the confirmation of txnSet. If the set is
+// already being tracked, e.g. because it was rebroadcast, it is left alone.
+func recordBroadcast(tx *bolt.Tx, txnSet []types.Transaction, now time.Time) error {
+	if len(txnSet) == 0 {
+		return nil
+	}
+	b := tx.Bucket(bucketPendingBroadcasts)
+	id := txnSet[len(txnSet)-1].ID()
+	if b.Get(id[:]) != nil {
+		return nil
+	}
+	var numBlocks uint64
+	getJSON(tx.Bucket(bucketMeta), keyNumBlocks, &numBlocks)
+	return putJSON(b, id[:], pendingBroadcast{
+		FeePerByte: setFeePerByte(txnSet),
+		Broadcast:  now,
+		Height:     types.BlockHeight(numBlocks),
+	})
+}
+
+// recordConfirmations records a ConfirmationSample for each pending broadcast
+// confirmed by the applied blocks of cc, which begin at the specified height.
+// Broadcasts that are no longer in Limbo without having confirmed are
+// discarded. Samples are not removed if their blocks are later reverted.
+func (t *Tracker) recordConfirmations(tx *bolt.Tx, cc modules.ConsensusChange, height types.BlockHeight) error {
+	pending := tx.Bucket(bucketPendingBroadcasts)
+	samples := tx.Bucket(bucketConfirmations)
+	for i, block := range cc.AppliedBlocks {
+		for _, txn := range block.Transactions {
+			id := txn.ID()
+			var pb pendingBroadcast
+			if !getJSON(pending, id[:], &pb) {
+				continue
+			}
+			blocks := uint64(1)
+			if h := height + types.BlockHeight(i); h >= pb.Height {
+				blocks = uint64(h-pb.Height) + 1
+			}
+			seq, err := samples.NextSequence()
+			if err != nil {
+				return err
+			}
+			err = putJSON(samples, sampleKey(seq), ConfirmationSample{
+				TransactionID: id,
+				FeePerByte:    pb.FeePerByte,
+				Broadcast:     pb.Broadcast,
+				Confirmed:     time.Unix(int64(block.Timestamp), 0),
+				Blocks:        blocks,
+			})
+			if err != nil {
+				return err
+			} else if err := pending.Delete(id[:]); err != nil {
+				return err
+			}
+			if seq > maxConfirmationSamples {
+				if err := samples.Delete(sampleKey(seq - maxConfirmationSamples)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// the wallet has already removed any newly-confirmed transactions from
+	// Limbo, so any remaining broadcasts that left Limbo were dropped
+	inLimbo := make(map[types.TransactionID]bool)
+	for _, txn := range t.w.LimboTransactions() {
+		inLimbo[txn.ID()] = true
+	}
+	var stale [][]byte
+	err := pending.ForEach(func(k, _ []byte) error {
+		var id types.TransactionID
+		copy(id[:], k)
+		if !inLimbo[id] {
+			stale = append(stale, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range stale {
+		if err := pending.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfirmationSamples returns the recorded confirmation samples of broadcasts
+// made at or after since, oldest first.
+func (t *Tracker) ConfirmationSamples(since time.Time) (samples []ConfirmationSample) {
+	t.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketConfirmations).ForEach(func(_, v []byte) error {
+			var cs ConfirmationSample
+			if err := json.Unmarshal(v, &cs); err != nil {
+				return err
+			} else if !cs.Broadcast.Before(since) {
+				samples = append(samples, cs)
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// PendingBroadcasts returns the number of broadcasts that have not yet
+// confirmed.
+func (t *Tracker) PendingBroadcasts() (n int) {
+	t.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPendingBroadcasts).ForEach(func(_, _ []byte) error {
+			n++
+			return nil
+		})
+	})
+	return
+}
+
+// ConfirmationStats summarizes a group of confirmation samples.
+type ConfirmationStats struct {
+	Count         int            `json:"count"`
+	MinFee        types.Currency `json:"minFee"`
+	MedianFee     types.Currency `json:"medianFee"`
+	MaxFee        types.Currency `json:"maxFee"`
+	MedianBlocks  uint64         `json:"medianBlocks"`
+	P90Blocks     uint64         `json:"p90Blocks"`
+	MedianSeconds float64        `json:"medianSeconds"`
+	P90Seconds    float64        `json:"p90Seconds"`
+}
+
+// percentile returns the index of the pth percentile of n sorted values.
+func percentile(n int, p int) int {
+	return (n - 1) * p / 100
+}
+
+// summarizeConfirmations computes the statistics of samples, which must be
+// non-empty.
+func summarizeConfirmations(samples []ConfirmationSample) ConfirmationStats {
+	n := len(samples)
+	fees := make([]types.Currency, n)
+	blocks := make([]uint64, n)
+	latencies := make([]time.Duration, n)
+	for i, cs := range samples {
+		fees[i] = cs.FeePerByte
+		blocks[i] = cs.Blocks
+		latencies[i] = cs.Latency()
+	}
+	sort.Slice(fees, func(i, j int) bool { return fees[i].Cmp(fees[j]) < 0 })
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return ConfirmationStats{
+		Count:         n,
+		MinFee:        fees[0],
+		MedianFee:     fees[percentile(n, 50)],
+		MaxFee:        fees[n-1],
+		MedianBlocks:  blocks[percentile(n, 50)],
+		P90Blocks:     blocks[percentile(n, 90)],
+		MedianSeconds: latencies[percentile(n, 50)].Seconds(),
+		P90Seconds:    latencies[percentile(n, 90)].Seconds(),
+	}
+}
+
+// feeBand returns the lower bound of the band containing feePerByte: the
+// largest power of two not exceeding it, or zero.
+func feeBand(feePerByte types.Currency) types.Currency {
+	if feePerByte.IsZero() {
+		return types.ZeroCurrency
+	}
+	return types.NewCurrency(new(big.Int).Lsh(big.NewInt(1), uint(feePerByte.Big().BitLen()-1)))
+}
+
+// confirmationBuckets groups samples by the interval in which they were
+// broadcast, and by fee band, and summarizes each group.
+func confirmationBuckets(samples []ConfirmationSample, interval time.Duration) (buckets []ResponseConfirmationBucket, bands []ResponseFeeBand) {
+	byStart := make(map[time.Time][]ConfirmationSample)
+	byBand := make(map[string][]ConfirmationSample)
+	bandMin := make(map[string]types.Currency)
+	for _, cs := range samples {
+		start := cs.Broadcast.UTC().Truncate(interval)
+		byStart[start] = append(byStart[start], cs)
+		band := feeBand(cs.FeePerByte)
+		byBand[band.String()] = append(byBand[band.String()], cs)
+		bandMin[band.String()] = band
+	}
+	for start, group := range byStart {
+		buckets = append(buckets, ResponseConfirmationBucket{
+			Start:             start,
+			ConfirmationStats: summarizeConfirmations(group),
+		})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start.Before(buckets[j].Start) })
+	for key, group := range byBand {
+		bands = append(bands, ResponseFeeBand{
+			FeeBand:           bandMin[key],
+			ConfirmationStats: summarizeConfirmations(group),
+		})
+	}
+	sort.Slice(bands, func(i, j int) bool { return bands[i].FeeBand.Cmp(bands[j].FeeBand) < 0 })
+	return
+}
@@ -0,0 +1,299 @@
+package walrus
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+	"lukechampine.com/us/wallet"
+)
+
+var keyConsolidationReady = []byte("consolidationReady")
+
+// A ConsolidationPolicy specifies when and where matured block rewards should
+// be consolidated.
+type ConsolidationPolicy struct {
+	// The number of matured, unspent block rewards that triggers a
+	// consolidation.
+	Threshold int `json:"threshold"`
+	// The address that consolidated rewards are sent to.
+	Destination types.UnlockHash `json:"destination"`
+}
+
+// ConsolidationReady is the data for the EventConsolidationReady event.
+type ConsolidationReady struct {
+	Outputs int            `json:"outputs"`
+	Value   types.Currency `json:"value"`
+}
+
+// SetConsolidationPolicy configures the Tracker to emit an
+// EventConsolidationReady event whenever the number of matured block rewards
+// reaches the policy's threshold. It must be called before the Tracker is
+// subscribed to the consensus set.
+func (t *Tracker) SetConsolidationPolicy(p ConsolidationPolicy) {
+	t.consolidation = &p
+}
+
+// ConsolidationPolicy returns the Tracker's consolidation policy, if any.
+func (t *Tracker) ConsolidationPolicy() (ConsolidationPolicy, bool) {
+	if t.consolidation == nil {
+		return ConsolidationPolicy{}, false
+	}
+	return *t.consolidation, true
+}
+
+// maturedRewards returns the block reward outputs in w that are spendable and
+// not already spent by a transaction in Limbo.
+func maturedRewards(w *wallet.SeedWallet) []wallet.UnspentOutput {
+	isReward := make(map[types.SiacoinOutputID]bool)
+	for _, br := range w.BlockRewards(-1) {
+		isReward[br.ID] = true
+	}
+	var outputs []wallet.UnspentOutput
+	for _, o := range w.UnspentOutputs(true) {
+		if isReward[o.ID] {
+			outputs = append(outputs, o)
+		}
+	}
+	return outputs
+}
+
+// checkConsolidation emits an EventConsolidationReady event when the number of
+// matured rewards crosses the consolidation threshold.
+func (t *Tracker) checkConsolidation(tx *bolt.Tx, height types.BlockHeight, timestamp time.Time) error {
+	meta := tx.Bucket(bucketMeta)
+	outputs := maturedRewards(t.w)
+	if len(outputs) < t.consolidation.Threshold {
+		return meta.Delete(keyConsolidationReady)
+	} else if meta.Get(keyConsolidationReady) != nil {
+		return nil // already emitted
+	}
+	value := types.ZeroCurrency
+	for _, o := range outputs {
+		value = value.Add(o.Value)
+	}
+	err := addEvent(tx, EventConsolidationReady, height, timestamp, ConsolidationReady{
+		Outputs: len(outputs),
+		Value:   value,
+	})
+	if err != nil {
+		return err
+	}
+	return meta.Put(keyConsolidationReady, []byte{1})
+}
+
+// draftConsolidation returns an unsigned transaction that sends outputs to
+// dest, along with the key index of each input.
+func draftConsolidation(w *wallet.SeedWallet, outputs []wallet.UnspentOutput, dest types.UnlockHash, feePerByte types.Currency) (txn types.Transaction, keyIndices []uint64, ok bool) {
+	return draftSweep(w, outputs, []SplitDestination{{Address: dest, Percent: 100}}, feePerByte)
+}
+
+// draftSweep returns an unsigned transaction that spends outputs in their
+// entirety, dividing their value, less the transaction fee, among dests. The
+// percentages of dests must sum to 100. It also returns the key index of each
+// input.
+func draftSweep(w *wallet.SeedWallet, outputs []wallet.UnspentOutput, dests []SplitDestination, feePerByte types.Currency) (txn types.Transaction, keyIndices []uint64, ok bool) {
+	value := types.ZeroCurrency
+	for _, o := range outputs {
+		info, ok := w.AddressInfo(o.UnlockHash)
+		if !ok {
+			continue
+		}
+		txn.SiacoinInputs = append(txn.SiacoinInputs, types.SiacoinInput{
+			ParentID:         o.ID,
+			UnlockConditions: info.UnlockConditions,
+		})
+		keyIndices = append(keyIndices, info.KeyIndex)
+		value = value.Add(o.Value)
+	}
+	// estimate the size of the signed transaction
+	sized := txn
+	sized.SiacoinOutputs = splitOutputs(dests, value)
+	sized.MinerFees = []types.Currency{value}
+	for _, in := range txn.SiacoinInputs {
+		sig := wallet.StandardTransactionSignature(crypto.Hash(in.ParentID))
+		sig.Signature = make([]byte, 64)
+		sized.TransactionSignatures = append(sized.TransactionSignatures, sig)
+	}
+	fee := feePerByte.Mul64(uint64(len(encoding.Marshal(sized))))
+	if value.Cmp(fee) <= 0 {
+		return types.Transaction{}, nil, false
+	}
+	txn.SiacoinOutputs = splitOutputs(dests, value.Sub(fee))
+	for _, o := range txn.SiacoinOutputs {
+		if o.Value.IsZero() {
+			return types.Transaction{}, nil, false
+		}
+	}
+	txn.MinerFees = []types.Currency{fee}
+	return txn, keyIndices, true
+}
+
+// selectConsolidation returns the outputs that a consolidation paying
+// feePerByte to dests should spend: the smallest outputs worth less than
+// threshold, but more than the fee for spending them, up to maxInputs (if
+// positive) and as many as fit in a single transaction. It also returns the
+// number of such outputs that were left for a later consolidation.
+func selectConsolidation(w *wallet.SeedWallet, outputs []wallet.UnspentOutput, threshold types.Currency, maxInputs int, dests []types.UnlockHash, feePerByte types.Currency) (selected []wallet.UnspentOutput, remaining int) {
+	var candidates []wallet.UnspentOutput
+	var sizes []int
+	for _, o := range outputs {
+		if o.Value.Cmp(threshold) >= 0 {
+			continue
+		}
+		info, ok := w.AddressInfo(o.UnlockHash)
+		if !ok {
+			continue
+		}
+		size := signedInputSize(types.SiacoinInput{
+			ParentID:         o.ID,
+			UnlockConditions: info.UnlockConditions,
+		})
+		if o.Value.Cmp(feePerByte.Mul64(uint64(size))) <= 0 {
+			continue
+		}
+		candidates = append(candidates, o)
+		sizes = append(sizes, size)
+	}
+	sort.Sort(outputsBySize{candidates, sizes})
+
+	// the output values and fee are bounded by the total value
+	total := types.ZeroCurrency
+	for _, o := range candidates {
+		total = total.Add(o.Value)
+	}
+	base := types.Transaction{MinerFees: []types.Currency{total}}
+	for _, addr := range dests {
+		base.SiacoinOutputs = append(base.SiacoinOutputs, types.SiacoinOutput{Value: total, UnlockHash: addr})
+	}
+	size := len(encoding.Marshal(base))
+	for i, o := range candidates {
+		if (maxInputs > 0 && len(selected) >= maxInputs) || size+sizes[i] > maxSweepSize {
+			break
+		}
+		selected = append(selected, o)
+		size += sizes[i]
+	}
+	return selected, len(candidates) - len(selected)
+}
+
+// outputsBySize sorts outputs, along with their signed input sizes, from
+// lowest to highest value.
+type outputsBySize struct {
+	outputs []wallet.UnspentOutput
+	sizes   []int
+}
+
+func (s outputsBySize) Len() int { return len(s.outputs) }
+func (s outputsBySize) Less(i, j int) bool {
+	return s.outputs[i].Value.Cmp(s.outputs[j].Value) < 0
+}
+func (s outputsBySize) Swap(i, j int) {
+	s.outputs[i], s.outputs[j] = s.outputs[j], s.outputs[i]
+	s.sizes[i], s.sizes[j] = s.sizes[j], s.sizes[i]
+}
+
+// evenSplit divides funds evenly among addrs.
+func evenSplit(addrs []types.UnlockHash) []SplitDestination {
+	dests := make([]SplitDestination, len(addrs))
+	for i, addr := range addrs {
+		dests[i] = SplitDestination{Address: addr, Percent: 100 / float64(len(addrs))}
+	}
+	return dests
+}
+
+// watchConsolidation consolidates the wallet's matured block rewards, signing
+// with the server's seed, each time a block is connected. It returns when the
+// Tracker is closed.
+func (s *server) watchConsolidation(events <-chan StreamEvent, unsubscribe func()) {
+	defer func() { unsubscribe() }()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				// we fell behind; resubscribe
+				events, unsubscribe = s.t.SubscribeStream()
+				continue
+			} else if e.Type != StreamBlockConnected {
+				continue
+			}
+		case <-s.t.closed:
+			return
+		}
+		// failed consolidations are retried when the next block is connected
+		s.consolidateRewards()
+	}
+}
+
+// consolidateRewards signs and broadcasts a transaction that sends the
+// wallet's matured block rewards to the destination of the consolidation
+// policy, if enough rewards have matured. Once broadcast, the rewards are
+// spent by a transaction in Limbo, so they are not consolidated twice.
+func (s *server) consolidateRewards() error {
+	policy, ok := s.t.ConsolidationPolicy()
+	if !ok {
+		return nil
+	}
+	outputs := maturedRewards(s.w)
+	if len(outputs) < policy.Threshold {
+		return nil
+	}
+	fee, err := s.parseFee("")
+	if err != nil {
+		return err
+	}
+	txn, _, ok := draftConsolidation(s.w, outputs, policy.Destination, fee.FeePerByte)
+	if !ok {
+		return errors.New("block rewards are worth less than the transaction fee")
+	} else if err := signWithSeed(s.w, *s.seed, &txn); err != nil {
+		return err
+	}
+	_, _, err = s.broadcast([]types.Transaction{txn})
+	return err
+}
+
+// ExecuteConsolidation drafts a consolidation as specified by rc (see
+// Client.Consolidate), signs it with s, and broadcasts it.
+func ExecuteConsolidation(c *Client, s TransactionSigner, rc RequestConsolidate) (types.Transaction, error) {
+	resp, err := c.Consolidate(rc)
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	txn := resp.Transaction
+	toSign := make([]crypto.Hash, len(txn.SiacoinInputs))
+	for i, in := range txn.SiacoinInputs {
+		toSign[i] = crypto.Hash(in.ParentID)
+	}
+	if err := s.SignTransaction(&txn, toSign); err != nil {
+		return types.Transaction{}, err
+	} else if _, err := c.Broadcast([]types.Transaction{txn}); err != nil {
+		return types.Transaction{}, err
+	}
+	return txn, nil
+}
+
+// RunConsolidation executes a consolidation as specified by rc every
+// interval, signing with s, until ctx is cancelled. Setting rc.MaxFeePerByte
+// restricts consolidation to low-fee periods. Consolidations that are
+// deferred are skipped silently; other errors are passed to onError, if
+// non-nil, and do not stop RunConsolidation.
+func RunConsolidation(ctx context.Context, c *Client, s TransactionSigner, rc RequestConsolidate, interval time.Duration, onError func(error)) error {
+	if onError == nil {
+		onError = func(error) {}
+	}
+	for {
+		if _, err := ExecuteConsolidation(c, s, rc); err != nil && !errors.Is(err, ErrConsolidationDeferred) {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
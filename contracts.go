@@ -0,0 +1,172 @@
+package walrus
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+	"lukechampine.com/us/wallet"
+)
+
+// A ContractOutcome records how a file contract relevant to the wallet was
+// resolved.
+type ContractOutcome struct {
+	ID          types.FileContractID `json:"id"`
+	Valid       bool                 `json:"valid"`
+	BlockHeight types.BlockHeight    `json:"blockHeight"`
+	Timestamp   time.Time            `json:"timestamp"`
+	// The sum of the wallet's proof outputs, valid or missed depending on the
+	// outcome.
+	Payout types.Currency `json:"payout"`
+}
+
+// ownedPayout returns the sum of the outputs in scos that are owned by the
+// wallet, and whether any such outputs exist.
+func (t *Tracker) ownedPayout(scos []types.SiacoinOutput) (types.Currency, bool) {
+	sum, owned := types.ZeroCurrency, false
+	for _, sco := range scos {
+		if t.w.OwnsAddress(sco.UnlockHash) {
+			sum = sum.Add(sco.Value)
+			owned = true
+		}
+	}
+	return sum, owned
+}
+
+// recordOutcomes records the outcome of each relevant file contract resolved
+// by the applied blocks in cc, the first of which is at the specified height.
+func (t *Tracker) recordOutcomes(tx *bolt.Tx, cc modules.ConsensusChange, height types.BlockHeight) error {
+	proven := make(map[types.FileContractID]types.BlockHeight)
+	for i, b := range cc.AppliedBlocks {
+		for _, txn := range b.Transactions {
+			for _, sp := range txn.StorageProofs {
+				proven[sp.ParentID] = height + types.BlockHeight(i)
+			}
+		}
+	}
+	timestamp := func(h types.BlockHeight) time.Time {
+		return time.Unix(int64(cc.AppliedBlocks[h-height].Timestamp), 0)
+	}
+	end := height + types.BlockHeight(len(cc.AppliedBlocks))
+
+	outcomes := tx.Bucket(bucketContractOutcomes)
+	for _, diff := range cc.FileContractDiffs {
+		if diff.Direction == modules.DiffApply {
+			// either a new contract, or a resolution being reverted
+			if err := outcomes.Delete(diff.ID[:]); err != nil {
+				return err
+			}
+			continue
+		}
+		o := ContractOutcome{ID: diff.ID}
+		var owned bool
+		if h, ok := proven[diff.ID]; ok {
+			o.Valid = true
+			o.BlockHeight = h
+			o.Payout, owned = t.ownedPayout(diff.FileContract.ValidProofOutputs)
+		} else if fc := diff.FileContract; fc.WindowEnd >= height && fc.WindowEnd < end {
+			// contracts without a proof expire at the end of their window
+			o.BlockHeight = fc.WindowEnd
+			o.Payout, owned = t.ownedPayout(fc.MissedProofOutputs)
+		} else {
+			// contract creation was reverted, or it was revised
+			continue
+		}
+		if !owned {
+			continue
+		}
+		o.Timestamp = timestamp(o.BlockHeight)
+		if err := putJSON(outcomes, diff.ID[:], o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ContractOutcomes returns the outcome of every resolved file contract with
+// outputs owned by the wallet.
+func (t *Tracker) ContractOutcomes() (outcomes []ContractOutcome) {
+	t.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketContractOutcomes).ForEach(func(_, v []byte) error {
+			var o ContractOutcome
+			if err := json.Unmarshal(v, &o); err != nil {
+				return err
+			}
+			outcomes = append(outcomes, o)
+			return nil
+		})
+	})
+	return
+}
+
+// A ContractFilter selects file contracts. Zero-valued fields match every
+// contract.
+type ContractFilter struct {
+	// The host's public key, i.e. the second public key in the contract's
+	// unlock conditions.
+	HostKey types.SiaPublicKey
+	// An address receiving one of the contract's valid or missed proof
+	// outputs.
+	PayoutAddress types.UnlockHash
+}
+
+func (f ContractFilter) isZero() bool {
+	return len(f.HostKey.Key) == 0 && f.PayoutAddress == (types.UnlockHash{})
+}
+
+// matches reports whether fc, with unlock conditions uc, is selected by f.
+// uc is supplied separately because a contract's unlock conditions are only
+// revealed by its revisions.
+func (f ContractFilter) matches(fc wallet.FileContract, uc types.UnlockConditions) bool {
+	if len(f.HostKey.Key) != 0 {
+		if len(uc.PublicKeys) < 2 {
+			return false
+		}
+		hpk := uc.PublicKeys[1]
+		if hpk.Algorithm != f.HostKey.Algorithm || !bytes.Equal(hpk.Key, f.HostKey.Key) {
+			return false
+		}
+	}
+	if f.PayoutAddress != (types.UnlockHash{}) {
+		pays := false
+		for _, scos := range [][]types.SiacoinOutput{fc.ValidProofOutputs, fc.MissedProofOutputs} {
+			for _, sco := range scos {
+				pays = pays || sco.UnlockHash == f.PayoutAddress
+			}
+		}
+		if !pays {
+			return false
+		}
+	}
+	return true
+}
+
+// parseContractFilter parses the 'host' and 'payout' query parameters.
+func parseContractFilter(q url.Values) (f ContractFilter, err error) {
+	if q.Get("host") != "" {
+		if f.HostKey, err = ParsePublicKey(q.Get("host")); err != nil {
+			return ContractFilter{}, errors.New("invalid host key: " + err.Error())
+		}
+	}
+	if q.Get("payout") != "" {
+		if err := f.PayoutAddress.LoadString(q.Get("payout")); err != nil {
+			return ContractFilter{}, errors.New("invalid payout address: " + err.Error())
+		}
+	}
+	return f, nil
+}
+
+// addContractFilter adds the query parameters corresponding to f to q.
+func addContractFilter(q url.Values, f ContractFilter) {
+	if len(f.HostKey.Key) != 0 {
+		q.Set("host", f.HostKey.String())
+	}
+	if f.PayoutAddress != (types.UnlockHash{}) {
+		q.Set("payout", f.PayoutAddress.String())
+	}
+}
@@ -0,0 +1,249 @@
+package walrus
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Cost basis policies.
+const (
+	PolicyFIFO = "fifo"
+	PolicyLIFO = "lifo"
+)
+
+// A Flow is a change in the wallet's siacoin holdings, along with the exchange
+// rate at the time it was confirmed. A Flow is either an acquisition (e.g. a
+// payment or block reward) or a disposal (e.g. a payment to another wallet,
+// including fees). A self-transfer produces a Flow only if it pays a fee, in
+// which case the Flow is marked as internal.
+type Flow struct {
+	// The transaction ID, or for block rewards and contract payouts, the
+	// output ID.
+	ID          crypto.Hash       `json:"id"`
+	BlockHeight types.BlockHeight `json:"blockHeight"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Acquired    types.Currency    `json:"acquired"`
+	Disposed    types.Currency    `json:"disposed"`
+	// The value of one siacoin when the Flow was confirmed. Zero if unknown.
+	Rate float64 `json:"rate"`
+	// Whether the Flow is the fee of an internal transaction, e.g. a
+	// consolidation or split.
+	Internal bool `json:"internal,omitempty"`
+}
+
+// A Disposal is a Flow that removed siacoins from the wallet, matched against
+// the acquisitions that funded it.
+type Disposal struct {
+	Flow
+	Proceeds  float64 `json:"proceeds"`
+	CostBasis float64 `json:"costBasis"`
+	Gain      float64 `json:"gain"`
+}
+
+func flowKey(height types.BlockHeight, id crypto.Hash) []byte {
+	key := make([]byte, 8+len(id))
+	binary.BigEndian.PutUint64(key, uint64(height))
+	copy(key[8:], id[:])
+	return key
+}
+
+func toSC(c types.Currency) float64 {
+	f, _ := new(big.Rat).SetFrac(c.Big(), types.SiacoinPrecision.Big()).Float64()
+	return f
+}
+
+// SetRateProvider configures the Tracker to record the exchange rate between
+// siacoins and the specified currency whenever siacoins enter or leave the
+// wallet. It must be called before the Tracker is subscribed to the consensus
+// set.
+func (t *Tracker) SetRateProvider(rp RateProvider, currency string) {
+	t.rates = rp
+	t.currency = currency
+}
+
+// Currency returns the currency that flows are valued in.
+func (t *Tracker) Currency() string {
+	return t.currency
+}
+
+// currentRate returns the current exchange rate, or zero if it is unknown.
+// Since historical rates are not available, the rate is only fetched once
+// the consensus set is synced.
+func (t *Tracker) currentRate(synced bool) float64 {
+	if t.rates == nil || !synced {
+		return 0
+	}
+	rate, err := t.rates.SiacoinRate(t.currency)
+	if err != nil {
+		return 0
+	}
+	return rate
+}
+
+// revertFlows deletes the flows recorded at the specified height.
+func (t *Tracker) revertFlows(tx *bolt.Tx, height types.BlockHeight) error {
+	c := tx.Bucket(bucketFlows).Cursor()
+	prefix := flowKey(height, crypto.Hash{})[:8]
+	var keys [][]byte
+	for k, _ := c.Seek(prefix); k != nil && string(k[:8]) == string(prefix); k, _ = c.Next() {
+		keys = append(keys, k)
+	}
+	for _, k := range keys {
+		if err := tx.Bucket(bucketFlows).Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyFlows records the flows resulting from the applied blocks in cc, the
+// first of which is at the specified height.
+func (t *Tracker) applyFlows(tx *bolt.Tx, cc modules.ConsensusChange, height types.BlockHeight, rate float64) error {
+	// record the value of every wallet output, so that we know how much is
+	// spent when it is used as an input
+	outputs := tx.Bucket(bucketOutputs)
+	for _, diff := range cc.SiacoinOutputDiffs {
+		if diff.Direction == modules.DiffApply && t.w.OwnsAddress(diff.SiacoinOutput.UnlockHash) {
+			if err := putJSON(outputs, diff.ID[:], diff.SiacoinOutput.Value); err != nil {
+				return err
+			}
+		}
+	}
+
+	flows := tx.Bucket(bucketFlows)
+	putFlow := func(f Flow) error {
+		return putJSON(flows, flowKey(f.BlockHeight, f.ID), f)
+	}
+	for i, b := range cc.AppliedBlocks {
+		timestamp := time.Unix(int64(b.Timestamp), 0)
+		for _, txn := range b.Transactions {
+			in, out := types.ZeroCurrency, types.ZeroCurrency
+			for _, sci := range txn.SiacoinInputs {
+				var v types.Currency
+				if getJSON(outputs, sci.ParentID[:], &v) {
+					in = in.Add(v)
+				}
+			}
+			for _, sco := range txn.SiacoinOutputs {
+				if t.w.OwnsAddress(sco.UnlockHash) {
+					out = out.Add(sco.Value)
+				}
+			}
+			f := Flow{
+				ID:          crypto.Hash(txn.ID()),
+				BlockHeight: height + types.BlockHeight(i),
+				Timestamp:   timestamp,
+				Acquired:    types.ZeroCurrency,
+				Disposed:    types.ZeroCurrency,
+				Rate:        rate,
+				Internal:    isInternal(t.w, txn),
+			}
+			switch in.Cmp(out) {
+			case 0:
+				continue
+			case -1:
+				f.Acquired = out.Sub(in)
+			case 1:
+				f.Disposed = in.Sub(out)
+			}
+			if err := putFlow(f); err != nil {
+				return err
+			}
+		}
+	}
+
+	// block rewards and contract payouts are acquired when they mature
+	matured := make(map[types.SiacoinOutputID]types.BlockHeight)
+	for _, diff := range cc.DelayedSiacoinOutputDiffs {
+		if diff.Direction == modules.DiffRevert {
+			matured[diff.ID] = diff.MaturityHeight
+		}
+	}
+	for _, diff := range cc.SiacoinOutputDiffs {
+		mh, ok := matured[diff.ID]
+		if !ok || diff.Direction != modules.DiffApply || !t.w.OwnsAddress(diff.SiacoinOutput.UnlockHash) {
+			continue
+		}
+		var timestamp time.Time
+		if mh >= height && int(mh-height) < len(cc.AppliedBlocks) {
+			timestamp = time.Unix(int64(cc.AppliedBlocks[mh-height].Timestamp), 0)
+		}
+		err := putFlow(Flow{
+			ID:          crypto.Hash(diff.ID),
+			BlockHeight: mh,
+			Timestamp:   timestamp,
+			Acquired:    diff.SiacoinOutput.Value,
+			Disposed:    types.ZeroCurrency,
+			Rate:        rate,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flows returns every flow recorded by the Tracker, ordered oldest-to-newest.
+func (t *Tracker) Flows() (flows []Flow) {
+	t.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketFlows).ForEach(func(_, v []byte) error {
+			var f Flow
+			if err := json.Unmarshal(v, &f); err != nil {
+				return err
+			}
+			flows = append(flows, f)
+			return nil
+		})
+	})
+	return
+}
+
+// RealizedGains matches each disposal in flows against prior acquisitions,
+// using the specified policy, and returns the resulting disposals. Flows must
+// be ordered oldest-to-newest. Siacoins disposed of without a matching
+// acquisition have a cost basis of zero.
+func RealizedGains(flows []Flow, policy string) []Disposal {
+	type lot struct {
+		amount types.Currency
+		rate   float64
+	}
+	var lots []lot
+	var disposals []Disposal
+	for _, f := range flows {
+		if !f.Acquired.IsZero() {
+			lots = append(lots, lot{f.Acquired, f.Rate})
+			continue
+		}
+		d := Disposal{
+			Flow:     f,
+			Proceeds: toSC(f.Disposed) * f.Rate,
+		}
+		rem := f.Disposed
+		for !rem.IsZero() && len(lots) > 0 {
+			i := 0
+			if policy == PolicyLIFO {
+				i = len(lots) - 1
+			}
+			used := lots[i].amount
+			if used.Cmp(rem) > 0 {
+				used = rem
+			}
+			d.CostBasis += toSC(used) * lots[i].rate
+			rem = rem.Sub(used)
+			lots[i].amount = lots[i].amount.Sub(used)
+			if lots[i].amount.IsZero() {
+				lots = append(lots[:i], lots[i+1:]...)
+			}
+		}
+		d.Gain = d.Proceeds - d.CostBasis
+		disposals = append(disposals, d)
+	}
+	return disposals
+}
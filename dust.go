@@ -0,0 +1,106 @@
+package walrus
+
+import (
+	"sort"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+)
+
+// DefaultDustMaxInputs is the default maximum number of dust outputs added to
+// a single transaction.
+const DefaultDustMaxInputs = 20
+
+// A DustPolicy specifies how small outputs should be consolidated
+// opportunistically. When the server builds a transaction that returns change
+// to the wallet, it also spends up to MaxInputs outputs worth less than
+// Threshold, adding their value (less the fee for spending them) to the
+// change. This keeps the wallet's UTXO set compact without dedicated
+// consolidation transactions.
+type DustPolicy struct {
+	// Outputs worth less than Threshold are considered dust.
+	Threshold types.Currency `json:"threshold"`
+	// The maximum number of dust outputs added to a single transaction.
+	MaxInputs int `json:"maxInputs"`
+	// If non-zero, dust is only added to transactions paying at most this
+	// fee, in hastings per byte, so that dust is consolidated while fees are
+	// low.
+	MaxFeePerByte types.Currency `json:"maxFeePerByte"`
+}
+
+// SetDustPolicy configures the Tracker to consolidate dust into the
+// transactions built from templates.
+func (t *Tracker) SetDustPolicy(p DustPolicy) {
+	t.dust = &p
+}
+
+// DustPolicy returns the Tracker's dust policy, if any.
+func (t *Tracker) DustPolicy() (DustPolicy, bool) {
+	if t.dust == nil {
+		return DustPolicy{}, false
+	}
+	return *t.dust, true
+}
+
+// withoutDust returns the outputs worth at least the server's dust threshold.
+// If include is true, outputs is returned unchanged.
+func (s *server) withoutDust(outputs []wallet.UnspentOutput, include bool) []wallet.UnspentOutput {
+	if include || s.dust.IsZero() {
+		return outputs
+	}
+	var filtered []wallet.UnspentOutput
+	for _, o := range outputs {
+		if o.Value.Cmp(s.dust) >= 0 {
+			filtered = append(filtered, o)
+		}
+	}
+	return filtered
+}
+
+// signedInputSize returns the size of in, along with its signature.
+func signedInputSize(in types.SiacoinInput) int {
+	sig := wallet.StandardTransactionSignature(crypto.Hash(in.ParentID))
+	sig.Signature = make([]byte, 64)
+	return len(encoding.Marshal(in)) + len(encoding.Marshal(sig))
+}
+
+// inputFee returns the fee for adding in, along with its signature, to a
+// transaction paying feePerByte.
+func inputFee(in types.SiacoinInput, feePerByte types.Currency) types.Currency {
+	return feePerByte.Mul64(uint64(signedInputSize(in)))
+}
+
+// selectDust returns the dust in candidates that should be added to a
+// transaction paying feePerByte, along with its total value and the
+// additional fee for spending it. Dust worth less than the fee for spending it
+// is never selected. The smallest dust is selected first.
+func selectDust(p DustPolicy, candidates []wallet.ValuedInput, feePerByte types.Currency) (dust []wallet.ValuedInput, value, fee types.Currency) {
+	value, fee = types.ZeroCurrency, types.ZeroCurrency
+	if !p.MaxFeePerByte.IsZero() && feePerByte.Cmp(p.MaxFeePerByte) > 0 {
+		return nil, value, fee
+	}
+	for _, in := range candidates {
+		if in.Value.Cmp(p.Threshold) < 0 {
+			dust = append(dust, in)
+		}
+	}
+	sort.Slice(dust, func(i, j int) bool {
+		return dust[i].Value.Cmp(dust[j].Value) < 0
+	})
+	selected := dust[:0]
+	for _, in := range dust {
+		if len(selected) >= p.MaxInputs {
+			break
+		}
+		inFee := inputFee(in.SiacoinInput, feePerByte)
+		if in.Value.Cmp(inFee) <= 0 {
+			continue
+		}
+		selected = append(selected, in)
+		value = value.Add(in.Value)
+		fee = fee.Add(inFee)
+	}
+	return selected, value, fee
+}
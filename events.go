@@ -0,0 +1,92 @@
+package walrus
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Event types.
+const (
+	EventFileContractWindowStarting = "fileContractWindowStarting"
+	EventFileContractWindowEnding   = "fileContractWindowEnding"
+	EventDepositReceived            = "depositReceived"
+	EventPaymentConfirming          = "paymentConfirming"
+	EventPaymentFinal               = "paymentFinal"
+	EventPaymentReverted            = "paymentReverted"
+	EventConsolidationReady         = "consolidationReady"
+	EventSplitReady                 = "splitReady"
+	EventSyncStalled                = "syncStalled"
+	EventSyncResumed                = "syncResumed"
+)
+
+// An Event is a notable change relating to the wallet. The type of Data
+// depends on Type: payment events contain a Payment.
+type Event struct {
+	Seq       uint64            `json:"seq"`
+	Type      string            `json:"type"`
+	Height    types.BlockHeight `json:"height"`
+	Timestamp time.Time         `json:"timestamp"`
+	Data      json.RawMessage   `json:"data"`
+}
+
+// FileContractWarning is the data for the EventFileContractWindowStarting and
+// EventFileContractWindowEnding events.
+type FileContractWarning struct {
+	ID              types.FileContractID `json:"id"`
+	WindowStart     types.BlockHeight    `json:"windowStart"`
+	WindowEnd       types.BlockHeight    `json:"windowEnd"`
+	BlocksRemaining types.BlockHeight    `json:"blocksRemaining"`
+}
+
+// DepositReceipt is the data for the EventDepositReceived event.
+type DepositReceipt struct {
+	Reference     string                `json:"reference"`
+	Address       types.UnlockHash      `json:"address"`
+	TransactionID types.TransactionID   `json:"transactionID"`
+	OutputID      types.SiacoinOutputID `json:"outputID"`
+	Value         types.Currency        `json:"value"`
+}
+
+func addEvent(tx *bolt.Tx, typ string, height types.BlockHeight, timestamp time.Time, data interface{}) error {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	b := tx.Bucket(bucketEvents)
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return putJSON(b, key, Event{
+		Seq:       seq,
+		Type:      typ,
+		Height:    height,
+		Timestamp: timestamp,
+		Data:      js,
+	})
+}
+
+// EventsAfter returns the events with sequence numbers greater than seq,
+// ordered oldest-to-newest. If max >= 0, at most max events are returned.
+func (t *Tracker) EventsAfter(seq uint64, max int) (events []Event) {
+	t.db.View(func(tx *bolt.Tx) error {
+		start := make([]byte, 8)
+		binary.BigEndian.PutUint64(start, seq+1)
+		c := tx.Bucket(bucketEvents).Cursor()
+		for k, v := c.Seek(start); k != nil && len(events) != max; k, v = c.Next() {
+			var e Event
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,85 @@
+package walrus
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// CSVOptions customize the CSV files produced by /reports/statement and
+// /reports/costbasis, e.g. for import into accounting software that expects
+// a particular locale.
+type CSVOptions struct {
+	// The decimal separator, either "." (the default) or ",". If it is ",",
+	// fields are separated by ";" instead of ",".
+	Decimal string
+	// A date pattern built from YYYY, MM, DD, hh, mm, and ss, e.g.
+	// "DD.MM.YYYY hh:mm". Defaults to RFC 3339.
+	DateFormat string
+	// If set, the fiat value of each amount is included, based on the exchange
+	// rate recorded when it was confirmed. Only the currency configured on the
+	// server is available.
+	Currency string
+}
+
+// dateTokens maps the tokens of a CSVOptions date pattern to the
+// corresponding elements of a Go time layout.
+var dateTokens = strings.NewReplacer("YYYY", "2006", "MM", "01", "DD", "02", "hh", "15", "mm", "04", "ss", "05")
+
+// validate checks that o is well-formed.
+func (o CSVOptions) validate() error {
+	if o.Decimal != "" && o.Decimal != "." && o.Decimal != "," {
+		return errors.New("decimal separator must be '.' or ','")
+	}
+	// other characters might be interpreted as part of a Go time layout
+	rest := strings.NewReplacer("YYYY", "", "MM", "", "DD", "", "hh", "", "mm", "", "ss", "").Replace(o.DateFormat)
+	if strings.Trim(rest, " .-/:,T") != "" {
+		return errors.New("date format may only contain YYYY, MM, DD, hh, mm, ss, spaces, and the characters .-/:,T")
+	}
+	return nil
+}
+
+// newWriter returns a CSV writer using the field separator implied by o.
+func (o CSVOptions) newWriter(w io.Writer) *csv.Writer {
+	cw := csv.NewWriter(w)
+	if o.Decimal == "," {
+		cw.Comma = ';'
+	}
+	return cw
+}
+
+func (o CSVOptions) formatTime(t time.Time) string {
+	if o.DateFormat == "" {
+		return t.Format(time.RFC3339)
+	}
+	return t.Format(dateTokens.Replace(o.DateFormat))
+}
+
+func (o CSVOptions) formatNumber(s string) string {
+	if o.Decimal == "," {
+		s = strings.Replace(s, ".", ",", 1)
+	}
+	return s
+}
+
+func (o CSVOptions) formatSC(c types.Currency) string {
+	return o.formatNumber(formatSC(c))
+}
+
+func (o CSVOptions) formatFloat(f float64) string {
+	return o.formatNumber(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+// formatFiat formats the fiat value of c at the specified rate. If the rate is
+// unknown, it returns the empty string.
+func (o CSVOptions) formatFiat(c types.Currency, rate float64) string {
+	if rate == 0 {
+		return ""
+	}
+	return o.formatNumber(strconv.FormatFloat(toSC(c)*rate, 'f', 2, 64))
+}
@@ -0,0 +1,163 @@
+package walrus
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// A FeeEstimator estimates transaction fees, in hastings per byte.
+type FeeEstimator interface {
+	// EstimateFee returns the fee sufficient for a transaction to be
+	// confirmed eventually (min) and within the next block (max).
+	EstimateFee() (min, max types.Currency, err error)
+}
+
+type tpoolFeeEstimator struct {
+	tp TransactionPool
+}
+
+func (fe tpoolFeeEstimator) EstimateFee() (min, max types.Currency, err error) {
+	min, max = fe.tp.FeeEstimation()
+	return min, max, nil
+}
+
+// TpoolFeeEstimator returns a FeeEstimator that uses the estimate of the
+// local transaction pool. This is the server's default.
+func TpoolFeeEstimator(tp TransactionPool) FeeEstimator {
+	return tpoolFeeEstimator{tp}
+}
+
+// A StaticFeeEstimator always returns the same estimate. It can be used to
+// override the other sources.
+type StaticFeeEstimator struct {
+	Min, Max types.Currency
+}
+
+// EstimateFee implements FeeEstimator.
+func (fe StaticFeeEstimator) EstimateFee() (min, max types.Currency, err error) {
+	return fe.Min, fe.Max, nil
+}
+
+// explorerCacheDuration is how long an ExplorerFeeEstimator reuses a fetched
+// estimate.
+const explorerCacheDuration = time.Minute
+
+// An ExplorerFeeEstimator fetches estimates from a remote API, such as the
+// /tpool/fee endpoint of another siad node or an explorer that mirrors it.
+// The response must be a JSON object with "minimum" and "maximum" fields.
+// Estimates are cached for a minute.
+type ExplorerFeeEstimator struct {
+	url string
+	hc  *http.Client
+
+	mu       sync.Mutex
+	min, max types.Currency
+	fetched  time.Time
+}
+
+// EstimateFee implements FeeEstimator.
+func (fe *ExplorerFeeEstimator) EstimateFee() (min, max types.Currency, err error) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	if time.Since(fe.fetched) < explorerCacheDuration {
+		return fe.min, fe.max, nil
+	}
+	req, err := http.NewRequest("GET", fe.url, nil)
+	if err != nil {
+		return types.Currency{}, types.Currency{}, err
+	}
+	// required by siad
+	req.Header.Set("User-Agent", "Sia-Agent")
+	resp, err := fe.hc.Do(req)
+	if err != nil {
+		return types.Currency{}, types.Currency{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return types.Currency{}, types.Currency{}, errors.New("fee API returned " + resp.Status)
+	}
+	var fees struct {
+		Minimum types.Currency `json:"minimum"`
+		Maximum types.Currency `json:"maximum"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&fees); err != nil {
+		return types.Currency{}, types.Currency{}, err
+	}
+	fe.min, fe.max, fe.fetched = fees.Minimum, fees.Maximum, time.Now()
+	return fe.min, fe.max, nil
+}
+
+// NewExplorerFeeEstimator returns an ExplorerFeeEstimator that fetches
+// estimates from url.
+func NewExplorerFeeEstimator(url string) *ExplorerFeeEstimator {
+	return &ExplorerFeeEstimator{
+		url: url,
+		hc:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// A BlendedFeeEstimator combines the estimates of multiple sources, so that
+// fees do not depend solely on one view of the network. Each bound of the
+// estimate is the median of the sources' bounds, clamped to [Floor, Ceiling].
+// Sources that fail are ignored; if every source fails, the first error is
+// returned.
+type BlendedFeeEstimator struct {
+	Sources []FeeEstimator
+	Floor   types.Currency
+	// If zero, estimates are not capped.
+	Ceiling types.Currency
+}
+
+// medianCurrency returns the median of cs, which must not be empty.
+func medianCurrency(cs []types.Currency) types.Currency {
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Cmp(cs[j]) < 0 })
+	if len(cs)%2 == 1 {
+		return cs[len(cs)/2]
+	}
+	return cs[len(cs)/2-1].Add(cs[len(cs)/2]).Div64(2)
+}
+
+// clamp returns c, raised to Floor and capped at Ceiling.
+func (fe BlendedFeeEstimator) clamp(c types.Currency) types.Currency {
+	if c.Cmp(fe.Floor) < 0 {
+		c = fe.Floor
+	}
+	if !fe.Ceiling.IsZero() && c.Cmp(fe.Ceiling) > 0 {
+		c = fe.Ceiling
+	}
+	return c
+}
+
+// EstimateFee implements FeeEstimator.
+func (fe BlendedFeeEstimator) EstimateFee() (min, max types.Currency, err error) {
+	var mins, maxs []types.Currency
+	var firstErr error
+	for _, src := range fe.Sources {
+		min, max, err := src.EstimateFee()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		mins = append(mins, min)
+		maxs = append(maxs, max)
+	}
+	if len(mins) == 0 {
+		if firstErr == nil {
+			firstErr = errors.New("no fee sources configured")
+		}
+		return types.Currency{}, types.Currency{}, firstErr
+	}
+	min, max = fe.clamp(medianCurrency(mins)), fe.clamp(medianCurrency(maxs))
+	if max.Cmp(min) < 0 {
+		max = min
+	}
+	return min, max, nil
+}
@@ -5,6 +5,9 @@ go 1.13
 require (
 	github.com/julienschmidt/httprouter v1.3.0
 	gitlab.com/NebulousLabs/Sia v1.4.2-0.20191220232351-91e83488aaa4
+	go.etcd.io/bbolt v1.3.3
 	lukechampine.com/flagg v1.1.1
+	lukechampine.com/frand v1.0.1
 	lukechampine.com/us v0.11.1
+	rsc.io/qr v0.2.0
 )
@@ -0,0 +1,105 @@
+package walrus
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+	"lukechampine.com/walrus/api"
+)
+
+// ErrWrongWallet is returned by a Client configured with WithWalletID if the
+// server manages a different wallet.
+var ErrWrongWallet = errors.New("server manages a different wallet")
+
+// WalletIDForAddress returns the ID of the wallet whose seed derives addr at
+// index 0. The ID identifies the wallet without revealing its addresses.
+func WalletIDForAddress(addr types.UnlockHash) string {
+	h := crypto.HashBytes([]byte("walrus wallet id " + addr.String()))
+	return hex.EncodeToString(h[:8])
+}
+
+// SeedWalletID returns the ID of the wallet derived from seed.
+func SeedWalletID(seed wallet.Seed) string {
+	uc := wallet.StandardUnlockConditions(seed.PublicKey(0))
+	return WalletIDForAddress(uc.UnlockHash())
+}
+
+// firstAddress returns the address at seed index 0, from which the wallet's
+// ID is derived. If the server cannot derive keys, the wallet's addresses are
+// searched; if there is no such address, or more than one (e.g. because
+// addresses from several seeds were added), it returns false.
+func (s *server) firstAddress() (types.UnlockHash, bool) {
+	if s.keys != nil {
+		if pk, ok := s.keys.PublicKey(0); ok {
+			return wallet.StandardUnlockConditions(pk).UnlockHash(), true
+		}
+	}
+	if s.seed != nil {
+		return wallet.StandardUnlockConditions(s.seed.PublicKey(0)).UnlockHash(), true
+	}
+	var first types.UnlockHash
+	var found bool
+	for _, addr := range s.w.Addresses() {
+		if info, ok := s.w.AddressInfo(addr); ok && info.KeyIndex == 0 {
+			if found {
+				return types.UnlockHash{}, false
+			}
+			first, found = addr, true
+		}
+	}
+	return first, found
+}
+
+// WalletID returns the ID of the wallet managed by the server.
+func (c *Client) WalletID() (resp ResponseWalletID, err error) {
+	err = c.get(api.WalletID, &resp)
+	return
+}
+
+// A walletIDCheck records the result of checking the server's wallet ID. It
+// is shared by copies of a Client.
+type walletIDCheck struct {
+	expected string
+	mu       sync.Mutex
+	done     bool
+	err      error
+}
+
+// check returns a non-nil error if the server's wallet ID is not the expected
+// ID. As with compatibilityCheck, a mismatch is cached, while other errors are
+// not.
+func (wc *walletIDCheck) check(ctx context.Context, c *Client) error {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	if wc.done {
+		return wc.err
+	}
+	c2 := *c
+	c2.ctx = ctx
+	c2.identity = nil
+	resp, err := c2.WalletID()
+	if err != nil {
+		return fmt.Errorf("couldn't verify wallet ID: %w", err)
+	}
+	if resp.ID != wc.expected {
+		wc.err = fmt.Errorf("%w (server wallet ID %v, expected %v)", ErrWrongWallet, resp.ID, wc.expected)
+	}
+	wc.done = true
+	return wc.err
+}
+
+// WithWalletID configures the Client to check the server's wallet ID before
+// its first request. If the server manages a different wallet, or its wallet
+// ID is unknown, every request fails; a mismatch is reported as ErrWrongWallet.
+// The expected ID can be computed with SeedWalletID.
+func WithWalletID(id string) ClientOption {
+	return func(c *Client) {
+		c.identity = &walletIDCheck{expected: id}
+	}
+}
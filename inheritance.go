@@ -0,0 +1,219 @@
+package walrus
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"strconv"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+var keyInheritance = []byte("inheritance")
+
+// maxClockSkew is the maximum difference between the timestamp of a signed
+// request and the server's clock.
+const maxClockSkew = 5 * time.Minute
+
+// inheritanceCheckInterval is how often the Tracker checks whether the
+// inheritance deadline has passed.
+var inheritanceCheckInterval = time.Minute
+
+// An Inheritance is a pre-signed transaction set paying a beneficiary, held by
+// the Tracker and broadcast automatically if the operator does not send a
+// heartbeat within the configured period.
+type Inheritance struct {
+	Beneficiary  types.UnlockHash    `json:"beneficiary"`
+	Transactions []types.Transaction `json:"transactions"`
+	// The key that must sign heartbeats.
+	HeartbeatKey  ed25519.PublicKey `json:"heartbeatKey"`
+	Period        time.Duration     `json:"period"`
+	LastHeartbeat time.Time         `json:"lastHeartbeat"`
+	// Set once the transactions have been broadcast, or queued as a vault
+	// withdrawal.
+	Triggered time.Time `json:"triggered"`
+	// The most recent broadcast error, if any.
+	LastError string `json:"lastError"`
+}
+
+// Deadline returns the time at which the transactions will be broadcast if no
+// further heartbeats are received.
+func (inh Inheritance) Deadline() time.Time {
+	return inh.LastHeartbeat.Add(inh.Period)
+}
+
+// signedMessage returns the message signed by the operator to authorize a
+// request with the specified purpose and timestamp.
+func signedMessage(purpose string, timestamp time.Time) []byte {
+	return []byte("walrus " + purpose + " " + strconv.FormatInt(timestamp.Unix(), 10))
+}
+
+// SignHeartbeat signs a heartbeat for the inheritance switch with the
+// specified timestamp, which should be the current time.
+func SignHeartbeat(key ed25519.PrivateKey, timestamp time.Time) []byte {
+	return ed25519.Sign(key, signedMessage("heartbeat", timestamp))
+}
+
+// SignInheritanceRemoval signs a request to remove the inheritance switch
+// with the specified timestamp, which should be the current time.
+func SignInheritanceRemoval(key ed25519.PrivateKey, timestamp time.Time) []byte {
+	return ed25519.Sign(key, signedMessage("remove inheritance", timestamp))
+}
+
+// validateInheritance checks that inh is well-formed and that its
+// transactions are signed and pay the beneficiary. The signatures themselves
+// are not verified.
+func validateInheritance(inh Inheritance) error {
+	if len(inh.HeartbeatKey) != ed25519.PublicKeySize {
+		return errors.New("heartbeat key must be an ed25519 public key")
+	} else if inh.Period <= 0 {
+		return errors.New("period must be positive")
+	} else if len(inh.Transactions) == 0 {
+		return errors.New("transaction set is empty")
+	}
+	pays := false
+	for _, txn := range inh.Transactions {
+		if len(txn.TransactionSignatures) == 0 {
+			return errors.New("transaction " + txn.ID().String() + " is not signed")
+		}
+		for _, sco := range txn.SiacoinOutputs {
+			pays = pays || sco.UnlockHash == inh.Beneficiary
+		}
+	}
+	if !pays {
+		return errors.New("transaction set does not pay the beneficiary")
+	}
+	return nil
+}
+
+// SetInheritance stores inh and starts its heartbeat period. It is an error
+// to replace an existing Inheritance; it must be removed first.
+func (t *Tracker) SetInheritance(inh Inheritance) error {
+	if err := validateInheritance(inh); err != nil {
+		return err
+	}
+	inh.LastHeartbeat = time.Now()
+	inh.Triggered = time.Time{}
+	inh.LastError = ""
+	return t.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(bucketMeta)
+		if meta.Get(keyInheritance) != nil {
+			return errors.New("an inheritance is already configured")
+		}
+		return putJSON(meta, keyInheritance, inh)
+	})
+}
+
+// Inheritance returns the Tracker's Inheritance, if any.
+func (t *Tracker) Inheritance() (inh Inheritance, ok bool) {
+	t.db.View(func(tx *bolt.Tx) error {
+		ok = getJSON(tx.Bucket(bucketMeta), keyInheritance, &inh)
+		return nil
+	})
+	return
+}
+
+// updateInheritance verifies a signed request from the operator and, if it is
+// valid, applies fn to the stored Inheritance. Timestamps must increase, so a
+// signature cannot be replayed.
+func (t *Tracker) updateInheritance(purpose string, timestamp time.Time, sig []byte, fn func(*bolt.Bucket, *Inheritance) error) error {
+	// signatures only cover whole seconds
+	timestamp = time.Unix(timestamp.Unix(), 0)
+	if d := time.Since(timestamp); d > maxClockSkew || d < -maxClockSkew {
+		return errors.New("timestamp is too far from the server's clock")
+	}
+	return t.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(bucketMeta)
+		var inh Inheritance
+		if !getJSON(meta, keyInheritance, &inh) {
+			return errors.New("no inheritance is configured")
+		} else if !ed25519.Verify(inh.HeartbeatKey, signedMessage(purpose, timestamp), sig) {
+			return errors.New("invalid signature")
+		} else if !timestamp.After(inh.LastHeartbeat) {
+			return errors.New("timestamp must be later than the previous heartbeat")
+		}
+		return fn(meta, &inh)
+	})
+}
+
+// Heartbeat records a check-in from the operator, postponing the inheritance
+// deadline. sig must be the signature returned by SignHeartbeat.
+func (t *Tracker) Heartbeat(timestamp time.Time, sig []byte) error {
+	return t.updateInheritance("heartbeat", timestamp, sig, func(meta *bolt.Bucket, inh *Inheritance) error {
+		if !inh.Triggered.IsZero() {
+			return errors.New("inheritance has already been broadcast")
+		}
+		inh.LastHeartbeat = timestamp
+		return putJSON(meta, keyInheritance, inh)
+	})
+}
+
+// RemoveInheritance deletes the Tracker's Inheritance. sig must be the
+// signature returned by SignInheritanceRemoval.
+func (t *Tracker) RemoveInheritance(timestamp time.Time, sig []byte) error {
+	return t.updateInheritance("remove inheritance", timestamp, sig, func(meta *bolt.Bucket, _ *Inheritance) error {
+		return meta.Delete(keyInheritance)
+	})
+}
+
+// WatchInheritance starts a goroutine that broadcasts the Inheritance
+// transactions via tp once the heartbeat deadline passes. Failed broadcasts
+// are retried. On a standby instance, nothing is broadcast.
+func (t *Tracker) WatchInheritance(tp TransactionPool) {
+	go func() {
+		ticker := time.NewTicker(inheritanceCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-t.closed:
+				return
+			}
+			if t.isLeader() {
+				t.checkInheritance(tp, time.Now())
+			}
+		}
+	}()
+}
+
+// checkInheritance broadcasts the Inheritance transactions if the deadline
+// has passed as of now. Like any other withdrawal, transactions that exceed
+// the vault threshold are queued instead, so that the holder of the recovery
+// key can cancel an inheritance configured by an attacker.
+func (t *Tracker) checkInheritance(tp TransactionPool, now time.Time) {
+	inh, ok := t.Inheritance()
+	if !ok || !inh.Triggered.IsZero() || now.Before(inh.Deadline()) {
+		return
+	}
+	var err error
+	queued := t.requiresDelay(inh.Transactions)
+	if queued {
+		_, err = t.QueueWithdrawal(inh.Transactions)
+	} else if err = tp.AcceptTransactionSet(inh.Transactions); err == modules.ErrDuplicateTransactionSet {
+		err = nil
+	}
+	if err == nil && !queued {
+		for _, txn := range inh.Transactions {
+			t.w.AddToLimbo(txn)
+		}
+		t.notifyLimbo(inh.Transactions)
+		t.AddLimboSet(inh.Transactions)
+	}
+	t.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(bucketMeta)
+		// the Inheritance may have been removed in the meantime
+		var cur Inheritance
+		if !getJSON(meta, keyInheritance, &cur) {
+			return nil
+		}
+		if err != nil {
+			cur.LastError = err.Error()
+		} else {
+			cur.Triggered = now
+			cur.LastError = ""
+		}
+		return putJSON(meta, keyInheritance, cur)
+	})
+}
@@ -0,0 +1,198 @@
+package walrus
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/walrus/api"
+)
+
+// iterPageSize is the number of items requested per page by iterators.
+var iterPageSize = 1000
+
+// A pageIterator lazily fetches the pages of a listing as newline-delimited
+// JSON, decoding one item at a time.
+type pageIterator struct {
+	c           *Client
+	route       string
+	query       url.Values
+	cursorParam string
+	// decode decodes the next item from dec, returning its ID.
+	decode func(dec *json.Decoder) (crypto.Hash, error)
+
+	body   io.ReadCloser
+	dec    *json.Decoder
+	n      int // items decoded from the current page
+	cursor crypto.Hash
+	done   bool
+	err    error
+}
+
+func (it *pageIterator) next() bool {
+	for !it.done && it.err == nil {
+		if it.body == nil {
+			q := make(url.Values)
+			for k, v := range it.query {
+				q[k] = v
+			}
+			q.Set("format", "ndjson")
+			q.Set("limit", strconv.Itoa(iterPageSize))
+			if it.cursor != (crypto.Hash{}) {
+				q.Set(it.cursorParam, it.cursor.String())
+			}
+			r, err := it.c.roundTrip("GET", it.route+"?"+q.Encode(), nil, "application/json")
+			if err != nil {
+				it.err = err
+				break
+			}
+			it.body, it.dec, it.n = r.Body, json.NewDecoder(r.Body), 0
+		}
+		id, err := it.decode(it.dec)
+		if err == nil {
+			it.cursor = id
+			it.n++
+			return true
+		}
+		it.body.Close()
+		it.body = nil
+		if err != io.EOF {
+			it.err = err
+		} else if it.n < iterPageSize {
+			it.done = true
+		}
+	}
+	return false
+}
+
+func (it *pageIterator) close() error {
+	it.done = true
+	if it.body != nil {
+		err := it.body.Close()
+		it.body = nil
+		return err
+	}
+	return nil
+}
+
+// A TransactionIterator iterates over the IDs of the transactions relevant to
+// the wallet, newest-to-oldest.
+type TransactionIterator struct {
+	it   pageIterator
+	txid types.TransactionID
+}
+
+// Next advances the iterator to the next transaction, which will then be
+// available through the ID method. It returns false when iteration stops,
+// either by reaching the end of the transactions or due to an error.
+func (ti *TransactionIterator) Next() bool {
+	return ti.it.next()
+}
+
+// ID returns the ID of the current transaction.
+func (ti *TransactionIterator) ID() types.TransactionID {
+	return ti.txid
+}
+
+// Err returns the error, if any, that was encountered during iteration.
+func (ti *TransactionIterator) Err() error {
+	return ti.it.err
+}
+
+// Close stops the iteration. It need not be called if Next has returned
+// false.
+func (ti *TransactionIterator) Close() error {
+	return ti.it.close()
+}
+
+// TransactionsIter returns an iterator over the IDs of the transactions
+// relevant to the wallet, ordered newest-to-oldest. Pages of IDs are fetched
+// as they are needed, so the full history is never held in memory.
+func (c *Client) TransactionsIter() *TransactionIterator {
+	return c.transactionsIter(nil)
+}
+
+// transactionsIter returns an iterator over the IDs of the transactions
+// selected by the query q.
+func (c *Client) transactionsIter(q url.Values) *TransactionIterator {
+	ti := new(TransactionIterator)
+	ti.it = pageIterator{
+		c:           c,
+		route:       api.Transactions,
+		query:       q,
+		cursorParam: "before",
+		decode: func(dec *json.Decoder) (crypto.Hash, error) {
+			err := dec.Decode(&ti.txid)
+			return crypto.Hash(ti.txid), err
+		},
+	}
+	return ti
+}
+
+// An UnspentOutputIterator iterates over the outputs that the wallet can
+// spend, ordered by ID.
+type UnspentOutputIterator struct {
+	it     pageIterator
+	output ResponseUnspentOutput
+}
+
+// Next advances the iterator to the next output, which will then be available
+// through the Output method. It returns false when iteration stops, either by
+// reaching the end of the outputs or due to an error.
+func (ui *UnspentOutputIterator) Next() bool {
+	return ui.it.next()
+}
+
+// Output returns the current output.
+func (ui *UnspentOutputIterator) Output() ResponseUnspentOutput {
+	return ui.output
+}
+
+// Err returns the error, if any, that was encountered during iteration.
+func (ui *UnspentOutputIterator) Err() error {
+	return ui.it.err
+}
+
+// Close stops the iteration. It need not be called if Next has returned
+// false.
+func (ui *UnspentOutputIterator) Close() error {
+	return ui.it.close()
+}
+
+// UnspentOutputsIter returns an iterator over the outputs that the wallet can
+// spend, ordered by ID. If the limbo flag is true, the outputs will reflect
+// any transactions currently in Limbo. Pages of outputs are fetched as they
+// are needed, so the full set is never held in memory.
+func (c *Client) UnspentOutputsIter(limbo bool, opts ...ResponseOptions) *UnspentOutputIterator {
+	return c.unspentOutputsIter(url.Values{"limbo": {strconv.FormatBool(limbo)}}, opts)
+}
+
+// unspentOutputsIter returns an iterator over the outputs selected by the
+// query q.
+func (c *Client) unspentOutputsIter(q url.Values, opts []ResponseOptions) *UnspentOutputIterator {
+	var fields []string
+	for _, o := range opts {
+		fields = append(fields, o.Fields...)
+	}
+	if len(fields) > 0 {
+		// the ID is needed to request the next page
+		q.Set("fields", strings.Join(append(fields, "id"), ","))
+	}
+	ui := new(UnspentOutputIterator)
+	ui.it = pageIterator{
+		c:           c,
+		route:       api.UTXOs,
+		query:       q,
+		cursorParam: "after",
+		decode: func(dec *json.Decoder) (crypto.Hash, error) {
+			ui.output = ResponseUnspentOutput{}
+			err := dec.Decode(&ui.output)
+			return crypto.Hash(ui.output.ID), err
+		},
+	}
+	return ui
+}
@@ -0,0 +1,163 @@
+package walrus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// Job statuses.
+const (
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job types.
+const (
+	JobTypeVerify = "verify"
+)
+
+// A Job is a long-running operation, such as a rescan, that proceeds in the
+// background while its progress is polled.
+type Job struct {
+	ID       string    `json:"id"`
+	Type     string    `json:"type"`
+	Status   string    `json:"status"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// Progress through the blockchain.
+	StartHeight   types.BlockHeight `json:"startHeight"`
+	CurrentHeight types.BlockHeight `json:"currentHeight"`
+	EndHeight     types.BlockHeight `json:"endHeight"`
+	// The number of relevant items (e.g. discrepancies) found so far.
+	ItemsFound int `json:"itemsFound"`
+	// The estimated completion time. Zero if unknown.
+	ETA    time.Time       `json:"eta"`
+	Error  string          `json:"error,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// A jobProgress tracks a running Job.
+type jobProgress struct {
+	mu         sync.Mutex
+	job        Job
+	phaseStart time.Time
+	cancel     context.CancelFunc
+}
+
+// update records the job's progress through the blockchain.
+func (jp *jobProgress) update(start, current, end types.BlockHeight, found int) {
+	jp.mu.Lock()
+	defer jp.mu.Unlock()
+	j := &jp.job
+	if jp.phaseStart.IsZero() || start != j.StartHeight || end != j.EndHeight {
+		// new phase; restart the ETA calculation
+		jp.phaseStart = time.Now()
+	}
+	j.StartHeight, j.CurrentHeight, j.EndHeight, j.ItemsFound = start, current, end, found
+	if current > start && end >= current {
+		elapsed := time.Since(jp.phaseStart)
+		perBlock := elapsed / time.Duration(current-start)
+		j.ETA = time.Now().Add(perBlock * time.Duration(end-current))
+	}
+}
+
+func (jp *jobProgress) snapshot() Job {
+	jp.mu.Lock()
+	defer jp.mu.Unlock()
+	return jp.job
+}
+
+// A jobSet is the set of jobs started by a server.
+type jobSet struct {
+	mu   sync.Mutex
+	jobs map[string]*jobProgress
+}
+
+// start runs fn in the background as a new job of the specified type. The
+// value returned by fn is stored as the job's result.
+func (js *jobSet) start(typ string, fn func(context.Context, *jobProgress) (interface{}, error)) Job {
+	id := make([]byte, 8)
+	rand.Read(id)
+	ctx, cancel := context.WithCancel(context.Background())
+	jp := &jobProgress{
+		job: Job{
+			ID:      hex.EncodeToString(id),
+			Type:    typ,
+			Status:  JobRunning,
+			Started: time.Now(),
+		},
+		cancel: cancel,
+	}
+	js.mu.Lock()
+	if js.jobs == nil {
+		js.jobs = make(map[string]*jobProgress)
+	}
+	js.jobs[jp.job.ID] = jp
+	js.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		result, err := fn(ctx, jp)
+		jp.mu.Lock()
+		defer jp.mu.Unlock()
+		jp.job.Finished = time.Now()
+		jp.job.ETA = time.Time{}
+		switch {
+		case err == context.Canceled:
+			jp.job.Status = JobCancelled
+		case err != nil:
+			jp.job.Status = JobFailed
+			jp.job.Error = err.Error()
+		default:
+			jp.job.Status = JobDone
+			jp.job.Result, _ = json.Marshal(result)
+		}
+	}()
+	return jp.snapshot()
+}
+
+// get returns the job with the specified ID.
+func (js *jobSet) get(id string) (Job, bool) {
+	js.mu.Lock()
+	jp, ok := js.jobs[id]
+	js.mu.Unlock()
+	if !ok {
+		return Job{}, false
+	}
+	return jp.snapshot(), true
+}
+
+// list returns every job, ordered by start time.
+func (js *jobSet) list() []Job {
+	js.mu.Lock()
+	jobs := make([]Job, 0, len(js.jobs))
+	for _, jp := range js.jobs {
+		jobs = append(jobs, jp.snapshot())
+	}
+	js.mu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Started.Before(jobs[j].Started)
+	})
+	return jobs
+}
+
+// cancel requests that the job with the specified ID stop. It returns false
+// if no such job exists.
+func (js *jobSet) cancel(id string) bool {
+	js.mu.Lock()
+	jp, ok := js.jobs[id]
+	js.mu.Unlock()
+	if ok {
+		jp.cancel()
+	}
+	return ok
+}
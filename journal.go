@@ -0,0 +1,267 @@
+package walrus
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+var keyJournalCursor = []byte("journalCursor")
+
+// journalChunkSize is the maximum number of Events written to the journal at
+// once.
+const journalChunkSize = 1000
+
+// Default journal rotation limits.
+const (
+	DefaultJournalMaxSize  = 64 << 20 // 64 MiB
+	DefaultJournalMaxFiles = 10
+)
+
+// A JournalEntry is a line of the event journal. Type is either an Event type
+// or a StreamEvent type; Data is the corresponding Event or StreamEvent data.
+type JournalEntry struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	// Set for Events only, since StreamEvents are not stored.
+	Seq    uint64            `json:"seq,omitempty"`
+	Height types.BlockHeight `json:"height,omitempty"`
+	Data   json.RawMessage   `json:"data"`
+}
+
+// A Journal is an append-only record of wallet events, written to disk as
+// newline-delimited JSON. When the journal file exceeds its maximum size, it
+// is renamed with the suffix ".1", any existing ".1" file is renamed ".2",
+// and so on; the oldest file is deleted once the maximum number of files is
+// reached.
+type Journal struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// rotatedPath returns the path of the n'th most recently rotated journal
+// file, or the current file if n is 0.
+func rotatedPath(path string, n int) string {
+	if n == 0 {
+		return path
+	}
+	return path + "." + strconv.Itoa(n)
+}
+
+func (j *Journal) open() error {
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	j.f, j.size = f, stat.Size()
+	return nil
+}
+
+// rotate renames the current journal file and opens a new one.
+func (j *Journal) rotate() error {
+	if err := j.f.Close(); err != nil {
+		return err
+	}
+	os.Remove(rotatedPath(j.path, j.maxFiles-1))
+	for n := j.maxFiles - 2; n >= 0; n-- {
+		if err := os.Rename(rotatedPath(j.path, n), rotatedPath(j.path, n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return j.open()
+}
+
+// append writes entries to the journal and syncs it to disk.
+func (j *Journal) append(entries []JournalEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return errors.New("journal is closed")
+	}
+	for _, e := range entries {
+		js, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if j.size > 0 && j.size+int64(len(js))+1 > j.maxSize && j.maxFiles > 1 {
+			if err := j.rotate(); err != nil {
+				return err
+			}
+		}
+		n, err := j.f.Write(append(js, '\n'))
+		j.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return j.f.Sync()
+}
+
+// Close closes the journal.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
+
+// OpenJournal opens the journal at path, creating it if necessary. The
+// journal is rotated when it exceeds maxSize bytes, and at most maxFiles
+// files (including the current file) are kept.
+func OpenJournal(path string, maxSize int64, maxFiles int) (*Journal, error) {
+	if maxSize <= 0 || maxFiles <= 0 {
+		panic("journal limits must be positive")
+	}
+	j := &Journal{
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// ReplayJournal calls fn on each entry of the journal at path, oldest first,
+// including the entries of rotated files.
+func ReplayJournal(path string, fn func(JournalEntry) error) error {
+	// find the oldest rotated file
+	oldest := 0
+	for {
+		if _, err := os.Stat(rotatedPath(path, oldest+1)); err != nil {
+			break
+		}
+		oldest++
+	}
+	for n := oldest; n >= 0; n-- {
+		f, err := os.Open(rotatedPath(path, n))
+		if err != nil {
+			return err
+		}
+		s := bufio.NewScanner(f)
+		s.Buffer(nil, 16<<20)
+		for s.Scan() {
+			var e JournalEntry
+			if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+				f.Close()
+				return err
+			} else if err := fn(e); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		err = s.Err()
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetJournal configures the Tracker to append wallet events to j: the
+// StreamEvents for relevant transactions, reorgs, and Limbo additions, as
+// they occur, and every Event, including those emitted before the journal was
+// first configured. Errors are passed to onError, which may be nil. Events
+// that could not be written are retried later, but StreamEvents are lost.
+func (t *Tracker) SetJournal(j *Journal, onError func(error)) {
+	if onError == nil {
+		onError = func(error) {}
+	}
+	t.journalMu.Lock()
+	t.journal, t.journalError = j, onError
+	t.journalMu.Unlock()
+	t.writeJournal(nil)
+}
+
+// journaling reports whether the Tracker has a journal.
+func (t *Tracker) journaling() bool {
+	t.journalMu.Lock()
+	defer t.journalMu.Unlock()
+	return t.journal != nil
+}
+
+// writeJournal appends stream, along with any Events that have not yet been
+// journaled, to the Tracker's journal.
+func (t *Tracker) writeJournal(stream []StreamEvent) {
+	t.journalMu.Lock()
+	defer t.journalMu.Unlock()
+	if t.journal == nil {
+		return
+	}
+	var entries []JournalEntry
+	for _, e := range stream {
+		if e.Type == StreamBlockConnected {
+			// not specific to the wallet
+			continue
+		}
+		entries = append(entries, JournalEntry{
+			Type:      e.Type,
+			Timestamp: e.Timestamp,
+			Data:      e.Data,
+		})
+	}
+	if err := t.journal.append(entries); err != nil {
+		t.journalError(err)
+		return
+	}
+	// Events are written in chunks, so that a large backlog (e.g. when the
+	// journal is first configured) need not be held in memory
+	for {
+		var cursor uint64
+		t.db.View(func(tx *bolt.Tx) error {
+			getJSON(tx.Bucket(bucketMeta), keyJournalCursor, &cursor)
+			return nil
+		})
+		events := t.EventsAfter(cursor, journalChunkSize)
+		if len(events) == 0 {
+			return
+		}
+		entries = entries[:0]
+		for _, e := range events {
+			entries = append(entries, JournalEntry{
+				Type:      e.Type,
+				Timestamp: e.Timestamp,
+				Seq:       e.Seq,
+				Height:    e.Height,
+				Data:      e.Data,
+			})
+		}
+		if err := t.journal.append(entries); err != nil {
+			t.journalError(err)
+			return
+		}
+		err := t.db.Update(func(tx *bolt.Tx) error {
+			return putJSON(tx.Bucket(bucketMeta), keyJournalCursor, events[len(events)-1].Seq)
+		})
+		if err != nil {
+			t.journalError(err)
+			return
+		}
+	}
+}
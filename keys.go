@@ -0,0 +1,203 @@
+package walrus
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+	"lukechampine.com/us/wallet"
+)
+
+var (
+	keyReservedSeedIndex = []byte("reservedSeedIndex")
+	keySeedIndexRanges   = []byte("seedIndexReservations")
+)
+
+// A KeySource provides the public keys of a seed, allowing the server to
+// derive addresses on behalf of its clients. Since Sia keys cannot be derived
+// from a public parent key, a KeySource typically wraps either the seed itself
+// or a set of public keys exported from it.
+type KeySource interface {
+	// PublicKey returns the public key at the specified index, or false if the
+	// key is unavailable.
+	PublicKey(index uint64) (types.SiaPublicKey, bool)
+}
+
+type seedKeySource struct {
+	seed wallet.Seed
+}
+
+func (s seedKeySource) PublicKey(index uint64) (types.SiaPublicKey, bool) {
+	return s.seed.PublicKey(index), true
+}
+
+// NewSeedKeySource returns a KeySource that derives public keys from seed.
+func NewSeedKeySource(seed wallet.Seed) KeySource {
+	return seedKeySource{seed}
+}
+
+// ParsePublicKey parses an ed25519 public key in the form "ed25519:<hex>", as
+// produced by types.SiaPublicKey.String.
+func ParsePublicKey(s string) (types.SiaPublicKey, error) {
+	const prefix = "ed25519:"
+	if !strings.HasPrefix(s, prefix) {
+		return types.SiaPublicKey{}, errors.New("public key must begin with " + prefix)
+	}
+	key, err := hex.DecodeString(strings.TrimPrefix(s, prefix))
+	if err != nil {
+		return types.SiaPublicKey{}, errors.New("invalid hex: " + err.Error())
+	} else if len(key) != ed25519.PublicKeySize {
+		return types.SiaPublicKey{}, errors.New("ed25519 public keys must be 32 bytes")
+	}
+	return types.SiaPublicKey{
+		Algorithm: types.SignatureEd25519,
+		Key:       key,
+	}, nil
+}
+
+// deriveAddresses returns the address info for up to count keys, starting at
+// the specified index. It stops early if ks does not have a key.
+func deriveAddresses(ks KeySource, index uint64, count int) []wallet.SeedAddressInfo {
+	infos := make([]wallet.SeedAddressInfo, 0, count)
+	for i := uint64(0); i < uint64(count); i++ {
+		pk, ok := ks.PublicKey(index + i)
+		if !ok {
+			break
+		}
+		infos = append(infos, wallet.SeedAddressInfo{
+			UnlockConditions: wallet.StandardUnlockConditions(pk),
+			KeyIndex:         index + i,
+		})
+	}
+	return infos
+}
+
+// validateAddressInfo checks that info's unlock conditions are the standard
+// unlock conditions for a single ed25519 key, as produced by deriveAddresses.
+// If ks is non-nil, the key must also be the one at info.KeyIndex.
+func validateAddressInfo(ks KeySource, info wallet.SeedAddressInfo) error {
+	uc := info.UnlockConditions
+	if len(uc.PublicKeys) != 1 || uc.SignaturesRequired != 1 || uc.Timelock != 0 {
+		return errors.New("unlock conditions must specify a single key and no timelock")
+	} else if uc.PublicKeys[0].Algorithm != types.SignatureEd25519 || len(uc.PublicKeys[0].Key) != ed25519.PublicKeySize {
+		return errors.New("key must be an ed25519 public key")
+	}
+	if ks != nil {
+		pk, ok := ks.PublicKey(info.KeyIndex)
+		if !ok {
+			return fmt.Errorf("no public key available for seed index %v", info.KeyIndex)
+		} else if pk.String() != uc.PublicKeys[0].String() {
+			return fmt.Errorf("key is not the key at seed index %v", info.KeyIndex)
+		}
+	}
+	return nil
+}
+
+// A seedIndexRange is a range of reserved seed indices, from Start
+// (inclusive) to End (exclusive).
+type seedIndexRange struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// ReserveSeedIndices records that the seed indices in [start, end) have been
+// reserved.
+func (t *Tracker) ReserveSeedIndices(start, end uint64) error {
+	return t.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(bucketMeta)
+		var ranges []seedIndexRange
+		getJSON(meta, keySeedIndexRanges, &ranges)
+		ranges = append(ranges, seedIndexRange{start, end})
+		if err := putJSON(meta, keySeedIndexRanges, ranges); err != nil {
+			return err
+		}
+		var reserved uint64
+		getJSON(meta, keyReservedSeedIndex, &reserved)
+		if end <= reserved {
+			return nil
+		}
+		return putJSON(meta, keyReservedSeedIndex, end)
+	})
+}
+
+// seedIndexReserved reports whether index lies within a range reserved via
+// ReserveSeedIndices.
+func (t *Tracker) seedIndexReserved(index uint64) (reserved bool) {
+	t.db.View(func(tx *bolt.Tx) error {
+		var ranges []seedIndexRange
+		getJSON(tx.Bucket(bucketMeta), keySeedIndexRanges, &ranges)
+		for _, r := range ranges {
+			reserved = reserved || (r.Start <= index && index < r.End)
+		}
+		return nil
+	})
+	return
+}
+
+// ReservedSeedIndex returns the index following the last reserved seed index.
+func (t *Tracker) ReservedSeedIndex() (index uint64) {
+	t.db.View(func(tx *bolt.Tx) error {
+		getJSON(tx.Bucket(bucketMeta), keyReservedSeedIndex, &index)
+		return nil
+	})
+	return
+}
+
+// SetReservedSeedIndex records that every seed index below index has been
+// reserved.
+func (t *Tracker) SetReservedSeedIndex(index uint64) error {
+	return t.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketMeta), keyReservedSeedIndex, index)
+	})
+}
+
+func pubkeyKey(index uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, index)
+	return key
+}
+
+// AddPublicKeys imports the public keys of a seed, starting at the specified
+// index, allowing the Tracker to serve as a watch-only KeySource. Existing keys
+// at the same indices are replaced.
+func (t *Tracker) AddPublicKeys(start uint64, pks []types.SiaPublicKey) error {
+	for _, pk := range pks {
+		if pk.Algorithm != types.SignatureEd25519 {
+			return errors.New("only ed25519 keys are supported")
+		}
+	}
+	err := t.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketPublicKeys)
+		for i, pk := range pks {
+			if err := b.Put(pubkeyKey(start+uint64(i)), pk.Key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	t.extendLookahead()
+	return nil
+}
+
+// PublicKey implements KeySource.
+func (t *Tracker) PublicKey(index uint64) (pk types.SiaPublicKey, ok bool) {
+	t.db.View(func(tx *bolt.Tx) error {
+		if key := tx.Bucket(bucketPublicKeys).Get(pubkeyKey(index)); key != nil {
+			pk = types.SiaPublicKey{
+				Algorithm: types.SignatureEd25519,
+				Key:       append([]byte(nil), key...),
+			}
+			ok = true
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,114 @@
+package walrus
+
+import (
+	"errors"
+	"sort"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Limits on the labels attached to an address.
+const (
+	maxAddressLabels   = 32
+	maxAddressLabelLen = 64
+)
+
+// validateLabels checks that labels are within the limits on address labels.
+func validateLabels(labels []string) error {
+	if len(labels) > maxAddressLabels {
+		return errors.New("too many labels")
+	}
+	for _, l := range labels {
+		if l == "" || len(l) > maxAddressLabelLen {
+			return errors.New("labels must be non-empty and at most 64 bytes")
+		}
+	}
+	return nil
+}
+
+// hasLabels reports whether have contains each of want.
+func hasLabels(have, want []string) bool {
+	set := make(map[string]bool, len(have))
+	for _, l := range have {
+		set[l] = true
+	}
+	for _, l := range want {
+		if !set[l] {
+			return false
+		}
+	}
+	return true
+}
+
+// SetAddressLabels replaces the labels attached to the specified address,
+// e.g. "cold" or "customer 1234". Duplicate labels are discarded. If labels is
+// empty, the address's labels are removed.
+func (t *Tracker) SetAddressLabels(addr types.UnlockHash, labels []string) error {
+	if err := validateLabels(labels); err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	var uniq []string
+	for _, l := range labels {
+		if !seen[l] {
+			seen[l] = true
+			uniq = append(uniq, l)
+		}
+	}
+	sort.Strings(uniq)
+	return t.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketAddressLabels)
+		if len(uniq) == 0 {
+			return b.Delete(addr[:])
+		}
+		return putJSON(b, addr[:], uniq)
+	})
+}
+
+// AddressLabels returns the labels attached to the specified address, in
+// sorted order.
+func (t *Tracker) AddressLabels(addr types.UnlockHash) (labels []string) {
+	t.db.View(func(tx *bolt.Tx) error {
+		getJSON(tx.Bucket(bucketAddressLabels), addr[:], &labels)
+		return nil
+	})
+	return
+}
+
+// labeledAddresses returns the addresses carrying each of the specified
+// labels. If t is nil, no addresses carry labels.
+func labeledAddresses(t *Tracker, labels []string) map[types.UnlockHash]bool {
+	addrs := make(map[types.UnlockHash]bool)
+	if t == nil {
+		return addrs
+	}
+	t.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketAddressLabels).ForEach(func(k, _ []byte) error {
+			var addr types.UnlockHash
+			copy(addr[:], k)
+			var have []string
+			if getJSON(tx.Bucket(bucketAddressLabels), k, &have) && hasLabels(have, labels) {
+				addrs[addr] = true
+			}
+			return nil
+		})
+	})
+	return addrs
+}
+
+// involvesAddress reports whether any input or output of txn belongs to one
+// of addrs.
+func involvesAddress(txn types.Transaction, addrs map[types.UnlockHash]bool) bool {
+	for _, sci := range txn.SiacoinInputs {
+		if addrs[sci.UnlockConditions.UnlockHash()] {
+			return true
+		}
+	}
+	for _, sco := range txn.SiacoinOutputs {
+		if addrs[sco.UnlockHash] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package walrus
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// A Leader reports whether this instance currently holds leadership among a
+// group of walrus instances. Only the leader broadcasts transactions and
+// delivers notifications; the others act as warm standbys, following the
+// blockchain so that they can take over immediately.
+type Leader interface {
+	IsLeader() bool
+}
+
+// SetLeader configures the Tracker to deliver push notifications and request
+// annotations only while l reports that it is the leader. While on standby,
+// events are skipped, and transactions remain queued for annotation.
+func (t *Tracker) SetLeader(l Leader) {
+	t.leader = l
+}
+
+func (t *Tracker) isLeader() bool {
+	return t.leader == nil || t.leader.IsLeader()
+}
+
+// A FileLease is a Leader backed by a lease file on storage shared by every
+// instance in the group, such as an NFS mount. The lease is held for a fixed
+// duration and must be renewed before it expires; if the leader stops
+// renewing it, another instance acquires it.
+type FileLease struct {
+	path   string
+	holder string
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	expires time.Time
+}
+
+type leaseFile struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+func (fl *FileLease) read() (lf leaseFile, err error) {
+	js, err := ioutil.ReadFile(fl.path)
+	if os.IsNotExist(err) {
+		return leaseFile{}, nil
+	} else if err != nil {
+		return leaseFile{}, err
+	}
+	err = json.Unmarshal(js, &lf)
+	return
+}
+
+// tryAcquire acquires or renews the lease, if it is held by this instance or
+// has expired.
+func (fl *FileLease) tryAcquire() error {
+	lf, err := fl.read()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if lf.Holder != fl.holder && now.Before(lf.Expires) {
+		return nil
+	}
+	js, _ := json.Marshal(leaseFile{
+		Holder:  fl.holder,
+		Expires: now.Add(fl.ttl),
+	})
+	// write atomically, so that other instances never see a partial file
+	tmp := fl.path + "." + fl.holder + ".tmp"
+	if err := ioutil.WriteFile(tmp, js, 0660); err != nil {
+		return err
+	} else if err := os.Rename(tmp, fl.path); err != nil {
+		return err
+	}
+	// if another instance acquired the lease at the same time, only one of
+	// the renames won; confirm that it was ours
+	if lf, err = fl.read(); err != nil {
+		return err
+	} else if lf.Holder == fl.holder {
+		fl.mu.Lock()
+		fl.expires = lf.Expires
+		fl.mu.Unlock()
+	}
+	return nil
+}
+
+// IsLeader implements Leader. To allow for clock skew and delayed renewals,
+// an instance stops considering itself the leader shortly before its lease
+// expires.
+func (fl *FileLease) IsLeader() bool {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	return time.Now().Before(fl.expires.Add(-fl.ttl / 3))
+}
+
+// Holder returns the current holder of the lease, or the empty string if the
+// lease has expired.
+func (fl *FileLease) Holder() string {
+	lf, err := fl.read()
+	if err != nil || time.Now().After(lf.Expires) {
+		return ""
+	}
+	return lf.Holder
+}
+
+// Run acquires and renews the lease until ctx is cancelled, at which point
+// the lease is released if held.
+func (fl *FileLease) Run(ctx context.Context) error {
+	for {
+		fl.tryAcquire()
+		select {
+		case <-ctx.Done():
+			if fl.IsLeader() {
+				os.Remove(fl.path)
+			}
+			return ctx.Err()
+		case <-time.After(fl.ttl / 4):
+		}
+	}
+}
+
+// NewFileLease returns a FileLease for the lease file at path, identifying
+// this instance as holder. The lease is not acquired until Run is called.
+func NewFileLease(path, holder string, ttl time.Duration) *FileLease {
+	return &FileLease{
+		path:   filepath.Clean(path),
+		holder: holder,
+		ttl:    ttl,
+	}
+}
@@ -0,0 +1,171 @@
+package walrus
+
+import (
+	"encoding/json"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+	"lukechampine.com/us/wallet"
+)
+
+// A LimboSet is a group of transactions that were broadcast together.
+type LimboSet struct {
+	ID             crypto.Hash           `json:"id"`
+	Broadcast      time.Time             `json:"broadcast"`
+	TransactionIDs []types.TransactionID `json:"transactionIDs"`
+}
+
+// AddLimboSet records that the transactions in txnSet were broadcast together,
+// and begins tracking how long the set takes to confirm.
+func (t *Tracker) AddLimboSet(txnSet []types.Transaction) error {
+	ls := LimboSet{
+		Broadcast:      time.Now(),
+		TransactionIDs: make([]types.TransactionID, len(txnSet)),
+	}
+	for i, txn := range txnSet {
+		ls.TransactionIDs[i] = txn.ID()
+	}
+	ls.ID = crypto.HashObject(ls.TransactionIDs)
+	return t.db.Update(func(tx *bolt.Tx) error {
+		if err := recordBroadcast(tx, txnSet, ls.Broadcast); err != nil {
+			return err
+		}
+		return putJSON(tx.Bucket(bucketLimboSets), ls.ID[:], ls)
+	})
+}
+
+// LimboSets returns every recorded transaction set that still has at least
+// one transaction in Limbo.
+func (t *Tracker) LimboSets() (sets []LimboSet) {
+	t.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketLimboSets).ForEach(func(_, v []byte) error {
+			var ls LimboSet
+			if err := json.Unmarshal(v, &ls); err != nil {
+				return err
+			}
+			sets = append(sets, ls)
+			return nil
+		})
+	})
+	return
+}
+
+// pruneLimboSets deletes any recorded set whose transactions have all left
+// Limbo.
+func (t *Tracker) pruneLimboSets(tx *bolt.Tx) error {
+	inLimbo := make(map[types.TransactionID]bool)
+	for _, txn := range t.w.LimboTransactions() {
+		inLimbo[txn.ID()] = true
+	}
+	b := tx.Bucket(bucketLimboSets)
+	var stale [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		var ls LimboSet
+		if err := json.Unmarshal(v, &ls); err != nil {
+			return err
+		}
+		for _, id := range ls.TransactionIDs {
+			if inLimbo[id] {
+				return nil
+			}
+		}
+		stale = append(stale, k)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// can't modify a bucket while iterating over it
+	for _, k := range stale {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupLimbo partitions limbo into the recorded sets. Transactions that do not
+// belong to any recorded set are returned as singleton sets. Transactions that
+// are no longer in limbo are omitted.
+func groupLimbo(sets []LimboSet, limbo []wallet.LimboTransaction) []ResponseLimboSet {
+	byID := make(map[types.TransactionID]wallet.LimboTransaction)
+	for _, txn := range limbo {
+		byID[txn.ID()] = txn
+	}
+	var groups []ResponseLimboSet
+	for _, ls := range sets {
+		g := ResponseLimboSet{ID: ls.ID, Broadcast: ls.Broadcast}
+		for _, id := range ls.TransactionIDs {
+			if txn, ok := byID[id]; ok {
+				g.Transactions = append(g.Transactions, txn)
+				delete(byID, id)
+			}
+		}
+		if len(g.Transactions) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	for _, txn := range limbo {
+		if _, ok := byID[txn.ID()]; ok {
+			groups = append(groups, ResponseLimboSet{
+				ID:           crypto.Hash(txn.ID()),
+				Broadcast:    txn.LimboSince,
+				Transactions: []wallet.LimboTransaction{txn},
+			})
+		}
+	}
+	return groups
+}
+
+// A LimboFilter selects transactions in Limbo. Zero-valued fields match every
+// transaction.
+type LimboFilter struct {
+	// Transactions that spend from or send to any of these addresses.
+	Addresses []types.UnlockHash
+	// The minimum value sent to Addresses or, if Addresses is empty, the
+	// minimum total value of the transaction's siacoin outputs.
+	MinValue types.Currency
+	// The minimum time that the transaction has spent in Limbo.
+	MinAge time.Duration
+}
+
+// matches reports whether txn is selected by f as of now.
+func (f LimboFilter) matches(txn wallet.LimboTransaction, now time.Time) bool {
+	if now.Sub(txn.LimboSince) < f.MinAge {
+		return false
+	}
+	inSet := func(addr types.UnlockHash) bool {
+		for _, a := range f.Addresses {
+			if a == addr {
+				return true
+			}
+		}
+		return false
+	}
+	relevant := len(f.Addresses) == 0
+	for _, sci := range txn.SiacoinInputs {
+		relevant = relevant || inSet(sci.UnlockConditions.UnlockHash())
+	}
+	value := types.ZeroCurrency
+	for _, sco := range txn.SiacoinOutputs {
+		if len(f.Addresses) == 0 || inSet(sco.UnlockHash) {
+			value = value.Add(sco.Value)
+			relevant = true
+		}
+	}
+	return relevant && value.Cmp(f.MinValue) >= 0
+}
+
+// filterLimbo returns the transactions in limbo that are selected by f as of
+// now.
+func filterLimbo(limbo []wallet.LimboTransaction, f LimboFilter, now time.Time) []wallet.LimboTransaction {
+	filtered := make([]wallet.LimboTransaction, 0, len(limbo))
+	for _, txn := range limbo {
+		if f.matches(txn, now) {
+			filtered = append(filtered, txn)
+		}
+	}
+	return filtered
+}
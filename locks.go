@@ -0,0 +1,171 @@
+package walrus
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+)
+
+// Limits on the duration of an output lock.
+const (
+	DefaultLockDuration = 10 * time.Minute
+	maxLockDuration     = 24 * time.Hour
+)
+
+// maxLockIDLen is the maximum length of a lock ID.
+const maxLockIDLen = 64
+
+// errOutputLocked is returned when locking an output that is held by another
+// lock.
+var errOutputLocked = errors.New("output is locked")
+
+// An outputLock reserves an output for the holder of a lock ID until it
+// expires.
+type outputLock struct {
+	id      string
+	expires time.Time
+}
+
+// An outputLockSet is the set of output locks held on a server. Locks are not
+// persisted; they are released when the server restarts.
+type outputLockSet struct {
+	mu    sync.Mutex
+	locks map[types.SiacoinOutputID]outputLock
+}
+
+// holder returns the ID of the unexpired lock on the output, if any.
+func (ls *outputLockSet) holder(oid types.SiacoinOutputID) string {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.holderLocked(oid, time.Now())
+}
+
+func (ls *outputLockSet) holderLocked(oid types.SiacoinOutputID, now time.Time) string {
+	l, ok := ls.locks[oid]
+	if !ok {
+		return ""
+	} else if now.After(l.expires) {
+		delete(ls.locks, oid)
+		return ""
+	}
+	return l.id
+}
+
+// lock locks each of the outputs under id for the specified duration,
+// extending any locks that id already holds. If any output is held by another
+// lock, no outputs are locked.
+func (ls *outputLockSet) lock(id string, oids []types.SiacoinOutputID, d time.Duration) (time.Time, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	now := time.Now()
+	for _, oid := range oids {
+		if h := ls.holderLocked(oid, now); h != "" && h != id {
+			return time.Time{}, errOutputLocked
+		}
+	}
+	if ls.locks == nil {
+		ls.locks = make(map[types.SiacoinOutputID]outputLock)
+	}
+	expires := now.Add(d)
+	for _, oid := range oids {
+		ls.locks[oid] = outputLock{id: id, expires: expires}
+	}
+	return expires, nil
+}
+
+// release releases the outputs held by id. If oids is empty, every output held
+// by id is released. Outputs held by other locks are unaffected.
+func (ls *outputLockSet) release(id string, oids []types.SiacoinOutputID) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if len(oids) == 0 {
+		for oid, l := range ls.locks {
+			if l.id == id {
+				delete(ls.locks, oid)
+			}
+		}
+		return
+	}
+	for _, oid := range oids {
+		if l, ok := ls.locks[oid]; ok && l.id == id {
+			delete(ls.locks, oid)
+		}
+	}
+}
+
+// filter returns the outputs that are unlocked or held by id.
+func (ls *outputLockSet) filter(outputs []wallet.UnspentOutput, id string) []wallet.UnspentOutput {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	now := time.Now()
+	var filtered []wallet.UnspentOutput
+	for _, o := range outputs {
+		if h := ls.holderLocked(o.ID, now); h == "" || h == id {
+			filtered = append(filtered, o)
+		}
+	}
+	return filtered
+}
+
+// parseLockDuration parses a lock duration, e.g. "10m". The empty string
+// denotes DefaultLockDuration.
+func parseLockDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return DefaultLockDuration, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	} else if d <= 0 || d > maxLockDuration {
+		return 0, errors.New("must be positive and at most 24h")
+	}
+	return d, nil
+}
+
+// validLockID reports whether id is a valid lock ID.
+func validLockID(id string) bool {
+	return id != "" && len(id) <= maxLockIDLen
+}
+
+// unlockedOutputs returns the outputs in utxos that are not locked.
+func unlockedOutputs(utxos []ResponseUnspentOutput) []ResponseUnspentOutput {
+	var unlocked []ResponseUnspentOutput
+	for _, o := range utxos {
+		if o.LockID == "" {
+			unlocked = append(unlocked, o)
+		}
+	}
+	return unlocked
+}
+
+// DepositLockID returns the ID of the lock that holds the outputs reserved by
+// the deposits with the specified reference. To spend the outputs, pass the
+// ID as the LockID of a /construct request.
+func DepositLockID(reference string) string {
+	return "deposit:" + reference
+}
+
+// reserveDeposits locks each output of txns that is sent to a deposit that
+// reserves its outputs. Outputs that are already locked are left alone, so an
+// output is reserved only when it is first detected. It requires a Tracker.
+func (s *server) reserveDeposits(txns []types.Transaction) {
+	for _, txn := range txns {
+		for i, sco := range txn.SiacoinOutputs {
+			d, ok := s.t.Deposit(sco.UnlockHash)
+			if !ok || !d.Reserve {
+				continue
+			}
+			dur, err := parseLockDuration(d.ReserveDuration)
+			if err != nil {
+				continue // validated when the deposit was added
+			}
+			oid := txn.SiacoinOutputID(uint64(i))
+			if s.locks.holder(oid) == "" {
+				s.locks.lock(DepositLockID(d.Reference), []types.SiacoinOutputID{oid}, dur)
+			}
+		}
+	}
+}
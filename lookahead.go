@@ -0,0 +1,86 @@
+package walrus
+
+import (
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+// SetLookahead configures the Tracker to keep n addresses beyond the last
+// issued seed index registered with the wallet, so that payments to addresses
+// that have not yet been requested are still detected. Addresses are derived
+// from the public keys imported via AddPublicKeys; if not enough keys are
+// available, the window is truncated. When an output is sent to an address in
+// the window, every index up to and including that address is considered
+// issued, and the window advances. A lookahead of 0 disables the window.
+func (t *Tracker) SetLookahead(n uint64) {
+	t.lookahead = n
+	t.extendLookahead()
+}
+
+// Lookahead returns the Tracker's lookahead window size.
+func (t *Tracker) Lookahead() uint64 {
+	return t.lookahead
+}
+
+// extendLookahead adds addresses to the wallet until the window following the
+// last issued seed index is full.
+func (t *Tracker) extendLookahead() {
+	if t.lookahead == 0 {
+		return
+	}
+	start, end := t.w.SeedIndex(), t.ReservedSeedIndex()+t.lookahead
+	if start >= end {
+		return
+	}
+	for _, info := range deriveAddresses(t, start, int(end-start)) {
+		t.w.AddAddress(info)
+	}
+}
+
+// markIssued records that the address at index has been issued, advancing the
+// lookahead window if necessary.
+func (t *Tracker) markIssued(index uint64) error {
+	if t.lookahead == 0 || index < t.ReservedSeedIndex() {
+		return nil
+	}
+	if err := t.SetReservedSeedIndex(index + 1); err != nil {
+		return err
+	}
+	t.extendLookahead()
+	return nil
+}
+
+// markUsed advances the last issued seed index past any address in the
+// lookahead window that received an output in cc.
+func (t *Tracker) markUsed(tx *bolt.Tx, cc modules.ConsensusChange) error {
+	if t.lookahead == 0 {
+		return nil
+	}
+	meta := tx.Bucket(bucketMeta)
+	var issued uint64
+	getJSON(meta, keyReservedSeedIndex, &issued)
+	used := issued
+	markAddr := func(addr types.UnlockHash) {
+		if info, ok := t.w.AddressInfo(addr); ok && info.KeyIndex >= used {
+			used = info.KeyIndex + 1
+		}
+	}
+	for _, b := range cc.AppliedBlocks {
+		for _, mp := range b.MinerPayouts {
+			markAddr(mp.UnlockHash)
+		}
+		for _, txn := range b.Transactions {
+			for _, sco := range txn.SiacoinOutputs {
+				markAddr(sco.UnlockHash)
+			}
+			for _, sfo := range txn.SiafundOutputs {
+				markAddr(sfo.UnlockHash)
+			}
+		}
+	}
+	if used == issued {
+		return nil
+	}
+	return putJSON(meta, keyReservedSeedIndex, used)
+}
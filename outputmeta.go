@@ -0,0 +1,175 @@
+package walrus
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+	"lukechampine.com/us/wallet"
+)
+
+// Limits on the metadata attached to an output.
+const (
+	maxMetadataKeys     = 32
+	maxMetadataKeyLen   = 64
+	maxMetadataValueLen = 256
+)
+
+// metadataKeySeparator separates a key from its value in a metadata filter
+// query parameter, e.g. ?meta=reserved-for=batch-7.
+const metadataKeySeparator = "="
+
+// validateMetadata checks that meta is within the limits on output metadata.
+func validateMetadata(meta map[string]string) error {
+	if len(meta) > maxMetadataKeys {
+		return errors.New("too many metadata keys")
+	}
+	for k, v := range meta {
+		if k == "" || len(k) > maxMetadataKeyLen || strings.Contains(k, metadataKeySeparator) {
+			return errors.New("metadata keys must be non-empty, at most 64 bytes, and must not contain '='")
+		} else if len(v) > maxMetadataValueLen {
+			return errors.New("metadata values must be at most 256 bytes")
+		}
+	}
+	return nil
+}
+
+// An OutputFilter selects unspent outputs by their metadata. The zero value
+// selects every output.
+type OutputFilter struct {
+	// Only outputs with each of these keys are selected. If the value of a key
+	// is non-empty, the output's value for the key must also match.
+	Require map[string]string `json:"require,omitempty"`
+	// Outputs with any of these keys are excluded.
+	Exclude []string `json:"exclude,omitempty"`
+	// Only outputs sent to addresses carrying each of these labels are
+	// selected. See /addresses/:addr/label.
+	Labels []string `json:"labels,omitempty"`
+	// If true, outputs worth less than the server's dust threshold are also
+	// selected. See WithDustThreshold.
+	IncludeDust bool `json:"includeDust,omitempty"`
+}
+
+// matches reports whether an output with the specified metadata is selected
+// by f.
+func (f OutputFilter) matches(meta map[string]string) bool {
+	for k, v := range f.Require {
+		if mv, ok := meta[k]; !ok || (v != "" && mv != v) {
+			return false
+		}
+	}
+	for _, k := range f.Exclude {
+		if _, ok := meta[k]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// isZero reports whether f selects every output.
+func (f OutputFilter) isZero() bool {
+	return len(f.Require) == 0 && len(f.Exclude) == 0 && len(f.Labels) == 0
+}
+
+// SetOutputMetadata replaces the metadata attached to the specified output. If
+// meta is empty, the output's metadata is removed. Metadata is not removed
+// when an output is spent, since a reorg may unspend it.
+func (t *Tracker) SetOutputMetadata(id types.SiacoinOutputID, meta map[string]string) error {
+	if err := validateMetadata(meta); err != nil {
+		return err
+	}
+	return t.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketOutputMetadata)
+		if len(meta) == 0 {
+			return b.Delete(id[:])
+		}
+		return putJSON(b, id[:], meta)
+	})
+}
+
+// OutputMetadata returns the metadata attached to the specified output.
+func (t *Tracker) OutputMetadata(id types.SiacoinOutputID) (meta map[string]string) {
+	t.db.View(func(tx *bolt.Tx) error {
+		getJSON(tx.Bucket(bucketOutputMetadata), id[:], &meta)
+		return nil
+	})
+	return
+}
+
+// outputsMetadata returns the metadata attached to each of the specified
+// outputs.
+func (t *Tracker) outputsMetadata(outputs []wallet.UnspentOutput) []map[string]string {
+	metas := make([]map[string]string, len(outputs))
+	t.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketOutputMetadata)
+		for i, o := range outputs {
+			getJSON(b, o.ID[:], &metas[i])
+		}
+		return nil
+	})
+	return metas
+}
+
+// filterOutputs returns the outputs selected by f. If t is nil, outputs are
+// treated as having no metadata or labels.
+func filterOutputs(t *Tracker, outputs []wallet.UnspentOutput, f OutputFilter) []wallet.UnspentOutput {
+	if f.isZero() {
+		return outputs
+	}
+	metas := make([]map[string]string, len(outputs))
+	if t != nil {
+		metas = t.outputsMetadata(outputs)
+	}
+	var labeled map[types.UnlockHash]bool
+	if len(f.Labels) > 0 {
+		labeled = labeledAddresses(t, f.Labels)
+	}
+	var filtered []wallet.UnspentOutput
+	for i, o := range outputs {
+		if f.matches(metas[i]) && (labeled == nil || labeled[o.UnlockHash]) {
+			filtered = append(filtered, o)
+		}
+	}
+	return filtered
+}
+
+// parseOutputFilter parses the 'meta', 'nometa', 'label', and 'includeDust'
+// query parameters of a request. Each 'meta' value is either a key or a key=value
+// pair.
+func parseOutputFilter(q url.Values) OutputFilter {
+	f := OutputFilter{IncludeDust: q.Get("includeDust") == "true"}
+	for _, kv := range q["meta"] {
+		if f.Require == nil {
+			f.Require = make(map[string]string)
+		}
+		kv := strings.SplitN(kv, metadataKeySeparator, 2)
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+		f.Require[kv[0]] = kv[1]
+	}
+	f.Exclude = q["nometa"]
+	f.Labels = q["label"]
+	return f
+}
+
+// addOutputFilter adds the query parameters corresponding to f to q.
+func addOutputFilter(q url.Values, f OutputFilter) {
+	for k, v := range f.Require {
+		if v != "" {
+			k += metadataKeySeparator + v
+		}
+		q.Add("meta", k)
+	}
+	for _, k := range f.Exclude {
+		q.Add("nometa", k)
+	}
+	for _, l := range f.Labels {
+		q.Add("label", l)
+	}
+	if f.IncludeDust {
+		q.Set("includeDust", "true")
+	}
+}
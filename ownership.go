@@ -0,0 +1,104 @@
+package walrus
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// An OwnershipProof demonstrates control of an address, e.g. for an exchange's
+// proof of reserves. It contains a message signed by enough of the keys of the
+// address's unlock conditions to spend from it. Verifiers should choose the
+// message themselves, e.g. a random challenge, so that proofs cannot be
+// replayed.
+type OwnershipProof struct {
+	Address          types.UnlockHash       `json:"address"`
+	UnlockConditions types.UnlockConditions `json:"unlockConditions"`
+	Message          string                 `json:"message"`
+	Signatures       []OwnershipSignature   `json:"signatures"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (p OwnershipProof) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Address          types.UnlockHash        `json:"address"`
+		UnlockConditions encodedUnlockConditions `json:"unlockConditions"`
+		Message          string                  `json:"message"`
+		Signatures       []OwnershipSignature    `json:"signatures"`
+	}{p.Address, encodedUnlockConditions(p.UnlockConditions), p.Message, p.Signatures})
+}
+
+// An OwnershipSignature is a signature of an OwnershipProof's SigHash by one
+// of the keys of its unlock conditions.
+type OwnershipSignature struct {
+	PublicKeyIndex uint64 `json:"publicKeyIndex"`
+	Signature      []byte `json:"signature"`
+}
+
+// SigHash returns the hash that must be signed by the keys of the proof's
+// unlock conditions. The hash is never a valid transaction signature hash,
+// so signing it does not authorize any spending.
+func (p *OwnershipProof) SigHash() crypto.Hash {
+	return crypto.HashBytes([]byte("walrus ownership proof " + p.Address.String() + " " + p.Message))
+}
+
+// AddSignature adds a signature of the proof's SigHash by pk, which must be
+// one of the keys of the proof's unlock conditions. It is used for hardware
+// wallets such as the Ledger Nano S, which can sign arbitrary hashes; hot
+// wallets can use Sign instead.
+func (p *OwnershipProof) AddSignature(pk ed25519.PublicKey, sig []byte) error {
+	for i, spk := range p.UnlockConditions.PublicKeys {
+		if spk.Algorithm == types.SignatureEd25519 && bytes.Equal(spk.Key, pk) {
+			p.Signatures = append(p.Signatures, OwnershipSignature{
+				PublicKeyIndex: uint64(i),
+				Signature:      sig,
+			})
+			return nil
+		}
+	}
+	return errors.New("key is not part of the address's unlock conditions")
+}
+
+// Sign signs the proof with key, which must correspond to one of the keys of
+// the proof's unlock conditions, e.g. seed.SecretKey(keyIndex).
+func (p *OwnershipProof) Sign(key ed25519.PrivateKey) error {
+	h := p.SigHash()
+	return p.AddSignature(key.Public().(ed25519.PublicKey), ed25519.Sign(key, h[:]))
+}
+
+// VerifyOwnershipProof checks that p's unlock conditions correspond to its
+// address, and that p carries enough valid signatures to satisfy them. The
+// timelock of the unlock conditions is ignored.
+func VerifyOwnershipProof(p OwnershipProof) error {
+	uc := p.UnlockConditions
+	if uc.UnlockHash() != p.Address {
+		return errors.New("unlock conditions do not match address")
+	} else if uc.SignaturesRequired == 0 {
+		return errors.New("address does not require any signatures")
+	}
+	h := p.SigHash()
+	used := make(map[uint64]bool)
+	for _, sig := range p.Signatures {
+		if sig.PublicKeyIndex >= uint64(len(uc.PublicKeys)) {
+			return fmt.Errorf("signature references nonexistent key %v", sig.PublicKeyIndex)
+		} else if used[sig.PublicKeyIndex] {
+			return fmt.Errorf("multiple signatures by key %v", sig.PublicKeyIndex)
+		}
+		used[sig.PublicKeyIndex] = true
+		pk := uc.PublicKeys[sig.PublicKeyIndex]
+		if pk.Algorithm != types.SignatureEd25519 || len(pk.Key) != ed25519.PublicKeySize {
+			return fmt.Errorf("key %v is not an ed25519 key", sig.PublicKeyIndex)
+		} else if !ed25519.Verify(pk.Key, h[:], sig.Signature) {
+			return fmt.Errorf("invalid signature by key %v", sig.PublicKeyIndex)
+		}
+	}
+	if uint64(len(used)) < uc.SignaturesRequired {
+		return fmt.Errorf("proof has %v signatures, but address requires %v", len(used), uc.SignaturesRequired)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package walrus
+
+import (
+	"errors"
+	"math"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+)
+
+// maxPayoutOutputSize is the maximum total size of the outputs of a single
+// payout transaction. It leaves half of the transaction pool's limit for the
+// inputs funding them.
+const maxPayoutOutputSize = modules.TransactionSizeLimit / 2
+
+// A draftedPayout is an unsigned payout transaction, along with the key index
+// of each input.
+type draftedPayout struct {
+	txn        types.Transaction
+	keyIndices []uint64
+	// the number of payouts paid by txn, which are its first outputs
+	payouts int
+}
+
+// payoutChunks divides payouts into groups whose outputs total at most
+// maxSize bytes, preserving their order.
+func payoutChunks(payouts []Payout, maxSize int) [][]Payout {
+	var chunks [][]Payout
+	var chunk []Payout
+	size := 0
+	for _, p := range payouts {
+		outputSize := len(encoding.Marshal(types.SiacoinOutput{Value: p.Amount, UnlockHash: p.Address}))
+		if len(chunk) > 0 && size+outputSize > maxSize {
+			chunks = append(chunks, chunk)
+			chunk, size = nil, 0
+		}
+		chunk = append(chunk, p)
+		size += outputSize
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// draftPayouts returns unsigned transactions that pay each of payouts, funded
+// by candidates selected according to strategy. Payouts are divided among as
+// many transactions as the size limit requires. The change of each
+// transaction is sent to changeAddr and, if changeAddr belongs to the wallet,
+// may fund later transactions, which must then be broadcast after it.
+func draftPayouts(w *wallet.SeedWallet, candidates []coinInput, strategy string, payouts []Payout, changeAddr types.UnlockHash, feePerByte types.Currency) ([]draftedPayout, error) {
+	candidates = append([]coinInput(nil), candidates...)
+	var drafts []draftedPayout
+	for _, chunk := range payoutChunks(payouts, maxPayoutOutputSize) {
+		outputs := make([]types.SiacoinOutput, len(chunk))
+		for i, p := range chunk {
+			outputs[i] = types.SiacoinOutput{Value: p.Amount, UnlockHash: p.Address}
+		}
+		txn, keyIndices, err := draftTemplate(w, candidates, strategy, outputs, changeAddr, feePerByte, types.ZeroCurrency, nil)
+		if err != nil {
+			return nil, err
+		} else if signedSize(txn) > modules.TransactionSizeLimit {
+			return nil, errors.New("payout transaction would exceed the size limit; consolidate the wallet's outputs first")
+		}
+		drafts = append(drafts, draftedPayout{txn, keyIndices, len(chunk)})
+
+		used := make(map[types.SiacoinOutputID]bool)
+		for _, in := range txn.SiacoinInputs {
+			used[in.ParentID] = true
+		}
+		remaining := candidates[:0]
+		for _, c := range candidates {
+			if !used[c.ParentID] {
+				remaining = append(remaining, c)
+			}
+		}
+		candidates = remaining
+		if len(txn.SiacoinOutputs) > len(outputs) {
+			if info, ok := w.AddressInfo(changeAddr); ok {
+				i := len(txn.SiacoinOutputs) - 1
+				candidates = append(candidates, coinInput{
+					ValuedInput: wallet.ValuedInput{
+						SiacoinInput: types.SiacoinInput{
+							ParentID:         txn.SiacoinOutputID(uint64(i)),
+							UnlockConditions: info.UnlockConditions,
+						},
+						Value: txn.SiacoinOutputs[i].Value,
+					},
+					Height: math.MaxUint64,
+				})
+			}
+		}
+	}
+	return drafts, nil
+}
+
+// signWithSeed signs each siacoin input of txn with seed. Every input must be
+// controlled by a key derived from seed.
+func signWithSeed(w *wallet.SeedWallet, seed wallet.Seed, txn *types.Transaction) error {
+	for _, in := range txn.SiacoinInputs {
+		uh := in.UnlockConditions.UnlockHash()
+		info, ok := w.AddressInfo(uh)
+		if !ok || wallet.StandardUnlockConditions(seed.PublicKey(info.KeyIndex)).UnlockHash() != uh {
+			return errors.New("input " + in.ParentID.String() + " is not controlled by the server's seed")
+		}
+		sig := wallet.StandardTransactionSignature(crypto.Hash(in.ParentID))
+		wallet.AppendTransactionSignature(txn, sig, seed.SecretKey(info.KeyIndex))
+	}
+	return nil
+}
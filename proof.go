@@ -0,0 +1,371 @@
+package walrus
+
+import (
+	"errors"
+	"fmt"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+)
+
+// merkleLeafHash and merkleNodeHash use the same domain separation as the
+// Merkle trees of Sia blocks.
+func merkleLeafHash(leaf []byte) crypto.Hash {
+	return crypto.HashBytes(append([]byte{0}, leaf...))
+}
+
+func merkleNodeHash(left, right crypto.Hash) crypto.Hash {
+	buf := make([]byte, 1+2*crypto.HashSize)
+	buf[0] = 1
+	copy(buf[1:], left[:])
+	copy(buf[1+crypto.HashSize:], right[:])
+	return crypto.HashBytes(buf)
+}
+
+// merkleSplit returns the number of leaves in the left subtree of a tree with
+// n leaves, i.e. the largest power of two less than n.
+func merkleSplit(n uint64) uint64 {
+	k := uint64(1)
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
+
+func merkleRoot(leaves []crypto.Hash) crypto.Hash {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	k := merkleSplit(uint64(len(leaves)))
+	return merkleNodeHash(merkleRoot(leaves[:k]), merkleRoot(leaves[k:]))
+}
+
+// buildMerkleProof returns the sibling hashes on the path from the i'th leaf
+// to the root, starting at the bottom of the tree.
+func buildMerkleProof(leaves []crypto.Hash, i uint64) []crypto.Hash {
+	if len(leaves) == 1 {
+		return nil
+	}
+	k := merkleSplit(uint64(len(leaves)))
+	if i < k {
+		return append(buildMerkleProof(leaves[:k], i), merkleRoot(leaves[k:]))
+	}
+	return append(buildMerkleProof(leaves[k:], i-k), merkleRoot(leaves[:k]))
+}
+
+// verifyMerkleProof reports whether proof proves that leaf is the i'th of n
+// leaves in the tree with the specified root.
+func verifyMerkleProof(root crypto.Hash, leaf []byte, i, n uint64, proof []crypto.Hash) bool {
+	if i >= n {
+		return false
+	}
+	// walk down from the root, recording which side the leaf is on
+	var isLeft []bool
+	for n > 1 {
+		k := merkleSplit(n)
+		isLeft = append(isLeft, i < k)
+		if i < k {
+			n = k
+		} else {
+			i, n = i-k, n-k
+		}
+	}
+	if len(proof) != len(isLeft) {
+		return false
+	}
+	h := merkleLeafHash(leaf)
+	for j, sibling := range proof {
+		if isLeft[len(isLeft)-1-j] {
+			h = merkleNodeHash(h, sibling)
+		} else {
+			h = merkleNodeHash(sibling, h)
+		}
+	}
+	return h == root
+}
+
+// An InclusionProof proves that a transaction or miner payout is included in
+// a block. It does not prove that the block is part of the best chain; compare
+// the ID of BlockHeader against an independent source to establish that.
+type InclusionProof struct {
+	BlockHeight types.BlockHeight `json:"blockHeight"`
+	BlockHeader types.BlockHeader `json:"blockHeader"`
+	// The Sia encoding of the transaction or miner payout, which is a leaf of
+	// the block's Merkle tree. The block's miner payouts precede its
+	// transactions.
+	Leaf      []byte        `json:"leaf"`
+	LeafIndex uint64        `json:"leafIndex"`
+	NumLeaves uint64        `json:"numLeaves"`
+	Proof     []crypto.Hash `json:"proof"`
+}
+
+// Verify checks that Leaf is included in the Merkle root of BlockHeader.
+func (p InclusionProof) Verify() error {
+	if !verifyMerkleProof(p.BlockHeader.MerkleRoot, p.Leaf, p.LeafIndex, p.NumLeaves, p.Proof) {
+		return errors.New("invalid Merkle proof")
+	}
+	return nil
+}
+
+// Transaction verifies p and decodes Leaf as a transaction.
+func (p InclusionProof) Transaction() (txn types.Transaction, err error) {
+	if err := p.Verify(); err != nil {
+		return types.Transaction{}, err
+	} else if err := encoding.Unmarshal(p.Leaf, &txn); err != nil {
+		return types.Transaction{}, fmt.Errorf("leaf is not a transaction: %v", err)
+	}
+	return txn, nil
+}
+
+// An OutputProof proves that a siacoin output was created in a block. It does
+// not prove that the output is unspent.
+type OutputProof struct {
+	InclusionProof
+	OutputID types.SiacoinOutputID `json:"outputID"`
+	// Whether the output is a miner payout, in which case Leaf is the output
+	// itself; otherwise, Leaf is the transaction that created it.
+	MinerPayout bool `json:"minerPayout"`
+	// The index of the output within the block's miner payouts or the
+	// transaction's siacoin outputs.
+	OutputIndex uint64 `json:"outputIndex"`
+}
+
+// Verify checks p and returns the proven output.
+func (p OutputProof) Verify() (types.SiacoinOutput, error) {
+	if err := p.InclusionProof.Verify(); err != nil {
+		return types.SiacoinOutput{}, err
+	}
+	var sco types.SiacoinOutput
+	var id types.SiacoinOutputID
+	if p.MinerPayout {
+		if p.OutputIndex != p.LeafIndex {
+			return types.SiacoinOutput{}, errors.New("miner payout index does not match leaf index")
+		} else if err := encoding.Unmarshal(p.Leaf, &sco); err != nil {
+			return types.SiacoinOutput{}, fmt.Errorf("leaf is not a siacoin output: %v", err)
+		}
+		id = types.SiacoinOutputID(crypto.HashAll(p.BlockHeader.ID(), p.OutputIndex))
+	} else {
+		var txn types.Transaction
+		if err := encoding.Unmarshal(p.Leaf, &txn); err != nil {
+			return types.SiacoinOutput{}, fmt.Errorf("leaf is not a transaction: %v", err)
+		} else if p.OutputIndex >= uint64(len(txn.SiacoinOutputs)) {
+			return types.SiacoinOutput{}, errors.New("output index out of range")
+		}
+		sco = txn.SiacoinOutputs[p.OutputIndex]
+		id = txn.SiacoinOutputID(p.OutputIndex)
+	}
+	if id != p.OutputID {
+		return types.SiacoinOutput{}, errors.New("proven output has a different ID")
+	}
+	return sco, nil
+}
+
+// blockInclusionProof returns a proof that the specified leaf is included in
+// b.
+func blockInclusionProof(b types.Block, height types.BlockHeight, leafIndex uint64) InclusionProof {
+	var leaves [][]byte
+	for _, mp := range b.MinerPayouts {
+		leaves = append(leaves, encoding.Marshal(mp))
+	}
+	for _, txn := range b.Transactions {
+		leaves = append(leaves, encoding.Marshal(txn))
+	}
+	hashes := make([]crypto.Hash, len(leaves))
+	for i, leaf := range leaves {
+		hashes[i] = merkleLeafHash(leaf)
+	}
+	return InclusionProof{
+		BlockHeight: height,
+		BlockHeader: b.Header(),
+		Leaf:        leaves[leafIndex],
+		LeafIndex:   leafIndex,
+		NumLeaves:   uint64(len(leaves)),
+		Proof:       buildMerkleProof(hashes, leafIndex),
+	}
+}
+
+// errNotInChain is returned when a proof cannot be built because the block
+// recorded by the wallet is no longer in the current chain.
+var errNotInChain = errors.New("block is not in the current chain")
+
+// transactionProof returns a proof that the specified confirmed transaction
+// is included in its block.
+func transactionProof(cs ConsensusSet, txn wallet.Transaction) (InclusionProof, error) {
+	b, ok := cs.BlockAtHeight(txn.BlockHeight)
+	if !ok || b.ID() != txn.BlockID {
+		return InclusionProof{}, errNotInChain
+	}
+	txid := txn.ID()
+	for i := range b.Transactions {
+		if b.Transactions[i].ID() == txid {
+			return blockInclusionProof(b, txn.BlockHeight, uint64(len(b.MinerPayouts)+i)), nil
+		}
+	}
+	return InclusionProof{}, errNotInChain
+}
+
+// outputProof returns a proof that the specified output, which must have been
+// created within the wallet's history, is included in the chain.
+func outputProof(w *wallet.SeedWallet, cs ConsensusSet, id types.SiacoinOutputID) (OutputProof, bool, error) {
+	for _, txid := range w.Transactions(-1) {
+		txn, ok := w.Transaction(txid)
+		if !ok {
+			continue
+		}
+		for i := range txn.SiacoinOutputs {
+			if txn.SiacoinOutputID(uint64(i)) == id {
+				ip, err := transactionProof(cs, txn)
+				return OutputProof{
+					InclusionProof: ip,
+					OutputID:       id,
+					OutputIndex:    uint64(i),
+				}, true, err
+			}
+		}
+	}
+	for _, br := range w.BlockRewards(-1) {
+		if br.ID != id || br.Timelock < types.MaturityDelay {
+			continue
+		}
+		height := br.Timelock - types.MaturityDelay
+		b, ok := cs.BlockAtHeight(height)
+		if !ok {
+			return OutputProof{}, true, errNotInChain
+		}
+		for i := range b.MinerPayouts {
+			if b.MinerPayoutID(uint64(i)) == id {
+				return OutputProof{
+					InclusionProof: blockInclusionProof(b, height, uint64(i)),
+					OutputID:       id,
+					MinerPayout:    true,
+					OutputIndex:    uint64(i),
+				}, true, nil
+			}
+		}
+		return OutputProof{}, true, errNotInChain
+	}
+	return OutputProof{}, false, nil
+}
+
+// A BalanceVerification is the result of checking the balance and history
+// reported by a server against proofs of inclusion.
+type BalanceVerification struct {
+	// The balance reported by the server, and the total value of the unspent
+	// outputs whose proofs were verified.
+	Reported types.Currency `json:"reported"`
+	Verified types.Currency `json:"verified"`
+	// The block IDs committed to by the verified proofs. A client that does
+	// not trust the server should compare these against an independent
+	// source, such as a block explorer or a second node.
+	Blocks map[types.BlockHeight]types.BlockID `json:"blocks"`
+	// Each discrepancy found.
+	Mismatches []string `json:"mismatches"`
+}
+
+// OK reports whether no discrepancies were found.
+func (bv BalanceVerification) OK() bool {
+	return len(bv.Mismatches) == 0
+}
+
+// VerifyBalance checks the balance reported by the server by fetching a proof
+// of inclusion for each unspent output and recomputing the balance locally.
+// It also checks the inflow and outflow reported for the specified number of
+// the wallet's most recent transactions in the same way. This guards against a server that
+// fabricates or inflates outputs and transactions; it cannot detect outputs
+// that the server reports as unspent after they have been spent, nor
+// transactions that the server omits.
+func (c *Client) VerifyBalance(history int) (BalanceVerification, error) {
+	bv := BalanceVerification{
+		Verified: types.ZeroCurrency,
+		Blocks:   make(map[types.BlockHeight]types.BlockID),
+	}
+	mismatch := func(format string, args ...interface{}) {
+		bv.Mismatches = append(bv.Mismatches, fmt.Sprintf(format, args...))
+	}
+	addBlock := func(ip InclusionProof) {
+		id := ip.BlockHeader.ID()
+		if prev, ok := bv.Blocks[ip.BlockHeight]; ok && prev != id {
+			mismatch("proofs disagree on the block at height %v", ip.BlockHeight)
+		}
+		bv.Blocks[ip.BlockHeight] = id
+	}
+
+	var err error
+	if bv.Reported, err = c.Balance(false); err != nil {
+		return BalanceVerification{}, err
+	}
+	addrs, err := c.Addresses()
+	if err != nil {
+		return BalanceVerification{}, err
+	}
+	owned := make(map[types.UnlockHash]bool, len(addrs))
+	for _, addr := range addrs {
+		owned[addr] = true
+	}
+	utxos, err := c.UnspentOutputs(false)
+	if err != nil {
+		return BalanceVerification{}, err
+	}
+	for _, o := range utxos {
+		proof, err := c.OutputProof(o.ID)
+		if err != nil {
+			mismatch("no proof for output %v: %v", o.ID, err)
+			continue
+		}
+		sco, err := proof.Verify()
+		if err != nil {
+			mismatch("invalid proof for output %v: %v", o.ID, err)
+			continue
+		} else if proof.OutputID != o.ID || sco.Value.Cmp(o.Value) != 0 || sco.UnlockHash != o.UnlockHash {
+			mismatch("output %v does not match its proof", o.ID)
+			continue
+		} else if !owned[sco.UnlockHash] {
+			mismatch("output %v is not sent to a wallet address", o.ID)
+			continue
+		}
+		addBlock(proof.InclusionProof)
+		bv.Verified = bv.Verified.Add(sco.Value)
+	}
+	if bv.Verified.Cmp(bv.Reported) != 0 {
+		mismatch("reported balance is %v H, but only %v H is proven", bv.Reported, bv.Verified)
+	}
+
+	txids, err := c.Transactions(history)
+	if err != nil {
+		return BalanceVerification{}, err
+	}
+	for _, txid := range txids {
+		rt, err := c.Transaction(txid)
+		if err != nil {
+			return BalanceVerification{}, err
+		}
+		proof, err := c.TransactionProof(txid)
+		if err != nil {
+			mismatch("no proof for transaction %v: %v", txid, err)
+			continue
+		}
+		txn, err := proof.Transaction()
+		if err != nil {
+			mismatch("invalid proof for transaction %v: %v", txid, err)
+			continue
+		} else if txn.ID() != txid || proof.BlockHeader.ID() != rt.BlockID || proof.BlockHeight != rt.BlockHeight {
+			mismatch("transaction %v does not match its proof", txid)
+			continue
+		}
+		addBlock(proof)
+		inflow, outflow := types.ZeroCurrency, types.ZeroCurrency
+		for _, sco := range txn.SiacoinOutputs {
+			if owned[sco.UnlockHash] {
+				inflow = inflow.Add(sco.Value)
+			} else {
+				outflow = outflow.Add(sco.Value)
+			}
+		}
+		if inflow.Cmp(rt.Inflow) != 0 || outflow.Cmp(rt.Outflow) != 0 {
+			mismatch("reported inflow and outflow of transaction %v do not match its proof", txid)
+		}
+	}
+	return bv, nil
+}
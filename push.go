@@ -0,0 +1,336 @@
+package walrus
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var keyPushCursor = []byte("pushCursor")
+
+// Push notification platforms.
+const (
+	PlatformFCM  = "fcm"
+	PlatformAPNs = "apns"
+)
+
+// A PushDevice is a mobile device registered to receive push notifications.
+type PushDevice struct {
+	Token    string `json:"token"`
+	Platform string `json:"platform"`
+	// The event types the device should be notified of. If empty, the device
+	// is notified of all events.
+	Events []string `json:"events"`
+}
+
+func (d PushDevice) wants(typ string) bool {
+	if len(d.Events) == 0 {
+		return true
+	}
+	for _, e := range d.Events {
+		if e == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// A PushSender delivers push notifications to devices on a particular
+// platform.
+type PushSender interface {
+	SendPush(token string, e Event) error
+}
+
+// eventSummary returns a short, human-readable description of e.
+func eventSummary(e Event) string {
+	switch e.Type {
+	case EventDepositReceived:
+		var dr DepositReceipt
+		json.Unmarshal(e.Data, &dr)
+		return fmt.Sprintf("Received %v SC (%v)", formatSC(dr.Value), dr.Reference)
+	case EventPaymentFinal:
+		var p Payment
+		json.Unmarshal(e.Data, &p)
+		return fmt.Sprintf("Payment of %v SC is final (%v)", formatSC(p.Value), p.Reference)
+	case EventPaymentReverted:
+		var p Payment
+		json.Unmarshal(e.Data, &p)
+		return fmt.Sprintf("Payment of %v SC was reverted (%v)", formatSC(p.Value), p.Reference)
+	case EventFileContractWindowStarting, EventFileContractWindowEnding:
+		var fcw FileContractWarning
+		json.Unmarshal(e.Data, &fcw)
+		return fmt.Sprintf("Contract %v: proof window deadline in %v blocks", fcw.ID.String()[:8], fcw.BlocksRemaining)
+	case EventConsolidationReady:
+		var cr ConsolidationReady
+		json.Unmarshal(e.Data, &cr)
+		return fmt.Sprintf("%v block rewards are ready to consolidate", cr.Outputs)
+	case EventSplitReady:
+		var sr SplitReady
+		json.Unmarshal(e.Data, &sr)
+		return fmt.Sprintf("%v SC is ready to split (%v)", formatSC(sr.Value), sr.Rule)
+	case EventSyncStalled:
+		var ss SyncStatus
+		json.Unmarshal(e.Data, &ss)
+		return fmt.Sprintf("Sync stalled at height %v: %v", ss.Height, ss.Reason)
+	case EventSyncResumed:
+		var ss SyncStatus
+		json.Unmarshal(e.Data, &ss)
+		return fmt.Sprintf("Sync resumed at height %v", ss.Height)
+	default:
+		return e.Type
+	}
+}
+
+func postJSON(c *http.Client, url string, header http.Header, v interface{}) error {
+	js, _ := json.Marshal(v)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(js))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer io.Copy(ioutil.Discard, resp.Body)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%v: %s", resp.Status, body)
+	}
+	return nil
+}
+
+// FCMSender delivers push notifications via Firebase Cloud Messaging.
+type FCMSender struct {
+	ServerKey string
+	Client    *http.Client
+}
+
+// SendPush implements PushSender.
+func (s *FCMSender) SendPush(token string, e Event) error {
+	c := s.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	return postJSON(c, "https://fcm.googleapis.com/fcm/send", http.Header{
+		"Authorization": {"key=" + s.ServerKey},
+	}, map[string]interface{}{
+		"to": token,
+		"notification": map[string]string{
+			"title": "walrus",
+			"body":  eventSummary(e),
+		},
+		"data": map[string]string{
+			"type": e.Type,
+			"seq":  strconv.FormatUint(e.Seq, 10),
+		},
+	})
+}
+
+// APNsSender delivers push notifications via the Apple Push Notification
+// service, using token-based authentication.
+type APNsSender struct {
+	KeyID   string
+	TeamID  string
+	Topic   string // the app's bundle ID
+	Key     *ecdsa.PrivateKey
+	Sandbox bool
+	Client  *http.Client
+
+	mu       sync.Mutex
+	jwt      string
+	jwtIssue time.Time
+}
+
+// bearer returns a JWT for authenticating with APNs. Apple rejects tokens
+// older than an hour, and throttles tokens refreshed more often than every 20
+// minutes, so tokens are reused for 50 minutes.
+func (s *APNsSender) bearer() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.jwtIssue) < 50*time.Minute {
+		return s.jwt, nil
+	}
+	enc := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": s.KeyID})
+	claims, _ := json.Marshal(map[string]interface{}{"iss": s.TeamID, "iat": time.Now().Unix()})
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	r, ss, err := ecdsa.Sign(rand.Reader, s.Key, hash[:])
+	if err != nil {
+		return "", err
+	}
+	sig := make([]byte, 64)
+	rb, sb := r.Bytes(), ss.Bytes()
+	copy(sig[32-len(rb):32], rb)
+	copy(sig[64-len(sb):], sb)
+	s.jwt = unsigned + "." + enc.EncodeToString(sig)
+	s.jwtIssue = time.Now()
+	return s.jwt, nil
+}
+
+// SendPush implements PushSender.
+func (s *APNsSender) SendPush(token string, e Event) error {
+	jwt, err := s.bearer()
+	if err != nil {
+		return err
+	}
+	c := s.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	host := "https://api.push.apple.com"
+	if s.Sandbox {
+		host = "https://api.sandbox.push.apple.com"
+	}
+	return postJSON(c, host+"/3/device/"+token, http.Header{
+		"Authorization": {"bearer " + jwt},
+		"Apns-Topic":    {s.Topic},
+	}, map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{
+				"title": "walrus",
+				"body":  eventSummary(e),
+			},
+		},
+		"type": e.Type,
+		"seq":  e.Seq,
+	})
+}
+
+// LoadAPNsKey loads an APNs signing key from a .p8 file, as downloaded from
+// the Apple developer portal.
+func LoadAPNsKey(filename string) (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is not an ECDSA key")
+	}
+	return ecKey, nil
+}
+
+// AddPushDevice registers a device to receive push notifications. If the
+// device is already registered, its settings are replaced.
+func (t *Tracker) AddPushDevice(d PushDevice) error {
+	return t.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketPushDevices), []byte(d.Token), d)
+	})
+}
+
+// RemovePushDevice unregisters a device.
+func (t *Tracker) RemovePushDevice(token string) error {
+	return t.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPushDevices).Delete([]byte(token))
+	})
+}
+
+// PushDevices returns all registered devices.
+func (t *Tracker) PushDevices() (devices []PushDevice) {
+	t.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPushDevices).ForEach(func(_, v []byte) error {
+			var d PushDevice
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			devices = append(devices, d)
+			return nil
+		})
+	})
+	return
+}
+
+// PushPlatforms returns the platforms that the Tracker can deliver push
+// notifications to.
+func (t *Tracker) PushPlatforms() (platforms []string) {
+	for p := range t.push {
+		platforms = append(platforms, p)
+	}
+	return
+}
+
+// SetPushSenders configures the Tracker to deliver new events to registered
+// devices using the specified senders, keyed by platform. Delivery is
+// best-effort: failed notifications are not retried.
+func (t *Tracker) SetPushSenders(senders map[string]PushSender) error {
+	// only deliver events emitted from now on
+	err := t.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(bucketMeta)
+		if meta.Get(keyPushCursor) != nil {
+			return nil
+		}
+		return putJSON(meta, keyPushCursor, tx.Bucket(bucketEvents).Sequence())
+	})
+	if err != nil {
+		return err
+	}
+	t.push = senders
+	go t.pushLoop()
+	t.notifyPush()
+	return nil
+}
+
+func (t *Tracker) notifyPush() {
+	select {
+	case t.pushSignal <- struct{}{}:
+	default:
+	}
+}
+
+func (t *Tracker) pushLoop() {
+	for {
+		select {
+		case <-t.pushSignal:
+		case <-t.closed:
+			return
+		}
+		var cursor uint64
+		t.db.View(func(tx *bolt.Tx) error {
+			getJSON(tx.Bucket(bucketMeta), keyPushCursor, &cursor)
+			return nil
+		})
+		devices := t.PushDevices()
+		if !t.isLeader() {
+			// standbys skip events; the leader delivers them
+			devices = nil
+		}
+		for _, e := range t.EventsAfter(cursor, -1) {
+			for _, d := range devices {
+				if s, ok := t.push[d.Platform]; ok && d.wants(e.Type) {
+					s.SendPush(d.Token, e)
+				}
+			}
+			cursor = e.Seq
+			t.db.Update(func(tx *bolt.Tx) error {
+				return putJSON(tx.Bucket(bucketMeta), keyPushCursor, cursor)
+			})
+		}
+	}
+}
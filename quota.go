@@ -0,0 +1,79 @@
+package walrus
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A Quota limits the resources that clients of a server may consume, allowing
+// hosted deployments to enforce plans without an external gateway. Zero-valued
+// fields impose no limit.
+type Quota struct {
+	// The maximum number of addresses in the wallet, including any addresses
+	// registered by the lookahead window.
+	MaxAddresses int `json:"maxAddresses"`
+	// The maximum number of registered push devices.
+	MaxPushDevices int `json:"maxPushDevices"`
+	// The maximum number of API requests per minute.
+	RequestsPerMinute int `json:"requestsPerMinute"`
+}
+
+// requestCounter tracks the number of requests served, in total and within
+// the current one-minute window.
+type requestCounter struct {
+	mu          sync.Mutex
+	total       uint64
+	window      time.Time
+	windowCount int
+}
+
+// add counts a request, returning false if doing so would exceed limit.
+func (rc *requestCounter) add(limit int) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if now := time.Now(); now.Sub(rc.window) >= time.Minute {
+		rc.window, rc.windowCount = now, 0
+	}
+	if limit > 0 && rc.windowCount >= limit {
+		return false
+	}
+	rc.total++
+	rc.windowCount++
+	return true
+}
+
+// counts returns the total number of requests served, and the number served
+// within the current window.
+func (rc *requestCounter) counts() (total uint64, window int) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if time.Since(rc.window) >= time.Minute {
+		return rc.total, 0
+	}
+	return rc.total, rc.windowCount
+}
+
+// countRequests wraps h, counting each request and rejecting those that
+// exceed the server's request quota.
+func (s *server) countRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !s.requests.add(s.quota.RequestsPerMinute) {
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "Request quota exceeded", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// checkAddressQuota writes an error and returns false if adding an address
+// would exceed the server's address quota. Addresses already in the wallet
+// can always be re-added.
+func (s *server) checkAddressQuota(w http.ResponseWriter, ownsAddress bool) bool {
+	if s.quota.MaxAddresses > 0 && !ownsAddress && len(s.w.Addresses()) >= s.quota.MaxAddresses {
+		http.Error(w, "Address quota exceeded", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,257 @@
+package walrus
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Posting directions.
+const (
+	PostingDebit  = "debit"
+	PostingCredit = "credit"
+)
+
+// Posting accounts. The wallet account is debited when siacoins enter the
+// wallet, and credited when they leave it.
+const (
+	// The wallet itself.
+	AccountWallet = "wallet"
+	// The other parties to the wallet's transactions.
+	AccountExternal = "external"
+	// Miner fees paid by the wallet.
+	AccountFees = "fees"
+	// Block rewards, contract payouts, and siafund claims, which are received
+	// when they mature.
+	AccountIncome = "income"
+)
+
+// ErrUnknownCCID is returned by Tracker.Postings when asked for the postings
+// since a consensus change that the Tracker did not record.
+var ErrUnknownCCID = errors.New("unknown consensus change ID")
+
+// A Posting is a single entry in a double-entry journal of the wallet's
+// balance. The postings of each transaction balance: their debits equal their
+// credits. When a block is reverted, its postings are reversed by new postings
+// in the opposite direction, rather than removed.
+type Posting struct {
+	Seq       uint64         `json:"seq"`
+	Account   string         `json:"account"`
+	Direction string         `json:"direction"`
+	Amount    types.Currency `json:"amount"`
+	// The transaction ID, or for block rewards and contract payouts, the
+	// output ID.
+	TxID      crypto.Hash       `json:"txid"`
+	Height    types.BlockHeight `json:"height"`
+	Timestamp time.Time         `json:"timestamp"`
+	// Whether the posting reverses an earlier one, because its block was
+	// reverted.
+	Reversal bool `json:"reversal,omitempty"`
+}
+
+func postingKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+func addPosting(tx *bolt.Tx, p Posting) error {
+	b := tx.Bucket(bucketPostings)
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	p.Seq = seq
+	if err := putJSON(b, postingKey(seq), p); err != nil {
+		return err
+	} else if p.Reversal {
+		return nil
+	}
+	// index the posting by height, so that it can be reversed
+	return tx.Bucket(bucketActivePostings).Put(activePostingKey(p.Height, seq), nil)
+}
+
+func activePostingKey(height types.BlockHeight, seq uint64) []byte {
+	return append(postingKey(uint64(height)), postingKey(seq)...)
+}
+
+// addEntry adds balanced postings moving amount from the credited account to
+// the debited account.
+func addEntry(tx *bolt.Tx, debit, credit string, amount types.Currency, id crypto.Hash, height types.BlockHeight, timestamp time.Time) error {
+	if amount.IsZero() {
+		return nil
+	}
+	for _, p := range []Posting{
+		{Account: debit, Direction: PostingDebit},
+		{Account: credit, Direction: PostingCredit},
+	} {
+		p.Amount = amount
+		p.TxID = id
+		p.Height = height
+		p.Timestamp = timestamp
+		if err := addPosting(tx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revertPostings reverses the postings recorded at the specified height.
+func (t *Tracker) revertPostings(tx *bolt.Tx, height types.BlockHeight) error {
+	active := tx.Bucket(bucketActivePostings)
+	postings := tx.Bucket(bucketPostings)
+	prefix := postingKey(uint64(height))
+	var keys [][]byte
+	var reversals []Posting
+	c := active.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && string(k[:8]) == string(prefix); k, _ = c.Next() {
+		var p Posting
+		if !getJSON(postings, k[8:], &p) {
+			return errors.New("missing posting")
+		}
+		p.Reversal = true
+		if p.Direction == PostingDebit {
+			p.Direction = PostingCredit
+		} else {
+			p.Direction = PostingDebit
+		}
+		keys = append(keys, k)
+		reversals = append(reversals, p)
+	}
+	// can't modify a bucket while iterating over it
+	for _, k := range keys {
+		if err := active.Delete(k); err != nil {
+			return err
+		}
+	}
+	for _, p := range reversals {
+		if err := addPosting(tx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyPostings records the postings resulting from the applied blocks in cc,
+// the first of which is at the specified height. It must be called after
+// applyFlows, which records the values of the wallet's outputs.
+func (t *Tracker) applyPostings(tx *bolt.Tx, cc modules.ConsensusChange, height types.BlockHeight) error {
+	outputs := tx.Bucket(bucketOutputs)
+	for i, b := range cc.AppliedBlocks {
+		h := height + types.BlockHeight(i)
+		timestamp := time.Unix(int64(b.Timestamp), 0)
+		for _, txn := range b.Transactions {
+			in, out := types.ZeroCurrency, types.ZeroCurrency
+			for _, sci := range txn.SiacoinInputs {
+				var v types.Currency
+				if getJSON(outputs, sci.ParentID[:], &v) {
+					in = in.Add(v)
+				}
+			}
+			for _, sco := range txn.SiacoinOutputs {
+				if t.w.OwnsAddress(sco.UnlockHash) {
+					out = out.Add(sco.Value)
+				}
+			}
+			id := crypto.Hash(txn.ID())
+			if in.Cmp(out) < 0 {
+				if err := addEntry(tx, AccountWallet, AccountExternal, out.Sub(in), id, h, timestamp); err != nil {
+					return err
+				}
+				continue
+			} else if in.Cmp(out) == 0 {
+				continue
+			}
+			// attribute the fees to the wallet first; the remainder was sent
+			// to other parties
+			disposed := in.Sub(out)
+			fee := types.ZeroCurrency
+			for _, f := range txn.MinerFees {
+				fee = fee.Add(f)
+			}
+			if fee.Cmp(disposed) > 0 {
+				fee = disposed
+			}
+			if err := addEntry(tx, AccountExternal, AccountWallet, disposed.Sub(fee), id, h, timestamp); err != nil {
+				return err
+			} else if err := addEntry(tx, AccountFees, AccountWallet, fee, id, h, timestamp); err != nil {
+				return err
+			}
+		}
+	}
+
+	// delayed outputs are received when they mature
+	matured := make(map[types.SiacoinOutputID]types.BlockHeight)
+	for _, diff := range cc.DelayedSiacoinOutputDiffs {
+		if diff.Direction == modules.DiffRevert {
+			matured[diff.ID] = diff.MaturityHeight
+		}
+	}
+	for _, diff := range cc.SiacoinOutputDiffs {
+		mh, ok := matured[diff.ID]
+		if !ok || diff.Direction != modules.DiffApply || !t.w.OwnsAddress(diff.SiacoinOutput.UnlockHash) {
+			continue
+		}
+		var timestamp time.Time
+		if mh >= height && int(mh-height) < len(cc.AppliedBlocks) {
+			timestamp = time.Unix(int64(cc.AppliedBlocks[mh-height].Timestamp), 0)
+		}
+		if err := addEntry(tx, AccountWallet, AccountIncome, diff.SiacoinOutput.Value, crypto.Hash(diff.ID), mh, timestamp); err != nil {
+			return err
+		}
+	}
+
+	// remember where the postings of cc end, so that clients can resume from
+	// it
+	seq := tx.Bucket(bucketPostings).Sequence()
+	return putJSON(tx.Bucket(bucketPostingCCIDs), cc.ID[:], seq)
+}
+
+// Postings returns the postings recorded after the specified consensus change,
+// ordered oldest-to-newest, along with the ID of the last consensus change
+// processed, which can be passed as since to receive subsequent postings. If
+// since is the zero ID, every posting is returned. If max >= 0, at most max
+// postings are returned; if more remain, the returned ID is zero, and the
+// listing should be continued with PostingsAfter.
+func (t *Tracker) Postings(since modules.ConsensusChangeID, max int) (postings []Posting, ccid modules.ConsensusChangeID, err error) {
+	var seq uint64
+	err = t.db.View(func(tx *bolt.Tx) error {
+		if since != (modules.ConsensusChangeID{}) && !getJSON(tx.Bucket(bucketPostingCCIDs), since[:], &seq) {
+			return ErrUnknownCCID
+		}
+		postings, ccid = postingsAfter(tx, seq, max)
+		return nil
+	})
+	return
+}
+
+// PostingsAfter is like Postings, but returns the postings with sequence
+// numbers greater than seq.
+func (t *Tracker) PostingsAfter(seq uint64, max int) (postings []Posting, ccid modules.ConsensusChangeID) {
+	t.db.View(func(tx *bolt.Tx) error {
+		postings, ccid = postingsAfter(tx, seq, max)
+		return nil
+	})
+	return
+}
+
+func postingsAfter(tx *bolt.Tx, seq uint64, max int) (postings []Posting, ccid modules.ConsensusChangeID) {
+	c := tx.Bucket(bucketPostings).Cursor()
+	k, v := c.Seek(postingKey(seq + 1))
+	for ; k != nil && len(postings) != max; k, v = c.Next() {
+		var p Posting
+		if json.Unmarshal(v, &p) == nil {
+			postings = append(postings, p)
+		}
+	}
+	if k == nil {
+		copy(ccid[:], tx.Bucket(bucketMeta).Get(keyCCID))
+	}
+	return
+}
@@ -0,0 +1,120 @@
+package walrus
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+)
+
+// A Replica is a read-only walrus server that mirrors a primary walrus server
+// rather than following the blockchain itself. It requires no consensus set or
+// wallet database, making it a cheap way to serve dashboards far from the
+// primary.
+//
+// Responses from the primary are cached until the primary processes a new
+// consensus change, or until they are older than the Replica's maximum age
+// (since some state, such as Limbo and memos, changes independently of
+// consensus). Requests other than GET are rejected.
+type Replica struct {
+	primary string
+	c       *Client
+	maxAge  time.Duration
+
+	mu    sync.Mutex
+	ccid  crypto.Hash
+	cache map[string]replicaEntry
+}
+
+type replicaEntry struct {
+	header  http.Header
+	body    []byte
+	fetched time.Time
+}
+
+// fetch retrieves the response for the specified URI from the primary.
+func (r *Replica) fetch(uri string) (replicaEntry, int, error) {
+	resp, err := http.Get(r.primary + uri)
+	if err != nil {
+		return replicaEntry{}, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return replicaEntry{}, 0, err
+	}
+	return replicaEntry{
+		header:  resp.Header,
+		body:    body,
+		fetched: time.Now(),
+	}, resp.StatusCode, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (r *Replica) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Replica is read-only", http.StatusMethodNotAllowed)
+		return
+	}
+	uri := req.URL.RequestURI()
+	r.mu.Lock()
+	e, ok := r.cache[uri]
+	r.mu.Unlock()
+	if !ok || time.Since(e.fetched) > r.maxAge {
+		var code int
+		var err error
+		e, code, err = r.fetch(uri)
+		if err != nil {
+			http.Error(w, "Couldn't reach primary: "+err.Error(), http.StatusBadGateway)
+			return
+		} else if code != http.StatusOK {
+			// don't cache errors
+			http.Error(w, strings.TrimSpace(string(e.body)), code)
+			return
+		}
+		r.mu.Lock()
+		r.cache[uri] = e
+		r.mu.Unlock()
+	}
+	for k, vs := range e.header {
+		w.Header()[k] = vs
+	}
+	w.Write(e.body)
+}
+
+// Sync polls the primary at the Replica's maximum age, discarding cached
+// responses whenever the primary processes a new consensus change. It
+// returns when ctx is cancelled.
+func (r *Replica) Sync(ctx context.Context) error {
+	for {
+		if info, err := r.c.ConsensusInfo(); err == nil {
+			r.mu.Lock()
+			if info.CCID != r.ccid {
+				r.ccid = info.CCID
+				r.cache = make(map[string]replicaEntry)
+			}
+			r.mu.Unlock()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.maxAge):
+		}
+	}
+}
+
+// NewReplica returns a Replica of the walrus server at the specified address.
+// Cached responses are refreshed after maxAge.
+func NewReplica(primary string, maxAge time.Duration) *Replica {
+	c := NewClient(primary)
+	return &Replica{
+		primary: c.addr,
+		c:       c,
+		maxAge:  maxAge,
+		cache:   make(map[string]replicaEntry),
+	}
+}
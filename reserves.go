@@ -0,0 +1,176 @@
+package walrus
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+	"lukechampine.com/walrus/api"
+)
+
+// A ReservesAttestation is a proof of reserves: it lists every address in the
+// wallet holding siacoins, along with its balance at the stated height and an
+// OwnershipProof demonstrating control of it. Each proof's message commits to
+// the attestation's height, block ID, and Merkle root (see
+// ReservesProofMessage), so signatures cannot be reused in another
+// attestation.
+type ReservesAttestation struct {
+	Height  types.BlockHeight `json:"height"`
+	BlockID types.BlockID     `json:"blockID"`
+	// The challenge supplied by the auditor.
+	Message string         `json:"message"`
+	Total   types.Currency `json:"total"`
+	// The root of a Merkle tree whose leaves are the entries' addresses and
+	// balances; see ReservesLeaf.
+	MerkleRoot crypto.Hash     `json:"merkleRoot"`
+	Entries    []ReservesEntry `json:"entries"`
+}
+
+// A ReservesEntry is an address included in a ReservesAttestation.
+type ReservesEntry struct {
+	Address types.UnlockHash `json:"address"`
+	Balance types.Currency   `json:"balance"`
+	// The seed index of the address's key.
+	KeyIndex uint64         `json:"keyIndex"`
+	Proof    OwnershipProof `json:"proof"`
+}
+
+// ReservesLeaf returns the Merkle leaf for an address and its balance: the
+// BLAKE2b hash of a zero byte, the address's 32-byte hash, and the balance in
+// hastings as a decimal string.
+func ReservesLeaf(addr types.UnlockHash, balance types.Currency) crypto.Hash {
+	b := append([]byte{0}, addr[:]...)
+	return crypto.HashBytes(append(b, balance.String()...))
+}
+
+// reservesMerkleRoot returns the root of the Merkle tree of entries. Interior
+// nodes are the hash of a one byte followed by their children; a node without
+// a sibling is promoted to the next level unchanged.
+func reservesMerkleRoot(entries []ReservesEntry) crypto.Hash {
+	if len(entries) == 0 {
+		return crypto.Hash{}
+	}
+	level := make([]crypto.Hash, len(entries))
+	for i, e := range entries {
+		level[i] = ReservesLeaf(e.Address, e.Balance)
+	}
+	for len(level) > 1 {
+		var next []crypto.Hash
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			b := append([]byte{1}, level[i][:]...)
+			next = append(next, crypto.HashBytes(append(b, level[i+1][:]...)))
+		}
+		level = next
+	}
+	return level[0]
+}
+
+// ReservesProofMessage returns the message that each OwnershipProof of a
+// ReservesAttestation must carry.
+func ReservesProofMessage(a ReservesAttestation) string {
+	return fmt.Sprintf("reserves height %v block %v root %v: %v", a.Height, a.BlockID, a.MerkleRoot, a.Message)
+}
+
+// newReservesAttestation returns an unsigned attestation of the specified
+// balances, which are sorted by address. info returns the unlock conditions
+// and key index of an address.
+func newReservesAttestation(height types.BlockHeight, id types.BlockID, message string, balances map[types.UnlockHash]types.Currency, info func(types.UnlockHash) (types.UnlockConditions, uint64)) ReservesAttestation {
+	a := ReservesAttestation{
+		Height:  height,
+		BlockID: id,
+		Message: message,
+		Total:   types.ZeroCurrency,
+		Entries: make([]ReservesEntry, 0, len(balances)),
+	}
+	for addr, bal := range balances {
+		a.Entries = append(a.Entries, ReservesEntry{Address: addr, Balance: bal})
+		a.Total = a.Total.Add(bal)
+	}
+	sort.Slice(a.Entries, func(i, j int) bool {
+		return bytes.Compare(a.Entries[i].Address[:], a.Entries[j].Address[:]) < 0
+	})
+	a.MerkleRoot = reservesMerkleRoot(a.Entries)
+	proofMessage := ReservesProofMessage(a)
+	for i := range a.Entries {
+		e := &a.Entries[i]
+		var uc types.UnlockConditions
+		uc, e.KeyIndex = info(e.Address)
+		e.Proof = OwnershipProof{
+			Address:          e.Address,
+			UnlockConditions: uc,
+			Message:          proofMessage,
+		}
+	}
+	return a
+}
+
+// SeedSigningKey returns a function that derives the secret key at each index
+// of seed, for use with ReservesAttestation.Sign.
+func SeedSigningKey(seed wallet.Seed) func(keyIndex uint64) ed25519.PrivateKey {
+	return func(keyIndex uint64) ed25519.PrivateKey {
+		return ed25519.PrivateKey(seed.SecretKey(keyIndex))
+	}
+}
+
+// Sign signs the OwnershipProof of each entry with the key returned by key for
+// the entry's KeyIndex; see SeedSigningKey. Attestations for hardware wallets
+// can instead be signed entry-by-entry; see OwnershipProof.
+func (a *ReservesAttestation) Sign(key func(keyIndex uint64) ed25519.PrivateKey) error {
+	for i := range a.Entries {
+		e := &a.Entries[i]
+		if err := e.Proof.Sign(key(e.KeyIndex)); err != nil {
+			return fmt.Errorf("couldn't sign proof for %v: %w", e.Address, err)
+		}
+	}
+	return nil
+}
+
+// VerifyReserves checks that a is internally consistent and fully signed: its
+// entries are sorted and unique, their balances sum to its total, they hash to
+// its Merkle root, and each carries a valid OwnershipProof for the expected
+// message. The balances themselves are not checked against the blockchain;
+// auditors should compare them to the state of an independent node at the
+// attestation's height.
+func VerifyReserves(a ReservesAttestation) error {
+	total := types.ZeroCurrency
+	for i, e := range a.Entries {
+		if i > 0 && bytes.Compare(a.Entries[i-1].Address[:], e.Address[:]) >= 0 {
+			return errors.New("entries are not sorted by address, or contain duplicates")
+		}
+		total = total.Add(e.Balance)
+	}
+	if !total.Equals(a.Total) {
+		return fmt.Errorf("balances sum to %v, but total is %v", total, a.Total)
+	} else if reservesMerkleRoot(a.Entries) != a.MerkleRoot {
+		return errors.New("entries do not match Merkle root")
+	}
+	proofMessage := ReservesProofMessage(a)
+	for _, e := range a.Entries {
+		if e.Proof.Address != e.Address {
+			return fmt.Errorf("proof for %v is for a different address", e.Address)
+		} else if e.Proof.Message != proofMessage {
+			return fmt.Errorf("proof for %v has the wrong message", e.Address)
+		} else if err := VerifyOwnershipProof(e.Proof); err != nil {
+			return fmt.Errorf("invalid proof for %v: %w", e.Address, err)
+		}
+	}
+	return nil
+}
+
+// Reserves returns an unsigned proof of reserves for the wallet, carrying the
+// specified challenge message. The attestation must be signed, e.g. via its
+// Sign method, before it is given to the auditor.
+func (c *Client) Reserves(message string) (a ReservesAttestation, err error) {
+	err = c.get(api.Reserves+"?message="+url.QueryEscape(message), &a)
+	return
+}
@@ -0,0 +1,72 @@
+package walrus
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// A RetryPolicy controls how a Client retries idempotent (GET) requests that
+// fail with a network error or a transient status code. Other requests are
+// never retried.
+type RetryPolicy struct {
+	// The maximum number of attempts, including the first. Values less than
+	// 2 disable retries.
+	MaxAttempts int
+	// The delay before the first retry. Each subsequent delay is doubled, up
+	// to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// The fraction by which each delay is randomly adjusted, e.g. 0.2 for
+	// ±20%.
+	Jitter float64
+	// The status codes that are retried.
+	RetryOn []int
+}
+
+// DefaultRetryPolicy is the RetryPolicy used by a Client unless WithRetryPolicy
+// is specified.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	Jitter:         0.2,
+	RetryOn:        []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+}
+
+// retryable reports whether a request that failed with err should be
+// retried.
+func (p RetryPolicy) retryable(err error) bool {
+	if apiErr, ok := err.(*APIError); ok {
+		for _, code := range p.RetryOn {
+			if apiErr.StatusCode == code {
+				return true
+			}
+		}
+		return false
+	}
+	return true // network error
+}
+
+// backoff returns the delay before the specified retry, starting from 1.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < retry && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		d = time.Duration(float64(d) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+	return d
+}
+
+// WithRetryPolicy sets the Client's RetryPolicy. To disable retries, pass the
+// zero RetryPolicy.
+func WithRetryPolicy(p RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retry = p
+	}
+}
@@ -0,0 +1,60 @@
+package walrus
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"lukechampine.com/us/wallet"
+)
+
+// CustomRoutePrefix is the path prefix required of custom routes. Reserving
+// a prefix ensures that custom routes never conflict with built-in routes.
+const CustomRoutePrefix = "/custom/"
+
+// A RouteContext provides custom routes with access to the server's wallet
+// and chain state.
+type RouteContext struct {
+	Wallet          *wallet.SeedWallet
+	ConsensusSet    ConsensusSet
+	TransactionPool TransactionPool
+	// Nil if the server has no Tracker.
+	Tracker *Tracker
+}
+
+// A RouteHandler handles requests to a custom route.
+type RouteHandler func(rc RouteContext, w http.ResponseWriter, req *http.Request, ps httprouter.Params)
+
+type customRoute struct {
+	method, path string
+	handler      RouteHandler
+}
+
+// WithRoute adds a custom route to the server, allowing programs that embed
+// walrus to serve bespoke endpoints alongside the built-in API. The path must
+// begin with CustomRoutePrefix, and may contain httprouter-style parameters,
+// e.g. "/custom/invoices/:id".
+func WithRoute(method, path string, h RouteHandler) ServerOption {
+	if !strings.HasPrefix(path, CustomRoutePrefix) {
+		panic("walrus: custom route " + path + " does not begin with " + CustomRoutePrefix)
+	}
+	return func(s *server) {
+		s.routes = append(s.routes, customRoute{method, path, h})
+	}
+}
+
+// registerCustomRoutes adds the server's custom routes to mux.
+func (s *server) registerCustomRoutes(mux *httprouter.Router) {
+	rc := RouteContext{
+		Wallet:          s.w,
+		ConsensusSet:    s.chain,
+		TransactionPool: s.chain,
+		Tracker:         s.t,
+	}
+	for _, r := range s.routes {
+		h := r.handler
+		mux.Handle(r.method, r.path, func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+			h(rc, w, req, ps)
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package walrus
+
+import (
+	"strconv"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/walrus/api"
+)
+
+// A Sandbox is a simulated blockchain that can be manipulated via the
+// /sandbox routes, allowing integrators to exercise their deposit and
+// withdrawal logic, including its handling of reorgs, without real funds. See
+// walrustest.Chain for an implementation.
+type Sandbox interface {
+	// Faucet mines a block containing a transaction that sends value to addr
+	// out of thin air.
+	Faucet(addr types.UnlockHash, value types.Currency) (types.TransactionID, error)
+	// Mine mines n blocks, the first of which contains the transactions
+	// awaiting confirmation.
+	Mine(n int) ([]types.BlockID, error)
+	// Reorg replaces the most recent depth blocks with depth+1 new blocks.
+	Reorg(depth int) ([]types.BlockID, error)
+}
+
+// maxSandboxBlocks is the maximum number of blocks that can be mined or
+// reverted by a single request to the /sandbox routes.
+const maxSandboxBlocks = 1000
+
+// SandboxFaucet sends value to addr in a new block, and returns the ID of the
+// transaction that did so. The server must be running in sandbox mode.
+func (c *Client) SandboxFaucet(addr types.UnlockHash, value types.Currency) (txid types.TransactionID, err error) {
+	var resp ResponseSandboxFaucet
+	err = c.post(api.SandboxFaucet, RequestSandboxFaucet{Address: addr, Value: value}, &resp)
+	return resp.TransactionID, err
+}
+
+// SandboxMine mines n blocks, confirming any broadcast transactions, and
+// returns their IDs. The server must be running in sandbox mode.
+func (c *Client) SandboxMine(n int) (ids []types.BlockID, err error) {
+	err = c.post(api.SandboxMine+"?blocks="+strconv.Itoa(n), nil, &ids)
+	return
+}
+
+// SandboxReorg replaces the most recent depth blocks with depth+1 new blocks,
+// and returns the IDs of the new blocks. The server must be running in sandbox
+// mode.
+func (c *Client) SandboxReorg(depth int) (ids []types.BlockID, err error) {
+	err = c.post(api.SandboxReorg+"?depth="+strconv.Itoa(depth), nil, &ids)
+	return
+}
@@ -0,0 +1,151 @@
+package walrus
+
+import (
+	"errors"
+	"math"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+)
+
+// deriveAddress derives an address from seed at the wallet's current seed
+// index, and adds it to the wallet.
+func (c *Client) deriveAddress(seed wallet.Seed) (types.UnlockHash, error) {
+	index, err := c.SeedIndex()
+	if err != nil {
+		return types.UnlockHash{}, err
+	}
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(index)),
+		KeyIndex:         index,
+	}
+	if err := c.AddAddress(info); err != nil {
+		return types.UnlockHash{}, err
+	}
+	return info.UnlockConditions.UnlockHash(), nil
+}
+
+// coinInputs returns the candidates for coin selection among utxos, along
+// with the key index of each.
+func (c *Client) coinInputs(utxos []ResponseUnspentOutput) ([]coinInput, map[types.SiacoinOutputID]uint64, error) {
+	infos := make(map[types.UnlockHash]wallet.SeedAddressInfo)
+	keys := make(map[types.SiacoinOutputID]uint64)
+	candidates := make([]coinInput, len(utxos))
+	for i, o := range utxos {
+		info, ok := infos[o.UnlockHash]
+		if !ok {
+			var err error
+			if info, err = c.AddressInfo(o.UnlockHash); err != nil {
+				return nil, nil, err
+			}
+			infos[o.UnlockHash] = info
+		}
+		keys[o.ID] = info.KeyIndex
+		candidates[i] = coinInput{
+			ValuedInput: wallet.ValuedInput{
+				SiacoinInput: types.SiacoinInput{
+					ParentID:         o.ID,
+					UnlockConditions: info.UnlockConditions,
+				},
+				Value: o.Value,
+			},
+			Height: o.BlockHeight,
+		}
+		if o.Limbo {
+			candidates[i].Height = math.MaxUint64
+		}
+	}
+	return candidates, keys, nil
+}
+
+// SendOptions customize how SendSiacoins and SendSiacoinsMulti fund
+// transactions.
+type SendOptions struct {
+	// The coin selection strategy, e.g. SelectOldest. Defaults to
+	// SelectMinInputs.
+	Strategy string
+}
+
+// SendSiacoins sends amount to dest, returning the ID of the broadcast
+// transaction. See SendSiacoinsMulti.
+func (c *Client) SendSiacoins(seed wallet.Seed, amount types.Currency, dest types.UnlockHash, opts ...SendOptions) (types.TransactionID, error) {
+	return c.SendSiacoinsMulti(seed, []types.SiacoinOutput{{Value: amount, UnlockHash: dest}}, opts...)
+}
+
+// SendSiacoinsMulti builds a transaction creating the specified outputs,
+// signs it with seed, and broadcasts it, returning its ID. The transaction is
+// funded by the wallet's unlocked unspent outputs, including those created by
+// transactions in Limbo, and pays the server's recommended fee. Any change is
+// sent to a new address derived from seed at the wallet's current seed index.
+// The seed must be the seed that the wallet's addresses were derived from.
+func (c *Client) SendSiacoinsMulti(seed wallet.Seed, outputs []types.SiacoinOutput, opts ...SendOptions) (types.TransactionID, error) {
+	if len(outputs) == 0 {
+		return types.TransactionID{}, errors.New("no outputs specified")
+	}
+	var strategy string
+	for _, o := range opts {
+		if o.Strategy != "" {
+			strategy = o.Strategy
+		}
+	}
+	if !validStrategy(strategy) {
+		return types.TransactionID{}, errors.New("unknown coin selection strategy")
+	}
+	var amount types.Currency
+	for _, o := range outputs {
+		amount = amount.Add(o.Value)
+	}
+	feePerByte, err := c.RecommendedFee()
+	if err != nil {
+		return types.TransactionID{}, err
+	}
+	utxos, err := c.UnspentOutputs(true)
+	if err != nil {
+		return types.TransactionID{}, err
+	}
+	candidates, keys, err := c.coinInputs(unlockedOutputs(utxos))
+	if err != nil {
+		return types.TransactionID{}, err
+	}
+	used, fee, change, ok := selectCoins(strategy, amount, feePerByte, candidates)
+	if !ok {
+		return types.TransactionID{}, errors.New("insufficient funds")
+	}
+
+	txn := types.Transaction{
+		SiacoinOutputs: append([]types.SiacoinOutput(nil), outputs...),
+		MinerFees:      []types.Currency{fee},
+	}
+	if !change.IsZero() {
+		addr, err := c.deriveAddress(seed)
+		if err != nil {
+			return types.TransactionID{}, err
+		}
+		txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{
+			Value:      change,
+			UnlockHash: addr,
+		})
+	}
+	for _, in := range used {
+		txn.SiacoinInputs = append(txn.SiacoinInputs, in.SiacoinInput)
+	}
+	for _, in := range used {
+		sig := wallet.StandardTransactionSignature(crypto.Hash(in.ParentID))
+		wallet.AppendTransactionSignature(&txn, sig, seed.SecretKey(keys[in.ParentID]))
+	}
+
+	parents, err := c.UnconfirmedParents(txn)
+	if err != nil {
+		return types.TransactionID{}, err
+	}
+	txnSet := make([]types.Transaction, 0, len(parents)+1)
+	for _, p := range parents {
+		txnSet = append(txnSet, p.Transaction)
+	}
+	txnSet = append(txnSet, txn)
+	if _, err := c.Broadcast(txnSet); err != nil {
+		return types.TransactionID{}, err
+	}
+	return txn.ID(), nil
+}
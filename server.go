@@ -1,19 +1,48 @@
 package walrus
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"math"
+	"math/big"
 	"net/http"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/encoding"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/types"
 	"lukechampine.com/us/wallet"
+	"lukechampine.com/walrus/api"
+	"rsc.io/qr"
 )
 
+// A ConsensusSet provides information about the current state of the
+// blockchain.
+type ConsensusSet interface {
+	BlockAtHeight(types.BlockHeight) (types.Block, bool)
+	ChildTarget(types.BlockID) (types.Target, bool)
+	CurrentBlock() types.Block
+	Height() types.BlockHeight
+}
+
+// A Gateway reports the peers that the server is connected to.
+type Gateway interface {
+	Peers() []modules.Peer
+}
+
 // A TransactionPool can broadcast transactions and estimate transaction
 // fees.
 type TransactionPool interface {
@@ -33,13 +62,347 @@ func writeJSON(w http.ResponseWriter, v interface{}) {
 	enc.Encode(v)
 }
 
+// fieldSet parses a comma-separated list of fields. It returns nil if fields
+// is empty.
+func fieldSet(fields string) map[string]bool {
+	if fields == "" {
+		return nil
+	}
+	keep := make(map[string]bool)
+	for _, f := range strings.Split(fields, ",") {
+		keep[strings.TrimSpace(f)] = true
+	}
+	return keep
+}
+
+// pruneFields returns the JSON encoding of v, decoded generically and pruned
+// to the top-level fields in keep. If v is an array, each element is pruned.
+func pruneFields(v interface{}, keep map[string]bool) (interface{}, error) {
+	prune := func(x interface{}) interface{} {
+		obj, ok := x.(map[string]interface{})
+		if !ok {
+			return x
+		}
+		for k := range obj {
+			if !keep[k] {
+				delete(obj, k)
+			}
+		}
+		return obj
+	}
+
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	// preserve large integers
+	dec := json.NewDecoder(strings.NewReader(string(js)))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	if elems, ok := generic.([]interface{}); ok {
+		for i := range elems {
+			elems[i] = prune(elems[i])
+		}
+	} else {
+		generic = prune(generic)
+	}
+	return generic, nil
+}
+
+// writeJSONFields is like writeJSON, but if fields (a comma-separated list) is
+// non-empty, the response is pruned to the specified top-level fields. If the
+// response is an array, each element is pruned.
+func writeJSONFields(w http.ResponseWriter, v interface{}, fields string) {
+	keep := fieldSet(fields)
+	if keep == nil {
+		writeJSON(w, v)
+		return
+	}
+	generic, err := pruneFields(v, keep)
+	if err != nil {
+		http.Error(w, "Could not encode response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, generic)
+}
+
+// ndjsonFlushInterval is the number of lines written by writeNDJSON between
+// flushes.
+const ndjsonFlushInterval = 100
+
+// writeNDJSON writes each element of the slice v as a line of JSON, pruned to
+// fields as in writeJSONFields. The response is flushed periodically, so that
+// clients can decode it incrementally.
+func writeNDJSON(w http.ResponseWriter, v interface{}, fields string) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	keep := fieldSet(fields)
+	enc := json.NewEncoder(w)
+	val := reflect.ValueOf(v)
+	for i := 0; i < val.Len(); i++ {
+		elem := val.Index(i).Interface()
+		if keep != nil {
+			var err error
+			if elem, err = pruneFields(elem, keep); err != nil {
+				// the status has already been sent; truncate the response
+				return
+			}
+		}
+		if enc.Encode(elem) != nil {
+			return
+		}
+		if flusher != nil && (i+1)%ndjsonFlushInterval == 0 {
+			flusher.Flush()
+		}
+	}
+}
+
+// writeListing writes the slice v in the format requested by req: either a
+// JSON array (the default) or newline-delimited JSON.
+func writeListing(w http.ResponseWriter, req *http.Request, v interface{}) {
+	switch req.FormValue("format") {
+	case "", "json":
+		writeJSONFields(w, v, req.FormValue("fields"))
+	case "ndjson":
+		writeNDJSON(w, v, req.FormValue("fields"))
+	default:
+		http.Error(w, "Invalid format: must be 'json' or 'ndjson'", http.StatusBadRequest)
+	}
+}
+
+// A page selects a range of a listing. The cursor is the ID of the last item
+// of the previous page.
+type page struct {
+	cursor    crypto.Hash
+	hasCursor bool
+	limit     int
+}
+
+// parsePage parses the 'limit' query parameter of req and the cursor stored in
+// the specified query parameter.
+func parsePage(req *http.Request, cursorParam string) (p page, err error) {
+	p.limit = -1
+	if req.FormValue("limit") != "" {
+		p.limit, err = strconv.Atoi(req.FormValue("limit"))
+		if err != nil || p.limit < 0 {
+			return page{}, errors.New("invalid 'limit' value")
+		}
+	}
+	if req.FormValue(cursorParam) != "" {
+		if err := p.cursor.LoadString(req.FormValue(cursorParam)); err != nil {
+			return page{}, fmt.Errorf("invalid '%v' value: %v", cursorParam, err)
+		}
+		p.hasCursor = true
+	}
+	return p, nil
+}
+
+// active reports whether any pagination parameters were supplied.
+func (p page) active() bool {
+	return p.hasCursor || p.limit >= 0
+}
+
+// bounds returns the range of an n-item listing selected by p, where id
+// returns the ID of the i'th item. It returns false if the cursor is not in
+// the listing.
+func (p page) bounds(n int, id func(int) crypto.Hash) (start, end int, ok bool) {
+	if p.hasCursor {
+		start = -1
+		for i := 0; i < n; i++ {
+			if id(i) == p.cursor {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return 0, 0, false
+		}
+	}
+	end = n
+	if p.limit >= 0 && start+p.limit < n {
+		end = start + p.limit
+	}
+	return start, end, true
+}
+
+// errCursorNotFound is the response to a request whose cursor is not in the
+// listing.
+const errCursorNotFound = "Cursor not found; it may have been removed by a reorg"
+
+// DefaultMaxPageSize is the default maximum number of items returned by a
+// single request to a listing endpoint, such as /transactions.
+const DefaultMaxPageSize = 5000
+
+// checkPageSize writes a 400 response and returns false if n, the value of
+// the specified query parameter, exceeds the server's maximum page size.
+func (s *server) checkPageSize(w http.ResponseWriter, param string, n int) bool {
+	if s.maxPage > 0 && n > s.maxPage {
+		http.Error(w, fmt.Sprintf("Invalid '%v' value: exceeds the maximum page size of %v", param, s.maxPage), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// checkLabelFilter writes a 400 response and returns false if req filters by
+// address label, but the server has no Tracker to store labels.
+func (s *server) checkLabelFilter(w http.ResponseWriter, req *http.Request) bool {
+	if s.t == nil && len(req.URL.Query()["label"]) > 0 {
+		http.Error(w, "Label filters require a Tracker", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// checkListingSize writes a 413 response and returns false if a listing of n
+// items, requested without a limit, exceeds the server's maximum page size.
+func (s *server) checkListingSize(w http.ResponseWriter, n int) bool {
+	if s.maxPage > 0 && n > s.maxPage {
+		http.Error(w, fmt.Sprintf("Listing exceeds the maximum page size of %v; request it in pages using 'limit'", s.maxPage), http.StatusRequestEntityTooLarge)
+		return false
+	}
+	return true
+}
+
+// blockTimestamp returns the timestamp of the block at the specified height,
+// or the zero time if no such block exists.
+func blockTimestamp(cs ConsensusSet, height types.BlockHeight) time.Time {
+	b, ok := cs.BlockAtHeight(height)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(int64(b.Timestamp), 0)
+}
+
+// Fee tiers, from cheapest to fastest.
+const (
+	FeeTierEconomy  = "economy"
+	FeeTierNormal   = "normal"
+	FeeTierPriority = "priority"
+)
+
+// feeEstimate returns the server's fee estimate. If the FeeEstimator fails,
+// the transaction pool's estimate is used instead.
+func (s *server) feeEstimate() (min, max types.Currency) {
+	if s.fees != nil {
+		if min, max, err := s.fees.EstimateFee(); err == nil {
+			return min, max
+		}
+	}
+	return s.chain.FeeEstimation()
+}
+
+// feeTiers maps a fee estimate onto the fee tiers. The confirmation horizons
+// are rough estimates; they assume that blocks are not consistently full.
+func feeTiers(min, max types.Currency) []ResponseFeeTier {
+	if max.Cmp(min) < 0 {
+		max = min
+	}
+	return []ResponseFeeTier{
+		{Tier: FeeTierEconomy, FeePerByte: min, ConfirmationBlocks: 6},
+		{Tier: FeeTierNormal, FeePerByte: min.Add(max).Div64(2), ConfirmationBlocks: 3},
+		{Tier: FeeTierPriority, FeePerByte: max, ConfirmationBlocks: 1},
+	}
+}
+
+// parseFee parses a fee tier or an explicit fee in hastings per byte. If spec
+// is empty, the recommended fee is returned.
+func (s *server) parseFee(spec string) (ResponseFeeTier, error) {
+	tiers := feeTiers(s.feeEstimate())
+	if spec == "" {
+		return tiers[0], nil
+	}
+	for _, t := range tiers {
+		if t.Tier == spec {
+			return t, nil
+		}
+	}
+	i, ok := new(big.Int).SetString(spec, 10)
+	if !ok || i.Sign() < 0 {
+		return ResponseFeeTier{}, fmt.Errorf("must be %v, %v, %v, or a value in hastings per byte", FeeTierEconomy, FeeTierNormal, FeeTierPriority)
+	}
+	// estimate the horizon using the closest tier at or below the fee
+	fee := types.NewCurrency(i)
+	resp := ResponseFeeTier{FeePerByte: fee}
+	for _, t := range tiers {
+		if fee.Cmp(t.FeePerByte) >= 0 {
+			resp.ConfirmationBlocks = t.ConfirmationBlocks
+		}
+	}
+	return resp, nil
+}
+
+// A RateProvider provides exchange rates between siacoins and fiat currencies.
+type RateProvider interface {
+	// SiacoinRate returns the value of one siacoin in the specified currency,
+	// e.g. "usd".
+	SiacoinRate(currency string) (float64, error)
+}
+
+// formatSC formats c as a decimal number of siacoins, without rounding.
+func formatSC(c types.Currency) string {
+	s := new(big.Rat).SetFrac(c.Big(), types.SiacoinPrecision.Big()).FloatString(24)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
 type server struct {
-	w  *wallet.SeedWallet
-	tp TransactionPool
+	mu      sync.Mutex // serializes address provisioning
+	w       *wallet.SeedWallet
+	chain   ChainAdapter
+	t       *Tracker
+	rates   RateProvider
+	network string
+	// signs statements produced by /reports/statement
+	statementKey ed25519.PrivateKey
+	keys         KeySource
+	// signs transactions via /sign, if set
+	seed *wallet.Seed
+	// constrains the transactions signed via /sign, if set
+	signing *spendLimiter
+	// the seed index reservation, if there is no Tracker to persist it
+	reserved uint64
+	quota    Quota
+	requests requestCounter
+	leader   Leader
+	rebuild  IndexRebuilder
+	jobs     jobSet
+	locks    outputLockSet
+	routes   []customRoute
+	g        Gateway
+	creds    Credentials
+	fees     FeeEstimator
+	sandbox  Sandbox
+	sync     *SyncWatchdog
+	// outputs worth less than this are hidden and not selected, by default
+	dust types.Currency
+	// the number of blocks the wallet may lag before /ready fails
+	maxBehind types.BlockHeight
+	// the maximum number of items in a listing response
+	maxPage int
+	// serves the sub-requests of /batch
+	api http.Handler
+	// origins, besides the server's own, that may open WebSockets
+	origins []string
 }
 
 func (s *server) addressesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	writeJSON(w, s.w.Addresses())
+	if !s.checkLabelFilter(w, req) {
+		return
+	}
+	addrs := s.w.Addresses()
+	if labels := req.URL.Query()["label"]; len(labels) > 0 {
+		labeled := labeledAddresses(s.t, labels)
+		filtered := addrs[:0]
+		for _, addr := range addrs {
+			if labeled[addr] {
+				filtered = append(filtered, addr)
+			}
+		}
+		addrs = filtered
+	}
+	writeJSON(w, addrs)
 }
 
 func (s *server) addressesaddrHandlerGET(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
@@ -53,7 +416,69 @@ func (s *server) addressesaddrHandlerGET(w http.ResponseWriter, req *http.Reques
 		http.Error(w, "No such entry", http.StatusNotFound)
 		return
 	}
-	writeJSON(w, responseAddressesAddr(info))
+	resp := responseAddressesAddr{SeedAddressInfo: info}
+	if s.t != nil {
+		resp.Labels = s.t.AddressLabels(addr)
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) addressesaddrlabelHandlerPUT(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var addr types.UnlockHash
+	if err := addr.LoadString(ps.ByName("addr")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if !s.w.OwnsAddress(addr) {
+		http.Error(w, "No such entry", http.StatusNotFound)
+		return
+	}
+	var labels []string
+	if err := json.NewDecoder(req.Body).Decode(&labels); err != nil {
+		http.Error(w, "Could not parse labels: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateLabels(labels); err != nil {
+		http.Error(w, "Invalid labels: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if err := s.t.SetAddressLabels(addr, labels); err != nil {
+		http.Error(w, "Couldn't set labels: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// maxOwnershipMessage is the maximum length of the message of an
+// OwnershipProof.
+const maxOwnershipMessage = 1024
+
+func (s *server) addressesaddrownershipHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var addr types.UnlockHash
+	if err := addr.LoadString(ps.ByName("addr")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	message := req.FormValue("message")
+	if message == "" {
+		http.Error(w, "Missing 'message' parameter", http.StatusBadRequest)
+		return
+	} else if len(message) > maxOwnershipMessage {
+		http.Error(w, "Message too long", http.StatusBadRequest)
+		return
+	}
+	info, ok := s.w.AddressInfo(addr)
+	if !ok {
+		http.Error(w, "No such entry", http.StatusNotFound)
+		return
+	}
+	proof := OwnershipProof{
+		Address:          addr,
+		UnlockConditions: info.UnlockConditions,
+		Message:          message,
+	}
+	writeJSON(w, ResponseOwnership{
+		Proof:    proof,
+		SigHash:  proof.SigHash(),
+		KeyIndex: info.KeyIndex,
+	})
 }
 
 func (s *server) addressesHandlerPOST(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
@@ -62,10 +487,44 @@ func (s *server) addressesHandlerPOST(w http.ResponseWriter, req *http.Request,
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !s.checkAddressQuota(w, s.w.OwnsAddress(wallet.CalculateUnlockHash(info.UnlockConditions))) {
+		return
+	}
 	s.w.AddAddress(info)
+	if s.t != nil {
+		if err := s.t.markIssued(info.KeyIndex); err != nil {
+			http.Error(w, "Couldn't update lookahead: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 	writeJSON(w, wallet.CalculateUnlockHash(info.UnlockConditions))
 }
 
+func (s *server) addressesnextHandlerPOST(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index := s.nextSeedIndex()
+	infos := deriveAddresses(s.keys, index, 1)
+	if len(infos) == 0 {
+		http.Error(w, fmt.Sprintf("No public key available for seed index %v", index), http.StatusBadRequest)
+		return
+	}
+	if !s.checkAddressQuota(w, s.w.OwnsAddress(infos[0].UnlockConditions.UnlockHash())) {
+		return
+	}
+	s.w.AddAddress(infos[0])
+	if s.t != nil {
+		if err := s.t.markIssued(index); err != nil {
+			http.Error(w, "Couldn't update lookahead: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	writeJSON(w, ResponseSeedIndexPreview{
+		SeedAddressInfo: infos[0],
+		Address:         infos[0].UnlockConditions.UnlockHash(),
+	})
+}
+
 func (s *server) addressesaddrHandlerDELETE(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	var addr types.UnlockHash
 	if err := addr.LoadString(ps.ByName("addr")); err != nil {
@@ -73,11 +532,41 @@ func (s *server) addressesaddrHandlerDELETE(w http.ResponseWriter, req *http.Req
 		return
 	}
 	s.w.RemoveAddress(addr)
+	if s.t != nil {
+		if err := s.t.SetAddressLabels(addr, nil); err != nil {
+			http.Error(w, "Couldn't remove labels: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 }
 
 func (s *server) balanceHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	limbo := req.FormValue("limbo") == "true"
-	writeJSON(w, s.w.Balance(limbo))
+	if s.dust.IsZero() || req.FormValue("includeDust") == "true" {
+		writeJSON(w, s.w.Balance(limbo))
+		return
+	}
+	bal := types.ZeroCurrency
+	for _, o := range s.withoutDust(s.w.UnspentOutputs(limbo), false) {
+		bal = bal.Add(o.Value)
+	}
+	writeJSON(w, bal)
+}
+
+func (s *server) batchHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var items []RequestBatchItem
+	if err := json.NewDecoder(req.Body).Decode(&items); err != nil {
+		http.Error(w, "Could not parse batch: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if len(items) > maxBatchRequests {
+		http.Error(w, "Batch contains more than "+strconv.Itoa(maxBatchRequests)+" requests", http.StatusBadRequest)
+		return
+	}
+	resp := make([]ResponseBatchItem, len(items))
+	for i, item := range items {
+		resp[i] = serveBatchItem(s.api, req, item)
+	}
+	writeJSON(w, resp)
 }
 
 func (s *server) blockrewardsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
@@ -90,7 +579,40 @@ func (s *server) blockrewardsHandler(w http.ResponseWriter, req *http.Request, _
 			return
 		}
 	}
-	writeJSON(w, responseBlockRewards(s.w.BlockRewards(max)))
+	pg, err := parsePage(req, "before")
+	if err != nil {
+		http.Error(w, "Invalid page: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.checkPageSize(w, "max", max) || !s.checkPageSize(w, "limit", pg.limit) {
+		return
+	}
+	var rewards []wallet.BlockReward
+	if pg.active() {
+		rewards = s.w.BlockRewards(-1)
+		start, end, ok := pg.bounds(len(rewards), func(i int) crypto.Hash { return crypto.Hash(rewards[i].ID) })
+		if !ok {
+			http.Error(w, errCursorNotFound, http.StatusBadRequest)
+			return
+		}
+		rewards = rewards[start:end]
+		if max >= 0 && len(rewards) > max {
+			rewards = rewards[:max]
+		}
+	} else {
+		rewards = s.w.BlockRewards(max)
+	}
+	if max < 0 && pg.limit < 0 && !s.checkListingSize(w, len(rewards)) {
+		return
+	}
+	resp := make(responseBlockRewards, len(rewards))
+	for i, r := range rewards {
+		resp[i].BlockReward = r
+		if r.Timelock >= types.MaturityDelay {
+			resp[i].Timestamp = blockTimestamp(s.chain, r.Timelock-types.MaturityDelay)
+		}
+	}
+	writeJSON(w, resp)
 }
 
 func (s *server) broadcastHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
@@ -102,113 +624,423 @@ func (s *server) broadcastHandler(w http.ResponseWriter, req *http.Request, _ ht
 		http.Error(w, "Transaction set is empty", http.StatusBadRequest)
 		return
 	}
+	receipt, code, err := s.broadcast(txnSet)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	writeJSON(w, receipt)
+}
+
+// broadcast submits txnSet to the transaction pool and adds it to Limbo,
+// returning a receipt for the set. Large withdrawals are instead queued by the
+// vault policy. If the set cannot be broadcast, broadcast returns an error
+// along with the HTTP status code to report it with.
+func (s *server) broadcast(txnSet []types.Transaction) (ResponseBroadcast, int, error) {
 	// check for duplicate transactions
 	for _, txn := range txnSet {
 		if _, ok := s.w.Transaction(txn.ID()); ok {
-			http.Error(w, "Transaction "+txn.ID().String()+" is already in the blockchain", http.StatusBadRequest)
-			return
+			return ResponseBroadcast{}, http.StatusBadRequest, errors.New("Transaction " + txn.ID().String() + " is already in the blockchain")
+		}
+	}
+
+	if s.leader != nil && !s.leader.IsLeader() {
+		return ResponseBroadcast{}, http.StatusServiceUnavailable, errors.New("This instance is a standby; broadcast via the leader")
+	}
+
+	// large withdrawals must wait out the vault delay
+	if s.t != nil && s.t.requiresDelay(txnSet) {
+		pw, err := s.t.QueueWithdrawal(txnSet)
+		if err != nil {
+			return ResponseBroadcast{}, http.StatusBadRequest, errors.New("Could not queue withdrawal: " + err.Error())
 		}
+		receipt := s.broadcastReceipt(txnSet, BroadcastQueued)
+		rw := withdrawalResponse(pw)
+		receipt.Withdrawal = &rw
+		return receipt, http.StatusOK, nil
 	}
 
 	// submit the transaction set (ignoring duplicate error -- if the set is
 	// already in the tpool, great)
-	err := s.tp.AcceptTransactionSet(txnSet)
-	if err != nil && err != modules.ErrDuplicateTransactionSet {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+	result := BroadcastAccepted
+	err := s.chain.AcceptTransactionSet(txnSet)
+	if err == modules.ErrDuplicateTransactionSet {
+		result = BroadcastDuplicate
+	} else if err != nil {
+		return ResponseBroadcast{}, http.StatusBadRequest, err
 	}
 
 	// add the transactions to Limbo
 	for _, txn := range txnSet {
 		s.w.AddToLimbo(txn)
 	}
+	if s.t != nil {
+		s.t.notifyLimbo(txnSet)
+		s.reserveDeposits(txnSet)
+		if err := s.t.AddLimboSet(txnSet); err != nil {
+			return ResponseBroadcast{}, http.StatusInternalServerError, errors.New("Could not record transaction set: " + err.Error())
+		}
+	}
+	return s.broadcastReceipt(txnSet, result), http.StatusOK, nil
 }
 
-func (s *server) consensusHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	writeJSON(w, ResponseConsensus{
-		Height: s.w.ChainHeight(),
-		CCID:   crypto.Hash(s.w.ConsensusChangeID()),
-	})
+// broadcastReceipt returns a receipt for txnSet with the specified result.
+func (s *server) broadcastReceipt(txnSet []types.Transaction, result string) ResponseBroadcast {
+	receipt := ResponseBroadcast{
+		Transactions: make([]ResponseBroadcastTransaction, len(txnSet)),
+	}
+	if s.g != nil && result != BroadcastQueued {
+		receipt.RelayPeers = len(s.g.Peers())
+	}
+	for i, txn := range txnSet {
+		size := len(encoding.Marshal(txn))
+		fees := types.ZeroCurrency
+		for _, fee := range txn.MinerFees {
+			fees = fees.Add(fee)
+		}
+		receipt.Transactions[i] = ResponseBroadcastTransaction{
+			ID:         txn.ID(),
+			Size:       size,
+			FeePerByte: fees.Div64(uint64(size)),
+			Result:     result,
+		}
+	}
+	return receipt
 }
 
-func (s *server) feeHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	median, _ := s.tp.FeeEstimation()
-	writeJSON(w, median)
-}
+// consensusWaitInterval is how often a long-polling /consensus request checks
+// whether the wallet has processed a new consensus change.
+var consensusWaitInterval = 100 * time.Millisecond
 
-func (s *server) filecontractsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	max := -1
-	if req.FormValue("max") != "" {
-		var err error
-		max, err = strconv.Atoi(req.FormValue("max"))
-		if err != nil {
-			http.Error(w, "Invalid 'max' value: "+err.Error(), http.StatusBadRequest)
+// maxConsensusWait is the longest that a /consensus request may wait.
+const maxConsensusWait = 5 * time.Minute
+
+func (s *server) consensusHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	if req.FormValue("wait") != "" {
+		var ccid crypto.Hash
+		if err := ccid.LoadString(req.FormValue("wait")); err != nil {
+			http.Error(w, "Invalid 'wait' value: "+err.Error(), http.StatusBadRequest)
 			return
 		}
+		timeout := 30 * time.Second
+		if req.FormValue("timeout") != "" {
+			var err error
+			timeout, err = time.ParseDuration(req.FormValue("timeout"))
+			if err != nil || timeout < 0 || timeout > maxConsensusWait {
+				http.Error(w, "Invalid 'timeout' value", http.StatusBadRequest)
+				return
+			}
+		}
+		deadline := time.After(timeout)
+		ticker := time.NewTicker(consensusWaitInterval)
+		defer ticker.Stop()
+	wait:
+		for crypto.Hash(s.w.ConsensusChangeID()) == ccid {
+			select {
+			case <-ticker.C:
+			case <-deadline:
+				break wait
+			case <-req.Context().Done():
+				return
+			}
+		}
 	}
-	writeJSON(w, responseFileContracts(s.w.FileContracts(max)))
+	writeJSON(w, ResponseConsensus{
+		Height:  s.w.ChainHeight(),
+		CCID:    crypto.Hash(s.w.ConsensusChangeID()),
+		Network: s.network,
+	})
 }
 
-func (s *server) filecontractsidHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
-	var id types.FileContractID
-	if err := id.LoadString(ps.ByName("id")); err != nil {
-		http.Error(w, "Invalid ID: "+err.Error(), http.StatusBadRequest)
+func (s *server) consolidateHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var rc RequestConsolidate
+	if err := json.NewDecoder(req.Body).Decode(&rc); err != nil {
+		http.Error(w, "Could not parse request: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if rc.Threshold.IsZero() {
+		http.Error(w, "Must specify a threshold", http.StatusBadRequest)
+		return
+	} else if len(rc.Destinations) == 0 {
+		http.Error(w, "Must specify at least one destination", http.StatusBadRequest)
+		return
+	} else if rc.MaxInputs < 0 {
+		http.Error(w, "Max inputs must not be negative", http.StatusBadRequest)
 		return
 	}
-	writeJSON(w, responseFileContracts(s.w.FileContractHistory(id)))
-}
-
-func (s *server) limboHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	writeJSON(w, responseLimbo(s.w.LimboTransactions()))
-}
-
-func (s *server) limboHandlerPUT(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
-	var txn types.Transaction
-	if err := json.NewDecoder(req.Body).Decode(&txn); err != nil {
-		http.Error(w, "Could not parse transaction: "+err.Error(), http.StatusBadRequest)
+	fee, err := s.parseFee(rc.Fee)
+	if err != nil {
+		http.Error(w, "Invalid fee: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if !rc.MaxFeePerByte.IsZero() && fee.FeePerByte.Cmp(rc.MaxFeePerByte) > 0 {
+		http.Error(w, fmt.Sprintf("Fee of %v H/byte exceeds maximum of %v H/byte", fee.FeePerByte, rc.MaxFeePerByte), http.StatusConflict)
 		return
 	}
-	s.w.AddToLimbo(txn)
-}
-
-func (s *server) limboHandlerDELETE(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
-	var txid types.TransactionID
-	if err := (*crypto.Hash)(&txid).LoadString(ps.ByName("id")); err != nil {
-		http.Error(w, "Invalid ID: "+err.Error(), http.StatusBadRequest)
+	// outputs created by Limbo transactions would require their parents to
+	// be broadcast as well
+	inLimbo := make(map[types.SiacoinOutputID]bool)
+	for _, txn := range s.w.LimboTransactions() {
+		for i := range txn.SiacoinOutputs {
+			inLimbo[txn.SiacoinOutputID(uint64(i))] = true
+		}
+	}
+	var outputs []wallet.UnspentOutput
+	for _, o := range s.locks.filter(s.w.UnspentOutputs(true), "") {
+		if !inLimbo[o.ID] {
+			outputs = append(outputs, o)
+		}
+	}
+	selected, remaining := selectConsolidation(s.w, outputs, rc.Threshold, rc.MaxInputs, rc.Destinations, fee.FeePerByte)
+	if len(selected) <= len(rc.Destinations) {
+		http.Error(w, fmt.Sprintf("Only %v outputs are worth consolidating into %v outputs", len(selected), len(rc.Destinations)), http.StatusConflict)
 		return
 	}
-	s.w.RemoveFromLimbo(txid)
+	txn, keyIndices, ok := draftSweep(s.w, selected, evenSplit(rc.Destinations), fee.FeePerByte)
+	if !ok {
+		http.Error(w, "Outputs are worth less than the transaction fee", http.StatusConflict)
+		return
+	}
+	writeJSON(w, ResponseConsolidate{
+		Fee:         fee,
+		Transaction: txn,
+		KeyIndices:  keyIndices,
+		Remaining:   remaining,
+	})
 }
 
-func (s *server) memosHandlerPUT(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
-	var txid types.TransactionID
-	if err := (*crypto.Hash)(&txid).LoadString(ps.ByName("txid")); err != nil {
-		http.Error(w, "Invalid transaction ID: "+err.Error(), http.StatusBadRequest)
+func (s *server) consolidationHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	policy, ok := s.t.ConsolidationPolicy()
+	if !ok {
+		http.Error(w, "No consolidation policy configured", http.StatusNotFound)
 		return
 	}
-	body, err := ioutil.ReadAll(req.Body)
+	outputs := maturedRewards(s.w)
+	if len(outputs) < policy.Threshold {
+		http.Error(w, fmt.Sprintf("Only %v of %v block rewards have matured", len(outputs), policy.Threshold), http.StatusBadRequest)
+		return
+	}
+	fee, err := s.parseFee(req.FormValue("fee"))
 	if err != nil {
-		http.Error(w, "Couldn't read memo: "+err.Error(), http.StatusBadRequest)
+		http.Error(w, "Invalid fee: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	s.w.SetMemo(txid, body)
+	txn, keyIndices, ok := draftConsolidation(s.w, outputs, policy.Destination, fee.FeePerByte)
+	if !ok {
+		http.Error(w, "Block rewards are worth less than the transaction fee", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, ResponseConsolidation{
+		Policy:      policy,
+		Fee:         fee,
+		Transaction: txn,
+		KeyIndices:  keyIndices,
+	})
 }
 
-func (s *server) memosHandlerGET(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
-	var txid types.TransactionID
-	if err := (*crypto.Hash)(&txid).LoadString(ps.ByName("txid")); err != nil {
-		http.Error(w, "Invalid transaction ID: "+err.Error(), http.StatusBadRequest)
+func (s *server) constructHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	format := req.FormValue("format")
+	if format != "" && format != "json" && format != "bundle" {
+		http.Error(w, "Invalid 'format' value: must be 'json' or 'bundle'", http.StatusBadRequest)
 		return
 	}
-	w.Write(s.w.Memo(txid))
+	var rc RequestConstruct
+	if err := json.NewDecoder(req.Body).Decode(&rc); err != nil {
+		http.Error(w, "Could not parse request: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if len(rc.Outputs) == 0 && len(rc.SiafundOutputs) == 0 {
+		http.Error(w, "Must specify at least one output", http.StatusBadRequest)
+		return
+	}
+	for _, o := range rc.Outputs {
+		if o.Value.IsZero() {
+			http.Error(w, "Output values must be nonzero", http.StatusBadRequest)
+			return
+		}
+	}
+	sfAmount := types.ZeroCurrency
+	for _, o := range rc.SiafundOutputs {
+		if o.Value.IsZero() {
+			http.Error(w, "Output values must be nonzero", http.StatusBadRequest)
+			return
+		}
+		sfAmount = sfAmount.Add(o.Value)
+	}
+	if len(rc.SiafundOutputs) > 0 {
+		if s.t == nil {
+			http.Error(w, "Sending siafunds requires a Tracker", http.StatusBadRequest)
+			return
+		} else if format == "bundle" {
+			http.Error(w, "Signing bundles cannot contain siafunds", http.StatusBadRequest)
+			return
+		}
+	}
+	if !validStrategy(rc.Strategy) {
+		http.Error(w, "Invalid coin selection strategy", http.StatusBadRequest)
+		return
+	}
+	fee, err := s.parseFee(rc.Fee)
+	if err != nil {
+		http.Error(w, "Invalid fee: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var lockDuration time.Duration
+	if rc.LockDuration != "" {
+		if !validLockID(rc.LockID) {
+			http.Error(w, "Must specify a lock ID of at most 64 bytes to lock inputs", http.StatusBadRequest)
+			return
+		} else if lockDuration, err = parseLockDuration(rc.LockDuration); err != nil {
+			http.Error(w, "Invalid lock duration: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var dust *DustPolicy
+	if s.t != nil {
+		dust = s.t.dust
+	}
+	// siafunds are selected first, so that the siacoin inputs can pay the
+	// fee for the siafund inputs and outputs
+	var sfTxn types.Transaction
+	var sfKeyIndices []uint64
+	if len(rc.SiafundOutputs) > 0 {
+		claimAddr := rc.ClaimAddress
+		if claimAddr == (types.UnlockHash{}) {
+			claimAddr = rc.ChangeAddress
+		}
+		if claimAddr == (types.UnlockHash{}) {
+			http.Error(w, "Must specify a claim or change address to spend siafunds", http.StatusBadRequest)
+			return
+		}
+		inputs, keyIndices, change, ok := fundSiafunds(s.w, unspentSiafundOutputs(s.t, s.w, true), sfAmount, claimAddr)
+		if !ok {
+			http.Error(w, "Couldn't build transaction: insufficient siafunds", http.StatusBadRequest)
+			return
+		}
+		sfTxn.SiafundInputs, sfKeyIndices = inputs, keyIndices
+		for _, o := range rc.SiafundOutputs {
+			// the claim start is set by consensus
+			o.ClaimStart = types.ZeroCurrency
+			sfTxn.SiafundOutputs = append(sfTxn.SiafundOutputs, o)
+		}
+		if !change.IsZero() {
+			if rc.ChangeAddress == (types.UnlockHash{}) {
+				http.Error(w, "Couldn't build transaction: no change address specified", http.StatusBadRequest)
+				return
+			}
+			sfTxn.SiafundOutputs = append(sfTxn.SiafundOutputs, types.SiafundOutput{
+				Value:      change,
+				UnlockHash: rc.ChangeAddress,
+			})
+		}
+	}
+	utxos := s.withoutDust(filterOutputs(s.t, s.locks.filter(s.w.UnspentOutputs(true), rc.LockID), rc.Inputs), rc.Inputs.IncludeDust)
+	txn, keyIndices, err := draftTemplate(s.w, coinInputs(s.t, s.w, utxos), rc.Strategy, rc.Outputs, rc.ChangeAddress, fee.FeePerByte, siafundFee(sfTxn, fee.FeePerByte), dust)
+	if err != nil {
+		http.Error(w, "Couldn't build transaction: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	txn.SiafundInputs = sfTxn.SiafundInputs
+	txn.SiafundOutputs = sfTxn.SiafundOutputs
+	if lockDuration != 0 {
+		oids := make([]types.SiacoinOutputID, len(txn.SiacoinInputs))
+		for i, sci := range txn.SiacoinInputs {
+			oids[i] = sci.ParentID
+		}
+		// another request may have locked an input since it was selected
+		if _, err := s.locks.lock(rc.LockID, oids, lockDuration); err != nil {
+			http.Error(w, "Couldn't lock inputs: "+err.Error()+"; try again", http.StatusConflict)
+			return
+		}
+	}
+	parents := []types.Transaction{}
+	for _, p := range unconfirmedAncestors([]types.Transaction{txn}, s.w.LimboTransactions()) {
+		parents = append(parents, p.Transaction)
+	}
+	if format == "bundle" {
+		values := make(map[types.SiacoinOutputID]types.Currency)
+		for _, o := range utxos {
+			values[o.ID] = o.Value
+		}
+		b := SigningBundle{
+			Version:     SigningBundleVersion,
+			Transaction: txn,
+			Inputs:      make([]BundleInput, len(txn.SiacoinInputs)),
+			Parents:     parents,
+		}
+		for i, sci := range txn.SiacoinInputs {
+			b.Inputs[i] = BundleInput{
+				ParentID:         sci.ParentID,
+				Value:            values[sci.ParentID],
+				UnlockConditions: sci.UnlockConditions,
+				KeyIndex:         keyIndices[i],
+			}
+		}
+		writeJSON(w, b)
+		return
+	}
+	writeJSON(w, ResponseConstruct{
+		Fee:               fee,
+		Transaction:       txn,
+		KeyIndices:        keyIndices,
+		SiafundKeyIndices: sfKeyIndices,
+		Parents:           parents,
+	})
 }
 
-func (s *server) seedindexHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	writeJSON(w, s.w.SeedIndex())
+func (s *server) feeHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	median, _ := s.feeEstimate()
+	writeJSON(w, median)
 }
 
-func (s *server) transactionsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	max := -1 // all txns
+func (s *server) feetiersHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	writeJSON(w, feeTiers(s.feeEstimate()))
+}
+
+func (s *server) fileContractsResponse(fcs []wallet.FileContract) responseFileContracts {
+	height := s.chain.Height()
+	resp := make(responseFileContracts, len(fcs))
+	for i, fc := range fcs {
+		resp[i].FileContract = fc
+		if fc.WindowEnd <= height {
+			resp[i].WindowEndTimestamp = blockTimestamp(s.chain, fc.WindowEnd)
+		}
+	}
+	return resp
+}
+
+// filterContracts returns the contracts in fcs that are selected by f.
+func (s *server) filterContracts(fcs []wallet.FileContract, f ContractFilter) []wallet.FileContract {
+	if f.isZero() {
+		return fcs
+	}
+	// unlock conditions only appear in revisions, so look them up in the
+	// contract's history if necessary
+	ucs := make(map[types.FileContractID]types.UnlockConditions)
+	unlockConditions := func(fc wallet.FileContract) types.UnlockConditions {
+		if len(fc.UnlockConditions.PublicKeys) != 0 || len(f.HostKey.Key) == 0 {
+			return fc.UnlockConditions
+		}
+		uc, ok := ucs[fc.ID]
+		if !ok {
+			for _, rev := range s.w.FileContractHistory(fc.ID) {
+				if len(rev.UnlockConditions.PublicKeys) != 0 {
+					uc = rev.UnlockConditions
+					break
+				}
+			}
+			ucs[fc.ID] = uc
+		}
+		return uc
+	}
+	var filtered []wallet.FileContract
+	for _, fc := range fcs {
+		if f.matches(fc, unlockConditions(fc)) {
+			filtered = append(filtered, fc)
+		}
+	}
+	return filtered
+}
+
+func (s *server) filecontractsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	max := -1
 	if req.FormValue("max") != "" {
 		var err error
 		max, err = strconv.Atoi(req.FormValue("max"))
@@ -217,92 +1049,2766 @@ func (s *server) transactionsHandler(w http.ResponseWriter, req *http.Request, _
 			return
 		}
 	}
-
-	var resp []types.TransactionID
-	if req.FormValue("addr") != "" {
-		var addr types.UnlockHash
-		if err := addr.LoadString(req.FormValue("addr")); err != nil {
-			http.Error(w, "Invalid address: "+err.Error(), http.StatusBadRequest)
+	pg, err := parsePage(req, "before")
+	if err != nil {
+		http.Error(w, "Invalid page: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, err := parseContractFilter(req.URL.Query())
+	if err != nil {
+		http.Error(w, "Invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.checkPageSize(w, "max", max) || !s.checkPageSize(w, "limit", pg.limit) {
+		return
+	}
+	var fcs []wallet.FileContract
+	if pg.active() || !f.isZero() {
+		fcs = s.filterContracts(s.w.FileContracts(-1), f)
+		start, end, ok := pg.bounds(len(fcs), func(i int) crypto.Hash { return crypto.Hash(fcs[i].ID) })
+		if !ok {
+			http.Error(w, errCursorNotFound, http.StatusBadRequest)
 			return
 		}
-		resp = s.w.TransactionsByAddress(addr, max)
+		fcs = fcs[start:end]
+		if max >= 0 && len(fcs) > max {
+			fcs = fcs[:max]
+		}
 	} else {
-		resp = s.w.Transactions(max)
+		fcs = s.w.FileContracts(max)
+	}
+	if max < 0 && pg.limit < 0 && !s.checkListingSize(w, len(fcs)) {
+		return
+	}
+	writeJSONFields(w, s.fileContractsResponse(fcs), req.FormValue("fields"))
+}
+
+func (s *server) filecontractsidHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	// httprouter does not allow a static route to overlap with a wildcard
+	// route, so /filecontracts/upcoming is dispatched here
+	if ps.ByName("id") == "upcoming" {
+		s.filecontractsupcomingHandler(w, req, ps)
+		return
+	}
+	var id types.FileContractID
+	if err := id.LoadString(ps.ByName("id")); err != nil {
+		http.Error(w, "Invalid ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, err := parseContractFilter(req.URL.Query())
+	if err != nil {
+		http.Error(w, "Invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// revisions share the contract's ID, so pages are delimited by revision
+	// number instead
+	before := uint64(math.MaxUint64)
+	if req.FormValue("before") != "" {
+		if before, err = strconv.ParseUint(req.FormValue("before"), 10, 64); err != nil {
+			http.Error(w, "Invalid 'before' value: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	limit := -1
+	if req.FormValue("limit") != "" {
+		if limit, err = strconv.Atoi(req.FormValue("limit")); err != nil || limit < 0 {
+			http.Error(w, "Invalid 'limit' value", http.StatusBadRequest)
+			return
+		}
+	}
+	if !s.checkPageSize(w, "limit", limit) {
+		return
+	}
+	var history []wallet.FileContract
+	for _, fc := range s.filterContracts(s.w.FileContractHistory(id), f) {
+		if fc.RevisionNumber < before && (limit < 0 || len(history) < limit) {
+			history = append(history, fc)
+		}
+	}
+	if limit < 0 && !s.checkListingSize(w, len(history)) {
+		return
+	}
+	writeJSONFields(w, s.fileContractsResponse(history), req.FormValue("fields"))
+}
+
+func (s *server) filecontractsupcomingHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	blocks := types.BlockHeight(contractWarningBlocks)
+	if req.FormValue("blocks") != "" {
+		n, err := strconv.ParseUint(req.FormValue("blocks"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid 'blocks' value: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		blocks = types.BlockHeight(n)
+	}
+	height := s.chain.Height()
+	var upcoming []wallet.FileContract
+	for _, fc := range s.w.FileContracts(-1) {
+		if height < fc.WindowEnd && fc.WindowStart <= height+blocks {
+			upcoming = append(upcoming, fc)
+		}
+	}
+	writeJSON(w, s.fileContractsResponse(upcoming))
+}
+
+// depositReceived returns the total amount sent to a deposit address, along
+// with the transactions that sent it.
+func (s *server) depositReceived(addr types.UnlockHash) (received types.Currency, txids []types.TransactionID) {
+	received = types.ZeroCurrency
+	for _, txid := range s.w.TransactionsByAddress(addr, -1) {
+		txn, ok := s.w.Transaction(txid)
+		if !ok {
+			continue
+		}
+		for _, sco := range txn.SiacoinOutputs {
+			if sco.UnlockHash == addr {
+				received = received.Add(sco.Value)
+			}
+		}
+		txids = append(txids, txid)
+	}
+	return
+}
+
+// verifyIndex verifies the wallet's index, rebuilding it if repair is set and
+// discrepancies are found. The rebuild itself cannot be cancelled.
+func (s *server) verifyIndex(ctx context.Context, depth types.BlockHeight, repair bool, progress func(start, current, end types.BlockHeight, found int)) (ResponseDBVerify, error) {
+	r, err := verifyWallet(ctx, s.w, s.chain, depth, progress)
+	if err != nil {
+		return ResponseDBVerify{}, err
+	}
+	resp := ResponseDBVerify{VerifyReport: r}
+	if repair && len(r.Discrepancies) > 0 {
+		// report rescan progress while the rebuild runs
+		done := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				case <-time.After(time.Second):
+					progress(0, s.w.ChainHeight(), s.chain.Height(), len(r.Discrepancies))
+				}
+			}
+		}()
+		err := s.rebuild.RebuildIndex()
+		close(done)
+		if err != nil {
+			return ResponseDBVerify{}, fmt.Errorf("couldn't rebuild index: %v", err)
+		}
+		resp.Repaired = true
+	}
+	return resp, nil
+}
+
+func (s *server) dbverifyHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var depth types.BlockHeight
+	if req.FormValue("depth") != "" {
+		if _, err := fmt.Sscan(req.FormValue("depth"), &depth); err != nil {
+			http.Error(w, "Invalid depth: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	repair := req.FormValue("repair") == "true"
+	if repair && s.rebuild == nil {
+		http.Error(w, "Index repair is not supported by this server", http.StatusBadRequest)
+		return
+	}
+	if req.FormValue("async") == "true" {
+		writeJSON(w, s.jobs.start(JobTypeVerify, func(ctx context.Context, jp *jobProgress) (interface{}, error) {
+			return s.verifyIndex(ctx, depth, repair, jp.update)
+		}))
+		return
+	}
+	resp, err := s.verifyIndex(req.Context(), depth, repair, func(_, _, _ types.BlockHeight, _ int) {})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 	writeJSON(w, resp)
 }
 
-func (s *server) transactionsidHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
-	var txid crypto.Hash
-	if err := txid.LoadString(ps.ByName("txid")); err != nil {
-		http.Error(w, "Invalid transaction ID: "+err.Error(), http.StatusBadRequest)
+func (s *server) depositsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	deposits := s.t.Deposits(req.FormValue("reference"))
+	resp := make([]ResponseDeposit, len(deposits))
+	for i, d := range deposits {
+		d.CallbackSecret = ""
+		resp[i].Deposit = d
+		resp[i].Received, resp[i].Transactions = s.depositReceived(d.Address)
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) depositsaddrcheckoutHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var addr types.UnlockHash
+	if err := addr.LoadString(ps.ByName("addr")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	txn, ok := s.w.Transaction(types.TransactionID(txid))
+	d, ok := s.t.Deposit(addr)
 	if !ok {
-		http.Error(w, "Transaction not found", http.StatusNotFound)
+		http.Error(w, "No such deposit", http.StatusNotFound)
 		return
 	}
-	// calculate inflow/outflow
-	var inflow, outflow types.Currency
-	for _, sco := range txn.SiacoinOutputs {
-		if s.w.OwnsAddress(sco.UnlockHash) {
-			inflow = inflow.Add(sco.Value)
-		} else {
-			outflow = outflow.Add(sco.Value)
+	received, _ := s.depositReceived(addr)
+	resp := ResponseCheckout{
+		Reference: d.Reference,
+		Address:   d.Address,
+		URI:       "sia:" + d.Address.String(),
+		Amount:    d.Amount,
+		AmountSC:  formatSC(d.Amount),
+		Received:  received,
+		Expiry:    d.Expiry,
+		Expired:   !d.Expiry.IsZero() && time.Now().After(d.Expiry),
+	}
+	if !d.Amount.IsZero() {
+		resp.URI += "?amount=" + resp.AmountSC
+	}
+	code, err := qr.Encode(resp.URI, qr.M)
+	if err != nil {
+		http.Error(w, "Couldn't encode QR code: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.QRPNG = code.PNG()
+	resp.QRSVG = qrSVG(code)
+	if currency := req.FormValue("currency"); currency != "" {
+		if s.rates == nil {
+			http.Error(w, "No exchange rate provider configured", http.StatusBadRequest)
+			return
+		}
+		rate, err := s.rates.SiacoinRate(currency)
+		if err != nil {
+			http.Error(w, "Couldn't get exchange rate: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sc, _ := new(big.Rat).SetFrac(d.Amount.Big(), types.SiacoinPrecision.Big()).Float64()
+		resp.Fiat = &ResponseCheckoutFiat{
+			Currency: currency,
+			Rate:     rate,
+			Amount:   sc * rate,
 		}
 	}
-	writeJSON(w, ResponseTransactionsID{
-		Transaction: txn.Transaction,
-		BlockID:     txn.BlockID,
-		BlockHeight: txn.BlockHeight,
-		Timestamp:   txn.Timestamp,
-		FeePerByte:  txn.FeePerByte,
-		Inflow:      inflow,
-		Outflow:     outflow,
-	})
+	writeJSON(w, resp)
 }
 
-func (s *server) unconfirmedparentsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	var txn types.Transaction
-	if err := json.NewDecoder(req.Body).Decode(&txn); err != nil {
-		http.Error(w, "Could not parse transaction: "+err.Error(), http.StatusBadRequest)
+// qrSVG renders c as an SVG document, surrounded by the same four-module quiet
+// zone as c.PNG.
+func qrSVG(c *qr.Code) string {
+	size := c.Size + 8
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size)
+	sb.WriteString(`<rect width="100%" height="100%" fill="#fff"/><path fill="#000" d="`)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Black(x, y) {
+				fmt.Fprintf(&sb, "M%d %dh1v1h-1z", x+4, y+4)
+			}
+		}
+	}
+	sb.WriteString(`"/></svg>`)
+	return sb.String()
+}
+
+func (s *server) depositsHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var rd RequestDeposit
+	if err := json.NewDecoder(req.Body).Decode(&rd); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if rd.Reference == "" {
+		http.Error(w, "Deposit must specify a reference", http.StatusBadRequest)
+		return
+	} else if err := validateCallback(rd.Callback, rd.CallbackSecret); err != nil {
+		http.Error(w, "Invalid callback: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rd.Reserve {
+		if rd.Amount.IsZero() {
+			http.Error(w, "Deposit must specify an amount to reserve outputs", http.StatusBadRequest)
+			return
+		} else if !validLockID(DepositLockID(rd.Reference)) {
+			http.Error(w, "Deposit that reserves outputs must have a reference of at most 56 bytes", http.StatusBadRequest)
+			return
+		} else if _, err := parseLockDuration(rd.ReserveDuration); err != nil {
+			http.Error(w, "Invalid reserve duration: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if rd.ReserveDuration != "" {
+		http.Error(w, "Reserve duration requires reserve to be set", http.StatusBadRequest)
+		return
+	}
+	// if possible, derive the address ourselves; otherwise, check that the
+	// client derived it correctly
+	if s.keys != nil && len(rd.UnlockConditions.PublicKeys) == 0 {
+		infos := deriveAddresses(s.keys, rd.KeyIndex, 1)
+		if len(infos) == 0 {
+			http.Error(w, fmt.Sprintf("No public key available for seed index %v", rd.KeyIndex), http.StatusBadRequest)
+			return
+		}
+		rd.SeedAddressInfo = infos[0]
+	} else if err := validateAddressInfo(s.keys, rd.SeedAddressInfo); err != nil {
+		http.Error(w, "Invalid unlock conditions: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	writeJSON(w, wallet.UnconfirmedParents(txn, s.w.LimboTransactions()))
+	// require the address to be derived from the current seed index, or from
+	// an index reserved via /seedindex/reserve, so that concurrent callers
+	// can't provision the same address twice
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addr := wallet.CalculateUnlockHash(rd.UnlockConditions)
+	provisioned := s.w.OwnsAddress(addr)
+	if s.t.Lookahead() > 0 {
+		// lookahead addresses are owned before they are issued
+		_, provisioned = s.t.Deposit(addr)
+	}
+	if index := s.nextSeedIndex(); provisioned || (rd.KeyIndex != index && !s.t.seedIndexReserved(rd.KeyIndex)) {
+		http.Error(w, fmt.Sprintf("Key index %v is not the current seed index (%v) or an unused reserved index", rd.KeyIndex, index), http.StatusConflict)
+		return
+	}
+	if !s.checkAddressQuota(w, s.w.OwnsAddress(addr)) {
+		return
+	}
+	s.w.AddAddress(rd.SeedAddressInfo)
+	if err := s.t.markIssued(rd.KeyIndex); err != nil {
+		http.Error(w, "Couldn't update lookahead: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err := s.t.AddDeposit(Deposit{
+		Reference:       rd.Reference,
+		Address:         addr,
+		KeyIndex:        rd.KeyIndex,
+		BlockHeight:     s.chain.Height(),
+		Confirmations:   rd.Confirmations,
+		Amount:          rd.Amount,
+		Expiry:          rd.Expiry,
+		Reserve:         rd.Reserve,
+		ReserveDuration: rd.ReserveDuration,
+		Callback:        rd.Callback,
+		CallbackSecret:  rd.CallbackSecret,
+	})
+	if err != nil {
+		http.Error(w, "Couldn't record deposit: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, addr)
 }
 
-func (s *server) utxosHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	writeJSON(w, s.w.UnspentOutputs(req.FormValue("limbo") == "true"))
+func (s *server) depositsaddrcallbackHandlerPUT(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var addr types.UnlockHash
+	if err := addr.LoadString(ps.ByName("addr")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var rdc RequestDepositCallback
+	if err := json.NewDecoder(req.Body).Decode(&rdc); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err := validateCallback(rdc.URL, rdc.Secret); err != nil {
+		http.Error(w, "Invalid callback: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if _, ok := s.t.Deposit(addr); !ok {
+		http.Error(w, "No such deposit", http.StatusNotFound)
+		return
+	}
+	if err := s.t.SetDepositCallback(addr, rdc.URL, rdc.Secret); err != nil {
+		http.Error(w, "Couldn't set callback: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 }
 
-// NewServer returns an HTTP handler that serves the walrus API.
-func NewServer(w *wallet.SeedWallet, tp TransactionPool) http.Handler {
-	s := server{
-		w:  w,
-		tp: tp,
+func (s *server) eventsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	if isWebSocketUpgrade(req) {
+		s.serveWebSocketStream(w, req)
+		return
 	}
-	mux := httprouter.New()
-	mux.GET("/addresses", s.addressesHandler)
-	mux.POST("/addresses", s.addressesHandlerPOST)
-	mux.GET("/addresses/:addr", s.addressesaddrHandlerGET)
-	mux.DELETE("/addresses/:addr", s.addressesaddrHandlerDELETE)
-	mux.GET("/balance", s.balanceHandler)
-	mux.GET("/blockrewards", s.blockrewardsHandler)
-	mux.POST("/broadcast", s.broadcastHandler)
-	mux.GET("/consensus", s.consensusHandler)
-	mux.GET("/fee", s.feeHandler)
-	mux.GET("/filecontracts", s.filecontractsHandler)
-	mux.GET("/filecontracts/:id", s.filecontractsidHandler)
-	mux.PUT("/limbo/:id", s.limboHandlerPUT)
-	mux.GET("/limbo", s.limboHandler)
-	mux.DELETE("/limbo/:id", s.limboHandlerDELETE)
-	mux.PUT("/memos/:txid", s.memosHandlerPUT)
-	mux.GET("/memos/:txid", s.memosHandlerGET)
-	mux.GET("/seedindex", s.seedindexHandler)
-	mux.GET("/transactions", s.transactionsHandler)
-	mux.GET("/transactions/:txid", s.transactionsidHandler)
-	mux.POST("/unconfirmedparents", s.unconfirmedparentsHandler)
-	mux.GET("/utxos", s.utxosHandler)
-	return mux
+	max := -1
+	if req.FormValue("max") != "" {
+		var err error
+		max, err = strconv.Atoi(req.FormValue("max"))
+		if err != nil {
+			http.Error(w, "Invalid 'max' value: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if !s.checkPageSize(w, "max", max) {
+		return
+	}
+	var events []Event
+	if req.FormValue("after") != "" {
+		after, err := strconv.ParseUint(req.FormValue("after"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid 'after' value: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		events = s.t.EventsAfter(after, max)
+	} else {
+		events = s.t.Events(max)
+	}
+	if max < 0 && !s.checkListingSize(w, len(events)) {
+		return
+	}
+	writeJSON(w, events)
+}
+
+func (s *server) eventssseHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	s.serveSSEStream(w, req)
+}
+
+func (s *server) healthHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *server) hostannouncementsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var resp []ResponseHostAnnouncement
+	for _, txid := range newestFirst(s.w.Transactions(-1)) {
+		txn, ok := s.w.Transaction(txid)
+		if !ok {
+			continue
+		}
+		// the announcement was made by the wallet if the wallet funded it
+		var addrs []types.UnlockHash
+		for _, sci := range txn.SiacoinInputs {
+			if addr := sci.UnlockConditions.UnlockHash(); s.w.OwnsAddress(addr) {
+				addrs = append(addrs, addr)
+			}
+		}
+		if len(addrs) == 0 {
+			continue
+		}
+		for _, arb := range txn.ArbitraryData {
+			na, spk, err := modules.DecodeAnnouncement(arb)
+			if err != nil {
+				continue
+			}
+			resp = append(resp, ResponseHostAnnouncement{
+				TransactionID: txid,
+				BlockHeight:   txn.BlockHeight,
+				Timestamp:     txn.Timestamp,
+				NetAddress:    na,
+				PublicKey:     spk.String(),
+				Addresses:     addrs,
+			})
+		}
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) inheritanceHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	inh, ok := s.t.Inheritance()
+	if !ok {
+		http.Error(w, "No inheritance is configured", http.StatusNotFound)
+		return
+	}
+	resp := ResponseInheritance{
+		Beneficiary:    inh.Beneficiary,
+		TransactionIDs: make([]types.TransactionID, len(inh.Transactions)),
+		HeartbeatKey:   hex.EncodeToString(inh.HeartbeatKey),
+		Period:         inh.Period.String(),
+		LastHeartbeat:  inh.LastHeartbeat,
+		Deadline:       inh.Deadline(),
+		LastError:      inh.LastError,
+	}
+	for i, txn := range inh.Transactions {
+		resp.TransactionIDs[i] = txn.ID()
+	}
+	if !inh.Triggered.IsZero() {
+		resp.Triggered = &inh.Triggered
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) inheritanceHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var ri RequestInheritance
+	if err := json.NewDecoder(req.Body).Decode(&ri); err != nil {
+		http.Error(w, "Could not parse inheritance: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	key, err := hex.DecodeString(ri.HeartbeatKey)
+	if err != nil {
+		http.Error(w, "Invalid heartbeat key: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	period, err := time.ParseDuration(ri.Period)
+	if err != nil {
+		http.Error(w, "Invalid period: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, txn := range ri.Transactions {
+		if err := s.chain.ValidateTransaction(txn, s.w.ChainHeight()+1); err != nil {
+			http.Error(w, "Invalid transaction "+txn.ID().String()+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if _, ok := s.t.Inheritance(); ok {
+		http.Error(w, "An inheritance is already configured; remove it first", http.StatusConflict)
+		return
+	}
+	err = s.t.SetInheritance(Inheritance{
+		Beneficiary:  ri.Beneficiary,
+		Transactions: ri.Transactions,
+		HeartbeatKey: key,
+		Period:       period,
+	})
+	if err != nil {
+		http.Error(w, "Couldn't set inheritance: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// parseHeartbeat decodes a RequestHeartbeat from req.
+func parseHeartbeat(req *http.Request) (time.Time, []byte, error) {
+	var rh RequestHeartbeat
+	if err := json.NewDecoder(req.Body).Decode(&rh); err != nil {
+		return time.Time{}, nil, err
+	}
+	sig, err := hex.DecodeString(rh.Signature)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	return rh.Timestamp, sig, nil
+}
+
+func (s *server) inheritanceHandlerDELETE(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	timestamp, sig, err := parseHeartbeat(req)
+	if err != nil {
+		http.Error(w, "Could not parse request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.t.RemoveInheritance(timestamp, sig); err != nil {
+		http.Error(w, "Couldn't remove inheritance: "+err.Error(), http.StatusForbidden)
+		return
+	}
+}
+
+func (s *server) inheritanceheartbeatHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	timestamp, sig, err := parseHeartbeat(req)
+	if err != nil {
+		http.Error(w, "Could not parse heartbeat: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.t.Heartbeat(timestamp, sig); err != nil {
+		http.Error(w, "Heartbeat rejected: "+err.Error(), http.StatusForbidden)
+		return
+	}
+}
+
+func (s *server) leaderHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	writeJSON(w, s.leader == nil || s.leader.IsLeader())
+}
+
+func (s *server) jobsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	writeJSON(w, s.jobs.list())
+}
+
+func (s *server) jobsidHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	job, ok := s.jobs.get(ps.ByName("id"))
+	if !ok {
+		http.Error(w, "No job with that ID", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, job)
+}
+
+func (s *server) jobsidHandlerDELETE(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	if !s.jobs.cancel(ps.ByName("id")) {
+		http.Error(w, "No job with that ID", http.StatusNotFound)
+		return
+	}
+}
+
+func (s *server) limboHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var f LimboFilter
+	for _, str := range req.URL.Query()["addr"] {
+		var addr types.UnlockHash
+		if err := addr.LoadString(str); err != nil {
+			http.Error(w, "Invalid address: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.Addresses = append(f.Addresses, addr)
+	}
+	if req.FormValue("minvalue") != "" {
+		i, ok := new(big.Int).SetString(req.FormValue("minvalue"), 10)
+		if !ok || i.Sign() < 0 {
+			http.Error(w, "Invalid 'minvalue' value: must be a value in hastings", http.StatusBadRequest)
+			return
+		}
+		f.MinValue = types.NewCurrency(i)
+	}
+	if req.FormValue("minage") != "" {
+		var err error
+		f.MinAge, err = time.ParseDuration(req.FormValue("minage"))
+		if err != nil {
+			http.Error(w, "Invalid 'minage' value: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	writeJSON(w, responseLimbo(filterLimbo(s.w.LimboTransactions(), f, time.Now())))
+}
+
+func (s *server) limboidHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	// /limbo/sets shares this route, since httprouter does not allow a
+	// static segment alongside a parameter
+	if ps.ByName("id") == "sets" && s.t != nil {
+		s.limbosetsHandler(w, req, ps)
+		return
+	}
+	var txid types.TransactionID
+	if err := (*crypto.Hash)(&txid).LoadString(ps.ByName("id")); err != nil {
+		http.Error(w, "Invalid ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	txn, ok := s.limboTransaction(txid)
+	if !ok {
+		s.limboNotFound(w, txid)
+		return
+	}
+	writeJSON(w, responseLimboID(txn))
+}
+
+// limboTransaction returns the transaction in Limbo with the specified ID.
+func (s *server) limboTransaction(txid types.TransactionID) (wallet.LimboTransaction, bool) {
+	for _, txn := range s.w.LimboTransactions() {
+		if txn.ID() == txid {
+			return txn, true
+		}
+	}
+	return wallet.LimboTransaction{}, false
+}
+
+// limboNotFound responds that txid is not in Limbo, noting its replacement, if
+// any.
+func (s *server) limboNotFound(w http.ResponseWriter, txid types.TransactionID) {
+	if s.t != nil {
+		if id, ok := s.t.Replacement(txid); ok {
+			http.Error(w, "Transaction is not in Limbo; it was replaced by "+id.String(), http.StatusNotFound)
+			return
+		}
+	}
+	http.Error(w, "Transaction is not in Limbo", http.StatusNotFound)
+}
+
+func (s *server) limbosetsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	sets := groupLimbo(s.t.LimboSets(), s.w.LimboTransactions())
+	sort.Slice(sets, func(i, j int) bool {
+		return sets[i].Broadcast.Before(sets[j].Broadcast)
+	})
+	writeJSON(w, sets)
+}
+
+func (s *server) limboHandlerPUT(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var txn types.Transaction
+	if err := json.NewDecoder(req.Body).Decode(&txn); err != nil {
+		http.Error(w, "Could not parse transaction: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.w.AddToLimbo(txn)
+	if s.t != nil {
+		s.t.notifyLimbo([]types.Transaction{txn})
+		s.reserveDeposits([]types.Transaction{txn})
+	}
+}
+
+func (s *server) limboHandlerDELETE(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var txid types.TransactionID
+	if err := (*crypto.Hash)(&txid).LoadString(ps.ByName("id")); err != nil {
+		http.Error(w, "Invalid ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.w.RemoveFromLimbo(txid)
+}
+
+func (s *server) limboidbumpHandlerPOST(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var txid types.TransactionID
+	if err := (*crypto.Hash)(&txid).LoadString(ps.ByName("id")); err != nil {
+		http.Error(w, "Invalid ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var rb RequestBump
+	if err := json.NewDecoder(req.Body).Decode(&rb); err != nil {
+		http.Error(w, "Could not parse request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rb.Fee == "" {
+		rb.Fee = FeeTierPriority
+	}
+	fee, err := s.parseFee(rb.Fee)
+	if err != nil {
+		http.Error(w, "Invalid fee: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	txn, ok := s.limboTransaction(txid)
+	if !ok {
+		s.limboNotFound(w, txid)
+		return
+	}
+	// replacing a transaction would invalidate any children, and outputs
+	// created by Limbo transactions would require their parents to be
+	// broadcast as well
+	created := make(map[types.SiacoinOutputID]bool)
+	for i := range txn.SiacoinOutputs {
+		created[txn.SiacoinOutputID(uint64(i))] = true
+	}
+	inLimbo := make(map[types.SiacoinOutputID]bool)
+	for _, ltxn := range s.w.LimboTransactions() {
+		for _, in := range ltxn.SiacoinInputs {
+			if created[in.ParentID] {
+				http.Error(w, "Transaction cannot be replaced: its outputs are spent by "+ltxn.ID().String(), http.StatusConflict)
+				return
+			}
+		}
+		for i := range ltxn.SiacoinOutputs {
+			inLimbo[ltxn.SiacoinOutputID(uint64(i))] = true
+		}
+	}
+	var utxos []wallet.UnspentOutput
+	for _, o := range s.withoutDust(s.locks.filter(s.w.UnspentOutputs(true), ""), false) {
+		if !inLimbo[o.ID] {
+			utxos = append(utxos, o)
+		}
+	}
+	bumped, keyIndices, err := draftBump(s.w, txn.Transaction, coinInputs(s.t, s.w, utxos), rb.ChangeAddress, fee.FeePerByte)
+	if err != nil {
+		http.Error(w, "Couldn't build replacement: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, ResponseBump{
+		Fee:         fee,
+		Transaction: bumped,
+		KeyIndices:  keyIndices,
+		Replaces:    txid,
+	})
+}
+
+func (s *server) limboidbumpHandlerPUT(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var txid types.TransactionID
+	if err := (*crypto.Hash)(&txid).LoadString(ps.ByName("id")); err != nil {
+		http.Error(w, "Invalid ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var replacement types.Transaction
+	if err := json.NewDecoder(req.Body).Decode(&replacement); err != nil {
+		http.Error(w, "Could not parse transaction: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	txn, ok := s.limboTransaction(txid)
+	if !ok {
+		s.limboNotFound(w, txid)
+		return
+	} else if err := checkReplacement(s.w, txn.Transaction, replacement); err != nil {
+		http.Error(w, "Invalid replacement: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if err := s.chain.ValidateTransaction(replacement, s.w.ChainHeight()+1); err != nil {
+		http.Error(w, "Invalid replacement: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	txnSet := []types.Transaction{replacement}
+	if s.t != nil {
+		// a queued withdrawal must wait out the vault delay; bumping it would
+		// broadcast it early
+		if pw, ok := s.t.withdrawalContaining(txid); ok {
+			http.Error(w, "Transaction belongs to pending withdrawal "+pw.ID.String()+"; cancel it and queue a new withdrawal instead", http.StatusConflict)
+			return
+		} else if s.t.requiresDelay(txnSet) {
+			http.Error(w, "Replacement exceeds the vault threshold and cannot be broadcast immediately", http.StatusConflict)
+			return
+		}
+	}
+	receipt, code, err := s.broadcast(txnSet)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	s.w.RemoveFromLimbo(txid)
+	if s.t != nil {
+		if err := s.t.recordReplacement(txid, replacement.ID()); err != nil {
+			http.Error(w, "Could not record replacement: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	writeJSON(w, receipt)
+}
+
+func (s *server) memosHandlerPUT(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var txid types.TransactionID
+	if err := (*crypto.Hash)(&txid).LoadString(ps.ByName("txid")); err != nil {
+		http.Error(w, "Invalid transaction ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, "Couldn't read memo: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.w.SetMemo(txid, body)
+}
+
+func (s *server) memosHandlerGET(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var txid types.TransactionID
+	if err := (*crypto.Hash)(&txid).LoadString(ps.ByName("txid")); err != nil {
+		http.Error(w, "Invalid transaction ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Write(s.w.Memo(txid))
+}
+
+func (s *server) networkHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	tip := s.chain.CurrentBlock()
+	height := s.chain.Height()
+	target, _ := s.chain.ChildTarget(tip.ID())
+	resp := ResponseNetwork{
+		Height:     height,
+		Target:     crypto.Hash(target),
+		Difficulty: target.Difficulty(),
+	}
+	// compute the average block time over the last hour, day, and week
+	for _, window := range []types.BlockHeight{6, 144, 1008} {
+		if window > height {
+			break
+		}
+		b, ok := s.chain.BlockAtHeight(height - window)
+		if !ok || tip.Timestamp < b.Timestamp {
+			break
+		}
+		resp.BlockTimes = append(resp.BlockTimes, ResponseNetworkBlockTime{
+			Blocks:  window,
+			Average: float64(tip.Timestamp-b.Timestamp) / float64(window),
+		})
+	}
+	// estimate the hashrate using the daily average, falling back to the
+	// expected block frequency
+	blockTime := uint64(types.BlockFrequency)
+	for _, bt := range resp.BlockTimes {
+		if bt.Blocks == 144 && bt.Average >= 1 {
+			blockTime = uint64(bt.Average)
+		}
+	}
+	resp.Hashrate = resp.Difficulty.Div64(blockTime)
+	writeJSON(w, resp)
+}
+
+func (s *server) ownershipverifyHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var proof OwnershipProof
+	if err := json.NewDecoder(req.Body).Decode(&proof); err != nil {
+		http.Error(w, "Could not parse proof: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if len(proof.Message) > maxOwnershipMessage {
+		http.Error(w, "Message too long", http.StatusBadRequest)
+		return
+	}
+	var resp ResponseOwnershipVerify
+	if err := VerifyOwnershipProof(proof); err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Valid = true
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) paymentsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	writeJSON(w, s.t.Payments(req.FormValue("reference")))
+}
+
+func (s *server) payoutsHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var rp RequestPayouts
+	if err := json.NewDecoder(req.Body).Decode(&rp); err != nil {
+		http.Error(w, "Could not parse request: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if len(rp.Payouts) == 0 {
+		http.Error(w, "Must specify at least one payout", http.StatusBadRequest)
+		return
+	}
+	for _, p := range rp.Payouts {
+		if p.Amount.IsZero() {
+			http.Error(w, "Payout amounts must be nonzero", http.StatusBadRequest)
+			return
+		}
+	}
+	if !validStrategy(rp.Strategy) {
+		http.Error(w, "Invalid coin selection strategy", http.StatusBadRequest)
+		return
+	} else if rp.Sign && (s.seed == nil || !s.hasCredentials()) {
+		http.Error(w, "Server cannot sign payouts: /sign is not enabled", http.StatusBadRequest)
+		return
+	}
+	fee, err := s.parseFee(rp.Fee)
+	if err != nil {
+		http.Error(w, "Invalid fee: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	utxos := s.withoutDust(filterOutputs(s.t, s.locks.filter(s.w.UnspentOutputs(true), ""), rp.Inputs), rp.Inputs.IncludeDust)
+	drafts, err := draftPayouts(s.w, coinInputs(s.t, s.w, utxos), rp.Strategy, rp.Payouts, rp.ChangeAddress, fee.FeePerByte)
+	if err != nil {
+		http.Error(w, "Couldn't build transactions: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := ResponsePayouts{
+		Fee:     fee,
+		Payouts: make([]ResponsePayout, 0, len(rp.Payouts)),
+		Fees:    types.ZeroCurrency,
+	}
+	for _, d := range drafts {
+		txid := d.txn.ID()
+		for _, p := range rp.Payouts[len(resp.Payouts):][:d.payouts] {
+			resp.Payouts = append(resp.Payouts, ResponsePayout{Payout: p, TransactionID: txid})
+		}
+		resp.Fees = resp.Fees.Add(totalFee(d.txn))
+	}
+
+	if !rp.Sign {
+		values := make(map[types.SiacoinOutputID]types.Currency)
+		for _, o := range utxos {
+			values[o.ID] = o.Value
+		}
+		limbo := s.w.LimboTransactions()
+		for _, d := range drafts {
+			b := SigningBundle{
+				Version:     SigningBundleVersion,
+				Transaction: d.txn,
+				Inputs:      make([]BundleInput, len(d.txn.SiacoinInputs)),
+				Parents:     []types.Transaction{},
+			}
+			for i, sci := range d.txn.SiacoinInputs {
+				b.Inputs[i] = BundleInput{
+					ParentID:         sci.ParentID,
+					Value:            values[sci.ParentID],
+					UnlockConditions: sci.UnlockConditions,
+					KeyIndex:         d.keyIndices[i],
+				}
+			}
+			for _, p := range unconfirmedAncestors([]types.Transaction{d.txn}, limbo) {
+				b.Parents = append(b.Parents, p.Transaction)
+			}
+			// later transactions may spend this transaction's change
+			for i, sco := range d.txn.SiacoinOutputs {
+				values[d.txn.SiacoinOutputID(uint64(i))] = sco.Value
+			}
+			resp.Bundles = append(resp.Bundles, b)
+		}
+		writeJSON(w, resp)
+		return
+	}
+
+	for _, d := range drafts {
+		txn := d.txn
+		if err := signWithSeed(s.w, *s.seed, &txn); err != nil {
+			http.Error(w, "Couldn't sign transaction: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp.Transactions = append(resp.Transactions, txn)
+	}
+	if s.t != nil && s.t.requiresDelay(resp.Transactions) {
+		http.Error(w, "Payouts exceed the vault threshold; request them unsigned and broadcast them via /broadcast", http.StatusConflict)
+		return
+	}
+	for i, txn := range resp.Transactions {
+		receipt, code, err := s.broadcast([]types.Transaction{txn})
+		if err != nil {
+			err = fmt.Errorf("Could not broadcast transaction %v (%v of %v were broadcast): %v", txn.ID(), i, len(resp.Transactions), err)
+			if i == 0 {
+				http.Error(w, err.Error(), code)
+				return
+			}
+			// report which payouts were made
+			resp.Transactions = resp.Transactions[:i]
+			paid := make(map[types.TransactionID]bool)
+			resp.Fees = types.ZeroCurrency
+			for _, txn := range resp.Transactions {
+				paid[txn.ID()] = true
+				resp.Fees = resp.Fees.Add(totalFee(txn))
+			}
+			for j := range resp.Payouts {
+				if !paid[resp.Payouts[j].TransactionID] {
+					resp.Payouts[j].TransactionID = types.TransactionID{}
+				}
+			}
+			resp.Error = err.Error()
+			break
+		}
+		resp.Receipts = append(resp.Receipts, receipt)
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) pushdevicesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	writeJSON(w, s.t.PushDevices())
+}
+
+func (s *server) pushdevicesHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var d PushDevice
+	if err := json.NewDecoder(req.Body).Decode(&d); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if d.Token == "" {
+		http.Error(w, "Device must specify a token", http.StatusBadRequest)
+		return
+	}
+	supported := false
+	for _, p := range s.t.PushPlatforms() {
+		supported = supported || p == d.Platform
+	}
+	if !supported {
+		http.Error(w, fmt.Sprintf("Push notifications are not configured for platform %q", d.Platform), http.StatusBadRequest)
+		return
+	}
+	if s.quota.MaxPushDevices > 0 {
+		devices := s.t.PushDevices()
+		exists := false
+		for _, e := range devices {
+			exists = exists || e.Token == d.Token
+		}
+		if !exists && len(devices) >= s.quota.MaxPushDevices {
+			http.Error(w, "Push device quota exceeded", http.StatusForbidden)
+			return
+		}
+	}
+	if err := s.t.AddPushDevice(d); err != nil {
+		http.Error(w, "Couldn't add device: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *server) pushdevicestokenHandlerDELETE(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	if err := s.t.RemovePushDevice(ps.ByName("token")); err != nil {
+		http.Error(w, "Couldn't remove device: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *server) pubkeysHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var rpk RequestPublicKeys
+	if err := json.NewDecoder(req.Body).Decode(&rpk); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pks := make([]types.SiaPublicKey, len(rpk.PublicKeys))
+	for i, s := range rpk.PublicKeys {
+		pk, err := ParsePublicKey(s)
+		if err != nil {
+			http.Error(w, "Invalid public key: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		pks[i] = pk
+	}
+	if err := s.t.AddPublicKeys(rpk.StartIndex, pks); err != nil {
+		http.Error(w, "Couldn't import public keys: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// DefaultMaxBlocksBehind is the default number of blocks the wallet may lag
+// behind the network before /ready fails. Since blocks are found at random,
+// an hour or more occasionally passes without one, so this should not be set
+// too low.
+const DefaultMaxBlocksBehind = 12
+
+// blocksBehind estimates how many blocks the wallet lags behind the network:
+// the blocks not yet processed by the wallet, plus the blocks expected to
+// have been mined since the consensus set's tip.
+func (s *server) blocksBehind() types.BlockHeight {
+	var behind types.BlockHeight
+	if h := s.chain.Height(); h > s.w.ChainHeight() {
+		behind = h - s.w.ChainHeight()
+	}
+	tip := time.Unix(int64(s.chain.CurrentBlock().Timestamp), 0)
+	if elapsed := time.Since(tip); elapsed > 0 {
+		behind += types.BlockHeight(elapsed / (time.Duration(types.BlockFrequency) * time.Second))
+	}
+	return behind
+}
+
+func (s *server) readyHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	resp := ResponseReady{
+		Height:       s.w.ChainHeight(),
+		BlocksBehind: s.blocksBehind(),
+		DBWritable:   true,
+	}
+	if resp.BlocksBehind > s.maxBehind {
+		resp.Errors = append(resp.Errors, fmt.Sprintf("wallet is %v blocks behind the network", resp.BlocksBehind))
+	}
+	if s.sync != nil {
+		if ss := s.sync.Status(); ss.Reason != "" {
+			resp.SyncStalled = true
+			resp.Errors = append(resp.Errors, "consensus sync has stalled: "+ss.Reason)
+		}
+	}
+	if s.t != nil {
+		if err := s.t.checkWritable(); err != nil {
+			resp.DBWritable = false
+			resp.Errors = append(resp.Errors, "database is not writable: "+err.Error())
+		}
+	}
+	resp.Ready = len(resp.Errors) == 0
+	if !resp.Ready {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) reconcileHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var since crypto.Hash
+	if req.FormValue("since") != "" {
+		if err := since.LoadString(req.FormValue("since")); err != nil {
+			http.Error(w, "Invalid 'since' value: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var after uint64
+	if req.FormValue("after") != "" {
+		if req.FormValue("since") != "" {
+			http.Error(w, "Cannot specify both 'since' and 'after'", http.StatusBadRequest)
+			return
+		}
+		var err error
+		if after, err = strconv.ParseUint(req.FormValue("after"), 10, 64); err != nil {
+			http.Error(w, "Invalid 'after' value: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	limit := -1
+	if req.FormValue("limit") != "" {
+		var err error
+		if limit, err = strconv.Atoi(req.FormValue("limit")); err != nil || limit < 0 {
+			http.Error(w, "Invalid 'limit' value", http.StatusBadRequest)
+			return
+		}
+	}
+	if !s.checkPageSize(w, "limit", limit) {
+		return
+	}
+	var postings []Posting
+	var ccid modules.ConsensusChangeID
+	if req.FormValue("after") != "" {
+		postings, ccid = s.t.PostingsAfter(after, limit)
+	} else {
+		var err error
+		postings, ccid, err = s.t.Postings(modules.ConsensusChangeID(since), limit)
+		if err == ErrUnknownCCID {
+			http.Error(w, "Unknown consensus change ID; it may predate the posting log, or belong to another node", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "Couldn't load postings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if limit < 0 && !s.checkListingSize(w, len(postings)) {
+		return
+	}
+	resp := ResponseReconcile{Postings: postings}
+	if resp.Postings == nil {
+		resp.Postings = []Posting{}
+	}
+	if ccid != (modules.ConsensusChangeID{}) {
+		h := crypto.Hash(ccid)
+		resp.CCID = &h
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) reportscostbasisHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	policy := req.FormValue("policy")
+	if policy == "" {
+		policy = PolicyFIFO
+	} else if policy != PolicyFIFO && policy != PolicyLIFO {
+		http.Error(w, "Invalid policy: must be 'fifo' or 'lifo'", http.StatusBadRequest)
+		return
+	}
+	resp := ResponseCostBasis{
+		Currency:  s.t.Currency(),
+		Policy:    policy,
+		Disposals: RealizedGains(s.t.Flows(), policy),
+	}
+	for _, d := range resp.Disposals {
+		resp.RealizedGain += d.Gain
+	}
+
+	switch req.FormValue("format") {
+	case "", "json":
+		writeJSON(w, resp)
+	case "csv":
+		opts, err := s.parseCSVOptions(req)
+		if err != nil {
+			http.Error(w, "Invalid CSV options: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		cw := opts.newWriter(w)
+		cw.Write([]string{"timestamp", "height", "id", "amount", "rate", "proceeds", "cost_basis", "gain"})
+		for _, d := range resp.Disposals {
+			cw.Write([]string{
+				opts.formatTime(d.Timestamp),
+				strconv.FormatUint(uint64(d.BlockHeight), 10),
+				d.ID.String(),
+				opts.formatSC(d.Disposed),
+				opts.formatFloat(d.Rate),
+				opts.formatFloat(d.Proceeds),
+				opts.formatFloat(d.CostBasis),
+				opts.formatFloat(d.Gain),
+			})
+		}
+		cw.Flush()
+	default:
+		http.Error(w, "Invalid format: must be 'json' or 'csv'", http.StatusBadRequest)
+	}
+}
+
+// weekOf returns the start (Monday, 00:00 UTC) of the week containing t.
+func weekOf(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// groupByWeek adds payout to the week containing t.
+func groupByWeek(weeks []ResponseHostReportWeek, t time.Time, payout types.Currency) []ResponseHostReportWeek {
+	week := weekOf(t)
+	i := sort.Search(len(weeks), func(i int) bool { return !weeks[i].Week.Before(week) })
+	if i == len(weeks) || !weeks[i].Week.Equal(week) {
+		weeks = append(weeks, ResponseHostReportWeek{})
+		copy(weeks[i+1:], weeks[i:])
+		weeks[i] = ResponseHostReportWeek{Week: week, Payout: types.ZeroCurrency}
+	}
+	weeks[i].Contracts++
+	weeks[i].Payout = weeks[i].Payout.Add(payout)
+	return weeks
+}
+
+func (s *server) reportshostHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	resp := ResponseHostReport{
+		CollateralLocked: types.ZeroCurrency,
+		AtRisk:           types.ZeroCurrency,
+	}
+	resolved := make(map[types.FileContractID]bool)
+	for _, o := range s.t.ContractOutcomes() {
+		resolved[o.ID] = true
+		if o.Valid {
+			resp.ValidProofs++
+		} else {
+			resp.MissedProofs++
+		}
+		resp.Revenue = groupByWeek(resp.Revenue, o.Timestamp, o.Payout)
+	}
+
+	owned := func(scos []types.SiacoinOutput) types.Currency {
+		sum := types.ZeroCurrency
+		for _, sco := range scos {
+			if s.w.OwnsAddress(sco.UnlockHash) {
+				sum = sum.Add(sco.Value)
+			}
+		}
+		return sum
+	}
+	height := s.chain.Height()
+	now := time.Now()
+	for _, fc := range s.w.FileContracts(-1) {
+		if fc.WindowEnd <= height || resolved[fc.ID] {
+			continue
+		}
+		valid, missed := owned(fc.ValidProofOutputs), owned(fc.MissedProofOutputs)
+		resp.ActiveContracts++
+		resp.CollateralLocked = resp.CollateralLocked.Add(valid)
+		if valid.Cmp(missed) > 0 {
+			resp.AtRisk = resp.AtRisk.Add(valid.Sub(missed))
+		}
+		eta := now.Add(time.Duration(fc.WindowEnd-height) * time.Duration(types.BlockFrequency) * time.Second)
+		resp.ExpectedPayouts = groupByWeek(resp.ExpectedPayouts, eta, valid)
+	}
+	writeJSON(w, resp)
+}
+
+// parsePeriod parses the 'start' and 'end' query parameters, defaulting to the
+// past 30 days.
+func parsePeriod(req *http.Request) (start, end time.Time, err error) {
+	end = time.Now()
+	start = end.AddDate(0, 0, -30)
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"start", &start}, {"end", &end}} {
+		if v := req.FormValue(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return time.Time{}, time.Time{}, fmt.Errorf("Invalid '%v' value: %v", p.name, err)
+			}
+			*p.t = t
+		}
+	}
+	return start, end, nil
+}
+
+// parseCSVOptions parses the CSV formatting options of a report request.
+func (s *server) parseCSVOptions(req *http.Request) (CSVOptions, error) {
+	opts := CSVOptions{
+		Decimal:    req.FormValue("decimal"),
+		DateFormat: req.FormValue("dateformat"),
+		Currency:   strings.ToLower(req.FormValue("currency")),
+	}
+	if err := opts.validate(); err != nil {
+		return CSVOptions{}, err
+	} else if opts.Currency != "" && opts.Currency != strings.ToLower(s.t.Currency()) {
+		if s.t.Currency() == "" {
+			return CSVOptions{}, errors.New("no exchange rates are recorded")
+		}
+		return CSVOptions{}, fmt.Errorf("exchange rates are only recorded in %v", s.t.Currency())
+	}
+	return opts, nil
+}
+
+func (s *server) reportsrenterHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	start, end, err := parsePeriod(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := ResponseRenterReport{
+		Start:             start,
+		End:               end,
+		ContractFormation: types.ZeroCurrency,
+		ContractRenewal:   types.ZeroCurrency,
+		Fees:              types.ZeroCurrency,
+		Other:             types.ZeroCurrency,
+		Total:             types.ZeroCurrency,
+	}
+
+	for _, f := range s.t.Flows() {
+		if f.Disposed.IsZero() || f.Timestamp.Before(resp.Start) || !f.Timestamp.Before(resp.End) {
+			continue
+		}
+		resp.Total = resp.Total.Add(f.Disposed)
+		txn, ok := s.w.Transaction(types.TransactionID(f.ID))
+		if !ok {
+			resp.Other = resp.Other.Add(f.Disposed)
+			continue
+		}
+		fees := types.ZeroCurrency
+		for _, fee := range txn.MinerFees {
+			fees = fees.Add(fee)
+		}
+		if fees.Cmp(f.Disposed) > 0 {
+			fees = f.Disposed
+		}
+		resp.Fees = resp.Fees.Add(fees)
+		spent := f.Disposed.Sub(fees)
+		if len(txn.FileContracts) == 0 {
+			resp.Other = resp.Other.Add(spent)
+			continue
+		}
+		// renewed contracts carry over the data of the contract they renew,
+		// whereas newly-formed contracts are empty
+		if txn.FileContracts[0].FileSize > 0 {
+			resp.ContractsRenewed += len(txn.FileContracts)
+			resp.ContractRenewal = resp.ContractRenewal.Add(spent)
+		} else {
+			resp.ContractsFormed += len(txn.FileContracts)
+			resp.ContractFormation = resp.ContractFormation.Add(spent)
+		}
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) reportsstatementHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	start, end, err := parsePeriod(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	st := buildStatement(s.t.Flows(), start, end)
+	st.Generated = time.Now()
+	st.Height = s.w.ChainHeight()
+
+	var file []byte
+	switch req.FormValue("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		file = st.MarshalIndentedJSON()
+	case "csv":
+		opts, err := s.parseCSVOptions(req)
+		if err != nil {
+			http.Error(w, "Invalid CSV options: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		file = st.EncodeCSV(opts)
+	default:
+		http.Error(w, "Invalid format: must be 'json' or 'csv'", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set(StatementSignatureHeader, hex.EncodeToString(ed25519.Sign(s.statementKey, file)))
+	w.Write(file)
+}
+
+func (s *server) reportsstatementkeyHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	writeJSON(w, hex.EncodeToString(s.statementKey.Public().(ed25519.PublicKey)))
+}
+
+func (s *server) reservesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	message := req.FormValue("message")
+	if message == "" {
+		http.Error(w, "Missing 'message' parameter", http.StatusBadRequest)
+		return
+	} else if len(message) > maxOwnershipMessage {
+		http.Error(w, "Message too long", http.StatusBadRequest)
+		return
+	}
+	// the balances must all be read at the same height; if a block is
+	// processed while they are being read, try again
+	var height types.BlockHeight
+	var balances map[types.UnlockHash]types.Currency
+	for attempt := 0; ; attempt++ {
+		height = s.w.ChainHeight()
+		balances = make(map[types.UnlockHash]types.Currency)
+		for _, o := range s.w.UnspentOutputs(false) {
+			balances[o.UnlockHash] = balances[o.UnlockHash].Add(o.Value)
+		}
+		if s.w.ChainHeight() == height {
+			break
+		} else if attempt == 2 {
+			http.Error(w, "Wallet is processing blocks; try again later", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	b, ok := s.chain.BlockAtHeight(height)
+	if !ok {
+		http.Error(w, "Wallet height is not in the current chain; try again later", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, newReservesAttestation(height, b.ID(), message, balances, func(addr types.UnlockHash) (types.UnlockConditions, uint64) {
+		info, _ := s.w.AddressInfo(addr)
+		return info.UnlockConditions, info.KeyIndex
+	}))
+}
+
+// nextSeedIndex returns the lowest seed index that has been neither used nor
+// reserved.
+func (s *server) nextSeedIndex() uint64 {
+	index := s.w.SeedIndex()
+	reserved := s.reserved
+	if s.t != nil {
+		reserved = s.t.ReservedSeedIndex()
+		if s.t.Lookahead() > 0 {
+			// the wallet's seed index includes the lookahead window
+			return reserved
+		}
+	}
+	if reserved > index {
+		index = reserved
+	}
+	return index
+}
+
+func (s *server) sandboxfaucetHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var rsf RequestSandboxFaucet
+	if err := json.NewDecoder(req.Body).Decode(&rsf); err != nil {
+		http.Error(w, "Could not parse request: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if rsf.Value.IsZero() {
+		http.Error(w, "Value must be nonzero", http.StatusBadRequest)
+		return
+	}
+	txid, err := s.sandbox.Faucet(rsf.Address, rsf.Value)
+	if err != nil {
+		http.Error(w, "Couldn't mint funds: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, ResponseSandboxFaucet{TransactionID: txid})
+}
+
+func (s *server) sandboxmineHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	n := 1
+	if req.FormValue("blocks") != "" {
+		var err error
+		n, err = strconv.Atoi(req.FormValue("blocks"))
+		if err != nil || n < 1 || n > maxSandboxBlocks {
+			http.Error(w, fmt.Sprintf("Invalid 'blocks' value: must be between 1 and %v", maxSandboxBlocks), http.StatusBadRequest)
+			return
+		}
+	}
+	ids, err := s.sandbox.Mine(n)
+	if err != nil {
+		http.Error(w, "Couldn't mine blocks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, ids)
+}
+
+func (s *server) sandboxreorgHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	depth := 1
+	if req.FormValue("depth") != "" {
+		var err error
+		depth, err = strconv.Atoi(req.FormValue("depth"))
+		if err != nil || depth < 1 || depth > maxSandboxBlocks {
+			http.Error(w, fmt.Sprintf("Invalid 'depth' value: must be between 1 and %v", maxSandboxBlocks), http.StatusBadRequest)
+			return
+		}
+	}
+	if types.BlockHeight(depth) > s.chain.Height() {
+		http.Error(w, "Cannot revert the genesis block", http.StatusBadRequest)
+		return
+	}
+	ids, err := s.sandbox.Reorg(depth)
+	if err != nil {
+		http.Error(w, "Couldn't reorg: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, ids)
+}
+
+func (s *server) seedindexHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	writeJSON(w, s.nextSeedIndex())
+}
+
+func (s *server) seedindexreserveHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	count := uint64(1)
+	if req.FormValue("count") != "" {
+		var err error
+		count, err = strconv.ParseUint(req.FormValue("count"), 10, 64)
+		if err != nil || count == 0 || count > maxPreviewCount {
+			http.Error(w, fmt.Sprintf("Invalid 'count' value: must be between 1 and %v", maxPreviewCount), http.StatusBadRequest)
+			return
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start := s.nextSeedIndex()
+	end := start + count
+	if s.t != nil {
+		if err := s.t.ReserveSeedIndices(start, end); err != nil {
+			http.Error(w, "Couldn't record reservation: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.t.extendLookahead()
+	} else {
+		s.reserved = end
+	}
+	writeJSON(w, ResponseSeedIndexReserve{Start: start, End: end})
+}
+
+// maxPreviewCount is the maximum number of addresses returned by
+// /seedindex/preview.
+const maxPreviewCount = 1000
+
+func (s *server) seedindexpreviewHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	count := 1
+	if req.FormValue("count") != "" {
+		var err error
+		count, err = strconv.Atoi(req.FormValue("count"))
+		if err != nil || count < 0 || count > maxPreviewCount {
+			http.Error(w, fmt.Sprintf("Invalid 'count' value: must be between 0 and %v", maxPreviewCount), http.StatusBadRequest)
+			return
+		}
+	}
+	infos := deriveAddresses(s.keys, s.nextSeedIndex(), count)
+	resp := make([]ResponseSeedIndexPreview, len(infos))
+	for i, info := range infos {
+		resp[i] = ResponseSeedIndexPreview{
+			SeedAddressInfo: info,
+			Address:         info.UnlockConditions.UnlockHash(),
+		}
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) signHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var rs RequestSign
+	if err := json.NewDecoder(req.Body).Decode(&rs); err != nil {
+		http.Error(w, "Could not parse request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	txn := rs.Transaction
+	toSign := rs.ToSign
+	if len(toSign) == 0 {
+		for _, in := range txn.SiacoinInputs {
+			if s.w.OwnsAddress(in.UnlockConditions.UnlockHash()) {
+				toSign = append(toSign, crypto.Hash(in.ParentID))
+			}
+		}
+		for _, in := range txn.SiafundInputs {
+			if s.w.OwnsAddress(in.UnlockConditions.UnlockHash()) {
+				toSign = append(toSign, crypto.Hash(in.ParentID))
+			}
+		}
+		if len(toSign) == 0 {
+			http.Error(w, "Transaction has no inputs controlled by the wallet", http.StatusBadRequest)
+			return
+		}
+	}
+	keyIndices := make([]uint64, len(toSign))
+	for i, id := range toSign {
+		var uc types.UnlockConditions
+		var found bool
+		for _, in := range txn.SiacoinInputs {
+			if crypto.Hash(in.ParentID) == id {
+				uc, found = in.UnlockConditions, true
+				break
+			}
+		}
+		for _, in := range txn.SiafundInputs {
+			if crypto.Hash(in.ParentID) == id {
+				uc, found = in.UnlockConditions, true
+				break
+			}
+		}
+		if !found {
+			http.Error(w, "No input with ID "+id.String(), http.StatusBadRequest)
+			return
+		}
+		info, ok := s.w.AddressInfo(uc.UnlockHash())
+		if !ok {
+			http.Error(w, "Input "+id.String()+" is not controlled by the wallet", http.StatusBadRequest)
+			return
+		}
+		// the wallet may contain addresses derived from other seeds
+		if wallet.StandardUnlockConditions(s.seed.PublicKey(info.KeyIndex)).UnlockHash() != uc.UnlockHash() {
+			http.Error(w, "Input "+id.String()+" is not controlled by the server's seed", http.StatusBadRequest)
+			return
+		}
+		keyIndices[i] = info.KeyIndex
+	}
+	sign := func() error {
+		for i, id := range toSign {
+			sig := wallet.StandardTransactionSignature(id)
+			wallet.AppendTransactionSignature(&txn, sig, s.seed.SecretKey(keyIndices[i]))
+		}
+		return nil
+	}
+	if s.signing != nil {
+		memo := func() ([]byte, error) { return s.w.Memo(txn.ID()), nil }
+		if err := s.signing.authorize(txn, memo, s.ownsSeedAddress, sign); err != nil {
+			http.Error(w, "Transaction violates the signing policy: "+err.Error(), http.StatusForbidden)
+			return
+		}
+	} else {
+		sign()
+	}
+	writeJSON(w, txn)
+}
+
+// ownsSeedAddress reports whether addr is a wallet address derived from the
+// server's seed.
+func (s *server) ownsSeedAddress(addr types.UnlockHash) (bool, error) {
+	info, ok := s.w.AddressInfo(addr)
+	return ok && wallet.StandardUnlockConditions(s.seed.PublicKey(info.KeyIndex)).UnlockHash() == addr, nil
+}
+
+func (s *server) siafundsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	limbo := req.FormValue("limbo") == "true"
+	pool := s.t.SiafundPool()
+	resp := ResponseSiafunds{
+		Balance:      types.ZeroCurrency,
+		ClaimBalance: types.ZeroCurrency,
+		Pool:         pool,
+	}
+	for _, sfo := range unspentSiafundOutputs(s.t, s.w, limbo) {
+		resp.Balance = resp.Balance.Add(sfo.Value)
+		resp.ClaimBalance = resp.ClaimBalance.Add(sfo.ClaimAt(pool))
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) siafundsclaimsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	pool := s.t.SiafundPool()
+	sfos := s.t.SiafundOutputs()
+	resp := make([]ResponseSiafundClaim, len(sfos))
+	for i, sfo := range sfos {
+		resp[i].SiafundOutput = sfo
+		if !sfo.Spent {
+			resp[i].UnrealizedClaim = sfo.ClaimAt(pool)
+		}
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) siafundsutxosHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	limbo := req.FormValue("limbo") == "true"
+	pool := s.t.SiafundPool()
+	sfos := unspentSiafundOutputs(s.t, s.w, limbo)
+	resp := make([]ResponseSiafundClaim, len(sfos))
+	for i, sfo := range sfos {
+		resp[i].SiafundOutput = sfo
+		resp[i].UnrealizedClaim = sfo.ClaimAt(pool)
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) statsconfirmationsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	interval := 24 * time.Hour
+	if v := req.FormValue("interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			http.Error(w, "Invalid interval: "+err.Error(), http.StatusBadRequest)
+			return
+		} else if d < time.Minute {
+			http.Error(w, "Interval must be at least 1m", http.StatusBadRequest)
+			return
+		}
+		interval = d
+	}
+	since := time.Now().AddDate(0, 0, -30)
+	if v := req.FormValue("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid 'since' value: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+	resp := ResponseConfirmationStats{
+		Buckets:  []ResponseConfirmationBucket{},
+		FeeBands: []ResponseFeeBand{},
+		Pending:  s.t.PendingBroadcasts(),
+	}
+	if samples := s.t.ConfirmationSamples(since); len(samples) > 0 {
+		resp.Buckets, resp.FeeBands = confirmationBuckets(samples, interval)
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) sweepHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var dest types.UnlockHash
+	if err := dest.LoadString(req.FormValue("dest")); err != nil {
+		http.Error(w, "Invalid destination address: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	fee, err := s.parseFee(req.FormValue("fee"))
+	if err != nil {
+		http.Error(w, "Invalid fee: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	sb, err := draftSweepBundle(s.w, s.w.UnspentOutputs(true), dest, fee.FeePerByte)
+	if err != nil {
+		http.Error(w, "Couldn't draft sweep: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, sb)
+}
+
+func (s *server) transactionsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	if !s.checkLabelFilter(w, req) {
+		return
+	}
+	max := -1 // all txns
+	if req.FormValue("max") != "" {
+		var err error
+		max, err = strconv.Atoi(req.FormValue("max"))
+		if err != nil {
+			http.Error(w, "Invalid 'max' value: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var internal *bool
+	switch req.FormValue("internal") {
+	case "":
+	case "true", "false":
+		b := req.FormValue("internal") == "true"
+		internal = &b
+	default:
+		http.Error(w, "Invalid 'internal' value: must be 'true' or 'false'", http.StatusBadRequest)
+		return
+	}
+	pg, err := parsePage(req, "before")
+	if err != nil {
+		http.Error(w, "Invalid page: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.checkPageSize(w, "max", max) || !s.checkPageSize(w, "limit", pg.limit) {
+		return
+	}
+	labels := req.URL.Query()["label"]
+	// when filtering or paging, max must be applied afterward
+	limit := max
+	if internal != nil || len(labels) > 0 || pg.active() {
+		limit = -1
+	}
+
+	var resp []types.TransactionID
+	if req.FormValue("addr") != "" {
+		var addr types.UnlockHash
+		if err := addr.LoadString(req.FormValue("addr")); err != nil {
+			http.Error(w, "Invalid address: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp = newestFirst(s.w.TransactionsByAddress(addr, limit))
+	} else {
+		resp = newestFirst(s.w.Transactions(limit))
+	}
+	if internal != nil {
+		filtered := resp[:0]
+		for _, id := range resp {
+			if txn, ok := s.w.Transaction(id); ok && isInternal(s.w, txn.Transaction) == *internal {
+				filtered = append(filtered, id)
+			}
+		}
+		resp = filtered
+	}
+	if len(labels) > 0 {
+		labeled := labeledAddresses(s.t, labels)
+		filtered := resp[:0]
+		for _, id := range resp {
+			if txn, ok := s.w.Transaction(id); ok && involvesAddress(txn.Transaction, labeled) {
+				filtered = append(filtered, id)
+			}
+		}
+		resp = filtered
+	}
+	if pg.active() {
+		start, end, ok := pg.bounds(len(resp), func(i int) crypto.Hash { return crypto.Hash(resp[i]) })
+		if !ok {
+			http.Error(w, errCursorNotFound, http.StatusBadRequest)
+			return
+		}
+		resp = resp[start:end]
+	}
+	if max >= 0 && len(resp) > max {
+		resp = resp[:max]
+	} else if max < 0 && pg.limit < 0 && !s.checkListingSize(w, len(resp)) {
+		return
+	}
+	writeListing(w, req, resp)
+}
+
+// newestFirst returns a copy of txids, which the wallet orders
+// oldest-to-newest, in newest-to-oldest order.
+func newestFirst(txids []types.TransactionID) []types.TransactionID {
+	rev := make([]types.TransactionID, len(txids))
+	for i, id := range txids {
+		rev[len(rev)-1-i] = id
+	}
+	return rev
+}
+
+func (s *server) transactionsidHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var txid crypto.Hash
+	if err := txid.LoadString(ps.ByName("txid")); err != nil {
+		http.Error(w, "Invalid transaction ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	txn, ok := s.w.Transaction(types.TransactionID(txid))
+	if !ok {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	// calculate inflow/outflow
+	var inflow, outflow, change types.Currency
+	isChange := changeOutputs(s.w, txn.Transaction)
+	for i, sco := range txn.SiacoinOutputs {
+		if s.w.OwnsAddress(sco.UnlockHash) {
+			inflow = inflow.Add(sco.Value)
+			if isChange != nil && isChange[i] {
+				change = change.Add(sco.Value)
+			}
+		} else {
+			outflow = outflow.Add(sco.Value)
+		}
+	}
+	writeJSONFields(w, ResponseTransactionsID{
+		Transaction: txn.Transaction,
+		BlockID:     txn.BlockID,
+		BlockHeight: txn.BlockHeight,
+		Timestamp:   txn.Timestamp,
+		FeePerByte:  txn.FeePerByte,
+		Inflow:      inflow,
+		Outflow:     outflow,
+		Change:      change,
+		Internal:    isInternal(s.w, txn.Transaction),
+	}, req.FormValue("fields"))
+}
+
+// A transactionFinder can look up an unconfirmed transaction by ID. The Sia
+// transaction pool satisfies this interface.
+type transactionFinder interface {
+	Transaction(id types.TransactionID) (types.Transaction, []types.Transaction, bool)
+}
+
+// defaultSearchDepth is the number of recent blocks searched for a transaction
+// that is not relevant to the wallet.
+const defaultSearchDepth = 1008
+
+func (s *server) transactionsidannotationHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var txid crypto.Hash
+	if err := txid.LoadString(ps.ByName("txid")); err != nil {
+		http.Error(w, "Invalid transaction ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	annotation, ok := s.t.Annotation(types.TransactionID(txid))
+	if !ok {
+		http.Error(w, "No annotation for that transaction", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, annotation)
+}
+
+func (s *server) transactionsidproofHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var txid crypto.Hash
+	if err := txid.LoadString(ps.ByName("txid")); err != nil {
+		http.Error(w, "Invalid transaction ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	txn, ok := s.w.Transaction(types.TransactionID(txid))
+	if !ok {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	proof, err := transactionProof(s.chain, txn)
+	if err != nil {
+		http.Error(w, "Couldn't build proof: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, proof)
+}
+
+func (s *server) transactionsidrawHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var txid crypto.Hash
+	if err := txid.LoadString(ps.ByName("txid")); err != nil {
+		http.Error(w, "Invalid transaction ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	anyRelevance := req.FormValue("anyrelevance") == "true"
+	depth := defaultSearchDepth
+	if req.FormValue("depth") != "" {
+		var err error
+		depth, err = strconv.Atoi(req.FormValue("depth"))
+		if err != nil || depth < 0 {
+			http.Error(w, "Invalid depth", http.StatusBadRequest)
+			return
+		}
+	}
+
+	id := types.TransactionID(txid)
+	if txn, ok := s.w.Transaction(id); ok {
+		writeJSON(w, ResponseTransactionsIDRaw{
+			Transaction: txn.Transaction,
+			BlockID:     txn.BlockID,
+			BlockHeight: txn.BlockHeight,
+			Confirmed:   true,
+		})
+		return
+	}
+	for _, txn := range s.w.LimboTransactions() {
+		if txn.ID() == id {
+			writeJSON(w, ResponseTransactionsIDRaw{Transaction: txn.Transaction})
+			return
+		}
+	}
+	if anyRelevance {
+		if txn, ok := s.chain.UnconfirmedTransaction(id); ok {
+			writeJSON(w, ResponseTransactionsIDRaw{Transaction: txn})
+			return
+		}
+		// search recent blocks, newest first
+		tip := s.chain.Height()
+		for i := 0; i < depth && types.BlockHeight(i) <= tip; i++ {
+			height := tip - types.BlockHeight(i)
+			b, ok := s.chain.BlockAtHeight(height)
+			if !ok {
+				break
+			}
+			for _, txn := range b.Transactions {
+				if txn.ID() == id {
+					writeJSON(w, ResponseTransactionsIDRaw{
+						Transaction: txn,
+						BlockID:     b.ID(),
+						BlockHeight: height,
+						Confirmed:   true,
+					})
+					return
+				}
+			}
+		}
+	}
+	http.Error(w, "Transaction not found", http.StatusNotFound)
+}
+
+func (s *server) unconfirmedparentsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	// accept either a single transaction or a transaction set
+	var js json.RawMessage
+	if err := json.NewDecoder(req.Body).Decode(&js); err != nil {
+		http.Error(w, "Could not parse transaction: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if trimmed := strings.TrimSpace(string(js)); !strings.HasPrefix(trimmed, "[") {
+		// a single transaction yields only its direct parents
+		var txn types.Transaction
+		if err := json.Unmarshal(js, &txn); err != nil {
+			http.Error(w, "Could not parse transaction: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, wallet.UnconfirmedParents(txn, s.w.LimboTransactions()))
+		return
+	}
+	var txnSet []types.Transaction
+	if err := json.Unmarshal(js, &txnSet); err != nil {
+		http.Error(w, "Could not parse transaction set: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, unconfirmedAncestors(txnSet, s.w.LimboTransactions()))
+}
+
+// unconfirmedAncestors returns every transaction in limbo that txnSet depends
+// on, directly or indirectly, ordered such that each transaction follows its
+// parents. Transactions in txnSet itself are excluded.
+func unconfirmedAncestors(txnSet []types.Transaction, limbo []wallet.LimboTransaction) []wallet.LimboTransaction {
+	seen := make(map[types.TransactionID]bool)
+	for _, txn := range txnSet {
+		seen[txn.ID()] = true
+	}
+	var ancestors []wallet.LimboTransaction
+	var visit func(txn types.Transaction)
+	visit = func(txn types.Transaction) {
+		for _, p := range wallet.UnconfirmedParents(txn, limbo) {
+			if id := p.ID(); !seen[id] {
+				seen[id] = true
+				visit(p.Transaction)
+				ancestors = append(ancestors, p)
+			}
+		}
+	}
+	for _, txn := range txnSet {
+		visit(txn)
+	}
+	return ancestors
+}
+
+func (s *server) usageHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	total, window := s.requests.counts()
+	resp := ResponseUsage{
+		Addresses:          len(s.w.Addresses()),
+		Requests:           total,
+		RequestsThisMinute: window,
+		Quota:              s.quota,
+	}
+	if s.t != nil {
+		resp.PushDevices = len(s.t.PushDevices())
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) utxosHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	if !s.checkLabelFilter(w, req) {
+		return
+	}
+	limbo := req.FormValue("limbo") == "true"
+	// outputs created by Limbo transactions aren't in the Tracker yet
+	inLimbo := make(map[types.SiacoinOutputID]bool)
+	limboChange := make(map[types.SiacoinOutputID]bool)
+	if limbo {
+		for _, txn := range s.w.LimboTransactions() {
+			for i := range txn.SiacoinOutputs {
+				inLimbo[txn.SiacoinOutputID(uint64(i))] = true
+			}
+			for i, isChange := range changeOutputs(s.w, txn.Transaction) {
+				limboChange[txn.SiacoinOutputID(uint64(i))] = isChange
+			}
+		}
+	}
+	pg, err := parsePage(req, "after")
+	if err != nil {
+		http.Error(w, "Invalid page: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.checkPageSize(w, "limit", pg.limit) {
+		return
+	}
+	f := parseOutputFilter(req.URL.Query())
+	outputs := s.withoutDust(filterOutputs(s.t, s.w.UnspentOutputs(limbo), f), f.IncludeDust)
+	// order by ID, so that pages are stable
+	sort.Slice(outputs, func(i, j int) bool {
+		return bytes.Compare(outputs[i].ID[:], outputs[j].ID[:]) < 0
+	})
+	start, end, ok := pg.bounds(len(outputs), func(i int) crypto.Hash { return crypto.Hash(outputs[i].ID) })
+	if !ok {
+		http.Error(w, errCursorNotFound, http.StatusBadRequest)
+		return
+	}
+	outputs = outputs[start:end]
+	if pg.limit < 0 && !s.checkListingSize(w, len(outputs)) {
+		return
+	}
+	resp := make([]ResponseUnspentOutput, len(outputs))
+	for i, o := range outputs {
+		resp[i] = ResponseUnspentOutput{
+			UnspentOutput: o,
+			IsChange:      limboChange[o.ID] || (s.t != nil && s.t.IsChange(o.ID)),
+			Limbo:         inLimbo[o.ID],
+			LockID:        s.locks.holder(o.ID),
+		}
+	}
+	if s.t != nil {
+		for i, meta := range s.t.outputsMetadata(outputs) {
+			resp[i].Metadata = meta
+		}
+		for i, height := range s.t.outputHeights(outputs) {
+			if !resp[i].Limbo {
+				resp[i].BlockHeight = height
+			}
+		}
+	}
+	writeListing(w, req, resp)
+}
+
+// defaultTraceDepth is the number of generations traced by /utxos/:id/trace.
+const defaultTraceDepth = 10
+
+func (s *server) utxosidmetadataHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var id types.SiacoinOutputID
+	if err := (*crypto.Hash)(&id).LoadString(ps.ByName("id")); err != nil {
+		http.Error(w, "Invalid ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	meta := s.t.OutputMetadata(id)
+	if meta == nil {
+		meta = make(map[string]string)
+	}
+	writeJSON(w, meta)
+}
+
+func (s *server) utxosidmetadataHandlerPUT(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var id types.SiacoinOutputID
+	if err := (*crypto.Hash)(&id).LoadString(ps.ByName("id")); err != nil {
+		http.Error(w, "Invalid ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var meta map[string]string
+	if err := json.NewDecoder(req.Body).Decode(&meta); err != nil {
+		http.Error(w, "Could not parse metadata: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.t.SetOutputMetadata(id, meta); err != nil {
+		http.Error(w, "Couldn't set metadata: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+func (s *server) utxosidproofHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var id types.SiacoinOutputID
+	if err := (*crypto.Hash)(&id).LoadString(ps.ByName("id")); err != nil {
+		http.Error(w, "Invalid ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	proof, ok, err := outputProof(s.w, s.chain, id)
+	if !ok {
+		http.Error(w, "Output not found in wallet history", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Couldn't build proof: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, proof)
+}
+
+func (s *server) utxosidtraceHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var id types.SiacoinOutputID
+	if err := (*crypto.Hash)(&id).LoadString(ps.ByName("id")); err != nil {
+		http.Error(w, "Invalid ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	depth := defaultTraceDepth
+	if req.FormValue("depth") != "" {
+		var err error
+		depth, err = strconv.Atoi(req.FormValue("depth"))
+		if err != nil || depth < 0 {
+			http.Error(w, "Invalid depth", http.StatusBadRequest)
+			return
+		}
+	}
+	trace := traceOutput(s.w, id, depth)
+	if trace[0].Source == OutputSourceExternal {
+		http.Error(w, "Output not found in wallet history", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, trace)
+}
+
+func (s *server) utxoslockHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var rl RequestLockUTXOs
+	if err := json.NewDecoder(req.Body).Decode(&rl); err != nil {
+		http.Error(w, "Could not parse request: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if !validLockID(rl.LockID) {
+		http.Error(w, "Lock ID must be non-empty and at most 64 bytes", http.StatusBadRequest)
+		return
+	} else if len(rl.IDs) == 0 {
+		http.Error(w, "Must specify at least one output", http.StatusBadRequest)
+		return
+	}
+	d, err := parseLockDuration(rl.Duration)
+	if err != nil {
+		http.Error(w, "Invalid duration: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	unspent := make(map[types.SiacoinOutputID]bool)
+	for _, o := range s.w.UnspentOutputs(true) {
+		unspent[o.ID] = true
+	}
+	for _, id := range rl.IDs {
+		if !unspent[id] {
+			http.Error(w, "Output "+id.String()+" is not an unspent output of the wallet", http.StatusBadRequest)
+			return
+		}
+	}
+	expires, err := s.locks.lock(rl.LockID, rl.IDs, d)
+	if err != nil {
+		http.Error(w, "Couldn't lock outputs: one or more are held by another lock", http.StatusConflict)
+		return
+	}
+	writeJSON(w, ResponseLockUTXOs{Expires: expires})
+}
+
+func (s *server) utxosreleaseHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var rr RequestReleaseUTXOs
+	if err := json.NewDecoder(req.Body).Decode(&rr); err != nil {
+		http.Error(w, "Could not parse request: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if !validLockID(rr.LockID) {
+		http.Error(w, "Lock ID must be non-empty and at most 64 bytes", http.StatusBadRequest)
+		return
+	}
+	s.locks.release(rr.LockID, rr.IDs)
+}
+
+func withdrawalResponse(pw PendingWithdrawal) ResponseWithdrawal {
+	rw := ResponseWithdrawal{
+		ID:             pw.ID,
+		TransactionIDs: make([]types.TransactionID, len(pw.Transactions)),
+		Value:          pw.Value,
+		Queued:         pw.Queued,
+		Release:        pw.Release,
+		LastError:      pw.LastError,
+	}
+	for i, txn := range pw.Transactions {
+		rw.TransactionIDs[i] = txn.ID()
+	}
+	return rw
+}
+
+func (s *server) splitsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	rs := s.t.SplitRules()
+	if rs == nil {
+		rs = []SplitRule{}
+	}
+	writeJSON(w, rs)
+}
+
+func (s *server) splitsnameHandlerPUT(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var r SplitRule
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		http.Error(w, "Could not parse split rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Name = ps.ByName("name")
+	if err := validateSplitRule(r); err != nil {
+		http.Error(w, "Invalid split rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, addr := range r.Sources {
+		if !s.w.OwnsAddress(addr) {
+			http.Error(w, "Source "+addr.String()+" is not in the wallet", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := s.t.SetSplitRule(r); err != nil {
+		http.Error(w, "Couldn't store split rule: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *server) splitsnameHandlerDELETE(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	if err := s.t.RemoveSplitRule(ps.ByName("name")); err != nil {
+		http.Error(w, "Couldn't remove split rule: "+err.Error(), http.StatusNotFound)
+		return
+	}
+}
+
+func (s *server) splitsnamedraftHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	r, ok := s.t.SplitRule(ps.ByName("name"))
+	if !ok {
+		http.Error(w, "No such split rule", http.StatusNotFound)
+		return
+	}
+	outputs := splitSources(s.w, r)
+	if len(outputs) == 0 {
+		http.Error(w, "Sources have no unspent outputs", http.StatusBadRequest)
+		return
+	}
+	fee, err := s.parseFee(req.FormValue("fee"))
+	if err != nil {
+		http.Error(w, "Invalid fee: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	txn, keyIndices, ok := draftSweep(s.w, outputs, r.Destinations, fee.FeePerByte)
+	if !ok {
+		http.Error(w, "Sources hold too little value to pay the transaction fee and every destination", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, ResponseSplitDraft{
+		Rule:        r,
+		Fee:         fee,
+		Transaction: txn,
+		KeyIndices:  keyIndices,
+	})
+}
+
+func (s *server) templatesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	tts := s.t.Templates()
+	if tts == nil {
+		tts = []TransactionTemplate{}
+	}
+	writeJSON(w, tts)
+}
+
+func (s *server) templatesnameHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	tt, ok := s.t.Template(ps.ByName("name"))
+	if !ok {
+		http.Error(w, "No such template", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, tt)
+}
+
+func (s *server) templatesnameHandlerPUT(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var tt TransactionTemplate
+	if err := json.NewDecoder(req.Body).Decode(&tt); err != nil {
+		http.Error(w, "Could not parse template: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	tt.Name = ps.ByName("name")
+	if err := validateTemplate(tt); err != nil {
+		http.Error(w, "Invalid template: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if err := s.t.SetTemplate(tt); err != nil {
+		http.Error(w, "Couldn't store template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *server) templatesnameHandlerDELETE(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	if err := s.t.RemoveTemplate(ps.ByName("name")); err != nil {
+		http.Error(w, "Couldn't remove template: "+err.Error(), http.StatusNotFound)
+		return
+	}
+}
+
+func (s *server) templatesnamebuildHandlerPOST(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	tt, ok := s.t.Template(ps.ByName("name"))
+	if !ok {
+		http.Error(w, "No such template", http.StatusNotFound)
+		return
+	}
+	var rtb RequestTemplateBuild
+	if err := json.NewDecoder(req.Body).Decode(&rtb); err != nil {
+		http.Error(w, "Could not parse request: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if tt.usesPercent() && rtb.Total.IsZero() {
+		http.Error(w, "Template has percentage recipients, so a total must be specified", http.StatusBadRequest)
+		return
+	}
+	fee, err := s.parseFee(rtb.Fee)
+	if err != nil {
+		http.Error(w, "Invalid fee: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	outputs := templateOutputs(tt, rtb.Total)
+	for _, o := range outputs {
+		if o.Value.IsZero() {
+			http.Error(w, "Total is too small to pay every recipient", http.StatusBadRequest)
+			return
+		}
+	}
+	changeAddr := tt.ChangeAddress
+	if rtb.ChangeAddress != (types.UnlockHash{}) {
+		changeAddr = rtb.ChangeAddress
+	}
+	utxos := s.withoutDust(filterOutputs(s.t, s.locks.filter(s.w.UnspentOutputs(true), ""), rtb.Outputs), rtb.Outputs.IncludeDust)
+	txn, keyIndices, err := draftTemplate(s.w, coinInputs(s.t, s.w, utxos), "", outputs, changeAddr, fee.FeePerByte, types.ZeroCurrency, s.t.dust)
+	if err != nil {
+		http.Error(w, "Couldn't build transaction: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	total := types.ZeroCurrency
+	for _, o := range outputs {
+		total = total.Add(o.Value)
+	}
+	memo := expandMemo(tt, total, rtb.Vars, time.Now())
+	if memo != "" {
+		s.w.SetMemo(txn.ID(), []byte(memo))
+	}
+	writeJSON(w, ResponseTemplateBuild{
+		Template:    tt,
+		Fee:         fee,
+		Transaction: txn,
+		KeyIndices:  keyIndices,
+		Memo:        memo,
+	})
+}
+
+func (s *server) vaultHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	p, ok := s.t.VaultPolicy()
+	if !ok {
+		http.Error(w, "No vault policy is configured", http.StatusNotFound)
+		return
+	}
+	resp := ResponseVault{
+		Threshold:   p.Threshold,
+		Delay:       p.Delay.String(),
+		RecoveryKey: hex.EncodeToString(p.RecoveryKey),
+		Withdrawals: []ResponseWithdrawal{},
+	}
+	for _, pw := range s.t.PendingWithdrawals() {
+		resp.Withdrawals = append(resp.Withdrawals, withdrawalResponse(pw))
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) vaultwithdrawalsidHandlerDELETE(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var id crypto.Hash
+	if err := id.LoadString(ps.ByName("id")); err != nil {
+		http.Error(w, "Invalid withdrawal ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var rcw RequestCancelWithdrawal
+	if err := json.NewDecoder(req.Body).Decode(&rcw); err != nil {
+		http.Error(w, "Could not parse request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	sig, err := hex.DecodeString(rcw.Signature)
+	if err != nil {
+		http.Error(w, "Invalid signature: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.t.CancelWithdrawal(id, rcw.Timestamp, sig); err != nil {
+		http.Error(w, "Couldn't cancel withdrawal: "+err.Error(), http.StatusForbidden)
+		return
+	}
+}
+
+func (s *server) versionHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	writeJSON(w, ResponseVersion{
+		Version:     Version,
+		APIRevision: APIRevision,
+		Network:     s.network,
+		Features:    s.features(),
+	})
+}
+
+func (s *server) walletidHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	addr, ok := s.firstAddress()
+	if !ok {
+		http.Error(w, "Wallet ID unknown: the wallet must contain exactly one address with seed index 0", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, ResponseWalletID{
+		ID:      WalletIDForAddress(addr),
+		Address: addr,
+	})
+}
+
+// A ServerOption modifies the default behavior of a server.
+type ServerOption func(*server)
+
+// WithNetwork sets the name of the network reported by the server. The
+// default is the name reported by the server's ChainAdapter, which is
+// "mainnet" for NewServer.
+func WithNetwork(network string) ServerOption {
+	return func(s *server) {
+		s.network = network
+	}
+}
+
+// WithTracker enables the routes that require a Tracker, such as those
+// relating to siafunds and events.
+func WithTracker(t *Tracker) ServerOption {
+	return func(s *server) {
+		s.t = t
+	}
+}
+
+// WithRateProvider sets the provider used to convert siacoin amounts to fiat
+// currencies.
+func WithRateProvider(rp RateProvider) ServerOption {
+	return func(s *server) {
+		s.rates = rp
+	}
+}
+
+// WithFeeEstimator sets the source of the fee estimates served by /fee and
+// /fee/tiers and used to draft transactions. By default, the estimate of the
+// local transaction pool is used, which is also the fallback if fe fails.
+func WithFeeEstimator(fe FeeEstimator) ServerOption {
+	return func(s *server) {
+		s.fees = fe
+	}
+}
+
+// WithDustThreshold causes the server to treat outputs worth less than
+// threshold as dust. By default, dust is excluded from /balance and /utxos,
+// and is not selected to fund the transactions built by /construct and
+// /templates/:name/build; clients may override this with the includeDust
+// parameter or OutputFilter.IncludeDust. Since dust is never a candidate for
+// coin selection, a Tracker's DustPolicy only consolidates outputs worth at
+// least threshold. The default threshold is zero, i.e. no outputs are dust.
+func WithDustThreshold(threshold types.Currency) ServerOption {
+	return func(s *server) {
+		s.dust = threshold
+	}
+}
+
+// WithMaxBlocksBehind sets how many blocks the wallet may lag behind the
+// network before /ready reports that the server is not ready. The default is
+// DefaultMaxBlocksBehind.
+func WithMaxBlocksBehind(n types.BlockHeight) ServerOption {
+	return func(s *server) {
+		s.maxBehind = n
+	}
+}
+
+// WithMaxPageSize sets the maximum number of items that a listing endpoint,
+// such as /transactions, returns in a single response. Requests for larger
+// pages are rejected, as are requests without a limit whose listings would
+// exceed it. If n <= 0, responses are unbounded. The default is
+// DefaultMaxPageSize.
+func WithMaxPageSize(n int) ServerOption {
+	return func(s *server) {
+		s.maxPage = n
+	}
+}
+
+// WithSyncWatchdog causes /ready to report that the server is not ready while
+// sw reports that consensus sync has stalled.
+func WithSyncWatchdog(sw *SyncWatchdog) ServerOption {
+	return func(s *server) {
+		s.sync = sw
+	}
+}
+
+// WithStatementKey sets the key used to sign the statements produced by
+// /reports/statement. Statements are only available if a key is set.
+func WithStatementKey(key ed25519.PrivateKey) ServerOption {
+	return func(s *server) {
+		s.statementKey = key
+	}
+}
+
+// WithKeySource allows the server to derive addresses using the public keys
+// provided by ks, enabling routes such as /seedindex/preview.
+func WithKeySource(ks KeySource) ServerOption {
+	return func(s *server) {
+		s.keys = ks
+	}
+}
+
+// WithSigningSeed allows the server to sign transactions with seed via /sign,
+// so that clients need not handle key material. Since any client that can
+// reach /sign can spend the wallet's funds, the route is only served if
+// credentials are also configured via WithCredentials.
+func WithSigningSeed(seed wallet.Seed) ServerOption {
+	return func(s *server) {
+		s.seed = &seed
+	}
+}
+
+// WithSigningPolicy restricts the transactions signed via /sign to those that
+// satisfy p. Unlike a PolicySigner, the policy is enforced by the server, so
+// clients cannot bypass it. The daily limit is not preserved across restarts.
+func WithSigningPolicy(p SigningPolicy) ServerOption {
+	return func(s *server) {
+		s.signing = &spendLimiter{policy: p}
+	}
+}
+
+// WithQuota limits the resources that clients of the server may consume.
+func WithQuota(q Quota) ServerOption {
+	return func(s *server) {
+		s.quota = q
+	}
+}
+
+// WithLeader configures the server to act as a warm standby unless l reports
+// that it is the leader. Standbys reject broadcasts.
+func WithLeader(l Leader) ServerOption {
+	return func(s *server) {
+		s.leader = l
+	}
+}
+
+// WithIndexRebuilder allows /db/verify to repair the wallet's index using ib.
+func WithIndexRebuilder(ib IndexRebuilder) ServerOption {
+	return func(s *server) {
+		s.rebuild = ib
+	}
+}
+
+// WithGateway allows the server to report the number of peers that broadcast
+// transactions were relayed to.
+func WithGateway(g Gateway) ServerOption {
+	return func(s *server) {
+		s.g = g
+	}
+}
+
+// WithSandbox enables the /sandbox routes, which mint funds, mine blocks, and
+// trigger reorgs on the server's simulated blockchain. sb should be the
+// server's ConsensusSet; it must never be used with a real blockchain.
+func WithSandbox(sb Sandbox) ServerOption {
+	return func(s *server) {
+		s.sandbox = sb
+	}
+}
+
+// WithAllowedOrigins allows web pages served from the specified origins, e.g.
+// "https://dashboard.example.com", to open WebSocket connections to the
+// server. By default, only pages served by the server itself may do so;
+// clients that are not browsers are unaffected.
+func WithAllowedOrigins(origins ...string) ServerOption {
+	return func(s *server) {
+		s.origins = origins
+	}
+}
+
+// NewServer returns an HTTP handler that serves the walrus API for the Sia
+// network.
+func NewServer(w *wallet.SeedWallet, cs ConsensusSet, tp TransactionPool, opts ...ServerOption) http.Handler {
+	return NewChainServer(w, SiaAdapter{CS: cs, TP: tp}, opts...)
+}
+
+// NewChainServer returns an HTTP handler that serves the walrus API for the
+// network provided by chain.
+func NewChainServer(w *wallet.SeedWallet, chain ChainAdapter, opts ...ServerOption) http.Handler {
+	s := server{
+		w:         w,
+		chain:     chain,
+		network:   chain.Network(),
+		maxBehind: DefaultMaxBlocksBehind,
+		maxPage:   DefaultMaxPageSize,
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	mux := httprouter.New()
+	mux.GET(api.Addresses, s.addressesHandler)
+	mux.POST(api.Addresses, s.addressesHandlerPOST)
+	if s.keys != nil {
+		mux.POST(api.AddressesNext, s.addressesnextHandlerPOST)
+	}
+	mux.GET(api.AddressesAddr, s.addressesaddrHandlerGET)
+	mux.DELETE(api.AddressesAddr, s.addressesaddrHandlerDELETE)
+	mux.GET(api.AddressesAddrOwnership, s.addressesaddrownershipHandler)
+	mux.GET(api.Balance, s.balanceHandler)
+	mux.POST(api.Batch, s.batchHandlerPOST)
+	mux.GET(api.BlockRewards, s.blockrewardsHandler)
+	mux.POST(api.Broadcast, s.broadcastHandler)
+	mux.GET(api.Consensus, s.consensusHandler)
+	mux.POST(api.Consolidate, s.consolidateHandlerPOST)
+	mux.POST(api.Construct, s.constructHandler)
+	mux.POST(api.DBVerify, s.dbverifyHandlerPOST)
+	mux.GET(api.Fee, s.feeHandler)
+	mux.GET(api.FeeTiers, s.feetiersHandler)
+	mux.GET(api.FileContracts, s.filecontractsHandler)
+	mux.GET(api.FileContractsID, s.filecontractsidHandler)
+	mux.GET(api.HostAnnouncements, s.hostannouncementsHandler)
+	mux.PUT(api.LimboID, s.limboHandlerPUT)
+	mux.GET(api.Jobs, s.jobsHandler)
+	mux.GET(api.JobsID, s.jobsidHandler)
+	mux.DELETE(api.JobsID, s.jobsidHandlerDELETE)
+	mux.GET(api.Leader, s.leaderHandler)
+	mux.GET(api.Limbo, s.limboHandler)
+	mux.GET(api.LimboID, s.limboidHandler)
+	mux.DELETE(api.LimboID, s.limboHandlerDELETE)
+	mux.POST(api.LimboIDBump, s.limboidbumpHandlerPOST)
+	mux.PUT(api.LimboIDBump, s.limboidbumpHandlerPUT)
+	mux.PUT(api.MemosTxID, s.memosHandlerPUT)
+	mux.GET(api.MemosTxID, s.memosHandlerGET)
+	mux.GET(api.Network, s.networkHandler)
+	mux.POST(api.OwnershipVerify, s.ownershipverifyHandlerPOST)
+	mux.POST(api.Payouts, s.payoutsHandlerPOST)
+	mux.GET(api.Reserves, s.reservesHandler)
+	if s.sandbox != nil {
+		mux.POST(api.SandboxFaucet, s.sandboxfaucetHandlerPOST)
+		mux.POST(api.SandboxMine, s.sandboxmineHandlerPOST)
+		mux.POST(api.SandboxReorg, s.sandboxreorgHandlerPOST)
+	}
+	mux.GET(api.SeedIndex, s.seedindexHandler)
+	mux.POST(api.SeedIndexReserve, s.seedindexreserveHandlerPOST)
+	if s.keys != nil {
+		mux.GET(api.SeedIndexPreview, s.seedindexpreviewHandler)
+	}
+	if s.seed != nil && s.hasCredentials() {
+		mux.POST(api.Sign, s.signHandlerPOST)
+	}
+	mux.GET(api.Sweep, s.sweepHandler)
+	mux.GET(api.Transactions, s.transactionsHandler)
+	mux.GET(api.TransactionsTxID, s.transactionsidHandler)
+	mux.GET(api.TransactionsTxIDProof, s.transactionsidproofHandler)
+	mux.GET(api.TransactionsTxIDRaw, s.transactionsidrawHandler)
+	mux.POST(api.UnconfirmedParents, s.unconfirmedparentsHandler)
+	mux.GET(api.Usage, s.usageHandler)
+	mux.GET(api.UTXOs, s.utxosHandler)
+	mux.GET(api.UTXOsIDProof, s.utxosidproofHandler)
+	mux.GET(api.UTXOsIDTrace, s.utxosidtraceHandler)
+	mux.POST(api.UTXOsLock, s.utxoslockHandlerPOST)
+	mux.POST(api.UTXOsRelease, s.utxosreleaseHandlerPOST)
+	mux.GET(api.Version, s.versionHandler)
+	mux.GET(api.WalletID, s.walletidHandler)
+
+	// routes that require a Tracker
+	if s.t != nil {
+		mux.PUT(api.AddressesAddrLabel, s.addressesaddrlabelHandlerPUT)
+		mux.GET(api.Consolidation, s.consolidationHandler)
+		mux.GET(api.Deposits, s.depositsHandler)
+		mux.POST(api.Deposits, s.depositsHandlerPOST)
+		mux.PUT(api.DepositsAddrCallback, s.depositsaddrcallbackHandlerPUT)
+		mux.GET(api.DepositsAddrCheckout, s.depositsaddrcheckoutHandler)
+		mux.GET(api.Events, s.eventsHandler)
+		mux.GET(api.EventsSSE, s.eventssseHandler)
+		mux.GET(api.Inheritance, s.inheritanceHandler)
+		mux.POST(api.Inheritance, s.inheritanceHandlerPOST)
+		mux.DELETE(api.Inheritance, s.inheritanceHandlerDELETE)
+		mux.POST(api.InheritanceHeartbeat, s.inheritanceheartbeatHandlerPOST)
+		mux.GET(api.Payments, s.paymentsHandler)
+		mux.POST(api.PubKeys, s.pubkeysHandlerPOST)
+		mux.GET(api.PushDevices, s.pushdevicesHandler)
+		mux.POST(api.PushDevices, s.pushdevicesHandlerPOST)
+		mux.DELETE(api.PushDevicesToken, s.pushdevicestokenHandlerDELETE)
+		mux.GET(api.Reconcile, s.reconcileHandler)
+		mux.GET(api.ReportsCostBasis, s.reportscostbasisHandler)
+		mux.GET(api.ReportsHost, s.reportshostHandler)
+		mux.GET(api.ReportsRenter, s.reportsrenterHandler)
+		if s.statementKey != nil {
+			mux.GET(api.ReportsStatement, s.reportsstatementHandler)
+			mux.GET(api.ReportsStatementKey, s.reportsstatementkeyHandler)
+		}
+		mux.GET(api.Siafunds, s.siafundsHandler)
+		mux.GET(api.SiafundsClaims, s.siafundsclaimsHandler)
+		mux.GET(api.SiafundsUTXOs, s.siafundsutxosHandler)
+		mux.GET(api.TransactionsTxIDAnnotation, s.transactionsidannotationHandler)
+		mux.GET(api.Splits, s.splitsHandler)
+		mux.PUT(api.SplitsName, s.splitsnameHandlerPUT)
+		mux.DELETE(api.SplitsName, s.splitsnameHandlerDELETE)
+		mux.GET(api.SplitsNameDraft, s.splitsnamedraftHandler)
+		mux.GET(api.StatsConfirmations, s.statsconfirmationsHandler)
+		mux.GET(api.Templates, s.templatesHandler)
+		mux.GET(api.TemplatesName, s.templatesnameHandler)
+		mux.PUT(api.TemplatesName, s.templatesnameHandlerPUT)
+		mux.DELETE(api.TemplatesName, s.templatesnameHandlerDELETE)
+		mux.POST(api.TemplatesNameBuild, s.templatesnamebuildHandlerPOST)
+		mux.GET(api.UTXOsIDMetadata, s.utxosidmetadataHandler)
+		mux.PUT(api.UTXOsIDMetadata, s.utxosidmetadataHandlerPUT)
+		mux.GET(api.Vault, s.vaultHandler)
+		mux.DELETE(api.VaultWithdrawalsID, s.vaultwithdrawalsidHandlerDELETE)
+	}
+
+	s.registerCustomRoutes(mux)
+	// in hot mode, block rewards are consolidated automatically
+	if s.t != nil && s.t.consolidation != nil && s.seed != nil {
+		events, unsubscribe := s.t.SubscribeStream()
+		go s.watchConsolidation(events, unsubscribe)
+	}
+	// unauthenticated requests do not count against the quota
+	s.api = s.countRequests(mux)
+
+	// health checks are exempt from authentication and the quota, so that
+	// load balancers and orchestrators need not be given credentials
+	probes := httprouter.New()
+	probes.GET(api.Health, s.healthHandler)
+	probes.GET(api.Ready, s.readyHandler)
+	probes.NotFound = s.authenticate(s.api)
+	return probes
 }
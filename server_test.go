@@ -1,20 +1,46 @@
 package walrus
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image/png"
 	"io/ioutil"
+	"math"
+	"math/big"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/julienschmidt/httprouter"
 	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/encoding"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/types"
 	"lukechampine.com/frand"
+	"lukechampine.com/us/renter/proto"
 	"lukechampine.com/us/wallet"
+	"rsc.io/qr"
 )
 
 type stubTpool struct{}
@@ -24,12 +50,37 @@ func (stubTpool) FeeEstimation() (min, max types.Currency)               { retur
 func (stubTpool) TransactionSet(id crypto.Hash) (ts []types.Transaction) { return }
 
 type mockCS struct {
-	subscriber modules.ConsensusSetSubscriber
-	height     types.BlockHeight
+	subscribers []modules.ConsensusSetSubscriber
+	height      types.BlockHeight
+	blocks      []types.Block
+	target      types.Target // defaults to types.RootTarget
 }
 
+func (m *mockCS) BlockAtHeight(height types.BlockHeight) (types.Block, bool) {
+	if height == 0 {
+		return types.GenesisBlock, true
+	} else if height > m.height {
+		return types.Block{}, false
+	}
+	return m.blocks[height-1], true
+}
+
+func (m *mockCS) CurrentBlock() types.Block {
+	b, _ := m.BlockAtHeight(m.height)
+	return b
+}
+
+func (m *mockCS) ChildTarget(types.BlockID) (types.Target, bool) {
+	if m.target == (types.Target{}) {
+		return types.RootTarget, true
+	}
+	return m.target, true
+}
+
+func (m *mockCS) Height() types.BlockHeight { return m.height }
+
 func (m *mockCS) ConsensusSetSubscribe(s modules.ConsensusSetSubscriber, ccid modules.ConsensusChangeID, cancel <-chan struct{}) error {
-	m.subscriber = s
+	m.subscribers = append(m.subscribers, s)
 	return nil
 }
 
@@ -42,14 +93,51 @@ func (m *mockCS) sendTxn(txn types.Transaction) {
 			ID:            txn.SiacoinOutputID(uint64(i)),
 		}
 	}
+	b := types.Block{
+		Timestamp:    types.CurrentTimestamp(),
+		Transactions: []types.Transaction{txn},
+	}
 	cc := modules.ConsensusChange{
-		AppliedBlocks: []types.Block{{
-			Transactions: []types.Transaction{txn},
-		}},
+		AppliedBlocks:      []types.Block{b},
 		SiacoinOutputDiffs: outputs,
 	}
 	frand.Read(cc.ID[:])
-	m.subscriber.ProcessConsensusChange(cc)
+	for _, s := range m.subscribers {
+		s.ProcessConsensusChange(cc)
+	}
+	m.blocks = append(m.blocks, b)
+	m.height++
+}
+
+// sendReward mines a block that pays value to addr. Unlike a real block
+// reward, the payout matures immediately.
+func (m *mockCS) sendReward(addr types.UnlockHash, value types.Currency) {
+	b := types.Block{
+		Timestamp:    types.CurrentTimestamp(),
+		MinerPayouts: []types.SiacoinOutput{{Value: value, UnlockHash: addr}},
+	}
+	frand.Read(b.Nonce[:])
+	id := b.MinerPayoutID(0)
+	cc := modules.ConsensusChange{
+		AppliedBlocks: []types.Block{b},
+		SiacoinOutputDiffs: []modules.SiacoinOutputDiff{{
+			Direction:     modules.DiffApply,
+			SiacoinOutput: b.MinerPayouts[0],
+			ID:            id,
+		}},
+		DelayedSiacoinOutputDiffs: []modules.DelayedSiacoinOutputDiff{{
+			Direction:      modules.DiffApply,
+			SiacoinOutput:  b.MinerPayouts[0],
+			ID:             id,
+			MaturityHeight: m.height + 1,
+		}},
+		Synced: true,
+	}
+	frand.Read(cc.ID[:])
+	for _, s := range m.subscribers {
+		s.ProcessConsensusChange(cc)
+	}
+	m.blocks = append(m.blocks, b)
 	m.height++
 }
 
@@ -109,7 +197,7 @@ func TestServer(t *testing.T) {
 	w := wallet.New(store)
 	cs := new(mockCS)
 	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
-	client, stop := runServer(NewServer(w, stubTpool{}))
+	client, stop := runServer(NewServer(w, cs, stubTpool{}))
 	defer stop()
 
 	// initial balance should be zero
@@ -225,8 +313,10 @@ func TestServer(t *testing.T) {
 	}
 	if err := txn.StandaloneValid(types.ASICHardforkHeight + 1); err != nil {
 		t.Fatal(err)
-	} else if err := client.Broadcast([]types.Transaction{txn}); err != nil {
+	} else if receipt, err := client.Broadcast([]types.Transaction{txn}); err != nil {
 		t.Fatal(err)
+	} else if len(receipt.Transactions) != 1 || receipt.Transactions[0].ID != txn.ID() || receipt.Transactions[0].Result != BroadcastAccepted {
+		t.Fatal("wrong broadcast receipt:", receipt)
 	}
 
 	// with limbo transactions applied, we should only have one UTXO (the change
@@ -263,12 +353,111 @@ func TestServer(t *testing.T) {
 	}
 }
 
+func TestLimboFilters(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	srv := httptest.NewServer(NewServer(w, new(mockCS), stubTpool{}))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	w.AddAddress(info)
+	addr := info.UnlockConditions.UnlockHash()
+	dest := types.UnlockHash{1}
+	// a payment of 5 SC to dest, with change, and a 1 SC payment to another
+	// address
+	pay := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{ParentID: types.SiacoinOutputID{1}, UnlockConditions: info.UnlockConditions}},
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Value: types.SiacoinPrecision.Mul64(5), UnlockHash: dest},
+			{Value: types.SiacoinPrecision.Mul64(2), UnlockHash: addr},
+		},
+	}
+	other := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: types.UnlockHash{2}}},
+	}
+	w.AddToLimbo(pay)
+	w.AddToLimbo(other)
+
+	for _, test := range []struct {
+		f   LimboFilter
+		exp []types.Transaction
+	}{
+		{LimboFilter{}, []types.Transaction{pay, other}},
+		{LimboFilter{Addresses: []types.UnlockHash{dest}}, []types.Transaction{pay}},
+		// spending from an address also matches
+		{LimboFilter{Addresses: []types.UnlockHash{addr}}, []types.Transaction{pay}},
+		{LimboFilter{Addresses: []types.UnlockHash{dest}, MinValue: types.SiacoinPrecision.Mul64(5)}, []types.Transaction{pay}},
+		{LimboFilter{Addresses: []types.UnlockHash{dest}, MinValue: types.SiacoinPrecision.Mul64(5).Add(types.NewCurrency64(1))}, nil},
+		// without addresses, the total output value is compared
+		{LimboFilter{MinValue: types.SiacoinPrecision.Mul64(7)}, []types.Transaction{pay}},
+		{LimboFilter{Addresses: []types.UnlockHash{{3}}}, nil},
+		{LimboFilter{MinAge: time.Hour}, nil},
+	} {
+		limbo, err := c.FilterLimbo(test.f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make(map[types.TransactionID]bool)
+		for _, txn := range limbo {
+			ids[txn.ID()] = true
+		}
+		if len(ids) != len(test.exp) {
+			t.Errorf("filter %+v: expected %v transactions, got %v", test.f, len(test.exp), len(limbo))
+			continue
+		}
+		for _, txn := range test.exp {
+			if !ids[txn.ID()] {
+				t.Errorf("filter %+v: missing transaction %v", test.f, txn.ID())
+			}
+		}
+	}
+	// transactions age as time passes
+	if limbo := filterLimbo(w.LimboTransactions(), LimboFilter{MinAge: time.Hour}, time.Now().Add(2*time.Hour)); len(limbo) != 2 {
+		t.Fatal("expected both transactions to be an hour old, got", len(limbo))
+	}
+
+	// invalid filters should be rejected
+	for _, q := range []string{
+		"addr=foo",
+		"minvalue=foo",
+		"minvalue=-1",
+		"minvalue=1.5",
+		"minage=foo",
+		"minage=1",
+	} {
+		resp, err := http.Get(srv.URL + "/limbo?" + q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%v: expected 400, got %v", q, resp.StatusCode)
+		}
+	}
+
+	// individual transactions can be fetched by ID
+	if txn, err := c.LimboTransaction(pay.ID()); err != nil {
+		t.Fatal(err)
+	} else if txn.ID() != pay.ID() || txn.LimboSince.IsZero() {
+		t.Fatal("wrong limbo transaction:", txn)
+	} else if _, err := c.LimboTransaction(types.TransactionID{1}); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected transaction not in limbo to be rejected with 404, got", err)
+	}
+	if resp, err := http.Get(srv.URL + "/limbo/foo"); err != nil {
+		t.Fatal(err)
+	} else if resp.Body.Close(); resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("expected invalid ID to be rejected with 400, got", resp.StatusCode)
+	}
+}
+
 func TestServerThreadSafety(t *testing.T) {
 	store := wallet.NewEphemeralStore()
 	w := wallet.New(store)
 	cs := new(mockCS)
 	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
-	client, stop := runServer(NewServer(w, stubTpool{}))
+	client, stop := runServer(NewServer(w, cs, stubTpool{}))
 	defer stop()
 
 	randomAddr := func() (info wallet.SeedAddressInfo) {
@@ -308,3 +497,3232 @@ func TestServerThreadSafety(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestWriteJSONFields(t *testing.T) {
+	v := []map[string]interface{}{
+		{"id": "foo", "value": "1000000000000000000000000", "height": 9007199254740993},
+		{"id": "bar", "value": "2"},
+	}
+	rec := httptest.NewRecorder()
+	writeJSONFields(rec, v, "id,height")
+	var got []map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	} else if len(got) != 2 || len(got[0]) != 2 || len(got[1]) != 1 {
+		t.Fatalf("wrong fields: %s", rec.Body.Bytes())
+	} else if string(got[0]["height"]) != "9007199254740993" {
+		t.Error("large integer was not preserved:", string(got[0]["height"]))
+	}
+}
+
+func TestRequestDepositJSON(t *testing.T) {
+	// the embedded SeedAddressInfo must not hide the deposit's own fields
+	rd := RequestDeposit{
+		SeedAddressInfo: wallet.SeedAddressInfo{
+			UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(3)),
+			KeyIndex:         3,
+		},
+		Reference:     "foo",
+		Confirmations: 2,
+		Amount:        types.SiacoinPrecision,
+		Callback:      "https://example.com",
+	}
+	js, err := json.Marshal(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got RequestDeposit
+	if err := json.Unmarshal(js, &got); err != nil {
+		t.Fatal(err)
+	} else if got.UnlockHash() != rd.UnlockHash() || got.KeyIndex != 3 || got.Reference != "foo" ||
+		got.Confirmations != 2 || !got.Amount.Equals(rd.Amount) || got.Callback != rd.Callback {
+		t.Fatalf("request changed after round-trip: %s", js)
+	}
+}
+
+func TestRequestQuota(t *testing.T) {
+	s := &server{quota: Quota{RequestsPerMinute: 2}}
+	h := s.countRequests(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	for i, want := range []int{200, 200, 429} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Code != want {
+			t.Fatalf("request %v: expected %v, got %v", i, want, rec.Code)
+		}
+	}
+	if total, window := s.requests.counts(); total != 2 || window != 2 {
+		t.Fatal("wrong counts:", total, window)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	var mu sync.Mutex
+	log := []Event{{Seq: 1}, {Seq: 2}, {Seq: 4}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var events []Event
+		if req.FormValue("after") != "" {
+			after, _ := strconv.ParseUint(req.FormValue("after"), 10, 64)
+			for _, e := range log {
+				if e.Seq > after {
+					events = append(events, e)
+				}
+			}
+		} else if len(log) > 0 {
+			events = log[len(log)-1:]
+		}
+		writeJSON(w, events)
+	}))
+	defer srv.Close()
+	watcher := NewWatcher(NewClient(srv.URL), 0, time.Millisecond)
+
+	// event 3 is missing
+	events, err := watcher.Next(context.Background())
+	if gap, ok := err.(*GapError); !ok || gap.From != 3 || gap.To != 3 {
+		t.Fatal("expected gap error, got", err)
+	} else if len(events) != 2 || events[1].Seq != 2 || watcher.Cursor() != 3 {
+		t.Fatal("wrong events before gap:", events, watcher.Cursor())
+	}
+	events, err = watcher.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	} else if len(events) != 1 || events[0].Seq != 4 {
+		t.Fatal("wrong events after gap:", events)
+	}
+
+	// simulate a server reset
+	mu.Lock()
+	log = nil
+	mu.Unlock()
+	if _, err := watcher.Next(context.Background()); err != ErrEventsReset {
+		t.Fatal("expected ErrEventsReset, got", err)
+	}
+}
+
+func TestReplica(t *testing.T) {
+	var hits int
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		hits++
+		writeJSON(w, hits)
+	}))
+	defer primary.Close()
+	r := NewReplica(primary.URL, time.Hour)
+
+	get := func(method string) (int, string) {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, "/balance", nil))
+		return rec.Code, strings.TrimSpace(rec.Body.String())
+	}
+	// second request should be served from the cache
+	for i := 0; i < 2; i++ {
+		if code, body := get("GET"); code != 200 || body != "1" {
+			t.Fatal("unexpected response:", code, body)
+		}
+	}
+	if code, _ := get("POST"); code != http.StatusMethodNotAllowed {
+		t.Fatal("replica accepted a POST:", code)
+	}
+}
+
+func TestFileLease(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lease")
+	a := NewFileLease(path, "a", time.Minute)
+	b := NewFileLease(path, "b", time.Minute)
+	if err := a.tryAcquire(); err != nil {
+		t.Fatal(err)
+	} else if err := b.tryAcquire(); err != nil {
+		t.Fatal(err)
+	}
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatal("expected a to be the only leader")
+	} else if a.Holder() != "a" {
+		t.Fatal("wrong holder:", a.Holder())
+	}
+
+	// once a's lease expires, b should take over
+	a.ttl = -time.Minute
+	if err := a.tryAcquire(); err != nil {
+		t.Fatal(err)
+	} else if err := b.tryAcquire(); err != nil {
+		t.Fatal(err)
+	}
+	if !b.IsLeader() || b.Holder() != "b" {
+		t.Fatal("expected b to be the leader")
+	}
+}
+
+func TestVerifyWallet(t *testing.T) {
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), modules.ConsensusChangeBeginning, nil)
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	addr := info.UnlockConditions.UnlockHash()
+	w.AddAddress(info)
+
+	cs.sendTxn(types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: addr}},
+	})
+	if r := VerifyWallet(w, cs, 0); len(r.Discrepancies) != 0 {
+		t.Fatal("unexpected discrepancies:", r.Discrepancies)
+	}
+
+	// add a block without notifying the wallet; the transaction must differ
+	// from the first, or the wallet would already know its ID
+	missed := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision.Mul64(2), UnlockHash: addr}},
+	}
+	cs.blocks = append(cs.blocks, types.Block{Transactions: []types.Transaction{missed}})
+	cs.height++
+	r := VerifyWallet(w, cs, 1)
+	if r.StartHeight != cs.height || len(r.Discrepancies) != 2 {
+		t.Fatal("wrong report:", r)
+	}
+	for _, d := range r.Discrepancies {
+		switch d.Type {
+		case DiscrepancyMissingTransaction:
+			if d.ID != crypto.Hash(missed.ID()) {
+				t.Error("wrong missing transaction:", d.ID)
+			}
+		case DiscrepancyMissingOutput:
+			if d.ID != crypto.Hash(missed.SiacoinOutputID(0)) {
+				t.Error("wrong missing output:", d.ID)
+			}
+		default:
+			t.Error("unexpected discrepancy:", d.Type)
+		}
+	}
+}
+
+func TestJobs(t *testing.T) {
+	var js jobSet
+	await := func(id string) Job {
+		for i := 0; i < 100; i++ {
+			if job, _ := js.get(id); job.Status != JobRunning {
+				return job
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("job did not finish")
+		return Job{}
+	}
+
+	done := js.start("test", func(ctx context.Context, jp *jobProgress) (interface{}, error) {
+		jp.update(0, 5, 10, 1)
+		return 7, nil
+	})
+	if job := await(done.ID); job.Status != JobDone || string(job.Result) != "7" || job.ItemsFound != 1 {
+		t.Fatalf("wrong job state: %+v", job)
+	}
+
+	cancelled := js.start("test", func(ctx context.Context, jp *jobProgress) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if !js.cancel(cancelled.ID) {
+		t.Fatal("job not found")
+	} else if job := await(cancelled.ID); job.Status != JobCancelled {
+		t.Fatal("wrong status:", job.Status)
+	}
+	if jobs := js.list(); len(jobs) != 2 || jobs[0].ID != done.ID {
+		t.Fatal("wrong job list")
+	}
+}
+
+func TestCustomRoutes(t *testing.T) {
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	h := NewServer(w, cs, stubTpool{}, WithRoute("GET", "/custom/height/:mul", func(rc RouteContext, w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		mul, _ := strconv.Atoi(ps.ByName("mul"))
+		writeJSON(w, int(rc.ConsensusSet.Height()+1)*mul)
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/custom/height/3", nil))
+	if rec.Code != 200 || strings.TrimSpace(rec.Body.String()) != "3" {
+		t.Fatal("unexpected response:", rec.Code, rec.Body.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for route outside custom prefix")
+		}
+	}()
+	WithRoute("GET", "/balance", nil)
+}
+
+func TestClientContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.WithContext(ctx).Balance(false)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected error from cancelled request")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not cancelled")
+	}
+	if client.ctx != nil {
+		t.Fatal("WithContext modified the original client")
+	}
+}
+
+func TestClientStats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/transactions/") {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, types.ZeroCurrency)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+	client.EnableStats()
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.Balance(false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := client.Transaction(types.TransactionID{1}); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := client.WithContext(context.Background()).Transaction(types.TransactionID{2}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	stats := client.Stats()
+	if stats.Global.Requests != 5 || stats.Global.Errors != 2 {
+		t.Fatalf("wrong global stats: %+v", stats.Global)
+	} else if es := stats.Endpoints["GET /balance"]; es.Requests != 3 || es.Errors != 0 || es.P50 == 0 {
+		t.Fatalf("wrong balance stats: %+v", es)
+	} else if es := stats.Endpoints["GET /transactions/:id"]; es.Requests != 2 || es.Errors != 2 {
+		t.Fatalf("wrong transaction stats: %+v", stats.Endpoints)
+	}
+
+	var buf bytes.Buffer
+	if err := stats.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(buf.String(), `walrus_client_requests_total{endpoint="GET /balance"} 3`) {
+		t.Fatal("missing request counter in Prometheus output:", buf.String())
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/slow" {
+			<-req.Context().Done()
+			return
+		}
+		writeJSON(w, types.ZeroCurrency)
+	}))
+	defer srv.Close()
+
+	// the test server's certificate is self-signed
+	if _, err := NewClient(srv.URL).Balance(false); err == nil {
+		t.Fatal("expected certificate error")
+	}
+	tlsConfig := srv.Client().Transport.(*http.Transport).TLSClientConfig
+	client := NewClient(srv.URL, WithTLSConfig(tlsConfig), WithTimeout(50*time.Millisecond))
+	if _, err := client.Balance(false); err != nil {
+		t.Fatal(err)
+	} else if err := client.get("/slow", nil); err == nil {
+		t.Fatal("expected timeout")
+	}
+	if http.DefaultClient.Timeout != 0 || http.DefaultTransport.(*http.Transport).TLSClientConfig == tlsConfig {
+		t.Fatal("options modified the default client")
+	}
+
+	// a custom client should be used as-is
+	hc := srv.Client()
+	client = NewClient(srv.URL, WithHTTPClient(hc), WithStats())
+	if _, err := client.Balance(false); err != nil {
+		t.Fatal(err)
+	} else if client.hc != hc {
+		t.Fatal("custom client not used")
+	} else if client.Stats().Global.Requests != 1 {
+		t.Fatal("stats not enabled")
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/limited":
+			http.Error(w, "Request quota exceeded", http.StatusTooManyRequests)
+		case strings.HasSuffix(req.URL.Path, "/annotation"):
+			http.Error(w, "No annotation for that transaction", http.StatusNotFound)
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+
+	err := client.get("/addresses/abcd", nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatal("expected *APIError, got", err)
+	} else if apiErr.StatusCode != http.StatusNotFound || apiErr.Method != "GET" || apiErr.Route != "/addresses/abcd" || apiErr.Message != "Not found" {
+		t.Fatalf("wrong error fields: %+v", apiErr)
+	} else if !errors.Is(err, ErrAddressNotFound) || !errors.Is(err, ErrNotFound) || errors.Is(err, ErrTransactionNotRelevant) {
+		t.Fatal("address error matched wrong sentinels")
+	}
+
+	for _, route := range []string{"/transactions/abcd?fields=inflow", "/transactions/abcd/raw"} {
+		if err := client.get(route, nil); !errors.Is(err, ErrTransactionNotRelevant) || errors.Is(err, ErrAddressNotFound) {
+			t.Fatal("transaction error matched wrong sentinels:", route)
+		}
+	}
+	if err := client.get("/transactions/abcd/annotation", nil); errors.Is(err, ErrTransactionNotRelevant) {
+		t.Fatal("annotation error should not match ErrTransactionNotRelevant")
+	}
+	if err := client.get("/limited", nil); !errors.Is(err, ErrRateLimited) || errors.Is(err, ErrNotFound) {
+		t.Fatal("rate limit error matched wrong sentinels")
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.Method == "GET" && requests%3 != 0 {
+			http.Error(w, "Server is a standby", http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, types.ZeroCurrency)
+	}))
+	defer srv.Close()
+
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+		Jitter:         0.5,
+		RetryOn:        []int{http.StatusServiceUnavailable},
+	}
+	client := NewClient(srv.URL, WithRetryPolicy(policy))
+	if _, err := client.Balance(false); err != nil {
+		t.Fatal(err)
+	} else if requests != 3 {
+		t.Fatal("expected 3 requests, got", requests)
+	}
+
+	// non-GET requests should not be retried
+	requests = 0
+	if err := client.post("/broadcast", nil, nil); err != nil {
+		t.Fatal(err)
+	} else if requests != 1 {
+		t.Fatal("expected 1 request, got", requests)
+	}
+
+	// retries can be disabled
+	requests = 0
+	client = NewClient(srv.URL, WithRetryPolicy(RetryPolicy{}))
+	if _, err := client.Balance(false); !errors.Is(err, ErrStandby) {
+		t.Fatal("expected ErrStandby, got", err)
+	} else if requests != 1 {
+		t.Fatal("expected 1 request, got", requests)
+	}
+
+	// backoff should grow exponentially up to the maximum
+	policy.Jitter = 0
+	if policy.backoff(1) != time.Millisecond || policy.backoff(3) != 4*time.Millisecond || policy.backoff(10) != policy.MaxBackoff {
+		t.Fatal("wrong backoff")
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	s := &server{creds: Credentials{
+		APIKeys:  []string{"foo", "bar"},
+		Username: "user",
+		Password: "pass",
+	}}
+	srv := httptest.NewServer(s.authenticate(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, types.ZeroCurrency)
+	})))
+	defer srv.Close()
+
+	tests := []struct {
+		opt ClientOption
+		ok  bool
+	}{
+		{func(*Client) {}, false},
+		{WithAPIKey("bar"), true},
+		{WithAPIKey("baz"), false},
+		{WithBasicAuth("user", "pass"), true},
+		{WithBasicAuth("user", "bar"), false},
+	}
+	for i, test := range tests {
+		_, err := NewClient(srv.URL, test.opt).Balance(false)
+		if test.ok && err != nil {
+			t.Errorf("%v: unexpected error: %v", i, err)
+		} else if !test.ok && !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("%v: expected ErrUnauthorized, got %v", i, err)
+		}
+	}
+
+	// without credentials, no authentication should be required
+	rec := httptest.NewRecorder()
+	(&server{}).authenticate(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatal("expected 404, got", rec.Code)
+	}
+}
+
+// writeTestCert writes a certificate and key for the specified name, signed by
+// parent (or self-signed, if parent is nil), to dir as name.crt and name.key.
+func writeTestCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0600); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestSign(t *testing.T) {
+	seed := wallet.NewSeed()
+	w := wallet.New(wallet.NewEphemeralStore())
+	owned := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0)),
+		KeyIndex:         0,
+	}
+	// an address in the wallet that was derived from a different seed
+	other := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(1)),
+		KeyIndex:         1,
+	}
+	foreign := wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0))
+	w.AddAddress(owned)
+	w.AddAddress(other)
+
+	// without credentials, /sign is not served
+	cs := new(mockCS)
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}, WithSigningSeed(seed)))
+	defer srv.Close()
+	if err := NewClient(srv.URL).SignTransaction(&types.Transaction{}, nil); err == nil {
+		t.Fatal("expected /sign to be unavailable without credentials")
+	}
+
+	creds := Credentials{APIKeys: []string{"foo"}}
+	srv2 := httptest.NewServer(NewServer(w, cs, stubTpool{}, WithSigningSeed(seed), WithCredentials(creds)))
+	defer srv2.Close()
+	c := NewClient(srv2.URL, WithAPIKey("foo"))
+
+	txn := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{
+			{ParentID: types.SiacoinOutputID{1}, UnlockConditions: owned.UnlockConditions},
+			{ParentID: types.SiacoinOutputID{2}, UnlockConditions: foreign},
+		},
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision}},
+	}
+	signed := txn
+	if err := c.SignTransaction(&signed, nil); err != nil {
+		t.Fatal(err)
+	} else if len(signed.TransactionSignatures) != 1 || signed.TransactionSignatures[0].ParentID != crypto.Hash(txn.SiacoinInputs[0].ParentID) {
+		t.Fatal("expected only the wallet's input to be signed:", signed.TransactionSignatures)
+	}
+
+	signed = txn
+	if err := c.SignTransaction(&signed, []crypto.Hash{crypto.Hash(txn.SiacoinInputs[1].ParentID)}); err == nil {
+		t.Fatal("expected signing a foreign input to fail")
+	}
+	signed = txn
+	signed.SiacoinInputs = append(signed.SiacoinInputs, types.SiacoinInput{ParentID: types.SiacoinOutputID{3}, UnlockConditions: other.UnlockConditions})
+	if err := c.SignTransaction(&signed, []crypto.Hash{crypto.Hash(signed.SiacoinInputs[2].ParentID)}); err == nil {
+		t.Fatal("expected signing an input from another seed to fail")
+	}
+	signed = txn
+	if err := c.SignTransaction(&signed, []crypto.Hash{{4}}); err == nil {
+		t.Fatal("expected signing a nonexistent input to fail")
+	}
+
+	// a signing policy should be enforced by the server
+	allowed := types.UnlockHash{1}
+	srv3 := httptest.NewServer(NewServer(w, cs, stubTpool{}, WithSigningSeed(seed), WithCredentials(creds), WithSigningPolicy(SigningPolicy{
+		Allowlist: []types.UnlockHash{allowed},
+		MaxPerDay: types.SiacoinPrecision.Mul64(3),
+	})))
+	defer srv3.Close()
+	c = NewClient(srv3.URL, WithAPIKey("foo"))
+	signed = txn
+	if err := c.SignTransaction(&signed, nil); err == nil || !strings.Contains(err.Error(), "allowlist") {
+		t.Fatal("expected destination outside the allowlist to be rejected, got", err)
+	} else if len(signed.TransactionSignatures) != 0 {
+		t.Fatal("rejected transaction should not be signed")
+	}
+	txn.SiacoinOutputs = []types.SiacoinOutput{
+		{Value: types.SiacoinPrecision.Mul64(2), UnlockHash: allowed},
+		// change is not counted against the limits
+		{Value: types.SiacoinPrecision.Mul64(10), UnlockHash: owned.UnlockConditions.UnlockHash()},
+	}
+	signed = txn
+	if err := c.SignTransaction(&signed, nil); err != nil {
+		t.Fatal(err)
+	} else if len(signed.TransactionSignatures) != 1 {
+		t.Fatal("expected transaction to be signed")
+	}
+	// sending to an address from another seed is not change
+	txn.SiacoinOutputs[1].UnlockHash = other.UnlockConditions.UnlockHash()
+	signed = txn
+	if err := c.SignTransaction(&signed, nil); err == nil || !strings.Contains(err.Error(), "allowlist") {
+		t.Fatal("expected foreign-seed destination to be checked against the allowlist, got", err)
+	}
+	txn.SiacoinOutputs = txn.SiacoinOutputs[:1]
+	signed = txn
+	if err := c.SignTransaction(&signed, nil); err == nil || !strings.Contains(err.Error(), "daily limit") {
+		t.Fatal("expected daily limit to be enforced, got", err)
+	}
+}
+
+func TestSigningBundle(t *testing.T) {
+	seed := wallet.NewSeed()
+	uc := wallet.StandardUnlockConditions(seed.PublicKey(3))
+	b := SigningBundle{
+		Version: SigningBundleVersion,
+		Transaction: types.Transaction{
+			SiacoinInputs: []types.SiacoinInput{{ParentID: types.SiacoinOutputID{1}, UnlockConditions: uc}},
+			SiacoinOutputs: []types.SiacoinOutput{{
+				Value:      types.SiacoinPrecision.Mul64(9),
+				UnlockHash: types.UnlockHash{1},
+			}},
+			MinerFees: []types.Currency{types.SiacoinPrecision},
+		},
+		Inputs: []BundleInput{{
+			ParentID:         types.SiacoinOutputID{1},
+			Value:            types.SiacoinPrecision.Mul64(10),
+			UnlockConditions: uc,
+			KeyIndex:         3,
+		}},
+	}
+	if err := b.Validate(); err != nil {
+		t.Fatal(err)
+	} else if !b.Fee().Equals(types.SiacoinPrecision) {
+		t.Fatal("wrong fee:", b.Fee())
+	}
+
+	// tampering with the bundle should be detected
+	bad := b
+	bad.Inputs = []BundleInput{b.Inputs[0]}
+	bad.Inputs[0].Value = types.SiacoinPrecision.Mul64(11)
+	if err := bad.Validate(); err == nil {
+		t.Fatal("expected mismatched value to be rejected")
+	}
+	bad.Inputs[0] = b.Inputs[0]
+	bad.Inputs[0].ParentID = types.SiacoinOutputID{2}
+	if err := bad.Validate(); err == nil {
+		t.Fatal("expected mismatched parent ID to be rejected")
+	}
+	bad.Version = SigningBundleVersion + 1
+	if err := bad.Validate(); err == nil {
+		t.Fatal("expected unknown version to be rejected")
+	}
+
+	// the key index must match the seed
+	bad = b
+	bad.Inputs = []BundleInput{b.Inputs[0]}
+	bad.Inputs[0].KeyIndex = 4
+	if err := SignBundle(&bad, seed); err == nil {
+		t.Fatal("expected wrong key index to be rejected")
+	} else if err := SignBundle(&b, wallet.NewSeed()); err == nil {
+		t.Fatal("expected wrong seed to be rejected")
+	}
+
+	if err := SignBundle(&b, seed); err != nil {
+		t.Fatal(err)
+	} else if len(b.Transaction.TransactionSignatures) != 1 {
+		t.Fatal("expected one signature, got", len(b.Transaction.TransactionSignatures))
+	} else if err := SignBundle(&b, seed); err == nil {
+		t.Fatal("expected signed bundle to be rejected")
+	}
+	if set := b.TransactionSet(); len(set) != 1 || set[0].ID() != b.Transaction.ID() {
+		t.Fatal("wrong transaction set")
+	}
+	if sr := b.SigningRequest(); len(sr.ToSign) != 1 || sr.KeyIndices[0] != 3 {
+		t.Fatal("wrong signing request:", sr)
+	}
+}
+
+func TestOutputLocks(t *testing.T) {
+	// expired locks should be ignored
+	var ls outputLockSet
+	if _, err := ls.lock("a", []types.SiacoinOutputID{{1}}, -time.Second); err != nil {
+		t.Fatal(err)
+	} else if h := ls.holder(types.SiacoinOutputID{1}); h != "" {
+		t.Fatal("expected expired lock to be ignored, got", h)
+	}
+
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	w.AddAddress(info)
+	addr := info.UnlockConditions.UnlockHash()
+	// the outputs must differ, or both transactions would have the same ID
+	for i := 0; i < 2; i++ {
+		cs.sendTxn(types.Transaction{
+			SiacoinOutputs: []types.SiacoinOutput{{
+				Value:      types.SiacoinPrecision.Mul64(uint64(10 + i)),
+				UnlockHash: addr,
+			}},
+		})
+	}
+	utxos := w.UnspentOutputs(true)
+	if len(utxos) != 2 {
+		t.Fatal("expected 2 outputs, got", len(utxos))
+	}
+	locked, free := utxos[0].ID, utxos[1].ID
+
+	if _, err := client.LockUTXOs("a", []types.SiacoinOutputID{locked}, "5m"); err != nil {
+		t.Fatal(err)
+	} else if _, err := client.LockUTXOs("b", []types.SiacoinOutputID{locked, free}, ""); err == nil {
+		t.Fatal("expected locking an output held by another lock to fail")
+	} else if _, err := client.LockUTXOs("b", []types.SiacoinOutputID{{9}}, ""); err == nil {
+		t.Fatal("expected locking an unknown output to fail")
+	} else if _, err := client.LockUTXOs("a", []types.SiacoinOutputID{locked}, "48h"); err == nil {
+		t.Fatal("expected excessive duration to be rejected")
+	}
+	resp, err := client.UnspentOutputs(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range resp {
+		if (o.ID == locked) != (o.LockID == "a") {
+			t.Fatalf("wrong lock ID %q for output %v", o.LockID, o.ID)
+		}
+	}
+
+	rc := RequestConstruct{
+		Outputs:       []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: types.UnlockHash{1}}},
+		ChangeAddress: addr,
+	}
+	inputs := func(resp ResponseConstruct) (ids []types.SiacoinOutputID) {
+		for _, sci := range resp.Transaction.SiacoinInputs {
+			ids = append(ids, sci.ParentID)
+		}
+		return
+	}
+	// without a lock ID, /construct should skip the locked output
+	cr, err := client.ConstructTransaction(rc)
+	if err != nil {
+		t.Fatal(err)
+	} else if ids := inputs(cr); len(ids) != 1 || ids[0] != free {
+		t.Fatal("expected the unlocked output to be spent, got", ids)
+	}
+	// locking the inputs of a constructed transaction
+	rc.LockID, rc.LockDuration = "b", "1m"
+	if cr, err = client.ConstructTransaction(rc); err != nil {
+		t.Fatal(err)
+	} else if ids := inputs(cr); len(ids) != 1 || ids[0] != free {
+		t.Fatal("expected the unlocked output to be spent, got", ids)
+	}
+	rc.LockID, rc.LockDuration = "", ""
+	if _, err := client.ConstructTransaction(rc); err == nil {
+		t.Fatal("expected every output to be locked")
+	}
+	rc.LockID = "a"
+	if cr, err = client.ConstructTransaction(rc); err != nil {
+		t.Fatal(err)
+	} else if ids := inputs(cr); len(ids) != 1 || ids[0] != locked {
+		t.Fatal("expected the output held by the lock to be spent, got", ids)
+	}
+	rc.LockID, rc.LockDuration = "", "1m"
+	if _, err := client.ConstructTransaction(rc); err == nil {
+		t.Fatal("expected lock duration without lock ID to be rejected")
+	}
+
+	// releasing
+	if err := client.ReleaseUTXOs("a", []types.SiacoinOutputID{free}); err != nil {
+		t.Fatal(err)
+	} else if _, err := client.LockUTXOs("a", []types.SiacoinOutputID{free}, ""); err == nil {
+		t.Fatal("releasing should not affect outputs held by other locks")
+	} else if err := client.ReleaseUTXOs("b", nil); err != nil {
+		t.Fatal(err)
+	} else if _, err := client.LockUTXOs("a", []types.SiacoinOutputID{free}, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	ca, caKey := writeTestCert(t, dir, "ca", nil, nil)
+	writeTestCert(t, dir, "server", ca, caKey)
+	writeTestCert(t, dir, "client", ca, caKey)
+	writeTestCert(t, dir, "rogue", nil, nil)
+
+	serverCfg, err := LoadServerTLSConfig(path("ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, err := tls.LoadX509KeyPair(path("server.crt"), path("server.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCfg.Certificates = []tls.Certificate{serverCert}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, types.ZeroCurrency)
+	}))
+	srv.TLS = serverCfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	tests := []struct {
+		cert, key string
+		ok        bool
+	}{
+		{"client.crt", "client.key", true},
+		{"", "", false},
+		{"rogue.crt", "rogue.key", false},
+	}
+	for _, test := range tests {
+		var certFile, keyFile string
+		if test.cert != "" {
+			certFile, keyFile = path(test.cert), path(test.key)
+		}
+		cfg, err := LoadClientTLSConfig(certFile, keyFile, path("ca.crt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := NewClient(srv.URL, WithTLSConfig(cfg), WithRetryPolicy(RetryPolicy{}))
+		if _, err := client.Balance(false); (err == nil) != test.ok {
+			t.Errorf("%q: expected ok=%v, got %v", test.cert, test.ok, err)
+		}
+	}
+
+	if _, err := LoadClientTLSConfig(path("client.crt"), "", ""); err == nil {
+		t.Fatal("expected error for missing key")
+	} else if _, err := LoadServerTLSConfig(path("client.key")); err == nil {
+		t.Fatal("expected error for bundle without certificates")
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := "unix://" + filepath.Join(dir, "walrus.sock")
+
+	// a stale socket should be replaced
+	for i := 0; i < 2; i++ {
+		l, err := Listen(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			writeJSON(w, types.SiacoinPrecision)
+		})}
+		go srv.Serve(l)
+		client := NewClient(addr, WithTimeout(time.Second))
+		if bal, err := client.Balance(false); err != nil {
+			t.Fatal(err)
+		} else if !bal.Equals(types.SiacoinPrecision) {
+			t.Fatal("wrong balance:", bal)
+		}
+		srv.Close()
+		if i == 0 {
+			// simulate an unclean shutdown by leaving the socket file behind
+			l, _ := net.Listen("unix", strings.TrimPrefix(addr, "unix://"))
+			if ul, ok := l.(*net.UnixListener); ok {
+				ul.SetUnlinkOnClose(false)
+				ul.Close()
+			}
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	defer func(p RetryPolicy) { streamBackoff = p }(streamBackoff)
+	streamBackoff = RetryPolicy{InitialBackoff: 10 * time.Millisecond}
+
+	tracker := new(Tracker)
+	s := &server{t: tracker}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.eventsHandler(w, req, nil)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 10)
+	events := NewClient(srv.URL).SubscribeEvents(ctx, func(err error) { errs <- err })
+	waitForSubscriber := func() {
+		for start := time.Now(); !tracker.stream.hasSubscribers(); time.Sleep(time.Millisecond) {
+			if time.Since(start) > 5*time.Second {
+				t.Fatal("client did not subscribe")
+			}
+		}
+	}
+	expectLimbo := func(txn types.Transaction) {
+		tracker.notifyLimbo([]types.Transaction{txn})
+		select {
+		case e := <-events:
+			var la LimboAdded
+			if e.Type != StreamLimboAdded {
+				t.Fatal("wrong event type:", e.Type)
+			} else if err := json.Unmarshal(e.Data, &la); err != nil {
+				t.Fatal(err)
+			} else if la.TransactionID != txn.ID() {
+				t.Fatal("wrong transaction ID")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event received")
+		}
+	}
+	waitForSubscriber()
+	expectLimbo(types.Transaction{ArbitraryData: [][]byte{{1}}})
+
+	// disconnect the client; it should reconnect
+	tracker.stream.mu.Lock()
+	for ch := range tracker.stream.subs {
+		delete(tracker.stream.subs, ch)
+		close(ch)
+	}
+	tracker.stream.mu.Unlock()
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("disconnect was not reported")
+	}
+	waitForSubscriber()
+	expectLimbo(types.Transaction{ArbitraryData: [][]byte{{2}}})
+
+	// canceling the context should close the channel
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("expected channel to be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel was not closed")
+	}
+
+	// plain requests should not be upgraded
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	if resp, err := http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	} else if resp.Body.Close(); resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("expected handshake without a key to be rejected, got", resp.Status)
+	}
+
+	// cross-origin handshakes are rejected unless the origin is allowed
+	s.origins = []string{"https://dashboard.example.com"}
+	handshake := func(origin string) int {
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for origin, code := range map[string]int{
+		"https://evil.example.com":      http.StatusForbidden,
+		"https://dashboard.example.com": http.StatusSwitchingProtocols,
+		srv.URL:                         http.StatusSwitchingProtocols,
+		"":                              http.StatusSwitchingProtocols,
+	} {
+		if got := handshake(origin); got != code {
+			t.Errorf("expected %v for origin %q, got %v", code, origin, got)
+		}
+	}
+
+	// servers must reject unmasked frames
+	var buf bytes.Buffer
+	writeFrame(&buf, wsOpText, []byte("hi"), false)
+	if _, _, err := readFrame(bytes.NewReader(buf.Bytes()), true); err == nil {
+		t.Fatal("expected unmasked frame to be rejected")
+	} else if _, payload, err := readFrame(&buf, false); err != nil || string(payload) != "hi" {
+		t.Fatal("unmasked frame should be accepted by clients:", err)
+	}
+	writeFrame(&buf, wsOpText, []byte("hi"), true)
+	if _, payload, err := readFrame(&buf, true); err != nil || string(payload) != "hi" {
+		t.Fatal("masked frame should be accepted by servers:", err)
+	}
+}
+
+func TestEventStreamSSE(t *testing.T) {
+	defer func(p RetryPolicy) { streamBackoff = p }(streamBackoff)
+	streamBackoff = RetryPolicy{InitialBackoff: 10 * time.Millisecond}
+
+	tracker := new(Tracker)
+	s := &server{t: tracker}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.eventssseHandler(w, req, nil)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 10)
+	events := NewClient(srv.URL).SubscribeEventsSSE(ctx, func(err error) { errs <- err })
+	waitForSubscriber := func() {
+		for start := time.Now(); !tracker.stream.hasSubscribers(); time.Sleep(time.Millisecond) {
+			if time.Since(start) > 5*time.Second {
+				t.Fatal("client did not subscribe")
+			}
+		}
+	}
+	expectReorg := func(height types.BlockHeight) {
+		tracker.stream.publish([]StreamEvent{newStreamEvent(StreamReorg, Reorg{Height: height})})
+		select {
+		case e := <-events:
+			var r Reorg
+			if e.Type != StreamReorg {
+				t.Fatal("wrong event type:", e.Type)
+			} else if err := json.Unmarshal(e.Data, &r); err != nil {
+				t.Fatal(err)
+			} else if r.Height != height {
+				t.Fatal("wrong height")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event received")
+		}
+	}
+	waitForSubscriber()
+	expectReorg(1)
+
+	// disconnect the client; it should reconnect
+	tracker.stream.mu.Lock()
+	for ch := range tracker.stream.subs {
+		delete(tracker.stream.subs, ch)
+		close(ch)
+	}
+	tracker.stream.mu.Unlock()
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("disconnect was not reported")
+	}
+	waitForSubscriber()
+	expectReorg(2)
+
+	// canceling the context should close the channel and unsubscribe
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("expected channel to be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel was not closed")
+	}
+	for start := time.Now(); tracker.stream.hasSubscribers(); time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("server did not unsubscribe")
+		}
+	}
+}
+
+func TestConsensusWait(t *testing.T) {
+	defer func(d time.Duration) { consensusWaitInterval = d }(consensusWaitInterval)
+	consensusWaitInterval = time.Millisecond
+
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+
+	info, err := client.ConsensusInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// if the timeout elapses, the unchanged info should be returned
+	var timedOut ResponseConsensus
+	if err := client.get("/consensus?wait="+info.CCID.String()+"&timeout=10ms", &timedOut); err != nil {
+		t.Fatal(err)
+	} else if timedOut.CCID != info.CCID {
+		t.Fatal("consensus change ID should not have changed")
+	}
+	if err := client.get("/consensus?wait="+info.CCID.String()+"&timeout=1h", nil); err == nil {
+		t.Fatal("expected excessive timeout to be rejected")
+	}
+
+	done := make(chan ResponseConsensus, 1)
+	go func() {
+		info, err := client.WaitForBlock(info.CCID)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- info
+	}()
+	select {
+	case <-done:
+		t.Fatal("WaitForBlock returned before a block was processed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	cs.sendTxn(types.Transaction{})
+	select {
+	case newInfo := <-done:
+		// the wallet counts the mock's first block as the genesis block, at
+		// height 0
+		if newInfo.CCID == info.CCID || newInfo.Height != cs.Height()-1 {
+			t.Fatal("WaitForBlock returned stale info:", newInfo)
+		}
+		info = newInfo
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitForBlock did not return")
+	}
+
+	// waiting should be cancellable
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.WithContext(ctx).WaitForBlock(info.CCID); err == nil {
+		t.Fatal("expected error from cancelled wait")
+	}
+}
+
+func TestPagination(t *testing.T) {
+	ids := make([]crypto.Hash, 5)
+	for i := range ids {
+		ids[i] = crypto.Hash{byte(i + 1)}
+	}
+	id := func(i int) crypto.Hash { return ids[i] }
+	for _, test := range []struct {
+		p          page
+		start, end int
+		ok         bool
+	}{
+		{page{limit: -1}, 0, 5, true},
+		{page{limit: 2}, 0, 2, true},
+		{page{limit: 2, cursor: ids[1], hasCursor: true}, 2, 4, true},
+		{page{limit: 2, cursor: ids[3], hasCursor: true}, 4, 5, true},
+		{page{limit: 2, cursor: ids[4], hasCursor: true}, 5, 5, true},
+		{page{limit: -1, cursor: ids[0], hasCursor: true}, 1, 5, true},
+		{page{limit: 2, cursor: crypto.Hash{9}, hasCursor: true}, 0, 0, false},
+	} {
+		start, end, ok := test.p.bounds(len(ids), id)
+		if start != test.start || end != test.end || ok != test.ok {
+			t.Errorf("%+v: expected (%v, %v, %v), got (%v, %v, %v)", test.p, test.start, test.end, test.ok, start, end, ok)
+		}
+	}
+
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	w.AddAddress(info)
+	for i := 0; i < 5; i++ {
+		cs.sendTxn(types.Transaction{
+			SiacoinOutputs: []types.SiacoinOutput{{
+				Value:      types.SiacoinPrecision.Mul64(uint64(i + 1)),
+				UnlockHash: info.UnlockConditions.UnlockHash(),
+			}},
+		})
+	}
+
+	all, err := client.Transactions(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paged []types.TransactionID
+	var before types.TransactionID
+	for {
+		txids, next, err := client.TransactionsPage(before, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paged = append(paged, txids...)
+		if next == (types.TransactionID{}) {
+			break
+		}
+		before = next
+	}
+	if !reflect.DeepEqual(paged, all) {
+		t.Fatal("paged transactions do not match full listing")
+	}
+
+	var outputs []ResponseUnspentOutput
+	var after types.SiacoinOutputID
+	for {
+		utxos, next, err := client.UnspentOutputsPage(false, after, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, utxos...)
+		if next == (types.SiacoinOutputID{}) {
+			break
+		}
+		after = next
+	}
+	if len(outputs) != len(w.UnspentOutputs(false)) {
+		t.Fatalf("expected %v outputs, got %v", len(w.UnspentOutputs(false)), len(outputs))
+	}
+
+	if err := client.get("/transactions?before="+crypto.Hash{9}.String(), nil); err == nil {
+		t.Fatal("expected unknown cursor to be rejected")
+	}
+}
+
+func TestMaxPageSize(t *testing.T) {
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}, WithMaxPageSize(3)))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	w.AddAddress(info)
+	for i := 0; i < 5; i++ {
+		cs.sendTxn(types.Transaction{
+			SiacoinOutputs: []types.SiacoinOutput{{
+				Value:      types.SiacoinPrecision.Mul64(uint64(i + 1)),
+				UnlockHash: info.UnlockConditions.UnlockHash(),
+			}},
+		})
+	}
+
+	for _, test := range []struct {
+		route string
+		code  int
+	}{
+		{"/transactions?max=3", 0},
+		{"/transactions?limit=2", 0},
+		{"/transactions?max=4", http.StatusBadRequest},
+		{"/transactions?limit=4", http.StatusBadRequest},
+		{"/transactions?max=-1", http.StatusRequestEntityTooLarge},
+		{"/utxos?limit=3", 0},
+		{"/utxos?limit=4", http.StatusBadRequest},
+		{"/utxos", http.StatusRequestEntityTooLarge},
+	} {
+		err := client.get(test.route, nil)
+		if test.code == 0 {
+			if err != nil {
+				t.Errorf("%v: unexpected error: %v", test.route, err)
+			}
+		} else if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != test.code {
+			t.Errorf("%v: expected %v, got %v", test.route, test.code, err)
+		}
+	}
+
+	// the client requests unbounded listings in pages
+	srv2 := httptest.NewServer(NewServer(w, cs, stubTpool{}))
+	defer srv2.Close()
+	if txids, err := NewClient(srv2.URL).Transactions(-1); err != nil {
+		t.Fatal(err)
+	} else if len(txids) != 5 {
+		t.Fatalf("expected 5 transactions, got %v", len(txids))
+	}
+}
+
+func TestBatch(t *testing.T) {
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	srv := httptest.NewServer(NewServer(w, new(mockCS), stubTpool{}))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+
+	addr := types.UnlockHash{1}
+	w.AddAddress(wallet.SeedAddressInfo{
+		UnlockConditions: types.UnlockConditions{},
+		KeyIndex:         3,
+	})
+	var fee types.Currency
+	var index uint64
+	var addrs []types.UnlockHash
+	var info wallet.SeedAddressInfo
+	err := client.Batch().
+		RecommendedFee(&fee).
+		SeedIndex(&index).
+		Get("/addresses", &addrs).
+		Get("/addresses/"+addr.String(), &info).
+		Do()
+	if !errors.Is(err, ErrAddressNotFound) {
+		t.Fatalf("expected ErrAddressNotFound, got %v", err)
+	} else if len(addrs) != 1 {
+		t.Fatalf("expected 1 address, got %v", len(addrs))
+	}
+
+	// batches cannot be nested, and are limited in size
+	var resps []ResponseBatchItem
+	if err := client.post("/batch", []RequestBatchItem{{Method: "POST", Route: "/batch"}}, &resps); err != nil {
+		t.Fatal(err)
+	} else if len(resps) != 1 || resps[0].Status != http.StatusBadRequest {
+		t.Fatalf("expected nested batch to be rejected, got %+v", resps)
+	}
+	if err := client.post("/batch", make([]RequestBatchItem, maxBatchRequests+1), nil); err == nil {
+		t.Fatal("expected oversized batch to be rejected")
+	}
+}
+
+type failingFeeEstimator struct{}
+
+func (failingFeeEstimator) EstimateFee() (min, max types.Currency, err error) {
+	return types.Currency{}, types.Currency{}, errors.New("unavailable")
+}
+
+func TestHealth(t *testing.T) {
+	cs := new(mockCS)
+	w := wallet.New(wallet.NewEphemeralStore())
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}, WithCredentials(Credentials{APIKeys: []string{"foo"}})))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	// health checks should not require credentials
+	if _, err := c.Balance(false); !errors.Is(err, ErrUnauthorized) {
+		t.Fatal("expected ErrUnauthorized, got", err)
+	}
+	resp, err := http.Get(srv.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("expected 200, got", resp.StatusCode)
+	}
+
+	// the genesis block is far older than the max lag
+	ready, err := c.Health()
+	if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatal("expected 503, got", err)
+	} else if ready.Ready || len(ready.Errors) == 0 || ready.BlocksBehind <= DefaultMaxBlocksBehind {
+		t.Fatal("expected server not to be ready:", ready)
+	}
+
+	// once a recent block arrives, the server should be ready, even though
+	// the wallet has not processed it
+	cs.blocks = append(cs.blocks, types.Block{Timestamp: types.CurrentTimestamp()})
+	cs.height++
+	ready, err = c.Health()
+	if err != nil {
+		t.Fatal(err)
+	} else if !ready.Ready || ready.BlocksBehind != 1 || !ready.DBWritable {
+		t.Fatal("expected server to be ready:", ready)
+	}
+}
+
+type stubGateway struct{ peers int }
+
+func (g *stubGateway) Peers() []modules.Peer { return make([]modules.Peer, g.peers) }
+
+func TestSyncWatchdog(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+	cs := &mockCS{
+		height: 1,
+		blocks: []types.Block{{Timestamp: types.CurrentTimestamp()}},
+	}
+	g := &stubGateway{peers: 8}
+	sw := NewSyncWatchdog(cs, g, tracker, time.Hour)
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}, WithTracker(tracker), WithSyncWatchdog(sw)))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	lastEvent := func() string {
+		events := tracker.Events(1)
+		if len(events) == 0 {
+			return ""
+		}
+		return events[0].Type
+	}
+
+	start := time.Now()
+	sw.check(start.Add(30 * time.Minute))
+	if ready, err := c.Health(); err != nil || ready.SyncStalled {
+		t.Fatal("expected server to be ready:", ready, err)
+	} else if lastEvent() != "" {
+		t.Fatal("expected no events, got", lastEvent())
+	}
+
+	// the height hasn't advanced for longer than the timeout
+	sw.check(start.Add(90 * time.Minute))
+	if ready, _ := c.Health(); ready.Ready || !ready.SyncStalled || len(ready.Errors) != 1 {
+		t.Fatal("expected sync to be stalled:", ready)
+	} else if lastEvent() != EventSyncStalled {
+		t.Fatal("expected a stall event, got", lastEvent())
+	}
+	// the stall should only be reported once
+	sw.check(start.Add(100 * time.Minute))
+	if events := tracker.Events(-1); len(events) != 1 {
+		t.Fatal("expected one event, got", len(events))
+	}
+
+	cs.blocks = append(cs.blocks, types.Block{Timestamp: types.CurrentTimestamp()})
+	cs.height++
+	sw.check(start.Add(110 * time.Minute))
+	if ready, err := c.Health(); err != nil || ready.SyncStalled {
+		t.Fatal("expected server to be ready:", ready, err)
+	} else if lastEvent() != EventSyncResumed {
+		t.Fatal("expected a resume event, got", lastEvent())
+	}
+
+	// losing every peer is a stall, but only if it lasts
+	g.peers = 0
+	sw.check(start.Add(112 * time.Minute))
+	if sw.Status().Reason != "" {
+		t.Fatal("brief loss of peers should not be a stall")
+	}
+	sw.check(start.Add(120 * time.Minute))
+	if ss := sw.Status(); !strings.Contains(ss.Reason, "no peers") || ss.Peers != 0 {
+		t.Fatal("expected a stall due to lack of peers:", ss)
+	} else if lastEvent() != EventSyncStalled {
+		t.Fatal("expected a stall event, got", lastEvent())
+	}
+}
+
+func TestOwnershipProof(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	_, otherPriv, _ := ed25519.GenerateKey(nil)
+	var cpk crypto.PublicKey
+	copy(cpk[:], pub)
+	uc := types.UnlockConditions{
+		PublicKeys:         []types.SiaPublicKey{types.Ed25519PublicKey(cpk)},
+		SignaturesRequired: 1,
+	}
+	proof := OwnershipProof{
+		Address:          uc.UnlockHash(),
+		UnlockConditions: uc,
+		Message:          "challenge",
+	}
+	if err := VerifyOwnershipProof(proof); err == nil {
+		t.Fatal("expected unsigned proof to be invalid")
+	} else if err := proof.Sign(otherPriv); err == nil {
+		t.Fatal("expected error when signing with unrelated key")
+	} else if err := proof.Sign(priv); err != nil {
+		t.Fatal(err)
+	} else if err := VerifyOwnershipProof(proof); err != nil {
+		t.Fatal(err)
+	}
+
+	// verify via the server
+	cs := new(mockCS)
+	w := wallet.New(wallet.NewEphemeralStore())
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+	if err := c.VerifyOwnership(proof); err != nil {
+		t.Fatal(err)
+	}
+
+	// altering the message should invalidate the proof
+	tampered := proof
+	tampered.Message = "other challenge"
+	if err := VerifyOwnershipProof(tampered); err == nil {
+		t.Fatal("expected tampered proof to be invalid")
+	} else if err := c.VerifyOwnership(tampered); err == nil {
+		t.Fatal("expected server to reject tampered proof")
+	}
+
+	// duplicate signatures should not count twice
+	uc.PublicKeys = append(uc.PublicKeys, types.Ed25519PublicKey(crypto.PublicKey{1}))
+	uc.SignaturesRequired = 2
+	multi := OwnershipProof{UnlockConditions: uc, Message: "challenge"}
+	multi.Address = uc.UnlockHash()
+	multi.Sign(priv)
+	multi.Sign(priv)
+	if err := VerifyOwnershipProof(multi); err == nil {
+		t.Fatal("expected proof with duplicate signatures to be invalid")
+	}
+}
+
+func TestReserves(t *testing.T) {
+	// three addresses, so that the Merkle tree has an unpaired node
+	seed := wallet.NewSeed()
+	balances := make(map[types.UnlockHash]types.Currency)
+	ucs := make(map[types.UnlockHash]types.UnlockConditions)
+	indices := make(map[types.UnlockHash]uint64)
+	for i := uint64(0); i < 3; i++ {
+		uc := wallet.StandardUnlockConditions(seed.PublicKey(i))
+		addr := uc.UnlockHash()
+		balances[addr] = types.SiacoinPrecision.Mul64(i + 1)
+		ucs[addr] = uc
+		indices[addr] = i
+	}
+	a := newReservesAttestation(100, types.BlockID{1}, "challenge", balances, func(addr types.UnlockHash) (types.UnlockConditions, uint64) {
+		return ucs[addr], indices[addr]
+	})
+	if len(a.Entries) != 3 || !a.Total.Equals(types.SiacoinPrecision.Mul64(6)) {
+		t.Fatal("attestation has wrong entries or total:", a.Entries, a.Total)
+	} else if err := VerifyReserves(a); err == nil {
+		t.Fatal("expected unsigned attestation to be invalid")
+	}
+	if err := a.Sign(SeedSigningKey(seed)); err != nil {
+		t.Fatal(err)
+	} else if err := VerifyReserves(a); err != nil {
+		t.Fatal(err)
+	}
+
+	// attestation should survive a JSON round-trip
+	js, _ := json.Marshal(a)
+	var decoded ReservesAttestation
+	if err := json.Unmarshal(js, &decoded); err != nil {
+		t.Fatal(err)
+	} else if err := VerifyReserves(decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	// altering a balance, the challenge, or the order of entries should
+	// invalidate the attestation
+	tampered := decoded
+	tampered.Entries = append([]ReservesEntry(nil), decoded.Entries...)
+	tampered.Entries[1].Balance = tampered.Entries[1].Balance.Add(types.SiacoinPrecision)
+	tampered.Total = tampered.Total.Add(types.SiacoinPrecision)
+	if err := VerifyReserves(tampered); err == nil {
+		t.Fatal("expected attestation with altered balance to be invalid")
+	}
+	tampered = decoded
+	tampered.Message = "other challenge"
+	if err := VerifyReserves(tampered); err == nil {
+		t.Fatal("expected attestation with altered message to be invalid")
+	}
+	tampered = decoded
+	tampered.Entries = []ReservesEntry{decoded.Entries[1], decoded.Entries[0], decoded.Entries[2]}
+	if err := VerifyReserves(tampered); err == nil {
+		t.Fatal("expected attestation with unsorted entries to be invalid")
+	}
+
+	// the server should reject requests without a challenge
+	cs := new(mockCS)
+	w := wallet.New(wallet.NewEphemeralStore())
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}))
+	defer srv.Close()
+	if _, err := NewClient(srv.URL).Reserves(""); err == nil {
+		t.Fatal("expected error for missing challenge")
+	}
+}
+
+func TestVersion(t *testing.T) {
+	cs := new(mockCS)
+	w := wallet.New(wallet.NewEphemeralStore())
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}, WithNetwork("zen")))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, WithCompatibilityCheck())
+	v, err := c.ServerVersion()
+	if err != nil {
+		t.Fatal(err)
+	} else if v.Version != Version || v.APIRevision != APIRevision || v.Network != "zen" || len(v.Features) != 0 {
+		t.Fatal("wrong version info:", v)
+	}
+
+	// a server without /version should be considered too old
+	var requests int
+	old := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.URL.Path == "/version" {
+			http.NotFound(w, req)
+			return
+		}
+		writeJSON(w, types.ZeroCurrency)
+	}))
+	defer old.Close()
+	if _, err := NewClient(old.URL).Balance(false); err != nil {
+		t.Fatal(err)
+	}
+	requests = 0
+	c = NewClient(old.URL, WithCompatibilityCheck())
+	for i := 0; i < 3; i++ {
+		if _, err := c.Balance(false); !errors.Is(err, ErrIncompatibleServer) {
+			t.Fatal("expected ErrIncompatibleServer, got", err)
+		}
+	}
+	if requests != 1 {
+		t.Fatalf("expected 1 request, got %v", requests)
+	}
+}
+
+func TestWalletID(t *testing.T) {
+	seed := wallet.NewSeed()
+	cs := new(mockCS)
+	w := wallet.New(wallet.NewEphemeralStore())
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}))
+	defer srv.Close()
+
+	// without an address at index 0, the ID is unknown
+	c := NewClient(srv.URL, WithWalletID(SeedWalletID(seed)))
+	if _, err := NewClient(srv.URL).WalletID(); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected ErrNotFound, got", err)
+	} else if _, err := c.Balance(false); err == nil || errors.Is(err, ErrWrongWallet) {
+		t.Fatal("expected unknown wallet ID to fail the check, got", err)
+	}
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0)),
+		KeyIndex:         0,
+	}
+	w.AddAddress(info)
+	if resp, err := NewClient(srv.URL).WalletID(); err != nil {
+		t.Fatal(err)
+	} else if resp.ID != SeedWalletID(seed) || resp.Address != info.UnlockConditions.UnlockHash() {
+		t.Fatal("wrong wallet ID:", resp)
+	}
+	// the failed check should not have been cached
+	if _, err := c.Balance(false); err != nil {
+		t.Fatal(err)
+	}
+
+	// a server with a key source derives the ID from the seed
+	srv2 := httptest.NewServer(NewServer(wallet.New(wallet.NewEphemeralStore()), cs, stubTpool{}, WithKeySource(NewSeedKeySource(seed))))
+	defer srv2.Close()
+	if _, err := NewClient(srv2.URL, WithWalletID(SeedWalletID(seed))).Balance(false); err != nil {
+		t.Fatal(err)
+	}
+	other := NewClient(srv2.URL, WithWalletID(SeedWalletID(wallet.NewSeed())))
+	for i := 0; i < 2; i++ {
+		if _, err := other.Balance(false); !errors.Is(err, ErrWrongWallet) {
+			t.Fatal("expected ErrWrongWallet, got", err)
+		}
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	cs := new(mockCS)
+	cs.target = types.RootTarget.MulDifficulty(big.NewRat(1200000, 1))
+	difficulty := cs.target.Difficulty()
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	// mine blocks at the specified interval, starting a week ago
+	mine := func(n int, interval types.Timestamp) {
+		cs.blocks, cs.height = nil, 0
+		start := types.CurrentTimestamp() - 7*24*60*60
+		for i := 1; i <= n; i++ {
+			cs.blocks = append(cs.blocks, types.Block{Timestamp: start + types.Timestamp(i)*interval})
+			cs.height++
+		}
+	}
+	windows := func(info ResponseNetwork) (blocks []types.BlockHeight) {
+		for _, bt := range info.BlockTimes {
+			blocks = append(blocks, bt.Blocks)
+		}
+		return
+	}
+
+	// at low heights, the longer windows are omitted, and the hashrate falls
+	// back to the expected block frequency
+	mine(10, 100)
+	info, err := c.NetworkInfo()
+	if err != nil {
+		t.Fatal(err)
+	} else if info.Height != 10 || info.Target != crypto.Hash(cs.target) {
+		t.Fatal("wrong height or target:", info.Height, info.Target)
+	} else if !info.Difficulty.Equals(difficulty) {
+		t.Fatal("wrong difficulty:", info.Difficulty)
+	} else if !reflect.DeepEqual(windows(info), []types.BlockHeight{6}) || info.BlockTimes[0].Average != 100 {
+		t.Fatal("wrong block times:", info.BlockTimes)
+	} else if !info.Hashrate.Equals(difficulty.Div64(uint64(types.BlockFrequency))) {
+		t.Fatal("expected hashrate to use the expected block frequency, got", info.Hashrate)
+	}
+
+	// once a day of blocks is available, the daily average determines the
+	// hashrate
+	mine(200, 150)
+	if info, err := c.NetworkInfo(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(windows(info), []types.BlockHeight{6, 144}) || info.BlockTimes[1].Average != 150 {
+		t.Fatal("wrong block times:", info.BlockTimes)
+	} else if !info.Hashrate.Equals(difficulty.Div64(150)) {
+		t.Fatal("expected hashrate to use the daily average, got", info.Hashrate)
+	}
+	mine(1100, 500)
+	if info, err := c.NetworkInfo(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(windows(info), []types.BlockHeight{6, 144, 1008}) || info.BlockTimes[2].Average != 500 {
+		t.Fatal("wrong block times:", info.BlockTimes)
+	}
+
+	// a window whose first block is newer than the tip is omitted
+	mine(10, 100)
+	cs.blocks[3].Timestamp = cs.blocks[9].Timestamp + 1
+	if info, err := c.NetworkInfo(); err != nil {
+		t.Fatal(err)
+	} else if len(info.BlockTimes) != 0 {
+		t.Fatal("expected no block times, got", info.BlockTimes)
+	}
+
+	// a daily average below one second also falls back to the expected block
+	// frequency
+	mine(200, 0)
+	if info, err := c.NetworkInfo(); err != nil {
+		t.Fatal(err)
+	} else if len(info.BlockTimes) != 2 || info.BlockTimes[1].Average != 0 {
+		t.Fatal("wrong block times:", info.BlockTimes)
+	} else if !info.Hashrate.Equals(difficulty.Div64(uint64(types.BlockFrequency))) {
+		t.Fatal("expected hashrate to use the expected block frequency, got", info.Hashrate)
+	}
+}
+
+func TestFeeEstimators(t *testing.T) {
+	static := func(min, max uint64) FeeEstimator {
+		return StaticFeeEstimator{types.NewCurrency64(min), types.NewCurrency64(max)}
+	}
+	for _, test := range []struct {
+		fe             BlendedFeeEstimator
+		expMin, expMax uint64
+		expErr         bool
+	}{
+		{BlendedFeeEstimator{}, 0, 0, true},
+		{BlendedFeeEstimator{Sources: []FeeEstimator{failingFeeEstimator{}}}, 0, 0, true},
+		{BlendedFeeEstimator{Sources: []FeeEstimator{static(10, 20)}}, 10, 20, false},
+		{BlendedFeeEstimator{Sources: []FeeEstimator{static(10, 20), failingFeeEstimator{}, static(30, 40)}}, 20, 30, false},
+		{BlendedFeeEstimator{Sources: []FeeEstimator{static(10, 20), static(1000, 2000), static(30, 40)}}, 30, 40, false},
+		{BlendedFeeEstimator{Sources: []FeeEstimator{static(10, 20)}, Floor: types.NewCurrency64(15)}, 15, 20, false},
+		{BlendedFeeEstimator{Sources: []FeeEstimator{static(10, 2000)}, Ceiling: types.NewCurrency64(100)}, 10, 100, false},
+	} {
+		min, max, err := test.fe.EstimateFee()
+		if (err != nil) != test.expErr {
+			t.Errorf("expected error %v, got %v", test.expErr, err)
+		} else if err == nil && (min.Cmp64(test.expMin) != 0 || max.Cmp64(test.expMax) != 0) {
+			t.Errorf("expected (%v, %v), got (%v, %v)", test.expMin, test.expMax, min, max)
+		}
+	}
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"minimum":"100","maximum":"200"}`))
+	}))
+	defer api.Close()
+	if min, max, err := NewExplorerFeeEstimator(api.URL).EstimateFee(); err != nil {
+		t.Fatal(err)
+	} else if min.Cmp64(100) != 0 || max.Cmp64(200) != 0 {
+		t.Fatalf("expected (100, 200), got (%v, %v)", min, max)
+	}
+
+	// the server should use the estimator, falling back to the tpool
+	srv := httptest.NewServer(NewServer(wallet.New(wallet.NewEphemeralStore()), new(mockCS), stubTpool{}, WithFeeEstimator(static(50, 60))))
+	defer srv.Close()
+	if fee, err := NewClient(srv.URL).RecommendedFee(); err != nil {
+		t.Fatal(err)
+	} else if fee.Cmp64(50) != 0 {
+		t.Fatalf("expected fee of 50, got %v", fee)
+	}
+}
+
+func TestContractFilter(t *testing.T) {
+	renter := types.Ed25519PublicKey(crypto.PublicKey{1})
+	host := types.Ed25519PublicKey(crypto.PublicKey{2})
+	uc := types.UnlockConditions{PublicKeys: []types.SiaPublicKey{renter, host}, SignaturesRequired: 2}
+	payout := types.UnlockHash{3}
+	fc := wallet.FileContract{ID: types.FileContractID{4}}
+	fc.MissedProofOutputs = []types.SiacoinOutput{{UnlockHash: payout}}
+
+	for _, test := range []struct {
+		f   ContractFilter
+		uc  types.UnlockConditions
+		exp bool
+	}{
+		{ContractFilter{}, types.UnlockConditions{}, true},
+		{ContractFilter{HostKey: host}, uc, true},
+		{ContractFilter{HostKey: renter}, uc, false},
+		{ContractFilter{HostKey: host}, types.UnlockConditions{}, false},
+		{ContractFilter{PayoutAddress: payout}, types.UnlockConditions{}, true},
+		{ContractFilter{PayoutAddress: types.UnlockHash{5}}, uc, false},
+		{ContractFilter{HostKey: host, PayoutAddress: payout}, uc, true},
+	} {
+		if test.f.matches(fc, test.uc) != test.exp {
+			t.Errorf("%+v: expected %v", test.f, test.exp)
+		}
+	}
+
+	q := make(url.Values)
+	f := ContractFilter{HostKey: host, PayoutAddress: payout}
+	addContractFilter(q, f)
+	if parsed, err := parseContractFilter(q); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(parsed, f) {
+		t.Fatalf("filter did not survive round trip: expected %+v, got %+v", f, parsed)
+	}
+	if _, err := parseContractFilter(url.Values{"payout": {"foo"}}); err == nil {
+		t.Fatal("expected invalid payout address to be rejected")
+	} else if _, err := parseContractFilter(url.Values{"host": {"ed25519:abcd"}}); err == nil {
+		t.Fatal("expected invalid host key to be rejected")
+	}
+}
+
+func TestIterators(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeNDJSON(rec, []ResponseUnspentOutput{{IsChange: true}, {}}, "isChange")
+	if exp := "{\"isChange\":true}\n{\"isChange\":false}\n"; rec.Body.String() != exp {
+		t.Fatalf("expected %q, got %q", exp, rec.Body.String())
+	}
+
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	w.AddAddress(info)
+	for i := 0; i < 6; i++ {
+		cs.sendTxn(types.Transaction{
+			SiacoinOutputs: []types.SiacoinOutput{{
+				Value:      types.SiacoinPrecision.Mul64(uint64(i + 1)),
+				UnlockHash: info.UnlockConditions.UnlockHash(),
+			}},
+		})
+	}
+	allTxns, err := client.Transactions(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allOutputs, err := client.UnspentOutputs(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(n int) { iterPageSize = n }(iterPageSize)
+	// exercise both a short final page and an empty one
+	for _, iterPageSize = range []int{4, 3} {
+		var txids []types.TransactionID
+		ti := client.TransactionsIter()
+		for ti.Next() {
+			txids = append(txids, ti.ID())
+		}
+		if err := ti.Err(); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(txids, allTxns) {
+			t.Fatalf("page size %v: iterated transactions do not match full listing", iterPageSize)
+		}
+
+		var outputs []ResponseUnspentOutput
+		ui := client.UnspentOutputsIter(false)
+		for ui.Next() {
+			outputs = append(outputs, ui.Output())
+		}
+		if err := ui.Err(); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(outputs, allOutputs) {
+			t.Fatalf("page size %v: iterated outputs do not match full listing", iterPageSize)
+		}
+	}
+
+	// abandoning an iterator early should be safe
+	ti := client.TransactionsIter()
+	if !ti.Next() {
+		t.Fatal(ti.Err())
+	} else if err := ti.Close(); err != nil {
+		t.Fatal(err)
+	} else if ti.Next() {
+		t.Fatal("expected closed iterator to stop")
+	}
+}
+
+// hardforkAdapter is a ChainAdapter that validates transactions as if the chain
+// were past the ASIC hardfork, since signatures from the wallet are not valid
+// at the low heights reached by mockCS.
+type hardforkAdapter struct {
+	SiaAdapter
+}
+
+func (hardforkAdapter) ValidateTransaction(txn types.Transaction, _ types.BlockHeight) error {
+	return txn.StandaloneValid(types.ASICHardforkHeight + 1)
+}
+
+func TestChainAdapter(t *testing.T) {
+	// subscriptions require a consensus set that supports them
+	cs := new(mockCS)
+	sa := SiaAdapter{CS: cs, TP: stubTpool{}}
+	w := wallet.New(wallet.NewEphemeralStore())
+	store := wallet.NewEphemeralStore()
+	sub := w.ConsensusSetSubscriber(store)
+	if err := sa.Subscribe(sub, modules.ConsensusChangeBeginning); err != nil {
+		t.Fatal(err)
+	} else if len(cs.subscribers) != 1 || cs.subscribers[0] != sub {
+		t.Fatal("adapter did not subscribe to consensus set")
+	}
+	sa.CS = struct{ ConsensusSet }{cs}
+	if err := sa.Subscribe(sub, modules.ConsensusChangeBeginning); err == nil {
+		t.Fatal("expected subscription to fail")
+	}
+	if _, ok := sa.UnconfirmedTransaction(types.TransactionID{}); ok {
+		t.Fatal("expected transaction to be unknown")
+	}
+
+	// the server should use the adapter's network name
+	srv := httptest.NewServer(NewChainServer(w, SiaAdapter{CS: cs, TP: stubTpool{}, Name: "zen"}))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+	if v, err := c.ServerVersion(); err != nil {
+		t.Fatal(err)
+	} else if v.Network != "zen" {
+		t.Fatal("expected network zen, got", v.Network)
+	}
+}
+
+func TestDustThreshold(t *testing.T) {
+	// the dust flag should survive a round trip through the query string
+	q := make(url.Values)
+	addOutputFilter(q, OutputFilter{IncludeDust: true})
+	if f := parseOutputFilter(q); !f.IncludeDust {
+		t.Fatal("expected includeDust to be parsed")
+	} else if f := parseOutputFilter(make(url.Values)); f.IncludeDust {
+		t.Fatal("expected dust to be excluded by default")
+	}
+
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}, WithDustThreshold(types.SiacoinPrecision)))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	w.AddAddress(info)
+	addr := info.UnlockConditions.UnlockHash()
+	for _, v := range []types.Currency{types.SiacoinPrecision.Mul64(10), types.NewCurrency64(1), types.NewCurrency64(2)} {
+		cs.sendTxn(types.Transaction{
+			SiacoinOutputs: []types.SiacoinOutput{{Value: v, UnlockHash: addr}},
+		})
+	}
+
+	// dust should be hidden unless requested
+	if bal, err := client.Balance(false); err != nil {
+		t.Fatal(err)
+	} else if !bal.Equals(types.SiacoinPrecision.Mul64(10)) {
+		t.Fatal("expected dust to be excluded from balance, got", bal)
+	}
+	if bal, err := client.BalanceWithDust(false); err != nil {
+		t.Fatal(err)
+	} else if !bal.Equals(types.SiacoinPrecision.Mul64(10).Add(types.NewCurrency64(3))) {
+		t.Fatal("expected dust to be included in balance, got", bal)
+	}
+	if utxos, err := client.UnspentOutputs(false); err != nil {
+		t.Fatal(err)
+	} else if len(utxos) != 1 {
+		t.Fatalf("expected 1 output, got %v", len(utxos))
+	}
+	if utxos, err := client.FilterUnspentOutputs(false, OutputFilter{IncludeDust: true}); err != nil {
+		t.Fatal(err)
+	} else if len(utxos) != 3 {
+		t.Fatalf("expected 3 outputs, got %v", len(utxos))
+	}
+
+	// dust should never fund a transaction unless requested
+	rc := RequestConstruct{
+		Outputs:       []types.SiacoinOutput{{Value: types.SiacoinPrecision.Mul64(10), UnlockHash: addr}},
+		ChangeAddress: addr,
+		Fee:           "0",
+	}
+	if resp, err := client.ConstructTransaction(rc); err != nil {
+		t.Fatal(err)
+	} else if len(resp.Transaction.SiacoinInputs) != 1 {
+		t.Fatalf("expected 1 input, got %v", len(resp.Transaction.SiacoinInputs))
+	}
+	rc.Outputs[0].Value = rc.Outputs[0].Value.Add(types.NewCurrency64(1))
+	if _, err := client.ConstructTransaction(rc); err == nil {
+		t.Fatal("expected dust to be unavailable for funding")
+	}
+	rc.Inputs.IncludeDust = true
+	if _, err := client.ConstructTransaction(rc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPayouts(t *testing.T) {
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+
+	// invalid requests should be rejected before any coins are selected
+	seed := wallet.NewSeed()
+	addr := wallet.StandardUnlockConditions(seed.PublicKey(0)).UnlockHash()
+	for _, rp := range []RequestPayouts{
+		{},
+		{Payouts: []Payout{{Address: addr}}},
+		{Payouts: []Payout{{Address: addr, Amount: types.SiacoinPrecision}}, Strategy: "foo"},
+		{Payouts: []Payout{{Address: addr, Amount: types.SiacoinPrecision}}, Sign: true},
+	} {
+		if _, err := client.Payouts(rp); err == nil {
+			t.Errorf("expected %+v to be rejected", rp)
+		}
+	}
+
+	// payouts should be divided into chunks that fit, in order
+	payouts := make([]Payout, 5)
+	for i := range payouts {
+		payouts[i] = Payout{Address: addr, Amount: types.SiacoinPrecision.Add(types.NewCurrency64(uint64(i)))}
+	}
+	outputSize := len(encoding.Marshal(types.SiacoinOutput{Value: payouts[0].Amount, UnlockHash: addr}))
+	chunks := payoutChunks(payouts, 2*outputSize)
+	if len(chunks) != 3 || len(chunks[0]) != 2 || len(chunks[1]) != 2 || len(chunks[2]) != 1 {
+		t.Fatalf("expected chunks of 2, 2, and 1 payouts, got %v", chunks)
+	} else if !chunks[2][0].Amount.Equals(payouts[4].Amount) {
+		t.Fatal("chunks should preserve the order of payouts")
+	}
+
+	// fund the wallet and pay out
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0)),
+		KeyIndex:         0,
+	}
+	w.AddAddress(info)
+	cs.sendTxn(types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision.Mul64(100), UnlockHash: addr}},
+	})
+	dest := wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)).UnlockHash()
+	resp, err := client.Payouts(RequestPayouts{
+		Payouts: []Payout{
+			{Address: dest, Amount: types.SiacoinPrecision.Mul64(10)},
+			{Address: dest, Amount: types.SiacoinPrecision.Mul64(20)},
+		},
+		ChangeAddress: addr,
+		Fee:           "0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(resp.Bundles) != 1 || len(resp.Transactions) != 0 {
+		t.Fatalf("expected 1 unsigned bundle, got %v bundles and %v transactions", len(resp.Bundles), len(resp.Transactions))
+	} else if len(resp.Payouts) != 2 {
+		t.Fatalf("expected 2 payouts, got %v", len(resp.Payouts))
+	}
+	b := resp.Bundles[0]
+	if err := b.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range resp.Payouts {
+		if p.TransactionID != b.Transaction.ID() {
+			t.Fatal("payout reported the wrong transaction ID")
+		}
+	}
+	if err := SignBundle(&b, seed); err != nil {
+		t.Fatal(err)
+	}
+
+	// if a signed transaction can't be broadcast, the payouts made by earlier
+	// transactions should still be reported
+	creds := Credentials{APIKeys: []string{"foo"}}
+	tp := &limitTpool{n: 1}
+	srv2 := httptest.NewServer(NewServer(w, cs, tp, WithSigningSeed(seed), WithCredentials(creds)))
+	defer srv2.Close()
+	client = NewClient(srv2.URL, WithAPIKey("foo"))
+	cs.sendTxn(types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision.Mul64(1000), UnlockHash: addr}},
+	})
+	payouts = make([]Payout, 2*maxPayoutOutputSize/outputSize)
+	for i := range payouts {
+		payouts[i] = Payout{Address: dest, Amount: types.SiacoinPrecision}
+	}
+	resp, err = client.Payouts(RequestPayouts{
+		Payouts:       payouts,
+		ChangeAddress: addr,
+		Fee:           "0",
+		Sign:          true,
+	})
+	if err == nil {
+		t.Fatal("expected partial broadcast to be reported")
+	} else if len(resp.Transactions) != 1 || len(resp.Receipts) != 1 || len(tp.sets) != 1 {
+		t.Fatalf("expected 1 broadcast transaction, got %v", len(resp.Transactions))
+	} else if len(resp.Payouts) != len(payouts) {
+		t.Fatalf("expected %v payouts, got %v", len(payouts), len(resp.Payouts))
+	}
+	paid := resp.Transactions[0].ID()
+	if resp.Payouts[0].TransactionID != paid || resp.Payouts[len(payouts)-1].TransactionID != (types.TransactionID{}) {
+		t.Fatal("payouts reported the wrong transaction IDs")
+	} else if len(w.LimboTransactions()) == 0 {
+		t.Fatal("broadcast transaction should be in Limbo")
+	}
+}
+
+// limitTpool accepts the first n transaction sets it receives.
+type limitTpool struct {
+	stubTpool
+	n    int
+	sets [][]types.Transaction
+}
+
+func (tp *limitTpool) AcceptTransactionSet(txnSet []types.Transaction) error {
+	if len(tp.sets) == tp.n {
+		return errors.New("transaction pool is full")
+	}
+	tp.sets = append(tp.sets, txnSet)
+	return nil
+}
+
+func TestPublicKeys(t *testing.T) {
+	seed := wallet.NewSeed()
+	pk := seed.PublicKey(0)
+	if parsed, err := ParsePublicKey(pk.String()); err != nil {
+		t.Fatal(err)
+	} else if parsed.String() != pk.String() {
+		t.Fatal("public key changed after round-trip:", parsed)
+	}
+	for _, s := range []string{
+		"",
+		strings.TrimPrefix(pk.String(), "ed25519:"),
+		"ed25519:zz",
+		"ed25519:abcd",
+		"secp256k1:" + strings.TrimPrefix(pk.String(), "ed25519:"),
+	} {
+		if _, err := ParsePublicKey(s); err == nil {
+			t.Errorf("expected %q to be rejected", s)
+		}
+	}
+
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+	srv := httptest.NewServer(NewServer(w, new(mockCS), stubTpool{}, WithTracker(tracker)))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	if err := c.AddPublicKeys(5, []types.SiaPublicKey{seed.PublicKey(5), seed.PublicKey(6)}); err != nil {
+		t.Fatal(err)
+	} else if got, ok := tracker.PublicKey(6); !ok || got.String() != seed.PublicKey(6).String() {
+		t.Fatal("public key was not imported")
+	}
+	// malformed keys should be rejected with 400
+	js, _ := json.Marshal(RequestPublicKeys{PublicKeys: []string{"ed25519:abcd"}})
+	resp, err := http.Post(srv.URL+"/pubkeys", "application/json", bytes.NewReader(js))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("expected 400, got", resp.StatusCode)
+	}
+}
+
+func TestAirgapFrames(t *testing.T) {
+	data := frand.Bytes(1000)
+	frames := EncodeFrames(FrameTypeSigningRequest, data, 50)
+	if len(frames) < 3 {
+		t.Fatal("expected multiple frames, got", len(frames))
+	}
+
+	// frames may arrive out of order and repeatedly
+	var d FrameDecoder
+	for i, j := range frand.Perm(len(frames)) {
+		for k := 0; k < 2; k++ {
+			done, err := d.Add(frames[j])
+			if err != nil {
+				t.Fatal(err)
+			} else if done != (i == len(frames)-1) {
+				t.Fatalf("decoder reported completion after %v of %v frames", i+1, len(frames))
+			}
+		}
+		if have, total := d.Progress(); have != i+1 || total != len(frames) {
+			t.Fatalf("expected progress %v/%v, got %v/%v", i+1, len(frames), have, total)
+		}
+	}
+	if got, err := d.Data(); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(got, data) {
+		t.Fatal("data changed after round-trip")
+	} else if d.Type() != FrameTypeSigningRequest {
+		t.Fatal("wrong frame type:", d.Type())
+	}
+
+	// frames from another sequence should be rejected
+	var d2 FrameDecoder
+	if _, err := d2.Add(frames[0]); err != nil {
+		t.Fatal(err)
+	}
+	other := strings.Split(frames[1], "/")
+	other[2] = "00000000"
+	if _, err := d2.Add(strings.Join(other, "/")); err == nil {
+		t.Fatal("expected frame with a different checksum to be rejected")
+	}
+
+	// a corrupted payload should fail the checksum
+	var d3 FrameDecoder
+	for i, f := range frames {
+		if i == 1 {
+			fields := strings.Split(f, "/")
+			c := "A"
+			if fields[3][0] == 'A' {
+				c = "B"
+			}
+			f = strings.Join(fields[:3], "/") + "/" + c + fields[3][1:]
+		}
+		if _, err := d3.Add(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := d3.Data(); err == nil {
+		t.Fatal("expected checksum mismatch")
+	}
+
+	// signing requests should survive a round-trip
+	sr := SigningRequest{
+		Transaction: types.Transaction{MinerFees: []types.Currency{types.NewCurrency64(1)}},
+		ToSign:      []crypto.Hash{{1}},
+		KeyIndices:  []uint64{3},
+	}
+	var d4 FrameDecoder
+	for _, f := range sr.Frames(20) {
+		d4.Add(f)
+	}
+	if got, err := DecodeSigningRequest(&d4); err != nil {
+		t.Fatal(err)
+	} else if got.Transaction.ID() != sr.Transaction.ID() || !reflect.DeepEqual(got.ToSign, sr.ToSign) || !reflect.DeepEqual(got.KeyIndices, sr.KeyIndices) {
+		t.Fatal("signing request changed after round-trip")
+	} else if _, err := DecodeSigningResponse(&d4); err == nil {
+		t.Fatal("expected frame type mismatch")
+	}
+}
+
+func TestPolicySigner(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	srv := httptest.NewServer(NewServer(w, new(mockCS), stubTpool{}))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	seed := wallet.NewSeed()
+	owned := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0)),
+		KeyIndex:         0,
+	}
+	// a watch-only address, not derived from the signer's seed
+	watched := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(1)),
+		KeyIndex:         1,
+	}
+	w.AddAddress(owned)
+	w.AddAddress(watched)
+	allowed := types.UnlockHash{1}
+
+	ps := NewPolicySigner(NewWalletAdapter(c, seed), SigningPolicy{
+		Allowlist: []types.UnlockHash{allowed},
+	})
+	txn := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Value: types.SiacoinPrecision, UnlockHash: allowed},
+			{Value: types.SiacoinPrecision.Mul64(2), UnlockHash: owned.UnlockConditions.UnlockHash()},
+		},
+		MinerFees: []types.Currency{types.NewCurrency64(10)},
+	}
+	if out, err := ps.outflow(txn); err != nil {
+		t.Fatal(err)
+	} else if exp := types.SiacoinPrecision.Add(types.NewCurrency64(10)); !out.Equals(exp) {
+		t.Fatalf("expected outflow of %v, got %v", exp, out)
+	}
+
+	// sending to a watch-only address is an outflow, not change
+	txn.SiacoinOutputs[1].UnlockHash = watched.UnlockConditions.UnlockHash()
+	if _, err := ps.outflow(txn); err == nil {
+		t.Fatal("expected watch-only destination to be checked against the allowlist")
+	}
+	ps = NewPolicySigner(NewWalletAdapter(c, seed), SigningPolicy{
+		MaxPerTransaction: types.SiacoinPrecision.Mul64(2),
+	})
+	if out, err := ps.outflow(txn); err != nil {
+		t.Fatal(err)
+	} else if exp := types.SiacoinPrecision.Mul64(3).Add(types.NewCurrency64(10)); !out.Equals(exp) {
+		t.Fatalf("expected outflow of %v, got %v", exp, out)
+	} else if err := ps.SignTransaction(&txn, nil); err == nil {
+		t.Fatal("expected transaction to exceed the per-transaction limit")
+	}
+}
+
+func TestWalletAdapterProto(t *testing.T) {
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	tp := new(recordTpool)
+	srv := httptest.NewServer(NewServer(w, cs, tp))
+	defer srv.Close()
+	seed := wallet.NewSeed()
+	wa := NewWalletAdapter(NewClient(srv.URL), seed)
+
+	addr, err := wa.NewWalletAddress()
+	if err != nil {
+		t.Fatal(err)
+	} else if uc, err := wa.UnlockConditions(addr); err != nil {
+		t.Fatal(err)
+	} else if uc.UnlockHash() != addr {
+		t.Fatal("wrong unlock conditions for address")
+	}
+	cs.sendTxn(types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: addr}},
+	})
+	if outputs, err := wa.UnspentOutputs(true); err != nil {
+		t.Fatal(err)
+	} else if len(outputs) != 1 || outputs[0].UnlockHash != addr || outputs[0].FundType != types.SpecifierSiacoinOutput {
+		t.Fatalf("unexpected outputs: %+v", outputs)
+	}
+
+	// the adapter should be usable as both the wallet and the transaction pool
+	// of a renter
+	rev := proto.ContractRevision{
+		Revision: types.FileContractRevision{
+			ParentID:          types.FileContractID{1},
+			NewRevisionNumber: 2,
+		},
+	}
+	if err := proto.SubmitContractRevision(rev, wa, wa); err != nil {
+		t.Fatal(err)
+	} else if len(tp.sets) != 1 || len(tp.sets[0]) != 1 {
+		t.Fatal("expected revision to be broadcast")
+	}
+	txn := tp.sets[0][0]
+	if len(txn.FileContractRevisions) != 1 || txn.FileContractRevisions[0].ParentID != rev.Revision.ParentID {
+		t.Fatal("broadcast transaction does not contain the revision")
+	} else if len(txn.SiacoinInputs) != 1 || txn.SiacoinInputs[0].UnlockConditions.UnlockHash() != addr {
+		t.Fatal("broadcast transaction was not funded by the wallet")
+	} else if len(txn.TransactionSignatures) != 3 {
+		t.Fatal("expected funding input to be signed, got", len(txn.TransactionSignatures), "signatures")
+	}
+}
+
+func TestHostAnnouncements(t *testing.T) {
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	seed := wallet.NewSeed()
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0)),
+	}
+	w.AddAddress(info)
+	addr := info.UnlockConditions.UnlockHash()
+	funding := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Value: types.SiacoinPrecision, UnlockHash: addr},
+			{Value: types.SiacoinPrecision, UnlockHash: addr},
+		},
+	}
+	cs.sendTxn(funding)
+
+	// announce twice, funded by the wallet, and once funded by someone else
+	sk, pk := crypto.GenerateKeyPair()
+	spk := types.Ed25519PublicKey(pk)
+	announce := func(na modules.NetAddress, uc types.UnlockConditions, parent types.SiacoinOutputID) types.Transaction {
+		ann, err := modules.CreateAnnouncement(na, spk, sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txn := types.Transaction{
+			SiacoinInputs: []types.SiacoinInput{{ParentID: parent, UnlockConditions: uc}},
+			ArbitraryData: [][]byte{ann},
+		}
+		cs.sendTxn(txn)
+		return txn
+	}
+	first := announce("1.2.3.4:9982", info.UnlockConditions, funding.SiacoinOutputID(0))
+	second := announce("5.6.7.8:9982", info.UnlockConditions, funding.SiacoinOutputID(1))
+	announce("9.9.9.9:9982", types.UnlockConditions{}, types.SiacoinOutputID{1})
+
+	anns, err := c.HostAnnouncements()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(anns) != 2 {
+		t.Fatalf("expected 2 announcements, got %v", len(anns))
+	} else if anns[0].TransactionID != second.ID() || anns[1].TransactionID != first.ID() {
+		t.Fatal("announcements should be ordered newest-to-oldest")
+	} else if anns[0].NetAddress != "5.6.7.8:9982" || anns[0].PublicKey != spk.String() {
+		t.Fatalf("wrong announcement: %+v", anns[0])
+	} else if len(anns[0].Addresses) != 1 || anns[0].Addresses[0] != addr {
+		t.Fatal("announcement should report the funding address")
+	}
+}
+
+func TestFileContractTimestamps(t *testing.T) {
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	w.AddAddress(info)
+	outputs := []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: info.UnlockConditions.UnlockHash()}}
+	txn := types.Transaction{
+		FileContracts: []types.FileContract{
+			{WindowStart: 0, WindowEnd: 1, ValidProofOutputs: outputs, MissedProofOutputs: outputs},
+			{WindowStart: 50, WindowEnd: 100, ValidProofOutputs: outputs, MissedProofOutputs: outputs},
+		},
+	}
+	cs.sendTxn(txn)
+
+	// only contracts whose window has ended have a timestamp
+	fcs, err := c.FileContracts(-1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(fcs) != 2 {
+		t.Fatalf("expected 2 contracts, got %v", len(fcs))
+	}
+	for _, fc := range fcs {
+		switch fc.ID {
+		case txn.FileContractID(0):
+			if exp := time.Unix(int64(cs.blocks[0].Timestamp), 0); !fc.WindowEndTimestamp.Equal(exp) {
+				t.Fatalf("expected timestamp %v, got %v", exp, fc.WindowEndTimestamp)
+			}
+		case txn.FileContractID(1):
+			if !fc.WindowEndTimestamp.IsZero() {
+				t.Fatal("open contract should not have a timestamp")
+			}
+		default:
+			t.Fatal("unexpected contract", fc.ID)
+		}
+	}
+}
+
+type fixedRates map[string]float64
+
+func (r fixedRates) SiacoinRate(currency string) (float64, error) {
+	rate, ok := r[currency]
+	if !ok {
+		return 0, errors.New("unsupported currency")
+	}
+	return rate, nil
+}
+
+func TestCheckout(t *testing.T) {
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	tracker := newTestTracker(t, w)
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}, WithTracker(tracker), WithRateProvider(fixedRates{"usd": 0.002})))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	w.AddAddress(info)
+	addr := info.UnlockConditions.UnlockHash()
+	expiry := time.Now().Add(time.Hour).Round(time.Second)
+	err := tracker.AddDeposit(Deposit{
+		Reference: "order 1",
+		Address:   addr,
+		Amount:    types.SiacoinPrecision.Mul64(1500).Div64(100),
+		Expiry:    expiry,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs.sendTxn(types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision.Mul64(5), UnlockHash: addr}},
+	})
+
+	co, err := c.Checkout(addr, "")
+	if err != nil {
+		t.Fatal(err)
+	} else if co.Reference != "order 1" || co.Address != addr {
+		t.Fatalf("wrong deposit: %+v", co)
+	} else if co.AmountSC != "15" || co.URI != "sia:"+addr.String()+"?amount=15" {
+		t.Fatalf("wrong amount or URI: %v, %v", co.AmountSC, co.URI)
+	} else if !co.Received.Equals(types.SiacoinPrecision.Mul64(5)) {
+		t.Fatal("wrong amount received:", co.Received)
+	} else if !co.Expiry.Equal(expiry) || co.Expired {
+		t.Fatal("wrong expiry:", co.Expiry, co.Expired)
+	} else if co.Fiat != nil {
+		t.Fatal("fiat value should only be present if requested")
+	}
+
+	// the QR codes should encode the URI
+	code, _ := qr.Encode(co.URI, qr.M)
+	if img, err := png.Decode(bytes.NewReader(co.QRPNG)); err != nil {
+		t.Fatal(err)
+	} else if size := (code.Size + 8) * code.Scale; img.Bounds().Dx() != size || img.Bounds().Dy() != size {
+		t.Fatal("wrong PNG size:", img.Bounds())
+	} else if !bytes.Equal(co.QRPNG, code.PNG()) {
+		t.Fatal("PNG does not encode the URI")
+	}
+	var svg struct {
+		ViewBox string `xml:"viewBox,attr"`
+		Path    struct {
+			D string `xml:"d,attr"`
+		} `xml:"path"`
+	}
+	black := 0
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				black++
+			}
+		}
+	}
+	if err := xml.Unmarshal([]byte(co.QRSVG), &svg); err != nil {
+		t.Fatal(err)
+	} else if exp := fmt.Sprintf("0 0 %v %v", code.Size+8, code.Size+8); svg.ViewBox != exp {
+		t.Fatal("wrong SVG viewBox:", svg.ViewBox)
+	} else if n := strings.Count(svg.Path.D, "M"); n != black || !strings.Contains(svg.Path.D, "M4 4h1v1h-1z") {
+		t.Fatalf("SVG should draw %v modules, got %v", black, n)
+	}
+
+	if co, err := c.Checkout(addr, "usd"); err != nil {
+		t.Fatal(err)
+	} else if co.Fiat == nil || co.Fiat.Currency != "usd" || math.Abs(co.Fiat.Amount-0.03) > 1e-9 {
+		t.Fatalf("wrong fiat value: %+v", co.Fiat)
+	} else if _, err := c.Checkout(addr, "xyz"); err == nil {
+		t.Fatal("expected unsupported currency to be rejected")
+	} else if _, err := c.Checkout(types.UnlockHash{1}, ""); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected unknown deposit to be rejected with 404, got", err)
+	}
+	if formatSC(types.SiacoinPrecision.Div64(1000)) != "0.001" || formatSC(types.ZeroCurrency) != "0" {
+		t.Fatal("wrong SC formatting")
+	}
+}
+
+func TestRenterReport(t *testing.T) {
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	tracker := newTestTracker(t, w)
+	cs.ConsensusSetSubscribe(tracker, tracker.ConsensusChangeID(), nil)
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}, WithTracker(tracker)))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	w.AddAddress(info)
+	addr := info.UnlockConditions.UnlockHash()
+	sc := types.SiacoinPrecision.Mul64
+	fee := []types.Currency{sc(1)}
+	payment := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: sc(100), UnlockHash: addr}},
+	}
+	spend := func(parent types.SiacoinOutputID, txn types.Transaction) types.Transaction {
+		txn.SiacoinInputs = []types.SiacoinInput{{ParentID: parent, UnlockConditions: info.UnlockConditions}}
+		txn.MinerFees = fee
+		cs.sendTxn(txn)
+		return txn
+	}
+	cs.sendTxn(payment)
+	// form a contract, renew it, and send siacoins elsewhere, paying a fee
+	// each time
+	formation := spend(payment.SiacoinOutputID(0), types.Transaction{
+		FileContracts:  []types.FileContract{{Payout: sc(30)}},
+		SiacoinOutputs: []types.SiacoinOutput{{Value: sc(69), UnlockHash: addr}},
+	})
+	renewal := spend(formation.SiacoinOutputID(0), types.Transaction{
+		FileContracts:  []types.FileContract{{Payout: sc(20), FileSize: 10}},
+		SiacoinOutputs: []types.SiacoinOutput{{Value: sc(48), UnlockHash: addr}},
+	})
+	spend(renewal.SiacoinOutputID(0), types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Value: sc(10), UnlockHash: types.UnlockHash{1}},
+			{Value: sc(37), UnlockHash: addr},
+		},
+	})
+
+	now := time.Now()
+	r, err := c.RenterReport(now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	} else if r.ContractsFormed != 1 || !r.ContractFormation.Equals(sc(30)) {
+		t.Fatalf("wrong contract formation: %v, %v", r.ContractsFormed, r.ContractFormation)
+	} else if r.ContractsRenewed != 1 || !r.ContractRenewal.Equals(sc(20)) {
+		t.Fatalf("wrong contract renewal: %v, %v", r.ContractsRenewed, r.ContractRenewal)
+	} else if !r.Fees.Equals(sc(3)) || !r.Other.Equals(sc(10)) || !r.Total.Equals(sc(63)) {
+		t.Fatalf("wrong fees, other, or total: %v, %v, %v", r.Fees, r.Other, r.Total)
+	}
+
+	// spending outside the period should not be counted
+	if r, err := c.RenterReport(now.Add(time.Hour), now.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if !r.Total.IsZero() {
+		t.Fatal("expected no spending in period, got", r.Total)
+	}
+}
+
+type feeTpool struct {
+	stubTpool
+	min, max types.Currency
+}
+
+func (tp feeTpool) FeeEstimation() (min, max types.Currency) { return tp.min, tp.max }
+
+func TestFeeTiers(t *testing.T) {
+	tp := feeTpool{min: types.NewCurrency64(10), max: types.NewCurrency64(30)}
+	w := wallet.New(wallet.NewEphemeralStore())
+	srv := httptest.NewServer(NewServer(w, new(mockCS), tp))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	tiers, err := c.FeeTiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []ResponseFeeTier{
+		{Tier: FeeTierEconomy, FeePerByte: types.NewCurrency64(10), ConfirmationBlocks: 6},
+		{Tier: FeeTierNormal, FeePerByte: types.NewCurrency64(20), ConfirmationBlocks: 3},
+		{Tier: FeeTierPriority, FeePerByte: types.NewCurrency64(30), ConfirmationBlocks: 1},
+	}
+	if len(tiers) != len(exp) {
+		t.Fatalf("expected %v tiers, got %v", len(exp), len(tiers))
+	}
+	for i := range exp {
+		if tiers[i].Tier != exp[i].Tier || !tiers[i].FeePerByte.Equals(exp[i].FeePerByte) || tiers[i].ConfirmationBlocks != exp[i].ConfirmationBlocks {
+			t.Errorf("expected tier %+v, got %+v", exp[i], tiers[i])
+		}
+	}
+	if min, max, err := NewWalletAdapter(c, wallet.NewSeed()).FeeEstimate(); err != nil {
+		t.Fatal(err)
+	} else if !min.Equals(exp[0].FeePerByte) || !max.Equals(exp[2].FeePerByte) {
+		t.Fatal("adapter should report the economy and priority fees, got", min, max)
+	}
+
+	// fees may be specified by tier or explicitly
+	s := &server{chain: SiaAdapter{CS: new(mockCS), TP: tp}}
+	for _, test := range []struct {
+		spec   string
+		fee    uint64
+		blocks int
+	}{
+		{"", 10, 6},
+		{FeeTierNormal, 20, 3},
+		{"25", 25, 3},
+		{"100", 100, 1},
+		{"5", 5, 0},
+	} {
+		if fee, err := s.parseFee(test.spec); err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+		} else if !fee.FeePerByte.Equals64(test.fee) || fee.ConfirmationBlocks != test.blocks {
+			t.Errorf("%q: expected %v H/byte in %v blocks, got %+v", test.spec, test.fee, test.blocks, fee)
+		}
+	}
+	for _, spec := range []string{"fast", "-1", "1.5"} {
+		if _, err := s.parseFee(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestUnconfirmedAncestors(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	srv := httptest.NewServer(NewServer(w, new(mockCS), stubTpool{}))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	// a chain of transactions, the first two of which are in Limbo
+	chain := make([]types.Transaction, 4)
+	parent := types.SiacoinOutputID{1}
+	for i := range chain {
+		chain[i] = types.Transaction{
+			SiacoinInputs:  []types.SiacoinInput{{ParentID: parent}},
+			SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision}},
+		}
+		parent = chain[i].SiacoinOutputID(0)
+	}
+	w.AddToLimbo(chain[0])
+	w.AddToLimbo(chain[1])
+	w.AddToLimbo(chain[2])
+
+	ids := func(txns []wallet.LimboTransaction) []types.TransactionID {
+		ids := make([]types.TransactionID, len(txns))
+		for i := range txns {
+			ids[i] = txns[i].ID()
+		}
+		return ids
+	}
+	// a single transaction yields only its direct parents
+	if parents, err := c.UnconfirmedParents(chain[3]); err != nil {
+		t.Fatal(err)
+	} else if got := ids(parents); !reflect.DeepEqual(got, []types.TransactionID{chain[2].ID()}) {
+		t.Fatal("wrong parents:", got)
+	}
+	// a set yields every ancestor, parents-first, excluding the set itself
+	if ancestors, err := c.UnconfirmedAncestors(chain[2:]); err != nil {
+		t.Fatal(err)
+	} else if got := ids(ancestors); !reflect.DeepEqual(got, []types.TransactionID{chain[0].ID(), chain[1].ID()}) {
+		t.Fatal("wrong ancestors:", got)
+	}
+}
+
+type finderTpool struct {
+	stubTpool
+	txns map[types.TransactionID]types.Transaction
+}
+
+func (tp finderTpool) Transaction(id types.TransactionID) (types.Transaction, []types.Transaction, bool) {
+	txn, ok := tp.txns[id]
+	return txn, nil, ok
+}
+
+func TestRawTransaction(t *testing.T) {
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	pooled := types.Transaction{ArbitraryData: [][]byte{[]byte("pooled")}}
+	tp := finderTpool{txns: map[types.TransactionID]types.Transaction{pooled.ID(): pooled}}
+	srv := httptest.NewServer(NewServer(w, cs, tp))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	w.AddAddress(info)
+	relevant := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: info.UnlockConditions.UnlockHash()}},
+	}
+	cs.sendTxn(relevant)
+	foreign := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision}},
+	}
+	cs.sendTxn(foreign)
+	limbo := types.Transaction{ArbitraryData: [][]byte{[]byte("limbo")}}
+	w.AddToLimbo(limbo)
+
+	// wallet-relevant and Limbo transactions are always found
+	if raw, err := c.RawTransaction(relevant.ID(), false); err != nil {
+		t.Fatal(err)
+	} else if raw.Transaction.ID() != relevant.ID() || !raw.Confirmed || raw.BlockHeight != 1 {
+		t.Fatalf("wrong raw transaction: %+v", raw)
+	}
+	if raw, err := c.RawTransaction(limbo.ID(), false); err != nil {
+		t.Fatal(err)
+	} else if raw.Transaction.ID() != limbo.ID() || raw.Confirmed {
+		t.Fatalf("wrong raw transaction: %+v", raw)
+	}
+
+	// other transactions are only found with anyrelevance
+	if _, err := c.RawTransaction(foreign.ID(), false); err == nil {
+		t.Fatal("expected irrelevant transaction to be hidden")
+	}
+	if raw, err := c.RawTransaction(foreign.ID(), true); err != nil {
+		t.Fatal(err)
+	} else if raw.Transaction.ID() != foreign.ID() || !raw.Confirmed || raw.BlockHeight != 2 || raw.BlockID != cs.blocks[1].ID() {
+		t.Fatalf("wrong raw transaction: %+v", raw)
+	}
+	if raw, err := c.RawTransaction(pooled.ID(), true); err != nil {
+		t.Fatal(err)
+	} else if raw.Transaction.ID() != pooled.ID() || raw.Confirmed {
+		t.Fatalf("wrong raw transaction: %+v", raw)
+	}
+	if _, err := c.RawTransaction(types.TransactionID{1}, true); err == nil {
+		t.Fatal("expected unknown transaction to be not found")
+	}
+
+	// the block search respects the depth limit
+	resp, err := http.Get(srv.URL + "/transactions/" + relevant.ID().String() + "/raw?anyrelevance=true&depth=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("relevant transaction should be found regardless of depth:", resp.Status)
+	}
+	resp, err = http.Get(srv.URL + "/transactions/" + foreign.ID().String() + "/raw?anyrelevance=true&depth=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatal("expected depth=0 to skip the block search, got", resp.Status)
+	}
+}
+
+func TestTraceOutput(t *testing.T) {
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	w.AddAddress(info)
+	addr := info.UnlockConditions.UnlockHash()
+
+	// funded by a counterparty, then spent back to ourselves
+	external := types.SiacoinOutputID{1}
+	funding := types.Transaction{
+		SiacoinInputs:  []types.SiacoinInput{{ParentID: external}},
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: addr}},
+	}
+	cs.sendTxn(funding)
+	spend := types.Transaction{
+		SiacoinInputs:  []types.SiacoinInput{{ParentID: funding.SiacoinOutputID(0), UnlockConditions: info.UnlockConditions}},
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: addr}},
+	}
+	cs.sendTxn(spend)
+
+	trace, err := c.TraceOutput(spend.SiacoinOutputID(0), 10)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(trace) != 3 {
+		t.Fatalf("expected 3 generations, got %v", len(trace))
+	}
+	if trace[0].Source != OutputSourceTransaction || trace[0].TransactionID != spend.ID() || trace[0].Depth != 0 ||
+		len(trace[0].Parents) != 1 || trace[0].Parents[0] != funding.SiacoinOutputID(0) {
+		t.Fatalf("wrong trace for output: %+v", trace[0])
+	}
+	if trace[1].Source != OutputSourceTransaction || trace[1].TransactionID != funding.ID() || trace[1].Depth != 1 ||
+		trace[1].UnlockHash != addr || !trace[1].Value.Equals(types.SiacoinPrecision) {
+		t.Fatalf("wrong trace for parent: %+v", trace[1])
+	}
+	if trace[2].Source != OutputSourceExternal || trace[2].ID != external || trace[2].Depth != 2 {
+		t.Fatalf("wrong trace for grandparent: %+v", trace[2])
+	}
+
+	// depth limits the number of generations
+	if trace, err := c.TraceOutput(spend.SiacoinOutputID(0), 1); err != nil {
+		t.Fatal(err)
+	} else if len(trace) != 2 {
+		t.Fatalf("expected 2 generations, got %v", len(trace))
+	}
+
+	// outputs outside the wallet's history are not found
+	if _, err := c.TraceOutput(types.SiacoinOutputID{2}, 10); err == nil {
+		t.Fatal("expected unknown output to be rejected")
+	}
+}
+
+func TestSeedIndexPreview(t *testing.T) {
+	seed := wallet.NewSeed()
+	w := wallet.New(wallet.NewEphemeralStore())
+
+	// without a KeySource, the route is not registered
+	srv := httptest.NewServer(NewServer(w, new(mockCS), stubTpool{}))
+	if _, err := NewClient(srv.URL).PreviewAddresses(1); err == nil {
+		t.Fatal("expected preview to fail without a KeySource")
+	}
+	srv.Close()
+
+	srv = httptest.NewServer(NewServer(w, new(mockCS), stubTpool{}, WithKeySource(NewSeedKeySource(seed))))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	w.AddAddress(wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0)),
+		KeyIndex:         0,
+	})
+	preview, err := c.PreviewAddresses(3)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(preview) != 3 {
+		t.Fatalf("expected 3 addresses, got %v", len(preview))
+	}
+	for i, p := range preview {
+		index := uint64(i + 1)
+		if p.KeyIndex != index || p.Address != wallet.StandardAddress(seed.PublicKey(index)) {
+			t.Fatalf("wrong address at index %v: %+v", index, p)
+		}
+	}
+	// previewing does not register the addresses
+	if index, err := c.SeedIndex(); err != nil {
+		t.Fatal(err)
+	} else if index != 1 {
+		t.Fatal("preview should not advance the seed index, got", index)
+	} else if w.OwnsAddress(preview[0].Address) {
+		t.Fatal("preview should not add addresses to the wallet")
+	}
+	if _, err := c.PreviewAddresses(maxPreviewCount + 1); err == nil {
+		t.Fatal("expected excessive count to be rejected")
+	}
+}
+
+func TestSeedIndexReserve(t *testing.T) {
+	// without a Tracker, reservations are held in memory
+	w := wallet.New(wallet.NewEphemeralStore())
+	srv := httptest.NewServer(NewServer(w, new(mockCS), stubTpool{}))
+	c := NewClient(srv.URL)
+	if start, end, err := c.ReserveSeedIndices(2); err != nil {
+		t.Fatal(err)
+	} else if start != 0 || end != 2 {
+		t.Fatalf("expected [0, 2), got [%v, %v)", start, end)
+	}
+	if start, end, err := c.ReserveSeedIndices(3); err != nil {
+		t.Fatal(err)
+	} else if start != 2 || end != 5 {
+		t.Fatalf("expected [2, 5), got [%v, %v)", start, end)
+	}
+	if index, err := c.SeedIndex(); err != nil {
+		t.Fatal(err)
+	} else if index != 5 {
+		t.Fatal("seed index should skip reserved indices, got", index)
+	}
+	if _, _, err := c.ReserveSeedIndices(0); err == nil {
+		t.Fatal("expected zero count to be rejected")
+	}
+	srv.Close()
+
+	// with a Tracker, reservations are persisted, and reserved indices can
+	// be provisioned as deposits
+	seed := wallet.NewSeed()
+	w = wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+	srv = httptest.NewServer(NewServer(w, new(mockCS), stubTpool{}, WithTracker(tracker)))
+	defer srv.Close()
+	c = NewClient(srv.URL)
+	if _, _, err := c.ReserveSeedIndices(2); err != nil {
+		t.Fatal(err)
+	} else if tracker.ReservedSeedIndex() != 2 {
+		t.Fatal("reservation was not persisted")
+	}
+	deposit := func(index uint64) error {
+		_, err := c.AddDeposit(RequestDeposit{
+			SeedAddressInfo: wallet.SeedAddressInfo{
+				UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(index)),
+				KeyIndex:         index,
+			},
+			Reference: "ref" + strconv.FormatUint(index, 10),
+		})
+		return err
+	}
+	if err := deposit(1); err != nil {
+		t.Fatal(err)
+	} else if err := deposit(0); err != nil {
+		t.Fatal(err)
+	} else if err := deposit(1); err == nil {
+		t.Fatal("expected provisioned index to be rejected")
+	} else if err := deposit(3); err == nil {
+		t.Fatal("expected index beyond the next seed index to be rejected")
+	} else if err := deposit(2); err != nil {
+		t.Fatal(err)
+	}
+	if index, err := c.SeedIndex(); err != nil {
+		t.Fatal(err)
+	} else if index != 3 {
+		t.Fatal("expected seed index 3, got", index)
+	}
+}
+
+func TestDepositAddressValidation(t *testing.T) {
+	seed := wallet.NewSeed()
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+	srv := httptest.NewServer(NewServer(w, new(mockCS), stubTpool{}, WithTracker(tracker), WithKeySource(NewSeedKeySource(seed))))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	deposit := func(uc types.UnlockConditions, index uint64) (types.UnlockHash, error) {
+		return c.AddDeposit(RequestDeposit{
+			SeedAddressInfo: wallet.SeedAddressInfo{UnlockConditions: uc, KeyIndex: index},
+			Reference:       "ref" + strconv.FormatUint(index, 10),
+		})
+	}
+
+	// the key must be the one at the specified index
+	if _, err := deposit(wallet.StandardUnlockConditions(seed.PublicKey(1)), 0); err == nil {
+		t.Fatal("expected key from the wrong index to be rejected")
+	}
+	multisig := types.UnlockConditions{
+		PublicKeys:         []types.SiaPublicKey{seed.PublicKey(0), seed.PublicKey(1)},
+		SignaturesRequired: 1,
+	}
+	if _, err := deposit(multisig, 0); err == nil {
+		t.Fatal("expected non-standard unlock conditions to be rejected")
+	}
+	// omitted unlock conditions are derived by the server
+	if addr, err := deposit(types.UnlockConditions{}, 0); err != nil {
+		t.Fatal(err)
+	} else if addr != wallet.StandardAddress(seed.PublicKey(0)) {
+		t.Fatal("server derived the wrong address")
+	}
+
+	// an unreserved index below the current index is rejected, even if it
+	// has never been provisioned
+	w.AddAddress(wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(3)),
+		KeyIndex:         3,
+	})
+	if _, err := deposit(types.UnlockConditions{}, 2); err == nil {
+		t.Fatal("expected unreserved index to be rejected")
+	} else if _, err := deposit(types.UnlockConditions{}, 4); err != nil {
+		t.Fatal(err)
+	}
+	if start, _, err := c.ReserveSeedIndices(2); err != nil {
+		t.Fatal(err)
+	} else if _, err := deposit(types.UnlockConditions{}, start+1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConsolidationPolicy(t *testing.T) {
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	tracker := newTestTracker(t, w)
+
+	// without a policy, there is nothing to consolidate
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}, WithTracker(tracker)))
+	defer srv.Close()
+	if _, err := NewClient(srv.URL).Consolidation(""); err == nil || !strings.Contains(err.Error(), "No consolidation policy") {
+		t.Fatal("expected missing policy to be rejected, got", err)
+	}
+
+	dest := types.UnlockHash{1}
+	tracker.SetConsolidationPolicy(ConsolidationPolicy{Threshold: 2, Destination: dest})
+	cs.ConsensusSetSubscribe(tracker, tracker.ConsensusChangeID(), nil)
+	seed := wallet.NewSeed()
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0)),
+	}
+	w.AddAddress(info)
+	addr := info.UnlockConditions.UnlockHash()
+
+	// without a seed, the consolidation is only drafted
+	tp := new(recordTpool)
+	cold := httptest.NewServer(NewServer(w, cs, tp, WithTracker(tracker)))
+	defer cold.Close()
+	c := NewClient(cold.URL)
+	cs.sendReward(addr, types.SiacoinPrecision.Mul64(10))
+	if _, err := c.Consolidation(""); err == nil || !strings.Contains(err.Error(), "Only 1 of 2") {
+		t.Fatal("expected consolidation below the threshold to be rejected, got", err)
+	}
+	cs.sendReward(addr, types.SiacoinPrecision.Mul64(10))
+	if _, err := c.Consolidation("foo"); err == nil || !strings.Contains(err.Error(), "Invalid fee") {
+		t.Fatal("expected invalid fee to be rejected, got", err)
+	}
+	cons, err := c.Consolidation("1")
+	if err != nil {
+		t.Fatal(err)
+	} else if cons.Policy.Threshold != 2 || cons.Policy.Destination != dest {
+		t.Fatal("wrong policy:", cons.Policy)
+	} else if txn := cons.Transaction; len(txn.SiacoinInputs) != 2 || len(cons.KeyIndices) != 2 || len(txn.TransactionSignatures) != 0 {
+		t.Fatal("wrong draft:", txn)
+	} else if len(txn.SiacoinOutputs) != 1 || txn.SiacoinOutputs[0].UnlockHash != dest ||
+		!txn.SiacoinOutputs[0].Value.Add(txn.MinerFees[0]).Equals(types.SiacoinPrecision.Mul64(20)) {
+		t.Fatal("consolidation should send all rewards to the destination:", txn.SiacoinOutputs)
+	} else if len(tp.sets) != 0 || len(w.LimboTransactions()) != 0 {
+		t.Fatal("draft should not be broadcast")
+	}
+
+	// with a seed, the consolidation is signed and broadcast once the next
+	// block is connected
+	hot := httptest.NewServer(NewServer(w, cs, tp, WithTracker(tracker), WithSigningSeed(seed)))
+	defer hot.Close()
+	c = NewClient(hot.URL)
+	cs.sendReward(addr, types.SiacoinPrecision.Mul64(10))
+	for i := 0; len(w.LimboTransactions()) == 0; i++ {
+		if i > 100 {
+			t.Fatal("consolidation was not broadcast")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(tp.sets) != 1 || len(tp.sets[0]) != 1 {
+		t.Fatal("expected one consolidation to be broadcast, got", tp.sets)
+	} else if txn := tp.sets[0][0]; len(txn.SiacoinInputs) != 3 || len(txn.TransactionSignatures) != 3 {
+		t.Fatal("consolidation should spend every reward and be signed:", txn)
+	} else if txn.SiacoinOutputs[0].UnlockHash != dest {
+		t.Fatal("consolidation should pay the destination:", txn.SiacoinOutputs)
+	} else if _, err := c.Consolidation(""); err == nil || !strings.Contains(err.Error(), "Only 0 of 2") {
+		t.Fatal("consolidated rewards should not be drafted again, got", err)
+	}
+}
+
+func TestHostReport(t *testing.T) {
+	// weeks start on Monday, in UTC
+	monday := time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC)
+	prevMonday := monday.AddDate(0, 0, -7)
+	for _, test := range []struct {
+		t    time.Time
+		week time.Time
+	}{
+		{monday, monday},
+		{monday.Add(-time.Second), prevMonday}, // Sunday
+		{monday.AddDate(0, 0, 6).Add(23 * time.Hour), monday},
+		{time.Date(2021, 1, 4, 1, 0, 0, 0, time.FixedZone("", 5*60*60)), prevMonday},
+	} {
+		if week := weekOf(test.t); !week.Equal(test.week) {
+			t.Errorf("weekOf(%v) = %v, expected %v", test.t, week, test.week)
+		}
+	}
+	var weeks []ResponseHostReportWeek
+	for _, d := range []int{14, 0, 7, 1} {
+		weeks = groupByWeek(weeks, monday.AddDate(0, 0, d), types.SiacoinPrecision)
+	}
+	if len(weeks) != 3 {
+		t.Fatal("expected 3 weeks, got", weeks)
+	}
+	for i, exp := range []int{2, 1, 1} {
+		if week := monday.AddDate(0, 0, 7*i); !weeks[i].Week.Equal(week) || weeks[i].Contracts != exp || !weeks[i].Payout.Equals(types.SiacoinPrecision.Mul64(uint64(exp))) {
+			t.Fatalf("wrong week %v: %+v", i, weeks[i])
+		}
+	}
+
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	tracker := newTestTracker(t, w)
+	cs.ConsensusSetSubscribe(tracker, tracker.ConsensusChangeID(), nil)
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}, WithTracker(tracker)))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	w.AddAddress(info)
+	addr, renter := info.UnlockConditions.UnlockHash(), types.UnlockHash{1}
+	sc := func(n uint64) types.Currency { return types.SiacoinPrecision.Mul64(n) }
+	contract := func(windowEnd types.BlockHeight, valid, missed []types.SiacoinOutput) types.FileContract {
+		return types.FileContract{
+			WindowStart:        windowEnd - 1,
+			WindowEnd:          windowEnd,
+			ValidProofOutputs:  valid,
+			MissedProofOutputs: missed,
+		}
+	}
+	txn := types.Transaction{
+		FileContracts: []types.FileContract{
+			// active; only the wallet's outputs count, and 6 SC is at risk
+			contract(200,
+				[]types.SiacoinOutput{{Value: sc(10), UnlockHash: addr}, {Value: sc(5), UnlockHash: renter}},
+				[]types.SiacoinOutput{{Value: sc(4), UnlockHash: addr}, {Value: sc(11), UnlockHash: renter}}),
+			// active; nothing is at risk
+			contract(3000,
+				[]types.SiacoinOutput{{Value: sc(3), UnlockHash: addr}},
+				[]types.SiacoinOutput{{Value: sc(3), UnlockHash: addr}}),
+			// expired
+			contract(3,
+				[]types.SiacoinOutput{{Value: sc(7), UnlockHash: addr}},
+				[]types.SiacoinOutput{{Value: sc(1), UnlockHash: addr}}),
+			// resolved by a storage proof
+			contract(300,
+				[]types.SiacoinOutput{{Value: sc(2), UnlockHash: addr}},
+				[]types.SiacoinOutput{{Value: sc(1), UnlockHash: addr}}),
+			// missed
+			contract(2,
+				[]types.SiacoinOutput{{Value: sc(8), UnlockHash: addr}},
+				[]types.SiacoinOutput{{Value: sc(1), UnlockHash: addr}}),
+		},
+	}
+	cs.sendTxn(txn)
+	fcs := txn.FileContracts
+	provenID, missedID := txn.FileContractID(3), txn.FileContractID(4)
+
+	// resolve the proven contract on a Monday, and the missed contract on the
+	// preceding Sunday
+	cc := modules.ConsensusChange{
+		AppliedBlocks: []types.Block{
+			{
+				Timestamp:    types.Timestamp(monday.Add(12 * time.Hour).Unix()),
+				Transactions: []types.Transaction{{StorageProofs: []types.StorageProof{{ParentID: provenID}}}},
+			},
+			{Timestamp: types.Timestamp(monday.Add(-12 * time.Hour).Unix())},
+		},
+		FileContractDiffs: []modules.FileContractDiff{
+			{Direction: modules.DiffRevert, ID: provenID, FileContract: fcs[3]},
+			{Direction: modules.DiffRevert, ID: missedID, FileContract: fcs[4]},
+		},
+	}
+	frand.Read(cc.ID[:])
+	for _, s := range cs.subscribers {
+		s.ProcessConsensusChange(cc)
+	}
+	cs.blocks = append(cs.blocks, cc.AppliedBlocks...)
+	cs.height += 2
+
+	report, err := c.HostReport()
+	if err != nil {
+		t.Fatal(err)
+	} else if report.ActiveContracts != 2 {
+		t.Fatal("expected 2 active contracts, got", report.ActiveContracts)
+	} else if !report.CollateralLocked.Equals(sc(13)) {
+		t.Fatal("wrong collateral locked:", report.CollateralLocked)
+	} else if !report.AtRisk.Equals(sc(6)) {
+		t.Fatal("wrong amount at risk:", report.AtRisk)
+	} else if report.ValidProofs != 1 || report.MissedProofs != 1 {
+		t.Fatal("wrong proof counts:", report.ValidProofs, report.MissedProofs)
+	}
+	if exp := report.ExpectedPayouts; len(exp) != 2 || !exp[0].Week.Before(exp[1].Week) ||
+		exp[0].Contracts != 1 || !exp[0].Payout.Equals(sc(10)) || exp[1].Contracts != 1 || !exp[1].Payout.Equals(sc(3)) {
+		t.Fatal("wrong expected payouts:", exp)
+	}
+	if rev := report.Revenue; len(rev) != 2 ||
+		!rev[0].Week.Equal(prevMonday) || rev[0].Contracts != 1 || !rev[0].Payout.Equals(sc(1)) ||
+		!rev[1].Week.Equal(monday) || rev[1].Contracts != 1 || !rev[1].Payout.Equals(sc(2)) {
+		t.Fatal("wrong revenue:", rev)
+	}
+}
@@ -0,0 +1,66 @@
+package walrus
+
+import (
+	"sort"
+
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+)
+
+// unspentSiafundOutputs returns the wallet's unspent siafund outputs. If limbo
+// is true, outputs spent by transactions in Limbo are excluded.
+func unspentSiafundOutputs(t *Tracker, w *wallet.SeedWallet, limbo bool) []SiafundOutput {
+	spent := make(map[types.SiafundOutputID]bool)
+	if limbo {
+		for _, txn := range w.LimboTransactions() {
+			for _, sfi := range txn.SiafundInputs {
+				spent[sfi.ParentID] = true
+			}
+		}
+	}
+	var unspent []SiafundOutput
+	for _, sfo := range t.SiafundOutputs() {
+		if !sfo.Spent && !spent[sfo.ID] {
+			unspent = append(unspent, sfo)
+		}
+	}
+	return unspent
+}
+
+// fundSiafunds selects siafund outputs worth at least amount, largest first,
+// returning an input for each, along with the key index of each input and the
+// change. The claims of the inputs are paid to claimAddr.
+func fundSiafunds(w *wallet.SeedWallet, sfos []SiafundOutput, amount types.Currency, claimAddr types.UnlockHash) (inputs []types.SiafundInput, keyIndices []uint64, change types.Currency, ok bool) {
+	sfos = append([]SiafundOutput(nil), sfos...)
+	sort.Slice(sfos, func(i, j int) bool {
+		return sfos[i].Value.Cmp(sfos[j].Value) > 0
+	})
+	total := types.ZeroCurrency
+	for _, sfo := range sfos {
+		if total.Cmp(amount) >= 0 {
+			break
+		}
+		info, ok := w.AddressInfo(sfo.UnlockHash)
+		if !ok {
+			continue
+		}
+		inputs = append(inputs, types.SiafundInput{
+			ParentID:         sfo.ID,
+			UnlockConditions: info.UnlockConditions,
+			ClaimUnlockHash:  claimAddr,
+		})
+		keyIndices = append(keyIndices, info.KeyIndex)
+		total = total.Add(sfo.Value)
+	}
+	if total.Cmp(amount) < 0 {
+		return nil, nil, types.ZeroCurrency, false
+	}
+	return inputs, keyIndices, total.Sub(amount), true
+}
+
+// siafundFee returns the fee for the siafund inputs and outputs of txn.
+func siafundFee(txn types.Transaction, feePerByte types.Currency) types.Currency {
+	size := len(encoding.Marshal(txn.SiafundInputs)) + len(encoding.Marshal(txn.SiafundOutputs))
+	return feePerByte.Mul64(uint64(size))
+}
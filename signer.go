@@ -0,0 +1,222 @@
+package walrus
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/renter/proto"
+)
+
+// A SigningPolicy constrains the transactions that a PolicySigner will sign.
+// Zero-valued fields impose no constraint.
+type SigningPolicy struct {
+	// The addresses that the wallet may send siacoins to. Change outputs
+	// (outputs sent to addresses derived from the signer's seed) are always
+	// permitted. Watch-only addresses are not exempt.
+	Allowlist []types.UnlockHash `json:"allowlist"`
+	// The maximum value, including miner fees, that may leave the wallet in a
+	// single transaction.
+	MaxPerTransaction types.Currency `json:"maxPerTransaction"`
+	// The maximum value, including miner fees, that may leave the wallet in any
+	// 24-hour period.
+	MaxPerDay types.Currency `json:"maxPerDay"`
+	// If set, the transaction's memo must contain this tag.
+	MemoTag string `json:"memoTag"`
+}
+
+// A PolicySigner signs transactions only if they satisfy a SigningPolicy,
+// allowing automated systems to hold constrained, rather than full, spending
+// authority. It can be used in place of a WalletAdapter. Since the signing
+// adapter is not exposed, the policy cannot be bypassed through the
+// PolicySigner; however, the policy is only as strong as the isolation of the
+// seed. To keep the seed away from the automated system entirely, serve /sign
+// with WithSigningPolicy instead.
+//
+// The daily limit is enforced using the transactions signed by the
+// PolicySigner itself, and is not preserved across restarts.
+type PolicySigner struct {
+	wa      *WalletAdapter
+	limiter *spendLimiter
+}
+
+var _ proto.Wallet = (*PolicySigner)(nil)
+var _ proto.TransactionPool = (*PolicySigner)(nil)
+
+type signedValue struct {
+	timestamp time.Time
+	value     types.Currency
+}
+
+// A spendLimiter authorizes the transactions that satisfy a SigningPolicy,
+// keeping track of the value signed for in the last day.
+type spendLimiter struct {
+	policy SigningPolicy
+
+	mu     sync.Mutex
+	signed []signedValue
+}
+
+// policyOutflow returns the value that txn sends out of the wallet, checking
+// that every external output is allowed by p. owns reports whether an address
+// is a change address.
+func policyOutflow(p SigningPolicy, txn types.Transaction, owns func(types.UnlockHash) (bool, error)) (types.Currency, error) {
+	if len(txn.FileContracts) > 0 || len(txn.FileContractRevisions) > 0 ||
+		len(txn.StorageProofs) > 0 || len(txn.SiafundInputs) > 0 || len(txn.SiafundOutputs) > 0 {
+		return types.ZeroCurrency, errors.New("transaction contains disallowed elements")
+	}
+	allowed := func(addr types.UnlockHash) bool {
+		if len(p.Allowlist) == 0 {
+			return true
+		}
+		for _, a := range p.Allowlist {
+			if a == addr {
+				return true
+			}
+		}
+		return false
+	}
+	out := types.ZeroCurrency
+	for _, sco := range txn.SiacoinOutputs {
+		if owned, err := owns(sco.UnlockHash); err != nil {
+			return types.ZeroCurrency, err
+		} else if owned {
+			continue
+		} else if !allowed(sco.UnlockHash) {
+			return types.ZeroCurrency, fmt.Errorf("destination %v is not in the allowlist", sco.UnlockHash)
+		}
+		out = out.Add(sco.Value)
+	}
+	for _, fee := range txn.MinerFees {
+		out = out.Add(fee)
+	}
+	return out, nil
+}
+
+// spentSince returns the total value signed for since the specified time.
+func (sl *spendLimiter) spentSince(t time.Time) types.Currency {
+	sum := types.ZeroCurrency
+	for _, sv := range sl.signed {
+		if sv.timestamp.After(t) {
+			sum = sum.Add(sv.value)
+		}
+	}
+	return sum
+}
+
+// authorize calls sign if txn satisfies the policy, and records the value
+// that txn sends out of the wallet if sign succeeds. memo returns the
+// transaction's memo, and owns reports whether an address is a change
+// address.
+func (sl *spendLimiter) authorize(txn types.Transaction, memo func() ([]byte, error), owns func(types.UnlockHash) (bool, error), sign func() error) error {
+	if sl.policy.MemoTag != "" {
+		m, err := memo()
+		if err != nil {
+			return err
+		} else if !bytes.Contains(m, []byte(sl.policy.MemoTag)) {
+			return errors.New("transaction memo does not contain the required tag")
+		}
+	}
+	out, err := policyOutflow(sl.policy, txn, owns)
+	if err != nil {
+		return err
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	if !sl.policy.MaxPerTransaction.IsZero() && out.Cmp(sl.policy.MaxPerTransaction) > 0 {
+		return fmt.Errorf("transaction sends %v, exceeding the per-transaction limit of %v", out, sl.policy.MaxPerTransaction)
+	}
+	now := time.Now()
+	if !sl.policy.MaxPerDay.IsZero() {
+		// forget transactions older than a day
+		cutoff := now.Add(-24 * time.Hour)
+		for len(sl.signed) > 0 && !sl.signed[0].timestamp.After(cutoff) {
+			sl.signed = sl.signed[1:]
+		}
+		if sl.spentSince(cutoff).Add(out).Cmp(sl.policy.MaxPerDay) > 0 {
+			return fmt.Errorf("transaction would exceed the daily limit of %v", sl.policy.MaxPerDay)
+		}
+	}
+	if err := sign(); err != nil {
+		return err
+	}
+	sl.signed = append(sl.signed, signedValue{now, out})
+	return nil
+}
+
+// outflow returns the value that txn sends out of the wallet, checking that
+// every external output is allowed by the policy.
+func (ps *PolicySigner) outflow(txn types.Transaction) (types.Currency, error) {
+	return policyOutflow(ps.limiter.policy, txn, ps.wa.ownsAddress)
+}
+
+// SignTransaction signs the inputs of txn whose parent IDs are in toSign, if
+// txn satisfies the signer's policy.
+func (ps *PolicySigner) SignTransaction(txn *types.Transaction, toSign []crypto.Hash) error {
+	memo := func() ([]byte, error) { return ps.wa.c.Memo(txn.ID()) }
+	return ps.limiter.authorize(*txn, memo, ps.wa.ownsAddress, func() error {
+		return ps.wa.SignTransaction(txn, toSign)
+	})
+}
+
+// Address derives a new address from the seed and adds it to the wallet.
+func (ps *PolicySigner) Address() (types.UnlockHash, error) {
+	return ps.wa.Address()
+}
+
+// NewWalletAddress implements proto.Wallet. It is equivalent to Address.
+func (ps *PolicySigner) NewWalletAddress() (types.UnlockHash, error) {
+	return ps.wa.NewWalletAddress()
+}
+
+// UnspentOutputs implements proto.Wallet.
+func (ps *PolicySigner) UnspentOutputs(limbo bool) ([]modules.UnspentOutput, error) {
+	return ps.wa.UnspentOutputs(limbo)
+}
+
+// UnlockConditions implements proto.Wallet.
+func (ps *PolicySigner) UnlockConditions(addr types.UnlockHash) (types.UnlockConditions, error) {
+	return ps.wa.UnlockConditions(addr)
+}
+
+// FundTransaction adds inputs worth at least amount to txn; see
+// WalletAdapter.FundTransaction. The inputs are not signed.
+func (ps *PolicySigner) FundTransaction(txn *types.Transaction, amount types.Currency) ([]crypto.Hash, func(), error) {
+	return ps.wa.FundTransaction(txn, amount)
+}
+
+// UnconfirmedParents returns any parents of txn that are in Limbo.
+func (ps *PolicySigner) UnconfirmedParents(txn types.Transaction) ([]types.Transaction, error) {
+	return ps.wa.UnconfirmedParents(txn)
+}
+
+// AcceptTransactionSet implements proto.TransactionPool. It broadcasts txnSet
+// via the server.
+func (ps *PolicySigner) AcceptTransactionSet(txnSet []types.Transaction) error {
+	return ps.wa.AcceptTransactionSet(txnSet)
+}
+
+// FeeEstimate implements proto.TransactionPool.
+func (ps *PolicySigner) FeeEstimate() (min, max types.Currency, err error) {
+	return ps.wa.FeeEstimate()
+}
+
+// Policy returns the signer's policy.
+func (ps *PolicySigner) Policy() SigningPolicy {
+	return ps.limiter.policy
+}
+
+// NewPolicySigner returns a PolicySigner that signs transactions with wa,
+// subject to the specified policy.
+func NewPolicySigner(wa *WalletAdapter, p SigningPolicy) *PolicySigner {
+	return &PolicySigner{
+		wa:      wa,
+		limiter: &spendLimiter{policy: p},
+	}
+}
@@ -0,0 +1,236 @@
+package walrus
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+	"lukechampine.com/us/wallet"
+)
+
+// snapshotVersion is the version of the snapshot format.
+const snapshotVersion = 1
+
+// snapshotManifestName is the name of the manifest entry of a snapshot.
+const snapshotManifestName = "manifest.json"
+
+// SnapshotFiles are the databases, relative to a walrus directory, that are
+// included in a snapshot: the consensus set, the wallet, and the Tracker.
+var SnapshotFiles = []string{"consensus/consensus.db", "wallet.db", "walrus.db"}
+
+// A SnapshotFile describes a database in a snapshot.
+type SnapshotFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// A SnapshotManifest describes the contents of a snapshot.
+type SnapshotManifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// The height and consensus change processed by the wallet.
+	Height            types.BlockHeight         `json:"height"`
+	ConsensusChangeID modules.ConsensusChangeID `json:"consensusChangeID"`
+	Files             []SnapshotFile            `json:"files"`
+}
+
+// walletPosition returns the height and consensus change processed by the
+// wallet database at path.
+func walletPosition(path string) (types.BlockHeight, modules.ConsensusChangeID, error) {
+	store, err := wallet.NewBoltDBStore(path, nil)
+	if err != nil {
+		return 0, modules.ConsensusChangeID{}, err
+	}
+	defer store.Close()
+	return store.ChainHeight(), store.ConsensusChangeID(), nil
+}
+
+// copyDB writes a consistent copy of the bolt database at src to dst, and
+// returns its size and hash. The database must not be open in another
+// process.
+func copyDB(src, dst string) (SnapshotFile, error) {
+	db, err := bolt.Open(src, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err == bolt.ErrTimeout {
+		return SnapshotFile{}, fmt.Errorf("%v is in use; stop walrus before taking a snapshot", src)
+	} else if err != nil {
+		return SnapshotFile{}, err
+	}
+	defer db.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		return SnapshotFile{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	var n int64
+	err = db.View(func(tx *bolt.Tx) error {
+		n, err = tx.WriteTo(io.MultiWriter(f, h))
+		return err
+	})
+	if err != nil {
+		return SnapshotFile{}, err
+	} else if err := f.Sync(); err != nil {
+		return SnapshotFile{}, err
+	}
+	return SnapshotFile{Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// WriteSnapshot writes a snapshot of the databases in dir to w, as a tar
+// archive. walrus must not be running.
+func WriteSnapshot(w io.Writer, dir string) (SnapshotManifest, error) {
+	tmp, err := ioutil.TempDir("", "walrus-snapshot")
+	if err != nil {
+		return SnapshotManifest{}, err
+	}
+	defer os.RemoveAll(tmp)
+
+	m := SnapshotManifest{
+		Version: snapshotVersion,
+		Created: time.Now(),
+	}
+	for i, name := range SnapshotFiles {
+		sf, err := copyDB(filepath.Join(dir, filepath.FromSlash(name)), filepath.Join(tmp, fmt.Sprint(i)))
+		if err != nil {
+			return SnapshotManifest{}, err
+		}
+		sf.Name = name
+		m.Files = append(m.Files, sf)
+	}
+	// read the wallet's position from a separate copy, since opening the
+	// store may modify it
+	walletCopy := filepath.Join(tmp, "wallet")
+	if _, err := copyDB(filepath.Join(dir, "wallet.db"), walletCopy); err != nil {
+		return SnapshotManifest{}, err
+	} else if m.Height, m.ConsensusChangeID, err = walletPosition(walletCopy); err != nil {
+		return SnapshotManifest{}, err
+	}
+
+	tw := tar.NewWriter(w)
+	js, _ := json.MarshalIndent(m, "", "\t")
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    snapshotManifestName,
+		Mode:    0600,
+		Size:    int64(len(js)),
+		ModTime: m.Created,
+	}); err != nil {
+		return SnapshotManifest{}, err
+	} else if _, err := tw.Write(js); err != nil {
+		return SnapshotManifest{}, err
+	}
+	for i, sf := range m.Files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    sf.Name,
+			Mode:    0600,
+			Size:    sf.Size,
+			ModTime: m.Created,
+		}); err != nil {
+			return SnapshotManifest{}, err
+		}
+		f, err := os.Open(filepath.Join(tmp, fmt.Sprint(i)))
+		if err != nil {
+			return SnapshotManifest{}, err
+		}
+		_, err = io.Copy(tw, f)
+		f.Close()
+		if err != nil {
+			return SnapshotManifest{}, err
+		}
+	}
+	return m, tw.Close()
+}
+
+// RestoreSnapshot restores the snapshot read from r into dir, verifying the
+// hash of each database against the snapshot's manifest. dir must not
+// already contain any of the databases.
+func RestoreSnapshot(r io.Reader, dir string) (SnapshotManifest, error) {
+	for _, name := range SnapshotFiles {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err == nil {
+			return SnapshotManifest{}, fmt.Errorf("%v already exists; snapshots can only be restored into a fresh directory", name)
+		}
+	}
+
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil {
+		return SnapshotManifest{}, err
+	} else if hdr.Name != snapshotManifestName {
+		return SnapshotManifest{}, errors.New("snapshot does not begin with a manifest")
+	}
+	var m SnapshotManifest
+	if err := json.NewDecoder(io.LimitReader(tr, 1<<20)).Decode(&m); err != nil {
+		return SnapshotManifest{}, fmt.Errorf("invalid manifest: %v", err)
+	} else if m.Version != snapshotVersion {
+		return SnapshotManifest{}, fmt.Errorf("unsupported snapshot version %v", m.Version)
+	}
+	expected := make(map[string]SnapshotFile)
+	for _, sf := range m.Files {
+		expected[sf.Name] = sf
+	}
+	for _, name := range SnapshotFiles {
+		if _, ok := expected[name]; !ok {
+			return SnapshotManifest{}, fmt.Errorf("snapshot is missing %v", name)
+		}
+	}
+	if len(expected) != len(SnapshotFiles) {
+		return SnapshotManifest{}, errors.New("snapshot contains unexpected files")
+	}
+
+	// extract each database to a temporary file, and only move them into
+	// place once every hash has been verified
+	var extracted []string
+	defer func() {
+		for _, path := range extracted {
+			os.Remove(path)
+		}
+	}()
+	for len(extracted) < len(SnapshotFiles) {
+		hdr, err := tr.Next()
+		if err != nil {
+			return SnapshotManifest{}, fmt.Errorf("couldn't read snapshot: %v", err)
+		}
+		sf, ok := expected[hdr.Name]
+		if !ok {
+			return SnapshotManifest{}, fmt.Errorf("unexpected file %q in snapshot", hdr.Name)
+		}
+		delete(expected, hdr.Name)
+		path := filepath.Join(dir, filepath.FromSlash(sf.Name)) + ".snapshot"
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return SnapshotManifest{}, err
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return SnapshotManifest{}, err
+		}
+		extracted = append(extracted, path)
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(f, h), tr)
+		if err == nil {
+			err = f.Sync()
+		}
+		f.Close()
+		if err != nil {
+			return SnapshotManifest{}, err
+		} else if n != sf.Size || hex.EncodeToString(h.Sum(nil)) != sf.SHA256 {
+			return SnapshotManifest{}, fmt.Errorf("%v does not match the manifest hash", sf.Name)
+		}
+	}
+	for _, path := range extracted {
+		if err := os.Rename(path, path[:len(path)-len(".snapshot")]); err != nil {
+			return SnapshotManifest{}, err
+		}
+	}
+	extracted = nil
+	return m, nil
+}
@@ -0,0 +1,251 @@
+package walrus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+	"lukechampine.com/us/wallet"
+)
+
+// A SplitDestination is an address that receives a percentage of the funds
+// divided by a SplitRule.
+type SplitDestination struct {
+	Address types.UnlockHash `json:"address"`
+	Percent float64          `json:"percent"`
+}
+
+// A SplitRule divides the funds received by a set of source addresses among
+// several destinations, as is common for hosting collectives and mining
+// pools. Once the unspent value held by the sources reaches the threshold, the
+// Tracker emits an EventSplitReady event, and a transaction spending all of
+// the sources' outputs can be drafted from /splits/:name/draft.
+type SplitRule struct {
+	Name    string             `json:"name"`
+	Sources []types.UnlockHash `json:"sources"`
+	// The unspent value held by the sources that triggers a split.
+	Threshold types.Currency `json:"threshold"`
+	// The percentages must sum to 100. The transaction fee is deducted before
+	// the funds are divided.
+	Destinations []SplitDestination `json:"destinations"`
+	// If set, the split is executed automatically by RunSplits. Otherwise, it
+	// is only drafted, for manual review and signing.
+	Hot bool `json:"hot"`
+}
+
+// SplitReady is the data for the EventSplitReady event.
+type SplitReady struct {
+	Rule    string         `json:"rule"`
+	Outputs int            `json:"outputs"`
+	Value   types.Currency `json:"value"`
+	Hot     bool           `json:"hot"`
+}
+
+// validateSplitRule checks that r is well-formed.
+func validateSplitRule(r SplitRule) error {
+	if r.Name == "" || strings.ContainsAny(r.Name, "/?#") {
+		return errors.New("rule name must be non-empty and must not contain '/', '?', or '#'")
+	} else if len(r.Sources) == 0 {
+		return errors.New("rule must specify at least one source address")
+	} else if r.Threshold.IsZero() {
+		return errors.New("threshold must be positive")
+	} else if len(r.Destinations) == 0 {
+		return errors.New("rule must specify at least one destination")
+	}
+	var sum float64
+	for _, d := range r.Destinations {
+		if d.Percent <= 0 {
+			return errors.New("percentages must be positive")
+		}
+		sum += d.Percent
+	}
+	// allow for floating-point error, e.g. 33.3 + 33.3 + 33.4
+	if sum < 100-1e-9 || sum > 100+1e-9 {
+		return errors.New("percentages must sum to 100")
+	}
+	return nil
+}
+
+// splitOutputs divides total among dests, paying any remainder left by
+// rounding down to the last destination, so that exactly total is
+// distributed.
+func splitOutputs(dests []SplitDestination, total types.Currency) []types.SiacoinOutput {
+	outputs := make([]types.SiacoinOutput, len(dests))
+	distributed := types.ZeroCurrency
+	for i, d := range dests {
+		outputs[i] = types.SiacoinOutput{Value: percentOf(total, d.Percent), UnlockHash: d.Address}
+		distributed = distributed.Add(outputs[i].Value)
+	}
+	if last := len(outputs) - 1; last >= 0 && distributed.Cmp(total) < 0 {
+		outputs[last].Value = outputs[last].Value.Add(total.Sub(distributed))
+	}
+	return outputs
+}
+
+// splitSources returns the unspent outputs held by the sources of r that are
+// not already spent by a transaction in Limbo.
+func splitSources(w *wallet.SeedWallet, r SplitRule) []wallet.UnspentOutput {
+	isSource := make(map[types.UnlockHash]bool)
+	for _, addr := range r.Sources {
+		isSource[addr] = true
+	}
+	var outputs []wallet.UnspentOutput
+	for _, o := range w.UnspentOutputs(true) {
+		if isSource[o.UnlockHash] {
+			outputs = append(outputs, o)
+		}
+	}
+	return outputs
+}
+
+func splitReadyKey(name string) []byte {
+	return []byte("splitReady/" + name)
+}
+
+// checkSplits emits an EventSplitReady event for each rule whose sources'
+// value crosses its threshold.
+func (t *Tracker) checkSplits(tx *bolt.Tx, height types.BlockHeight, timestamp time.Time) error {
+	meta := tx.Bucket(bucketMeta)
+	return tx.Bucket(bucketSplitRules).ForEach(func(_, v []byte) error {
+		var r SplitRule
+		if err := json.Unmarshal(v, &r); err != nil {
+			return err
+		}
+		outputs := splitSources(t.w, r)
+		value := types.ZeroCurrency
+		for _, o := range outputs {
+			value = value.Add(o.Value)
+		}
+		key := splitReadyKey(r.Name)
+		if value.Cmp(r.Threshold) < 0 {
+			return meta.Delete(key)
+		} else if meta.Get(key) != nil {
+			return nil // already emitted
+		}
+		err := addEvent(tx, EventSplitReady, height, timestamp, SplitReady{
+			Rule:    r.Name,
+			Outputs: len(outputs),
+			Value:   value,
+			Hot:     r.Hot,
+		})
+		if err != nil {
+			return err
+		}
+		return meta.Put(key, []byte{1})
+	})
+}
+
+// SetSplitRule stores r, replacing any existing rule with the same name. The
+// rule's sources should already be in the wallet.
+func (t *Tracker) SetSplitRule(r SplitRule) error {
+	if err := validateSplitRule(r); err != nil {
+		return err
+	}
+	return t.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketSplitRules), []byte(r.Name), r)
+	})
+}
+
+// SplitRule returns the split rule with the specified name.
+func (t *Tracker) SplitRule(name string) (r SplitRule, ok bool) {
+	t.db.View(func(tx *bolt.Tx) error {
+		ok = getJSON(tx.Bucket(bucketSplitRules), []byte(name), &r)
+		return nil
+	})
+	return
+}
+
+// SplitRules returns all stored split rules, ordered by name.
+func (t *Tracker) SplitRules() (rs []SplitRule) {
+	t.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketSplitRules).ForEach(func(_, v []byte) error {
+			var r SplitRule
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			rs = append(rs, r)
+			return nil
+		})
+	})
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].Name < rs[j].Name
+	})
+	return
+}
+
+// RemoveSplitRule deletes the split rule with the specified name.
+func (t *Tracker) RemoveSplitRule(name string) error {
+	return t.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketSplitRules)
+		if b.Get([]byte(name)) == nil {
+			return errors.New("no split rule named " + name)
+		} else if err := tx.Bucket(bucketMeta).Delete(splitReadyKey(name)); err != nil {
+			return err
+		}
+		return b.Delete([]byte(name))
+	})
+}
+
+// A TransactionSigner signs the specified inputs of a transaction. It is
+// implemented by WalletAdapter and PolicySigner.
+type TransactionSigner interface {
+	SignTransaction(txn *types.Transaction, toSign []crypto.Hash) error
+}
+
+// ExecuteSplit drafts the split for the specified rule at the specified fee
+// (see Client.SplitDraft), signs it with s, and broadcasts it.
+func ExecuteSplit(c *Client, s TransactionSigner, rule, fee string) (types.Transaction, error) {
+	draft, err := c.SplitDraft(rule, fee)
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	txn := draft.Transaction
+	toSign := make([]crypto.Hash, len(txn.SiacoinInputs))
+	for i, in := range txn.SiacoinInputs {
+		toSign[i] = crypto.Hash(in.ParentID)
+	}
+	if err := s.SignTransaction(&txn, toSign); err != nil {
+		return types.Transaction{}, err
+	} else if _, err := c.Broadcast([]types.Transaction{txn}); err != nil {
+		return types.Transaction{}, err
+	}
+	return txn, nil
+}
+
+// RunSplits executes hot split rules as the server reports them ready,
+// signing with s, until ctx is cancelled. Events are read from w, which
+// should poll the same server as c. Errors executing individual splits are
+// passed to onError, if non-nil, and do not stop RunSplits.
+func RunSplits(ctx context.Context, w *Watcher, c *Client, s TransactionSigner, fee string, onError func(error)) error {
+	if onError == nil {
+		onError = func(error) {}
+	}
+	for {
+		events, err := w.Next(ctx)
+		for _, e := range events {
+			var sr SplitReady
+			if e.Type != EventSplitReady || json.Unmarshal(e.Data, &sr) != nil || !sr.Hot {
+				continue
+			}
+			if _, err := ExecuteSplit(c, s, sr.Rule, fee); err != nil {
+				onError(err)
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if err != nil {
+			onError(err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(w.interval):
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package walrus
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// StatementSignatureHeader is the HTTP header containing the hex-encoded
+// ed25519 signature of a statement file.
+const StatementSignatureHeader = "X-Walrus-Signature"
+
+// A Statement summarizes the siacoins entering and leaving the wallet over a
+// period.
+type Statement struct {
+	Start          time.Time         `json:"start"`
+	End            time.Time         `json:"end"`
+	Generated      time.Time         `json:"generated"`
+	Height         types.BlockHeight `json:"height"`
+	OpeningBalance types.Currency    `json:"openingBalance"`
+	TotalIn        types.Currency    `json:"totalIn"`
+	TotalOut       types.Currency    `json:"totalOut"`
+	ClosingBalance types.Currency    `json:"closingBalance"`
+	Entries        []Flow            `json:"entries"`
+}
+
+// buildStatement returns a Statement covering the flows in [start, end).
+// Flows must be ordered oldest-to-newest.
+func buildStatement(flows []Flow, start, end time.Time) Statement {
+	st := Statement{
+		Start:          start,
+		End:            end,
+		OpeningBalance: types.ZeroCurrency,
+		TotalIn:        types.ZeroCurrency,
+		TotalOut:       types.ZeroCurrency,
+	}
+	for _, f := range flows {
+		if f.Timestamp.Before(start) {
+			st.OpeningBalance = st.OpeningBalance.Add(f.Acquired)
+			if f.Disposed.Cmp(st.OpeningBalance) > 0 {
+				st.OpeningBalance = types.ZeroCurrency
+			} else {
+				st.OpeningBalance = st.OpeningBalance.Sub(f.Disposed)
+			}
+		} else if f.Timestamp.Before(end) {
+			st.TotalIn = st.TotalIn.Add(f.Acquired)
+			st.TotalOut = st.TotalOut.Add(f.Disposed)
+			st.Entries = append(st.Entries, f)
+		}
+	}
+	st.ClosingBalance = st.OpeningBalance.Add(st.TotalIn)
+	if st.TotalOut.Cmp(st.ClosingBalance) > 0 {
+		st.ClosingBalance = types.ZeroCurrency
+	} else {
+		st.ClosingBalance = st.ClosingBalance.Sub(st.TotalOut)
+	}
+	return st
+}
+
+// MarshalCSV encodes the Statement as CSV. The summary is written as a series
+// of comment-like header rows, followed by one row per entry.
+func (st Statement) MarshalCSV() []byte {
+	return st.EncodeCSV(CSVOptions{})
+}
+
+// EncodeCSV is like MarshalCSV, but formats the file according to opts. If
+// opts specifies a fiat currency, each entry includes the fiat value of its
+// inflow and outflow.
+func (st Statement) EncodeCSV(opts CSVOptions) []byte {
+	var buf bytes.Buffer
+	cw := opts.newWriter(&buf)
+	for _, row := range [][]string{
+		{"# start", opts.formatTime(st.Start)},
+		{"# end", opts.formatTime(st.End)},
+		{"# generated", opts.formatTime(st.Generated)},
+		{"# height", strconv.FormatUint(uint64(st.Height), 10)},
+		{"# opening_balance", opts.formatSC(st.OpeningBalance)},
+		{"# total_in", opts.formatSC(st.TotalIn)},
+		{"# total_out", opts.formatSC(st.TotalOut)},
+		{"# closing_balance", opts.formatSC(st.ClosingBalance)},
+	} {
+		cw.Write(row)
+	}
+	header := []string{"timestamp", "height", "id", "in", "out", "internal"}
+	if opts.Currency != "" {
+		header = append(header, "in_"+opts.Currency, "out_"+opts.Currency)
+	}
+	cw.Write(header)
+	for _, f := range st.Entries {
+		row := []string{
+			opts.formatTime(f.Timestamp),
+			strconv.FormatUint(uint64(f.BlockHeight), 10),
+			f.ID.String(),
+			opts.formatSC(f.Acquired),
+			opts.formatSC(f.Disposed),
+			strconv.FormatBool(f.Internal),
+		}
+		if opts.Currency != "" {
+			row = append(row, opts.formatFiat(f.Acquired, f.Rate), opts.formatFiat(f.Disposed, f.Rate))
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return buf.Bytes()
+}
+
+// MarshalIndentedJSON encodes the Statement as indented JSON.
+func (st Statement) MarshalIndentedJSON() []byte {
+	js, _ := json.MarshalIndent(st, "", "\t")
+	return append(js, '\n')
+}
+
+// VerifyStatement reports whether sig is a valid signature of a statement file
+// by the server with the specified public key.
+func VerifyStatement(pubkey ed25519.PublicKey, file, sig []byte) bool {
+	return len(pubkey) == ed25519.PublicKeySize && ed25519.Verify(pubkey, file, sig)
+}
@@ -0,0 +1,506 @@
+package walrus
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+	"lukechampine.com/us/wallet"
+	"lukechampine.com/walrus/api"
+)
+
+// Stream event types.
+const (
+	StreamBlockConnected      = "blockConnected"
+	StreamTransactionRelevant = "transactionRelevant"
+	StreamLimboAdded          = "limboAdded"
+	StreamReorg               = "reorg"
+)
+
+// A StreamEvent is a live notification pushed to subscribers of the event
+// stream. Unlike an Event, a StreamEvent is not stored; subscribers that are
+// disconnected miss any StreamEvents emitted in the meantime. The type of
+// Data depends on Type.
+type StreamEvent struct {
+	Type      string          `json:"type"`
+	Timestamp time.Time       `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// BlockConnected is the data for the StreamBlockConnected event.
+type BlockConnected struct {
+	ID        types.BlockID     `json:"id"`
+	Height    types.BlockHeight `json:"height"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// TransactionRelevant is the data for the StreamTransactionRelevant event,
+// emitted when a transaction relevant to the wallet is confirmed.
+type TransactionRelevant struct {
+	TransactionID types.TransactionID `json:"transactionID"`
+	BlockID       types.BlockID       `json:"blockID"`
+	Height        types.BlockHeight   `json:"height"`
+}
+
+// LimboAdded is the data for the StreamLimboAdded event.
+type LimboAdded struct {
+	TransactionID types.TransactionID `json:"transactionID"`
+}
+
+// Reorg is the data for the StreamReorg event, emitted when blocks are
+// reverted. It is followed by a StreamBlockConnected event for each block of
+// the new chain.
+type Reorg struct {
+	Reverted []types.BlockID `json:"reverted"`
+	// The height of the last block common to both chains.
+	Height types.BlockHeight `json:"height"`
+}
+
+// streamBuffer is the number of StreamEvents buffered for each subscriber.
+// Subscribers that fall further behind are disconnected.
+const streamBuffer = 256
+
+// A streamFeed delivers StreamEvents to subscribers.
+type streamFeed struct {
+	mu   sync.Mutex
+	subs map[chan StreamEvent]struct{}
+}
+
+func (f *streamFeed) subscribe() chan StreamEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subs == nil {
+		f.subs = make(map[chan StreamEvent]struct{})
+	}
+	ch := make(chan StreamEvent, streamBuffer)
+	f.subs[ch] = struct{}{}
+	return ch
+}
+
+func (f *streamFeed) unsubscribe(ch chan StreamEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.subs[ch]; ok {
+		delete(f.subs, ch)
+		close(ch)
+	}
+}
+
+func (f *streamFeed) hasSubscribers() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subs) > 0
+}
+
+func (f *streamFeed) publish(events []StreamEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subs {
+		for _, e := range events {
+			select {
+			case ch <- e:
+			default:
+				// the subscriber can't keep up
+				delete(f.subs, ch)
+				close(ch)
+			}
+			if _, ok := f.subs[ch]; !ok {
+				break
+			}
+		}
+	}
+}
+
+func newStreamEvent(typ string, data interface{}) StreamEvent {
+	js, _ := json.Marshal(data)
+	return StreamEvent{
+		Type:      typ,
+		Timestamp: time.Now(),
+		Data:      js,
+	}
+}
+
+// streamEvents returns the StreamEvents resulting from cc. The first applied
+// block is at the specified height.
+func streamEvents(tx *bolt.Tx, w *wallet.SeedWallet, cc modules.ConsensusChange, height types.BlockHeight) []StreamEvent {
+	var events []StreamEvent
+	if len(cc.RevertedBlocks) > 0 {
+		r := Reorg{
+			Reverted: make([]types.BlockID, len(cc.RevertedBlocks)),
+			Height:   height - 1,
+		}
+		for i, b := range cc.RevertedBlocks {
+			r.Reverted[i] = b.ID()
+		}
+		events = append(events, newStreamEvent(StreamReorg, r))
+	}
+	for i, b := range cc.AppliedBlocks {
+		bid := b.ID()
+		bh := height + types.BlockHeight(i)
+		events = append(events, newStreamEvent(StreamBlockConnected, BlockConnected{
+			ID:        bid,
+			Height:    bh,
+			Timestamp: time.Unix(int64(b.Timestamp), 0),
+		}))
+		for _, txn := range b.Transactions {
+			if isRelevant(tx, w, txn) {
+				events = append(events, newStreamEvent(StreamTransactionRelevant, TransactionRelevant{
+					TransactionID: txn.ID(),
+					BlockID:       bid,
+					Height:        bh,
+				}))
+			}
+		}
+	}
+	return events
+}
+
+// SubscribeStream returns a channel that receives each StreamEvent emitted by
+// the Tracker, along with a function that ends the subscription. The channel
+// is closed when the subscription ends, or if the subscriber falls too far
+// behind.
+func (t *Tracker) SubscribeStream() (<-chan StreamEvent, func()) {
+	ch := t.stream.subscribe()
+	return ch, func() { t.stream.unsubscribe(ch) }
+}
+
+// notifyLimbo emits a StreamLimboAdded event for each transaction.
+func (t *Tracker) notifyLimbo(txns []types.Transaction) {
+	events := make([]StreamEvent, len(txns))
+	for i, txn := range txns {
+		events[i] = newStreamEvent(StreamLimboAdded, LimboAdded{TransactionID: txn.ID()})
+	}
+	t.stream.publish(events)
+	t.writeJournal(events)
+}
+
+// streamKeepalive is how often a ping is sent to idle stream subscribers.
+var streamKeepalive = 30 * time.Second
+
+// serveWebSocketStream streams the Tracker's StreamEvents to a WebSocket
+// client until either side closes the connection.
+func (s *server) serveWebSocketStream(w http.ResponseWriter, req *http.Request) {
+	conn, brw, err := upgradeWebSocket(w, req, s.origins)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	events, unsubscribe := s.t.SubscribeStream()
+	defer unsubscribe()
+
+	var mu sync.Mutex // serializes writes
+	write := func(opcode byte, payload []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return writeFrame(conn, opcode, payload, false)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			opcode, payload, err := readFrame(brw, true)
+			if err != nil {
+				return
+			}
+			switch opcode {
+			case wsOpPing:
+				write(wsOpPong, payload)
+			case wsOpClose:
+				write(wsOpClose, nil)
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(streamKeepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				write(wsOpClose, nil)
+				return
+			}
+			js, _ := json.Marshal(e)
+			if write(wsOpText, js) != nil {
+				return
+			}
+		case <-ticker.C:
+			if write(wsOpPing, nil) != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// serveSSEStream streams the Tracker's StreamEvents to a client as
+// Server-Sent Events until the client disconnects. Each event's name is its
+// Type, and its data is the JSON-encoded StreamEvent.
+func (s *server) serveSSEStream(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	events, unsubscribe := s.t.SubscribeStream()
+	defer unsubscribe()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// disable buffering in reverse proxies such as nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(streamKeepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			js, _ := json.Marshal(e)
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, js); err != nil {
+				return
+			}
+		case <-ticker.C:
+			// comments are ignored by clients, but keep proxies from
+			// closing the idle connection
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-req.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// streamBackoff controls how quickly SubscribeEvents reconnects.
+var streamBackoff = RetryPolicy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+	Jitter:         0.2,
+}
+
+// dialWebSocket performs the client side of the opening handshake.
+func (c *Client) dialWebSocket(ctx context.Context, route string) (io.ReadWriteCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.addr+route, nil)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	if c.auth != "" {
+		req.Header.Set("Authorization", c.auth)
+	}
+	// the stream is long-lived, so it must not be subject to the Client's
+	// timeout
+	hc := *c.hc
+	hc.Timeout = 0
+	r, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	} else if r.StatusCode != http.StatusSwitchingProtocols {
+		msg, _ := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		return nil, &APIError{
+			StatusCode: r.StatusCode,
+			Method:     "GET",
+			Route:      req.URL.Path,
+			Message:    strings.TrimSpace(string(msg)),
+		}
+	}
+	rwc, ok := r.Body.(io.ReadWriteCloser)
+	if !ok || r.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		r.Body.Close()
+		return nil, errors.New("invalid WebSocket handshake response")
+	}
+	return rwc, nil
+}
+
+// streamWebSocket delivers the StreamEvents received over a single WebSocket
+// connection to ch. It returns when the connection fails or ctx is canceled.
+func (c *Client) streamWebSocket(ctx context.Context, ch chan<- StreamEvent, connected func()) error {
+	rwc, err := c.dialWebSocket(ctx, api.Events)
+	if err != nil {
+		return err
+	}
+	connected()
+	// unblock reads when ctx is canceled
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+		rwc.Close()
+	}()
+
+	var mu sync.Mutex // serializes writes
+	write := func(opcode byte, payload []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return writeFrame(rwc, opcode, payload, true)
+	}
+	br := bufio.NewReader(rwc)
+	for {
+		opcode, payload, err := readFrame(br, false)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		switch opcode {
+		case wsOpText:
+			var e StreamEvent
+			if err := json.Unmarshal(payload, &e); err != nil {
+				return err
+			}
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+				write(wsOpClose, nil)
+				return ctx.Err()
+			}
+		case wsOpPing:
+			write(wsOpPong, payload)
+		case wsOpClose:
+			write(wsOpClose, nil)
+			return errors.New("server closed the event stream")
+		}
+	}
+}
+
+// streamSSE delivers the StreamEvents received over a single Server-Sent
+// Events connection to ch. It returns when the connection fails or ctx is
+// canceled.
+func (c *Client) streamSSE(ctx context.Context, ch chan<- StreamEvent, connected func()) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.addr+api.EventsSSE, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if c.auth != "" {
+		req.Header.Set("Authorization", c.auth)
+	}
+	hc := *c.hc
+	hc.Timeout = 0
+	r, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(r.Body)
+		return &APIError{
+			StatusCode: r.StatusCode,
+			Method:     "GET",
+			Route:      req.URL.Path,
+			Message:    strings.TrimSpace(string(msg)),
+		}
+	}
+	connected()
+
+	s := bufio.NewScanner(r.Body)
+	s.Buffer(nil, wsMaxPayload)
+	var data []string
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case line == "":
+			// a blank line dispatches the buffered event
+			if len(data) == 0 {
+				continue
+			}
+			var e StreamEvent
+			if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &e); err != nil {
+				return err
+			}
+			data = data[:0]
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+		// other fields, and comments, are ignored
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	} else if err := s.Err(); err != nil {
+		return err
+	}
+	return errors.New("server closed the event stream")
+}
+
+// subscribeStream calls stream repeatedly, with exponential backoff, until
+// ctx is canceled, and returns the channel that stream delivers to.
+func (c *Client) subscribeStream(ctx context.Context, onError func(error), stream func(context.Context, chan<- StreamEvent, func()) error) <-chan StreamEvent {
+	ch := make(chan StreamEvent)
+	go func() {
+		defer close(ch)
+		retry := 0
+		for {
+			err := stream(ctx, ch, func() { retry = 0 })
+			if ctx.Err() != nil {
+				return
+			}
+			if onError != nil {
+				onError(err)
+			}
+			retry++
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(streamBackoff.backoff(retry)):
+			}
+		}
+	}()
+	return ch
+}
+
+// SubscribeEvents connects to the server's event stream over a WebSocket and
+// returns a channel that receives each StreamEvent as it is emitted. If the
+// connection fails, the Client reconnects automatically, with exponential
+// backoff; StreamEvents emitted while disconnected are not delivered. Each
+// connection error is passed to onError, which may be nil. The channel is
+// closed once ctx is canceled.
+//
+// StreamEvents are best-effort notifications. Use a Watcher to reliably
+// receive stored Events such as payments.
+func (c *Client) SubscribeEvents(ctx context.Context, onError func(error)) <-chan StreamEvent {
+	return c.subscribeStream(ctx, onError, c.streamWebSocket)
+}
+
+// SubscribeEventsSSE is like SubscribeEvents, but receives the event stream as
+// Server-Sent Events rather than over a WebSocket, for use where WebSockets
+// are blocked, e.g. by a proxy.
+func (c *Client) SubscribeEventsSSE(ctx context.Context, onError func(error)) <-chan StreamEvent {
+	return c.subscribeStream(ctx, onError, c.streamSSE)
+}
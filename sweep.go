@@ -0,0 +1,141 @@
+package walrus
+
+import (
+	"errors"
+	"sort"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+)
+
+// maxSweepSize is the maximum size of a signed sweep transaction. It leaves
+// some headroom below the transaction pool's limit.
+const maxSweepSize = modules.TransactionSizeLimit - 1000
+
+// A SweepBundle is a set of unsigned transactions that together send the
+// wallet's entire balance to a single address.
+type SweepBundle struct {
+	// Each request can be signed independently, e.g. by an offline signer
+	// via the air-gapped signing workflow.
+	Requests []SigningRequest `json:"requests"`
+	// The total value received by the destination, and the total fees paid.
+	Value types.Currency `json:"value"`
+	Fees  types.Currency `json:"fees"`
+	// The number of outputs left behind because they were worth less than
+	// the fee required to spend them.
+	Dust int `json:"dust"`
+}
+
+// sweepChunks divides outputs into groups whose sweep transactions, once
+// signed, are no larger than maxSize bytes. Outputs are ordered from highest
+// to lowest value, so that any dust ends up in the final groups.
+func sweepChunks(w *wallet.SeedWallet, outputs []wallet.UnspentOutput, dest types.UnlockHash, maxSize int) [][]wallet.UnspentOutput {
+	outputs = append([]wallet.UnspentOutput(nil), outputs...)
+	sort.Slice(outputs, func(i, j int) bool {
+		return outputs[i].Value.Cmp(outputs[j].Value) > 0
+	})
+	// the size of a transaction grows by a fixed amount per input and
+	// signature; the output and fee are bounded by the total value
+	total := types.ZeroCurrency
+	for _, o := range outputs {
+		total = total.Add(o.Value)
+	}
+	base := len(encoding.Marshal(types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: total, UnlockHash: dest}},
+		MinerFees:      []types.Currency{total},
+	}))
+
+	var chunks [][]wallet.UnspentOutput
+	var chunk []wallet.UnspentOutput
+	size := base
+	for _, o := range outputs {
+		info, ok := w.AddressInfo(o.UnlockHash)
+		if !ok {
+			continue
+		}
+		inputSize := signedInputSize(types.SiacoinInput{
+			ParentID:         o.ID,
+			UnlockConditions: info.UnlockConditions,
+		})
+		if len(chunk) > 0 && size+inputSize > maxSize {
+			chunks = append(chunks, chunk)
+			chunk, size = nil, base
+		}
+		chunk = append(chunk, o)
+		size += inputSize
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// draftSweepBundle returns a SweepBundle that sends outputs to dest.
+func draftSweepBundle(w *wallet.SeedWallet, outputs []wallet.UnspentOutput, dest types.UnlockHash, feePerByte types.Currency) (SweepBundle, error) {
+	sb := SweepBundle{
+		Requests: []SigningRequest{},
+		Value:    types.ZeroCurrency,
+		Fees:     types.ZeroCurrency,
+	}
+	for _, chunk := range sweepChunks(w, outputs, dest, maxSweepSize) {
+		txn, keyIndices, ok := draftConsolidation(w, chunk, dest, feePerByte)
+		if !ok {
+			sb.Dust += len(chunk)
+			continue
+		}
+		toSign := make([]crypto.Hash, len(txn.SiacoinInputs))
+		for i, in := range txn.SiacoinInputs {
+			toSign[i] = crypto.Hash(in.ParentID)
+		}
+		sb.Requests = append(sb.Requests, SigningRequest{
+			Transaction: txn,
+			ToSign:      toSign,
+			KeyIndices:  keyIndices,
+		})
+		sb.Value = sb.Value.Add(txn.SiacoinOutputs[0].Value)
+		sb.Fees = sb.Fees.Add(txn.MinerFees[0])
+	}
+	if len(sb.Requests) == 0 {
+		return SweepBundle{}, errors.New("wallet has no outputs worth more than the transaction fee")
+	}
+	return sb, nil
+}
+
+// Sweep sends the wallet's entire balance to dest, e.g. to migrate to a new
+// wallet or to move funds out of reach of a compromised key. It drafts a sweep
+// bundle at the specified fee (see SweepBundle), signs each transaction with
+// seed, and broadcasts it along with any unconfirmed parents, returning the
+// IDs of the broadcast transactions. If an error occurs, the IDs of the
+// transactions broadcast so far are returned along with the error. The seed
+// must be the seed that the wallet's addresses were derived from.
+func (c *Client) Sweep(seed wallet.Seed, dest types.UnlockHash, fee string) ([]types.TransactionID, error) {
+	sb, err := c.SweepBundle(dest, fee)
+	if err != nil {
+		return nil, err
+	}
+	txids := make([]types.TransactionID, 0, len(sb.Requests))
+	for _, sr := range sb.Requests {
+		txn := sr.Transaction
+		for i, id := range sr.ToSign {
+			sig := wallet.StandardTransactionSignature(id)
+			wallet.AppendTransactionSignature(&txn, sig, seed.SecretKey(sr.KeyIndices[i]))
+		}
+		parents, err := c.UnconfirmedParents(txn)
+		if err != nil {
+			return txids, err
+		}
+		txnSet := make([]types.Transaction, 0, len(parents)+1)
+		for _, p := range parents {
+			txnSet = append(txnSet, p.Transaction)
+		}
+		txnSet = append(txnSet, txn)
+		if _, err := c.Broadcast(txnSet); err != nil {
+			return txids, err
+		}
+		txids = append(txids, txn.ID())
+	}
+	return txids, nil
+}
@@ -0,0 +1,220 @@
+package walrus
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+	"lukechampine.com/us/wallet"
+)
+
+// A TemplateRecipient is an output of a TransactionTemplate. Exactly one of
+// Amount and Percent must be set.
+type TemplateRecipient struct {
+	Address types.UnlockHash `json:"address"`
+	// A fixed amount, in hastings.
+	Amount types.Currency `json:"amount"`
+	// A percentage of the total specified when the template is built.
+	Percent float64 `json:"percent"`
+}
+
+// A TransactionTemplate describes a recurring transaction, such as a revenue
+// split between cold storage and an operating wallet.
+type TransactionTemplate struct {
+	Name       string              `json:"name"`
+	Recipients []TemplateRecipient `json:"recipients"`
+	// The address that change is sent to, unless overridden when the
+	// template is built.
+	ChangeAddress types.UnlockHash `json:"changeAddress"`
+	// The memo attached to each built transaction. The placeholders {name},
+	// {date}, {time}, and {total} are replaced with the template name, the
+	// current UTC date and time, and the total paid to the recipients in SC;
+	// any other {key} is replaced with the corresponding variable supplied
+	// when the template is built.
+	Memo string `json:"memo"`
+}
+
+// usesPercent reports whether any of the template's recipients receive a
+// percentage of the total.
+func (tt TransactionTemplate) usesPercent() bool {
+	for _, r := range tt.Recipients {
+		if r.Percent > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// validateTemplate checks that tt is well-formed.
+func validateTemplate(tt TransactionTemplate) error {
+	if tt.Name == "" || strings.ContainsAny(tt.Name, "/?#") {
+		return errors.New("template name must be non-empty and must not contain '/', '?', or '#'")
+	} else if len(tt.Recipients) == 0 {
+		return errors.New("template must specify at least one recipient")
+	}
+	var sum float64
+	for _, r := range tt.Recipients {
+		if r.Amount.IsZero() == (r.Percent == 0) {
+			return errors.New("each recipient must specify exactly one of amount and percent")
+		} else if r.Percent < 0 || r.Percent > 100 {
+			return errors.New("percentages must be between 0 and 100")
+		}
+		sum += r.Percent
+	}
+	if sum > 100 {
+		return errors.New("percentages sum to more than 100")
+	}
+	return nil
+}
+
+// percentOf returns the specified percentage of c, rounded down.
+func percentOf(c types.Currency, percent float64) types.Currency {
+	// parse the shortest decimal representation, so that e.g. 33.3 is exact
+	share, _ := new(big.Rat).SetString(strconv.FormatFloat(percent, 'f', -1, 64))
+	share.Mul(share, new(big.Rat).SetFrac(c.Big(), big.NewInt(100)))
+	return types.NewCurrency(new(big.Int).Quo(share.Num(), share.Denom()))
+}
+
+// templateOutputs returns the outputs paying the recipients of tt, with
+// percentages taken of total. If the percentages sum to 100, any remainder
+// left by rounding down is paid to the last percentage recipient, so that
+// exactly total is distributed.
+func templateOutputs(tt TransactionTemplate, total types.Currency) []types.SiacoinOutput {
+	outputs := make([]types.SiacoinOutput, len(tt.Recipients))
+	distributed := types.ZeroCurrency
+	last := -1
+	var sum float64
+	for i, r := range tt.Recipients {
+		outputs[i] = types.SiacoinOutput{Value: r.Amount, UnlockHash: r.Address}
+		if r.Percent > 0 {
+			outputs[i].Value = percentOf(total, r.Percent)
+			distributed = distributed.Add(outputs[i].Value)
+			last = i
+			sum += r.Percent
+		}
+	}
+	if sum == 100 && distributed.Cmp(total) < 0 {
+		outputs[last].Value = outputs[last].Value.Add(total.Sub(distributed))
+	}
+	return outputs
+}
+
+// expandMemo replaces the placeholders in tt's memo.
+func expandMemo(tt TransactionTemplate, total types.Currency, vars map[string]string, now time.Time) string {
+	now = now.UTC()
+	oldnew := []string{
+		"{name}", tt.Name,
+		"{date}", now.Format("2006-01-02"),
+		"{time}", now.Format("15:04:05"),
+		"{total}", formatSC(total),
+	}
+	for k, v := range vars {
+		oldnew = append(oldnew, "{"+k+"}", v)
+	}
+	return strings.NewReplacer(oldnew...).Replace(tt.Memo)
+}
+
+// draftTemplate returns an unsigned transaction that pays outputs and any
+// change to changeAddr, funded by candidates selected according to strategy,
+// along with the key index of each input. extraFee is added to the fee, e.g.
+// to pay for elements of the transaction that the caller adds later. If dust
+// is non-nil and the transaction returns change, dust among the remaining
+// candidates is also spent, per the policy.
+func draftTemplate(w *wallet.SeedWallet, candidates []coinInput, strategy string, outputs []types.SiacoinOutput, changeAddr types.UnlockHash, feePerByte, extraFee types.Currency, dust *DustPolicy) (txn types.Transaction, keyIndices []uint64, err error) {
+	amount := extraFee
+	for _, o := range outputs {
+		amount = amount.Add(o.Value)
+	}
+	used, fee, change, ok := selectCoins(strategy, amount, feePerByte, candidates)
+	if !ok {
+		return types.Transaction{}, nil, errors.New("insufficient funds")
+	}
+	fee = fee.Add(extraFee)
+	if dust != nil && !change.IsZero() && changeAddr != (types.UnlockHash{}) {
+		isUsed := make(map[types.SiacoinOutputID]bool, len(used))
+		for _, in := range used {
+			isUsed[in.ParentID] = true
+		}
+		var unused []wallet.ValuedInput
+		for _, c := range candidates {
+			if !isUsed[c.ParentID] {
+				unused = append(unused, c.ValuedInput)
+			}
+		}
+		extra, value, extraFee := selectDust(*dust, unused, feePerByte)
+		used = append(used, extra...)
+		change = change.Add(value).Sub(extraFee)
+		fee = fee.Add(extraFee)
+	}
+	txn.SiacoinOutputs = append(txn.SiacoinOutputs, outputs...)
+	if !change.IsZero() {
+		if changeAddr == (types.UnlockHash{}) {
+			return types.Transaction{}, nil, errors.New("no change address specified")
+		}
+		txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{
+			Value:      change,
+			UnlockHash: changeAddr,
+		})
+	}
+	for _, in := range used {
+		info, _ := w.AddressInfo(in.UnlockConditions.UnlockHash())
+		txn.SiacoinInputs = append(txn.SiacoinInputs, in.SiacoinInput)
+		keyIndices = append(keyIndices, info.KeyIndex)
+	}
+	txn.MinerFees = []types.Currency{fee}
+	return txn, keyIndices, nil
+}
+
+// SetTemplate stores tt, replacing any existing template with the same name.
+func (t *Tracker) SetTemplate(tt TransactionTemplate) error {
+	if err := validateTemplate(tt); err != nil {
+		return err
+	}
+	return t.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketTemplates), []byte(tt.Name), tt)
+	})
+}
+
+// Template returns the template with the specified name.
+func (t *Tracker) Template(name string) (tt TransactionTemplate, ok bool) {
+	t.db.View(func(tx *bolt.Tx) error {
+		ok = getJSON(tx.Bucket(bucketTemplates), []byte(name), &tt)
+		return nil
+	})
+	return
+}
+
+// Templates returns all stored templates, ordered by name.
+func (t *Tracker) Templates() (tts []TransactionTemplate) {
+	t.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketTemplates).ForEach(func(_, v []byte) error {
+			var tt TransactionTemplate
+			if err := json.Unmarshal(v, &tt); err != nil {
+				return err
+			}
+			tts = append(tts, tt)
+			return nil
+		})
+	})
+	sort.Slice(tts, func(i, j int) bool {
+		return tts[i].Name < tts[j].Name
+	})
+	return
+}
+
+// RemoveTemplate deletes the template with the specified name.
+func (t *Tracker) RemoveTemplate(name string) error {
+	return t.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketTemplates)
+		if b.Get([]byte(name)) == nil {
+			return errors.New("no template named " + name)
+		}
+		return b.Delete([]byte(name))
+	})
+}
@@ -0,0 +1,60 @@
+package walrus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+)
+
+// loadCertPool loads a bundle of PEM-encoded CA certificates.
+func loadCertPool(filename string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in " + filename)
+	}
+	return pool, nil
+}
+
+// LoadClientTLSConfig returns a TLS configuration, suitable for WithTLSConfig,
+// that presents the certificate and key in the specified PEM files to the
+// server, and verifies the server against the CA certificates in caFile. If
+// certFile and keyFile are empty, no client certificate is presented; if
+// caFile is empty, the system's root CAs are used.
+func LoadClientTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cfg := new(tls.Config)
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// LoadServerTLSConfig returns a TLS configuration for a server that requires
+// clients to present a certificate signed by one of the CA certificates in
+// clientCAFile. The server's own certificate must be supplied separately, e.g.
+// via http.Server.ListenAndServeTLS.
+func LoadServerTLSConfig(clientCAFile string) (*tls.Config, error) {
+	pool, err := loadCertPool(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+	}, nil
+}
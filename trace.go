@@ -0,0 +1,96 @@
+package walrus
+
+import (
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+)
+
+// Output sources.
+const (
+	OutputSourceTransaction = "transaction"
+	OutputSourceBlockReward = "blockReward"
+	// The output was not created within the wallet's history, e.g. it was
+	// created by a counterparty's transaction spending their own outputs.
+	OutputSourceExternal = "external"
+)
+
+// An OutputTrace describes the origin of a siacoin output.
+type OutputTrace struct {
+	ID         types.SiacoinOutputID `json:"id"`
+	Value      types.Currency        `json:"value"`
+	UnlockHash types.UnlockHash      `json:"unlockHash"`
+	Source     string                `json:"source"`
+	// The number of generations between this output and the traced output.
+	Depth int `json:"depth"`
+	// For outputs created by transactions, the creating transaction and the
+	// outputs it spent.
+	TransactionID types.TransactionID     `json:"transactionID,omitempty"`
+	BlockHeight   types.BlockHeight       `json:"blockHeight"`
+	Parents       []types.SiacoinOutputID `json:"parents,omitempty"`
+}
+
+// traceOutput walks the ancestry of the specified output through the wallet's
+// history, breadth-first, stopping after maxDepth generations. The first
+// element of the returned trace is the output itself.
+func traceOutput(w *wallet.SeedWallet, id types.SiacoinOutputID, maxDepth int) []OutputTrace {
+	// index the outputs created within the wallet's history
+	type origin struct {
+		txn   wallet.Transaction
+		index int
+	}
+	created := make(map[types.SiacoinOutputID]origin)
+	for _, txid := range w.Transactions(-1) {
+		txn, ok := w.Transaction(txid)
+		if !ok {
+			continue
+		}
+		for i := range txn.SiacoinOutputs {
+			created[txn.SiacoinOutputID(uint64(i))] = origin{txn, i}
+		}
+	}
+	rewards := make(map[types.SiacoinOutputID]wallet.BlockReward)
+	for _, br := range w.BlockRewards(-1) {
+		rewards[br.ID] = br
+	}
+
+	type hop struct {
+		id    types.SiacoinOutputID
+		depth int
+		// the unlock conditions of an input spending this output, if known
+		addr types.UnlockHash
+	}
+	var trace []OutputTrace
+	seen := map[types.SiacoinOutputID]bool{id: true}
+	queue := []hop{{id: id}}
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+		ot := OutputTrace{
+			ID:         h.id,
+			Value:      types.ZeroCurrency,
+			UnlockHash: h.addr,
+			Source:     OutputSourceExternal,
+			Depth:      h.depth,
+		}
+		if o, ok := created[h.id]; ok {
+			sco := o.txn.SiacoinOutputs[o.index]
+			ot.Value, ot.UnlockHash = sco.Value, sco.UnlockHash
+			ot.Source = OutputSourceTransaction
+			ot.TransactionID = o.txn.ID()
+			ot.BlockHeight = o.txn.BlockHeight
+			for _, sci := range o.txn.SiacoinInputs {
+				ot.Parents = append(ot.Parents, sci.ParentID)
+				if h.depth < maxDepth && !seen[sci.ParentID] {
+					seen[sci.ParentID] = true
+					queue = append(queue, hop{sci.ParentID, h.depth + 1, sci.UnlockConditions.UnlockHash()})
+				}
+			}
+		} else if br, ok := rewards[h.id]; ok {
+			ot.Value, ot.UnlockHash = br.Value, br.UnlockHash
+			ot.Source = OutputSourceBlockReward
+			ot.BlockHeight = br.Timelock - types.MaturityDelay
+		}
+		trace = append(trace, ot)
+	}
+	return trace
+}
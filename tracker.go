@@ -0,0 +1,673 @@
+package walrus
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+	"lukechampine.com/us/wallet"
+)
+
+// contractWarningBlocks is how many blocks in advance the Tracker warns about
+// file contract windows.
+const contractWarningBlocks = 144
+
+var (
+	bucketMeta              = []byte("meta")
+	bucketSiafunds          = []byte("siafunds")
+	bucketEvents            = []byte("events")
+	bucketContractWarnings  = []byte("contractWarnings")
+	bucketDeposits          = []byte("deposits")
+	bucketPayments          = []byte("payments")
+	bucketPendingPayments   = []byte("pendingPayments")
+	bucketOutputs           = []byte("outputs")
+	bucketFlows             = []byte("flows")
+	bucketContractOutcomes  = []byte("contractOutcomes")
+	bucketPushDevices       = []byte("pushDevices")
+	bucketLimboSets         = []byte("limboSets")
+	bucketPublicKeys        = []byte("publicKeys")
+	bucketAnnotationQueue   = []byte("annotationQueue")
+	bucketAnnotations       = []byte("annotations")
+	bucketChangeOutputs     = []byte("changeOutputs")
+	bucketWithdrawals       = []byte("withdrawals")
+	bucketTemplates         = []byte("templates")
+	bucketSplitRules        = []byte("splitRules")
+	bucketOutputMetadata    = []byte("outputMetadata")
+	bucketOutputHeights     = []byte("outputHeights")
+	bucketPostings          = []byte("postings")
+	bucketActivePostings    = []byte("activePostings")
+	bucketPostingCCIDs      = []byte("postingCCIDs")
+	bucketPendingBroadcasts = []byte("pendingBroadcasts")
+	bucketConfirmations     = []byte("confirmations")
+	bucketReplacements      = []byte("replacements")
+	bucketAddressLabels     = []byte("addressLabels")
+
+	keyCCID        = []byte("ccid")
+	keyNumBlocks   = []byte("numBlocks")
+	keySiafundPool = []byte("siafundPool")
+	keyReadyProbe  = []byte("readyProbe")
+)
+
+func getJSON(b *bolt.Bucket, key []byte, v interface{}) bool {
+	js := b.Get(key)
+	return js != nil && json.Unmarshal(js, v) == nil
+}
+
+func putJSON(b *bolt.Bucket, key []byte, v interface{}) error {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, js)
+}
+
+// A SiafundOutput is a siafund output that is, or was, owned by the wallet.
+type SiafundOutput struct {
+	ID          types.SiafundOutputID `json:"id"`
+	Value       types.Currency        `json:"value"`
+	UnlockHash  types.UnlockHash      `json:"unlockHash"`
+	ClaimStart  types.Currency        `json:"claimStart"`
+	BlockHeight types.BlockHeight     `json:"blockHeight"`
+	Spent       bool                  `json:"spent"`
+	SpentHeight types.BlockHeight     `json:"spentHeight,omitempty"`
+	// The claim paid out when the output was spent. Zero if the output is
+	// unspent.
+	RealizedClaim types.Currency `json:"realizedClaim"`
+}
+
+// ClaimAt returns the claim that the output would receive if it were spent
+// when the siafund pool had the specified value.
+func (sfo SiafundOutput) ClaimAt(pool types.Currency) types.Currency {
+	if pool.Cmp(sfo.ClaimStart) <= 0 {
+		return types.ZeroCurrency
+	}
+	return pool.Sub(sfo.ClaimStart).Div(types.SiafundCount).Mul(sfo.Value)
+}
+
+// A Deposit is an address that was provisioned on behalf of an external
+// reference, such as an exchange customer.
+type Deposit struct {
+	Reference   string            `json:"reference"`
+	Address     types.UnlockHash  `json:"address"`
+	KeyIndex    uint64            `json:"keyIndex"`
+	BlockHeight types.BlockHeight `json:"blockHeight"`
+	// The number of confirmations required before a payment to the address
+	// is considered final. If zero, defaultConfirmations are required.
+	Confirmations uint64 `json:"confirmations"`
+	// The amount the depositor is expected to send, and the time after which
+	// the deposit should no longer be used. Both are optional.
+	Amount types.Currency `json:"amount"`
+	Expiry time.Time      `json:"expiry"`
+	// If set, outputs sent to the address are locked under
+	// DepositLockID(Reference) for ReserveDuration when they are first
+	// detected in Limbo, before they confirm. Requires Amount.
+	Reserve         bool   `json:"reserve,omitempty"`
+	ReserveDuration string `json:"reserveDuration,omitempty"`
+	// If set, events relating to the deposit are posted to Callback, signed
+	// with CallbackSecret. See SignCallback.
+	Callback       string `json:"callback,omitempty"`
+	CallbackSecret string `json:"callbackSecret,omitempty"`
+}
+
+// Payment states.
+const (
+	PaymentConfirming = "confirming"
+	PaymentFinal      = "final"
+	PaymentReverted   = "reverted"
+)
+
+// A Payment is an output sent to a deposit address. A payment starts out
+// confirming, and becomes final once it has the number of confirmations
+// required by its deposit. If the block containing the payment is reverted,
+// the payment is marked as reverted; if it later reappears in the blockchain,
+// it will begin confirming again.
+type Payment struct {
+	Reference     string                `json:"reference"`
+	Address       types.UnlockHash      `json:"address"`
+	TransactionID types.TransactionID   `json:"transactionID"`
+	OutputID      types.SiacoinOutputID `json:"outputID"`
+	Value         types.Currency        `json:"value"`
+	BlockHeight   types.BlockHeight     `json:"blockHeight"`
+	Confirmations uint64                `json:"confirmations"`
+	Required      uint64                `json:"required"`
+	State         string                `json:"state"`
+}
+
+// A Tracker indexes chain data that is relevant to a wallet, but is not tracked
+// by the wallet itself, such as siafund outputs. The Tracker relies on the
+// wallet to determine which addresses are relevant, so it must be subscribed to
+// the consensus set after the wallet.
+type Tracker struct {
+	w        *wallet.SeedWallet
+	db       *bolt.DB
+	rates    RateProvider
+	currency string
+
+	consolidation *ConsolidationPolicy
+	lookahead     uint64
+	vault         *VaultPolicy
+	dust          *DustPolicy
+	alerts        *alertState
+
+	push       map[string]PushSender
+	pushSignal chan struct{}
+
+	callbackSignal chan struct{}
+
+	annotator      Annotator
+	annotateSignal chan struct{}
+
+	leader Leader
+
+	stream streamFeed
+
+	journalMu    sync.Mutex
+	journal      *Journal
+	journalError func(error)
+
+	closed chan struct{}
+}
+
+// ConsensusChangeID returns the ID of the last consensus change processed by
+// the Tracker.
+func (t *Tracker) ConsensusChangeID() (ccid modules.ConsensusChangeID) {
+	t.db.View(func(tx *bolt.Tx) error {
+		copy(ccid[:], tx.Bucket(bucketMeta).Get(keyCCID))
+		return nil
+	})
+	return
+}
+
+// checkWritable returns an error if the Tracker's database cannot be
+// written to.
+func (t *Tracker) checkWritable() error {
+	return t.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketMeta), keyReadyProbe, time.Now())
+	})
+}
+
+// checkContracts emits warnings for file contracts whose proof windows are
+// about to start or end. Each warning is emitted at most once per contract.
+func (t *Tracker) checkContracts(tx *bolt.Tx, height types.BlockHeight, timestamp time.Time) error {
+	warned := tx.Bucket(bucketContractWarnings)
+	for _, fc := range t.w.FileContracts(-1) {
+		deadlines := []struct {
+			event  string
+			height types.BlockHeight
+		}{
+			{EventFileContractWindowStarting, fc.WindowStart},
+			{EventFileContractWindowEnding, fc.WindowEnd},
+		}
+		for _, d := range deadlines {
+			if height >= d.height || d.height-height > contractWarningBlocks {
+				continue
+			}
+			key := append(fc.ID[:], d.event...)
+			if warned.Get(key) != nil {
+				continue
+			}
+			err := addEvent(tx, d.event, height, timestamp, FileContractWarning{
+				ID:              fc.ID,
+				WindowStart:     fc.WindowStart,
+				WindowEnd:       fc.WindowEnd,
+				BlocksRemaining: d.height - height,
+			})
+			if err != nil {
+				return err
+			} else if err := warned.Put(key, []byte{1}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// attributeDeposits emits an event for each output in txn that was sent to a
+// deposit address, and begins tracking its confirmations.
+func (t *Tracker) attributeDeposits(tx *bolt.Tx, txn types.Transaction, height types.BlockHeight, timestamp time.Time) error {
+	deposits := tx.Bucket(bucketDeposits)
+	for i, sco := range txn.SiacoinOutputs {
+		var d Deposit
+		if !getJSON(deposits, sco.UnlockHash[:], &d) {
+			continue
+		}
+		p := Payment{
+			Reference:     d.Reference,
+			Address:       d.Address,
+			TransactionID: txn.ID(),
+			OutputID:      txn.SiacoinOutputID(uint64(i)),
+			Value:         sco.Value,
+			BlockHeight:   height,
+			Required:      d.Confirmations,
+			State:         PaymentConfirming,
+		}
+		err := addEvent(tx, EventDepositReceived, height, timestamp, DepositReceipt{
+			Reference:     p.Reference,
+			Address:       p.Address,
+			TransactionID: p.TransactionID,
+			OutputID:      p.OutputID,
+			Value:         p.Value,
+		})
+		if err != nil {
+			return err
+		} else if err := putJSON(tx.Bucket(bucketPayments), p.OutputID[:], p); err != nil {
+			return err
+		} else if err := tx.Bucket(bucketPendingPayments).Put(p.OutputID[:], []byte{1}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revertDeposits marks any payments in txn as reverted.
+func (t *Tracker) revertDeposits(tx *bolt.Tx, txn types.Transaction, height types.BlockHeight, timestamp time.Time) error {
+	payments := tx.Bucket(bucketPayments)
+	for i := range txn.SiacoinOutputs {
+		id := txn.SiacoinOutputID(uint64(i))
+		var p Payment
+		if !getJSON(payments, id[:], &p) {
+			continue
+		}
+		p.State = PaymentReverted
+		p.Confirmations = 0
+		if err := addEvent(tx, EventPaymentReverted, height, timestamp, p); err != nil {
+			return err
+		} else if err := putJSON(payments, id[:], p); err != nil {
+			return err
+		} else if err := tx.Bucket(bucketPendingPayments).Delete(id[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updatePayments advances the confirmation count of each pending payment,
+// emitting an event for each transition.
+func (t *Tracker) updatePayments(tx *bolt.Tx, height types.BlockHeight, timestamp time.Time) error {
+	payments := tx.Bucket(bucketPayments)
+	pending := tx.Bucket(bucketPendingPayments)
+	var final [][]byte
+	err := pending.ForEach(func(id, _ []byte) error {
+		var p Payment
+		if !getJSON(payments, id, &p) {
+			return nil
+		}
+		confs := uint64(height-p.BlockHeight) + 1
+		if confs == p.Confirmations {
+			return nil
+		}
+		p.Confirmations = confs
+		event := EventPaymentConfirming
+		if p.Confirmations >= p.Required {
+			p.State = PaymentFinal
+			event = EventPaymentFinal
+			final = append(final, id)
+		}
+		if err := addEvent(tx, event, height, timestamp, p); err != nil {
+			return err
+		}
+		return putJSON(payments, id, p)
+	})
+	if err != nil {
+		return err
+	}
+	// can't modify a bucket while iterating over it
+	for _, id := range final {
+		if err := pending.Delete(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProcessConsensusChange implements modules.ConsensusSetSubscriber.
+func (t *Tracker) ProcessConsensusChange(cc modules.ConsensusChange) {
+	rate := t.currentRate(cc.Synced)
+	var stream []StreamEvent
+	err := t.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(bucketMeta)
+		var numBlocks uint64
+		getJSON(meta, keyNumBlocks, &numBlocks)
+
+		// determine the height at which siafund outputs were created and spent
+		created := make(map[types.SiafundOutputID]types.BlockHeight)
+		spent := make(map[types.SiafundOutputID]types.BlockHeight)
+		for i, b := range cc.RevertedBlocks {
+			height := types.BlockHeight(numBlocks - uint64(i) - 1)
+			for _, txn := range b.Transactions {
+				if err := t.revertDeposits(tx, txn, height, time.Unix(int64(b.Timestamp), 0)); err != nil {
+					return err
+				}
+			}
+			if err := t.revertFlows(tx, height); err != nil {
+				return err
+			} else if err := t.revertPostings(tx, height); err != nil {
+				return err
+			}
+		}
+		numBlocks -= uint64(len(cc.RevertedBlocks))
+		if err := t.applyFlows(tx, cc, types.BlockHeight(numBlocks), rate); err != nil {
+			return err
+		} else if err := t.applyPostings(tx, cc, types.BlockHeight(numBlocks)); err != nil {
+			return err
+		} else if err := t.recordOutcomes(tx, cc, types.BlockHeight(numBlocks)); err != nil {
+			return err
+		} else if err := t.queueAnnotations(tx, cc, types.BlockHeight(numBlocks)); err != nil {
+			return err
+		} else if err := t.recordChange(tx, cc); err != nil {
+			return err
+		} else if err := t.recordOutputHeights(tx, cc, types.BlockHeight(numBlocks)); err != nil {
+			return err
+		} else if err := t.recordConfirmations(tx, cc, types.BlockHeight(numBlocks)); err != nil {
+			return err
+		}
+		if t.stream.hasSubscribers() || t.journaling() {
+			stream = streamEvents(tx, t.w, cc, types.BlockHeight(numBlocks))
+		}
+		for _, b := range cc.AppliedBlocks {
+			height := types.BlockHeight(numBlocks)
+			for _, txn := range b.Transactions {
+				for i := range txn.SiafundOutputs {
+					created[txn.SiafundOutputID(uint64(i))] = height
+				}
+				for _, sfi := range txn.SiafundInputs {
+					spent[sfi.ParentID] = height
+				}
+				if err := t.attributeDeposits(tx, txn, height, time.Unix(int64(b.Timestamp), 0)); err != nil {
+					return err
+				}
+			}
+			numBlocks++
+		}
+		// spending a siafund output creates a delayed claim output
+		claims := make(map[types.SiacoinOutputID]types.Currency)
+		for _, diff := range cc.DelayedSiacoinOutputDiffs {
+			if diff.Direction == modules.DiffApply {
+				claims[diff.ID] = diff.SiacoinOutput.Value
+			}
+		}
+
+		sfb := tx.Bucket(bucketSiafunds)
+		for _, diff := range cc.SiafundOutputDiffs {
+			var sfo SiafundOutput
+			exists := getJSON(sfb, diff.ID[:], &sfo)
+			if diff.Direction == modules.DiffApply {
+				// output was either created, or its spend was reverted
+				if !exists {
+					if !t.w.OwnsAddress(diff.SiafundOutput.UnlockHash) {
+						continue
+					}
+					sfo = SiafundOutput{
+						ID:         diff.ID,
+						Value:      diff.SiafundOutput.Value,
+						UnlockHash: diff.SiafundOutput.UnlockHash,
+						ClaimStart: diff.SiafundOutput.ClaimStart,
+					}
+				}
+				if height, ok := created[diff.ID]; ok {
+					sfo.BlockHeight = height
+				}
+				sfo.Spent = false
+				sfo.SpentHeight = 0
+				sfo.RealizedClaim = types.ZeroCurrency
+				if err := putJSON(sfb, diff.ID[:], sfo); err != nil {
+					return err
+				}
+			} else if exists {
+				// output was either spent, or its creation was reverted
+				if height, ok := spent[diff.ID]; ok {
+					sfo.Spent = true
+					sfo.SpentHeight = height
+					sfo.RealizedClaim = claims[diff.ID.SiaClaimOutputID()]
+					if err := putJSON(sfb, diff.ID[:], sfo); err != nil {
+						return err
+					}
+				} else if err := sfb.Delete(diff.ID[:]); err != nil {
+					return err
+				}
+			}
+		}
+
+		pool := types.ZeroCurrency
+		getJSON(meta, keySiafundPool, &pool)
+		for _, diff := range cc.SiafundPoolDiffs {
+			if diff.Direction == modules.DiffApply {
+				pool = diff.Adjusted
+			} else {
+				pool = diff.Previous
+			}
+		}
+
+		if numBlocks > 0 && len(cc.AppliedBlocks) > 0 {
+			tip := cc.AppliedBlocks[len(cc.AppliedBlocks)-1]
+			if err := t.updatePayments(tx, types.BlockHeight(numBlocks-1), time.Unix(int64(tip.Timestamp), 0)); err != nil {
+				return err
+			}
+		}
+
+		if t.consolidation != nil && cc.Synced && numBlocks > 0 && len(cc.AppliedBlocks) > 0 {
+			tip := cc.AppliedBlocks[len(cc.AppliedBlocks)-1]
+			if err := t.checkConsolidation(tx, types.BlockHeight(numBlocks-1), time.Unix(int64(tip.Timestamp), 0)); err != nil {
+				return err
+			}
+		}
+
+		if cc.Synced && numBlocks > 0 && len(cc.AppliedBlocks) > 0 {
+			tip := cc.AppliedBlocks[len(cc.AppliedBlocks)-1]
+			if err := t.checkSplits(tx, types.BlockHeight(numBlocks-1), time.Unix(int64(tip.Timestamp), 0)); err != nil {
+				return err
+			}
+		}
+
+		// only emit warnings once we've caught up to the current height;
+		// otherwise, we'd warn about every historical contract
+		if cc.Synced && numBlocks > 0 && len(cc.AppliedBlocks) > 0 {
+			tip := cc.AppliedBlocks[len(cc.AppliedBlocks)-1]
+			timestamp := time.Unix(int64(tip.Timestamp), 0)
+			if err := t.checkContracts(tx, types.BlockHeight(numBlocks-1), timestamp); err != nil {
+				return err
+			}
+		}
+
+		// the wallet has already removed any newly-confirmed transactions
+		// from Limbo
+		if err := t.pruneLimboSets(tx); err != nil {
+			return err
+		} else if err := t.markUsed(tx, cc); err != nil {
+			return err
+		}
+
+		if err := putJSON(meta, keySiafundPool, pool); err != nil {
+			return err
+		} else if err := putJSON(meta, keyNumBlocks, numBlocks); err != nil {
+			return err
+		}
+		return meta.Put(keyCCID, cc.ID[:])
+	})
+	if err != nil {
+		panic(err)
+	}
+	t.stream.publish(stream)
+	t.writeJournal(stream)
+	t.extendLookahead()
+	t.notifyPush()
+	t.notifyCallbacks()
+	t.notifyAnnotate()
+	t.checkAlerts(cc)
+}
+
+// SiafundOutputs returns every siafund output that is, or was, owned by the
+// wallet.
+func (t *Tracker) SiafundOutputs() (sfos []SiafundOutput) {
+	t.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketSiafunds).ForEach(func(_, v []byte) error {
+			var sfo SiafundOutput
+			if err := json.Unmarshal(v, &sfo); err != nil {
+				return err
+			}
+			sfos = append(sfos, sfo)
+			return nil
+		})
+	})
+	return
+}
+
+// SiafundPool returns the current value of the siafund pool.
+func (t *Tracker) SiafundPool() (pool types.Currency) {
+	t.db.View(func(tx *bolt.Tx) error {
+		getJSON(tx.Bucket(bucketMeta), keySiafundPool, &pool)
+		return nil
+	})
+	return
+}
+
+// defaultConfirmations is the number of confirmations required for a deposit
+// payment to be considered final, if the deposit does not specify otherwise.
+const defaultConfirmations = 6
+
+// AddDeposit records a deposit address. Future outputs sent to the address
+// will be attributed to the deposit's reference.
+func (t *Tracker) AddDeposit(d Deposit) error {
+	if d.Confirmations == 0 {
+		d.Confirmations = defaultConfirmations
+	}
+	return t.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketDeposits), d.Address[:], d)
+	})
+}
+
+// Deposit returns the deposit with the specified address.
+func (t *Tracker) Deposit(addr types.UnlockHash) (d Deposit, ok bool) {
+	t.db.View(func(tx *bolt.Tx) error {
+		ok = getJSON(tx.Bucket(bucketDeposits), addr[:], &d)
+		return nil
+	})
+	return
+}
+
+// Deposits returns the deposits with the specified reference. If reference is
+// empty, all deposits are returned.
+func (t *Tracker) Deposits(reference string) (deposits []Deposit) {
+	t.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketDeposits).ForEach(func(_, v []byte) error {
+			var d Deposit
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			if reference == "" || d.Reference == reference {
+				deposits = append(deposits, d)
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// Payments returns the payments made to deposits with the specified reference.
+// If reference is empty, all payments are returned.
+func (t *Tracker) Payments(reference string) (payments []Payment) {
+	t.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPayments).ForEach(func(_, v []byte) error {
+			var p Payment
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+			if reference == "" || p.Reference == reference {
+				payments = append(payments, p)
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// Events returns the most recent events emitted by the Tracker. If max < 0,
+// all events are returned; otherwise, at most max events are returned. The
+// events are ordered newest-to-oldest.
+func (t *Tracker) Events(max int) (events []Event) {
+	t.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketEvents).Cursor()
+		for k, v := c.Last(); k != nil && len(events) != max; k, v = c.Prev() {
+			var e Event
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+		return nil
+	})
+	return
+}
+
+// Close closes the Tracker's database.
+func (t *Tracker) Close() error {
+	close(t.closed)
+	return t.db.Close()
+}
+
+// NewTracker returns a Tracker for w that stores its data in the specified
+// file. The file is created if it does not already exist.
+func NewTracker(w *wallet.SeedWallet, filename string) (*Tracker, error) {
+	db, err := bolt.Open(filename, 0660, &bolt.Options{Timeout: 3 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{
+			bucketMeta,
+			bucketSiafunds,
+			bucketEvents,
+			bucketContractWarnings,
+			bucketDeposits,
+			bucketPayments,
+			bucketPendingPayments,
+			bucketOutputs,
+			bucketFlows,
+			bucketContractOutcomes,
+			bucketPushDevices,
+			bucketLimboSets,
+			bucketPublicKeys,
+			bucketAnnotationQueue,
+			bucketAnnotations,
+			bucketChangeOutputs,
+			bucketWithdrawals,
+			bucketTemplates,
+			bucketSplitRules,
+			bucketOutputMetadata,
+			bucketOutputHeights,
+			bucketPostings,
+			bucketActivePostings,
+			bucketPostingCCIDs,
+			bucketPendingBroadcasts,
+			bucketConfirmations,
+			bucketReplacements,
+			bucketAddressLabels,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		// only deliver callbacks for events emitted from now on
+		if meta := tx.Bucket(bucketMeta); meta.Get(keyCallbackCursor) == nil {
+			return putJSON(meta, keyCallbackCursor, tx.Bucket(bucketEvents).Sequence())
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	t := &Tracker{
+		w:              w,
+		db:             db,
+		pushSignal:     make(chan struct{}, 1),
+		callbackSignal: make(chan struct{}, 1),
+		annotateSignal: make(chan struct{}, 1),
+		closed:         make(chan struct{}),
+	}
+	go t.callbackLoop()
+	return t, nil
+}
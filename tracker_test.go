@@ -0,0 +1,2605 @@
+package walrus
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+	"lukechampine.com/frand"
+	"lukechampine.com/us/wallet"
+)
+
+// newTestTracker returns a Tracker for w backed by a temporary database. The
+// Tracker is closed and the database removed when the test finishes.
+func newTestTracker(t *testing.T, w *wallet.SeedWallet) *Tracker {
+	t.Helper()
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker, err := NewTracker(w, filepath.Join(dir, "walrus.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		tracker.Close()
+		os.RemoveAll(dir)
+	})
+	return tracker
+}
+
+func TestTrackerSiafunds(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	addr := info.UnlockConditions.UnlockHash()
+	w.AddAddress(info)
+
+	// receive some siafunds while the pool is at 1000 SC
+	pool1 := types.SiacoinPrecision.Mul64(1000)
+	pool2 := types.SiacoinPrecision.Mul64(3000)
+	sfo := types.SiafundOutput{
+		Value:      types.NewCurrency64(10),
+		UnlockHash: addr,
+		ClaimStart: pool1,
+	}
+	recvTxn := types.Transaction{SiafundOutputs: []types.SiafundOutput{sfo}}
+	sfid := recvTxn.SiafundOutputID(0)
+	cc := modules.ConsensusChange{
+		AppliedBlocks: []types.Block{{Transactions: []types.Transaction{recvTxn}}},
+		SiafundOutputDiffs: []modules.SiafundOutputDiff{
+			{Direction: modules.DiffApply, ID: sfid, SiafundOutput: sfo},
+		},
+		SiafundPoolDiffs: []modules.SiafundPoolDiff{
+			{Direction: modules.DiffApply, Previous: types.ZeroCurrency, Adjusted: pool1},
+		},
+	}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+	if tracker.ConsensusChangeID() != cc.ID {
+		t.Fatal("tracker did not record consensus change ID")
+	}
+	sfos := tracker.SiafundOutputs()
+	if len(sfos) != 1 || sfos[0].ID != sfid || sfos[0].Spent {
+		t.Fatal("tracker should have one unspent siafund output", sfos)
+	}
+	expClaim := pool2.Sub(pool1).Div(types.SiafundCount).Mul64(10)
+	if claim := sfos[0].ClaimAt(pool2); claim.Cmp(expClaim) != 0 {
+		t.Fatalf("expected claim of %v, got %v", expClaim, claim)
+	}
+
+	// spend the siafunds after the pool has grown
+	spendBlock := types.Block{Transactions: []types.Transaction{{
+		SiafundInputs: []types.SiafundInput{{ParentID: sfid}},
+	}}}
+	cc = modules.ConsensusChange{
+		AppliedBlocks: []types.Block{spendBlock},
+		SiafundOutputDiffs: []modules.SiafundOutputDiff{
+			{Direction: modules.DiffRevert, ID: sfid, SiafundOutput: sfo},
+		},
+		DelayedSiacoinOutputDiffs: []modules.DelayedSiacoinOutputDiff{{
+			Direction:     modules.DiffApply,
+			ID:            sfid.SiaClaimOutputID(),
+			SiacoinOutput: types.SiacoinOutput{Value: expClaim, UnlockHash: addr},
+		}},
+		SiafundPoolDiffs: []modules.SiafundPoolDiff{
+			{Direction: modules.DiffApply, Previous: pool1, Adjusted: pool2},
+		},
+	}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+	sfos = tracker.SiafundOutputs()
+	if len(sfos) != 1 || !sfos[0].Spent || sfos[0].SpentHeight != 1 {
+		t.Fatal("siafund output should be spent at height 1", sfos)
+	} else if sfos[0].RealizedClaim.Cmp(expClaim) != 0 {
+		t.Fatalf("expected realized claim of %v, got %v", expClaim, sfos[0].RealizedClaim)
+	} else if tracker.SiafundPool().Cmp(pool2) != 0 {
+		t.Fatal("siafund pool was not updated")
+	}
+
+	// revert the spend
+	cc = modules.ConsensusChange{
+		RevertedBlocks: []types.Block{spendBlock},
+		SiafundOutputDiffs: []modules.SiafundOutputDiff{
+			{Direction: modules.DiffApply, ID: sfid, SiafundOutput: sfo},
+		},
+		SiafundPoolDiffs: []modules.SiafundPoolDiff{
+			{Direction: modules.DiffRevert, Previous: pool1, Adjusted: pool2},
+		},
+	}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+	sfos = tracker.SiafundOutputs()
+	if len(sfos) != 1 || sfos[0].Spent || !sfos[0].RealizedClaim.IsZero() {
+		t.Fatal("siafund output should be unspent", sfos)
+	} else if tracker.SiafundPool().Cmp(pool1) != 0 {
+		t.Fatal("siafund pool was not reverted")
+	}
+}
+
+func TestTrackerDeposits(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	addr := info.UnlockConditions.UnlockHash()
+	w.AddAddress(info)
+	if err := tracker.AddDeposit(Deposit{Reference: "foo", Address: addr}); err != nil {
+		t.Fatal(err)
+	}
+	if ds := tracker.Deposits("foo"); len(ds) != 1 || ds[0].Address != addr {
+		t.Fatal("tracker should have one deposit", ds)
+	} else if ds := tracker.Deposits("bar"); len(ds) != 0 {
+		t.Fatal("tracker should not have deposits for other references", ds)
+	}
+
+	// send an output to the deposit address, and another elsewhere
+	txn := types.Transaction{SiacoinOutputs: []types.SiacoinOutput{
+		{Value: types.SiacoinPrecision, UnlockHash: types.UnlockHash{1}},
+		{Value: types.SiacoinPrecision.Mul64(2), UnlockHash: addr},
+	}}
+	cc := modules.ConsensusChange{
+		AppliedBlocks: []types.Block{{Transactions: []types.Transaction{txn}}},
+	}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+	// the payment should require the default number of confirmations
+	events := tracker.Events(-1)
+	if len(events) != 2 || events[1].Type != EventDepositReceived || events[0].Type != EventPaymentConfirming {
+		t.Fatal("expected depositReceived and paymentConfirming events", events)
+	}
+	var p Payment
+	if err := json.Unmarshal(events[0].Data, &p); err != nil {
+		t.Fatal(err)
+	} else if p.Required != defaultConfirmations {
+		t.Fatalf("expected payment to require %v confirmations, got %v", defaultConfirmations, p.Required)
+	}
+	var dr DepositReceipt
+	if err := json.Unmarshal(events[1].Data, &dr); err != nil {
+		t.Fatal(err)
+	} else if dr.Reference != "foo" || dr.OutputID != txn.SiacoinOutputID(1) || dr.Value.Cmp(types.SiacoinPrecision.Mul64(2)) != 0 {
+		t.Fatal("wrong deposit receipt", dr)
+	}
+}
+
+func TestTrackerPayments(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	addr := info.UnlockConditions.UnlockHash()
+	w.AddAddress(info)
+	if err := tracker.AddDeposit(Deposit{Reference: "foo", Address: addr, Confirmations: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	applyBlock := func(b types.Block) {
+		cc := modules.ConsensusChange{AppliedBlocks: []types.Block{b}}
+		frand.Read(cc.ID[:])
+		tracker.ProcessConsensusChange(cc)
+	}
+	checkPayment := func(state string, confs uint64) {
+		t.Helper()
+		ps := tracker.Payments("foo")
+		if len(ps) != 1 || ps[0].State != state || ps[0].Confirmations != confs {
+			t.Fatalf("expected one %v payment with %v confirmations, got %v", state, confs, ps)
+		}
+		if e := tracker.Events(1); len(e) != 1 || e[0].Type != "payment"+strings.Title(state) {
+			t.Fatal("expected a transition event, got", e)
+		}
+	}
+
+	payBlock := types.Block{Transactions: []types.Transaction{{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: addr}},
+	}}}
+	applyBlock(payBlock)
+	checkPayment(PaymentConfirming, 1)
+	applyBlock(types.Block{Timestamp: 1})
+	checkPayment(PaymentFinal, 2)
+
+	// revert both blocks
+	cc := modules.ConsensusChange{RevertedBlocks: []types.Block{{Timestamp: 1}, payBlock}}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+	checkPayment(PaymentReverted, 0)
+
+	// reapply the payment
+	applyBlock(payBlock)
+	checkPayment(PaymentConfirming, 1)
+}
+
+func TestRealizedGains(t *testing.T) {
+	sc := func(n uint64) types.Currency { return types.SiacoinPrecision.Mul64(n) }
+	flows := []Flow{
+		{Acquired: sc(10), Disposed: types.ZeroCurrency, Rate: 1},
+		{Acquired: sc(10), Disposed: types.ZeroCurrency, Rate: 2},
+		{Acquired: types.ZeroCurrency, Disposed: sc(15), Rate: 3},
+	}
+	tests := []struct {
+		policy string
+		basis  float64
+	}{
+		{PolicyFIFO, 10*1 + 5*2},
+		{PolicyLIFO, 10*2 + 5*1},
+	}
+	for _, test := range tests {
+		ds := RealizedGains(flows, test.policy)
+		if len(ds) != 1 {
+			t.Fatal("expected one disposal, got", len(ds))
+		}
+		if ds[0].Proceeds != 45 || ds[0].CostBasis != test.basis || ds[0].Gain != 45-test.basis {
+			t.Errorf("%v: wrong disposal: %+v", test.policy, ds[0])
+		}
+	}
+
+	// disposing of more than was acquired should use a basis of zero
+	ds := RealizedGains(append(flows, Flow{Disposed: sc(10), Rate: 3}), PolicyFIFO)
+	if ds[1].CostBasis != 5*2 {
+		t.Error("wrong cost basis for unmatched disposal:", ds[1].CostBasis)
+	}
+}
+
+func TestBuildStatement(t *testing.T) {
+	sc := func(n uint64) types.Currency { return types.SiacoinPrecision.Mul64(n) }
+	day := func(d int) time.Time { return time.Date(2019, 7, d, 0, 0, 0, 0, time.UTC) }
+	flows := []Flow{
+		{Timestamp: day(1), Acquired: sc(10), Disposed: types.ZeroCurrency},
+		{Timestamp: day(2), Acquired: types.ZeroCurrency, Disposed: sc(3)},
+		{Timestamp: day(5), Acquired: sc(4), Disposed: types.ZeroCurrency},
+		{Timestamp: day(6), Acquired: types.ZeroCurrency, Disposed: sc(2)},
+		{Timestamp: day(10), Acquired: sc(100), Disposed: types.ZeroCurrency},
+	}
+	st := buildStatement(flows, day(3), day(10))
+	if len(st.Entries) != 2 {
+		t.Fatal("expected 2 entries, got", len(st.Entries))
+	} else if !st.OpeningBalance.Equals(sc(7)) || !st.TotalIn.Equals(sc(4)) ||
+		!st.TotalOut.Equals(sc(2)) || !st.ClosingBalance.Equals(sc(9)) {
+		t.Errorf("wrong statement totals: %+v", st)
+	}
+}
+
+func TestStatementCSVOptions(t *testing.T) {
+	st := Statement{
+		Start:          time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC),
+		OpeningBalance: types.ZeroCurrency,
+		TotalIn:        types.ZeroCurrency,
+		TotalOut:       types.ZeroCurrency,
+		ClosingBalance: types.ZeroCurrency,
+		Entries: []Flow{{
+			Timestamp: time.Date(2019, 7, 5, 13, 17, 4, 0, time.UTC),
+			Acquired:  types.SiacoinPrecision.Mul64(9).Div64(2),
+			Disposed:  types.ZeroCurrency,
+			Rate:      0.5,
+		}},
+	}
+	opts := CSVOptions{Decimal: ",", DateFormat: "DD.MM.YYYY hh:mm", Currency: "eur"}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(st.EncodeCSV(opts))), "\n")
+	if lines[0] != "# start;01.07.2019 00:00" {
+		t.Error("wrong start row:", lines[0])
+	} else if header := lines[len(lines)-2]; header != "timestamp;height;id;in;out;internal;in_eur;out_eur" {
+		t.Error("wrong header:", header)
+	}
+	fields := strings.Split(lines[len(lines)-1], ";")
+	if len(fields) != 8 || fields[0] != "05.07.2019 13:17" || fields[3] != "4,5" || fields[6] != "2,25" || fields[7] != "0,00" {
+		t.Error("wrong entry:", fields)
+	}
+
+	for _, bad := range []CSVOptions{
+		{Decimal: ";"},
+		{DateFormat: "Jan 2 2006"},
+		{DateFormat: "YYYY-MM-DD PM"},
+	} {
+		if bad.validate() == nil {
+			t.Errorf("expected %+v to be invalid", bad)
+		}
+	}
+}
+
+func TestGroupLimbo(t *testing.T) {
+	limbo := make([]wallet.LimboTransaction, 4)
+	for i := range limbo {
+		limbo[i].ArbitraryData = [][]byte{{byte(i)}}
+	}
+	ids := func(txns ...wallet.LimboTransaction) (ids []types.TransactionID) {
+		for _, txn := range txns {
+			ids = append(ids, txn.ID())
+		}
+		return
+	}
+	sets := []LimboSet{
+		{TransactionIDs: ids(limbo[0], limbo[1])},
+		// a set whose transactions have all left Limbo
+		{TransactionIDs: []types.TransactionID{{1}}},
+		// a set with one transaction remaining
+		{TransactionIDs: append(ids(limbo[2]), types.TransactionID{2})},
+	}
+	groups := groupLimbo(sets, limbo)
+	if len(groups) != 3 {
+		t.Fatal("expected 3 groups, got", len(groups))
+	}
+	for i, exp := range [][]types.TransactionID{
+		ids(limbo[0], limbo[1]),
+		ids(limbo[2]),
+		ids(limbo[3]),
+	} {
+		if got := ids(groups[i].Transactions...); len(got) != len(exp) || got[0] != exp[0] || got[len(got)-1] != exp[len(exp)-1] {
+			t.Errorf("group %v: expected %v, got %v", i, exp, got)
+		}
+	}
+	if groups[2].ID != crypto.Hash(limbo[3].ID()) {
+		t.Error("ungrouped transaction should use its own ID")
+	}
+}
+
+func TestTrackerContractOutcomes(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	addr := info.UnlockConditions.UnlockHash()
+	w.AddAddress(info)
+
+	// two contracts: one proven, one missed at its window end (height 1)
+	fc := types.FileContract{
+		WindowStart:        0,
+		WindowEnd:          1,
+		ValidProofOutputs:  []types.SiacoinOutput{{Value: types.SiacoinPrecision.Mul64(2), UnlockHash: addr}},
+		MissedProofOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: addr}},
+	}
+	provenID, missedID := types.FileContractID{1}, types.FileContractID{2}
+	cc := modules.ConsensusChange{
+		AppliedBlocks: []types.Block{
+			{Transactions: []types.Transaction{{StorageProofs: []types.StorageProof{{ParentID: provenID}}}}},
+			{Timestamp: 1},
+		},
+		FileContractDiffs: []modules.FileContractDiff{
+			{Direction: modules.DiffRevert, ID: provenID, FileContract: fc},
+			{Direction: modules.DiffRevert, ID: missedID, FileContract: fc},
+		},
+	}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+	outcomes := make(map[types.FileContractID]ContractOutcome)
+	for _, o := range tracker.ContractOutcomes() {
+		outcomes[o.ID] = o
+	}
+	if o, ok := outcomes[provenID]; !ok || !o.Valid || o.BlockHeight != 0 || o.Payout.Cmp(types.SiacoinPrecision.Mul64(2)) != 0 {
+		t.Fatal("wrong outcome for proven contract:", o)
+	} else if o, ok := outcomes[missedID]; !ok || o.Valid || o.BlockHeight != 1 || o.Payout.Cmp(types.SiacoinPrecision) != 0 {
+		t.Fatal("wrong outcome for missed contract:", o)
+	}
+
+	// reverting the blocks should restore the contracts
+	cc = modules.ConsensusChange{
+		RevertedBlocks: []types.Block{cc.AppliedBlocks[1], cc.AppliedBlocks[0]},
+		FileContractDiffs: []modules.FileContractDiff{
+			{Direction: modules.DiffApply, ID: missedID, FileContract: fc},
+			{Direction: modules.DiffApply, ID: provenID, FileContract: fc},
+		},
+	}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+	if outcomes := tracker.ContractOutcomes(); len(outcomes) != 0 {
+		t.Fatal("outcomes should have been reverted:", outcomes)
+	}
+}
+
+func TestTrackerContractWarnings(t *testing.T) {
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	tracker := newTestTracker(t, w)
+	sub := w.ConsensusSetSubscriber(store)
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	w.AddAddress(info)
+	outputs := []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: info.UnlockConditions.UnlockHash()}}
+	txn := types.Transaction{
+		FileContracts: []types.FileContract{{
+			WindowStart:        10,
+			WindowEnd:          10 + contractWarningBlocks + 5,
+			ValidProofOutputs:  outputs,
+			MissedProofOutputs: outputs,
+		}},
+	}
+	id := txn.FileContractID(0)
+	apply := func(b types.Block) {
+		cc := modules.ConsensusChange{AppliedBlocks: []types.Block{b}, Synced: true}
+		frand.Read(cc.ID[:])
+		sub.ProcessConsensusChange(cc)
+		tracker.ProcessConsensusChange(cc)
+	}
+	warnings := func() (ws []FileContractWarning) {
+		for _, e := range tracker.Events(-1) {
+			if e.Type == EventFileContractWindowStarting || e.Type == EventFileContractWindowEnding {
+				var fw FileContractWarning
+				json.Unmarshal(e.Data, &fw)
+				ws = append(ws, fw)
+			}
+		}
+		return
+	}
+
+	// only the window start is close enough to warn about
+	apply(types.Block{Transactions: []types.Transaction{txn}})
+	if ws := warnings(); len(ws) != 1 || ws[0].ID != id || ws[0].BlocksRemaining != 10 {
+		t.Fatalf("expected one warning with 10 blocks remaining, got %+v", ws)
+	}
+	// the warning should not be repeated
+	apply(types.Block{Timestamp: 1})
+	if ws := warnings(); len(ws) != 1 {
+		t.Fatalf("expected warning to be emitted once, got %v", len(ws))
+	}
+
+	// the contract should be listed as upcoming
+	cs := new(mockCS)
+	srv := httptest.NewServer(NewServer(w, cs, stubTpool{}, WithTracker(tracker)))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+	if fcs, err := c.UpcomingFileContracts(10); err != nil {
+		t.Fatal(err)
+	} else if len(fcs) != 1 || fcs[0].ID != id {
+		t.Fatal("expected contract to be upcoming:", fcs)
+	} else if fcs, err := c.UpcomingFileContracts(5); err != nil {
+		t.Fatal(err)
+	} else if len(fcs) != 0 {
+		t.Fatal("expected no upcoming contracts:", fcs)
+	}
+}
+
+type fakePushSender chan Event
+
+func (s fakePushSender) SendPush(token string, e Event) error {
+	s <- e
+	return nil
+}
+
+func TestTrackerPush(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+
+	sent := make(fakePushSender, 10)
+	if err := tracker.SetPushSenders(map[string]PushSender{PlatformFCM: sent}); err != nil {
+		t.Fatal(err)
+	}
+	err := tracker.AddPushDevice(PushDevice{
+		Token:    "foo",
+		Platform: PlatformFCM,
+		Events:   []string{EventDepositReceived},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the deposit event should be delivered
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	addr := info.UnlockConditions.UnlockHash()
+	w.AddAddress(info)
+	if err := tracker.AddDeposit(Deposit{Reference: "foo", Address: addr, Confirmations: 1}); err != nil {
+		t.Fatal(err)
+	}
+	cc := modules.ConsensusChange{
+		AppliedBlocks: []types.Block{{Transactions: []types.Transaction{{
+			SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: addr}},
+		}}}},
+	}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+	select {
+	case e := <-sent:
+		if e.Type != EventDepositReceived {
+			t.Fatal("wrong event delivered:", e.Type)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not delivered")
+	}
+	select {
+	case e := <-sent:
+		t.Fatal("unexpected event delivered:", e.Type)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+type fakeAlertSender chan Alert
+
+func (s fakeAlertSender) SendAlert(a Alert) error {
+	s <- a
+	return nil
+}
+
+func TestTrackerAlerts(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+
+	slack := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var msg struct {
+			Text string `json:"text"`
+		}
+		json.NewDecoder(req.Body).Decode(&msg)
+		slack <- msg.Text
+	}))
+	defer srv.Close()
+	outflows := make(fakeAlertSender, 10)
+	tracker.SetAlerts(AlertPolicy{
+		LargeOutflow: types.SiacoinPrecision.Mul64(5),
+		LowBalance:   types.SiacoinPrecision,
+		SyncStalled:  time.Second,
+	}, []AlertChannel{
+		{Sender: outflows, Types: []string{AlertLargeOutflow}},
+		{Sender: &SlackAlertSender{WebhookURL: srv.URL}},
+	})
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	addr := info.UnlockConditions.UnlockHash()
+	w.AddAddress(info)
+
+	// spend 10 SC, sending 2 SC back to the wallet
+	parent := types.SiacoinOutputID{1}
+	txn := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{ParentID: parent, UnlockConditions: info.UnlockConditions}},
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Value: types.SiacoinPrecision.Mul64(2), UnlockHash: addr},
+			{Value: types.SiacoinPrecision.Mul64(8), UnlockHash: types.UnlockHash{1}},
+		},
+	}
+	cc := modules.ConsensusChange{
+		AppliedBlocks: []types.Block{{Transactions: []types.Transaction{txn}}},
+		SiacoinOutputDiffs: []modules.SiacoinOutputDiff{{
+			Direction:     modules.DiffRevert,
+			ID:            parent,
+			SiacoinOutput: types.SiacoinOutput{Value: types.SiacoinPrecision.Mul64(10), UnlockHash: addr},
+		}},
+		Synced: true,
+	}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+
+	select {
+	case a := <-outflows:
+		if a.Type != AlertLargeOutflow || !strings.Contains(a.Message, "8 SC") {
+			t.Fatal("wrong alert:", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("outflow alert was not delivered")
+	}
+	// Slack receives every alert; the wallet's balance is zero, since the
+	// wallet itself is not subscribed
+	for _, typ := range []string{AlertLargeOutflow, AlertLowBalance, AlertSyncStalled} {
+		select {
+		case text := <-slack:
+			if !strings.Contains(text, typ) {
+				t.Fatalf("expected %v alert, got %q", typ, text)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal(typ, "alert was not delivered")
+		}
+	}
+
+	// alerts should not be repeated
+	frand.Read(cc.ID[:])
+	cc.AppliedBlocks, cc.SiacoinOutputDiffs = []types.Block{{}}, nil
+	tracker.ProcessConsensusChange(cc)
+	select {
+	case a := <-outflows:
+		t.Fatal("unexpected alert:", a)
+	case text := <-slack:
+		t.Fatal("unexpected alert:", text)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestTrackerCallbacks(t *testing.T) {
+	type callback struct {
+		event Event
+		valid bool
+	}
+	received := make(chan callback, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		var cb callback
+		json.Unmarshal(body, &cb.event)
+		cb.valid = req.Header.Get("Walrus-Signature") == SignCallback("secret", body)
+		received <- cb
+	}))
+	defer srv.Close()
+
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+
+	// provision two deposits, only one of which has a callback
+	seed := wallet.NewSeed()
+	var addrs []types.UnlockHash
+	for i := uint64(0); i < 2; i++ {
+		info := wallet.SeedAddressInfo{
+			UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(i)),
+			KeyIndex:         i,
+		}
+		w.AddAddress(info)
+		addrs = append(addrs, info.UnlockConditions.UnlockHash())
+		if err := tracker.AddDeposit(Deposit{Reference: "foo", Address: addrs[i], Confirmations: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tracker.SetDepositCallback(addrs[0], srv.URL, ""); err == nil {
+		t.Fatal("expected error for missing secret")
+	} else if err := tracker.SetDepositCallback(types.UnlockHash{1}, srv.URL, "secret"); err == nil {
+		t.Fatal("expected error for unknown deposit")
+	} else if err := tracker.SetDepositCallback(addrs[0], srv.URL, "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	cc := modules.ConsensusChange{
+		AppliedBlocks: []types.Block{{Transactions: []types.Transaction{{
+			SiacoinOutputs: []types.SiacoinOutput{
+				{Value: types.SiacoinPrecision, UnlockHash: addrs[0]},
+				{Value: types.SiacoinPrecision, UnlockHash: addrs[1]},
+			},
+		}}}},
+	}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+	for _, typ := range []string{EventDepositReceived, EventPaymentFinal} {
+		select {
+		case cb := <-received:
+			if cb.event.Type != typ {
+				t.Fatalf("expected %v callback, got %v", typ, cb.event.Type)
+			} else if !cb.valid {
+				t.Fatal("callback has invalid signature")
+			} else if addr, _ := eventDeposit(cb.event); addr != addrs[0] {
+				t.Fatal("callback is for the wrong deposit")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("callback was not delivered")
+		}
+	}
+	select {
+	case cb := <-received:
+		t.Fatal("unexpected callback:", cb.event.Type)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestTrackerCallbackRetry(t *testing.T) {
+	// registered first, so that it runs after the tracker is closed
+	p := callbackRetryPolicy
+	t.Cleanup(func() { callbackRetryPolicy = p })
+	callbackRetryPolicy = RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+
+	// fail the first two attempts
+	var attempts int32
+	received := make(chan Event, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&attempts, 1) <= 2 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var e Event
+		json.NewDecoder(req.Body).Decode(&e)
+		received <- e
+	}))
+	defer srv.Close()
+
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+	seed := wallet.NewSeed()
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0)),
+	}
+	w.AddAddress(info)
+	addr := info.UnlockConditions.UnlockHash()
+	if err := tracker.AddDeposit(Deposit{Reference: "foo", Address: addr, Confirmations: 1}); err != nil {
+		t.Fatal(err)
+	} else if err := tracker.SetDepositCallback(addr, srv.URL, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	cc := modules.ConsensusChange{
+		AppliedBlocks: []types.Block{{Transactions: []types.Transaction{{
+			SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: addr}},
+		}}}},
+	}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+
+	// the failed event should be retried, and delivered before later events
+	for _, typ := range []string{EventDepositReceived, EventPaymentFinal} {
+		select {
+		case e := <-received:
+			if e.Type != typ {
+				t.Fatalf("expected %v callback, got %v", typ, e.Type)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("callback was not retried")
+		}
+	}
+	if n := atomic.LoadInt32(&attempts); n != 4 {
+		t.Fatal("expected 4 attempts, got", n)
+	}
+}
+
+func TestTrackerCallbackIsolation(t *testing.T) {
+	p := callbackRetryPolicy
+	t.Cleanup(func() { callbackRetryPolicy = p })
+	callbackRetryPolicy = RetryPolicy{InitialBackoff: time.Hour}
+
+	// deposit A's endpoint is down; deposit B's is up
+	var failed int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&failed, 1)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}))
+	defer down.Close()
+	received := make(chan Event, 10)
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var e Event
+		json.NewDecoder(req.Body).Decode(&e)
+		received <- e
+	}))
+	defer up.Close()
+
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+	seed := wallet.NewSeed()
+	var addrs []types.UnlockHash
+	for i, url := range []string{down.URL, up.URL} {
+		info := wallet.SeedAddressInfo{
+			UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(uint64(i))),
+			KeyIndex:         uint64(i),
+		}
+		w.AddAddress(info)
+		addr := info.UnlockConditions.UnlockHash()
+		addrs = append(addrs, addr)
+		if err := tracker.AddDeposit(Deposit{Reference: "foo", Address: addr, Confirmations: 1}); err != nil {
+			t.Fatal(err)
+		} else if err := tracker.SetDepositCallback(addr, url, "secret"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A's deposit is detected first, so its failure precedes B's events
+	cc := modules.ConsensusChange{
+		AppliedBlocks: []types.Block{{Transactions: []types.Transaction{{
+			SiacoinOutputs: []types.SiacoinOutput{
+				{Value: types.SiacoinPrecision, UnlockHash: addrs[0]},
+				{Value: types.SiacoinPrecision, UnlockHash: addrs[1]},
+			},
+		}}}},
+	}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+	for _, typ := range []string{EventDepositReceived, EventPaymentFinal} {
+		select {
+		case e := <-received:
+			if addr, _ := eventDeposit(e); e.Type != typ || addr != addrs[1] {
+				t.Fatalf("expected %v callback for B, got %v", typ, e.Type)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("B's callbacks were blocked by A's failure")
+		}
+	}
+	// A's later events are held back until its first event is delivered
+	if n := atomic.LoadInt32(&failed); n != 1 {
+		t.Fatal("expected 1 attempt for A, got", n)
+	}
+}
+
+func TestTrackerJournal(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+
+	seed := wallet.NewSeed()
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0)),
+		KeyIndex:         0,
+	}
+	w.AddAddress(info)
+	addr := info.UnlockConditions.UnlockHash()
+	if err := tracker.AddDeposit(Deposit{Reference: "foo", Address: addr, Confirmations: 1}); err != nil {
+		t.Fatal(err)
+	}
+	processDeposit := func() {
+		cc := modules.ConsensusChange{
+			AppliedBlocks: []types.Block{{Transactions: []types.Transaction{{
+				SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: addr}},
+			}}}},
+		}
+		frand.Read(cc.ID[:])
+		tracker.ProcessConsensusChange(cc)
+	}
+
+	// events emitted before the journal is configured should be written
+	// when it is
+	processDeposit()
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.jsonl")
+	j, err := OpenJournal(path, 1<<20, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	tracker.SetJournal(j, func(err error) { t.Error(err) })
+	processDeposit()
+
+	var seqs []uint64
+	err = ReplayJournal(path, func(e JournalEntry) error {
+		if e.Seq != 0 {
+			seqs = append(seqs, e.Seq)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := tracker.EventsAfter(0, -1)
+	if len(events) == 0 || len(seqs) != len(events) {
+		t.Fatalf("expected %v journaled events, got %v", len(events), len(seqs))
+	}
+	for i := range seqs {
+		if seqs[i] != events[i].Seq {
+			t.Fatalf("expected event %v, got %v", events[i].Seq, seqs[i])
+		}
+	}
+
+	// reopening the journal should not duplicate events
+	j.Close()
+	if j, err = OpenJournal(path, 1<<20, 3); err != nil {
+		t.Fatal(err)
+	}
+	tracker.SetJournal(j, func(err error) { t.Error(err) })
+	n := 0
+	ReplayJournal(path, func(e JournalEntry) error {
+		if e.Seq != 0 {
+			n++
+		}
+		return nil
+	})
+	if n != len(seqs) {
+		t.Fatalf("expected %v journaled events, got %v", len(seqs), n)
+	}
+}
+
+func TestJournalRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.jsonl")
+	j, err := OpenJournal(path, 200, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	for seq := uint64(1); seq <= 20; seq++ {
+		err := j.append([]JournalEntry{{
+			Type: EventDepositReceived,
+			Seq:  seq,
+			Data: json.RawMessage(`{}`),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for n := 0; n < 3; n++ {
+		stat, err := os.Stat(rotatedPath(path, n))
+		if err != nil {
+			t.Fatal(err)
+		} else if stat.Size() > 200 {
+			t.Fatalf("journal file %v exceeds max size: %v bytes", n, stat.Size())
+		}
+	}
+	if _, err := os.Stat(rotatedPath(path, 3)); !os.IsNotExist(err) {
+		t.Fatal("expected oldest journal file to be deleted")
+	}
+
+	// replay should yield the most recent entries, in order
+	var seqs []uint64
+	err = ReplayJournal(path, func(e JournalEntry) error {
+		seqs = append(seqs, e.Seq)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(seqs) == 0 || len(seqs) >= 20 {
+		t.Fatalf("expected some entries to be rotated away, got %v entries", len(seqs))
+	}
+	for i, seq := range seqs {
+		if seq != uint64(20-len(seqs)+1+i) {
+			t.Fatalf("expected entries %v-20 in order, got %v", 20-len(seqs)+1, seqs)
+		}
+	}
+}
+
+type fakeAnnotator chan AnnotationRequest
+
+func (a fakeAnnotator) Annotate(ar AnnotationRequest) (json.RawMessage, error) {
+	a <- ar
+	return json.RawMessage(`{"customer":"foo"}`), nil
+}
+
+func TestTrackerAnnotations(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+
+	annotated := make(fakeAnnotator, 10)
+	tracker.SetAnnotator(annotated)
+
+	// only the relevant transaction should be annotated
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	addr := info.UnlockConditions.UnlockHash()
+	w.AddAddress(info)
+	relevant := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: addr}},
+	}
+	irrelevant := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision}},
+	}
+	cc := modules.ConsensusChange{
+		AppliedBlocks: []types.Block{{Transactions: []types.Transaction{irrelevant, relevant}}},
+	}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+	select {
+	case ar := <-annotated:
+		if ar.TransactionID != relevant.ID() {
+			t.Fatal("wrong transaction annotated")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("transaction was not annotated")
+	}
+	select {
+	case ar := <-annotated:
+		t.Fatal("unexpected transaction annotated:", ar.TransactionID)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if a, ok := tracker.Annotation(relevant.ID()); !ok || string(a) != `{"customer":"foo"}` {
+		t.Fatal("annotation was not stored:", string(a))
+	}
+}
+
+func TestTrackerChange(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	addr := info.UnlockConditions.UnlockHash()
+	w.AddAddress(info)
+
+	// an incoming payment is not change
+	payment := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision.Mul64(2), UnlockHash: addr}},
+	}
+	// spending it with an output back to the wallet creates change
+	spend := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{
+			ParentID:         payment.SiacoinOutputID(0),
+			UnlockConditions: info.UnlockConditions,
+		}},
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Value: types.SiacoinPrecision, UnlockHash: types.UnlockHash{1}},
+			{Value: types.SiacoinPrecision, UnlockHash: addr},
+		},
+	}
+	cc := modules.ConsensusChange{
+		AppliedBlocks: []types.Block{{Transactions: []types.Transaction{payment, spend}}},
+	}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+	if tracker.IsChange(payment.SiacoinOutputID(0)) {
+		t.Error("payment marked as change")
+	} else if tracker.IsChange(spend.SiacoinOutputID(0)) {
+		t.Error("external output marked as change")
+	} else if !tracker.IsChange(spend.SiacoinOutputID(1)) {
+		t.Error("change output not marked")
+	}
+}
+
+func TestTrackerInternal(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+
+	seed := wallet.NewSeed()
+	info := wallet.SeedAddressInfo{UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0))}
+	info2 := wallet.SeedAddressInfo{UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(1)), KeyIndex: 1}
+	addr, addr2 := info.UnlockConditions.UnlockHash(), info2.UnlockConditions.UnlockHash()
+	w.AddAddress(info)
+	w.AddAddress(info2)
+
+	payment := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision.Mul64(3), UnlockHash: addr}},
+	}
+	// splitting the payment between two wallet addresses is internal
+	split := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{
+			ParentID:         payment.SiacoinOutputID(0),
+			UnlockConditions: info.UnlockConditions,
+		}},
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Value: types.SiacoinPrecision, UnlockHash: addr},
+			{Value: types.SiacoinPrecision, UnlockHash: addr2},
+		},
+		MinerFees: []types.Currency{types.SiacoinPrecision},
+	}
+	if isInternal(w, payment) {
+		t.Error("payment classified as internal")
+	} else if !isInternal(w, split) {
+		t.Error("split not classified as internal")
+	}
+
+	cc := modules.ConsensusChange{
+		AppliedBlocks: []types.Block{{Transactions: []types.Transaction{payment, split}}},
+		SiacoinOutputDiffs: []modules.SiacoinOutputDiff{{
+			Direction:     modules.DiffApply,
+			ID:            payment.SiacoinOutputID(0),
+			SiacoinOutput: payment.SiacoinOutputs[0],
+		}},
+	}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+
+	// only the fee of the split should be recorded, and it should be marked
+	// as internal
+	flows := tracker.Flows()
+	if len(flows) != 2 {
+		t.Fatalf("expected 2 flows, got %v", len(flows))
+	}
+	for _, f := range flows {
+		switch f.ID {
+		case crypto.Hash(payment.ID()):
+			if f.Internal {
+				t.Error("payment flow marked as internal")
+			}
+		case crypto.Hash(split.ID()):
+			if !f.Internal {
+				t.Error("split flow not marked as internal")
+			} else if !f.Disposed.Equals(types.SiacoinPrecision) {
+				t.Error("split flow should dispose of the fee only, got", f.Disposed)
+			}
+		default:
+			t.Error("unexpected flow", f.ID)
+		}
+	}
+}
+
+type recordTpool struct {
+	stubTpool
+	sets [][]types.Transaction
+}
+
+func (tp *recordTpool) AcceptTransactionSet(txnSet []types.Transaction) error {
+	tp.sets = append(tp.sets, txnSet)
+	return nil
+}
+
+func TestTrackerInheritance(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+
+	pk, sk, _ := ed25519.GenerateKey(nil)
+	beneficiary := types.UnlockHash{1}
+	txn := types.Transaction{
+		SiacoinInputs:         []types.SiacoinInput{{ParentID: types.SiacoinOutputID{2}}},
+		SiacoinOutputs:        []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: beneficiary}},
+		TransactionSignatures: []types.TransactionSignature{{ParentID: crypto.Hash{2}}},
+	}
+	inh := Inheritance{
+		Beneficiary:  beneficiary,
+		Transactions: []types.Transaction{txn},
+		HeartbeatKey: pk,
+		Period:       time.Hour,
+	}
+	if err := tracker.SetInheritance(Inheritance{Beneficiary: types.UnlockHash{3}, Transactions: inh.Transactions, HeartbeatKey: pk, Period: time.Hour}); err == nil {
+		t.Fatal("expected error for set that does not pay the beneficiary")
+	} else if err := tracker.SetInheritance(inh); err != nil {
+		t.Fatal(err)
+	} else if err := tracker.SetInheritance(inh); err == nil {
+		t.Fatal("expected error when replacing inheritance")
+	}
+
+	// heartbeats must be signed by the heartbeat key and must not be replayed
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	now := time.Now().Add(time.Second)
+	if err := tracker.Heartbeat(now, SignHeartbeat(otherKey, now)); err == nil {
+		t.Fatal("expected error for heartbeat signed by wrong key")
+	} else if err := tracker.Heartbeat(now, SignInheritanceRemoval(sk, now)); err == nil {
+		t.Fatal("expected error for removal signature used as heartbeat")
+	} else if err := tracker.Heartbeat(now, SignHeartbeat(sk, now)); err != nil {
+		t.Fatal(err)
+	} else if err := tracker.Heartbeat(now, SignHeartbeat(sk, now)); err == nil {
+		t.Fatal("expected error for replayed heartbeat")
+	}
+	old := now.Add(-time.Hour)
+	if err := tracker.Heartbeat(old, SignHeartbeat(sk, old)); err == nil {
+		t.Fatal("expected error for stale heartbeat")
+	}
+
+	// nothing should be broadcast before the deadline
+	tp := new(recordTpool)
+	stored, _ := tracker.Inheritance()
+	tracker.checkInheritance(tp, stored.Deadline().Add(-time.Second))
+	if len(tp.sets) != 0 {
+		t.Fatal("inheritance broadcast before deadline")
+	}
+	tracker.checkInheritance(tp, stored.Deadline())
+	if len(tp.sets) != 1 || tp.sets[0][0].ID() != txn.ID() {
+		t.Fatal("inheritance not broadcast after deadline")
+	}
+	if stored, _ = tracker.Inheritance(); stored.Triggered.IsZero() {
+		t.Fatal("inheritance not marked as triggered")
+	}
+	tracker.checkInheritance(tp, stored.Deadline())
+	if len(tp.sets) != 1 {
+		t.Fatal("inheritance broadcast twice")
+	}
+
+	later := now.Add(time.Second)
+	if err := tracker.Heartbeat(later, SignHeartbeat(sk, later)); err == nil {
+		t.Fatal("expected error for heartbeat after broadcast")
+	} else if err := tracker.RemoveInheritance(later, SignInheritanceRemoval(sk, later)); err != nil {
+		t.Fatal(err)
+	} else if _, ok := tracker.Inheritance(); ok {
+		t.Fatal("inheritance was not removed")
+	}
+}
+
+func TestTrackerVault(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+
+	pk, sk, _ := ed25519.GenerateKey(nil)
+	err := tracker.SetVaultPolicy(VaultPolicy{
+		Threshold:   types.SiacoinPrecision.Mul64(10),
+		Delay:       time.Hour,
+		RecoveryKey: pk,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	small := []types.Transaction{{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision.Mul64(5), UnlockHash: types.UnlockHash{1}}},
+	}}
+	large := []types.Transaction{{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision.Mul64(20), UnlockHash: types.UnlockHash{1}}},
+	}}
+	if tracker.requiresDelay(small) {
+		t.Fatal("small withdrawal should not be delayed")
+	} else if !tracker.requiresDelay(large) {
+		t.Fatal("large withdrawal should be delayed")
+	}
+
+	pw, err := tracker.QueueWithdrawal(large)
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := tracker.QueueWithdrawal(large); err == nil {
+		t.Fatal("expected error when queueing the same set twice")
+	} else if len(w.LimboTransactions()) != 1 {
+		t.Fatal("queued withdrawal not added to Limbo")
+	}
+
+	tp := new(recordTpool)
+	tracker.releaseWithdrawals(tp, pw.Release.Add(-time.Second))
+	if len(tp.sets) != 0 {
+		t.Fatal("withdrawal released before delay elapsed")
+	}
+	tracker.releaseWithdrawals(tp, pw.Release)
+	if len(tp.sets) != 1 || len(tracker.PendingWithdrawals()) != 0 {
+		t.Fatal("withdrawal not released after delay elapsed")
+	}
+
+	// queue another withdrawal and cancel it with the recovery key
+	large[0].MinerFees = []types.Currency{types.SiacoinPrecision}
+	pw, err = tracker.QueueWithdrawal(large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	if err := tracker.CancelWithdrawal(pw.ID, now, SignWithdrawalCancellation(otherKey, pw.ID, now)); err == nil {
+		t.Fatal("expected error for cancellation signed by wrong key")
+	} else if err := tracker.CancelWithdrawal(pw.ID, now, SignWithdrawalCancellation(sk, pw.ID, now)); err != nil {
+		t.Fatal(err)
+	} else if len(tracker.PendingWithdrawals()) != 0 {
+		t.Fatal("withdrawal not cancelled")
+	}
+	tracker.releaseWithdrawals(tp, now.Add(2*time.Hour))
+	if len(tp.sets) != 1 {
+		t.Fatal("cancelled withdrawal was broadcast")
+	}
+
+	// a large inheritance must wait out the delay too, so that an attacker
+	// can't use it to drain the wallet
+	heartbeatKey, _, _ := ed25519.GenerateKey(nil)
+	inheritance := []types.Transaction{{
+		SiacoinInputs:         []types.SiacoinInput{{ParentID: types.SiacoinOutputID{3}}},
+		SiacoinOutputs:        []types.SiacoinOutput{{Value: types.SiacoinPrecision.Mul64(20), UnlockHash: types.UnlockHash{1}}},
+		TransactionSignatures: []types.TransactionSignature{{ParentID: crypto.Hash{3}}},
+	}}
+	err = tracker.SetInheritance(Inheritance{
+		Beneficiary:  types.UnlockHash{1},
+		Transactions: inheritance,
+		HeartbeatKey: heartbeatKey,
+		Period:       time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inh, _ := tracker.Inheritance()
+	tracker.checkInheritance(tp, inh.Deadline())
+	pws := tracker.PendingWithdrawals()
+	if len(tp.sets) != 1 {
+		t.Fatal("large inheritance was broadcast immediately")
+	} else if len(pws) != 1 || pws[0].Transactions[0].ID() != inheritance[0].ID() {
+		t.Fatal("large inheritance was not queued")
+	} else if inh, _ = tracker.Inheritance(); inh.Triggered.IsZero() {
+		t.Fatal("queued inheritance should be marked as triggered")
+	}
+	if err := tracker.CancelWithdrawal(pws[0].ID, now, SignWithdrawalCancellation(sk, pws[0].ID, now)); err != nil {
+		t.Fatal(err)
+	}
+	tracker.checkInheritance(tp, inh.Deadline().Add(time.Hour))
+	tracker.releaseWithdrawals(tp, now.Add(2*time.Hour))
+	if len(tp.sets) != 1 || len(tracker.PendingWithdrawals()) != 0 {
+		t.Fatal("cancelled inheritance was broadcast")
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	tt := TransactionTemplate{
+		Name: "split",
+		Recipients: []TemplateRecipient{
+			{Address: types.UnlockHash{1}, Amount: types.NewCurrency64(5)},
+			{Address: types.UnlockHash{2}, Percent: 33.3},
+			{Address: types.UnlockHash{3}, Percent: 66.7},
+		},
+		Memo: "{name} {date}: {total} SC for {period}",
+	}
+	if err := validateTemplate(tt); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []TransactionTemplate{
+		{Name: "", Recipients: tt.Recipients},
+		{Name: "a/b", Recipients: tt.Recipients},
+		{Name: "none"},
+		{Name: "both", Recipients: []TemplateRecipient{{Amount: types.NewCurrency64(1), Percent: 1}}},
+		{Name: "neither", Recipients: []TemplateRecipient{{}}},
+		{Name: "over", Recipients: []TemplateRecipient{{Percent: 60}, {Percent: 50}}},
+	} {
+		if validateTemplate(bad) == nil {
+			t.Errorf("expected %q to be invalid", bad.Name)
+		}
+	}
+
+	// percentages summing to 100 should distribute exactly the total
+	outputs := templateOutputs(tt, types.NewCurrency64(1001))
+	if len(outputs) != 3 || outputs[0].Value.Cmp64(5) != 0 || outputs[1].Value.Cmp64(333) != 0 || outputs[2].Value.Cmp64(668) != 0 {
+		t.Fatal("wrong outputs:", outputs)
+	}
+	tt.Recipients = tt.Recipients[:2]
+	if outputs := templateOutputs(tt, types.NewCurrency64(1001)); outputs[1].Value.Cmp64(333) != 0 {
+		t.Fatal("remainder should not be distributed:", outputs)
+	}
+
+	now := time.Date(2019, time.August, 1, 23, 0, 0, 0, time.FixedZone("", -5*3600))
+	memo := expandMemo(tt, types.SiacoinPrecision.Mul64(1000), map[string]string{"period": "July"}, now)
+	if memo != "split 2019-08-02: 1000 SC for July" {
+		t.Fatal("wrong memo:", memo)
+	}
+}
+
+func TestDustPolicy(t *testing.T) {
+	feePerByte := types.NewCurrency64(1000)
+	input := func(id byte, value types.Currency) wallet.ValuedInput {
+		return wallet.ValuedInput{
+			SiacoinInput: types.SiacoinInput{
+				ParentID: types.SiacoinOutputID{id},
+				UnlockConditions: types.UnlockConditions{
+					PublicKeys:         []types.SiaPublicKey{types.Ed25519PublicKey(crypto.PublicKey{id})},
+					SignaturesRequired: 1,
+				},
+			},
+			Value: value,
+		}
+	}
+	// dust that isn't worth the fee to spend should never be selected
+	perInput := inputFee(input(0, types.ZeroCurrency).SiacoinInput, feePerByte)
+	candidates := []wallet.ValuedInput{
+		input(1, types.SiacoinPrecision),
+		input(2, types.NewCurrency64(3e6).Add(perInput)),
+		input(3, perInput),
+		input(4, types.NewCurrency64(1e6).Add(perInput)),
+		input(5, types.NewCurrency64(2e6).Add(perInput)),
+	}
+	p := DustPolicy{
+		Threshold: types.SiacoinPrecision,
+		MaxInputs: 2,
+	}
+	dust, value, fee := selectDust(p, candidates, feePerByte)
+	if len(dust) != 2 || dust[0].ParentID != candidates[3].ParentID || dust[1].ParentID != candidates[4].ParentID {
+		t.Fatal("expected the two smallest economical outputs to be selected, got", dust)
+	} else if !value.Equals(candidates[3].Value.Add(candidates[4].Value)) || !fee.Equals(perInput.Mul64(2)) {
+		t.Fatal("wrong value or fee:", value, fee)
+	}
+
+	// no dust should be selected while fees are high
+	p.MaxFeePerByte = feePerByte.Sub(types.NewCurrency64(1))
+	if dust, _, _ := selectDust(p, candidates, feePerByte); len(dust) != 0 {
+		t.Fatal("expected no dust to be selected above the fee limit, got", dust)
+	}
+}
+
+func TestConsolidate(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	srv := httptest.NewServer(NewServer(w, new(mockCS), stubTpool{}))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	// invalid requests should be rejected, and unfavorable conditions
+	// should defer the consolidation
+	if _, err := c.Consolidate(RequestConsolidate{Destinations: []types.UnlockHash{{1}}}); err == nil || errors.Is(err, ErrConsolidationDeferred) {
+		t.Fatal("expected missing threshold to be rejected, got", err)
+	}
+	rc := RequestConsolidate{
+		Threshold:     types.SiacoinPrecision,
+		Destinations:  []types.UnlockHash{{1}},
+		Fee:           "1000",
+		MaxFeePerByte: types.NewCurrency64(999),
+	}
+	if _, err := c.Consolidate(rc); !errors.Is(err, ErrConsolidationDeferred) {
+		t.Fatal("expected high fee to defer consolidation, got", err)
+	}
+	rc.MaxFeePerByte = types.ZeroCurrency
+	if _, err := c.Consolidate(rc); !errors.Is(err, ErrConsolidationDeferred) {
+		t.Fatal("expected empty wallet to defer consolidation, got", err)
+	}
+
+	seed := wallet.NewSeed()
+	feePerByte := types.NewCurrency64(1000)
+	var outputs []wallet.UnspentOutput
+	for i := 0; i < 10; i++ {
+		info := wallet.SeedAddressInfo{
+			UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(uint64(i))),
+			KeyIndex:         uint64(i),
+		}
+		w.AddAddress(info)
+		outputs = append(outputs, wallet.UnspentOutput{
+			SiacoinOutput: types.SiacoinOutput{
+				Value:      types.SiacoinPrecision.Mul64(uint64(10 - i)),
+				UnlockHash: info.UnlockConditions.UnlockHash(),
+			},
+			ID: types.SiacoinOutputID{byte(i)},
+		})
+	}
+	// one output is worth less than the fee to spend it
+	perInput := inputFee(types.SiacoinInput{
+		ParentID:         outputs[0].ID,
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0)),
+	}, feePerByte)
+	outputs[0].Value = perInput
+	dests := []types.UnlockHash{{1}, {2}}
+
+	// five economical outputs are below the threshold of 6 SC; the smallest
+	// should be selected first
+	selected, remaining := selectConsolidation(w, outputs, types.SiacoinPrecision.Mul64(6), 4, dests, feePerByte)
+	if len(selected) != 4 || remaining != 1 {
+		t.Fatalf("expected 4 outputs selected and 1 remaining, got %v and %v", len(selected), remaining)
+	}
+	for i, o := range selected {
+		if o.ID != outputs[9-i].ID {
+			t.Fatal("expected smallest outputs to be selected first, got", selected)
+		}
+	}
+	txn, _, ok := draftSweep(w, selected, evenSplit(dests), feePerByte)
+	if !ok || len(txn.SiacoinOutputs) != 2 {
+		t.Fatal("couldn't draft consolidation")
+	} else if sum := txn.SiacoinOutputs[0].Value.Add(txn.SiacoinOutputs[1].Value).Add(txn.MinerFees[0]); !sum.Equals(types.SiacoinPrecision.Mul64(1 + 2 + 3 + 4)) {
+		t.Fatal("consolidation does not preserve value:", sum)
+	}
+
+	// without a size limit, every eligible output fits
+	if selected, remaining := selectConsolidation(w, outputs, types.SiacoinPrecision.Mul64(6), 0, dests, feePerByte); len(selected) != 5 || remaining != 0 {
+		t.Fatalf("expected 5 outputs selected and 0 remaining, got %v and %v", len(selected), remaining)
+	}
+}
+
+func TestTrackerConsolidation(t *testing.T) {
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	tracker := newTestTracker(t, w)
+	tracker.SetConsolidationPolicy(ConsolidationPolicy{Threshold: 3, Destination: types.UnlockHash{1}})
+	cs.ConsensusSetSubscribe(tracker, tracker.ConsensusChangeID(), nil)
+
+	seed := wallet.NewSeed()
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0)),
+	}
+	w.AddAddress(info)
+	addr := info.UnlockConditions.UnlockHash()
+	readyEvents := func() (events []ConsolidationReady) {
+		for _, e := range tracker.Events(-1) {
+			if e.Type == EventConsolidationReady {
+				var cr ConsolidationReady
+				if err := json.Unmarshal(e.Data, &cr); err != nil {
+					t.Fatal(err)
+				}
+				events = append(events, cr)
+			}
+		}
+		return
+	}
+
+	// the event should be emitted when the threshold is first crossed
+	cs.sendReward(addr, types.SiacoinPrecision.Mul64(10))
+	cs.sendReward(addr, types.SiacoinPrecision.Mul64(10))
+	if rewards := maturedRewards(w); len(rewards) != 2 {
+		t.Fatal("expected 2 matured rewards, got", len(rewards))
+	} else if len(readyEvents()) != 0 {
+		t.Fatal("event should not be emitted below the threshold")
+	}
+	cs.sendReward(addr, types.SiacoinPrecision.Mul64(10))
+	if events := readyEvents(); len(events) != 1 {
+		t.Fatal("expected 1 event, got", len(events))
+	} else if events[0].Outputs != 3 || !events[0].Value.Equals(types.SiacoinPrecision.Mul64(30)) {
+		t.Fatal("wrong event data:", events[0])
+	}
+
+	// ...and only once
+	cs.sendReward(addr, types.SiacoinPrecision.Mul64(10))
+	if events := readyEvents(); len(events) != 1 {
+		t.Fatal("event should only be emitted once, got", len(events))
+	}
+
+	// rewards spent in Limbo are not counted
+	rewards := maturedRewards(w)
+	txn, _, ok := draftConsolidation(w, rewards, types.UnlockHash{1}, types.NewCurrency64(1))
+	if !ok || len(txn.SiacoinInputs) != 4 {
+		t.Fatal("couldn't draft consolidation")
+	}
+	w.AddToLimbo(txn)
+	if n := len(maturedRewards(w)); n != 0 {
+		t.Fatal("expected rewards in Limbo to be excluded, got", n)
+	}
+
+	// once the rewards are spent, the event should be emitted again when the
+	// threshold is next crossed
+	cc := modules.ConsensusChange{
+		AppliedBlocks: []types.Block{{Transactions: []types.Transaction{txn}}},
+		Synced:        true,
+	}
+	for _, o := range rewards {
+		cc.SiacoinOutputDiffs = append(cc.SiacoinOutputDiffs, modules.SiacoinOutputDiff{
+			Direction:     modules.DiffRevert,
+			SiacoinOutput: o.SiacoinOutput,
+			ID:            o.ID,
+		})
+	}
+	frand.Read(cc.ID[:])
+	for _, s := range cs.subscribers {
+		s.ProcessConsensusChange(cc)
+	}
+	for i := 0; i < 2; i++ {
+		cs.sendReward(addr, types.SiacoinPrecision.Mul64(10))
+	}
+	if events := readyEvents(); len(events) != 1 {
+		t.Fatal("event should not be emitted below the threshold, got", len(events))
+	}
+	cs.sendReward(addr, types.SiacoinPrecision.Mul64(10))
+	if events := readyEvents(); len(events) != 2 || events[1].Outputs != 3 {
+		t.Fatal("expected event to be emitted again, got", events)
+	}
+}
+
+func TestCoinSelection(t *testing.T) {
+	feePerByte := types.NewCurrency64(1000)
+	perInput := inputFee(types.SiacoinInput{
+		UnlockConditions: types.UnlockConditions{
+			PublicKeys:         []types.SiaPublicKey{types.Ed25519PublicKey(crypto.PublicKey{})},
+			SignaturesRequired: 1,
+		},
+	}, feePerByte)
+	// each input is worth sc siacoins after the fee for spending it
+	input := func(id byte, sc uint64, height types.BlockHeight) coinInput {
+		return coinInput{
+			ValuedInput: wallet.ValuedInput{
+				SiacoinInput: types.SiacoinInput{
+					ParentID: types.SiacoinOutputID{id},
+					UnlockConditions: types.UnlockConditions{
+						PublicKeys:         []types.SiaPublicKey{types.Ed25519PublicKey(crypto.PublicKey{id})},
+						SignaturesRequired: 1,
+					},
+				},
+				Value: types.SiacoinPrecision.Mul64(sc).Add(perInput),
+			},
+			Height: height,
+		}
+	}
+	selected := func(used []wallet.ValuedInput) (ids []byte, total types.Currency) {
+		total = types.ZeroCurrency
+		for _, in := range used {
+			ids = append(ids, in.ParentID[0])
+			total = total.Add(in.Value)
+		}
+		return
+	}
+	candidates := []coinInput{
+		input(1, 7, 5),
+		input(2, 5, 1),
+		input(3, 4, math.MaxUint64),
+		input(4, 3, 3),
+	}
+	overhead := feePerByte.Mul64(txnOverhead)
+
+	// the oldest outputs should be spent first, and outputs in Limbo last
+	amount := types.SiacoinPrecision.Mul64(6)
+	used, fee, change, ok := selectCoins(SelectOldest, amount, feePerByte, candidates)
+	if ids, total := selected(used); !ok || !reflect.DeepEqual(ids, []byte{2, 4}) {
+		t.Fatal("expected the two oldest outputs to be selected, got", ids)
+	} else if !fee.Equals(overhead.Add(perInput.Mul64(2))) || !total.Equals(amount.Add(fee).Add(change)) {
+		t.Fatal("wrong fee or change:", fee, change)
+	}
+
+	// an exact match should be found, with no change
+	amount = types.SiacoinPrecision.Mul64(8).Sub(overhead)
+	used, fee, change, ok = selectCoins(SelectExact, amount, feePerByte, candidates)
+	if ids, total := selected(used); !ok || !reflect.DeepEqual(ids, []byte{2, 4}) {
+		t.Fatal("expected an exact match, got", ids)
+	} else if !change.IsZero() || !total.Equals(amount.Add(fee)) {
+		t.Fatal("wrong fee or change:", fee, change)
+	}
+
+	// a random selection should be valid, whatever its order
+	amount = types.SiacoinPrecision.Mul64(10)
+	for i := 0; i < 10; i++ {
+		used, fee, change, ok := selectCoins(SelectRandom, amount, feePerByte, candidates)
+		if _, total := selected(used); !ok || !total.Equals(amount.Add(fee).Add(change)) {
+			t.Fatal("invalid random selection:", used, fee, change)
+		}
+	}
+	if _, _, _, ok := selectCoins(SelectRandom, types.SiacoinPrecision.Mul64(20), feePerByte, candidates); ok {
+		t.Fatal("expected insufficient funds")
+	}
+}
+
+func TestSplitRules(t *testing.T) {
+	r := SplitRule{
+		Name:      "pool",
+		Sources:   []types.UnlockHash{{1}},
+		Threshold: types.SiacoinPrecision,
+		Destinations: []SplitDestination{
+			{Address: types.UnlockHash{2}, Percent: 33.3},
+			{Address: types.UnlockHash{3}, Percent: 33.3},
+			{Address: types.UnlockHash{4}, Percent: 33.4},
+		},
+	}
+	if err := validateSplitRule(r); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []SplitRule{
+		{Name: "", Sources: r.Sources, Threshold: r.Threshold, Destinations: r.Destinations},
+		{Name: "nosources", Threshold: r.Threshold, Destinations: r.Destinations},
+		{Name: "nothreshold", Sources: r.Sources, Destinations: r.Destinations},
+		{Name: "under", Sources: r.Sources, Threshold: r.Threshold, Destinations: r.Destinations[:2]},
+		{Name: "negative", Sources: r.Sources, Threshold: r.Threshold, Destinations: []SplitDestination{{Percent: 110}, {Percent: -10}}},
+	} {
+		if validateSplitRule(bad) == nil {
+			t.Errorf("expected %q to be invalid", bad.Name)
+		}
+	}
+
+	// the remainder should be paid to the last destination
+	outputs := splitOutputs(r.Destinations, types.NewCurrency64(1000))
+	if len(outputs) != 3 || outputs[0].Value.Cmp64(333) != 0 || outputs[1].Value.Cmp64(333) != 0 || outputs[2].Value.Cmp64(334) != 0 {
+		t.Fatal("wrong outputs:", outputs)
+	} else if outputs[2].UnlockHash != r.Destinations[2].Address {
+		t.Fatal("wrong destination")
+	}
+}
+
+func TestSweepBundle(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	seed := wallet.NewSeed()
+	var outputs []wallet.UnspentOutput
+	for i := 0; i < 300; i++ {
+		info := wallet.SeedAddressInfo{
+			UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(uint64(i))),
+			KeyIndex:         uint64(i),
+		}
+		w.AddAddress(info)
+		outputs = append(outputs, wallet.UnspentOutput{
+			SiacoinOutput: types.SiacoinOutput{
+				Value:      types.NewCurrency64(uint64(i + 1)).Mul64(1e9),
+				UnlockHash: info.UnlockConditions.UnlockHash(),
+			},
+			ID: types.SiacoinOutputID{byte(i), byte(i >> 8)},
+		})
+	}
+	dest := types.UnlockHash{1}
+
+	// every chunk should fit within the size limit once signed
+	chunks := sweepChunks(w, outputs, dest, maxSweepSize)
+	if len(chunks) < 2 {
+		t.Fatal("expected outputs to be split across multiple transactions")
+	}
+	n := 0
+	for _, chunk := range chunks {
+		txn, keyIndices, ok := draftConsolidation(w, chunk, dest, types.NewCurrency64(1))
+		if !ok {
+			t.Fatal("couldn't draft sweep")
+		}
+		for i, in := range txn.SiacoinInputs {
+			wallet.AppendTransactionSignature(&txn, wallet.StandardTransactionSignature(crypto.Hash(in.ParentID)), seed.SecretKey(keyIndices[i]))
+		}
+		if size := len(encoding.Marshal(txn)); size > maxSweepSize {
+			t.Fatalf("signed transaction is %v bytes, exceeding the limit of %v", size, maxSweepSize)
+		}
+		n += len(chunk)
+	}
+	if n != len(outputs) {
+		t.Fatalf("expected %v outputs to be swept, got %v", len(outputs), n)
+	}
+
+	// with a high fee, the smallest outputs should be left behind
+	sb, err := draftSweepBundle(w, outputs, dest, types.NewCurrency64(4e8))
+	if err != nil {
+		t.Fatal(err)
+	} else if sb.Dust == 0 || len(sb.Requests) == 0 {
+		t.Fatalf("expected some outputs to be swept and some to be dust, got %v requests and %v dust", len(sb.Requests), sb.Dust)
+	}
+	total := types.ZeroCurrency
+	for _, o := range outputs {
+		total = total.Add(o.Value)
+	}
+	if sb.Value.Add(sb.Fees).Cmp(total) > 0 {
+		t.Fatal("bundle spends more than the wallet holds")
+	}
+	for _, sr := range sb.Requests {
+		if len(sr.ToSign) != len(sr.Transaction.SiacoinInputs) || len(sr.KeyIndices) != len(sr.ToSign) {
+			t.Fatal("signing request is inconsistent")
+		}
+	}
+	if _, err := draftSweepBundle(w, outputs, dest, types.SiacoinPrecision); err == nil {
+		t.Fatal("expected error when every output is dust")
+	}
+}
+
+func TestClientSweep(t *testing.T) {
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	tp := new(recordTpool)
+	srv := httptest.NewServer(NewServer(w, cs, tp))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	seed := wallet.NewSeed()
+	for i := uint64(0); i < 3; i++ {
+		info := wallet.SeedAddressInfo{
+			UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(i)),
+			KeyIndex:         i,
+		}
+		w.AddAddress(info)
+		cs.sendTxn(types.Transaction{
+			SiacoinOutputs: []types.SiacoinOutput{{
+				Value:      types.SiacoinPrecision.Mul64(10),
+				UnlockHash: info.UnlockConditions.UnlockHash(),
+			}},
+		})
+	}
+
+	dest := types.UnlockHash{1}
+	txids, err := c.Sweep(seed, dest, "1")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(txids) != 1 || len(tp.sets) != 1 {
+		t.Fatalf("expected one transaction to be broadcast, got %v", len(tp.sets))
+	}
+	txn := tp.sets[0][len(tp.sets[0])-1]
+	if txn.ID() != txids[0] {
+		t.Fatal("wrong transaction ID")
+	} else if len(txn.SiacoinInputs) != 3 || len(txn.SiacoinOutputs) != 1 || txn.SiacoinOutputs[0].UnlockHash != dest {
+		t.Fatal("transaction does not sweep the wallet:", txn)
+	} else if err := txn.StandaloneValid(types.ASICHardforkHeight + 1); err != nil {
+		t.Fatal("swept transaction is invalid:", err)
+	}
+}
+
+func TestBumpFee(t *testing.T) {
+	// a replacement must spend the same inputs, make the same payments, and
+	// pay a higher fee
+	w := wallet.New(wallet.NewEphemeralStore())
+	old := types.Transaction{
+		SiacoinInputs:  []types.SiacoinInput{{ParentID: types.SiacoinOutputID{1}}},
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: types.UnlockHash{1}}},
+		MinerFees:      []types.Currency{types.NewCurrency64(100)},
+	}
+	replacement := old
+	replacement.MinerFees = []types.Currency{types.NewCurrency64(200)}
+	if err := checkReplacement(w, old, replacement); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []types.Transaction{
+		{SiacoinInputs: []types.SiacoinInput{{ParentID: types.SiacoinOutputID{2}}}, SiacoinOutputs: replacement.SiacoinOutputs, MinerFees: replacement.MinerFees},
+		{SiacoinInputs: replacement.SiacoinInputs, SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: types.UnlockHash{2}}}, MinerFees: replacement.MinerFees},
+		old,
+	} {
+		if err := checkReplacement(w, old, bad); err == nil {
+			t.Fatal("expected replacement to be rejected:", bad)
+		}
+	}
+
+	store := wallet.NewEphemeralStore()
+	w = wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	tracker := newTestTracker(t, w)
+	cs.ConsensusSetSubscribe(tracker, tracker.ConsensusChangeID(), nil)
+	tp := new(recordTpool)
+	srv := httptest.NewServer(NewChainServer(w, hardforkAdapter{SiaAdapter{CS: cs, TP: tp}}, WithTracker(tracker)))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	seed := wallet.NewSeed()
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0)),
+	}
+	w.AddAddress(info)
+	addr := info.UnlockConditions.UnlockHash()
+	cs.sendTxn(types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision.Mul64(10), UnlockHash: addr}},
+	})
+	resp, err := c.ConstructTransaction(RequestConstruct{
+		Outputs:       []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: types.UnlockHash{1}}},
+		ChangeAddress: addr,
+		Fee:           "1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := NewWalletAdapter(c, seed)
+	stuck := resp.Transaction
+	signer.SignTransaction(&stuck, []crypto.Hash{crypto.Hash(stuck.SiacoinInputs[0].ParentID)})
+	if _, err := c.Broadcast([]types.Transaction{stuck}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the fee must increase
+	if _, err := c.DraftFeeBump(stuck.ID(), RequestBump{Fee: "0"}); err == nil {
+		t.Fatal("expected bump that does not raise the fee to be rejected")
+	}
+	bumped, err := c.BumpFee(signer, stuck.ID(), "10")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(bumped.SiacoinInputs) != 1 || bumped.SiacoinInputs[0].ParentID != stuck.SiacoinInputs[0].ParentID {
+		t.Fatal("replacement should reuse the original input")
+	} else if !reflect.DeepEqual(bumped.SiacoinOutputs[0], stuck.SiacoinOutputs[0]) {
+		t.Fatal("replacement should make the same payment")
+	} else if totalFee(bumped).Cmp(totalFee(stuck)) <= 0 {
+		t.Fatal("replacement should pay a higher fee")
+	} else if err := bumped.StandaloneValid(types.ASICHardforkHeight + 1); err != nil {
+		t.Fatal("replacement is invalid:", err)
+	}
+	if last := tp.sets[len(tp.sets)-1]; len(last) != 1 || last[0].ID() != bumped.ID() {
+		t.Fatal("replacement was not broadcast")
+	}
+
+	// the original should be marked as replaced
+	if id, ok := tracker.Replacement(stuck.ID()); !ok || id != bumped.ID() {
+		t.Fatal("replacement not recorded")
+	} else if _, err := c.LimboTransaction(stuck.ID()); err == nil || !strings.Contains(err.Error(), bumped.ID().String()) {
+		t.Fatal("expected error naming the replacement, got", err)
+	} else if _, err := c.LimboTransaction(bumped.ID()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBumpQueuedWithdrawal(t *testing.T) {
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	cs := new(mockCS)
+	cs.ConsensusSetSubscribe(w.ConsensusSetSubscriber(store), store.ConsensusChangeID(), nil)
+	tracker := newTestTracker(t, w)
+	cs.ConsensusSetSubscribe(tracker, tracker.ConsensusChangeID(), nil)
+	pk, _, _ := ed25519.GenerateKey(nil)
+	err := tracker.SetVaultPolicy(VaultPolicy{
+		Threshold:   types.SiacoinPrecision.Mul64(5),
+		Delay:       time.Hour,
+		RecoveryKey: pk,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := new(recordTpool)
+	srv := httptest.NewServer(NewChainServer(w, hardforkAdapter{SiaAdapter{CS: cs, TP: tp}}, WithTracker(tracker)))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	seed := wallet.NewSeed()
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0)),
+	}
+	w.AddAddress(info)
+	addr := info.UnlockConditions.UnlockHash()
+	cs.sendTxn(types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision.Mul64(10), UnlockHash: addr}},
+	})
+	resp, err := c.ConstructTransaction(RequestConstruct{
+		Outputs:       []types.SiacoinOutput{{Value: types.SiacoinPrecision.Mul64(8), UnlockHash: types.UnlockHash{1}}},
+		ChangeAddress: addr,
+		Fee:           "1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := NewWalletAdapter(c, seed)
+	txn := resp.Transaction
+	signer.SignTransaction(&txn, []crypto.Hash{crypto.Hash(txn.SiacoinInputs[0].ParentID)})
+	if receipt, err := c.Broadcast([]types.Transaction{txn}); err != nil {
+		t.Fatal(err)
+	} else if receipt.Withdrawal == nil {
+		t.Fatal("large withdrawal should be queued")
+	}
+
+	// bumping the queued withdrawal must not broadcast it early
+	if _, err := c.BumpFee(signer, txn.ID(), "10"); err == nil || !strings.Contains(err.Error(), "pending withdrawal") {
+		t.Fatal("expected bump of queued withdrawal to be rejected, got", err)
+	} else if len(tp.sets) != 0 {
+		t.Fatal("queued withdrawal was broadcast")
+	} else if pws := tracker.PendingWithdrawals(); len(pws) != 1 || pws[0].Transactions[0].ID() != txn.ID() {
+		t.Fatal("pending withdrawal should be unchanged")
+	} else if _, ok := tracker.Replacement(txn.ID()); ok {
+		t.Fatal("replacement should not be recorded")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+
+	// populate each database
+	os.MkdirAll(filepath.Join(src, "consensus"), 0700)
+	db, err := bolt.Open(filepath.Join(src, "consensus", "consensus.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket([]byte("foo"))
+		return err
+	})
+	db.Close()
+	store, err := wallet.NewBoltDBStore(filepath.Join(src, "wallet.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(0)),
+	}
+	addr := info.UnlockConditions.UnlockHash()
+	w := wallet.New(store)
+	w.AddAddress(info)
+	tracker, err := NewTracker(w, filepath.Join(src, "walrus.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt := TransactionTemplate{
+		Name:       "foo",
+		Recipients: []TemplateRecipient{{Address: addr, Amount: types.SiacoinPrecision}},
+	}
+	if err := tracker.SetTemplate(tt); err != nil {
+		t.Fatal(err)
+	}
+	tracker.Close()
+	store.Close()
+
+	var buf bytes.Buffer
+	m, err := WriteSnapshot(&buf, src)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(m.Files) != len(SnapshotFiles) {
+		t.Fatalf("expected %v files in manifest, got %v", len(SnapshotFiles), len(m.Files))
+	}
+	snapshot := buf.Bytes()
+
+	// a corrupted database should be rejected, leaving nothing behind
+	var corrupt bytes.Buffer
+	tr, tw := tar.NewReader(bytes.NewReader(snapshot)), tar.NewWriter(&corrupt)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		b, _ := ioutil.ReadAll(tr)
+		if hdr.Name == "wallet.db" {
+			b[len(b)/2] ^= 1
+		}
+		tw.WriteHeader(hdr)
+		tw.Write(b)
+	}
+	tw.Close()
+	if _, err := RestoreSnapshot(&corrupt, dst); err == nil || !strings.Contains(err.Error(), "hash") {
+		t.Fatal("expected hash mismatch, got", err)
+	}
+	for _, name := range SnapshotFiles {
+		if _, err := os.Stat(filepath.Join(dst, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Fatalf("%v should not exist after a failed restore", name)
+		}
+	}
+
+	m2, err := RestoreSnapshot(bytes.NewReader(snapshot), dst)
+	if err != nil {
+		t.Fatal(err)
+	} else if m2.ConsensusChangeID != m.ConsensusChangeID || m2.Height != m.Height {
+		t.Fatal("manifest mismatch")
+	}
+	if _, err := RestoreSnapshot(bytes.NewReader(snapshot), dst); err == nil {
+		t.Fatal("expected error when restoring over existing databases")
+	}
+
+	// the restored databases should contain the same state
+	store, err = wallet.NewBoltDBStore(filepath.Join(dst, "wallet.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	w = wallet.New(store)
+	if !w.OwnsAddress(addr) {
+		t.Fatal("restored wallet should own address")
+	}
+	tracker, err = NewTracker(w, filepath.Join(dst, "walrus.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+	if _, ok := tracker.Template("foo"); !ok {
+		t.Fatal("restored tracker should have template")
+	}
+}
+
+func TestInclusionProof(t *testing.T) {
+	for n := 1; n <= 17; n++ {
+		leaves := make([]crypto.Hash, n)
+		data := make([][]byte, n)
+		for i := range leaves {
+			data[i] = []byte{byte(i)}
+			leaves[i] = merkleLeafHash(data[i])
+		}
+		root := merkleRoot(leaves)
+		for i := range leaves {
+			proof := buildMerkleProof(leaves, uint64(i))
+			if !verifyMerkleProof(root, data[i], uint64(i), uint64(n), proof) {
+				t.Fatalf("valid proof of leaf %v of %v was rejected", i, n)
+			} else if n > 1 && verifyMerkleProof(root, data[(i+1)%n], uint64(i), uint64(n), proof) {
+				t.Fatalf("proof of leaf %v of %v accepted the wrong leaf", i, n)
+			}
+		}
+	}
+
+	// proofs should verify against the Merkle root of a real block
+	seed := wallet.NewSeed()
+	b := types.Block{
+		Timestamp: types.CurrentTimestamp(),
+		MinerPayouts: []types.SiacoinOutput{
+			{Value: types.SiacoinPrecision, UnlockHash: wallet.StandardAddress(seed.PublicKey(0))},
+			{Value: types.SiacoinPrecision.Mul64(2), UnlockHash: wallet.StandardAddress(seed.PublicKey(1))},
+		},
+	}
+	for i := 0; i < 5; i++ {
+		b.Transactions = append(b.Transactions, types.Transaction{
+			SiacoinOutputs: []types.SiacoinOutput{{Value: types.NewCurrency64(uint64(i)), UnlockHash: types.UnlockHash{byte(i)}}},
+		})
+	}
+	for i := range b.MinerPayouts {
+		p := OutputProof{
+			InclusionProof: blockInclusionProof(b, 10, uint64(i)),
+			OutputID:       b.MinerPayoutID(uint64(i)),
+			MinerPayout:    true,
+			OutputIndex:    uint64(i),
+		}
+		if sco, err := p.Verify(); err != nil {
+			t.Fatal(err)
+		} else if sco.UnlockHash != b.MinerPayouts[i].UnlockHash {
+			t.Fatal("proof returned the wrong output")
+		}
+	}
+	for i, txn := range b.Transactions {
+		ip := blockInclusionProof(b, 10, uint64(len(b.MinerPayouts)+i))
+		if ptxn, err := ip.Transaction(); err != nil {
+			t.Fatal(err)
+		} else if ptxn.ID() != txn.ID() {
+			t.Fatal("proof returned the wrong transaction")
+		}
+		p := OutputProof{InclusionProof: ip, OutputID: txn.SiacoinOutputID(0)}
+		if _, err := p.Verify(); err != nil {
+			t.Fatal(err)
+		}
+		// claiming a different output should fail
+		p.OutputID = types.SiacoinOutputID{1}
+		if _, err := p.Verify(); err == nil {
+			t.Fatal("expected proof of the wrong output to be rejected")
+		}
+	}
+}
+
+func TestOutputMetadata(t *testing.T) {
+	tracker := newTestTracker(t, wallet.New(wallet.NewEphemeralStore()))
+
+	outputs := []wallet.UnspentOutput{{ID: types.SiacoinOutputID{1}}, {ID: types.SiacoinOutputID{2}}, {ID: types.SiacoinOutputID{3}}}
+	if err := tracker.SetOutputMetadata(outputs[0].ID, map[string]string{"reserved-for": "batch-7"}); err != nil {
+		t.Fatal(err)
+	} else if err := tracker.SetOutputMetadata(outputs[1].ID, map[string]string{"reserved-for": "batch-8", "note": "x"}); err != nil {
+		t.Fatal(err)
+	} else if err := tracker.SetOutputMetadata(outputs[2].ID, map[string]string{"a=b": "c"}); err == nil {
+		t.Fatal("expected key containing '=' to be rejected")
+	}
+	if meta := tracker.OutputMetadata(outputs[0].ID); meta["reserved-for"] != "batch-7" {
+		t.Fatal("wrong metadata:", meta)
+	}
+
+	ids := func(os []wallet.UnspentOutput) (ids []types.SiacoinOutputID) {
+		for _, o := range os {
+			ids = append(ids, o.ID)
+		}
+		return
+	}
+	for _, test := range []struct {
+		query string
+		exp   []types.SiacoinOutputID
+	}{
+		{"", ids(outputs)},
+		{"nometa=reserved-for", ids(outputs[2:])},
+		{"meta=reserved-for", ids(outputs[:2])},
+		{"meta=reserved-for=batch-8", ids(outputs[1:2])},
+		{"meta=reserved-for&nometa=note", ids(outputs[:1])},
+	} {
+		q, _ := url.ParseQuery(test.query)
+		f := parseOutputFilter(q)
+		if got := ids(filterOutputs(tracker, outputs, f)); !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%q: expected %v, got %v", test.query, test.exp, got)
+		}
+		// the filter should survive a round-trip through the query string
+		q2 := make(url.Values)
+		addOutputFilter(q2, f)
+		if f2 := parseOutputFilter(q2); !reflect.DeepEqual(f2, f) {
+			t.Errorf("%q: filter changed after round-trip: %+v", test.query, f2)
+		}
+	}
+
+	// removing metadata
+	if err := tracker.SetOutputMetadata(outputs[0].ID, nil); err != nil {
+		t.Fatal(err)
+	} else if meta := tracker.OutputMetadata(outputs[0].ID); meta != nil {
+		t.Fatal("metadata should have been removed")
+	}
+}
+
+func TestAddressLabels(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+	srv := httptest.NewServer(NewServer(w, new(mockCS), stubTpool{}, WithTracker(tracker)))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+
+	seed := wallet.NewSeed()
+	var addrs []types.UnlockHash
+	for i := uint64(0); i < 3; i++ {
+		info := wallet.SeedAddressInfo{
+			UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(i)),
+			KeyIndex:         i,
+		}
+		w.AddAddress(info)
+		addrs = append(addrs, info.UnlockConditions.UnlockHash())
+	}
+	if err := client.SetAddressLabels(addrs[0], []string{"deposits", "customer 1234", "deposits"}); err != nil {
+		t.Fatal(err)
+	} else if err := client.SetAddressLabels(addrs[1], []string{"cold"}); err != nil {
+		t.Fatal(err)
+	} else if err := client.SetAddressLabels(addrs[2], []string{""}); err == nil {
+		t.Fatal("expected empty label to be rejected")
+	} else if err := client.SetAddressLabels(types.UnlockHash{1}, []string{"cold"}); err == nil {
+		t.Fatal("expected unknown address to be rejected")
+	}
+	if labels, err := client.AddressLabels(addrs[0]); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(labels, []string{"customer 1234", "deposits"}) {
+		t.Fatal("wrong labels:", labels)
+	}
+	if labeled, err := client.AddressesByLabel("cold"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(labeled, addrs[1:2]) {
+		t.Fatal("wrong addresses:", labeled)
+	}
+
+	// outputs should be selected by the labels of their addresses
+	outputs := []wallet.UnspentOutput{
+		{ID: types.SiacoinOutputID{1}, SiacoinOutput: types.SiacoinOutput{UnlockHash: addrs[0]}},
+		{ID: types.SiacoinOutputID{2}, SiacoinOutput: types.SiacoinOutput{UnlockHash: addrs[1]}},
+		{ID: types.SiacoinOutputID{3}, SiacoinOutput: types.SiacoinOutput{UnlockHash: addrs[2]}},
+	}
+	for _, test := range []struct {
+		labels []string
+		exp    int
+	}{
+		{nil, 3},
+		{[]string{"cold"}, 1},
+		{[]string{"deposits", "customer 1234"}, 1},
+		{[]string{"deposits", "cold"}, 0},
+	} {
+		if got := filterOutputs(tracker, outputs, OutputFilter{Labels: test.labels}); len(got) != test.exp {
+			t.Errorf("%q: expected %v outputs, got %v", test.labels, test.exp, len(got))
+		}
+	}
+	if !involvesAddress(types.Transaction{SiacoinOutputs: []types.SiacoinOutput{{UnlockHash: addrs[1]}}}, labeledAddresses(tracker, []string{"cold"})) {
+		t.Fatal("expected transaction to involve a cold address")
+	} else if len(labeledAddresses(nil, []string{"cold"})) != 0 {
+		t.Fatal("expected no labeled addresses without a tracker")
+	}
+
+	// removing labels
+	if err := client.SetAddressLabels(addrs[0], nil); err != nil {
+		t.Fatal(err)
+	} else if labels := tracker.AddressLabels(addrs[0]); labels != nil {
+		t.Fatal("labels should have been removed")
+	}
+	if err := client.RemoveAddress(addrs[1]); err != nil {
+		t.Fatal(err)
+	} else if labels := tracker.AddressLabels(addrs[1]); labels != nil {
+		t.Fatal("labels should be removed along with the address")
+	}
+
+	// invalid labels are the client's fault; database errors are not
+	putLabels := func(labels string) int {
+		req, _ := http.NewRequest(http.MethodPut, srv.URL+"/addresses/"+addrs[2].String()+"/label", strings.NewReader(labels))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := putLabels(`[""]`); code != http.StatusBadRequest {
+		t.Fatal("expected invalid label to be rejected with 400, got", code)
+	} else if code := putLabels(`["` + strings.Repeat("a", 65) + `"]`); code != http.StatusBadRequest {
+		t.Fatal("expected long label to be rejected with 400, got", code)
+	}
+	tracker.db.Close()
+	if code := putLabels(`["cold"]`); code != http.StatusInternalServerError {
+		t.Fatal("expected database error to be reported with 500, got", code)
+	}
+
+	// without a Tracker, label filters are rejected rather than ignored
+	srv2 := httptest.NewServer(NewServer(w, new(mockCS), stubTpool{}))
+	defer srv2.Close()
+	client2 := NewClient(srv2.URL)
+	if _, err := client2.AddressesByLabel("cold"); err == nil || !strings.Contains(err.Error(), "require a Tracker") {
+		t.Fatal("expected /addresses label filter to be rejected, got", err)
+	}
+	for _, route := range []string{"/transactions", "/utxos"} {
+		resp, err := http.Get(srv2.URL + route + "?label=cold")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%v: expected label filter to be rejected with 400, got %v", route, resp.StatusCode)
+		}
+	}
+	if _, err := client2.Addresses(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTrackerReconcile(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+
+	seed := wallet.NewSeed()
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0)),
+		KeyIndex:         0,
+	}
+	w.AddAddress(info)
+	addr := info.UnlockConditions.UnlockHash()
+
+	depositBlock := types.Block{Timestamp: 1, Transactions: []types.Transaction{{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: addr}},
+	}}}
+	depositID := crypto.Hash(depositBlock.Transactions[0].ID())
+	cc := modules.ConsensusChange{AppliedBlocks: []types.Block{depositBlock}}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+	depositCC := cc.ID
+
+	balanced := func(ps []Posting) bool {
+		debits, credits := types.ZeroCurrency, types.ZeroCurrency
+		for _, p := range ps {
+			if p.Direction == PostingDebit {
+				debits = debits.Add(p.Amount)
+			} else {
+				credits = credits.Add(p.Amount)
+			}
+		}
+		return debits.Equals(credits)
+	}
+
+	postings, ccid, err := tracker.Postings(modules.ConsensusChangeID{}, -1)
+	if err != nil {
+		t.Fatal(err)
+	} else if ccid != depositCC {
+		t.Fatal("expected ccid of deposit, got", ccid)
+	} else if len(postings) != 2 || !balanced(postings) {
+		t.Fatal("expected balanced deposit postings, got", postings)
+	}
+	for _, p := range postings {
+		if p.TxID != depositID || !p.Amount.Equals(types.SiacoinPrecision) || p.Reversal {
+			t.Fatal("wrong deposit posting:", p)
+		}
+		if (p.Account == AccountWallet) != (p.Direction == PostingDebit) {
+			t.Fatal("deposit should debit the wallet:", p)
+		}
+	}
+
+	// reverting the deposit should reverse its postings
+	cc = modules.ConsensusChange{RevertedBlocks: []types.Block{depositBlock}}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+	reversals, ccid, err := tracker.Postings(depositCC, -1)
+	if err != nil {
+		t.Fatal(err)
+	} else if ccid != cc.ID {
+		t.Fatal("expected ccid of revert, got", ccid)
+	} else if len(reversals) != 2 || !balanced(reversals) {
+		t.Fatal("expected balanced reversal postings, got", reversals)
+	}
+	for i, p := range reversals {
+		if !p.Reversal || p.Account != postings[i].Account || p.Direction == postings[i].Direction {
+			t.Fatal("wrong reversal posting:", p)
+		}
+	}
+	if all, _, _ := tracker.Postings(modules.ConsensusChangeID{}, -1); len(all) != 4 || !balanced(all) {
+		t.Fatal("expected four balanced postings, got", all)
+	}
+
+	// blocks without wallet activity should not add postings
+	cc = modules.ConsensusChange{AppliedBlocks: []types.Block{{Timestamp: 2}}}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+	if ps, _, _ := tracker.Postings(modules.ConsensusChangeID{}, -1); len(ps) != 4 {
+		t.Fatal("expected no new postings, got", ps[4:])
+	}
+
+	// paging
+	page, ccid := tracker.PostingsAfter(0, 3)
+	if len(page) != 3 || ccid != (modules.ConsensusChangeID{}) {
+		t.Fatal("expected partial page without ccid")
+	} else if page, ccid = tracker.PostingsAfter(page[2].Seq, 3); len(page) != 1 || ccid != cc.ID {
+		t.Fatal("expected final page with ccid")
+	}
+
+	if _, _, err := tracker.Postings(modules.ConsensusChangeID{1}, -1); err != ErrUnknownCCID {
+		t.Fatal("expected ErrUnknownCCID, got", err)
+	}
+}
+
+func TestSiafundConstruct(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+	srv := httptest.NewServer(NewServer(w, new(mockCS), stubTpool{}, WithTracker(tracker)))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(wallet.NewSeed().PublicKey(3)),
+		KeyIndex:         3,
+	}
+	addr := info.UnlockConditions.UnlockHash()
+	w.AddAddress(info)
+
+	// the outputs are created when the pool reaches 1000 SC, so their claims
+	// are zero
+	pool := types.SiacoinPrecision.Mul64(1000)
+	txn := types.Transaction{SiafundOutputs: []types.SiafundOutput{
+		{Value: types.NewCurrency64(10), UnlockHash: addr, ClaimStart: pool},
+		{Value: types.NewCurrency64(5), UnlockHash: addr, ClaimStart: pool},
+	}}
+	cc := modules.ConsensusChange{
+		AppliedBlocks: []types.Block{{Transactions: []types.Transaction{txn}}},
+		SiafundPoolDiffs: []modules.SiafundPoolDiff{
+			{Direction: modules.DiffApply, Previous: types.ZeroCurrency, Adjusted: pool},
+		},
+	}
+	for i, sfo := range txn.SiafundOutputs {
+		cc.SiafundOutputDiffs = append(cc.SiafundOutputDiffs, modules.SiafundOutputDiff{
+			Direction:     modules.DiffApply,
+			ID:            txn.SiafundOutputID(uint64(i)),
+			SiafundOutput: sfo,
+		})
+	}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+
+	if bal, err := c.SiafundBalance(true); err != nil {
+		t.Fatal(err)
+	} else if !bal.Balance.Equals(types.NewCurrency64(15)) || !bal.Pool.Equals(pool) || !bal.ClaimBalance.IsZero() {
+		t.Fatal("wrong siafund balance:", bal)
+	}
+	if sfos, err := c.SiafundOutputs(true); err != nil {
+		t.Fatal(err)
+	} else if len(sfos) != 2 {
+		t.Fatal("expected 2 unspent siafund outputs, got", len(sfos))
+	}
+
+	dest := types.UnlockHash{1}
+	rc := RequestConstruct{
+		SiafundOutputs: []types.SiafundOutput{{Value: types.NewCurrency64(12), UnlockHash: dest}},
+		ChangeAddress:  addr,
+		Fee:            "0",
+	}
+	resp, err := c.ConstructTransaction(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sft := resp.Transaction
+	if len(sft.SiafundInputs) != 2 || len(resp.SiafundKeyIndices) != 2 || resp.SiafundKeyIndices[0] != 3 {
+		t.Fatal("expected both siafund outputs to be spent:", resp)
+	} else if sft.SiafundInputs[0].ClaimUnlockHash != addr {
+		t.Fatal("claim should be paid to the change address")
+	} else if len(sft.SiafundOutputs) != 2 || !sft.SiafundOutputs[1].Value.Equals(types.NewCurrency64(3)) || sft.SiafundOutputs[1].UnlockHash != addr {
+		t.Fatal("expected siafund change:", sft.SiafundOutputs)
+	}
+
+	rc.SiafundOutputs[0].Value = types.NewCurrency64(16)
+	if _, err := c.ConstructTransaction(rc); err == nil {
+		t.Fatal("expected insufficient siafunds")
+	}
+	// the fee must be paid in siacoins
+	rc.SiafundOutputs[0].Value = types.NewCurrency64(1)
+	rc.Fee = "10"
+	if _, err := c.ConstructTransaction(rc); err == nil {
+		t.Fatal("expected insufficient siacoins for the fee")
+	}
+}
+
+func TestDepositReservations(t *testing.T) {
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+	srv := httptest.NewServer(NewServer(w, new(mockCS), stubTpool{}, WithTracker(tracker)))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	// reserving requires an amount and a short reference
+	seed := wallet.NewSeed()
+	rd := RequestDeposit{
+		SeedAddressInfo: wallet.SeedAddressInfo{UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0))},
+		Reference:       "foo",
+		Reserve:         true,
+	}
+	if _, err := c.AddDeposit(rd); err == nil {
+		t.Fatal("expected reserving deposit without amount to be rejected")
+	}
+	rd.Amount = types.SiacoinPrecision
+	rd.Reference = strings.Repeat("x", 57)
+	if _, err := c.AddDeposit(rd); err == nil {
+		t.Fatal("expected reserving deposit with long reference to be rejected")
+	}
+
+	var addrs []types.UnlockHash
+	for i := uint64(0); i < 2; i++ {
+		info := wallet.SeedAddressInfo{
+			UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(i)),
+			KeyIndex:         i,
+		}
+		w.AddAddress(info)
+		addrs = append(addrs, info.UnlockConditions.UnlockHash())
+	}
+	err := tracker.AddDeposit(Deposit{Reference: "foo", Address: addrs[0], Amount: types.SiacoinPrecision, Reserve: true})
+	if err != nil {
+		t.Fatal(err)
+	} else if err := tracker.AddDeposit(Deposit{Reference: "bar", Address: addrs[1]}); err != nil {
+		t.Fatal(err)
+	}
+
+	// outputs sent to the reserving deposit should be locked as soon as they
+	// appear in Limbo
+	txn := types.Transaction{SiacoinOutputs: []types.SiacoinOutput{
+		{Value: types.SiacoinPrecision, UnlockHash: addrs[0]},
+		{Value: types.SiacoinPrecision, UnlockHash: addrs[1]},
+	}}
+	if err := c.AddToLimbo(txn); err != nil {
+		t.Fatal(err)
+	}
+	reserved, unreserved := txn.SiacoinOutputID(0), txn.SiacoinOutputID(1)
+	utxos, err := c.UnspentOutputs(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockIDs := make(map[types.SiacoinOutputID]string)
+	for _, o := range utxos {
+		lockIDs[o.ID] = o.LockID
+	}
+	if id, ok := lockIDs[reserved]; !ok || id != DepositLockID("foo") {
+		t.Fatalf("expected reserved output to be locked under %q, got %q", DepositLockID("foo"), id)
+	} else if id := lockIDs[unreserved]; id != "" {
+		t.Fatal("expected other output to be unlocked, got", id)
+	}
+
+	// the reservation can be released by its holder
+	if err := c.ReleaseUTXOs(DepositLockID("foo"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if utxos, err := c.UnspentOutputs(true); err != nil {
+		t.Fatal(err)
+	} else if len(unlockedOutputs(utxos)) != len(utxos) {
+		t.Fatal("expected reservation to be released")
+	}
+}
+
+func TestConfirmationStats(t *testing.T) {
+	if b := feeBand(types.NewCurrency64(1000)); !b.Equals(types.NewCurrency64(512)) {
+		t.Fatal("wrong fee band:", b)
+	} else if b := feeBand(types.NewCurrency64(1024)); !b.Equals(types.NewCurrency64(1024)) {
+		t.Fatal("wrong fee band:", b)
+	} else if b := feeBand(types.ZeroCurrency); !b.IsZero() {
+		t.Fatal("wrong fee band:", b)
+	}
+
+	day := time.Date(2019, 8, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(broadcast time.Time, fee uint64, blocks uint64, latency time.Duration) ConfirmationSample {
+		return ConfirmationSample{
+			FeePerByte: types.NewCurrency64(fee),
+			Broadcast:  broadcast,
+			Confirmed:  broadcast.Add(latency),
+			Blocks:     blocks,
+		}
+	}
+	samples := []ConfirmationSample{
+		sample(day.Add(time.Hour), 100, 1, 5*time.Minute),
+		sample(day.Add(2*time.Hour), 200, 2, 20*time.Minute),
+		sample(day.Add(3*time.Hour), 300, 3, 30*time.Minute),
+		sample(day.Add(25*time.Hour), 10, 6, time.Hour),
+		// block timestamps may precede the broadcast
+		sample(day.Add(26*time.Hour), 10, 1, -time.Minute),
+	}
+	buckets, bands := confirmationBuckets(samples, 24*time.Hour)
+	if len(buckets) != 2 || !buckets[0].Start.Equal(day) || !buckets[1].Start.Equal(day.Add(24*time.Hour)) {
+		t.Fatal("wrong buckets:", buckets)
+	}
+	b := buckets[0]
+	if b.Count != 3 || !b.MinFee.Equals(types.NewCurrency64(100)) || !b.MedianFee.Equals(types.NewCurrency64(200)) || !b.MaxFee.Equals(types.NewCurrency64(300)) {
+		t.Fatal("wrong fee stats:", b.ConfirmationStats)
+	} else if b.MedianBlocks != 2 || b.P90Blocks != 2 || b.MedianSeconds != 1200 {
+		t.Fatal("wrong latency stats:", b.ConfirmationStats)
+	} else if buckets[1].MedianSeconds != 0 {
+		t.Fatal("latency should not be negative:", buckets[1].ConfirmationStats)
+	}
+	// 10 -> 8, 100 -> 64, 200 -> 128, 300 -> 256
+	if len(bands) != 4 || !bands[0].FeeBand.Equals(types.NewCurrency64(8)) || bands[0].Count != 2 || !bands[3].FeeBand.Equals(types.NewCurrency64(256)) {
+		t.Fatal("wrong fee bands:", bands)
+	}
+
+	// broadcasts should be sampled when they confirm
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+	txn := types.Transaction{MinerFees: []types.Currency{types.SiacoinPrecision}}
+	w.AddToLimbo(txn)
+	if err := tracker.AddLimboSet([]types.Transaction{txn}); err != nil {
+		t.Fatal(err)
+	} else if n := tracker.PendingBroadcasts(); n != 1 {
+		t.Fatal("expected 1 pending broadcast, got", n)
+	}
+	cc := modules.ConsensusChange{AppliedBlocks: []types.Block{{
+		Timestamp:    types.CurrentTimestamp(),
+		Transactions: []types.Transaction{txn},
+	}}}
+	frand.Read(cc.ID[:])
+	w.RemoveFromLimbo(txn.ID())
+	tracker.ProcessConsensusChange(cc)
+	if n := tracker.PendingBroadcasts(); n != 0 {
+		t.Fatal("expected no pending broadcasts, got", n)
+	}
+	got := tracker.ConfirmationSamples(time.Time{})
+	if len(got) != 1 || got[0].TransactionID != txn.ID() || got[0].Blocks != 1 {
+		t.Fatal("wrong samples:", got)
+	} else if exp := setFeePerByte([]types.Transaction{txn}); !got[0].FeePerByte.Equals(exp) {
+		t.Fatalf("expected fee rate %v, got %v", exp, got[0].FeePerByte)
+	}
+}
+
+func TestTrackerLookahead(t *testing.T) {
+	seed := wallet.NewSeed()
+	w := wallet.New(wallet.NewEphemeralStore())
+	tracker := newTestTracker(t, w)
+	pks := make([]types.SiaPublicKey, 10)
+	for i := range pks {
+		pks[i] = seed.PublicKey(uint64(i))
+	}
+	if err := tracker.AddPublicKeys(0, pks); err != nil {
+		t.Fatal(err)
+	}
+	addr := func(index uint64) types.UnlockHash { return wallet.StandardAddress(seed.PublicKey(index)) }
+
+	// the window is filled as soon as it is configured
+	tracker.SetLookahead(3)
+	if !w.OwnsAddress(addr(2)) || w.OwnsAddress(addr(3)) {
+		t.Fatal("wallet should watch exactly the first 3 addresses")
+	}
+
+	// a payment to an address in the window issues every index up to it, and
+	// advances the window
+	cc := modules.ConsensusChange{
+		AppliedBlocks: []types.Block{{Transactions: []types.Transaction{{
+			SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: addr(1)}},
+		}}}},
+	}
+	frand.Read(cc.ID[:])
+	tracker.ProcessConsensusChange(cc)
+	if index := tracker.ReservedSeedIndex(); index != 2 {
+		t.Fatal("expected issued index 2, got", index)
+	} else if !w.OwnsAddress(addr(4)) || w.OwnsAddress(addr(5)) {
+		t.Fatal("window should have advanced to index 4")
+	}
+
+	// the window is truncated when keys run out
+	if err := tracker.markIssued(8); err != nil {
+		t.Fatal(err)
+	} else if !w.OwnsAddress(addr(9)) || w.SeedIndex() != 10 {
+		t.Fatal("window should extend to the last imported key, got seed index", w.SeedIndex())
+	}
+
+	// the server reports the next unissued index, not the end of the window
+	srv := httptest.NewServer(NewServer(w, new(mockCS), stubTpool{}, WithTracker(tracker)))
+	defer srv.Close()
+	if index, err := NewClient(srv.URL).SeedIndex(); err != nil {
+		t.Fatal(err)
+	} else if index != 9 {
+		t.Fatal("expected seed index 9, got", index)
+	}
+}
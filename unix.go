@@ -0,0 +1,39 @@
+package walrus
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// unixPrefix is the scheme prefix of addresses that refer to a Unix domain
+// socket, e.g. unix:///var/run/walrus.sock.
+const unixPrefix = "unix://"
+
+// unixTransport returns a transport that connects to the Unix domain socket at
+// path, regardless of the requested host.
+func unixTransport(path string) *http.Transport {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = nil
+	tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	}
+	return tr
+}
+
+// Listen listens on the specified address, which is either a TCP host:port or
+// a Unix domain socket path of the form unix:///path/to/walrus.sock. Any
+// stale socket file at the path is removed first.
+func Listen(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, unixPrefix) {
+		return net.Listen("tcp", addr)
+	}
+	path := strings.TrimPrefix(addr, unixPrefix)
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,237 @@
+package walrus
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+	"lukechampine.com/us/wallet"
+)
+
+// vaultCheckInterval is how often the Tracker checks for withdrawals whose
+// delay has elapsed.
+var vaultCheckInterval = time.Minute
+
+// A VaultPolicy delays large withdrawals, giving the holder of a separate
+// recovery key time to cancel them if the wallet's signing key is
+// compromised.
+type VaultPolicy struct {
+	// Transaction sets sending more than this amount out of the wallet are
+	// delayed.
+	Threshold types.Currency `json:"threshold"`
+	Delay     time.Duration  `json:"delay"`
+	// The key that must sign cancellations.
+	RecoveryKey ed25519.PublicKey `json:"recoveryKey"`
+}
+
+// A PendingWithdrawal is a transaction set that is waiting out the vault
+// delay before being broadcast.
+type PendingWithdrawal struct {
+	ID           crypto.Hash         `json:"id"`
+	Transactions []types.Transaction `json:"transactions"`
+	// The value sent out of the wallet, including fees.
+	Value   types.Currency `json:"value"`
+	Queued  time.Time      `json:"queued"`
+	Release time.Time      `json:"release"`
+	// The most recent broadcast error, if any.
+	LastError string `json:"lastError"`
+}
+
+// withdrawalValue returns the value that txnSet sends out of w, including
+// fees.
+func withdrawalValue(w *wallet.SeedWallet, txnSet []types.Transaction) types.Currency {
+	value := types.ZeroCurrency
+	for _, txn := range txnSet {
+		for _, sco := range txn.SiacoinOutputs {
+			if !w.OwnsAddress(sco.UnlockHash) {
+				value = value.Add(sco.Value)
+			}
+		}
+		for _, fee := range txn.MinerFees {
+			value = value.Add(fee)
+		}
+	}
+	return value
+}
+
+// SignWithdrawalCancellation signs a request to cancel the specified pending
+// withdrawal with the specified timestamp, which should be the current time.
+func SignWithdrawalCancellation(key ed25519.PrivateKey, id crypto.Hash, timestamp time.Time) []byte {
+	return ed25519.Sign(key, signedMessage("cancel withdrawal "+id.String(), timestamp))
+}
+
+// SetVaultPolicy configures the Tracker to delay withdrawals according to p.
+// It must be called before the Tracker is passed to NewServer.
+func (t *Tracker) SetVaultPolicy(p VaultPolicy) error {
+	if len(p.RecoveryKey) != ed25519.PublicKeySize {
+		return errors.New("recovery key must be an ed25519 public key")
+	} else if p.Delay <= 0 {
+		return errors.New("delay must be positive")
+	}
+	t.vault = &p
+	return nil
+}
+
+// VaultPolicy returns the Tracker's vault policy, if any.
+func (t *Tracker) VaultPolicy() (VaultPolicy, bool) {
+	if t.vault == nil {
+		return VaultPolicy{}, false
+	}
+	return *t.vault, true
+}
+
+// requiresDelay reports whether txnSet must wait out the vault delay.
+func (t *Tracker) requiresDelay(txnSet []types.Transaction) bool {
+	return t.vault != nil && withdrawalValue(t.w, txnSet).Cmp(t.vault.Threshold) > 0
+}
+
+// QueueWithdrawal queues txnSet for broadcast once the vault delay has
+// elapsed. The transactions are added to Limbo immediately, so that their
+// inputs are not spent again.
+func (t *Tracker) QueueWithdrawal(txnSet []types.Transaction) (PendingWithdrawal, error) {
+	if t.vault == nil {
+		return PendingWithdrawal{}, errors.New("no vault policy is configured")
+	}
+	txids := make([]types.TransactionID, len(txnSet))
+	for i, txn := range txnSet {
+		txids[i] = txn.ID()
+	}
+	now := time.Now()
+	pw := PendingWithdrawal{
+		ID:           crypto.HashObject(txids),
+		Transactions: txnSet,
+		Value:        withdrawalValue(t.w, txnSet),
+		Queued:       now,
+		Release:      now.Add(t.vault.Delay),
+	}
+	err := t.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketWithdrawals)
+		if b.Get(pw.ID[:]) != nil {
+			return errors.New("transaction set is already queued")
+		}
+		return putJSON(b, pw.ID[:], pw)
+	})
+	if err != nil {
+		return PendingWithdrawal{}, err
+	}
+	for _, txn := range txnSet {
+		t.w.AddToLimbo(txn)
+	}
+	t.notifyLimbo(txnSet)
+	return pw, nil
+}
+
+// PendingWithdrawals returns the queued withdrawals, ordered by release time.
+func (t *Tracker) PendingWithdrawals() (pws []PendingWithdrawal) {
+	t.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketWithdrawals).ForEach(func(_, v []byte) error {
+			var pw PendingWithdrawal
+			if err := json.Unmarshal(v, &pw); err != nil {
+				return err
+			}
+			pws = append(pws, pw)
+			return nil
+		})
+	})
+	sort.Slice(pws, func(i, j int) bool {
+		return pws[i].Release.Before(pws[j].Release)
+	})
+	return
+}
+
+// withdrawalContaining returns the pending withdrawal containing the
+// specified transaction, if any.
+func (t *Tracker) withdrawalContaining(txid types.TransactionID) (PendingWithdrawal, bool) {
+	for _, pw := range t.PendingWithdrawals() {
+		for _, txn := range pw.Transactions {
+			if txn.ID() == txid {
+				return pw, true
+			}
+		}
+	}
+	return PendingWithdrawal{}, false
+}
+
+// CancelWithdrawal cancels the specified pending withdrawal and removes its
+// transactions from Limbo. sig must be the signature returned by
+// SignWithdrawalCancellation, made with the vault's recovery key.
+func (t *Tracker) CancelWithdrawal(id crypto.Hash, timestamp time.Time, sig []byte) error {
+	if t.vault == nil {
+		return errors.New("no vault policy is configured")
+	}
+	timestamp = time.Unix(timestamp.Unix(), 0)
+	if d := time.Since(timestamp); d > maxClockSkew || d < -maxClockSkew {
+		return errors.New("timestamp is too far from the server's clock")
+	} else if !ed25519.Verify(t.vault.RecoveryKey, signedMessage("cancel withdrawal "+id.String(), timestamp), sig) {
+		return errors.New("invalid signature")
+	}
+	var pw PendingWithdrawal
+	err := t.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketWithdrawals)
+		if !getJSON(b, id[:], &pw) {
+			return errors.New("no pending withdrawal with ID " + id.String())
+		}
+		return b.Delete(id[:])
+	})
+	if err != nil {
+		return err
+	}
+	for _, txn := range pw.Transactions {
+		t.w.RemoveFromLimbo(txn.ID())
+	}
+	return nil
+}
+
+// WatchVault starts a goroutine that broadcasts pending withdrawals via tp
+// once their delay has elapsed. Failed broadcasts are retried. On a standby
+// instance, nothing is broadcast.
+func (t *Tracker) WatchVault(tp TransactionPool) {
+	go func() {
+		ticker := time.NewTicker(vaultCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-t.closed:
+				return
+			}
+			if t.isLeader() {
+				t.releaseWithdrawals(tp, time.Now())
+			}
+		}
+	}()
+}
+
+// releaseWithdrawals broadcasts the pending withdrawals whose delay has
+// elapsed as of now.
+func (t *Tracker) releaseWithdrawals(tp TransactionPool, now time.Time) {
+	for _, pw := range t.PendingWithdrawals() {
+		if now.Before(pw.Release) {
+			break
+		}
+		err := tp.AcceptTransactionSet(pw.Transactions)
+		if err == modules.ErrDuplicateTransactionSet {
+			err = nil
+		}
+		if err == nil {
+			t.AddLimboSet(pw.Transactions)
+		}
+		t.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(bucketWithdrawals)
+			// the withdrawal may have been cancelled in the meantime
+			if b.Get(pw.ID[:]) == nil {
+				return nil
+			} else if err == nil {
+				return b.Delete(pw.ID[:])
+			}
+			pw.LastError = err.Error()
+			return putJSON(b, pw.ID[:], pw)
+		})
+	}
+}
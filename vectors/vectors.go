@@ -0,0 +1,264 @@
+// Package vectors provides deterministic test vectors for the walrus API.
+//
+// Every vector is derived from a fixed seed, so the output of this package
+// never changes. Third-party client authors and auditors can compare their own
+// address derivation, transaction encoding, signing, and request and response
+// handling byte-for-byte against these values. The vectors can be printed as
+// JSON with 'walrus vectors'.
+//
+// The seed is public; never send real siacoins to any address derived from
+// it.
+package vectors
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+	"lukechampine.com/walrus"
+	"lukechampine.com/walrus/api"
+)
+
+// Entropy is the entropy of the seed from which every vector is derived.
+var Entropy = [16]byte{0x77, 0x61, 0x6c, 0x72, 0x75, 0x73, 0x20, 0x74, 0x65, 0x73, 0x74, 0x20, 0x73, 0x65, 0x65, 0x64}
+
+// Timestamp is the timestamp used in every vector that requires one.
+var Timestamp = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Seed returns the seed from which every vector is derived.
+func Seed() wallet.Seed {
+	return wallet.SeedFromEntropy(Entropy)
+}
+
+// An Address is an address derived from the seed.
+type Address struct {
+	Index     uint64           `json:"index"`
+	PublicKey string           `json:"publicKey"`
+	SecretKey string           `json:"secretKey"`
+	Address   types.UnlockHash `json:"address"`
+	// The address's entry in the /seedindex/preview response.
+	Encoded json.RawMessage `json:"encoded"`
+}
+
+// A Transaction is a signed transaction spending outputs of addresses derived
+// from the seed.
+type Transaction struct {
+	Description string              `json:"description"`
+	ID          types.TransactionID `json:"id"`
+	// The hex-encoded Sia binary encoding, as used for IDs and signatures.
+	Binary string `json:"binary"`
+	// The encoding used in walrus responses, e.g. /transactions/:txid/raw.
+	Encoded json.RawMessage `json:"encoded"`
+	// The encoding accepted by /broadcast.
+	Request json.RawMessage `json:"request"`
+}
+
+// An Exchange is an example request to the API and the response a server
+// would return.
+type Exchange struct {
+	Description string          `json:"description"`
+	Method      string          `json:"method"`
+	Route       string          `json:"route"`
+	Request     json.RawMessage `json:"request,omitempty"`
+	Response    json.RawMessage `json:"response,omitempty"`
+}
+
+// Vectors is the complete set of test vectors.
+type Vectors struct {
+	SeedPhrase   string        `json:"seedPhrase"`
+	Addresses    []Address     `json:"addresses"`
+	Transactions []Transaction `json:"transactions"`
+	Exchanges    []Exchange    `json:"exchanges"`
+}
+
+func mustJSON(v interface{}) json.RawMessage {
+	js, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return js
+}
+
+// Addresses returns the first n addresses derived from the seed.
+func Addresses(n int) []Address {
+	seed := Seed()
+	addrs := make([]Address, n)
+	for i := range addrs {
+		index := uint64(i)
+		info := wallet.SeedAddressInfo{
+			UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(index)),
+			KeyIndex:         index,
+		}
+		addr := info.UnlockConditions.UnlockHash()
+		addrs[i] = Address{
+			Index:     index,
+			PublicKey: seed.PublicKey(index).String(),
+			SecretKey: hex.EncodeToString(seed.SecretKey(index)),
+			Address:   addr,
+			Encoded:   mustJSON(walrus.ResponseSeedIndexPreview{SeedAddressInfo: info, Address: addr}),
+		}
+	}
+	return addrs
+}
+
+// parentID returns a deterministic output ID for the i'th input of the
+// vectors.
+func parentID(i int) types.SiacoinOutputID {
+	return types.SiacoinOutputID(crypto.HashAll("walrus test vector", uint64(i)))
+}
+
+// signedTransactions returns the transactions used by the vectors, along
+// with their descriptions. The signatures are valid after the ASIC hardfork
+// height.
+func signedTransactions() ([]types.Transaction, []string) {
+	seed := Seed()
+	// each input spends an output of the address with the same key index
+	input := func(parent int, keyIndex uint64) types.SiacoinInput {
+		return types.SiacoinInput{
+			ParentID:         parentID(parent),
+			UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(keyIndex)),
+		}
+	}
+	addr := func(keyIndex uint64) types.UnlockHash {
+		return wallet.StandardAddress(seed.PublicKey(keyIndex))
+	}
+	external := types.UnlockHash(crypto.HashObject("walrus test vector external address"))
+
+	vs := []struct {
+		desc string
+		txn  types.Transaction
+		keys []uint64
+	}{
+		{
+			desc: "a payment of 7 SC to an external address, with 2 SC of change and a 1 SC fee",
+			txn: types.Transaction{
+				SiacoinInputs: []types.SiacoinInput{input(0, 0)},
+				SiacoinOutputs: []types.SiacoinOutput{
+					{Value: types.SiacoinPrecision.Mul64(7), UnlockHash: external},
+					{Value: types.SiacoinPrecision.Mul64(2), UnlockHash: addr(1)},
+				},
+				MinerFees: []types.Currency{types.SiacoinPrecision},
+			},
+			keys: []uint64{0},
+		},
+		{
+			desc: "a consolidation of two inputs into one output, with a 1 SC fee",
+			txn: types.Transaction{
+				SiacoinInputs: []types.SiacoinInput{input(1, 1), input(2, 2)},
+				SiacoinOutputs: []types.SiacoinOutput{
+					{Value: types.SiacoinPrecision.Mul64(19), UnlockHash: addr(3)},
+				},
+				MinerFees: []types.Currency{types.SiacoinPrecision},
+			},
+			keys: []uint64{1, 2},
+		},
+	}
+	txns := make([]types.Transaction, len(vs))
+	descs := make([]string, len(vs))
+	for i, v := range vs {
+		txn := v.txn
+		for j, sci := range txn.SiacoinInputs {
+			txnSig := wallet.StandardTransactionSignature(crypto.Hash(sci.ParentID))
+			wallet.AppendTransactionSignature(&txn, txnSig, seed.SecretKey(v.keys[j]))
+		}
+		txns[i], descs[i] = txn, v.desc
+	}
+	return txns, descs
+}
+
+// Transactions returns the signed transaction vectors.
+func Transactions() []Transaction {
+	txns, descs := signedTransactions()
+	vs := make([]Transaction, len(txns))
+	for i, txn := range txns {
+		// extract the walrus encoding of the transaction from a response
+		var raw struct {
+			Transaction json.RawMessage `json:"transaction"`
+		}
+		json.Unmarshal(mustJSON(walrus.ResponseTransactionsIDRaw{Transaction: txn}), &raw)
+		vs[i] = Transaction{
+			Description: descs[i],
+			ID:          txn.ID(),
+			Binary:      hex.EncodeToString(encoding.Marshal(txn)),
+			Encoded:     raw.Transaction,
+			Request:     mustJSON(txn),
+		}
+	}
+	return vs
+}
+
+// Exchanges returns example requests and responses.
+func Exchanges() []Exchange {
+	txns, _ := signedTransactions()
+	addrs := Addresses(2)
+	size := len(encoding.Marshal(txns[0]))
+
+	return []Exchange{
+		{
+			Description: "import the first two public keys of the seed",
+			Method:      "POST",
+			Route:       api.PubKeys,
+			Request: mustJSON(walrus.RequestPublicKeys{
+				StartIndex: 0,
+				PublicKeys: []string{addrs[0].PublicKey, addrs[1].PublicKey},
+			}),
+		},
+		{
+			Description: "broadcast the payment transaction",
+			Method:      "POST",
+			Route:       api.Broadcast,
+			Request:     mustJSON(txns[:1]),
+			Response: mustJSON(walrus.ResponseBroadcast{
+				Transactions: []walrus.ResponseBroadcastTransaction{{
+					ID:         txns[0].ID(),
+					Size:       size,
+					FeePerByte: types.SiacoinPrecision.Div64(uint64(size)),
+					Result:     walrus.BroadcastAccepted,
+				}},
+				RelayPeers: 8,
+			}),
+		},
+		{
+			Description: "fetch the raw payment transaction after it is confirmed at height 250000",
+			Method:      "GET",
+			Route:       api.Path(api.TransactionsTxIDRaw, txns[0].ID().String()),
+			Response: mustJSON(walrus.ResponseTransactionsIDRaw{
+				Transaction: txns[0],
+				BlockID:     types.BlockID(crypto.HashObject("walrus test vector block")),
+				BlockHeight: 250000,
+				Confirmed:   true,
+			}),
+		},
+		{
+			Description: "send an inheritance heartbeat signed with the seed's first key",
+			Method:      "POST",
+			Route:       api.InheritanceHeartbeat,
+			Request: mustJSON(walrus.RequestHeartbeat{
+				Timestamp: Timestamp,
+				Signature: hex.EncodeToString(walrus.SignHeartbeat(ed25519.PrivateKey(Seed().SecretKey(0)), Timestamp)),
+			}),
+		},
+	}
+}
+
+// All returns the complete set of test vectors.
+func All() Vectors {
+	return Vectors{
+		SeedPhrase:   Seed().String(),
+		Addresses:    Addresses(4),
+		Transactions: Transactions(),
+		Exchanges:    Exchanges(),
+	}
+}
+
+// MarshalIndentedJSON encodes the complete set of test vectors as indented
+// JSON.
+func MarshalIndentedJSON() []byte {
+	js, _ := json.MarshalIndent(All(), "", "\t")
+	return append(js, '\n')
+}
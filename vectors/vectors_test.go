@@ -0,0 +1,44 @@
+package vectors
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/walrus"
+	"lukechampine.com/walrus/api"
+)
+
+func TestVectors(t *testing.T) {
+	if !bytes.Equal(MarshalIndentedJSON(), MarshalIndentedJSON()) {
+		t.Fatal("vectors are not deterministic")
+	}
+	txns, _ := signedTransactions()
+	for i, v := range Transactions() {
+		if err := txns[i].StandaloneValid(types.ASICHardforkHeight + 1); err != nil {
+			t.Errorf("transaction %v is invalid: %v", i, err)
+		} else if v.Binary != hex.EncodeToString(encoding.Marshal(txns[i])) {
+			t.Errorf("transaction %v has wrong binary encoding", i)
+		}
+	}
+
+	for _, e := range Exchanges() {
+		if e.Route != api.InheritanceHeartbeat {
+			continue
+		}
+		var rh walrus.RequestHeartbeat
+		if err := json.Unmarshal(e.Request, &rh); err != nil {
+			t.Fatal(err)
+		}
+		sig, _ := hex.DecodeString(rh.Signature)
+		msg := []byte("walrus heartbeat " + strconv.FormatInt(rh.Timestamp.Unix(), 10))
+		if !ed25519.Verify(ed25519.PublicKey(Seed().PublicKey(0).Key), msg, sig) {
+			t.Error("heartbeat signature is invalid")
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package walrus
+
+import (
+	"context"
+	"sort"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+)
+
+// Discrepancy types.
+const (
+	// A relevant transaction in the blockchain is not in the wallet.
+	DiscrepancyMissingTransaction = "missingTransaction"
+	// A wallet transaction is not in the block that the wallet recorded.
+	DiscrepancyPhantomTransaction = "phantomTransaction"
+	// An unspent output in the blockchain is not in the wallet.
+	DiscrepancyMissingOutput = "missingOutput"
+	// An unspent wallet output has been spent in the blockchain.
+	DiscrepancyPhantomOutput = "phantomOutput"
+)
+
+// A Discrepancy is an inconsistency between the wallet and the blockchain.
+type Discrepancy struct {
+	Type string `json:"type"`
+	// The transaction or output ID.
+	ID          crypto.Hash       `json:"id"`
+	BlockHeight types.BlockHeight `json:"blockHeight"`
+}
+
+// A VerifyReport is the result of checking the wallet against the blockchain.
+type VerifyReport struct {
+	// The range of blocks checked, inclusive.
+	StartHeight   types.BlockHeight `json:"startHeight"`
+	EndHeight     types.BlockHeight `json:"endHeight"`
+	Discrepancies []Discrepancy     `json:"discrepancies"`
+}
+
+// An IndexRebuilder rebuilds the wallet's index from the blockchain, e.g. by
+// resetting the wallet's store and rescanning.
+type IndexRebuilder interface {
+	RebuildIndex() error
+}
+
+// VerifyWallet cross-checks the wallet against the most recent depth blocks
+// of cs, or against the entire blockchain if depth is 0.
+//
+// Outputs that were created before the checked range, and block rewards that
+// have not yet matured, cannot be verified.
+func VerifyWallet(w *wallet.SeedWallet, cs ConsensusSet, depth types.BlockHeight) VerifyReport {
+	r, _ := verifyWallet(context.Background(), w, cs, depth, func(_, _, _ types.BlockHeight, _ int) {})
+	return r
+}
+
+// verifyWallet implements VerifyWallet, calling progress after checking each
+// block and returning early if ctx is cancelled.
+func verifyWallet(ctx context.Context, w *wallet.SeedWallet, cs ConsensusSet, depth types.BlockHeight, progress func(start, current, end types.BlockHeight, found int)) (VerifyReport, error) {
+	height := cs.Height()
+	var start types.BlockHeight
+	if depth != 0 && depth <= height {
+		start = height - depth + 1
+	}
+	r := VerifyReport{StartHeight: start, EndHeight: height}
+	add := func(typ string, id crypto.Hash, height types.BlockHeight) {
+		r.Discrepancies = append(r.Discrepancies, Discrepancy{typ, id, height})
+	}
+
+	created := make(map[types.SiacoinOutputID]types.BlockHeight)
+	spent := make(map[types.SiacoinOutputID]types.BlockHeight)
+	blockIDs := make(map[types.TransactionID]types.BlockID)
+	for h := start; h <= height; h++ {
+		if ctx.Err() != nil {
+			return r, ctx.Err()
+		}
+		b, ok := cs.BlockAtHeight(h)
+		if !ok {
+			break
+		}
+		for i, mp := range b.MinerPayouts {
+			// immature rewards are not yet in the wallet
+			if w.OwnsAddress(mp.UnlockHash) && h+types.MaturityDelay <= height {
+				created[b.MinerPayoutID(uint64(i))] = h
+			}
+		}
+		for _, txn := range b.Transactions {
+			txid := txn.ID()
+			blockIDs[txid] = b.ID()
+			relevant := false
+			for _, sci := range txn.SiacoinInputs {
+				spent[sci.ParentID] = h
+				relevant = relevant || w.OwnsAddress(sci.UnlockConditions.UnlockHash())
+			}
+			for i, sco := range txn.SiacoinOutputs {
+				if w.OwnsAddress(sco.UnlockHash) {
+					created[txn.SiacoinOutputID(uint64(i))] = h
+					relevant = true
+				}
+			}
+			if _, ok := w.Transaction(txid); relevant && !ok {
+				add(DiscrepancyMissingTransaction, crypto.Hash(txid), h)
+			}
+		}
+		progress(start, h, height, len(r.Discrepancies))
+	}
+
+	for _, txid := range w.Transactions(-1) {
+		txn, ok := w.Transaction(txid)
+		if !ok || txn.BlockHeight < start || txn.BlockHeight > height {
+			continue
+		}
+		if blockIDs[txid] != txn.BlockID {
+			add(DiscrepancyPhantomTransaction, crypto.Hash(txid), txn.BlockHeight)
+		}
+	}
+
+	unspent := make(map[types.SiacoinOutputID]bool)
+	for _, o := range w.UnspentOutputs(false) {
+		unspent[o.ID] = true
+		if h, ok := spent[o.ID]; ok {
+			add(DiscrepancyPhantomOutput, crypto.Hash(o.ID), h)
+		}
+	}
+	for id, h := range created {
+		if _, ok := spent[id]; !ok && !unspent[id] {
+			add(DiscrepancyMissingOutput, crypto.Hash(id), h)
+		}
+	}
+	sort.SliceStable(r.Discrepancies, func(i, j int) bool {
+		return r.Discrepancies[i].BlockHeight < r.Discrepancies[j].BlockHeight
+	})
+	return r, nil
+}
@@ -0,0 +1,117 @@
+package walrus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"lukechampine.com/walrus/api"
+)
+
+// Version is the version of walrus.
+const Version = "0.3.0"
+
+// APIRevision is the revision of the API implemented by this version of the
+// server, and expected by this version of the Client. It is incremented
+// whenever routes are added or changed in a way that clients may depend on.
+// Servers that predate the /version endpoint are considered to be revision 0.
+const APIRevision = 1
+
+// Optional features reported by the /version endpoint.
+const (
+	// Routes that require a Tracker, such as /events and /deposits.
+	FeatureTracker = "tracker"
+	// Signed statements, via /reports/statement.
+	FeatureStatements = "statements"
+	// Address derivation, via /addresses/next and /seedindex/preview.
+	FeatureKeySource = "keySource"
+	// Repairing the wallet's index, via /db/verify.
+	FeatureIndexRepair = "indexRepair"
+	// Leader election among redundant servers.
+	FeatureLeader = "leader"
+	// A simulated blockchain, manipulated via the /sandbox routes.
+	FeatureSandbox = "sandbox"
+)
+
+// ErrIncompatibleServer is returned by a Client configured with
+// WithCompatibilityCheck if the server's API revision is too old.
+var ErrIncompatibleServer = errors.New("server is too old for this client")
+
+// features returns the optional features enabled on the server.
+func (s *server) features() []string {
+	fs := make([]string, 0, 6)
+	if s.t != nil {
+		fs = append(fs, FeatureTracker)
+		if s.statementKey != nil {
+			fs = append(fs, FeatureStatements)
+		}
+	}
+	if s.keys != nil {
+		fs = append(fs, FeatureKeySource)
+	}
+	if s.rebuild != nil {
+		fs = append(fs, FeatureIndexRepair)
+	}
+	if s.leader != nil {
+		fs = append(fs, FeatureLeader)
+	}
+	if s.sandbox != nil {
+		fs = append(fs, FeatureSandbox)
+	}
+	return fs
+}
+
+// ServerVersion returns the server's version, API revision, and enabled
+// features.
+func (c *Client) ServerVersion() (v ResponseVersion, err error) {
+	err = c.get(api.Version, &v)
+	return
+}
+
+// A compatibilityCheck records the result of checking the server's API
+// revision. It is shared by copies of a Client.
+type compatibilityCheck struct {
+	minRevision int
+	mu          sync.Mutex
+	done        bool
+	err         error
+}
+
+// check returns a non-nil error if the server's API revision is below the
+// minimum. Once the revision is known, the result is cached, so that requests
+// to an incompatible server fail immediately; other errors, such as the server
+// being unreachable, are returned without being cached.
+func (cc *compatibilityCheck) check(ctx context.Context, c *Client) error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.done {
+		return cc.err
+	}
+	c2 := *c
+	c2.ctx = ctx
+	c2.compat = nil
+	v, err := c2.ServerVersion()
+	if errors.Is(err, ErrNotFound) {
+		// the server predates /version
+		v.APIRevision, err = 0, nil
+	}
+	if err != nil {
+		return err
+	}
+	if v.APIRevision < cc.minRevision {
+		cc.err = fmt.Errorf("%w (server API revision %v, client requires %v)", ErrIncompatibleServer, v.APIRevision, cc.minRevision)
+	}
+	cc.done = true
+	return cc.err
+}
+
+// WithCompatibilityCheck configures the Client to check the server's API
+// revision before its first request. If the server's revision is older than
+// APIRevision, that request and all subsequent requests fail immediately with
+// ErrIncompatibleServer.
+func WithCompatibilityCheck() ClientOption {
+	return func(c *Client) {
+		c.compat = &compatibilityCheck{minRevision: APIRevision}
+	}
+}
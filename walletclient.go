@@ -0,0 +1,41 @@
+package walrus
+
+import (
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+)
+
+// A WalletClient manages a wallet: its addresses, balance, outputs,
+// transactions, and Limbo. It is the subset of the Client's methods that
+// typical integrations, such as exchange backends, depend on. Accepting a
+// WalletClient rather than a *Client allows such code to be tested against an
+// in-memory implementation, such as walrustest.Wallet, instead of a live
+// server.
+type WalletClient interface {
+	Addresses() ([]types.UnlockHash, error)
+	AddressInfo(addr types.UnlockHash) (wallet.SeedAddressInfo, error)
+	AddAddress(info wallet.SeedAddressInfo) error
+	RemoveAddress(addr types.UnlockHash) error
+	SeedIndex() (uint64, error)
+	ReserveSeedIndices(count int) (start, end uint64, err error)
+
+	ConsensusInfo() (ResponseConsensus, error)
+	Balance(limbo bool) (types.Currency, error)
+	UnspentOutputs(limbo bool, opts ...ResponseOptions) ([]ResponseUnspentOutput, error)
+	Transactions(max int) ([]types.TransactionID, error)
+	TransactionsByAddress(addr types.UnlockHash, max int) ([]types.TransactionID, error)
+	Transaction(txid types.TransactionID, opts ...ResponseOptions) (ResponseTransactionsID, error)
+	Memo(txid types.TransactionID) ([]byte, error)
+	SetMemo(txid types.TransactionID, memo []byte) error
+
+	FeeTiers() ([]ResponseFeeTier, error)
+	RecommendedFee() (types.Currency, error)
+	UnconfirmedParents(txn types.Transaction) ([]wallet.LimboTransaction, error)
+	Broadcast(txnSet []types.Transaction) (ResponseBroadcast, error)
+	LimboTransactions() ([]wallet.LimboTransaction, error)
+	LimboTransaction(txid types.TransactionID) (wallet.LimboTransaction, error)
+	AddToLimbo(txn types.Transaction) error
+	RemoveFromLimbo(txid types.TransactionID) error
+}
+
+var _ WalletClient = (*Client)(nil)
@@ -0,0 +1,325 @@
+package walrustest
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"sync"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/walrus"
+)
+
+// A Chain is a simulated blockchain. It implements walrus.ConsensusSet,
+// walrus.TransactionPool, and walrus.Sandbox. Transactions are checked for
+// double-spends, but are otherwise not validated. The chain only advances
+// when a block is mined explicitly.
+type Chain struct {
+	mu          sync.Mutex
+	blocks      []types.Block                 // including the genesis block
+	diffs       [][]modules.SiacoinOutputDiff // the diffs applied by each block
+	utxos       map[types.SiacoinOutputID]types.SiacoinOutput
+	pool        []types.Transaction
+	faucet      map[types.TransactionID]bool
+	minFee      types.Currency
+	maxFee      types.Currency
+	nonce       uint64
+	subscribers []modules.ConsensusSetSubscriber
+}
+
+var _ walrus.Sandbox = (*Chain)(nil)
+
+// NewChain returns a Chain containing only the genesis block.
+func NewChain() *Chain {
+	fee := types.SiacoinPrecision.Div64(1e6) // 1 uS/byte
+	return &Chain{
+		blocks: []types.Block{types.GenesisBlock},
+		diffs:  [][]modules.SiacoinOutputDiff{nil},
+		utxos:  make(map[types.SiacoinOutputID]types.SiacoinOutput),
+		faucet: make(map[types.TransactionID]bool),
+		minFee: fee,
+		maxFee: fee.Mul64(3),
+	}
+}
+
+// BlockAtHeight implements walrus.ConsensusSet.
+func (c *Chain) BlockAtHeight(height types.BlockHeight) (types.Block, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if height >= types.BlockHeight(len(c.blocks)) {
+		return types.Block{}, false
+	}
+	return c.blocks[height], true
+}
+
+// CurrentBlock implements walrus.ConsensusSet.
+func (c *Chain) CurrentBlock() types.Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.blocks[len(c.blocks)-1]
+}
+
+// ChildTarget implements walrus.ConsensusSet.
+func (c *Chain) ChildTarget(types.BlockID) (types.Target, bool) { return types.RootTarget, true }
+
+// Height implements walrus.ConsensusSet.
+func (c *Chain) Height() types.BlockHeight {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return types.BlockHeight(len(c.blocks) - 1)
+}
+
+// FeeEstimation implements walrus.TransactionPool.
+func (c *Chain) FeeEstimation() (min, max types.Currency) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.minFee, c.maxFee
+}
+
+// SetFees sets the fee estimate, in hastings per byte, of the simulated
+// transaction pool.
+func (c *Chain) SetFees(min, max types.Currency) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.minFee, c.maxFee = min, max
+}
+
+// validTransactions returns the transactions in txns that spend existing,
+// unspent outputs, in order. Outputs created by earlier transactions in txns
+// may be spent by later ones.
+func (c *Chain) validTransactions(txns []types.Transaction) (valid []types.Transaction, err error) {
+	seen := make(map[types.TransactionID]bool)
+	spent := make(map[types.SiacoinOutputID]bool)
+	created := make(map[types.SiacoinOutputID]bool)
+outer:
+	for _, txn := range txns {
+		if seen[txn.ID()] {
+			continue
+		}
+		seen[txn.ID()] = true
+		for _, sci := range txn.SiacoinInputs {
+			if _, ok := c.utxos[sci.ParentID]; !ok && !created[sci.ParentID] {
+				err = errors.New("transaction spends nonexistent output " + sci.ParentID.String())
+				continue outer
+			} else if spent[sci.ParentID] {
+				err = errors.New("transaction double-spends output " + sci.ParentID.String())
+				continue outer
+			}
+		}
+		for _, sci := range txn.SiacoinInputs {
+			spent[sci.ParentID] = true
+		}
+		for i := range txn.SiacoinOutputs {
+			created[txn.SiacoinOutputID(uint64(i))] = true
+		}
+		valid = append(valid, txn)
+	}
+	return valid, err
+}
+
+// AcceptTransactionSet implements walrus.TransactionPool. The set is added to
+// the pool, to be included in the next block. It returns an error if the set
+// spends an output that does not exist or is already spent.
+func (c *Chain) AcceptTransactionSet(txnSet []types.Transaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(txnSet) == 0 {
+		return errors.New("empty transaction set")
+	}
+	valid, err := c.validTransactions(append(c.pool[:len(c.pool):len(c.pool)], txnSet...))
+	if err != nil {
+		return err
+	} else if len(valid) == len(c.pool) {
+		return modules.ErrDuplicateTransactionSet
+	}
+	c.pool = valid
+	return nil
+}
+
+// Transaction returns the pooled transaction with the specified ID, along with
+// its parents in the pool.
+func (c *Chain) Transaction(id types.TransactionID) (types.Transaction, []types.Transaction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, txn := range c.pool {
+		if txn.ID() == id {
+			return txn, append([]types.Transaction(nil), c.pool[:i]...), true
+		}
+	}
+	return types.Transaction{}, nil, false
+}
+
+// Subscribe sends the entire chain to s as a single consensus change, and
+// sends it each subsequent change.
+func (c *Chain) Subscribe(s modules.ConsensusSetSubscriber) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cc := c.newChange()
+	for i := range c.blocks {
+		cc.AppliedBlocks = append(cc.AppliedBlocks, c.blocks[i])
+		cc.SiacoinOutputDiffs = append(cc.SiacoinOutputDiffs, c.diffs[i]...)
+	}
+	s.ProcessConsensusChange(cc)
+	c.subscribers = append(c.subscribers, s)
+}
+
+// newChange returns an empty consensus change identified by the current
+// block.
+func (c *Chain) newChange() modules.ConsensusChange {
+	return modules.ConsensusChange{
+		ID:          modules.ConsensusChangeID(crypto.HashObject(c.blocks[len(c.blocks)-1].ID())),
+		ChildTarget: types.RootTarget,
+		Synced:      true,
+	}
+}
+
+// notify sends cc to each subscriber. The change's ID is updated to reflect the
+// current block.
+func (c *Chain) notify(cc modules.ConsensusChange) {
+	cc.ID = c.newChange().ID
+	for _, s := range c.subscribers {
+		s.ProcessConsensusChange(cc)
+	}
+}
+
+// applyBlock adds a block containing txns to the chain, and records it in cc.
+func (c *Chain) applyBlock(cc *modules.ConsensusChange, txns []types.Transaction) types.Block {
+	parent := c.blocks[len(c.blocks)-1]
+	c.nonce++
+	b := types.Block{
+		ParentID:     parent.ID(),
+		Timestamp:    types.CurrentTimestamp(),
+		Transactions: txns,
+	}
+	binary.LittleEndian.PutUint64(b.Nonce[:], c.nonce)
+	if b.Timestamp <= parent.Timestamp {
+		b.Timestamp = parent.Timestamp + 1
+	}
+	var diffs []modules.SiacoinOutputDiff
+	for _, txn := range b.Transactions {
+		for _, sci := range txn.SiacoinInputs {
+			if sco, ok := c.utxos[sci.ParentID]; ok {
+				diffs = append(diffs, modules.SiacoinOutputDiff{
+					Direction:     modules.DiffRevert,
+					ID:            sci.ParentID,
+					SiacoinOutput: sco,
+				})
+				delete(c.utxos, sci.ParentID)
+			}
+		}
+		for i, sco := range txn.SiacoinOutputs {
+			id := txn.SiacoinOutputID(uint64(i))
+			diffs = append(diffs, modules.SiacoinOutputDiff{
+				Direction:     modules.DiffApply,
+				ID:            id,
+				SiacoinOutput: sco,
+			})
+			c.utxos[id] = sco
+		}
+	}
+	c.blocks = append(c.blocks, b)
+	c.diffs = append(c.diffs, diffs)
+	cc.AppliedBlocks = append(cc.AppliedBlocks, b)
+	cc.SiacoinOutputDiffs = append(cc.SiacoinOutputDiffs, diffs...)
+	return b
+}
+
+// revertBlock removes the current block from the chain, and records it in cc.
+func (c *Chain) revertBlock(cc *modules.ConsensusChange) types.Block {
+	b, diffs := c.blocks[len(c.blocks)-1], c.diffs[len(c.diffs)-1]
+	for i := len(diffs) - 1; i >= 0; i-- {
+		diff := diffs[i]
+		if diff.Direction == modules.DiffApply {
+			delete(c.utxos, diff.ID)
+			diff.Direction = modules.DiffRevert
+		} else {
+			c.utxos[diff.ID] = diff.SiacoinOutput
+			diff.Direction = modules.DiffApply
+		}
+		cc.SiacoinOutputDiffs = append(cc.SiacoinOutputDiffs, diff)
+	}
+	c.blocks = c.blocks[:len(c.blocks)-1]
+	c.diffs = c.diffs[:len(c.diffs)-1]
+	cc.RevertedBlocks = append(cc.RevertedBlocks, b)
+	return b
+}
+
+// MineBlock mines a block containing the transactions in the pool, along with
+// txns, and returns it. Once MineBlock returns, the block has been processed
+// by each subscriber.
+func (c *Chain) MineBlock(txns ...types.Transaction) types.Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cc := c.newChange()
+	b := c.applyBlock(&cc, append(c.pool, txns...))
+	c.pool = nil
+	c.notify(cc)
+	return b
+}
+
+// Faucet implements walrus.Sandbox. It mines a block containing a transaction
+// that sends value to addr out of thin air.
+func (c *Chain) Faucet(addr types.UnlockHash, value types.Currency) (types.TransactionID, error) {
+	c.mu.Lock()
+	c.nonce++
+	txn := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{UnlockHash: addr, Value: value}},
+		// ensure that each transaction has a unique ID
+		ArbitraryData: [][]byte{[]byte("walrustest " + strconv.FormatUint(c.nonce, 10))},
+	}
+	c.faucet[txn.ID()] = true
+	c.mu.Unlock()
+	c.MineBlock(txn)
+	return txn.ID(), nil
+}
+
+// Mine implements walrus.Sandbox. The first block contains the transactions
+// in the pool; the rest are empty.
+func (c *Chain) Mine(n int) ([]types.BlockID, error) {
+	if n < 1 {
+		return nil, errors.New("must mine at least one block")
+	}
+	ids := make([]types.BlockID, n)
+	for i := range ids {
+		ids[i] = c.MineBlock().ID()
+	}
+	return ids, nil
+}
+
+// Reorg implements walrus.Sandbox. It replaces the most recent depth blocks
+// with depth+1 new blocks, in a single consensus change. Transactions in the
+// reverted blocks that are still valid are included in the first new block,
+// along with the transactions in the pool; transactions created by Faucet are
+// discarded instead, simulating deposits that were double-spent, as are any
+// transactions that depend on them.
+func (c *Chain) Reorg(depth int) ([]types.BlockID, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if depth < 1 || depth >= len(c.blocks) {
+		return nil, errors.New("depth must be between 1 and the current height")
+	}
+	cc := c.newChange()
+	reverted := make([][]types.Transaction, depth)
+	for i := range reverted {
+		reverted[depth-i-1] = c.revertBlock(&cc).Transactions
+	}
+	var txns []types.Transaction
+	for _, b := range reverted {
+		for _, txn := range b {
+			if !c.faucet[txn.ID()] {
+				txns = append(txns, txn)
+			}
+		}
+	}
+	txns, _ = c.validTransactions(append(txns, c.pool...))
+	c.pool = nil
+	ids := make([]types.BlockID, depth+1)
+	for i := range ids {
+		ids[i] = c.applyBlock(&cc, txns).ID()
+		txns = nil
+	}
+	c.notify(cc)
+	return ids, nil
+}
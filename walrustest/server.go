@@ -0,0 +1,102 @@
+package walrustest
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+	"lukechampine.com/walrus"
+)
+
+// A Server is a walrus server backed by an in-memory wallet and a simulated
+// blockchain, for integration tests that exercise the real API without siad.
+// The blockchain only advances when a block is mined, either by the Server's
+// methods or via the server's /sandbox routes.
+type Server struct {
+	// The base URL of the server, e.g. http://127.0.0.1:1234.
+	URL     string
+	Wallet  *wallet.SeedWallet
+	Tracker *walrus.Tracker
+
+	chain *Chain
+	srv   *httptest.Server
+	dir   string
+}
+
+// NewServer starts a Server, with a Tracker and sandbox routes, configured
+// with opts. The server should be closed when it is no longer needed.
+func NewServer(opts ...walrus.ServerOption) (*Server, error) {
+	dir, err := ioutil.TempDir("", "walrustest")
+	if err != nil {
+		return nil, err
+	}
+	store := wallet.NewEphemeralStore()
+	w := wallet.New(store)
+	t, err := walrus.NewTracker(w, filepath.Join(dir, "walrus.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	c := NewChain()
+	// the tracker must be subscribed after the wallet
+	c.Subscribe(w.ConsensusSetSubscriber(store))
+	c.Subscribe(t)
+	opts = append([]walrus.ServerOption{walrus.WithTracker(t), walrus.WithSandbox(c)}, opts...)
+	srv := httptest.NewServer(walrus.NewServer(w, c, c, opts...))
+	return &Server{
+		URL:     srv.URL,
+		Wallet:  w,
+		Tracker: t,
+		chain:   c,
+		srv:     srv,
+		dir:     dir,
+	}, nil
+}
+
+// Client returns a Client for the server.
+func (s *Server) Client(opts ...walrus.ClientOption) *walrus.Client {
+	return walrus.NewClient(s.URL, opts...)
+}
+
+// SetFees sets the fee estimate, in hastings per byte, of the simulated
+// transaction pool.
+func (s *Server) SetFees(min, max types.Currency) {
+	s.chain.SetFees(min, max)
+}
+
+// Height returns the height of the simulated blockchain.
+func (s *Server) Height() types.BlockHeight {
+	return s.chain.Height()
+}
+
+// MineBlock mines a block containing every transaction broadcast since the
+// previous block, along with txns, and returns its ID. Once MineBlock returns,
+// the block has been processed by the wallet and the Tracker.
+func (s *Server) MineBlock(txns ...types.Transaction) types.BlockID {
+	return s.chain.MineBlock(txns...).ID()
+}
+
+// Credit mines a block containing a transaction that sends value to addr out
+// of thin air, and returns the transaction's ID. It is typically used to fund
+// the wallet, or to simulate a deposit.
+func (s *Server) Credit(addr types.UnlockHash, value types.Currency) types.TransactionID {
+	txid, _ := s.chain.Faucet(addr, value)
+	return txid
+}
+
+// Reorg replaces the most recent depth blocks with depth+1 new blocks, as
+// described by Chain.Reorg.
+func (s *Server) Reorg(depth int) ([]types.BlockID, error) {
+	return s.chain.Reorg(depth)
+}
+
+// Close shuts down the server and deletes its Tracker's database.
+func (s *Server) Close() error {
+	s.srv.Close()
+	err := s.Tracker.Close()
+	os.RemoveAll(s.dir)
+	return err
+}
@@ -0,0 +1,278 @@
+package walrustest
+
+import (
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+	"lukechampine.com/walrus"
+)
+
+func TestServer(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c := s.Client()
+
+	seed := wallet.NewSeed()
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0)),
+		KeyIndex:         0,
+	}
+	addr := info.UnlockConditions.UnlockHash()
+	if err := c.AddAddress(info); err != nil {
+		t.Fatal(err)
+	}
+
+	// fund the wallet
+	s.Credit(addr, types.SiacoinPrecision.Mul64(10))
+	if bal, err := c.Balance(false); err != nil {
+		t.Fatal(err)
+	} else if !bal.Equals(types.SiacoinPrecision.Mul64(10)) {
+		t.Fatal("wrong balance after credit:", bal)
+	} else if info, err := c.ConsensusInfo(); err != nil {
+		t.Fatal(err)
+	} else if info.Height != 1 {
+		t.Fatal("expected height 1, got", info.Height)
+	}
+
+	// send some of it
+	utxos, err := c.UnspentOutputs(false)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(utxos) != 1 {
+		t.Fatal("expected one output, got", len(utxos))
+	}
+	txn := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{
+			ParentID:         utxos[0].ID,
+			UnlockConditions: info.UnlockConditions,
+		}},
+		SiacoinOutputs: []types.SiacoinOutput{
+			{UnlockHash: types.UnlockHash{1}, Value: types.SiacoinPrecision.Mul64(4)},
+			{UnlockHash: addr, Value: types.SiacoinPrecision.Mul64(6)},
+		},
+	}
+	sig := wallet.StandardTransactionSignature(crypto.Hash(utxos[0].ID))
+	wallet.AppendTransactionSignature(&txn, sig, seed.SecretKey(0))
+	if _, err := c.Broadcast([]types.Transaction{txn}); err != nil {
+		t.Fatal(err)
+	} else if bal, _ := c.Balance(true); !bal.Equals(types.SiacoinPrecision.Mul64(6)) {
+		t.Fatal("wrong Limbo balance:", bal)
+	}
+
+	// spending the same output again should fail
+	double := txn
+	double.SiacoinOutputs = double.SiacoinOutputs[:1]
+	if _, err := c.Broadcast([]types.Transaction{double}); err == nil {
+		t.Fatal("expected double-spend to be rejected")
+	}
+
+	// once mined, the transaction should leave Limbo
+	s.MineBlock()
+	if limbo, err := c.LimboTransactions(); err != nil {
+		t.Fatal(err)
+	} else if len(limbo) != 0 {
+		t.Fatal("expected Limbo to be empty, got", len(limbo))
+	} else if bal, _ := c.Balance(false); !bal.Equals(types.SiacoinPrecision.Mul64(6)) {
+		t.Fatal("wrong balance after spend:", bal)
+	} else if txids, _ := c.Transactions(-1); len(txids) != 2 || txids[0] != txn.ID() {
+		t.Fatal("wrong transaction history:", txids)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c := s.Client()
+
+	seed := wallet.NewSeed()
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0)),
+		KeyIndex:         0,
+	}
+	addr := info.UnlockConditions.UnlockHash()
+	if err := c.AddAddress(info); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := c.ServerVersion(); err != nil {
+		t.Fatal(err)
+	} else if len(v.Features) == 0 || v.Features[len(v.Features)-1] != walrus.FeatureSandbox {
+		t.Fatal("sandbox feature not reported:", v.Features)
+	}
+
+	// mint some funds, then bury them
+	if _, err := c.SandboxFaucet(addr, types.ZeroCurrency); err == nil {
+		t.Fatal("expected zero-value faucet request to be rejected")
+	}
+	if _, err := c.SandboxFaucet(addr, types.SiacoinPrecision.Mul64(10)); err != nil {
+		t.Fatal(err)
+	} else if ids, err := c.SandboxMine(2); err != nil {
+		t.Fatal(err)
+	} else if len(ids) != 2 || s.Height() != 3 {
+		t.Fatal("wrong blocks mined:", ids, s.Height())
+	} else if bal, _ := c.Balance(false); !bal.Equals(types.SiacoinPrecision.Mul64(10)) {
+		t.Fatal("wrong balance after faucet:", bal)
+	}
+
+	// a reorg that does not reach the deposit leaves it intact
+	if ids, err := c.SandboxReorg(2); err != nil {
+		t.Fatal(err)
+	} else if len(ids) != 3 || s.Height() != 4 {
+		t.Fatal("wrong blocks after reorg:", ids, s.Height())
+	} else if bal, _ := c.Balance(false); !bal.Equals(types.SiacoinPrecision.Mul64(10)) {
+		t.Fatal("shallow reorg should not affect balance:", bal)
+	}
+
+	// a deeper reorg reverses it
+	if _, err := c.SandboxReorg(4); err != nil {
+		t.Fatal(err)
+	} else if s.Height() != 5 {
+		t.Fatal("wrong height after reorg:", s.Height())
+	} else if bal, _ := c.Balance(false); !bal.IsZero() {
+		t.Fatal("deposit should have been reverted:", bal)
+	}
+	if _, err := c.SandboxReorg(6); err == nil {
+		t.Fatal("expected reorg past genesis to be rejected")
+	}
+}
+
+func TestSendSiacoins(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c := s.Client()
+
+	seed := wallet.NewSeed()
+	info := wallet.SeedAddressInfo{
+		UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0)),
+		KeyIndex:         0,
+	}
+	if err := c.AddAddress(info); err != nil {
+		t.Fatal(err)
+	}
+	s.Credit(info.UnlockConditions.UnlockHash(), types.SiacoinPrecision.Mul64(10))
+
+	if _, err := c.SendSiacoins(seed, types.SiacoinPrecision.Mul64(11), types.UnlockHash{1}); err == nil {
+		t.Fatal("expected insufficient funds")
+	}
+	txid, err := c.SendSiacoins(seed, types.SiacoinPrecision.Mul64(3), types.UnlockHash{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the change can be spent before the first transaction is confirmed
+	txid2, err := c.SendSiacoinsMulti(seed, []types.SiacoinOutput{
+		{UnlockHash: types.UnlockHash{2}, Value: types.SiacoinPrecision.Mul64(2)},
+		{UnlockHash: types.UnlockHash{3}, Value: types.SiacoinPrecision.Mul64(1)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if limbo, _ := c.LimboTransactions(); len(limbo) != 2 {
+		t.Fatal("expected both transactions in Limbo, got", len(limbo))
+	}
+
+	s.MineBlock()
+	fees := types.ZeroCurrency
+	for _, id := range []types.TransactionID{txid, txid2} {
+		txn, err := c.Transaction(id)
+		if err != nil {
+			t.Fatal(err)
+		} else if fs := txn.Transaction.MinerFees; len(fs) != 1 || fs[0].IsZero() {
+			t.Fatal("transaction should pay a fee")
+		}
+		fees = fees.Add(txn.Transaction.MinerFees[0])
+	}
+	if bal, _ := c.Balance(false); !bal.Equals(types.SiacoinPrecision.Mul64(4).Sub(fees)) {
+		t.Fatal("wrong balance after sending:", bal)
+	} else if index, _ := c.SeedIndex(); index != 3 {
+		t.Fatal("expected a new change address for each transaction, got seed index", index)
+	}
+}
+
+func TestConstruct(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c := s.Client()
+
+	seed := wallet.NewSeed()
+	addrs := make([]types.UnlockHash, 2)
+	for i := range addrs {
+		info := wallet.SeedAddressInfo{
+			UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(uint64(i))),
+			KeyIndex:         uint64(i),
+		}
+		if err := c.AddAddress(info); err != nil {
+			t.Fatal(err)
+		}
+		addrs[i] = info.UnlockConditions.UnlockHash()
+	}
+	s.Credit(addrs[0], types.SiacoinPrecision.Mul64(10))
+
+	construct := func(value types.Currency) walrus.ResponseConstruct {
+		t.Helper()
+		resp, err := c.ConstructTransaction(walrus.RequestConstruct{
+			Outputs:       []types.SiacoinOutput{{UnlockHash: types.UnlockHash{1}, Value: value}},
+			ChangeAddress: addrs[1],
+			Fee:           "normal",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, in := range resp.Transaction.SiacoinInputs {
+			sig := wallet.StandardTransactionSignature(crypto.Hash(in.ParentID))
+			wallet.AppendTransactionSignature(&resp.Transaction, sig, seed.SecretKey(resp.KeyIndices[i]))
+		}
+		if _, err := c.Broadcast(append(resp.Parents, resp.Transaction)); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if _, err := c.ConstructTransaction(walrus.RequestConstruct{
+		Outputs:       []types.SiacoinOutput{{UnlockHash: types.UnlockHash{1}, Value: types.SiacoinPrecision.Mul64(11)}},
+		ChangeAddress: addrs[1],
+	}); err == nil {
+		t.Fatal("expected insufficient funds")
+	}
+	if resp := construct(types.SiacoinPrecision.Mul64(3)); len(resp.Parents) != 0 {
+		t.Fatal("expected no parents, got", len(resp.Parents))
+	} else if resp.Fee.Tier != "normal" {
+		t.Fatal("wrong fee tier:", resp.Fee.Tier)
+	}
+	// the second transaction spends the change of the first
+	if resp := construct(types.SiacoinPrecision.Mul64(5)); len(resp.Parents) != 1 {
+		t.Fatal("expected one parent, got", len(resp.Parents))
+	}
+
+	// a bundle can be signed offline; it spends the change of the second
+	b, err := c.ConstructBundle(walrus.RequestConstruct{
+		Outputs:       []types.SiacoinOutput{{UnlockHash: types.UnlockHash{1}, Value: types.SiacoinPrecision}},
+		ChangeAddress: addrs[1],
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(b.Parents) != 2 {
+		t.Fatal("expected two parents, got", len(b.Parents))
+	} else if err := walrus.SignBundle(&b, seed); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.Broadcast(b.TransactionSet()); err != nil {
+		t.Fatal(err)
+	}
+
+	s.MineBlock()
+	if limbo, _ := c.LimboTransactions(); len(limbo) != 0 {
+		t.Fatal("expected Limbo to be empty, got", len(limbo))
+	}
+}
@@ -0,0 +1,553 @@
+// Package walrustest provides an in-memory implementation of
+// walrus.WalletClient, for unit-testing code that interacts with a walrus
+// server.
+package walrustest
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/encoding"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+	"lukechampine.com/walrus"
+)
+
+// maxReserveCount is the maximum number of seed indices reserved in a single
+// call, matching the server's limit.
+const maxReserveCount = 1000
+
+// A Wallet is an in-memory walrus.WalletClient. It simulates a wallet
+// following a blockchain that advances only when MineBlock is called:
+// transaction sets passed to Broadcast are placed in Limbo, and are confirmed
+// once they are mined. Transactions are not validated.
+//
+// Errors are returned as *walrus.APIError, with the same status codes and
+// routes as the server, so they can be matched against the sentinel errors of
+// package walrus, e.g. walrus.ErrTransactionNotRelevant.
+//
+// A Wallet is safe for concurrent use.
+type Wallet struct {
+	mu           sync.Mutex
+	network      string
+	height       types.BlockHeight
+	ccid         crypto.Hash
+	minFee       types.Currency
+	maxFee       types.Currency
+	seedIndex    uint64
+	reserved     uint64
+	nonce        uint64
+	addrs        map[types.UnlockHash]wallet.SeedAddressInfo
+	outputs      map[types.SiacoinOutputID]walrus.ResponseUnspentOutput
+	txns         []walrus.ResponseTransactionsID // oldest first
+	limbo        []wallet.LimboTransaction
+	memos        map[types.TransactionID][]byte
+	broadcasts   [][]types.Transaction
+	broadcastErr error
+}
+
+var _ walrus.WalletClient = (*Wallet)(nil)
+
+// NewWallet returns an empty Wallet at height 0.
+func NewWallet() *Wallet {
+	fee := types.SiacoinPrecision.Div64(1e6) // 1 uS/byte
+	return &Wallet{
+		network: "mainnet",
+		minFee:  fee,
+		maxFee:  fee.Mul64(3),
+		addrs:   make(map[types.UnlockHash]wallet.SeedAddressInfo),
+		outputs: make(map[types.SiacoinOutputID]walrus.ResponseUnspentOutput),
+		memos:   make(map[types.TransactionID][]byte),
+	}
+}
+
+func apiError(code int, method, route, msg string) error {
+	return &walrus.APIError{
+		StatusCode: code,
+		Method:     method,
+		Route:      route,
+		Message:    msg,
+	}
+}
+
+// SetFees sets the fee estimate, in hastings per byte, reported by FeeTiers
+// and RecommendedFee.
+func (w *Wallet) SetFees(min, max types.Currency) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.minFee, w.maxFee = min, max
+}
+
+// SetBroadcastError causes subsequent calls to Broadcast to fail with err, e.g.
+// to simulate the transaction pool rejecting a transaction set. If err is nil,
+// Broadcast succeeds.
+func (w *Wallet) SetBroadcastError(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.broadcastErr = err
+}
+
+// Broadcasts returns the transaction sets successfully passed to Broadcast,
+// oldest first.
+func (w *Wallet) Broadcasts() [][]types.Transaction {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([][]types.Transaction(nil), w.broadcasts...)
+}
+
+// MineBlock adds a block containing txns to the simulated blockchain, along
+// with every transaction in Limbo, and returns its ID. Transactions relevant
+// to the wallet are added to its history, and their outputs are spent or
+// created accordingly.
+func (w *Wallet) MineBlock(txns ...types.Transaction) types.BlockID {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	txns = txns[:len(txns):len(txns)] // don't modify the caller's slice
+	for _, txn := range w.limbo {
+		txns = append(txns, txn.Transaction)
+	}
+	w.limbo = nil
+
+	w.height++
+	id := types.BlockID(crypto.HashObject(struct {
+		Parent       crypto.Hash
+		Height       types.BlockHeight
+		Transactions []types.Transaction
+	}{w.ccid, w.height, txns}))
+	w.ccid = crypto.Hash(id)
+	timestamp := time.Now()
+	for _, txn := range txns {
+		if !w.relevant(txn) {
+			continue
+		}
+		for _, sci := range txn.SiacoinInputs {
+			delete(w.outputs, sci.ParentID)
+		}
+		for _, o := range w.createdOutputs(txn) {
+			w.outputs[o.ID] = o
+		}
+		w.txns = append(w.txns, walrus.ResponseTransactionsID{
+			Transaction: txn,
+			BlockID:     id,
+			BlockHeight: w.height,
+			Timestamp:   timestamp,
+			FeePerByte:  feePerByte(txn),
+		})
+	}
+	return id
+}
+
+// Receive mines a block containing a transaction that sends value to addr,
+// and returns the transaction's ID. It is typically used to simulate a
+// deposit to one of the wallet's addresses.
+func (w *Wallet) Receive(addr types.UnlockHash, value types.Currency) types.TransactionID {
+	w.mu.Lock()
+	w.nonce++
+	txn := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{UnlockHash: addr, Value: value}},
+		// ensure that each transaction has a unique ID
+		ArbitraryData: [][]byte{[]byte("walrustest " + strconv.FormatUint(w.nonce, 10))},
+	}
+	w.mu.Unlock()
+	w.MineBlock(txn)
+	return txn.ID()
+}
+
+// relevant reports whether txn spends or creates an output belonging to the
+// wallet.
+func (w *Wallet) relevant(txn types.Transaction) bool {
+	for _, sci := range txn.SiacoinInputs {
+		if _, ok := w.outputs[sci.ParentID]; ok {
+			return true
+		} else if _, ok := w.addrs[sci.UnlockConditions.UnlockHash()]; ok {
+			return true
+		}
+	}
+	for _, sco := range txn.SiacoinOutputs {
+		if _, ok := w.addrs[sco.UnlockHash]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// createdOutputs returns the outputs created by txn that belong to the wallet.
+// As on the server, outputs are change if txn also spends from the wallet.
+func (w *Wallet) createdOutputs(txn types.Transaction) []walrus.ResponseUnspentOutput {
+	spendsWallet := false
+	for _, sci := range txn.SiacoinInputs {
+		_, ok := w.addrs[sci.UnlockConditions.UnlockHash()]
+		spendsWallet = spendsWallet || ok
+	}
+	var outputs []walrus.ResponseUnspentOutput
+	for i, sco := range txn.SiacoinOutputs {
+		if _, ok := w.addrs[sco.UnlockHash]; ok {
+			outputs = append(outputs, walrus.ResponseUnspentOutput{
+				UnspentOutput: wallet.UnspentOutput{
+					SiacoinOutput: sco,
+					ID:            txn.SiacoinOutputID(uint64(i)),
+				},
+				IsChange: spendsWallet,
+			})
+		}
+	}
+	return outputs
+}
+
+// feePerByte returns the fee paid by txn per byte of its encoding.
+func feePerByte(txn types.Transaction) types.Currency {
+	fees := types.ZeroCurrency
+	for _, fee := range txn.MinerFees {
+		fees = fees.Add(fee)
+	}
+	size := len(encoding.Marshal(txn))
+	if size == 0 {
+		return types.ZeroCurrency
+	}
+	return fees.Div64(uint64(size))
+}
+
+// unspentOutputs returns the wallet's unspent outputs, ordered by ID. If limbo
+// is true, outputs spent by Limbo transactions are excluded, and outputs
+// created by them are included.
+func (w *Wallet) unspentOutputs(limbo bool) []walrus.ResponseUnspentOutput {
+	outputs := make(map[types.SiacoinOutputID]walrus.ResponseUnspentOutput)
+	for id, o := range w.outputs {
+		outputs[id] = o
+	}
+	if limbo {
+		// outputs may be created and spent within Limbo, so add them all
+		// before removing any
+		for _, txn := range w.limbo {
+			for _, o := range w.createdOutputs(txn.Transaction) {
+				outputs[o.ID] = o
+			}
+		}
+		for _, txn := range w.limbo {
+			for _, sci := range txn.SiacoinInputs {
+				delete(outputs, sci.ParentID)
+			}
+		}
+	}
+	resp := make([]walrus.ResponseUnspentOutput, 0, len(outputs))
+	for _, o := range outputs {
+		resp = append(resp, o)
+	}
+	sort.Slice(resp, func(i, j int) bool {
+		return bytes.Compare(resp[i].ID[:], resp[j].ID[:]) < 0
+	})
+	return resp
+}
+
+// Addresses implements walrus.WalletClient.
+func (w *Wallet) Addresses() ([]types.UnlockHash, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	addrs := make([]types.UnlockHash, 0, len(w.addrs))
+	for addr := range w.addrs {
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// AddressInfo implements walrus.WalletClient.
+func (w *Wallet) AddressInfo(addr types.UnlockHash) (wallet.SeedAddressInfo, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	info, ok := w.addrs[addr]
+	if !ok {
+		return wallet.SeedAddressInfo{}, apiError(http.StatusNotFound, "GET", "/addresses/"+addr.String(), "No such entry")
+	}
+	return info, nil
+}
+
+// AddAddress implements walrus.WalletClient.
+func (w *Wallet) AddAddress(info wallet.SeedAddressInfo) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.addrs[info.UnlockConditions.UnlockHash()] = info
+	if info.KeyIndex >= w.seedIndex {
+		w.seedIndex = info.KeyIndex + 1
+	}
+	return nil
+}
+
+// RemoveAddress implements walrus.WalletClient.
+func (w *Wallet) RemoveAddress(addr types.UnlockHash) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.addrs, addr)
+	return nil
+}
+
+// SeedIndex implements walrus.WalletClient.
+func (w *Wallet) SeedIndex() (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.nextSeedIndex(), nil
+}
+
+func (w *Wallet) nextSeedIndex() uint64 {
+	if w.reserved > w.seedIndex {
+		return w.reserved
+	}
+	return w.seedIndex
+}
+
+// ReserveSeedIndices implements walrus.WalletClient.
+func (w *Wallet) ReserveSeedIndices(count int) (start, end uint64, err error) {
+	if count <= 0 || count > maxReserveCount {
+		return 0, 0, apiError(http.StatusBadRequest, "POST", "/seedindex/reserve", fmt.Sprintf("Invalid 'count' value: must be between 1 and %v", maxReserveCount))
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	start = w.nextSeedIndex()
+	end = start + uint64(count)
+	w.reserved = end
+	return start, end, nil
+}
+
+// ConsensusInfo implements walrus.WalletClient.
+func (w *Wallet) ConsensusInfo() (walrus.ResponseConsensus, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return walrus.ResponseConsensus{
+		Height:  w.height,
+		CCID:    w.ccid,
+		Network: w.network,
+	}, nil
+}
+
+// Balance implements walrus.WalletClient.
+func (w *Wallet) Balance(limbo bool) (types.Currency, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	bal := types.ZeroCurrency
+	for _, o := range w.unspentOutputs(limbo) {
+		bal = bal.Add(o.Value)
+	}
+	return bal, nil
+}
+
+// UnspentOutputs implements walrus.WalletClient. opts are ignored.
+func (w *Wallet) UnspentOutputs(limbo bool, opts ...walrus.ResponseOptions) ([]walrus.ResponseUnspentOutput, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.unspentOutputs(limbo), nil
+}
+
+// Transactions implements walrus.WalletClient.
+func (w *Wallet) Transactions(max int) ([]types.TransactionID, error) {
+	return w.transactions(max, func(types.Transaction) bool { return true }), nil
+}
+
+// TransactionsByAddress implements walrus.WalletClient.
+func (w *Wallet) TransactionsByAddress(addr types.UnlockHash, max int) ([]types.TransactionID, error) {
+	return w.transactions(max, func(txn types.Transaction) bool {
+		for _, sci := range txn.SiacoinInputs {
+			if sci.UnlockConditions.UnlockHash() == addr {
+				return true
+			}
+		}
+		for _, sco := range txn.SiacoinOutputs {
+			if sco.UnlockHash == addr {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+// transactions returns the IDs of at most max transactions selected by fn,
+// ordered newest-to-oldest. If max < 0, all such IDs are returned.
+func (w *Wallet) transactions(max int, fn func(types.Transaction) bool) []types.TransactionID {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var txids []types.TransactionID
+	for i := len(w.txns) - 1; i >= 0 && (max < 0 || len(txids) < max); i-- {
+		if fn(w.txns[i].Transaction) {
+			txids = append(txids, w.txns[i].Transaction.ID())
+		}
+	}
+	return txids
+}
+
+// Transaction implements walrus.WalletClient. opts are ignored.
+func (w *Wallet) Transaction(txid types.TransactionID, opts ...walrus.ResponseOptions) (walrus.ResponseTransactionsID, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, txn := range w.txns {
+		if txn.Transaction.ID() != txid {
+			continue
+		}
+		spendsWallet, internal := false, len(txn.Transaction.SiacoinInputs) > 0
+		for _, sci := range txn.Transaction.SiacoinInputs {
+			_, ok := w.addrs[sci.UnlockConditions.UnlockHash()]
+			spendsWallet = spendsWallet || ok
+			internal = internal && ok
+		}
+		txn.Inflow, txn.Outflow, txn.Change = types.ZeroCurrency, types.ZeroCurrency, types.ZeroCurrency
+		for _, sco := range txn.Transaction.SiacoinOutputs {
+			if _, ok := w.addrs[sco.UnlockHash]; ok {
+				txn.Inflow = txn.Inflow.Add(sco.Value)
+				if spendsWallet {
+					txn.Change = txn.Change.Add(sco.Value)
+				}
+			} else {
+				txn.Outflow = txn.Outflow.Add(sco.Value)
+				internal = false
+			}
+		}
+		txn.Internal = internal && len(txn.Transaction.FileContracts) == 0
+		return txn, nil
+	}
+	return walrus.ResponseTransactionsID{}, apiError(http.StatusNotFound, "GET", "/transactions/"+txid.String(), "Transaction not found")
+}
+
+// Memo implements walrus.WalletClient.
+func (w *Wallet) Memo(txid types.TransactionID) ([]byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]byte(nil), w.memos[txid]...), nil
+}
+
+// SetMemo implements walrus.WalletClient.
+func (w *Wallet) SetMemo(txid types.TransactionID, memo []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.memos[txid] = append([]byte(nil), memo...)
+	return nil
+}
+
+// FeeTiers implements walrus.WalletClient.
+func (w *Wallet) FeeTiers() ([]walrus.ResponseFeeTier, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	min, max := w.minFee, w.maxFee
+	if max.Cmp(min) < 0 {
+		max = min
+	}
+	return []walrus.ResponseFeeTier{
+		{Tier: walrus.FeeTierEconomy, FeePerByte: min, ConfirmationBlocks: 6},
+		{Tier: walrus.FeeTierNormal, FeePerByte: min.Add(max).Div64(2), ConfirmationBlocks: 3},
+		{Tier: walrus.FeeTierPriority, FeePerByte: max, ConfirmationBlocks: 1},
+	}, nil
+}
+
+// RecommendedFee implements walrus.WalletClient.
+func (w *Wallet) RecommendedFee() (types.Currency, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.minFee, nil
+}
+
+// UnconfirmedParents implements walrus.WalletClient.
+func (w *Wallet) UnconfirmedParents(txn types.Transaction) ([]wallet.LimboTransaction, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	spent := make(map[types.SiacoinOutputID]bool)
+	for _, sci := range txn.SiacoinInputs {
+		spent[sci.ParentID] = true
+	}
+	var parents []wallet.LimboTransaction
+	for _, ltxn := range w.limbo {
+		for i := range ltxn.SiacoinOutputs {
+			if spent[ltxn.SiacoinOutputID(uint64(i))] {
+				parents = append(parents, ltxn)
+				break
+			}
+		}
+	}
+	return parents, nil
+}
+
+// Broadcast implements walrus.WalletClient. The transactions are added to
+// Limbo, and confirmed by the next call to MineBlock.
+func (w *Wallet) Broadcast(txnSet []types.Transaction) (walrus.ResponseBroadcast, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.broadcastErr != nil {
+		return walrus.ResponseBroadcast{}, w.broadcastErr
+	} else if len(txnSet) == 0 {
+		return walrus.ResponseBroadcast{}, apiError(http.StatusBadRequest, "POST", "/broadcast", "Transaction set is empty")
+	}
+	for _, txn := range txnSet {
+		for _, ctxn := range w.txns {
+			if ctxn.Transaction.ID() == txn.ID() {
+				return walrus.ResponseBroadcast{}, apiError(http.StatusBadRequest, "POST", "/broadcast", "Transaction "+txn.ID().String()+" is already in the blockchain")
+			}
+		}
+	}
+	receipt := walrus.ResponseBroadcast{
+		Transactions: make([]walrus.ResponseBroadcastTransaction, len(txnSet)),
+	}
+	for i, txn := range txnSet {
+		w.addToLimbo(txn)
+		receipt.Transactions[i] = walrus.ResponseBroadcastTransaction{
+			ID:         txn.ID(),
+			Size:       len(encoding.Marshal(txn)),
+			FeePerByte: feePerByte(txn),
+			Result:     walrus.BroadcastAccepted,
+		}
+	}
+	w.broadcasts = append(w.broadcasts, append([]types.Transaction(nil), txnSet...))
+	return receipt, nil
+}
+
+// LimboTransactions implements walrus.WalletClient.
+func (w *Wallet) LimboTransactions() ([]wallet.LimboTransaction, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]wallet.LimboTransaction(nil), w.limbo...), nil
+}
+
+// LimboTransaction implements walrus.WalletClient.
+func (w *Wallet) LimboTransaction(txid types.TransactionID) (wallet.LimboTransaction, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, txn := range w.limbo {
+		if txn.ID() == txid {
+			return txn, nil
+		}
+	}
+	return wallet.LimboTransaction{}, apiError(http.StatusNotFound, "GET", "/limbo/"+txid.String(), "Transaction is not in Limbo")
+}
+
+// AddToLimbo implements walrus.WalletClient.
+func (w *Wallet) AddToLimbo(txn types.Transaction) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.addToLimbo(txn)
+	return nil
+}
+
+func (w *Wallet) addToLimbo(txn types.Transaction) {
+	for _, ltxn := range w.limbo {
+		if ltxn.ID() == txn.ID() {
+			return
+		}
+	}
+	w.limbo = append(w.limbo, wallet.LimboTransaction{
+		Transaction: txn,
+		LimboSince:  time.Now(),
+	})
+}
+
+// RemoveFromLimbo implements walrus.WalletClient.
+func (w *Wallet) RemoveFromLimbo(txid types.TransactionID) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, txn := range w.limbo {
+		if txn.ID() == txid {
+			w.limbo = append(w.limbo[:i], w.limbo[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
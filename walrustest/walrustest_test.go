@@ -0,0 +1,102 @@
+package walrustest
+
+import (
+	"errors"
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"lukechampine.com/us/wallet"
+	"lukechampine.com/walrus"
+)
+
+func testAddress(keyIndex uint64) wallet.SeedAddressInfo {
+	return wallet.SeedAddressInfo{
+		UnlockConditions: types.UnlockConditions{
+			PublicKeys:         []types.SiaPublicKey{types.Ed25519PublicKey(crypto.PublicKey{byte(keyIndex + 1)})},
+			SignaturesRequired: 1,
+		},
+		KeyIndex: keyIndex,
+	}
+}
+
+func TestWallet(t *testing.T) {
+	w := NewWallet()
+	var c walrus.WalletClient = w
+
+	deposit := testAddress(0)
+	change := testAddress(1)
+	depositAddr := deposit.UnlockConditions.UnlockHash()
+	changeAddr := change.UnlockConditions.UnlockHash()
+	c.AddAddress(deposit)
+	c.AddAddress(change)
+	if index, _ := c.SeedIndex(); index != 2 {
+		t.Fatal("expected seed index 2, got", index)
+	} else if start, end, _ := c.ReserveSeedIndices(3); start != 2 || end != 5 {
+		t.Fatal("wrong reservation:", start, end)
+	} else if index, _ := c.SeedIndex(); index != 5 {
+		t.Fatal("expected seed index 5 after reservation, got", index)
+	}
+
+	// receive a deposit
+	txid := w.Receive(depositAddr, types.SiacoinPrecision.Mul64(10))
+	if bal, _ := c.Balance(false); !bal.Equals(types.SiacoinPrecision.Mul64(10)) {
+		t.Fatal("wrong balance after deposit:", bal)
+	} else if txids, _ := c.TransactionsByAddress(depositAddr, -1); len(txids) != 1 || txids[0] != txid {
+		t.Fatal("deposit not recorded:", txids)
+	} else if txn, err := c.Transaction(txid); err != nil {
+		t.Fatal(err)
+	} else if !txn.Inflow.Equals(types.SiacoinPrecision.Mul64(10)) || txn.BlockHeight != 1 {
+		t.Fatal("wrong transaction info:", txn.Inflow, txn.BlockHeight)
+	}
+
+	// spend part of it
+	utxos, _ := c.UnspentOutputs(false)
+	if len(utxos) != 1 || utxos[0].IsChange {
+		t.Fatal("wrong outputs:", utxos)
+	}
+	spend := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{
+			ParentID:         utxos[0].ID,
+			UnlockConditions: deposit.UnlockConditions,
+		}},
+		SiacoinOutputs: []types.SiacoinOutput{
+			{UnlockHash: types.UnlockHash{1}, Value: types.SiacoinPrecision.Mul64(4)},
+			{UnlockHash: changeAddr, Value: types.SiacoinPrecision.Mul64(6)},
+		},
+	}
+	if _, err := c.Broadcast([]types.Transaction{spend}); err != nil {
+		t.Fatal(err)
+	} else if limbo, _ := c.LimboTransactions(); len(limbo) != 1 {
+		t.Fatal("expected transaction in Limbo")
+	} else if bal, _ := c.Balance(true); !bal.Equals(types.SiacoinPrecision.Mul64(6)) {
+		t.Fatal("wrong Limbo balance:", bal)
+	} else if bal, _ := c.Balance(false); !bal.Equals(types.SiacoinPrecision.Mul64(10)) {
+		t.Fatal("confirmed balance should not reflect Limbo:", bal)
+	}
+
+	// mine it
+	w.MineBlock()
+	if limbo, _ := c.LimboTransactions(); len(limbo) != 0 {
+		t.Fatal("expected Limbo to be empty")
+	} else if utxos, _ := c.UnspentOutputs(false); len(utxos) != 1 || !utxos[0].IsChange {
+		t.Fatal("expected a single change output:", utxos)
+	} else if txn, _ := c.Transaction(spend.ID()); !txn.Outflow.Equals(types.SiacoinPrecision.Mul64(4)) || !txn.Change.Equals(types.SiacoinPrecision.Mul64(6)) {
+		t.Fatal("wrong transaction info:", txn.Outflow, txn.Change)
+	} else if info, _ := c.ConsensusInfo(); info.Height != 2 {
+		t.Fatal("expected height 2, got", info.Height)
+	}
+
+	// errors should match the package's sentinel errors
+	if _, err := c.Transaction(types.TransactionID{1}); !errors.Is(err, walrus.ErrTransactionNotRelevant) {
+		t.Fatal("expected ErrTransactionNotRelevant, got", err)
+	} else if _, err := c.AddressInfo(types.UnlockHash{1}); !errors.Is(err, walrus.ErrAddressNotFound) {
+		t.Fatal("expected ErrAddressNotFound, got", err)
+	}
+	w.SetBroadcastError(errors.New("rejected"))
+	if _, err := c.Broadcast([]types.Transaction{{}}); err == nil {
+		t.Fatal("expected broadcast error")
+	} else if len(w.Broadcasts()) != 1 {
+		t.Fatal("failed broadcast should not be recorded")
+	}
+}
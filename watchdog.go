@@ -0,0 +1,147 @@
+package walrus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultSyncStallTimeout is the default period for which the consensus
+// height may stay the same before a SyncWatchdog reports a stall. Blocks are
+// found at random, and an hour occasionally passes without one.
+const DefaultSyncStallTimeout = 2 * time.Hour
+
+// syncNoPeersTimeout is the period for which the node may have no peers
+// before a SyncWatchdog reports a stall. Peers come and go, so a brief
+// disconnection is not a stall.
+const syncNoPeersTimeout = 5 * time.Minute
+
+// SyncStatus is the data for the EventSyncStalled and EventSyncResumed
+// events.
+type SyncStatus struct {
+	// Why sync has stalled. Empty if it has not.
+	Reason string `json:"reason,omitempty"`
+	// The height of the consensus set.
+	Height types.BlockHeight `json:"height"`
+	// When the height last advanced, or when the watchdog started.
+	LastAdvanced time.Time `json:"lastAdvanced"`
+	// The number of connected peers. Zero if unknown.
+	Peers int `json:"peers"`
+}
+
+// A SyncWatchdog detects when the consensus set has stopped syncing: when its
+// height has not advanced for a configurable period, or when the node has had
+// no peers for several minutes. Without it, a stalled node looks like a
+// wallet that simply isn't receiving deposits.
+type SyncWatchdog struct {
+	cs      ConsensusSet
+	g       Gateway
+	t       *Tracker
+	timeout time.Duration
+
+	mu        sync.Mutex
+	status    SyncStatus
+	peersSeen time.Time
+}
+
+// check updates the watchdog's status and, if the Tracker is set, emits an
+// event whenever sync stalls or resumes.
+func (sw *SyncWatchdog) check(now time.Time) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if h := sw.cs.Height(); h != sw.status.Height {
+		sw.status.Height = h
+		sw.status.LastAdvanced = now
+	}
+	sw.status.Peers = 0
+	if sw.g == nil {
+		sw.peersSeen = now
+	} else if sw.status.Peers = len(sw.g.Peers()); sw.status.Peers > 0 {
+		sw.peersSeen = now
+	}
+
+	wasStalled := sw.status.Reason != ""
+	sw.status.Reason = ""
+	if since := now.Sub(sw.peersSeen); since > syncNoPeersTimeout {
+		sw.status.Reason = fmt.Sprintf("no peers for %v", since.Round(time.Second))
+	} else if since := now.Sub(sw.status.LastAdvanced); since > sw.timeout {
+		sw.status.Reason = fmt.Sprintf("height has not advanced for %v", since.Round(time.Second))
+	}
+	if stalled := sw.status.Reason != ""; stalled != wasStalled && sw.t != nil {
+		typ := EventSyncResumed
+		if stalled {
+			typ = EventSyncStalled
+		}
+		sw.t.addSyncEvent(typ, sw.status)
+	}
+}
+
+// Status returns the watchdog's view of the consensus set, as of its most
+// recent check.
+func (sw *SyncWatchdog) Status() SyncStatus {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.status
+}
+
+// Run checks the consensus set periodically until ctx is cancelled.
+func (sw *SyncWatchdog) Run(ctx context.Context) error {
+	interval := sw.timeout / 4
+	if interval > time.Minute {
+		interval = time.Minute
+	} else if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			sw.check(now)
+		}
+	}
+}
+
+// NewSyncWatchdog returns a SyncWatchdog that reports a stall if the height of
+// cs does not advance within timeout, or if g has no peers. g may be nil, in
+// which case peers are not checked. If t is non-nil, EventSyncStalled and
+// EventSyncResumed events are added to its event log. The watchdog does not
+// check cs until Run is called.
+func NewSyncWatchdog(cs ConsensusSet, g Gateway, t *Tracker, timeout time.Duration) *SyncWatchdog {
+	now := time.Now()
+	return &SyncWatchdog{
+		cs:      cs,
+		g:       g,
+		t:       t,
+		timeout: timeout,
+		status: SyncStatus{
+			Height:       cs.Height(),
+			LastAdvanced: now,
+		},
+		peersSeen: now,
+	}
+}
+
+// addSyncEvent adds a sync watchdog event to the event log.
+func (t *Tracker) addSyncEvent(typ string, status SyncStatus) {
+	err := t.db.Update(func(tx *bolt.Tx) error {
+		var numBlocks uint64
+		getJSON(tx.Bucket(bucketMeta), keyNumBlocks, &numBlocks)
+		var height types.BlockHeight
+		if numBlocks > 0 {
+			height = types.BlockHeight(numBlocks - 1)
+		}
+		return addEvent(tx, typ, height, time.Now(), status)
+	})
+	if err != nil {
+		return
+	}
+	t.notifyPush()
+	t.notifyCallbacks()
+}
@@ -0,0 +1,112 @@
+package walrus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrEventsReset is returned by a Watcher when the server's event log no
+// longer contains events that the Watcher has already seen, e.g. because the
+// server was reset. Events may have been missed; the caller should
+// resynchronize (e.g. by re-checking deposits) and create a new Watcher.
+var ErrEventsReset = errors.New("server event log was reset")
+
+// A GapError is returned by a Watcher when events are permanently missing
+// from the server's event log. The Watcher's cursor is advanced past the gap.
+type GapError struct {
+	From, To uint64 // inclusive
+}
+
+// Error implements error.
+func (e *GapError) Error() string {
+	return fmt.Sprintf("events %v through %v are missing", e.From, e.To)
+}
+
+// A Watcher delivers the events emitted by a walrus server, in order and
+// without gaps. Since events are identified by sequence number, a Watcher can
+// resume from where it left off after a reconnect or restart; callers should
+// persist the Watcher's cursor after processing each batch of events.
+type Watcher struct {
+	c        *Client
+	cursor   uint64
+	interval time.Duration
+}
+
+// Cursor returns the sequence number of the last event delivered.
+func (w *Watcher) Cursor() uint64 {
+	return w.cursor
+}
+
+// poll fetches the events after the cursor, refetching if any appear to be
+// missing.
+func (w *Watcher) poll() ([]Event, error) {
+	const maxRetries = 3
+	var events []Event
+	for attempt := 0; ; attempt++ {
+		batch, err := w.c.EventsAfter(w.cursor, -1)
+		if err != nil {
+			return events, err
+		}
+		// deliver the contiguous prefix
+		next := w.cursor + 1
+		for len(batch) > 0 && batch[0].Seq == next {
+			events = append(events, batch[0])
+			w.cursor = next
+			batch = batch[1:]
+			next++
+		}
+		if len(batch) == 0 {
+			return events, nil
+		} else if attempt == maxRetries {
+			// the missing events are not coming back
+			gap := &GapError{From: next, To: batch[0].Seq - 1}
+			w.cursor = gap.To
+			return events, gap
+		}
+		time.Sleep(time.Duration(attempt+1) * 100 * time.Millisecond)
+	}
+}
+
+// checkReset returns ErrEventsReset if the server's latest event precedes the
+// cursor.
+func (w *Watcher) checkReset() error {
+	latest, err := w.c.Events(1)
+	if err != nil {
+		return err
+	} else if (len(latest) == 0 && w.cursor > 0) || (len(latest) > 0 && latest[0].Seq < w.cursor) {
+		return ErrEventsReset
+	}
+	return nil
+}
+
+// Next blocks until at least one new event is available, or ctx is canceled,
+// and returns the new events, ordered oldest-to-newest. If a non-nil error is
+// returned alongside events, the events should still be processed.
+func (w *Watcher) Next(ctx context.Context) ([]Event, error) {
+	for {
+		events, err := w.poll()
+		if len(events) > 0 || err != nil {
+			return events, err
+		} else if err := w.checkReset(); err != nil {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(w.interval):
+		}
+	}
+}
+
+// NewWatcher returns a Watcher that delivers the events emitted after the
+// specified sequence number, polling c at the specified interval. To receive
+// every event, pass 0.
+func NewWatcher(c *Client, after uint64, interval time.Duration) *Watcher {
+	return &Watcher{
+		c:        c,
+		cursor:   after,
+		interval: interval,
+	}
+}
@@ -0,0 +1,186 @@
+package walrus
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// This file implements the subset of RFC 6455 needed to stream events: the
+// opening handshake, unfragmented frames, and control frames.
+
+// WebSocket opcodes.
+const (
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+)
+
+// wsMaxPayload is the maximum size of a received frame payload.
+const wsMaxPayload = 1 << 20
+
+// websocketAccept returns the Sec-WebSocket-Accept value for a handshake with
+// the specified Sec-WebSocket-Key.
+func websocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// headerHasToken reports whether any value of the specified header contains
+// token in its comma-separated list.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isWebSocketUpgrade reports whether req is a WebSocket opening handshake.
+func isWebSocketUpgrade(req *http.Request) bool {
+	return headerHasToken(req.Header, "Connection", "upgrade") && headerHasToken(req.Header, "Upgrade", "websocket")
+}
+
+// checkOrigin reports whether a WebSocket handshake from req's Origin is
+// permitted. Browsers do not apply the same-origin policy to WebSockets, so
+// without this check, any web page could read the stream. Only pages served
+// by the server itself, or by one of the allowed origins, may connect;
+// non-browser clients send no Origin and are always permitted.
+func checkOrigin(req *http.Request, allowed []string) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, o := range allowed {
+		if strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, req.Host)
+}
+
+// upgradeWebSocket completes the server side of the opening handshake and
+// returns the hijacked connection. On failure, it writes an error response.
+func upgradeWebSocket(w http.ResponseWriter, req *http.Request, allowedOrigins []string) (net.Conn, *bufio.ReadWriter, error) {
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if key == "" || req.Header.Get("Sec-WebSocket-Version") != "13" {
+		http.Error(w, "Invalid WebSocket handshake", http.StatusBadRequest)
+		return nil, nil, errors.New("invalid handshake")
+	} else if !checkOrigin(req, allowedOrigins) {
+		http.Error(w, "WebSocket origin not allowed", http.StatusForbidden)
+		return nil, nil, errors.New("origin not allowed")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSockets are not supported by this server", http.StatusInternalServerError)
+		return nil, nil, errors.New("connection cannot be hijacked")
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n")
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, brw, nil
+}
+
+// writeFrame writes a single unfragmented frame. Clients must mask their
+// frames; servers must not.
+func writeFrame(w io.Writer, opcode byte, payload []byte, mask bool) error {
+	hdr := []byte{0x80 | opcode, 0}
+	switch n := len(payload); {
+	case n < 126:
+		hdr[1] = byte(n)
+	case n <= 0xFFFF:
+		hdr[1] = 126
+		hdr = append(hdr, 0, 0)
+		binary.BigEndian.PutUint16(hdr[2:], uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = append(hdr, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(hdr[2:], uint64(n))
+	}
+	if mask {
+		hdr[1] |= 0x80
+		key := make([]byte, 4)
+		rand.Read(key)
+		hdr = append(hdr, key...)
+		masked := make([]byte, len(payload))
+		for i := range payload {
+			masked[i] = payload[i] ^ key[i%4]
+		}
+		payload = masked
+	}
+	_, err := w.Write(append(hdr, payload...))
+	return err
+}
+
+// readFrame reads a single frame, unmasking its payload if necessary.
+// Fragmented messages are not supported. A server must set requireMask, since
+// clients must mask every frame (RFC 6455, section 5.1).
+func readFrame(r io.Reader, requireMask bool) (opcode byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	if hdr[0]&0x80 == 0 || hdr[0]&0x0F == 0 {
+		return 0, nil, errors.New("fragmented WebSocket messages are not supported")
+	}
+	opcode = hdr[0] & 0x0F
+	n := uint64(hdr[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxPayload {
+		return 0, nil, errors.New("WebSocket frame is too large")
+	}
+	var key [4]byte
+	masked := hdr[1]&0x80 != 0
+	if requireMask && !masked {
+		return 0, nil, errors.New("client sent an unmasked WebSocket frame")
+	} else if masked {
+		if _, err := io.ReadFull(r, key[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+	return opcode, payload, nil
+}